@@ -0,0 +1,421 @@
+// Cliente TypeScript: los tipos y rutas salen de src/schema.d.ts, generado
+// desde openapi.yaml en cada build.
+import createClient from "openapi-fetch";
+import type { components, paths } from "./schema";
+
+export type Job = components["schemas"]["Job"];
+export type JobEvent = components["schemas"]["JobEvent"];
+export type ProcessRequest = components["schemas"]["ProcessRequest"];
+export type ProcessResponse = components["schemas"]["ProcessResponse"];
+export type DryRunResult = components["schemas"]["DryRunResult"];
+export type SyncResponse = components["schemas"]["SyncResponse"];
+export type JobStatusSummary = components["schemas"]["JobStatusSummary"];
+export type Upload = components["schemas"]["Upload"];
+export type PresignedUpload = components["schemas"]["PresignedUpload"];
+export type MediaProbe = components["schemas"]["MediaProbe"];
+export type ProbeRequest = components["schemas"]["ProbeRequest"];
+export type Segment = components["schemas"]["Segment"];
+export type Chapter = components["schemas"]["Chapter"];
+export type TranscriptDocument = components["schemas"]["TranscriptDocument"];
+export type JobReview = components["schemas"]["JobReview"];
+export type Annotation = components["schemas"]["Annotation"];
+export type AnnotationRequest = components["schemas"]["AnnotationRequest"];
+export type ShareRequest = components["schemas"]["ShareRequest"];
+export type ShareLink = components["schemas"]["ShareLink"];
+export type GlossaryEntry = components["schemas"]["GlossaryEntry"];
+export type RetentionPolicy = components["schemas"]["RetentionPolicy"];
+export type RetentionDeletion = components["schemas"]["RetentionDeletion"];
+export type ErasureRequest = components["schemas"]["ErasureRequest"];
+export type ErasureReport = components["schemas"]["ErasureReport"];
+export type MetadataExport = components["schemas"]["MetadataExport"];
+export type AlertStatus = components["schemas"]["AlertStatus"];
+export type AlertNotification = components["schemas"]["AlertNotification"];
+export type JobTemplate = components["schemas"]["JobTemplate"];
+export type TemplateRequest = components["schemas"]["TemplateRequest"];
+export type CustomModel = components["schemas"]["CustomModel"];
+export type CustomModelRequest = components["schemas"]["CustomModelRequest"];
+export type Webhook = components["schemas"]["Webhook"];
+export type WebhookRequest = components["schemas"]["WebhookRequest"];
+export type WebhookEventInfo = components["schemas"]["WebhookEventInfo"];
+export type FeedItem = components["schemas"]["FeedItem"];
+export type Stats = components["schemas"]["Stats"];
+export type Integration = components["schemas"]["Integration"];
+export type IntegrationRequest = components["schemas"]["IntegrationRequest"];
+export type SFTPCredential = components["schemas"]["SFTPCredential"];
+export type SFTPCredentialRequest = components["schemas"]["SFTPCredentialRequest"];
+export type ManagedKey = components["schemas"]["ManagedKey"];
+export type KeyWithSecret = components["schemas"]["KeyWithSecret"];
+export type KeyRequest = components["schemas"]["KeyRequest"];
+export type AuditEvent = components["schemas"]["AuditEvent"];
+export type Session = components["schemas"]["Session"];
+export type Identity = components["schemas"]["Identity"];
+export type APIErrorBody = components["schemas"]["Error"];
+export type { components, paths };
+
+export class APIError extends Error {
+  constructor(
+    public status: number,
+    public code: string | undefined,
+    message: string,
+    public requestId?: string, // X-Request-ID, para citarlo al contactar con soporte
+  ) {
+    super(message);
+    this.name = "APIError";
+  }
+}
+
+export interface ClientOptions {
+  baseUrl: string;
+  apiKey?: string; // o el session_token de createSession
+  language?: "en" | "es" | "yo"; // idioma de los mensajes de error
+  fetch?: typeof fetch;
+  // Firma cada petición en lugar de enviar apiKey (keys con require_signature);
+  // keyId es el id de la key gestionada o el nombre de la estática
+  signingKey?: { keyId: string; secret: string };
+}
+
+const RETRYABLE = new Set([429, 502, 503, 504]);
+
+// HMAC-SHA256 en hex de prefix seguido de body
+async function hmacHex(secret: string, prefix: string, body: Uint8Array): Promise<string> {
+  const encoder = new TextEncoder();
+  const key = await crypto.subtle.importKey("raw", encoder.encode(secret), { name: "HMAC", hash: "SHA-256" }, false, ["sign"]);
+  const head = encoder.encode(prefix);
+  const data = new Uint8Array(head.length + body.length);
+  data.set(head);
+  data.set(body, head.length);
+  const sig = new Uint8Array(await crypto.subtle.sign("HMAC", key, data));
+  return Array.from(sig, (b) => b.toString(16).padStart(2, "0")).join("");
+}
+
+export function createTranscribeClient(options: ClientOptions) {
+  const api = createClient<paths>({
+    baseUrl: options.baseUrl.replace(/\/+$/, ""),
+    headers: {
+      ...(options.apiKey ? { "X-API-Key": options.apiKey } : {}),
+      ...(options.language ? { "Accept-Language": options.language } : {}),
+    },
+    fetch: options.fetch,
+  });
+
+  // X-Signature: HMAC de "<t>.<método>.<ruta con query>.<cuerpo>", como los webhooks
+  if (options.signingKey) {
+    const { keyId, secret } = options.signingKey;
+    api.use({
+      async onRequest(req) {
+        const url = new URL(req.url);
+        const body = new Uint8Array(await req.clone().arrayBuffer());
+        const ts = Math.floor(Date.now() / 1000).toString();
+        const sig = await hmacHex(secret, `${ts}.${req.method}.${url.pathname}${url.search}.`, body);
+        req.headers.set("X-Key-ID", keyId);
+        req.headers.set("X-Signature", `t=${ts},v1=${sig}`);
+        return req;
+      },
+    });
+  }
+  // Una firma no se puede repetir: los reintentos firmados caen en otro segundo
+  const retryDelay = options.signingKey ? 1000 : 500;
+
+  // Reintenta respuestas transitorias con espera lineal
+  async function withRetry<T>(
+    call: () => Promise<{ data?: T; error?: unknown; response: Response }>,
+    retries = 3,
+  ): Promise<T> {
+    for (let attempt = 0; ; attempt++) {
+      const { data, error, response } = await call();
+      if (data !== undefined && response.ok) {
+        return data;
+      }
+      if (response.ok) {
+        return undefined as T;
+      }
+      if (!RETRYABLE.has(response.status) || attempt >= retries) {
+        const body = (error ?? {}) as Partial<APIErrorBody>;
+        const requestId = body.request_id ?? response.headers.get("X-Request-ID") ?? undefined;
+        throw new APIError(response.status, body.code, body.error ?? response.statusText, requestId);
+      }
+      await new Promise((resolve) => setTimeout(resolve, (attempt + 1) * retryDelay));
+    }
+  }
+
+  const client = {
+    api,
+
+    process: (body: ProcessRequest) =>
+      withRetry<ProcessResponse | DryRunResult>(() => api.POST("/process", { body })) as Promise<ProcessResponse>,
+
+    // Valida la petición y comprueba el medio y el cupo sin crear el job
+    dryRun: (body: ProcessRequest) =>
+      withRetry<ProcessResponse | DryRunResult>(() =>
+        api.POST("/process", { params: { query: { dry_run: true } }, body }),
+      ) as Promise<DryRunResult>,
+
+    // Cuerpo ya comprimido si se indica encoding; sin reintentos (el stream
+    // no se puede releer)
+    upload: (body: BodyInit, filename: string, encoding?: "gzip" | "zstd") =>
+      withRetry<Upload>(
+        () =>
+          api.POST("/uploads", {
+            params: { query: { filename } },
+            body: body as unknown as string,
+            bodySerializer: (b: unknown) => b as BodyInit,
+            headers: { "Content-Type": "application/octet-stream", ...(encoding ? { "Content-Encoding": encoding } : {}) },
+          }),
+        0,
+      ),
+
+    // Enlace para subir el medio directamente al almacén con PUT; luego
+    // process({ upload_id })
+    presignUpload: (filename: string) =>
+      withRetry<PresignedUpload>(() => api.POST("/uploads", { body: { filename } })),
+
+    // Duración, códec y tiempo estimado sin crear el job
+    probe: (body: ProbeRequest) => withRetry<MediaProbe>(() => api.POST("/probe", { body })),
+
+    transcribeSync: (body: ProcessRequest) =>
+      withRetry<SyncResponse>(() => api.POST("/transcribe/sync", { body })),
+
+    // Canjea un ID token OIDC por una sesión; session_token sirve como apiKey
+    createSession: (idToken: string) =>
+      withRetry<Session>(() => api.POST("/auth/session", { body: { id_token: idToken } })),
+
+    me: () => withRetry<Identity>(() => api.GET("/auth/me")),
+
+    job: (jobId: string) =>
+      withRetry<Job>(() => api.GET("/result/{job_id}", { params: { path: { job_id: jobId } } })),
+
+    // Transcripción en el esquema versionado; sin schemaVersion, la actual
+    transcript: (jobId: string, schemaVersion?: string) =>
+      withRetry<TranscriptDocument>(() =>
+        api.GET("/result/{job_id}/transcript", {
+          params: { path: { job_id: jobId }, query: schemaVersion ? { schema_version: schemaVersion } : {} },
+        }),
+      ),
+
+    // Jobs por ID; p. ej. { review_status: "needs_review" } para la cola de revisión
+    jobs: (query: paths["/jobs"]["get"]["parameters"]["query"] = {}) =>
+      withRetry(() => api.GET("/jobs", { params: { query } })),
+
+    // Jobs terminados por cursor: { since: next_cursor } devuelve solo los nuevos
+    jobFeed: (query: paths["/jobs/feed"]["get"]["parameters"]["query"] = {}) =>
+      withRetry(() => api.GET("/jobs/feed", { params: { query } })),
+
+    stats: (query: paths["/stats"]["get"]["parameters"]["query"] = {}) =>
+      withRetry<Stats>(() => api.GET("/stats", { params: { query } })),
+
+    // Solo el estado, sin resultado; hasta BULK_STATUS_MAX_JOBS IDs
+    jobStatuses: (jobIds: string[]) => withRetry(() => api.POST("/jobs/status", { body: { job_ids: jobIds } })),
+
+    events: async (jobId: string) => {
+      const data = await withRetry(() =>
+        api.GET("/jobs/{job_id}/events", { params: { path: { job_id: jobId } } }),
+      );
+      return data.events ?? [];
+    },
+
+    // Repite un segmento; sin model ni prompt usa los del job
+    retranscribeSegment: (jobId: string, segId: number, body: { model?: string; prompt?: string } = {}) =>
+      withRetry(() =>
+        api.POST("/jobs/{job_id}/segments/{seg_id}/retranscribe", {
+          params: { path: { job_id: jobId, seg_id: segId } },
+          body,
+        }),
+      ),
+
+    // Revisión humana de jobs creados con review: true; el revisor es el
+    // nombre de la API key
+    review: (jobId: string, action: "claim" | "release" | "approve") =>
+      withRetry<JobReview>(() =>
+        api.POST("/jobs/{job_id}/review/{action}", {
+          params: { path: { job_id: jobId, action } },
+        }),
+      ),
+
+    annotations: (jobId: string) =>
+      withRetry(() => api.GET("/jobs/{job_id}/annotations", { params: { path: { job_id: jobId } } })),
+
+    // Comenta un tramo (start-end o el de segment_id) de un job completado
+    createAnnotation: (jobId: string, body: AnnotationRequest) =>
+      withRetry<Annotation>(() => api.POST("/jobs/{job_id}/annotations", { params: { path: { job_id: jobId } }, body })),
+
+    deleteAnnotation: (jobId: string, annotationId: string) =>
+      withRetry(() =>
+        api.DELETE("/jobs/{job_id}/annotations/{annotation_id}", {
+          params: { path: { job_id: jobId, annotation_id: annotationId } },
+        }),
+      ),
+
+    // Enlace público de solo lectura; expires_in vacío = SHARE_LINK_TTL
+    share: (jobId: string, body: ShareRequest = {}) =>
+      withRetry<ShareLink>(() => api.POST("/jobs/{job_id}/share", { params: { path: { job_id: jobId } }, body })),
+
+    revokeShares: (jobId: string) =>
+      withRetry(() => api.DELETE("/jobs/{job_id}/share", { params: { path: { job_id: jobId } } })),
+
+    // Consulta el job hasta que termina; un job fallido u omitido se devuelve sin lanzar
+    async wait(jobId: string, intervalMs = 2000, signal?: AbortSignal): Promise<Job> {
+      for (;;) {
+        const job = await client.job(jobId);
+        if (job.status === "completed" || job.status === "failed" || job.status === "skipped") {
+          return job;
+        }
+        if (signal?.aborted) {
+          throw new Error("wait aborted");
+        }
+        await new Promise((resolve) => setTimeout(resolve, intervalMs));
+      }
+    },
+
+    async processAndWait(body: ProcessRequest, intervalMs = 2000, signal?: AbortSignal): Promise<Job> {
+      const created = await client.process(body);
+      return client.wait(created.job_id, intervalMs, signal);
+    },
+
+    glossary: async () => {
+      const data = await withRetry(() => api.GET("/glossary"));
+      return data.entries ?? [];
+    },
+
+    setGlossary: (entries: GlossaryEntry[]) =>
+      withRetry(() => api.PUT("/glossary", { body: { entries } })),
+
+    retention: () => withRetry(() => api.GET("/retention")),
+
+    setRetention: (body: RetentionPolicy) => withRetry(() => api.PUT("/retention", { body })),
+
+    retentionDeletions: async (limit?: number) => {
+      const data = await withRetry(() => api.GET("/retention/deletions", { params: { query: { limit } } }));
+      return data.deletions ?? [];
+    },
+
+    // Borra los jobs terminados de un interesado; devuelve el informe firmado
+    eraseSubjectData: (body: ErasureRequest) =>
+      withRetry(() => api.POST("/admin/erasure", { body }), 0),
+
+    // Instantánea de los metadatos de los jobs (CSV o Parquet) en el almacén
+    exportMetadata: (format?: "csv" | "parquet") =>
+      withRetry<MetadataExport>(() => api.POST("/admin/exports", { body: format ? { format } : {} }), 0),
+
+    metadataExports: async () => {
+      const data = await withRetry(() => api.GET("/admin/exports"));
+      return data.exports ?? [];
+    },
+
+    // Reglas de alerta con su último valor y si disparan
+    alerts: async () => {
+      const data = await withRetry(() => api.GET("/admin/alerts"));
+      return data.alerts ?? [];
+    },
+
+    templates: async () => {
+      const data = await withRetry(() => api.GET("/templates"));
+      return data.templates ?? [];
+    },
+
+    // Sin reintentos: un 409 tras un reintento ocultaría que se creó
+    createTemplate: (body: TemplateRequest) =>
+      withRetry<JobTemplate>(() => api.POST("/templates", { body }), 0),
+
+    updateTemplate: (name: string, body: TemplateRequest) =>
+      withRetry<JobTemplate>(() =>
+        api.PUT("/templates/{template_name}", { params: { path: { template_name: name } }, body }),
+      ),
+
+    deleteTemplate: (name: string) =>
+      withRetry(() => api.DELETE("/templates/{template_name}", { params: { path: { template_name: name } } })),
+
+    features: async () => {
+      const data = await withRetry(() => api.GET("/features"));
+      return data.features;
+    },
+
+    models: () => withRetry(() => api.GET("/models")),
+
+    putModel: (name: string, body: CustomModelRequest) =>
+      withRetry<CustomModel>(() => api.PUT("/models/{model_name}", { params: { path: { model_name: name } }, body })),
+
+    deleteModel: (name: string) =>
+      withRetry(() => api.DELETE("/models/{model_name}", { params: { path: { model_name: name } } })),
+
+    webhookEvents: async () => {
+      const data = await withRetry(() => api.GET("/webhooks/events"));
+      return data.events ?? [];
+    },
+
+    webhooks: async () => {
+      const data = await withRetry(() => api.GET("/webhooks"));
+      return data.webhooks ?? [];
+    },
+
+    // Sin reintentos: un POST repetido registraría dos webhooks
+    createWebhook: (body: WebhookRequest) =>
+      withRetry<Webhook>(() => api.POST("/webhooks", { body }), 0),
+
+    updateWebhook: (webhookId: string, body: WebhookRequest) =>
+      withRetry<Webhook>(() =>
+        api.PATCH("/webhooks/{webhook_id}", { params: { path: { webhook_id: webhookId } }, body }),
+      ),
+
+    deleteWebhook: (webhookId: string) =>
+      withRetry(() => api.DELETE("/webhooks/{webhook_id}", { params: { path: { webhook_id: webhookId } } })),
+
+    integrations: async () => {
+      const data = await withRetry(() => api.GET("/integrations"));
+      return data.integrations ?? [];
+    },
+
+    // Sin reintentos: un POST repetido exportaría dos veces cada transcripción
+    createIntegration: (body: IntegrationRequest) =>
+      withRetry<Integration>(() => api.POST("/integrations", { body }), 0),
+
+    updateIntegration: (integrationId: string, body: IntegrationRequest) =>
+      withRetry<Integration>(() =>
+        api.PATCH("/integrations/{integration_id}", { params: { path: { integration_id: integrationId } }, body }),
+      ),
+
+    deleteIntegration: (integrationId: string) =>
+      withRetry(() =>
+        api.DELETE("/integrations/{integration_id}", { params: { path: { integration_id: integrationId } } }),
+      ),
+
+    sftpCredentials: async () => {
+      const data = await withRetry(() => api.GET("/sftp/credentials"));
+      return data.credentials ?? [];
+    },
+
+    putSFTPCredential: (host: string, body: SFTPCredentialRequest) =>
+      withRetry<SFTPCredential>(() => api.PUT("/sftp/credentials/{host}", { params: { path: { host } }, body })),
+
+    deleteSFTPCredential: (host: string) =>
+      withRetry(() => api.DELETE("/sftp/credentials/{host}", { params: { path: { host } } })),
+
+    keys: async () => {
+      const data = await withRetry(() => api.GET("/keys"));
+      return data.keys ?? [];
+    },
+
+    // Sin reintentos: un POST repetido crearía dos keys
+    createKey: (body: KeyRequest) => withRetry<KeyWithSecret>(() => api.POST("/keys", { body }), 0),
+
+    revokeKey: (keyId: string) =>
+      withRetry(() => api.DELETE("/keys/{key_id}", { params: { path: { key_id: keyId } } })),
+
+    // Sin reintentos: cada rotación invalida el secreto de la anterior
+    rotateKey: (keyId: string) =>
+      withRetry<KeyWithSecret>(() => api.POST("/keys/{key_id}/rotate", { params: { path: { key_id: keyId } } }), 0),
+
+    // Lista vacía: la key vuelve a aceptarse desde cualquier IP
+    setKeyAllowedCIDRs: (keyId: string, allowedCidrs: string[]) =>
+      withRetry<ManagedKey>(() =>
+        api.PATCH("/keys/{key_id}", { params: { path: { key_id: keyId } }, body: { allowed_cidrs: allowedCidrs } }),
+      ),
+
+    auditEvents: async (type?: AuditEvent["type"], limit?: number) => {
+      const data = await withRetry(() => api.GET("/audit", { params: { query: { type, limit } } }));
+      return data.events ?? [];
+    },
+
+    capacity: () => withRetry(() => api.GET("/capacity")),
+  };
+  return client;
+}
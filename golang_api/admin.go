@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Todos los jobs, del más antiguo al más reciente: del almacén compartido
+// si lo hay (incluye los de otras réplicas) o de memoria
+func loadJobRecords(ctx context.Context) ([]JobRecord, error) {
+	if stateStore != nil {
+		return stateStore.LoadJobs(ctx)
+	}
+	mu.RLock()
+	records := make([]JobRecord, 0, len(jobStore))
+	for id, job := range jobStore {
+		rec := JobRecord{ID: id, Job: *job, Events: jobEvents[id]}
+		if meta, ok := jobMetas[id]; ok {
+			rec.Meta = *meta
+		}
+		records = append(records, rec)
+	}
+	mu.RUnlock()
+	sort.Slice(records, func(i, j int) bool { return records[i].Job.Timestamp.Before(records[j].Job.Timestamp) })
+	return records, nil
+}
+
+// Job en la vista de operación: sin resultados, con el worker que lo
+// ejecuta y hasta cuándo vale su concesión
+type AdminJob struct {
+	JobID          string     `json:"job_id"`
+	Type           string     `json:"type"`
+	Status         string     `json:"status"`
+	APIKey         string     `json:"api_key,omitempty"`
+	Tenant         string     `json:"tenant,omitempty"`
+	Backend        string     `json:"backend,omitempty"`
+	ClaimedBy      string     `json:"claimed_by,omitempty"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+	LeaseExpired   bool       `json:"lease_expired,omitempty"` // el worker dejó de renovarla
+	Timestamp      time.Time  `json:"timestamp"`
+}
+
+// GET /admin/jobs lista todos los jobs con su concesión, leídos del almacén
+// compartido si lo hay
+func adminJobsHandler(c *gin.Context) {
+	records, err := loadJobRecords(c.Request.Context())
+	if abortOnDeadline(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+
+	now := time.Now()
+	jobs := make([]AdminJob, 0, len(records))
+	tenant := currentTenant(c)
+	for _, rec := range records {
+		if !isOperator(c) && rec.Meta.Tenant != tenant {
+			continue
+		}
+		job := AdminJob{
+			JobID:     rec.ID,
+			Type:      rec.Job.Type,
+			Status:    rec.Job.Status,
+			APIKey:    rec.Job.APIKey,
+			Tenant:    rec.Meta.Tenant,
+			Backend:   rec.Job.Backend,
+			Timestamp: rec.Job.Timestamp,
+		}
+		if claim := rec.Claim; claim != nil {
+			expiry := claim.LeaseExpiresAt
+			job.ClaimedBy = claim.WorkerID
+			job.LeaseExpiresAt = &expiry
+			job.LeaseExpired = expiry.Before(now)
+		}
+		jobs = append(jobs, job)
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
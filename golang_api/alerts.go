@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Métricas sobre las que se definen las reglas de alerta
+const (
+	AlertFailureRate = "failure_rate" // failed / (completed + failed) de los jobs terminados en la ventana; skipped no cuenta
+	AlertQueueDepth  = "queue_depth"  // jobs en queued de todas las réplicas
+)
+
+// Estados de una alerta en las notificaciones
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+const alertsSetting = "alerts"
+
+// Regla de alerta de CONFIG_FILE (alert_rules). Se dispara cuando el valor
+// supera threshold y se resuelve cuando deja de superarlo; cada cambio se
+// notifica una vez.
+type AlertRule struct {
+	Name      string   `json:"name"`
+	Metric    string   `json:"metric"`
+	Threshold float64  `json:"threshold"` // failure_rate como fracción: 0.2 = 20 %
+	Window    Duration `json:"window"`    // failure_rate: jobs terminados en este plazo
+	MinJobs   int      `json:"min_jobs"`  // failure_rate: sin tantos jobs terminados no se evalúa
+}
+
+// Estado de una regla tras la última evaluación, en GET /admin/alerts
+type AlertStatus struct {
+	AlertRule
+	Value       float64    `json:"value"`
+	Firing      bool       `json:"firing"`
+	Since       *time.Time `json:"since,omitempty"`        // desde cuándo dispara
+	EvaluatedAt *time.Time `json:"evaluated_at,omitempty"` // vacío si aún no se evaluó
+}
+
+// Cuerpo enviado a ALERT_WEBHOOK_URL
+type AlertNotification struct {
+	Rule      string    `json:"rule"`
+	Metric    string    `json:"metric"`
+	State     string    `json:"state"` // firing o resolved
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	At        time.Time `json:"at"`
+}
+
+// Último estado de cada regla, por nombre. Lo escribe el líder; las demás
+// réplicas lo leen del almacén.
+var alertsMu sync.Mutex
+var alertStates = make(map[string]AlertStatus)
+
+// Valores de las métricas a partir de los jobs del almacén de estado. ok es
+// false si la regla no tiene datos suficientes y no cambia de estado.
+func alertValue(rule AlertRule, records []JobRecord, now time.Time) (float64, bool) {
+	switch rule.Metric {
+	case AlertQueueDepth:
+		queued := 0
+		for _, rec := range records {
+			if rec.Job.Status == "queued" {
+				queued++
+			}
+		}
+		return float64(queued), true
+	case AlertFailureRate:
+		since := now.Add(-rule.Window.Duration)
+		var completed, failed int
+		for _, rec := range records {
+			if !isTerminalStatus(rec.Job.Status) || rec.Job.Status == "skipped" {
+				continue
+			}
+			if at, ok := finishedAt(rec.Events); !ok || at.Before(since) {
+				continue
+			}
+			if rec.Job.Status == "failed" {
+				failed++
+			} else {
+				completed++
+			}
+		}
+		if completed+failed == 0 || completed+failed < rule.MinJobs {
+			return 0, false
+		}
+		return round2(float64(failed) / float64(completed+failed)), true
+	}
+	return 0, false
+}
+
+// Evalúa todas las reglas y notifica las que cambian de estado
+func evaluateAlerts(ctx context.Context) error {
+	records, err := loadJobRecords(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	alertsMu.Lock()
+	var changed []AlertNotification
+	for _, rule := range cfg.AlertRules {
+		status := alertStates[rule.Name]
+		status.AlertRule = rule
+		status.EvaluatedAt = &now
+		value, ok := alertValue(rule, records, now)
+		if !ok {
+			alertStates[rule.Name] = status
+			continue
+		}
+		status.Value = value
+		firing := value > rule.Threshold
+		if firing != status.Firing {
+			state := AlertResolved
+			status.Since = nil
+			if firing {
+				state = AlertFiring
+				status.Since = &now
+			}
+			changed = append(changed, AlertNotification{Rule: rule.Name, Metric: rule.Metric, State: state, Value: value, Threshold: rule.Threshold, At: now})
+		}
+		status.Firing = firing
+		alertStates[rule.Name] = status
+	}
+	err = saveAlertStatesLocked()
+	alertsMu.Unlock()
+	if err != nil {
+		log.Printf("⚠️ No se pudo guardar el estado de las alertas: %v", err)
+	}
+
+	for _, alert := range changed {
+		if alert.State == AlertFiring {
+			log.Printf("⚠️ Alerta %s: %s = %g supera %g", alert.Rule, alert.Metric, alert.Value, alert.Threshold)
+		} else {
+			log.Printf("🚀 Alerta %s resuelta: %s = %g", alert.Rule, alert.Metric, alert.Value)
+		}
+		if err := notifyAlert(ctx, alert); err != nil {
+			log.Printf("❌ No se pudo notificar la alerta %s: %v", alert.Rule, err)
+		}
+	}
+	return nil
+}
+
+func saveAlertStatesLocked() error {
+	if stateStore == nil {
+		return nil
+	}
+	data, err := json.Marshal(alertStates)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal alert states")
+	}
+	return stateStore.SaveSetting(alertsSetting, data)
+}
+
+// Estado guardado por el líder anterior, para no repetir las notificaciones
+// de las alertas que ya disparaban
+func loadAlertStates() (map[string]AlertStatus, error) {
+	if stateStore == nil {
+		alertsMu.Lock()
+		defer alertsMu.Unlock()
+		states := make(map[string]AlertStatus, len(alertStates))
+		for name, status := range alertStates {
+			states[name] = status
+		}
+		return states, nil
+	}
+	data, err := stateStore.LoadSetting(alertsSetting)
+	if err != nil || data == nil {
+		return map[string]AlertStatus{}, err
+	}
+	states := make(map[string]AlertStatus)
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, errors.Wrap(err, "corrupt alert states")
+	}
+	return states, nil
+}
+
+// Envía la notificación a Slack y al webhook configurados
+func notifyAlert(ctx context.Context, alert AlertNotification) error {
+	var failures []string
+	if cfg.AlertSlackWebhookURL != "" {
+		text := fmt.Sprintf(":rotating_light: *%s* is firing: %s is %g (threshold %g)", alert.Rule, alert.Metric, alert.Value, alert.Threshold)
+		if alert.State == AlertResolved {
+			text = fmt.Sprintf(":white_check_mark: *%s* resolved: %s is %g (threshold %g)", alert.Rule, alert.Metric, alert.Value, alert.Threshold)
+		}
+		body, _ := json.Marshal(gin.H{"text": text})
+		if err := postAlert(ctx, cfg.AlertSlackWebhookURL, body, ""); err != nil {
+			failures = append(failures, "slack: "+err.Error())
+		}
+	}
+	if cfg.AlertWebhookURL != "" {
+		body, _ := json.Marshal(alert)
+		if err := postAlert(ctx, cfg.AlertWebhookURL, body, liveSecret(&cfg.AlertWebhookSecret)); err != nil {
+			failures = append(failures, "webhook: "+err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// POST con los reintentos de los webhooks (WEBHOOK_MAX_ATTEMPTS, espera
+// WEBHOOK_RETRY_BACKOFF que se duplica). Con secreto se firma como los
+// webhooks de los tenants, en X-Alert-Signature.
+func postAlert(ctx context.Context, target string, body []byte, secret string) error {
+	client := &http.Client{Timeout: cfg.WebhookTimeout.Duration}
+	backoff := cfg.WebhookRetryBackoff.Duration
+	var err error
+	for attempt := 1; attempt <= cfg.WebhookMaxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+		if err != nil {
+			return errors.Wrap(err, "invalid alert request")
+		}
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		req.Header.Set("User-Agent", "transcribe-whisper-alerts")
+		if secret != "" {
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			req.Header.Set("X-Alert-Signature", "t="+ts+",v1="+webhookHMAC(secret, ts, body))
+		}
+		if err = doProviderRequest(client, req, nil); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Evaluación de las reglas en el líder cada ALERT_EVALUATION_INTERVAL
+func runAlertEvaluator(ctx context.Context) {
+	states, err := loadAlertStates()
+	if err != nil {
+		log.Printf("⚠️ No se pudo leer el estado de las alertas: %v", err)
+	}
+	alertsMu.Lock()
+	for _, rule := range cfg.AlertRules {
+		if status, ok := states[rule.Name]; ok {
+			alertStates[rule.Name] = status
+		}
+	}
+	alertsMu.Unlock()
+
+	ticker := time.NewTicker(cfg.AlertEvaluationInterval.Duration)
+	defer ticker.Stop()
+	for {
+		if err := evaluateAlerts(ctx); err != nil {
+			log.Printf("⚠️ No se pudieron evaluar las alertas: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GET /admin/alerts devuelve las reglas con su último valor y si disparan
+func listAlertsHandler(c *gin.Context) {
+	states, err := loadAlertStates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+	alerts := make([]AlertStatus, 0, len(cfg.AlertRules))
+	for _, rule := range cfg.AlertRules {
+		status := states[rule.Name]
+		status.AlertRule = rule
+		alerts = append(alerts, status)
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"alerts": alerts})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Texto corregido a alinear con el audio del job
+type AlignRequestBody struct {
+	Text string `json:"text" binding:"required"`
+}
+
+// Petición al backend de alineación forzada
+type AlignerRequest struct {
+	URL      string `json:"url"`
+	FilePath string `json:"file_path,omitempty"`
+	Text     string `json:"text"`
+	Language string `json:"language,omitempty"`
+}
+
+// Respuesta del backend de alineación: segmentos o solo palabras
+type AlignerResponse struct {
+	Segments []Segment `json:"segments"`
+	Words    []Word    `json:"words"`
+}
+
+func alignJobHandler(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	var input AlignRequestBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if cfg.AlignerURL == "" {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "alignment backend is not configured"})
+		return
+	}
+
+	job, exists := getJob(jobID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if job.Status != "completed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "only completed jobs can be aligned"})
+		return
+	}
+	meta, _ := getJobMeta(jobID)
+
+	req := AlignerRequest{
+		URL:      meta.Input.URL,
+		Text:     input.Text,
+		Language: job.Language,
+	}
+	if meta.MediaPath != "" {
+		req.FilePath = backendPath(meta.MediaPath)
+	}
+
+	aligned, err := callAligner(c.Request.Context(), req)
+	if err != nil {
+		recordEvent(jobID, JobEvent{Type: EventError, Code: "ALIGNMENT_FAILED", Message: err.Error()})
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "code": "ALIGNMENT_FAILED"})
+		return
+	}
+
+	// La transcripción corregida pasa a ser la del job
+	updateJob(jobID, func(job *JobState) {
+		job.Transcription = input.Text
+		job.Segments = aligned
+		job.Stats = computeStats(&BackendResponse{
+			Transcription: input.Text,
+			Language:      job.Language,
+			Segments:      aligned,
+		}, job.Duration)
+	})
+	recordEvent(jobID, JobEvent{Type: EventEdit, Message: "transcript re-aligned"})
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{
+		"job_id":   jobID,
+		"segments": aligned,
+	})
+}
+
+func callAligner(ctx context.Context, req AlignerRequest) ([]Segment, error) {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal alignment request")
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(cfg.AlignerURL, "/")+"/align", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid aligner URL")
+	}
+	httpReq.Header.Set("Content-Type", "application/json; charset=utf-8")
+	httpReq.Header.Set("Accept-Charset", "utf-8")
+
+	client := &http.Client{Timeout: cfg.AlignTimeout.Duration}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to alignment backend")
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read alignment response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("alignment backend responded with status %d: %s", resp.StatusCode, body)
+	}
+
+	if body, err = decodeCharset(body, resp.Header.Get("Content-Type")); err != nil {
+		return nil, errors.Wrap(err, "invalid alignment response encoding")
+	}
+	var result AlignerResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, errors.Wrap(err, "failed to parse alignment response")
+	}
+	normalizeStrings(reflect.ValueOf(&result))
+
+	if len(result.Segments) == 0 && len(result.Words) > 0 {
+		result.Segments = []Segment{{
+			Start: result.Words[0].Start,
+			End:   result.Words[len(result.Words)-1].End,
+			Text:  req.Text,
+			Words: result.Words,
+		}}
+	}
+	if len(result.Segments) == 0 {
+		return nil, errors.New("alignment backend returned no timestamps")
+	}
+	return result.Segments, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Máximo de rangos en allowed_cidrs de una key
+const maxAllowedCIDRs = 50
+
+// Valida allowed_cidrs y lo deja en forma canónica; una IP suelta es su /32
+// (o /128)
+func normalizeAllowedCIDRs(cidrs []string) ([]string, error) {
+	if len(cidrs) > maxAllowedCIDRs {
+		return nil, errors.Errorf("at most %d ranges are allowed in allowed_cidrs", maxAllowedCIDRs)
+	}
+	out := make([]string, 0, len(cidrs))
+	for _, raw := range cidrs {
+		raw = strings.TrimSpace(raw)
+		if ip := net.ParseIP(raw); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			raw = fmt.Sprintf("%s/%d", ip, bits)
+		}
+		_, network, err := net.ParseCIDR(raw)
+		if err != nil {
+			return nil, errors.Errorf("invalid CIDR %q in allowed_cidrs", raw)
+		}
+		out = append(out, network.String())
+	}
+	return out, nil
+}
+
+// Sin allowed_cidrs la key vale desde cualquier IP
+func (k *APIKey) allowsIP(ip string) bool {
+	if k == nil || len(k.AllowedCIDRs) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, cidr := range k.AllowedCIDRs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// IP con la que se comprueba allowed_cidrs. X-Forwarded-For solo cuenta si
+// la conexión llega desde TRUSTED_PROXIES; sin proxies de confianza vale la
+// del socket, que el cliente no puede falsear.
+func allowlistClientIP(c *gin.Context) string {
+	if len(cfg.TrustedProxies) == 0 {
+		return c.RemoteIP()
+	}
+	return c.ClientIP()
+}
+
+// Rechaza con 403 la petición de una key desde fuera de sus rangos y lo
+// deja en el registro de auditoría. false si la rechazó.
+func checkKeyIP(c *gin.Context, key *APIKey) bool {
+	ip := allowlistClientIP(c)
+	if key.allowsIP(ip) {
+		return true
+	}
+	log.Printf("⚠️ API key %s usada desde una IP fuera de allowed_cidrs: %s (%s %s)", key.Name, ip, c.Request.Method, c.Request.URL.Path)
+	audit.record(AuditEvent{
+		Type:      AuditIPDenied,
+		Tenant:    key.tenant(),
+		APIKey:    key.Name,
+		ClientIP:  ip,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		RequestID: requestID(c),
+		Message:   "API key used from outside its allowed_cidrs",
+	})
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key is not allowed from this IP address", "code": "IP_NOT_ALLOWED"})
+	return false
+}
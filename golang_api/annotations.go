@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Límites de las anotaciones de un job
+const (
+	maxAnnotationsPerJob   = 500
+	maxAnnotationChars     = 2000
+	maxAnnotationAuthor    = 128
+	annotationEndTolerance = 0.5 // segundos que se admiten tras el final de la transcripción
+)
+
+// Comentario sobre un tramo de la transcripción de un job completado
+type Annotation struct {
+	ID        string    `json:"id"`
+	Author    string    `json:"author"`
+	Start     float64   `json:"start"`
+	End       float64   `json:"end"`
+	SegmentID *int      `json:"segment_id,omitempty"` // segmento comentado, si se indicó
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AnnotationBody struct {
+	Author    string   `json:"author"` // por defecto el nombre de la API key
+	Start     *float64 `json:"start"`  // sin start ni end, el tramo del segmento
+	End       *float64 `json:"end"`
+	SegmentID *int     `json:"segment_id"`
+	Text      string   `json:"text"`
+}
+
+var errTooManyAnnotations = errors.Errorf("a job can have at most %d annotations", maxAnnotationsPerJob)
+
+// Final de la transcripción, o 0 si no se conoce
+func transcriptEnd(job JobState) float64 {
+	if n := len(job.Segments); n > 0 {
+		return job.Segments[n-1].End
+	}
+	return job.Duration
+}
+
+// Valida la anotación contra el job y la devuelve completa, sin ID
+func newAnnotation(c *gin.Context, job JobState, input AnnotationBody) (Annotation, error) {
+	a := Annotation{Author: strings.TrimSpace(input.Author), SegmentID: input.SegmentID, Text: strings.TrimSpace(input.Text)}
+	if a.Author == "" {
+		if key := currentAPIKey(c); key != nil {
+			a.Author = key.Name
+		}
+	}
+	switch {
+	case a.Author == "":
+		return a, errors.New("author is required")
+	case utf8.RuneCountInString(a.Author) > maxAnnotationAuthor:
+		return a, errors.Errorf("author must be at most %d characters", maxAnnotationAuthor)
+	case a.Text == "":
+		return a, errors.New("text is required")
+	case utf8.RuneCountInString(a.Text) > maxAnnotationChars:
+		return a, errors.Errorf("text must be at most %d characters", maxAnnotationChars)
+	case (input.Start == nil) != (input.End == nil):
+		return a, errors.New("start and end must be set together")
+	case input.Start == nil && input.SegmentID == nil:
+		return a, errors.New("start and end, or segment_id, are required")
+	}
+	if input.SegmentID != nil {
+		seg, ok := findSegment(job.Segments, *input.SegmentID)
+		if !ok {
+			return a, errors.New("segment not found")
+		}
+		a.Start, a.End = seg.Start, seg.End
+	}
+	if input.Start != nil {
+		a.Start, a.End = *input.Start, *input.End
+	}
+	if a.Start < 0 || a.End < a.Start {
+		return a, errors.New("start must be non-negative and not after end")
+	}
+	if end := transcriptEnd(job); end > 0 && a.End > end+annotationEndTolerance {
+		return a, errors.Errorf("end must not be after the end of the transcript (%.2fs)", end)
+	}
+	return a, nil
+}
+
+// Copia de las anotaciones de un job, por start y después por creación
+func getAnnotations(jobID string) ([]Annotation, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	meta, ok := jobMetas[jobID]
+	if !ok {
+		return nil, false
+	}
+	annotations := make([]Annotation, len(meta.Annotations))
+	copy(annotations, meta.Annotations)
+	sort.SliceStable(annotations, func(i, j int) bool { return annotations[i].Start < annotations[j].Start })
+	return annotations, true
+}
+
+// POST /jobs/:job_id/annotations añade un comentario a un tramo de la
+// transcripción
+func createAnnotationHandler(c *gin.Context) {
+	var input AnnotationBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	jobID := c.Param("job_id")
+	job, exists := getJob(jobID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if job.Type != JobTypeTranscription || job.Status != "completed" || job.PurgedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "annotations require a completed job with its transcript"})
+		return
+	}
+	annotation, err := newAnnotation(c, job, input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_REQUEST"})
+		return
+	}
+	annotation.ID = uuid.NewString()
+	annotation.CreatedAt = time.Now().UTC()
+
+	found, err := addAnnotation(jobID, annotation)
+	switch {
+	case !found:
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+	case err != nil:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "ANNOTATION_LIMIT"})
+	default:
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.JSON(http.StatusCreated, annotation)
+	}
+}
+
+// GET /jobs/:job_id/annotations lista las anotaciones en orden de start
+func listAnnotationsHandler(c *gin.Context) {
+	annotations, ok := getAnnotations(c.Param("job_id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"annotations": annotations})
+}
+
+// DELETE /jobs/:job_id/annotations/:annotation_id
+func deleteAnnotationHandler(c *gin.Context) {
+	jobFound, found := removeAnnotation(c.Param("job_id"), c.Param("annotation_id"))
+	switch {
+	case !jobFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+	case !found:
+		c.JSON(http.StatusNotFound, gin.H{"error": "annotation not found"})
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// Guarda la anotación con su evento bajo mu
+func addAnnotation(jobID string, a Annotation) (bool, error) {
+	mu.Lock()
+	defer unlockJobs()
+	meta, ok := jobMetas[jobID]
+	if !ok {
+		return false, nil
+	}
+	if len(meta.Annotations) >= maxAnnotationsPerJob {
+		return true, errTooManyAnnotations
+	}
+	meta.Annotations = append(meta.Annotations, a)
+	// El evento guarda el job con la anotación
+	appendEventLocked(jobID, JobEvent{
+		Type:    EventAnnotation,
+		Message: fmt.Sprintf("annotation %s added by %s at %.2f-%.2fs", a.ID, a.Author, a.Start, a.End),
+	})
+	return true, nil
+}
+
+func removeAnnotation(jobID, annotationID string) (jobFound, found bool) {
+	mu.Lock()
+	defer unlockJobs()
+	meta, ok := jobMetas[jobID]
+	if !ok {
+		return false, false
+	}
+	for i, a := range meta.Annotations {
+		if a.ID == annotationID {
+			// Copia nueva: las de getJobMeta comparten el array
+			meta.Annotations = append(meta.Annotations[:i:i], meta.Annotations[i+1:]...)
+			appendEventLocked(jobID, JobEvent{Type: EventAnnotation, Message: fmt.Sprintf("annotation %s deleted", annotationID)})
+			return true, true
+		}
+	}
+	return true, false
+}
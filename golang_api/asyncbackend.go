@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Valores de BACKEND_PROTOCOL
+const (
+	BackendProtocolAuto = "auto" // v2 con los backends que lo anuncian en /capacity
+	BackendProtocolV1   = "v1"   // POST /transcribe abierto durante todo el job
+	BackendProtocolV2   = "v2"   // POST /jobs y callback o sondeo de GET /jobs/{id}
+)
+
+// Ruta a la que los backends con protocolo v2 avisan de que un job terminó
+const backendCallbackPrefix = "/backend/callback/"
+
+// Veces que se vuelve a enviar un job que el backend ya no conoce
+const maxBackendResubmits = 3
+
+// Estados finales de un job en el backend; antes está queued o running
+const (
+	backendJobCompleted = "completed"
+	backendJobFailed    = "failed"
+)
+
+// Cuerpo de POST {backend}/jobs: la petición de v1 con el ID del job y la
+// URL del callback. Un job_id ya conocido devuelve ese job (si falló, el
+// backend lo empieza otra vez): tras reiniciar el gateway se vuelve a
+// esperar el mismo job en lugar de repetir el trabajo.
+type backendJobRequest struct {
+	PythonRequest
+	JobID       string `json:"job_id"`
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// Job en el backend, en la respuesta de POST /jobs y GET /jobs/{id}
+type backendJob struct {
+	JobID     string            `json:"job_id"`
+	Status    string            `json:"status"`
+	Segments  []json.RawMessage `json:"segments,omitempty"` // parciales mientras corre
+	Result    json.RawMessage   `json:"result,omitempty"`   // la respuesta de v1 al completarse
+	Error     string            `json:"error,omitempty"`
+	Retryable bool              `json:"retryable,omitempty"`
+}
+
+// Jobs de este proceso que esperan el callback de su backend. El callback
+// solo adelanta el siguiente sondeo: si llega a otra réplica el job se
+// entera igual al sondear.
+type backendCallbackWaits struct {
+	mu    sync.Mutex
+	waits map[string][]chan struct{}
+}
+
+var backendCallbacks = &backendCallbackWaits{waits: make(map[string][]chan struct{})}
+
+func (w *backendCallbackWaits) register(id string) chan struct{} {
+	ch := make(chan struct{}, 1)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.waits[id] = append(w.waits[id], ch)
+	return ch
+}
+
+func (w *backendCallbackWaits) unregister(id string, ch chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	list := w.waits[id]
+	for i, c := range list {
+		if c == ch {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(w.waits, id)
+		return
+	}
+	w.waits[id] = list
+}
+
+func (w *backendCallbackWaits) notify(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ch := range w.waits[id] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Protocolo con el backend según BACKEND_PROTOCOL y su última capacidad
+func (p *backendPool) protocol(baseURL string) string {
+	switch mode := live().BackendProtocol; mode {
+	case BackendProtocolV1, BackendProtocolV2:
+		return mode
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, b := range p.backends {
+		if b.URL == baseURL && b.Capacity != nil && b.Capacity.Protocol >= 2 {
+			return BackendProtocolV2
+		}
+	}
+	return BackendProtocolV1
+}
+
+// ID del job en el backend: el mismo para el mismo job y la misma petición,
+// de modo que un reenvío encuentra el job que ya estaba en marcha
+func backendJobID(payload PythonRequest) string {
+	data, _ := json.Marshal(payload)
+	sum := sha256.Sum256([]byte(payload.JobID + "\n" + payload.RequestID + "\n" + string(data)))
+	return hex.EncodeToString(sum[:16])
+}
+
+func backendCallbackToken(id string) string {
+	mac := hmac.New(sha256.New, []byte(cfg.BackendCallbackSecret))
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// URL del callback del job; vacía sin BACKEND_CALLBACK_SECRET (solo sondeo)
+func backendCallbackURL(id string) string {
+	base := cfg.BackendCallbackURL
+	if base == "" {
+		base = cfg.PublicBaseURL
+	}
+	if cfg.BackendCallbackSecret == "" || base == "" {
+		return ""
+	}
+	return strings.TrimRight(base, "/") + backendCallbackPrefix + url.PathEscape(id) + "?token=" + backendCallbackToken(id)
+}
+
+// Llamadas del gateway a los jobs de un backend
+type backendJobClient struct {
+	client    *http.Client
+	baseURL   string
+	requestID string
+}
+
+// Hace la petición y decodifica el job; status es el código HTTP
+func (b *backendJobClient) do(ctx context.Context, method, path string, body interface{}) (*backendJob, int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, 0, &backendError{code: "INTERNAL_ERROR", message: errors.Wrap(err, "failed to marshal JSON payload").Error()}
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, b.baseURL+path, reader)
+	if err != nil {
+		return nil, 0, &backendError{code: "INTERNAL_ERROR", message: errors.Wrap(err, "failed to build backend request").Error()}
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Accept-Charset", "utf-8")
+	if b.requestID != "" {
+		req.Header.Set(requestIDHeader, b.requestID)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, 0, &backendError{code: "BACKEND_UNAVAILABLE", message: errors.Wrap(err, "failed to connect to whisper service").Error(), retryable: true}
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, &backendError{code: "BACKEND_UNAVAILABLE", message: errors.Wrap(err, "failed to read response body").Error(), retryable: true}
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, resp.StatusCode, nil
+	case resp.StatusCode >= 300:
+		return nil, resp.StatusCode, &backendError{code: "BACKEND_ERROR", message: string(data), retryable: resp.StatusCode >= 500}
+	case method == http.MethodDelete:
+		return nil, resp.StatusCode, nil
+	}
+	if data, err = decodeBackendCharset(b.baseURL, data, resp.Header.Get("Content-Type")); err != nil {
+		return nil, resp.StatusCode, err
+	}
+	var job backendJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, resp.StatusCode, &backendError{code: "INVALID_BACKEND_RESPONSE", message: errors.Wrap(err, "failed to parse backend job").Error(), retryable: true}
+	}
+	return &job, resp.StatusCode, nil
+}
+
+func (b *backendJobClient) submit(ctx context.Context, id string, payload PythonRequest) error {
+	body := backendJobRequest{PythonRequest: payload, JobID: id, CallbackURL: backendCallbackURL(id)}
+	_, status, err := b.do(ctx, http.MethodPost, "/jobs", body)
+	if err == nil && status == http.StatusNotFound {
+		return &backendError{code: "BACKEND_ERROR", message: fmt.Sprintf("backend %s does not support protocol v2 (POST /jobs)", b.baseURL)}
+	}
+	return err
+}
+
+// Protocolo v2: encola el job en el backend y espera al callback o, cada
+// BACKEND_POLL_INTERVAL, consulta su estado. Sin conexión abierta durante
+// el job, el backend puede reiniciarse: lo que no responde durante
+// BACKEND_RESTART_GRACE falla, y un job que el backend olvidó se reenvía.
+// Cancelar ctx deja de esperarlo.
+func callBackendAsync(ctx context.Context, baseURL string, payload PythonRequest) (*BackendResponse, error) {
+	b := &backendJobClient{client: &http.Client{Timeout: 30 * time.Second}, baseURL: baseURL, requestID: payload.RequestID}
+	id := backendJobID(payload)
+	wake := backendCallbacks.register(id)
+	defer backendCallbacks.unregister(id, wake)
+
+	payload.Partials.begin()
+	if err := b.submit(ctx, id, payload); err != nil {
+		return nil, err
+	}
+	// Terminado o abandonado, el backend ya no necesita guardarlo
+	defer func() {
+		if _, _, err := b.do(context.Background(), http.MethodDelete, "/jobs/"+url.PathEscape(id), nil); err != nil {
+			log.Printf("⚠️ No se pudo borrar el job %s del backend %s: %v", id, baseURL, err)
+		}
+	}()
+
+	c := live()
+	deadline := time.Now().Add(c.BackendJobTimeout.Duration)
+	ticker := time.NewTicker(c.BackendPollInterval.Duration)
+	defer ticker.Stop()
+	var unreachableSince time.Time
+	published, resubmits := 0, 0
+	for {
+		job, status, err := b.do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil)
+		var berr *backendError
+		switch {
+		case errors.As(err, &berr) && berr.retryable:
+			// Reiniciándose (o su proxy responde 502): se sigue sondeando
+			// hasta agotar el margen
+			if unreachableSince.IsZero() {
+				unreachableSince = time.Now()
+				log.Printf("⚠️ Backend %s sin respuesta para el job %s: %v", baseURL, id, err)
+			}
+			if time.Since(unreachableSince) > c.BackendRestartGrace.Duration {
+				return nil, err
+			}
+		case err != nil:
+			return nil, err
+		case status == http.StatusNotFound:
+			// El backend se reinició sin sus jobs: se vuelve a enviar
+			if resubmits == maxBackendResubmits {
+				return nil, &backendError{code: "BACKEND_ERROR", message: fmt.Sprintf("backend %s lost job %s %d times", baseURL, id, resubmits+1), retryable: true}
+			}
+			resubmits++
+			unreachableSince = time.Time{}
+			log.Printf("⚠️ El backend %s no conoce el job %s: reenviando (%d/%d)", baseURL, id, resubmits, maxBackendResubmits)
+			payload.Partials.begin()
+			published = 0
+			if err := b.submit(ctx, id, payload); err != nil {
+				return nil, err
+			}
+		default:
+			unreachableSince = time.Time{}
+			switch job.Status {
+			case backendJobCompleted:
+				if len(job.Result) == 0 {
+					return nil, &backendError{code: "INVALID_BACKEND_RESPONSE", message: "completed backend job has no result", retryable: true}
+				}
+				return parseBackendResult(baseURL, job.Result)
+			case backendJobFailed:
+				return nil, &backendError{code: "BACKEND_ERROR", message: job.Error, retryable: job.Retryable}
+			}
+			published = publishBackendSegments(baseURL, job.Segments, published, payload.Partials)
+		}
+
+		if time.Now().After(deadline) {
+			return nil, &backendError{code: "BACKEND_TIMEOUT", message: fmt.Sprintf("backend job did not finish within %s", c.BackendJobTimeout.Duration), retryable: true}
+		}
+		select {
+		case <-wake:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Publica los parciales nuevos desde el último sondeo; devuelve cuántos van.
+// Igual que en el streaming de v1, uno fuera de contrato se descarta.
+func publishBackendSegments(baseURL string, segments []json.RawMessage, published int, partials *partialTranscript) int {
+	for ; published < len(segments); published++ {
+		seg, violations, err := decodeBackendSegment(segments[published])
+		if err != nil {
+			log.Printf("⚠️ Segmento parcial del backend %s descartado: %v", baseURL, err)
+			continue
+		}
+		if len(violations) > 0 {
+			log.Printf("⚠️ Segmento parcial del backend %s descartado: %s", baseURL, backendContractMessage(violations))
+			continue
+		}
+		partials.add(seg)
+	}
+	return published
+}
+
+// POST /backend/callback/:backend_job_id avisa de que un job del backend
+// terminó; se autentica con el token de la URL que recibió el backend
+func backendCallbackHandler(c *gin.Context) {
+	id := c.Param("backend_job_id")
+	if cfg.BackendCallbackSecret == "" || !hmac.Equal([]byte(c.Query("token")), []byte(backendCallbackToken(id))) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid backend callback token", "code": "FORBIDDEN"})
+		return
+	}
+	backendCallbacks.notify(id)
+	c.Status(http.StatusNoContent)
+}
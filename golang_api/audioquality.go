@@ -0,0 +1,69 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Calidad del audio de entrada, para explicar una transcripción pobre
+type AudioQuality struct {
+	BackgroundMusic bool     `json:"background_music"` // heurística: sonido continuo, sin pausas de habla
+	SNRDB           *float64 `json:"snr_db,omitempty"` // nivel RMS sobre el suelo de ruido; sin suelo medible se omite
+	NoiseFloorDB    *float64 `json:"noise_floor_db,omitempty"`
+	RMSLevelDB      float64  `json:"rms_level_db"`
+	PeakLevelDB     float64  `json:"peak_level_db"`
+	ClippingRatio   float64  `json:"clipping_ratio"` // fracción de muestras saturadas
+	Clipped         bool     `json:"clipped"`
+}
+
+// El habla tiene pausas; por debajo de esta fracción de silencio en un audio
+// de al menos musicMinDuration segundos se asume música u otro fondo
+const (
+	musicMaxPauseRatio = 0.02
+	musicMinDuration   = 30
+)
+
+// A partir de esta fracción de muestras a fondo de escala se marca clipped
+const clippingThreshold = 0.001
+
+var astatsLinePattern = regexp.MustCompile(`\] ([A-Za-z ]+): (-?[0-9.]+|-?inf)`)
+
+// Lee la sección Overall del log de astats
+func audioQuality(log string, speechRatio, duration float64) *AudioQuality {
+	i := strings.LastIndex(log, "] Overall")
+	if i < 0 {
+		return nil
+	}
+	values := make(map[string]float64)
+	for _, m := range astatsLinePattern.FindAllStringSubmatch(log[i:], -1) {
+		v, err := strconv.ParseFloat(m[2], 64)
+		if err != nil || math.IsInf(v, 0) {
+			continue // -inf en silencio digital
+		}
+		values[m[1]] = v
+	}
+
+	q := &AudioQuality{
+		RMSLevelDB:  round2(values["RMS level dB"]),
+		PeakLevelDB: round2(values["Peak level dB"]),
+	}
+	// Sin Noise floor (ffmpeg antiguo) el valle RMS es la mejor aproximación
+	floor, ok := values["Noise floor dB"]
+	if !ok {
+		floor, ok = values["RMS trough dB"]
+	}
+	if ok {
+		floor = round2(floor)
+		snr := round2(values["RMS level dB"] - floor)
+		q.NoiseFloorDB, q.SNRDB = &floor, &snr
+	}
+	if samples := values["Number of samples"]; samples > 0 && values["Peak level dB"] >= -0.1 {
+		q.ClippingRatio = math.Min(1, values["Peak count"]/samples)
+		q.ClippingRatio = math.Round(q.ClippingRatio*1e4) / 1e4
+	}
+	q.Clipped = q.ClippingRatio >= clippingThreshold
+	q.BackgroundMusic = duration >= musicMinDuration && 1-speechRatio < musicMaxPauseRatio
+	return q
+}
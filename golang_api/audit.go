@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Nombre del ajuste compartido con el registro de auditoría
+const auditSetting = "audit_log"
+
+// Eventos que se conservan entre todos los tenants; los más antiguos se
+// descartan
+const maxAuditEvents = 1000
+
+// Tipos de AuditEvent
+const (
+	AuditIPDenied         = "api_key.ip_denied"         // petición con una key desde fuera de allowed_cidrs
+	AuditAllowlistUpdated = "api_key.allowlist_updated" // allowed_cidrs de una key gestionada cambiado
+)
+
+// Entrada del registro de auditoría del tenant
+type AuditEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Tenant    string    `json:"tenant,omitempty"`
+	APIKey    string    `json:"api_key,omitempty"` // key afectada o usada
+	Actor     string    `json:"actor,omitempty"`   // key que hizo el cambio
+	ClientIP  string    `json:"client_ip,omitempty"`
+	Method    string    `json:"method,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// Registro de auditoría. Cada réplica acumula sus eventos y los añade al
+// almacén en cada sincronización de ajustes; sin almacén solo conoce los
+// suyos.
+type auditLog struct {
+	mu      sync.Mutex
+	events  []AuditEvent // los del almacén tras la última sincronización
+	pending []AuditEvent // de esta réplica, aún sin guardar
+}
+
+var audit = &auditLog{}
+
+// Conserva los max más recientes
+func trimAuditEvents(events []AuditEvent, max int) []AuditEvent {
+	if len(events) > max {
+		events = append([]AuditEvent(nil), events[len(events)-max:]...)
+	}
+	return events
+}
+
+func (a *auditLog) record(event AuditEvent) {
+	event.ID = uuid.NewString()
+	event.Time = time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if stateStore == nil {
+		a.events = trimAuditEvents(append(a.events, event), maxAuditEvents)
+		return
+	}
+	a.pending = trimAuditEvents(append(a.pending, event), maxAuditEvents)
+}
+
+// Eventos del tenant, el más reciente primero; typ vacío no filtra
+func (a *auditLog) list(tenant, typ string, limit int) []AuditEvent {
+	a.mu.Lock()
+	all := append(append([]AuditEvent(nil), a.events...), a.pending...)
+	a.mu.Unlock()
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Time.After(all[j].Time) })
+	out := []AuditEvent{}
+	for _, e := range all {
+		if e.Tenant != tenant || (typ != "" && e.Type != typ) {
+			continue
+		}
+		out = append(out, e)
+		if len(out) == limit {
+			break
+		}
+	}
+	return out
+}
+
+func loadAuditEvents() ([]AuditEvent, error) {
+	data, err := stateStore.LoadSetting(auditSetting)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var events []AuditEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, errors.Wrap(err, "corrupt audit log")
+	}
+	return events, nil
+}
+
+// Añade al almacén los eventos pendientes de esta réplica y relee los de
+// las demás
+func flushAuditLog() error {
+	audit.mu.Lock()
+	pending := audit.pending
+	audit.pending = nil
+	audit.mu.Unlock()
+	requeue := func() {
+		audit.mu.Lock()
+		audit.pending = trimAuditEvents(append(pending, audit.pending...), maxAuditEvents)
+		audit.mu.Unlock()
+	}
+
+	events, err := loadAuditEvents()
+	if err != nil {
+		requeue()
+		return err
+	}
+	if len(pending) > 0 {
+		events = append(events, pending...)
+		sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+		events = trimAuditEvents(events, maxAuditEvents)
+		data, err := json.Marshal(events)
+		if err != nil {
+			requeue()
+			return errors.Wrap(err, "failed to marshal audit log")
+		}
+		if err := stateStore.SaveSetting(auditSetting, data); err != nil {
+			requeue()
+			return err
+		}
+	}
+	audit.mu.Lock()
+	audit.events = events
+	audit.mu.Unlock()
+	return nil
+}
+
+// GET /audit lista el registro de auditoría del tenant, el más reciente
+// primero
+func listAuditHandler(c *gin.Context) {
+	limit := 100
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxAuditEvents {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000", "code": "INVALID_REQUEST"})
+			return
+		}
+		limit = n
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"events": audit.list(currentTenant(c), c.Query("type"), limit)})
+}
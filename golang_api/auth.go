@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API key estática definida en CONFIG_FILE
+type APIKey struct {
+	Key               string `json:"key"`
+	Name              string `json:"name"`                          // identificador visible en los jobs (nunca la key)
+	MaxConcurrentJobs int    `json:"max_concurrent_jobs,omitempty"` // 0 usa el valor por defecto
+	Tenant            string `json:"tenant,omitempty"`              // varias keys pueden compartir tenant; por defecto Name
+	Role              string `json:"role,omitempty"`                // viewer, editor (por defecto), admin u operator
+
+	// Key de sandbox: sus jobs los resuelve al momento un backend de prueba
+	// con transcripciones deterministas, sin medio ni GPU
+	Sandbox bool `json:"sandbox,omitempty"`
+
+	// Solo se aceptan peticiones firmadas con la key (ver signing.go); en
+	// claro, en X-API-Key o Bearer, se rechaza
+	RequireSignature bool `json:"require_signature,omitempty"`
+
+	// Rangos (CIDR o IP suelta) desde los que se acepta la key; vacío, desde
+	// cualquiera. Ver allowlist.go.
+	AllowedCIDRs []string `json:"allowed_cidrs,omitempty"`
+}
+
+// Clave de contexto gin con la *APIKey autenticada
+const ctxAPIKey = "api_key"
+
+// Hay credenciales que exigir: keys estáticas o gestionadas, u OIDC
+func authEnabled() bool {
+	return len(cfg.APIKeys) > 0 || oidcEnabled() || !managedKeys.empty()
+}
+
+// Rutas que llaman los proveedores (Twilio, Zoom, el correo entrante, los
+// bots) y que cada handler autentica con la firma de la integración
+func isSignedCallbackPath(path string) bool {
+	switch path {
+	case twilioCallbackPath, zoomWebhookPath, emailInboundPath, telegramWebhookPath, whatsAppWebhookPath, discordInteractionsPath:
+		return true
+	}
+	return false
+}
+
+// Exige una API key o una sesión OIDC válida cuando hay keys u OIDC
+// configurados. Sin ninguno el servicio sigue abierto como hasta ahora.
+func authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authEnabled() || strings.HasPrefix(c.Request.URL.Path, "/artifacts/") ||
+			strings.HasPrefix(c.Request.URL.Path, sharedPathPrefix) || isLoginPath(c.Request.URL.Path) ||
+			isSignedCallbackPath(c.Request.URL.Path) || strings.HasPrefix(c.Request.URL.Path, backendCallbackPrefix) {
+			// Los artefactos locales y las transcripciones compartidas se
+			// protegen con enlaces firmados, los callbacks de los proveedores
+			// con su firma y los de los backends con su token
+			c.Next()
+			return
+		}
+
+		if c.GetHeader(signatureHeader) != "" {
+			key, err := verifySignedRequest(c)
+			if err != nil {
+				c.AbortWithStatusJSON(err.status, gin.H{"error": err.Error(), "code": err.code})
+				return
+			}
+			if !checkKeyIP(c, key) {
+				return
+			}
+			c.Set(ctxAPIKey, key)
+			c.Next()
+			return
+		}
+
+		provided := c.GetHeader("X-API-Key")
+		if provided == "" {
+			if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+				provided = strings.TrimPrefix(auth, "Bearer ")
+			}
+		}
+
+		key := lookupAPIKey(provided)
+		if key == nil {
+			key = managedKeys.lookup(provided)
+		}
+		if key == nil && oidcEnabled() {
+			key = sessionAPIKey(c, provided)
+		}
+		if key == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid API key", "code": "UNAUTHORIZED"})
+			return
+		}
+		if key.RequireSignature {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "this API key only accepts signed requests", "code": "SIGNATURE_REQUIRED"})
+			return
+		}
+		if !checkKeyIP(c, key) {
+			return
+		}
+		c.Set(ctxAPIKey, key)
+		c.Next()
+	}
+}
+
+func lookupAPIKey(provided string) *APIKey {
+	if provided == "" {
+		return nil
+	}
+	for i := range cfg.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(liveSecret(&cfg.APIKeys[i].Key)), []byte(provided)) == 1 {
+			return &cfg.APIKeys[i]
+		}
+	}
+	return nil
+}
+
+// Key configurada o gestionada con ese nombre (para jobs restaurados)
+func findAPIKeyByName(name string) *APIKey {
+	if name == "" {
+		return nil
+	}
+	for i := range cfg.APIKeys {
+		if cfg.APIKeys[i].Name == name {
+			return &cfg.APIKeys[i]
+		}
+	}
+	return managedKeys.findByName(name)
+}
+
+// API key de la petición, o nil si el servicio no exige autenticación
+func currentAPIKey(c *gin.Context) *APIKey {
+	if v, ok := c.Get(ctxAPIKey); ok {
+		return v.(*APIKey)
+	}
+	return nil
+}
+
+// Límite de jobs simultáneos aplicable a la key (0 = sin límite)
+func (k *APIKey) concurrencyLimit() int {
+	if k == nil {
+		return 0
+	}
+	if k.MaxConcurrentJobs > 0 {
+		return k.MaxConcurrentJobs
+	}
+	return live().DefaultMaxConcurrentJobs
+}
+
+// La key es de sandbox (false si el servicio no exige autenticación)
+func (k *APIKey) sandbox() bool {
+	return k != nil && k.Sandbox
+}
+
+// Tenant al que pertenece la key ("" si el servicio no exige autenticación)
+func (k *APIKey) tenant() string {
+	if k == nil {
+		return ""
+	}
+	if k.Tenant != "" {
+		return k.Tenant
+	}
+	return k.Name
+}
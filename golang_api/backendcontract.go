@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Campos incumplidos que se citan en el error; del resto solo se cuentan
+const maxContractViolations = 10
+
+// Forma esperada de un valor JSON de la respuesta del backend. Los campos
+// que no están en el contrato se ignoran: el backend puede añadir campos
+// nuevos sin romper el gateway.
+type contractSpec struct {
+	kind     string // string, number, integer, array u object
+	required bool
+	items    *contractSpec
+	fields   map[string]contractSpec
+	aliases  []string // otros nombres del campo en otros backends de whisper
+}
+
+var wordContract = contractSpec{kind: "object", fields: map[string]contractSpec{
+	"word":        {kind: "string", required: true, aliases: []string{"text"}},
+	"start":       {kind: "number", required: true},
+	"end":         {kind: "number", required: true},
+	"probability": {kind: "number", aliases: []string{"confidence", "score"}},
+}}
+
+var segmentContract = contractSpec{kind: "object", fields: map[string]contractSpec{
+	"id":             {kind: "integer"},
+	"start":          {kind: "number", required: true},
+	"end":            {kind: "number", required: true},
+	"text":           {kind: "string", required: true},
+	"language":       {kind: "string"},
+	"speaker":        {kind: "string"},
+	"avg_logprob":    {kind: "number"},
+	"no_speech_prob": {kind: "number"},
+	"words":          {kind: "array", items: &wordContract},
+}}
+
+var chapterContract = contractSpec{kind: "object", fields: map[string]contractSpec{
+	"title": {kind: "string", required: true, aliases: []string{"headline"}},
+	"start": {kind: "number", required: true},
+	"end":   {kind: "number", required: true},
+}}
+
+// Contrato de POST {backend}/transcribe
+var backendResponseContract = contractSpec{kind: "object", fields: map[string]contractSpec{
+	"transcription": {kind: "string", required: true, aliases: []string{"text"}},
+	"translation":   {kind: "string"},
+	"language":      {kind: "string"},
+	"model_used":    {kind: "string"},
+	"segments":      {kind: "array", items: &segmentContract},
+	"chapters":      {kind: "array", items: &chapterContract},
+}}
+
+// Tipo JSON de un valor decodificado con UseNumber
+func jsonKind(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// Convierte lo que tiene una única lectura posible: números en texto
+// ("3.5"), enteros escritos como 3.0, hablantes numéricos (1 es "1") y los
+// alias de los campos. Lo demás queda igual y lo rechaza check.
+func (s contractSpec) coerce(v interface{}) interface{} {
+	switch s.kind {
+	case "number", "integer":
+		if text, ok := v.(string); ok {
+			text = strings.TrimSpace(text)
+			if _, err := strconv.ParseFloat(text, 64); err == nil && json.Valid([]byte(text)) {
+				v = json.Number(text)
+			}
+		}
+		if n, ok := v.(json.Number); ok && s.kind == "integer" {
+			if f, err := n.Float64(); err == nil && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+				v = json.Number(strconv.FormatInt(int64(f), 10))
+			}
+		}
+	case "string":
+		if n, ok := v.(json.Number); ok {
+			v = n.String()
+		}
+	case "array":
+		if items, ok := v.([]interface{}); ok {
+			for i := range items {
+				items[i] = s.items.coerce(items[i])
+			}
+		}
+	case "object":
+		if obj, ok := v.(map[string]interface{}); ok {
+			for name, field := range s.fields {
+				if _, ok := obj[name]; !ok {
+					for _, alias := range field.aliases {
+						if value, ok := obj[alias]; ok {
+							obj[name] = value
+							break
+						}
+					}
+				}
+				if value, ok := obj[name]; ok && value != nil {
+					obj[name] = field.coerce(value)
+				}
+			}
+		}
+	}
+	return v
+}
+
+func (s contractSpec) check(path string, v interface{}, violations *[]string) {
+	got := jsonKind(v)
+	if got != s.kind && !(s.kind == "number" && got == "integer") {
+		*violations = append(*violations, fmt.Sprintf("%s: expected %s, got %s", path, s.kind, got))
+		return
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		for i, item := range v {
+			s.items.check(fmt.Sprintf("%s[%d]", path, i), item, violations)
+		}
+	case map[string]interface{}:
+		names := make([]string, 0, len(s.fields))
+		for name := range s.fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		prefix := path + "."
+		if path == "" {
+			prefix = ""
+		}
+		for _, name := range names {
+			field := s.fields[name]
+			value, ok := v[name]
+			if !ok || value == nil {
+				// null equivale a ausente
+				if field.required {
+					*violations = append(*violations, prefix+name+": is required")
+				}
+				continue
+			}
+			field.check(prefix+name, value, violations)
+		}
+	}
+}
+
+// Decodifica la respuesta del backend con las conversiones de coerce. Si no
+// cumple el contrato devuelve los campos afectados, como
+// "segments[2].start: expected number, got string", y ningún resultado; el
+// error es que el cuerpo ni siquiera es JSON.
+func decodeBackendResponse(body []byte) (*BackendResponse, []string, error) {
+	var result BackendResponse
+	if violations, err := decodeWithContract(body, backendResponseContract, "response", &result); err != nil || len(violations) > 0 {
+		return nil, violations, err
+	}
+	return &result, nil, nil
+}
+
+// Un segmento suelto de la respuesta en streaming, con el mismo contrato
+// que los de la respuesta completa
+func decodeBackendSegment(body []byte) (Segment, []string, error) {
+	var seg Segment
+	violations, err := decodeWithContract(body, segmentContract, "segment", &seg)
+	return seg, violations, err
+}
+
+func decodeWithContract(body []byte, spec contractSpec, name string, out interface{}) ([]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	if kind := jsonKind(v); kind != spec.kind {
+		return []string{name + ": expected " + spec.kind + ", got " + kind}, nil
+	}
+	v = spec.coerce(v)
+	var violations []string
+	spec.check("", v, &violations)
+	if len(violations) > 0 {
+		return violations, nil
+	}
+	// Ya con los tipos del contrato: no se pierde ningún campo conocido
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return nil, json.Unmarshal(data, out)
+}
+
+func backendContractMessage(violations []string) string {
+	cited := violations
+	if len(cited) > maxContractViolations {
+		cited = cited[:maxContractViolations]
+	}
+	message := "backend response does not match the contract: " + strings.Join(cited, "; ")
+	if n := len(violations) - len(cited); n > 0 {
+		message += fmt.Sprintf(" (and %d more)", n)
+	}
+	return message
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Capacidad que reporta un backend whisper en GET /capacity
+type BackendCapacity struct {
+	QueueLength      int     `json:"queue_length"`
+	GPUMemoryUsedMB  float64 `json:"gpu_memory_used_mb,omitempty"`
+	GPUMemoryTotalMB float64 `json:"gpu_memory_total_mb,omitempty"`
+	ModelLoaded      string  `json:"model_loaded,omitempty"`
+
+	// 2 si admite POST /jobs (protocolo v2); ausente en los de v1
+	Protocol int `json:"protocol,omitempty"`
+}
+
+// Estado conocido de un backend
+type BackendStatus struct {
+	URL            string           `json:"url"`
+	Healthy        bool             `json:"healthy"`
+	InFlight       int              `json:"in_flight"`                 // peticiones enviadas por este gateway
+	MaxConcurrency int              `json:"max_concurrency,omitempty"` // tope de este proceso (0 = sin tope)
+	Capacity       *BackendCapacity `json:"capacity,omitempty"`
+	Error          string           `json:"error,omitempty"`
+	CheckedAt      time.Time        `json:"checked_at"`
+
+	// Calentamiento del modelo (ver warmup.go)
+	WarmState         string     `json:"warm_state"`
+	WarmedAt          *time.Time `json:"warmed_at,omitempty"`
+	lastUsed          time.Time  // último job o calentamiento
+	warmupUnsupported bool
+}
+
+// Sobrecarga estimada usada para elegir backend
+func (b *BackendStatus) load() int {
+	load := b.InFlight
+	if b.Capacity != nil {
+		load += b.Capacity.QueueLength
+	}
+	return load
+}
+
+// Hueco libre: sin tope o por debajo de él
+func (b *BackendStatus) hasSlot() bool {
+	return b.MaxConcurrency == 0 || b.InFlight < b.MaxConcurrency
+}
+
+// Carga relativa al tamaño del backend tras sumarle una petición; reparte en
+// proporción a los topes (un backend sin tope cuenta como tamaño 1)
+func (b *BackendStatus) share() float64 {
+	size := b.MaxConcurrency
+	if size == 0 {
+		size = 1
+	}
+	return float64(b.load()+1) / float64(size)
+}
+
+type backendPool struct {
+	mu       sync.RWMutex
+	backends []*BackendStatus
+	waiting  []*backendWaiter // en orden de llegada
+}
+
+// Petición esperando un hueco en algún backend
+type backendWaiter struct {
+	exclude []*BackendStatus
+	ready   chan *BackendStatus
+}
+
+var backends *backendPool
+
+// Plazo de cada consulta de capacidad
+const capacityTimeout = 5 * time.Second
+
+func newBackendPool(urls []string) *backendPool {
+	pool := &backendPool{}
+	pool.reconfigure(urls)
+	return pool
+}
+
+// Tope de un backend según backend_max_concurrency
+func backendLimit(u string) int {
+	limit, ok := live().BackendMaxConcurrency[u]
+	if !ok {
+		limit = live().DefaultBackendConcurrency
+	}
+	return limit
+}
+
+// Sustituye los backends del pool al recargar la configuración. Los que
+// siguen conservan su estado y sus peticiones en curso; las de los
+// retirados terminan en ellos.
+func (p *backendPool) reconfigure(urls []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	previous := make(map[string]*BackendStatus, len(p.backends))
+	for _, b := range p.backends {
+		previous[b.URL] = b
+	}
+	list := make([]*BackendStatus, 0, len(urls))
+	for _, u := range urls {
+		b, ok := previous[u]
+		if !ok {
+			// Hasta el primer sondeo se asume sano
+			b = &BackendStatus{URL: u, Healthy: true, WarmState: BackendCold}
+		}
+		b.MaxConcurrency = backendLimit(u)
+		list = append(list, b)
+	}
+	p.backends = list
+
+	// Los que solo podían ir a backends retirados no esperan más
+	remaining := p.waiting[:0]
+	for _, w := range p.waiting {
+		if !p.hasCandidateLocked(w.exclude) {
+			w.ready <- nil
+			continue
+		}
+		remaining = append(remaining, w)
+	}
+	p.waiting = remaining
+	p.dispatchLocked()
+}
+
+// Sondea /capacity de todos los backends cada intervalo
+func (p *backendPool) startPolling(interval time.Duration) {
+	p.pollAll()
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			p.pollAll()
+		}
+	}()
+}
+
+func (p *backendPool) pollAll() {
+	// Por puntero: una recarga puede cambiar la lista mientras se sondea
+	p.mu.RLock()
+	list := append([]*BackendStatus(nil), p.backends...)
+	urls := make([]string, len(list))
+	for i, b := range list {
+		urls[i] = b.URL
+	}
+	p.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			capacity, healthy, err := p.fetchCapacity(u)
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			b := list[i]
+			b.Healthy = healthy
+			b.Capacity = capacity
+			b.CheckedAt = time.Now()
+			b.Error = ""
+			if err != nil {
+				b.Error = err.Error()
+				if !healthy {
+					log.Printf("⚠️ Backend %s no disponible: %v", u, err)
+				}
+			}
+		}(i, u)
+	}
+	wg.Wait()
+
+	// Un backend recuperado puede atender a los que esperan
+	p.mu.Lock()
+	p.dispatchLocked()
+	p.mu.Unlock()
+}
+
+func (p *backendPool) fetchCapacity(baseURL string) (*BackendCapacity, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), capacityTimeout)
+	defer cancel()
+	return transcriberFor(baseURL).capacity(ctx, baseURL)
+}
+
+// GET /capacity; un 404 indica un backend vivo que aún no lo expone
+func (t *httpTranscriber) capacity(ctx context.Context, baseURL string) (*BackendCapacity, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/capacity", nil)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "invalid backend URL")
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "capacity request failed")
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, true, errors.New("backend does not expose /capacity")
+	case resp.StatusCode != http.StatusOK:
+		return nil, false, errors.Errorf("capacity endpoint responded with status %d", resp.StatusCode)
+	}
+
+	var capacity BackendCapacity
+	if err := json.NewDecoder(resp.Body).Decode(&capacity); err != nil {
+		return nil, true, errors.Wrap(err, "invalid capacity payload")
+	}
+	return &capacity, true, nil
+}
+
+// Elige el backend con hueco y menor carga relativa a su tope y cuenta la
+// petición en curso. Si todos los backends candidatos están llenos espera,
+// en orden de llegada, a que se libere uno o a que se cancele ctx. Solo se
+// usan backends no sanos si no queda ninguno sano. Devuelve nil si todos
+// están excluidos.
+func (p *backendPool) acquire(ctx context.Context, exclude ...*BackendStatus) (*BackendStatus, error) {
+	p.mu.Lock()
+	if !p.hasCandidateLocked(exclude) {
+		p.mu.Unlock()
+		return nil, nil
+	}
+	w := &backendWaiter{exclude: exclude, ready: make(chan *BackendStatus, 1)}
+	p.waiting = append(p.waiting, w)
+	// Con hueco libre se atiende ya, detrás de los que esperaban antes
+	p.dispatchLocked()
+	p.mu.Unlock()
+
+	select {
+	case b := <-w.ready:
+		return b, nil
+	case <-ctx.Done():
+		p.abandon(w)
+		return nil, ctx.Err()
+	}
+}
+
+// Saca de la cola a un waiter que dejó de esperar. Si ya se le había
+// asignado un hueco, pasa al siguiente.
+func (p *backendPool) abandon(w *backendWaiter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, other := range p.waiting {
+		if other == w {
+			p.waiting = append(p.waiting[:i], p.waiting[i+1:]...)
+			return
+		}
+	}
+	if b := <-w.ready; b != nil {
+		b.InFlight--
+		p.dispatchLocked()
+	}
+}
+
+// Como acquire, pero solo el backend con esa URL; nil si no está en el pool
+func (p *backendPool) acquireURL(ctx context.Context, url string) (*BackendStatus, error) {
+	return p.acquireIn(ctx, []string{url})
+}
+
+// Como acquire, pero solo entre los backends de urls (vacío = todo el
+// pool); nil si ninguno queda
+func (p *backendPool) acquireIn(ctx context.Context, urls []string, exclude ...*BackendStatus) (*BackendStatus, error) {
+	return p.acquire(ctx, p.outside(urls, exclude)...)
+}
+
+// Exclusiones más los backends fuera de urls
+func (p *backendPool) outside(urls []string, exclude []*BackendStatus) []*BackendStatus {
+	if len(urls) == 0 {
+		return exclude
+	}
+	others := append([]*BackendStatus(nil), exclude...)
+	p.mu.RLock()
+	for _, b := range p.backends {
+		if !containsString(urls, b.URL) {
+			others = append(others, b)
+		}
+	}
+	p.mu.RUnlock()
+	return others
+}
+
+// URL del backend que elegiría acquire ahora, sin contar la petición; vacío
+// si todos están llenos
+func (p *backendPool) peek() string {
+	return p.peekIn(nil)
+}
+
+// Como peek, entre los backends de urls (vacío = todo el pool)
+func (p *backendPool) peekIn(urls []string) string {
+	exclude := p.outside(urls, nil)
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if best := p.pickLocked(exclude); best != nil {
+		return best.URL
+	}
+	return ""
+}
+
+func (p *backendPool) hasCandidateLocked(exclude []*BackendStatus) bool {
+	for _, b := range p.backends {
+		if !containsBackend(exclude, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// Mejor backend con hueco, o nil si los candidatos están llenos
+func (p *backendPool) pickLocked(exclude []*BackendStatus) *BackendStatus {
+	anyHealthy := false
+	for _, b := range p.backends {
+		if b.Healthy && !containsBackend(exclude, b) {
+			anyHealthy = true
+		}
+	}
+	var best *BackendStatus
+	for _, b := range p.backends {
+		if containsBackend(exclude, b) || b.Healthy != anyHealthy || !b.hasSlot() {
+			continue
+		}
+		// A igual carga, mejor uno con el modelo ya cargado
+		if best == nil || b.share() < best.share() || b.share() == best.share() && b.WarmState == BackendWarm && best.WarmState != BackendWarm {
+			best = b
+		}
+	}
+	return best
+}
+
+// Asigna los huecos libres a los que esperan, en orden de llegada. Uno que
+// no cabe (p. ej. por sus exclusiones) no bloquea a los siguientes.
+func (p *backendPool) dispatchLocked() {
+	remaining := p.waiting[:0]
+	for _, w := range p.waiting {
+		if best := p.pickLocked(w.exclude); best != nil {
+			best.InFlight++
+			w.ready <- best
+			continue
+		}
+		remaining = append(remaining, w)
+	}
+	p.waiting = remaining
+}
+
+func containsBackend(list []*BackendStatus, b *BackendStatus) bool {
+	for _, item := range list {
+		if item == b {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *backendPool) release(b *BackendStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b.InFlight--
+	p.dispatchLocked()
+}
+
+// Copia del estado de todos los backends
+func (p *backendPool) snapshot() []BackendStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	out := make([]BackendStatus, len(p.backends))
+	for i, b := range p.backends {
+		out[i] = *b
+		if b.Capacity != nil {
+			c := *b.Capacity
+			out[i].Capacity = &c
+		}
+	}
+	return out
+}
+
+// Totales agregados para GET /capacity
+type CapacitySummary struct {
+	Backends        []BackendStatus `json:"backends"`
+	HealthyBackends int             `json:"healthy_backends"`
+	QueueLength     int             `json:"queue_length"`
+	InFlight        int             `json:"in_flight"`
+	Waiting         int             `json:"waiting"` // peticiones esperando un hueco en este proceso
+}
+
+func (p *backendPool) summary() CapacitySummary {
+	summary := CapacitySummary{Backends: p.snapshot()}
+	p.mu.RLock()
+	summary.Waiting = len(p.waiting)
+	p.mu.RUnlock()
+	for _, b := range summary.Backends {
+		if b.Healthy {
+			summary.HealthyBackends++
+		}
+		if b.Capacity != nil {
+			summary.QueueLength += b.Capacity.QueueLength
+		}
+		summary.InFlight += b.InFlight
+	}
+	return summary
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ai/youtube_transcriber/internal/mockwhisper"
+)
+
+func singleSlotPool() (*backendPool, *BackendStatus) {
+	b := &BackendStatus{URL: "http://a", Healthy: true, MaxConcurrency: 1}
+	return &backendPool{backends: []*BackendStatus{b}}, b
+}
+
+func TestAcquireCancelledWhileWaiting(t *testing.T) {
+	pool, b := singleSlotPool()
+	held, err := pool.acquire(context.Background())
+	if err != nil || held != b {
+		t.Fatalf("first acquire = %v, %v", held, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if got, err := pool.acquire(ctx); got != nil || err != context.DeadlineExceeded {
+		t.Fatalf("acquire on a full pool = %v, %v, want deadline exceeded", got, err)
+	}
+	if n := len(pool.waiting); n != 0 {
+		t.Errorf("%d waiters left after cancel, want 0", n)
+	}
+
+	// El siguiente en llegar recibe el hueco al liberarse
+	got := make(chan *BackendStatus, 1)
+	go func() {
+		next, _ := pool.acquire(context.Background())
+		got <- next
+	}()
+	time.Sleep(10 * time.Millisecond)
+	pool.release(held)
+	select {
+	case next := <-got:
+		if next != b || b.InFlight != 1 {
+			t.Errorf("next acquire = %v with %d in flight", next, b.InFlight)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter not served after release")
+	}
+}
+
+// Un hueco asignado a la vez que se cancela pasa al siguiente
+func TestAbandonDispatchedWaiter(t *testing.T) {
+	pool, b := singleSlotPool()
+	b.InFlight = 1
+	w := &backendWaiter{ready: make(chan *BackendStatus, 1)}
+	next := &backendWaiter{ready: make(chan *BackendStatus, 1)}
+	w.ready <- b // dispatchLocked ya lo sacó de la cola
+	pool.waiting = []*backendWaiter{next}
+
+	pool.abandon(w)
+	select {
+	case got := <-next.ready:
+		if got != b || b.InFlight != 1 {
+			t.Errorf("slot handed to %v with %d in flight", got, b.InFlight)
+		}
+	default:
+		t.Fatal("abandoned waiter kept its slot")
+	}
+	if len(pool.waiting) != 0 {
+		t.Errorf("%d waiters left", len(pool.waiting))
+	}
+}
+
+func TestAcquireAllExcluded(t *testing.T) {
+	pool, b := singleSlotPool()
+	if got, err := pool.acquire(context.Background(), b); got != nil || err != nil {
+		t.Errorf("acquire with every backend excluded = %v, %v", got, err)
+	}
+}
+
+// Cancelar ctx corta la llamada en curso, sin reintentarla en otro backend
+func TestTranscribeCancelledWhileCalling(t *testing.T) {
+	initLiveConfig()
+	first, hanging := startMock(t, mockwhisper.WithMode(mockwhisper.ModeHang))
+	second, other := startMock(t)
+	saved := backends
+	backends = newBackendPool([]string{hanging.URL, other.URL})
+	t.Cleanup(func() { backends = saved })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := transcribeWithFallback(ctx, "sync-cancel", PythonRequest{URL: "https://media.example/a.mp3"})
+	var berr *backendError
+	if !errors.As(err, &berr) || berr.code != "BACKEND_TIMEOUT" || berr.retryable {
+		t.Fatalf("err = %v, want a non-retryable BACKEND_TIMEOUT", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("call returned after %s", elapsed)
+	}
+	if n, m := len(first.Requests()), len(second.Requests()); n != 1 || m != 0 {
+		t.Errorf("backend requests = %d and %d, want 1 and 0", n, m)
+	}
+	for _, b := range backends.backends {
+		if b.InFlight != 0 {
+			t.Errorf("%s keeps %d in flight", b.URL, b.InFlight)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Mensajes por respuesta; lo que sobra se recorta
+const maxBotReplyMessages = 5
+
+// Los IDs de los jobs salen del mensaje, para que un webhook repetido no
+// cree otro job
+var botNamespace = uuid.MustParse("d41f6b0e-2c87-4a59-9e13-8b5a7c0f6d92")
+
+// Adaptador de un bot: de dónde sale la nota de voz y cómo se responde en
+// el chat
+type messagingAdapter interface {
+	// Abre el audio de source.Media; el tamaño es -1 si no se conoce
+	FetchMedia(ctx context.Context, item Integration, source *jobSource) (io.ReadCloser, int64, error)
+	// Envía los mensajes a source.ReplyTo como respuesta a source.Key
+	Reply(ctx context.Context, item Integration, source *jobSource, parts []string) error
+	// Caracteres por mensaje
+	MessageLimit() int
+}
+
+var messagingAdapters = map[string]messagingAdapter{
+	ProviderTelegram: telegramAdapter{},
+	ProviderWhatsApp: whatsAppAdapter{},
+	ProviderDiscord:  discordAdapter{},
+}
+
+func isBotProvider(provider string) bool {
+	_, ok := messagingAdapters[provider]
+	return ok
+}
+
+// Nota de voz recibida por un bot
+type botMessage struct {
+	ChatID    string // telegram: chat; whatsapp: número del remitente
+	MessageID string
+	MediaID   string // id del archivo en el proveedor
+	URL       string // discord: enlace del audio, en lugar de MediaID
+	FileName  string
+	Size      int64 // 0 si el webhook no lo trae
+	Metadata  map[string]string
+}
+
+// Extensión del audio según su tipo MIME; las notas de voz son OGG/Opus
+func botAudioExtension(mimeType string) string {
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	switch mediaType {
+	case "audio/mpeg":
+		return ".mp3"
+	case "audio/mp4", "audio/x-m4a":
+		return ".m4a"
+	case "audio/aac":
+		return ".aac"
+	case "audio/amr":
+		return ".amr"
+	case "audio/wav", "audio/x-wav":
+		return ".wav"
+	case "audio/flac":
+		return ".flac"
+	}
+	return ".ogg"
+}
+
+// Crea el job de la nota de voz, salvo que ya exista, y devuelve su ID. El
+// audio se descarga al ejecutarlo: los proveedores esperan una respuesta
+// rápida al webhook.
+func createBotJob(item Integration, msg botMessage) (string, error) {
+	if cfg.MaxDownloadMB > 0 && msg.Size > cfg.MaxDownloadMB*1024*1024 {
+		return "", errTooLarge
+	}
+	jobID := uuid.NewSHA1(botNamespace, []byte(item.ID+"/"+msg.ChatID+"/"+msg.MessageID)).String()
+	input := RequestBody{}
+	if item.Template != "" {
+		if _, err := applyTemplate(item.tenant, item.Template, &input); err != nil {
+			return "", err
+		}
+	}
+	input.Type = JobTypeTranscription
+	input.URL = msg.URL
+	input.Metadata = map[string]string{"integration_id": item.ID}
+	for k, v := range msg.Metadata {
+		if v != "" && len(v) <= maxMetadataValueLength {
+			input.Metadata[k] = v
+		}
+	}
+	source := &jobSource{Kind: item.Provider, Key: msg.MessageID, Integration: item.ID, Name: msg.FileName, Media: msg.MediaID, ReplyTo: msg.ChatID}
+	if createSourcedJob(jobID, item.tenant, input, source) {
+		jobLogf(jobID, "🚀 Job %s creado desde %s", jobID, source)
+	}
+	return jobID, nil
+}
+
+// Descarga la nota de voz del job a un upload del tenant y devuelve el
+// upload_id
+func stageBotMedia(meta jobMeta) (string, error) {
+	item, ok := integrations.lookup(meta.Source.Integration)
+	if !ok {
+		return "", errors.Errorf("%s integration no longer exists", meta.Source.Kind)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DownloadTimeout.Duration)
+	defer cancel()
+	body, size, err := messagingAdapters[meta.Source.Kind].FetchMedia(ctx, item, meta.Source)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	if cfg.MaxDownloadMB > 0 && size > cfg.MaxDownloadMB*1024*1024 {
+		return "", errTooLarge
+	}
+	return stageSourceMedia(ctx, meta.Tenant, path.Ext(meta.Source.Name), body, size)
+}
+
+// Un intento de respuesta desde el outbox: la transcripción en uno o varios
+// mensajes, o el error del job
+func sendBotReply(job JobState, meta jobMeta, event string) (string, error) {
+	item, ok := integrations.lookup(meta.Source.Integration)
+	if !ok || !item.Enabled || meta.Source.ReplyTo == "" {
+		return "", errOutboxDiscard
+	}
+	text := integrationExport{Text: job.Transcription, Translation: job.Translation}.body()
+	if event == WebhookJobFailed {
+		reason := job.Error
+		if reason == "" {
+			reason = job.Status
+		}
+		text = "Transcription failed: " + reason
+	} else if strings.TrimSpace(text) == "" {
+		text = "No speech was detected."
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.IntegrationTimeout.Duration)
+	defer cancel()
+	adapter := messagingAdapters[meta.Source.Kind]
+	parts := splitBotMessage(text, adapter.MessageLimit())
+	if err := adapter.Reply(ctx, item, meta.Source, parts); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("replied in %s chat %s (%d messages)", meta.Source.Kind, meta.Source.ReplyTo, len(parts)), nil
+}
+
+// Trozos de hasta limit caracteres, cortados en un espacio si se puede; el
+// último de maxBotReplyMessages se recorta con "…"
+func splitBotMessage(text string, limit int) []string {
+	runes := []rune(strings.TrimSpace(text))
+	var parts []string
+	for len(runes) > 0 {
+		if len(parts) == maxBotReplyMessages-1 && len(runes) > limit {
+			parts = append(parts, string(runes[:limit-1])+"…")
+			break
+		}
+		n := len(runes)
+		if n > limit {
+			n = limit
+			for i := n; i > n/2; i-- {
+				if unicode.IsSpace(runes[i]) {
+					n = i
+					break
+				}
+			}
+		}
+		parts = append(parts, strings.TrimSpace(string(runes[:n])))
+		runes = runes[n:]
+		for len(runes) > 0 && unicode.IsSpace(runes[0]) {
+			runes = runes[1:]
+		}
+	}
+	return parts
+}
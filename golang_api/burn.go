@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Tipos de job
+const (
+	JobTypeTranscription = "transcription"
+	JobTypeBurnSubtitles = "burn_subtitles" // vídeo con subtítulos incrustados
+)
+
+// Nombre del artefacto generado por un job burn_subtitles
+const burnedVideoArtifact = "subtitled.mp4"
+
+// Comprueba que el job de transcripción de origen sirve para incrustar. Uno
+// de otro tenant se trata como inexistente, sin revelar su estado.
+func validateBurnRequest(input RequestBody, key *APIKey) error {
+	if input.TranscriptJobID == "" {
+		return errors.New("transcript_job_id is required for burn_subtitles jobs")
+	}
+	source, exists := getJob(input.TranscriptJobID)
+	meta, _ := getJobMeta(input.TranscriptJobID)
+	if !exists || !key.canSee(meta) {
+		return errors.New("transcript job not found")
+	}
+	if source.Status != "completed" || len(source.Segments) == 0 {
+		return errors.New("transcript job must be completed and have timed segments")
+	}
+	return nil
+}
+
+// Descarga el vídeo, incrusta los subtítulos con ffmpeg y sube el resultado
+func processBurnJob(jobID string, input RequestBody, key *APIKey) {
+	meta, _ := getJobMeta(jobID)
+	source, exists := getJob(input.TranscriptJobID)
+	sourceMeta, _ := getJobMeta(input.TranscriptJobID)
+	// En un worker la key puede no existir ya: entonces basta el mismo tenant
+	if !exists || (sourceMeta.Tenant != meta.Tenant && (key == nil || !key.canSee(sourceMeta))) {
+		failJob(jobID, "INVALID_REQUEST", "transcript job not found")
+		return
+	}
+
+	setJobStatus(jobID, "downloading")
+	video, err := downloadMedia(jobID, meta.Tenant, input.URL)
+	if err != nil {
+		failJob(jobID, "DOWNLOAD_FAILED", errors.Wrap(err, "failed to download video").Error())
+		return
+	}
+	mu.Lock()
+	jobMetas[jobID].MediaPath = video.Path
+	unlockJobs()
+
+	setJobStatus(jobID, "processing")
+
+	opts := defaultSubtitleOptions().merge(sourceMeta.Input.Subtitles).merge(input.Subtitles)
+	dir := filepath.Dir(video.Path)
+	srtPath := filepath.Join(dir, "subtitles.srt")
+	if err := os.WriteFile(srtPath, []byte(renderSRT(buildCues(source.Segments, opts))), 0o644); err != nil {
+		failJob(jobID, "INTERNAL_ERROR", errors.Wrap(err, "failed to write subtitles").Error())
+		return
+	}
+
+	outPath := filepath.Join(dir, burnedVideoArtifact)
+	if err := burnSubtitles(video.Path, srtPath, outPath); err != nil {
+		failJob(jobID, "RENDER_FAILED", err.Error())
+		return
+	}
+
+	artifact, err := storeArtifact(jobID, burnedVideoArtifact, outPath, "video/mp4")
+	if err != nil {
+		failJob(jobID, "STORAGE_FAILED", err.Error())
+		return
+	}
+
+	mu.Lock()
+	defer unlockJobs()
+	jobStore[jobID].Status = "completed"
+	jobStore[jobID].Artifacts = append(jobStore[jobID].Artifacts, artifact)
+	appendEventLocked(jobID, JobEvent{Type: EventStatus, Status: "completed"})
+}
+
+func burnSubtitles(videoPath, srtPath, outPath string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.RenderTimeout.Duration)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, cfg.FFmpegPath,
+		"-y", "-v", "error",
+		"-i", videoPath,
+		"-vf", "subtitles=filename="+escapeFilterValue(srtPath),
+		"-c:a", "copy",
+		outPath,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "ffmpeg failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Escapa una ruta para usarla como valor dentro de un filtro de ffmpeg
+func escapeFilterValue(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, `:`, `\:`, `'`, `\'`, `,`, `\,`, `[`, `\[`, `]`, `\]`)
+	return r.Replace(v)
+}
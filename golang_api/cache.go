@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// Prefijo de las claves de resultados en Redis
+const cacheKeyPrefix = "transcribe:result:"
+
+// Resultado completado guardado en caché
+type CachedResult struct {
+	Transcription string           `json:"transcription"`
+	Translation   string           `json:"translation,omitempty"`
+	Language      string           `json:"language,omitempty"`
+	Segments      []Segment        `json:"segments,omitempty"`
+	Chapters      []Chapter        `json:"chapters,omitempty"`
+	Stats         *TranscriptStats `json:"stats,omitempty"`
+	CachedAt      time.Time        `json:"cached_at"`
+}
+
+func (r CachedResult) backendResponse() BackendResponse {
+	return BackendResponse{Transcription: r.Transcription, Translation: r.Translation, Language: r.Language, Segments: r.Segments, Chapters: r.Chapters}
+}
+
+// Caché de resultados en Redis; nil si REDIS_URL no está configurado
+type resultCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+var cache *resultCache
+
+func newResultCache(redisURL string, ttl time.Duration) (*resultCache, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid REDIS_URL")
+	}
+	return &resultCache{client: redis.NewClient(opts), ttl: ttl}, nil
+}
+
+func urlHash(rawURL string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(rawURL)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Clave por (hash de URL, idioma, modelo, traducción)
+func cacheKey(input RequestBody) string {
+	return fmt.Sprintf("%s%s:%s:%s:%t", cacheKeyPrefix, urlHash(input.URL),
+		strings.ToLower(input.Language), strings.ToLower(input.Model), input.Translate)
+}
+
+// Petición con la que se guarda un resultado: con el modelo que fijó una
+// regla de backend_routing, no el pedido
+func cacheInput(input RequestBody, payload PythonRequest) RequestBody {
+	if payload.RouteModel != "" {
+		input.Model = payload.RouteModel
+	}
+	return input
+}
+
+// La caché la comparten todos los tenants, así que solo guarda medios que
+// cualquiera con la URL puede bajar: http(s). Un sftp:// se lee con las
+// credenciales del tenant y su resultado no se sirve a otro.
+func sharedCacheURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// Los modelos propios no se cachean: el nombre solo es único por tenant. El
+// modo high y diarize tampoco, la clave no los distingue del estándar.
+func (rc *resultCache) cacheable(input RequestBody) bool {
+	return rc != nil && sharedCacheURL(input.URL) && isBuiltinModel(input.Model) && input.Accuracy != AccuracyHigh && !input.Diarize
+}
+
+func (rc *resultCache) get(ctx context.Context, input RequestBody) (*CachedResult, bool) {
+	if !rc.cacheable(input) {
+		return nil, false
+	}
+	data, err := rc.client.Get(ctx, cacheKey(input)).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	if isSealed(string(data)) {
+		if data, err = encryption.open(cacheScope, string(data)); err != nil {
+			return nil, false
+		}
+	}
+	var result CachedResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, false
+	}
+	return &result, true
+}
+
+func (rc *resultCache) set(ctx context.Context, input RequestBody, result CachedResult) error {
+	if !rc.cacheable(input) {
+		return nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal cached result")
+	}
+	if encryption != nil {
+		sealed, err := encryption.seal(cacheScope, data)
+		if err != nil {
+			return errors.Wrap(err, "failed to encrypt cached result")
+		}
+		data = []byte(sealed)
+	}
+	return errors.Wrap(rc.client.Set(ctx, cacheKey(input), data, rc.ttl).Err(), "failed to store cached result")
+}
+
+// Borra las entradas de una URL. Los filtros vacíos abarcan todas las
+// variantes de idioma, modelo y traducción.
+func (rc *resultCache) invalidate(ctx context.Context, rawURL, language, model, translate string) (int, error) {
+	pattern := fmt.Sprintf("%s%s:%s:%s:%s", cacheKeyPrefix, urlHash(rawURL),
+		globOrAll(strings.ToLower(language)), globOrAll(strings.ToLower(model)), globOrAll(translate))
+
+	deleted := 0
+	iter := rc.client.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		n, err := rc.client.Del(ctx, iter.Val()).Result()
+		if err != nil {
+			return deleted, errors.Wrap(err, "failed to delete cache entry")
+		}
+		deleted += int(n)
+	}
+	return deleted, errors.Wrap(iter.Err(), "failed to scan cache entries")
+}
+
+func globOrAll(v string) string {
+	if v == "" {
+		return "*"
+	}
+	return v
+}
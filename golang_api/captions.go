@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Velocidad de fotogramas de los subtítulos de emisión
+type frameRate struct {
+	fps     float64 // fotogramas por segundo reales
+	nominal int     // fotogramas por segundo del timecode
+	drop    bool    // drop-frame (solo 29.97)
+}
+
+var frameRates = map[string]frameRate{
+	"23.976":   {fps: 24000.0 / 1001, nominal: 24},
+	"24":       {fps: 24, nominal: 24},
+	"25":       {fps: 25, nominal: 25},
+	"29.97":    {fps: 30000.0 / 1001, nominal: 30, drop: true},
+	"29.97ndf": {fps: 30000.0 / 1001, nominal: 30},
+	"30":       {fps: 30, nominal: 30},
+}
+
+// CEA-608 se transmite a 30 fotogramas (o 29.97) por segundo
+var sccFrameRates = []string{"29.97", "29.97ndf", "30"}
+
+// Por defecto SCC usa 29.97 drop-frame, el de la emisión NTSC
+const defaultSCCFrameRate = "29.97"
+
+// Fotograma más cercano al instante
+func (r frameRate) frame(seconds float64) int {
+	if seconds < 0 {
+		return 0
+	}
+	return int(math.Round(seconds * r.fps))
+}
+
+// HH:MM:SS:FF, o HH:MM:SS;FF en drop-frame, donde se saltan los
+// fotogramas 0 y 1 de cada minuto salvo los múltiplos de 10
+func (r frameRate) timecode(frame int) string {
+	if !r.drop {
+		n := r.nominal
+		return fmt.Sprintf("%02d:%02d:%02d:%02d", frame/(n*3600), frame/(n*60)%60, frame/n%60, frame%n)
+	}
+	const perTenMinutes, perMinute = 17982, 1798
+	tens, rest := frame/perTenMinutes, frame%perTenMinutes
+	frame += 18 * tens
+	if rest >= 2 {
+		frame += 2 * ((rest - 2) / perMinute)
+	}
+	return fmt.Sprintf("%02d:%02d:%02d;%02d", frame/108000, frame/1800%60, frame/30%60, frame%30)
+}
+
+// EBU-TT-D (TTML para distribución) con los cues abajo y centrados. Con
+// frame_rate los tiempos se ajustan a fotogramas enteros.
+func renderTTML(cues []Cue, language string, rate *frameRate) string {
+	if language == "" {
+		language = "und"
+	}
+	clock := func(seconds float64) string {
+		if rate != nil {
+			seconds = float64(rate.frame(seconds)) / rate.fps
+		}
+		return formatTimestamp(seconds, ".")
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&b, `<tt xmlns="http://www.w3.org/ns/ttml" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" `+
+		`xmlns:tts="http://www.w3.org/ns/ttml#styling" xmlns:ebuttm="urn:ebu:tt:metadata" `+
+		`ttp:timeBase="media" ttp:cellResolution="50 30" xml:lang="%s">`+"\n", xmlEscape(language))
+	b.WriteString(`  <head>
+    <metadata>
+      <ebuttm:documentMetadata>
+        <ebuttm:conformsToStandard>urn:ebu:tt:distribution:2014-01</ebuttm:conformsToStandard>
+      </ebuttm:documentMetadata>
+    </metadata>
+    <styling>
+      <style xml:id="paragraph" tts:textAlign="center" tts:fontFamily="proportionalSansSerif" tts:fontSize="100%" tts:lineHeight="normal"/>
+      <style xml:id="text" tts:color="#FFFFFF" tts:backgroundColor="#000000C2"/>
+    </styling>
+    <layout>
+      <region xml:id="bottom" tts:origin="10% 10%" tts:extent="80% 80%" tts:displayAlign="after"/>
+    </layout>
+  </head>
+  <body>
+    <div>
+`)
+	for i, cue := range cues {
+		lines := make([]string, len(cue.Lines))
+		for j, line := range cue.Lines {
+			lines[j] = `<span style="text">` + xmlEscape(line) + `</span>`
+		}
+		fmt.Fprintf(&b, `      <p xml:id="sub%d" begin="%s" end="%s" region="bottom" style="paragraph">%s</p>`+"\n",
+			i+1, clock(cue.Start), clock(cue.End), strings.Join(lines, "<br/>"))
+	}
+	b.WriteString("    </div>\n  </body>\n</tt>\n")
+	return b.String()
+}
+
+func xmlEscape(text string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// Columnas y filas de CEA-608 en pop-on
+const (
+	sccMaxColumns = 32
+	sccMaxRows    = 4
+)
+
+// Códigos de control del canal 1
+var (
+	sccResumeLoading  = [2]byte{0x14, 0x20} // RCL
+	sccEraseDisplayed = [2]byte{0x14, 0x2c} // EDM
+	sccEraseMemory    = [2]byte{0x14, 0x2e} // ENM
+	sccEndOfCaption   = [2]byte{0x14, 0x2f} // EOC: muestra el cue cargado
+)
+
+// PAC de cada fila (1 a 15): primer byte y base del segundo
+var sccRowPreambles = [16][2]byte{
+	{}, {0x11, 0x40}, {0x11, 0x60}, {0x12, 0x40}, {0x12, 0x60}, {0x15, 0x40}, {0x15, 0x60}, {0x16, 0x40},
+	{0x16, 0x60}, {0x17, 0x40}, {0x17, 0x60}, {0x10, 0x40}, {0x13, 0x40}, {0x13, 0x60}, {0x14, 0x40}, {0x14, 0x60},
+}
+
+// Caracteres de CEA-608 que no coinciden con ASCII
+var sccBasicChars = map[rune]byte{
+	'á': 0x2a, 'é': 0x5c, 'í': 0x5e, 'ó': 0x5f, 'ú': 0x60, 'ç': 0x7b, '÷': 0x7c, 'Ñ': 0x7d, 'ñ': 0x7e,
+}
+
+// Caracteres especiales (0x11) y extendidos (0x12 y 0x13); los extendidos
+// van tras un carácter básico aproximado que el decodificador sustituye
+type sccChar struct {
+	code     [2]byte
+	fallback byte
+}
+
+var sccSpecialChars = map[rune]sccChar{
+	'®': {code: [2]byte{0x11, 0x30}}, '°': {code: [2]byte{0x11, 0x31}}, '½': {code: [2]byte{0x11, 0x32}},
+	'¿': {code: [2]byte{0x11, 0x33}}, '™': {code: [2]byte{0x11, 0x34}}, '¢': {code: [2]byte{0x11, 0x35}},
+	'£': {code: [2]byte{0x11, 0x36}}, '♪': {code: [2]byte{0x11, 0x37}}, 'à': {code: [2]byte{0x11, 0x38}},
+	'è': {code: [2]byte{0x11, 0x3a}}, 'â': {code: [2]byte{0x11, 0x3b}}, 'ê': {code: [2]byte{0x11, 0x3c}},
+	'î': {code: [2]byte{0x11, 0x3d}}, 'ô': {code: [2]byte{0x11, 0x3e}}, 'û': {code: [2]byte{0x11, 0x3f}},
+
+	'Á': {[2]byte{0x12, 0x20}, 'A'}, 'É': {[2]byte{0x12, 0x21}, 'E'}, 'Ó': {[2]byte{0x12, 0x22}, 'O'},
+	'Ú': {[2]byte{0x12, 0x23}, 'U'}, 'Ü': {[2]byte{0x12, 0x24}, 'U'}, 'ü': {[2]byte{0x12, 0x25}, 'u'},
+	'‘': {[2]byte{0x12, 0x26}, '\''}, '¡': {[2]byte{0x12, 0x27}, '!'}, '*': {[2]byte{0x12, 0x28}, '.'},
+	'’': {[2]byte{0x12, 0x29}, '\''}, '—': {[2]byte{0x12, 0x2a}, '-'}, '©': {[2]byte{0x12, 0x2b}, 'c'},
+	'•': {[2]byte{0x12, 0x2d}, '.'}, '“': {[2]byte{0x12, 0x2e}, '"'}, '”': {[2]byte{0x12, 0x2f}, '"'},
+	'À': {[2]byte{0x12, 0x30}, 'A'}, 'Â': {[2]byte{0x12, 0x31}, 'A'}, 'Ç': {[2]byte{0x12, 0x32}, 'C'},
+	'È': {[2]byte{0x12, 0x33}, 'E'}, 'Ê': {[2]byte{0x12, 0x34}, 'E'}, 'Ë': {[2]byte{0x12, 0x35}, 'E'},
+	'ë': {[2]byte{0x12, 0x36}, 'e'}, 'Î': {[2]byte{0x12, 0x37}, 'I'}, 'Ï': {[2]byte{0x12, 0x38}, 'I'},
+	'ï': {[2]byte{0x12, 0x39}, 'i'}, 'Ô': {[2]byte{0x12, 0x3a}, 'O'}, 'Ù': {[2]byte{0x12, 0x3b}, 'U'},
+	'ù': {[2]byte{0x12, 0x3c}, 'u'}, 'Û': {[2]byte{0x12, 0x3d}, 'U'}, '«': {[2]byte{0x12, 0x3e}, '"'},
+	'»': {[2]byte{0x12, 0x3f}, '"'},
+
+	'Ã': {[2]byte{0x13, 0x20}, 'A'}, 'ã': {[2]byte{0x13, 0x21}, 'a'}, 'Í': {[2]byte{0x13, 0x22}, 'I'},
+	'Ì': {[2]byte{0x13, 0x23}, 'I'}, 'ì': {[2]byte{0x13, 0x24}, 'i'}, 'Ò': {[2]byte{0x13, 0x25}, 'O'},
+	'ò': {[2]byte{0x13, 0x26}, 'o'}, 'Õ': {[2]byte{0x13, 0x27}, 'O'}, 'õ': {[2]byte{0x13, 0x28}, 'o'},
+	'{': {[2]byte{0x13, 0x29}, '('}, '}': {[2]byte{0x13, 0x2a}, ')'}, '\\': {[2]byte{0x13, 0x2b}, '/'},
+	'^': {[2]byte{0x13, 0x2c}, '\''}, '_': {[2]byte{0x13, 0x2d}, '-'}, '|': {[2]byte{0x13, 0x2e}, '!'},
+	'~': {[2]byte{0x13, 0x2f}, '-'}, 'Ä': {[2]byte{0x13, 0x30}, 'A'}, 'ä': {[2]byte{0x13, 0x31}, 'a'},
+	'Ö': {[2]byte{0x13, 0x32}, 'O'}, 'ö': {[2]byte{0x13, 0x33}, 'o'}, 'ß': {[2]byte{0x13, 0x34}, 's'},
+	'¥': {[2]byte{0x13, 0x35}, 'Y'}, 'Å': {[2]byte{0x13, 0x38}, 'A'}, 'å': {[2]byte{0x13, 0x39}, 'a'},
+	'Ø': {[2]byte{0x13, 0x3a}, 'O'}, 'ø': {[2]byte{0x13, 0x3b}, 'o'},
+}
+
+// Bit de paridad impar en el bit 7
+func sccParity(b byte) byte {
+	b &= 0x7f
+	ones := 0
+	for v := b; v != 0; v >>= 1 {
+		ones += int(v & 1)
+	}
+	if ones%2 == 0 {
+		b |= 0x80
+	}
+	return b
+}
+
+// Palabras de 16 bits de un cue, en el orden de transmisión
+type sccWords []string
+
+func (w *sccWords) pair(b1, b2 byte) {
+	*w = append(*w, fmt.Sprintf("%02x%02x", sccParity(b1), sccParity(b2)))
+}
+
+// Los códigos de control se envían dos veces, como es habitual
+func (w *sccWords) control(code [2]byte) {
+	w.pair(code[0], code[1])
+	w.pair(code[0], code[1])
+}
+
+// Texto de una fila: los caracteres básicos van de dos en dos y los demás
+// códigos empiezan en palabra nueva
+func (w *sccWords) text(line string) {
+	var pending []byte
+	flush := func() {
+		if len(pending) == 1 {
+			w.pair(pending[0], 0)
+		}
+		pending = pending[:0]
+	}
+	basic := func(b byte) {
+		if pending = append(pending, b); len(pending) == 2 {
+			w.pair(pending[0], pending[1])
+			pending = pending[:0]
+		}
+	}
+	for _, r := range line {
+		if b, ok := sccBasicChars[r]; ok {
+			basic(b)
+			continue
+		}
+		if special, ok := sccSpecialChars[r]; ok {
+			if special.fallback != 0 {
+				basic(special.fallback)
+			}
+			flush()
+			w.control(special.code)
+			continue
+		}
+		if r == '`' {
+			// 0x60 es la ú
+			basic('\'')
+			continue
+		}
+		// Sin equivalente: la letra sin diacríticos o '?'
+		if base := []rune(norm.NFD.String(string(r))); base[0] >= 0x20 && base[0] < 0x7f && base[0] != '`' {
+			basic(byte(base[0]))
+		} else {
+			basic('?')
+		}
+	}
+	flush()
+}
+
+// Carga en memoria oculta un cue en las últimas filas, centrado; el EOC lo
+// muestra
+func sccLoadCue(cue Cue) sccWords {
+	lines := cue.Lines
+	if len(lines) > sccMaxRows {
+		lines = lines[len(lines)-sccMaxRows:]
+	}
+	var w sccWords
+	w.control(sccResumeLoading)
+	w.control(sccEraseMemory)
+	for i, line := range lines {
+		// Las marcas combinantes (p. ej. los tonos del yorùbá) no tienen
+		// equivalente y no ocupan columna
+		var runes []rune
+		for _, r := range norm.NFC.String(line) {
+			if !unicode.Is(unicode.Mn, r) {
+				runes = append(runes, r)
+			}
+		}
+		if len(runes) > sccMaxColumns {
+			runes = runes[:sccMaxColumns]
+		}
+		column := (sccMaxColumns - len(runes)) / 2
+		row := sccRowPreambles[15-len(lines)+1+i]
+		// El PAC sangra de 4 en 4 columnas; el resto con Tab Offset
+		w.control([2]byte{row[0], row[1] + 0x10 + byte(column/4*2)})
+		if tab := column % 4; tab > 0 {
+			w.control([2]byte{0x17, 0x20 + byte(tab)})
+		}
+		w.text(string(runes))
+	}
+	w.control(sccEndOfCaption)
+	return w
+}
+
+// Scenarist SCC con CEA-608 pop-on en el canal 1. Se transmite una palabra
+// por fotograma, así que cada cue se empieza a cargar antes para que el
+// EOC caiga en su inicio; la pantalla se borra al final salvo que el
+// siguiente cue la sustituya antes.
+func renderSCC(cues []Cue, rate frameRate) string {
+	loads := make([]sccWords, len(cues))
+	for i, cue := range cues {
+		loads[i] = sccLoadCue(cue)
+	}
+	loadAt := func(i int) int {
+		return rate.frame(cues[i].Start) - len(loads[i]) + 1
+	}
+
+	var b strings.Builder
+	b.WriteString("Scenarist_SCC V1.0\n\n")
+	cursor := 0 // primer fotograma libre
+	emit := func(frame int, words sccWords) {
+		if frame < cursor {
+			frame = cursor
+		}
+		fmt.Fprintf(&b, "%s\t%s\n\n", rate.timecode(frame), strings.Join(words, " "))
+		cursor = frame + len(words)
+	}
+	for i := range cues {
+		emit(loadAt(i), loads[i])
+		var clear sccWords
+		clear.control(sccEraseDisplayed)
+		end := rate.frame(cues[i].End)
+		if end < cursor {
+			end = cursor
+		}
+		if i+1 < len(cues) && end+len(clear) > loadAt(i+1) {
+			continue
+		}
+		emit(end, clear)
+	}
+	return b.String()
+}
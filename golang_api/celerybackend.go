@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// Backends de WHISPER_BACKENDS atendidos por workers Celery:
+// celery+redis://host:6379/0?queue=whisper (celery+rediss:// con TLS). El
+// gateway deja la tarea en la cola del broker con el formato de Celery y
+// lee el resultado del result backend de Redis, sin pasar por la API HTTP
+// del servicio Python.
+const celeryScheme = "celery+"
+
+// Tareas de python_service/app/worker.py
+const (
+	celeryTaskName   = "whisper.transcribe"
+	celeryWarmupTask = "whisper.warmup"
+)
+
+// Cola por defecto de Celery
+const celeryDefaultQueue = "celery"
+
+// Clave (y canal) del result backend de Redis de Celery
+const celeryResultPrefix = "celery-task-meta-"
+
+// Estados de Celery que terminan la tarea; antes está PENDING, STARTED,
+// RETRY o PROGRESS
+const (
+	celerySuccess = "SUCCESS"
+	celeryFailure = "FAILURE"
+	celeryRevoked = "REVOKED"
+)
+
+func isCeleryBackend(baseURL string) bool {
+	return strings.HasPrefix(baseURL, celeryScheme+"redis://") || strings.HasPrefix(baseURL, celeryScheme+"rediss://")
+}
+
+// Mensaje del protocolo 2 de Celery tal como lo guarda kombu en Redis
+type celeryMessage struct {
+	Body            string                 `json:"body"` // [args, kwargs, embed] en base64
+	ContentEncoding string                 `json:"content-encoding"`
+	ContentType     string                 `json:"content-type"`
+	Headers         map[string]interface{} `json:"headers"`
+	Properties      map[string]interface{} `json:"properties"`
+}
+
+// Entrada del result backend. Result es la respuesta de POST /transcribe,
+// la excepción con FAILURE o {"segments": [...]} con PROGRESS.
+type celeryResult struct {
+	Status string          `json:"status"`
+	Result json.RawMessage `json:"result"`
+}
+
+// Excepción de una tarea fallida
+type celeryException struct {
+	Type    string        `json:"exc_type"`
+	Message []interface{} `json:"exc_message"`
+}
+
+// Broker de un backend Celery y su cola
+type celeryBroker struct {
+	client *redis.Client
+	queue  string
+}
+
+type celeryTranscriber struct {
+	mu      sync.Mutex
+	brokers map[string]*celeryBroker
+}
+
+var celeryBackend = &celeryTranscriber{brokers: make(map[string]*celeryBroker)}
+
+// Cliente de Redis de cada URL, creado en el primer uso
+func (t *celeryTranscriber) broker(baseURL string) (*celeryBroker, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if b, ok := t.brokers[baseURL]; ok {
+		return b, nil
+	}
+	u, err := url.Parse(strings.TrimPrefix(baseURL, celeryScheme))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid backend URL")
+	}
+	queue := u.Query().Get("queue")
+	if queue == "" {
+		queue = celeryDefaultQueue
+	}
+	u.RawQuery = ""
+	opts, err := redis.ParseURL(u.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid backend URL")
+	}
+	b := &celeryBroker{client: redis.NewClient(opts), queue: queue}
+	t.brokers[baseURL] = b
+	return b, nil
+}
+
+// Tarea para la cola. Caduca en expires para que un worker no empiece una
+// tarea que el gateway ya dio por perdida.
+func (b *celeryBroker) message(id, task string, args []interface{}, kwargs map[string]interface{}, expires time.Time) ([]byte, error) {
+	embed := map[string]interface{}{"callbacks": nil, "errbacks": nil, "chain": nil, "chord": nil}
+	body, err := json.Marshal([]interface{}{args, kwargs, embed})
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	return json.Marshal(celeryMessage{
+		Body:            base64.StdEncoding.EncodeToString(body),
+		ContentEncoding: "utf-8",
+		ContentType:     "application/json",
+		Headers: map[string]interface{}{
+			"lang":      "py",
+			"task":      task,
+			"id":        id,
+			"root_id":   id,
+			"parent_id": nil,
+			"group":     nil,
+			"retries":   0,
+			"eta":       nil,
+			"expires":   expires.UTC().Format("2006-01-02T15:04:05.000000+00:00"),
+			"timelimit": []interface{}{nil, nil},
+			"origin":    "gateway@" + host,
+		},
+		Properties: map[string]interface{}{
+			"correlation_id": id,
+			"delivery_mode":  2,
+			"delivery_info":  map[string]interface{}{"exchange": "", "routing_key": b.queue},
+			"priority":       0,
+			"body_encoding":  "base64",
+			"delivery_tag":   uuid.NewString(),
+		},
+	})
+}
+
+// Entrada del result backend; nil si la tarea aún no tiene
+func (b *celeryBroker) result(ctx context.Context, key string) (*celeryResult, error) {
+	data, err := b.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result celeryResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, &backendError{code: "INVALID_BACKEND_RESPONSE", message: errors.Wrap(err, "failed to parse celery result").Error(), retryable: true}
+	}
+	return &result, nil
+}
+
+// Una excepción de validación no cambia en otro backend; el resto (CUDA,
+// memoria, descarga) sí se reintenta
+func celeryFailureError(raw json.RawMessage) *backendError {
+	var exc celeryException
+	json.Unmarshal(raw, &exc)
+	message := exc.Type
+	if len(exc.Message) > 0 {
+		message += ": " + fmt.Sprint(exc.Message[0])
+	}
+	return &backendError{code: "BACKEND_ERROR", message: "celery task failed: " + message, retryable: exc.Type != "ValidationError"}
+}
+
+// Encola la tarea con el mismo ID que un job v2 y espera su resultado,
+// avisado por el canal del result backend o sondeando cada
+// BACKEND_POLL_INTERVAL. Si el gateway se reinicia, un resultado ya
+// guardado se aprovecha en lugar de repetir la transcripción.
+func (t *celeryTranscriber) transcribe(ctx context.Context, baseURL string, payload PythonRequest) (*BackendResponse, error) {
+	b, err := t.broker(baseURL)
+	if err != nil {
+		return nil, &backendError{code: "BACKEND_UNAVAILABLE", message: err.Error()}
+	}
+	c := live()
+	ctx, cancel := context.WithTimeout(ctx, c.BackendJobTimeout.Duration)
+	defer cancel()
+	id := backendJobID(payload)
+	key := celeryResultPrefix + id
+
+	// Suscrito antes de encolar para no perder el aviso
+	sub := b.client.Subscribe(ctx, key)
+	defer sub.Close()
+	payload.Partials.begin()
+	result, err := b.result(ctx, key)
+	if err != nil {
+		return nil, &backendError{code: "BACKEND_UNAVAILABLE", message: errors.Wrap(err, "failed to read celery result").Error(), retryable: true}
+	}
+	if result == nil || result.Status == celeryFailure || result.Status == celeryRevoked {
+		// La petición como en POST /transcribe y el X-Request-ID aparte
+		kwargs := map[string]interface{}{"request_id": payload.RequestID}
+		msg, err := b.message(id, celeryTaskName, []interface{}{payload}, kwargs, time.Now().Add(c.BackendJobTimeout.Duration))
+		if err != nil {
+			return nil, &backendError{code: "INTERNAL_ERROR", message: errors.Wrap(err, "failed to marshal celery task").Error()}
+		}
+		pipe := b.client.TxPipeline()
+		pipe.Del(ctx, key)
+		pipe.LPush(ctx, b.queue, msg)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, &backendError{code: "BACKEND_UNAVAILABLE", message: errors.Wrap(err, "failed to enqueue celery task").Error(), retryable: true}
+		}
+		result = nil
+	}
+	// Terminada o abandonada, el resultado ya no hace falta
+	defer func() {
+		if err := b.client.Del(context.Background(), key).Err(); err != nil {
+			log.Printf("⚠️ No se pudo borrar el resultado %s del backend %s: %v", key, baseURL, err)
+		}
+	}()
+
+	ticker := time.NewTicker(c.BackendPollInterval.Duration)
+	defer ticker.Stop()
+	notify := sub.Channel()
+	var unreachableSince time.Time
+	published := 0
+	for {
+		if result != nil {
+			switch result.Status {
+			case celerySuccess:
+				return parseBackendResult(baseURL, result.Result)
+			case celeryFailure:
+				return nil, celeryFailureError(result.Result)
+			case celeryRevoked:
+				return nil, &backendError{code: "BACKEND_ERROR", message: "celery task was revoked", retryable: true}
+			}
+			var progress struct {
+				Segments []json.RawMessage `json:"segments"`
+			}
+			if json.Unmarshal(result.Result, &progress) == nil {
+				published = publishBackendSegments(baseURL, progress.Segments, published, payload.Partials)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, &backendError{code: "BACKEND_TIMEOUT", message: fmt.Sprintf("celery task did not finish within %s", c.BackendJobTimeout.Duration), retryable: true}
+		case <-notify:
+		case <-ticker.C:
+		}
+		next, err := b.result(ctx, key)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			// Redis reiniciándose: la tarea sigue en la cola o en un worker
+			if unreachableSince.IsZero() {
+				unreachableSince = time.Now()
+				log.Printf("⚠️ Broker %s sin respuesta para la tarea %s: %v", baseURL, id, err)
+			}
+			if time.Since(unreachableSince) > c.BackendRestartGrace.Duration {
+				return nil, &backendError{code: "BACKEND_UNAVAILABLE", message: errors.Wrap(err, "failed to read celery result").Error(), retryable: true}
+			}
+			continue
+		}
+		unreachableSince = time.Time{}
+		result = next
+	}
+}
+
+// Encola whisper.warmup y espera a que un worker la termine. Con varios
+// workers en la cola solo se calienta el que la recoge.
+func (t *celeryTranscriber) warmup(ctx context.Context, baseURL, model string) error {
+	b, err := t.broker(baseURL)
+	if err != nil {
+		return err
+	}
+	id := uuid.NewString()
+	key := celeryResultPrefix + id
+	deadline, _ := ctx.Deadline()
+	msg, err := b.message(id, celeryWarmupTask, []interface{}{model}, map[string]interface{}{}, deadline)
+	if err != nil {
+		return err
+	}
+	sub := b.client.Subscribe(ctx, key)
+	defer sub.Close()
+	if err := b.client.LPush(ctx, b.queue, msg).Err(); err != nil {
+		return errors.Wrap(err, "failed to enqueue celery task")
+	}
+	defer b.client.Del(context.Background(), key)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.New("celery warm-up task did not finish in time")
+		case <-sub.Channel():
+		case <-ticker.C:
+		}
+		result, err := b.result(ctx, key)
+		if err != nil || result == nil {
+			continue
+		}
+		switch result.Status {
+		case celerySuccess:
+			return nil
+		case celeryFailure:
+			return celeryFailureError(result.Result)
+		case celeryRevoked:
+			return errors.New("celery warm-up task was revoked")
+		}
+	}
+}
+
+// Tareas esperando en la cola del broker
+func (t *celeryTranscriber) capacity(ctx context.Context, baseURL string) (*BackendCapacity, bool, error) {
+	b, err := t.broker(baseURL)
+	if err != nil {
+		return nil, false, err
+	}
+	n, err := b.client.LLen(ctx, b.queue).Result()
+	if err != nil {
+		return nil, false, errors.Wrap(err, "broker unreachable")
+	}
+	return &BackendCapacity{QueueLength: int(n)}, true, nil
+}
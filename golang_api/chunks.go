@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Progreso de un job troceado
+type ChunkProgress struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+}
+
+// Audio largo descargado por el gateway: se trocea para poder reanudar
+func shouldChunk(source string, duration float64) bool {
+	return cfg.ChunkDuration.Duration > 0 && source != "" && duration > cfg.ChunkDuration.Seconds()
+}
+
+// Transcribe el medio por fragmentos de ChunkDuration. Cada resultado se
+// persiste en cuanto llega, así que tras un reinicio solo se repiten los
+// fragmentos pendientes. Devuelve el modelo de respaldo usado, si lo hubo.
+func transcribeChunked(ctx context.Context, jobID, source string, duration float64, payload PythonRequest) (*BackendResponse, string, error) {
+	size := cfg.ChunkDuration.Seconds()
+	total := int(math.Ceil(duration / size))
+
+	done := make(map[int]BackendResponse)
+	if stateStore != nil {
+		loaded, err := stateStore.LoadChunks(jobID)
+		if err != nil {
+			jobLogf(jobID, "⚠️ No se pudieron cargar los fragmentos del job %s: %v", jobID, err)
+		} else {
+			done = loaded
+		}
+	}
+	updateJob(jobID, func(job *JobState) { job.Chunks = &ChunkProgress{Total: total, Completed: len(done)} })
+
+	fallbackModel := ""
+	for i := 0; i < total; i++ {
+		if _, ok := done[i]; ok {
+			continue
+		}
+		start := float64(i) * size
+		end := math.Min(start+size, duration)
+
+		chunkPath := filepath.Join(filepath.Dir(source), fmt.Sprintf("chunk-%d.wav", i))
+		if err := cutClip(source, chunkPath, start, end); err != nil {
+			return nil, "", &backendError{code: "INTERNAL_ERROR", message: errors.Wrapf(err, "failed to cut chunk %d", i).Error()}
+		}
+		chunkPayload := payload
+		chunkPayload.FilePath = backendPath(chunkPath)
+		if payload.Partials != nil {
+			// Lo ya transcrito se ve en /result mientras llega este fragmento
+			prior := mergeChunks(done, i, size)
+			chunkPayload.Partials = &partialTranscript{jobID: jobID, offset: start, segments: prior.Segments, text: prior.Transcription}
+		}
+		result, model, err := transcribePayload(ctx, jobID, chunkPayload)
+		os.Remove(chunkPath)
+		if err != nil {
+			return nil, "", err
+		}
+		if model != "" {
+			// Los fragmentos siguientes usan ya el modelo de respaldo
+			payload.Model = model
+			fallbackModel = model
+		}
+
+		done[i] = *result
+		if stateStore != nil {
+			if err := stateStore.SaveChunk(jobID, i, *result); err != nil {
+				jobLogf(jobID, "⚠️ No se pudo persistir el fragmento %d del job %s: %v", i, jobID, err)
+			}
+		}
+		updateJob(jobID, func(job *JobState) { job.Chunks.Completed = len(done) })
+	}
+
+	return mergeChunks(done, total, size), fallbackModel, nil
+}
+
+// Une los fragmentos desplazando tiempos y renumerando segmentos
+func mergeChunks(chunks map[int]BackendResponse, total int, size float64) *BackendResponse {
+	merged := &BackendResponse{}
+	var texts, translations []string
+	languages := make(map[string]int)
+	for i := 0; i < total; i++ {
+		chunk := chunks[i]
+		offset := float64(i) * size
+		if t := strings.TrimSpace(chunk.Transcription); t != "" {
+			texts = append(texts, t)
+		}
+		if t := strings.TrimSpace(chunk.Translation); t != "" {
+			translations = append(translations, t)
+		}
+		if chunk.Language != "" {
+			languages[chunk.Language]++
+			if merged.Language == "" || languages[chunk.Language] > languages[merged.Language] {
+				merged.Language = chunk.Language
+			}
+		}
+		if merged.ModelUsed == "" {
+			merged.ModelUsed = chunk.ModelUsed
+		}
+		for _, seg := range chunk.Segments {
+			seg = shiftSegment(seg, offset)
+			seg.ID = len(merged.Segments)
+			merged.Segments = append(merged.Segments, seg)
+		}
+		for _, ch := range chunk.Chapters {
+			ch.Start += offset
+			ch.End += offset
+			merged.Chapters = append(merged.Chapters, ch)
+		}
+	}
+	merged.Transcription = strings.Join(texts, " ")
+	merged.Translation = strings.Join(translations, " ")
+	return merged
+}
+
+// Desplaza un segmento del fragmento a su posición en el audio completo
+func shiftSegment(seg Segment, offset float64) Segment {
+	seg.Start += offset
+	seg.End += offset
+	words := make([]Word, len(seg.Words))
+	for j, w := range seg.Words {
+		w.Start += offset
+		w.End += offset
+		words[j] = w
+	}
+	if len(words) > 0 {
+		seg.Words = words
+	}
+	return seg
+}
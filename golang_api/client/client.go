@@ -0,0 +1,1186 @@
+// Package client es el cliente Go de la API de transcripción: métodos
+// tipados, reintentos ante errores transitorios y espera de jobs.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Error devuelto por la API con su código estable (p. ej. CONCURRENCY_LIMIT)
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Message    string `json:"error"`
+	Code       string `json:"code,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"` // segundos sugeridos (modo mantenimiento)
+	Detail     string `json:"detail,omitempty"`      // original en inglés si Message es una traducción genérica
+	RequestID  string `json:"request_id,omitempty"`  // para citarlo al contactar con soporte
+}
+
+type requestIDKey struct{}
+
+// WithRequestID hace que las peticiones hechas con ctx envíen X-Request-ID,
+// para correlacionarlas con los logs del servicio
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("%d: %s", e.StatusCode, e.Message)
+}
+
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+	retries    int
+	backoff    time.Duration
+	language   string
+
+	// Con WithSigningKey las peticiones van firmadas en lugar de con apiKey
+	keyID         string
+	signingSecret string
+}
+
+type Option func(*Client)
+
+// API key o token de sesión de CreateSession (ses_...)
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// Firma cada petición (X-Key-ID y X-Signature) en lugar de enviar el
+// secreto, como exigen las keys con require_signature. keyID es el ID de la
+// key gestionada o el nombre de la estática. El servicio rechaza una firma
+// repetida: dos peticiones idénticas en el mismo segundo fallan con
+// REPLAYED_REQUEST.
+func WithSigningKey(keyID, secret string) Option {
+	return func(c *Client) { c.keyID, c.signingSecret = keyID, secret }
+}
+
+// Idioma de los mensajes de error (en, es, yo), enviado como Accept-Language
+func WithLanguage(lang string) Option {
+	return func(c *Client) { c.language = lang }
+}
+
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// Reintentos ante 429, 502, 503, 504 y errores de red (solo en peticiones
+// idempotentes); la espera crece linealmente desde backoff
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+		retries:    3,
+		backoff:    500 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Ejecuta la petición y decodifica la respuesta JSON en out (si no es nil)
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errors.Wrapf(err, "failed to decode %s %s response", method, path)
+	}
+	return nil
+}
+
+// Envía con reintentos; devuelve la respuesta solo si es 2xx
+func (c *Client) send(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encode request")
+		}
+		payload = data
+	}
+	idempotent := method == http.MethodGet || method == http.MethodPut || method == http.MethodDelete
+
+	var lastErr error
+	var signedAt int64
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Duration(attempt) * c.backoff):
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		c.setHeaders(ctx, req)
+		signedAt = c.sign(req, payload, signedAt)
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			if ctx.Err() != nil || !idempotent {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		apiErr := readAPIError(resp)
+		lastErr = apiErr
+		// En mantenimiento los reintentos inmediatos no sirven
+		if apiErr.Code == "MAINTENANCE" {
+			return nil, apiErr
+		}
+		// Sin idempotencia solo se reintenta lo que seguro no se procesó
+		if !retryableStatus(resp.StatusCode) || (!idempotent && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+			return nil, apiErr
+		}
+	}
+	return nil, lastErr
+}
+
+// API key, idioma y request ID de ctx
+func (c *Client) setHeaders(ctx context.Context, req *http.Request) {
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if c.language != "" {
+		req.Header.Set("Accept-Language", c.language)
+	}
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok && id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+}
+
+// Firma la petición si hay WithSigningKey: HMAC-SHA256 de
+// "<t>.<método>.<ruta con query>.<cuerpo>". Cada reintento lleva un
+// timestamp posterior a after para no repetir la firma.
+func (c *Client) sign(req *http.Request, body []byte, after int64) int64 {
+	if c.keyID == "" {
+		return 0
+	}
+	ts := time.Now().Unix()
+	if ts <= after {
+		ts = after + 1
+	}
+	stamp := strconv.FormatInt(ts, 10)
+	mac := hmac.New(sha256.New, []byte(c.signingSecret))
+	mac.Write([]byte(stamp + "." + req.Method + "." + req.URL.RequestURI() + "."))
+	mac.Write(body)
+	req.Header.Set("X-Key-ID", c.keyID)
+	req.Header.Set("X-Signature", "t="+stamp+",v1="+hex.EncodeToString(mac.Sum(nil)))
+	return ts
+}
+
+// Lee y cierra el cuerpo de una respuesta de error
+func readAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = resp.Header.Get("X-Request-ID")
+	}
+	return apiErr
+}
+
+// CreateSession canjea un ID token OIDC por una sesión; su SessionToken se
+// usa después con WithAPIKey
+func (c *Client) CreateSession(ctx context.Context, idToken string) (*Session, error) {
+	var out Session
+	if err := c.do(ctx, http.MethodPost, "/auth/session", map[string]string{"id_token": idToken}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Me devuelve la identidad con la que el servidor atiende al cliente
+func (c *Client) Me(ctx context.Context) (*Identity, error) {
+	var out Identity
+	if err := c.do(ctx, http.MethodGet, "/auth/me", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Upload sube un medio (POST /uploads) y devuelve la URL para Process. Con
+// encoding "gzip" o "zstd" r ya debe ir comprimido. Sin reintentos: r no se
+// puede releer.
+func (c *Client) Upload(ctx context.Context, r io.Reader, filename, encoding string) (*Upload, error) {
+	var signed []byte
+	if c.keyID != "" {
+		// La firma cubre el cuerpo entero
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read upload")
+		}
+		signed, r = data, bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/uploads?filename="+url.QueryEscape(filename), r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	c.setHeaders(ctx, req)
+	c.sign(req, signed, 0)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, readAPIError(resp)
+	}
+	defer resp.Body.Close()
+	var out Upload
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, errors.Wrap(err, "failed to decode POST /uploads response")
+	}
+	return &out, nil
+}
+
+// PresignUpload pide un enlace para subir el medio directamente al almacén
+// de artefactos; filename solo aporta la extensión
+func (c *Client) PresignUpload(ctx context.Context, filename string) (*PresignedUpload, error) {
+	var out PresignedUpload
+	body := struct {
+		Filename string `json:"filename"`
+	}{filename}
+	if err := c.do(ctx, http.MethodPost, "/uploads", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Probe sondea un medio (url o uploadID) sin crear el job; model elige el
+// factor de la estimación
+func (c *Client) Probe(ctx context.Context, mediaURL, uploadID, model string) (*MediaProbe, error) {
+	var out MediaProbe
+	body := struct {
+		URL      string `json:"url,omitempty"`
+		UploadID string `json:"upload_id,omitempty"`
+		Model    string `json:"model,omitempty"`
+	}{mediaURL, uploadID, model}
+	if err := c.do(ctx, http.MethodPost, "/probe", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Process crea un job asíncrono (POST /process)
+func (c *Client) Process(ctx context.Context, req ProcessRequest) (*ProcessResponse, error) {
+	var out ProcessResponse
+	if err := c.do(ctx, http.MethodPost, "/process", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DryRun valida la petición como Process y comprueba el medio y el cupo de
+// la key sin crear el job (POST /process?dry_run=true)
+func (c *Client) DryRun(ctx context.Context, req ProcessRequest) (*DryRunResult, error) {
+	var out DryRunResult
+	if err := c.do(ctx, http.MethodPost, "/process?dry_run=true", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// TranscribeSync transcribe audio corto en la misma petición
+func (c *Client) TranscribeSync(ctx context.Context, req ProcessRequest) (*SyncResponse, error) {
+	var out SyncResponse
+	if err := c.do(ctx, http.MethodPost, "/transcribe/sync", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Job devuelve el estado actual (GET /result/:job_id)
+func (c *Client) Job(ctx context.Context, jobID string) (*Job, error) {
+	var out Job
+	if err := c.do(ctx, http.MethodGet, "/result/"+url.PathEscape(jobID), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Transcript devuelve la transcripción en el esquema versionado; vacío pide
+// la versión actual
+func (c *Client) Transcript(ctx context.Context, jobID, schemaVersion string) (*TranscriptDocument, error) {
+	path := "/result/" + url.PathEscape(jobID) + "/transcript"
+	if schemaVersion != "" {
+		path += "?schema_version=" + url.QueryEscape(schemaVersion)
+	}
+	var out TranscriptDocument
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Jobs lista todos los jobs por ID
+func (c *Client) Jobs(ctx context.Context) (map[string]Job, error) {
+	out := make(map[string]Job)
+	if err := c.do(ctx, http.MethodGet, "/jobs", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FindJobs lista los jobs que cumplen el filtro, por ID
+func (c *Client) FindJobs(ctx context.Context, filter JobFilter) (map[string]Job, error) {
+	q := url.Values{}
+	if filter.Status != "" {
+		q.Set("status", filter.Status)
+	}
+	if filter.ReviewStatus != "" {
+		q.Set("review_status", filter.ReviewStatus)
+	}
+	if filter.Assignee != "" {
+		q.Set("assignee", filter.Assignee)
+	}
+	path := "/jobs"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	out := make(map[string]Job)
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// JobFeed devuelve los jobs terminados (status "", completed, failed o skipped) que
+// terminaron después de since; since vacío devuelve los últimos
+func (c *Client) JobFeed(ctx context.Context, status, since string, limit int) (*JobFeed, error) {
+	q := url.Values{}
+	if status != "" {
+		q.Set("status", status)
+	}
+	if since != "" {
+		q.Set("since", since)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	path := "/jobs/feed"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var out JobFeed
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Stats devuelve los agregados del tenant entre from y to (YYYY-MM-DD,
+// incluidos); vacíos son los últimos 30 días
+func (c *Client) Stats(ctx context.Context, from, to string) (*Stats, error) {
+	q := url.Values{}
+	if from != "" {
+		q.Set("from", from)
+	}
+	if to != "" {
+		q.Set("to", to)
+	}
+	path := "/stats"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var out Stats
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// JobStatuses devuelve el estado (sin resultado) de varios jobs en una sola
+// petición, y los IDs que el servidor no conoce
+func (c *Client) JobStatuses(ctx context.Context, jobIDs []string) (map[string]JobStatus, []string, error) {
+	var out struct {
+		Jobs     map[string]JobStatus `json:"jobs"`
+		NotFound []string             `json:"not_found"`
+	}
+	body := struct {
+		JobIDs []string `json:"job_ids"`
+	}{jobIDs}
+	if err := c.do(ctx, http.MethodPost, "/jobs/status", body, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Jobs, out.NotFound, nil
+}
+
+// AdminJobs lista todos los jobs con el worker que los ejecuta
+func (c *Client) AdminJobs(ctx context.Context) ([]AdminJob, error) {
+	var out struct {
+		Jobs []AdminJob `json:"jobs"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/admin/jobs", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Jobs, nil
+}
+
+// Queue devuelve el estado de la cola
+func (c *Client) Queue(ctx context.Context) (*QueueState, error) {
+	var out QueueState
+	if err := c.do(ctx, http.MethodGet, "/admin/queue", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PauseQueue deja de asignar jobs a los backends; los nuevos esperan en queued
+func (c *Client) PauseQueue(ctx context.Context, reason string) (*QueueState, error) {
+	var out QueueState
+	body := map[string]string{"reason": reason}
+	if err := c.do(ctx, http.MethodPost, "/admin/queue/pause", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ResumeQueue vuelve a asignar jobs
+func (c *Client) ResumeQueue(ctx context.Context) (*QueueState, error) {
+	var out QueueState
+	if err := c.do(ctx, http.MethodPost, "/admin/queue/resume", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SchedulerStats devuelve el reparto de workers entre tenants de la réplica
+// que responde y sus últimas asignaciones
+func (c *Client) SchedulerStats(ctx context.Context) (*SchedulerStats, error) {
+	var out SchedulerStats
+	if err := c.do(ctx, http.MethodGet, "/admin/scheduler", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Maintenance devuelve el modo mantenimiento efectivo
+func (c *Client) Maintenance(ctx context.Context) (*MaintenanceState, error) {
+	var out MaintenanceState
+	if err := c.do(ctx, http.MethodGet, "/admin/maintenance", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetMaintenance activa o desactiva el modo mantenimiento
+func (c *Client) SetMaintenance(ctx context.Context, req MaintenanceRequest) (*MaintenanceState, error) {
+	var out MaintenanceState
+	if err := c.do(ctx, http.MethodPut, "/admin/maintenance", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ReloadConfig aplica en la réplica que responde los cambios de la
+// configuración que no requieren reiniciar
+func (c *Client) ReloadConfig(ctx context.Context) (*ConfigReload, error) {
+	var out ConfigReload
+	if err := c.do(ctx, http.MethodPost, "/admin/config/reload", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ExplainRouting evalúa las reglas de backend_routing con los datos de in
+func (c *Client) ExplainRouting(ctx context.Context, in RoutingInput) (*RoutingExplanation, error) {
+	var out RoutingExplanation
+	if err := c.do(ctx, http.MethodPost, "/admin/routing/explain", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ExplainJobRouting evalúa las reglas de backend_routing con los datos del
+// job e indica dónde se ejecutó
+func (c *Client) ExplainJobRouting(ctx context.Context, jobID string) (*RoutingExplanation, error) {
+	body := struct {
+		JobID string `json:"job_id"`
+	}{jobID}
+	var out RoutingExplanation
+	if err := c.do(ctx, http.MethodPost, "/admin/routing/explain", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ExportMetadata sube ya una exportación de los metadatos de los jobs en
+// format ("csv", "parquet" o "" para el del servidor)
+func (c *Client) ExportMetadata(ctx context.Context, format string) (*MetadataExport, error) {
+	body := struct {
+		Format string `json:"format,omitempty"`
+	}{format}
+	var out MetadataExport
+	if err := c.do(ctx, http.MethodPost, "/admin/exports", body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// MetadataExports lista las últimas exportaciones, la más reciente primero
+func (c *Client) MetadataExports(ctx context.Context) ([]MetadataExport, error) {
+	var out struct {
+		Exports []MetadataExport `json:"exports"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/admin/exports", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Exports, nil
+}
+
+// Alerts devuelve las reglas de alerta con su último valor
+func (c *Client) Alerts(ctx context.Context) ([]AlertStatus, error) {
+	var out struct {
+		Alerts []AlertStatus `json:"alerts"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/admin/alerts", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Alerts, nil
+}
+
+// EraseSubjectData borra los jobs terminados que cumplen los criterios, con
+// sus artefactos, medio y entradas de caché
+func (c *Client) EraseSubjectData(ctx context.Context, req ErasureRequest) (*ErasureReport, error) {
+	var out ErasureReport
+	if err := c.do(ctx, http.MethodPost, "/admin/erasure", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Events devuelve el historial del job
+func (c *Client) Events(ctx context.Context, jobID string) ([]JobEvent, error) {
+	var out struct {
+		Events []JobEvent `json:"events"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(jobID)+"/events", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Events, nil
+}
+
+// Wait consulta el job cada interval hasta que termina o se cancela ctx.
+// Un job fallido se devuelve sin error; hay que mirar Status.
+func (c *Client) Wait(ctx context.Context, jobID string, interval time.Duration) (*Job, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		job, err := c.Job(ctx, jobID)
+		if err != nil {
+			return nil, err
+		}
+		if job.Done() {
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessAndWait crea el job y espera a que termine
+func (c *Client) ProcessAndWait(ctx context.Context, req ProcessRequest, interval time.Duration) (*Job, error) {
+	created, err := c.Process(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return c.Wait(ctx, created.JobID, interval)
+}
+
+// Subtitles descarga los subtítulos en formato "srt", "vtt", "ttml" o "scc"
+func (c *Client) Subtitles(ctx context.Context, jobID, format string, opts *SubtitleOptions) (string, error) {
+	q := url.Values{}
+	if format != "" {
+		q.Set("format", format)
+	}
+	if opts != nil {
+		if opts.MaxCharsPerLine > 0 {
+			q.Set("max_chars_per_line", strconv.Itoa(opts.MaxCharsPerLine))
+		}
+		if opts.MaxLinesPerCue > 0 {
+			q.Set("max_lines_per_cue", strconv.Itoa(opts.MaxLinesPerCue))
+		}
+		if opts.MinCueSeconds > 0 {
+			q.Set("min_cue_seconds", strconv.FormatFloat(opts.MinCueSeconds, 'f', -1, 64))
+		}
+		if opts.MaxCueSeconds > 0 {
+			q.Set("max_cue_seconds", strconv.FormatFloat(opts.MaxCueSeconds, 'f', -1, 64))
+		}
+		if opts.SpeakerPrefix != nil {
+			q.Set("speaker_prefix", strconv.FormatBool(*opts.SpeakerPrefix))
+		}
+		if opts.FrameRate != "" {
+			q.Set("frame_rate", opts.FrameRate)
+		}
+	}
+	path := "/result/" + url.PathEscape(jobID) + "/subtitles"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	resp, err := c.send(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Clips recorta fragmentos del audio del job
+func (c *Client) Clips(ctx context.Context, jobID string, req ClipsRequest) ([]Clip, error) {
+	var out struct {
+		Clips []Clip `json:"clips"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/jobs/"+url.PathEscape(jobID)+"/clips", req, &out); err != nil {
+		return nil, err
+	}
+	return out.Clips, nil
+}
+
+// Align re-alinea un texto corregido con el audio del job
+func (c *Client) Align(ctx context.Context, jobID, text string) ([]Segment, error) {
+	var out struct {
+		Segments []Segment `json:"segments"`
+	}
+	body := map[string]string{"text": text}
+	if err := c.do(ctx, http.MethodPost, "/jobs/"+url.PathEscape(jobID)+"/align", body, &out); err != nil {
+		return nil, err
+	}
+	return out.Segments, nil
+}
+
+// RetranscribeSegment repite la transcripción de un segmento; model y
+// prompt vacíos usan los del job
+func (c *Client) RetranscribeSegment(ctx context.Context, jobID string, segmentID int, model, prompt string) (*Segment, error) {
+	var out struct {
+		Segment Segment `json:"segment"`
+	}
+	body := map[string]string{"model": model, "prompt": prompt}
+	path := fmt.Sprintf("/jobs/%s/segments/%d/retranscribe", url.PathEscape(jobID), segmentID)
+	if err := c.do(ctx, http.MethodPost, path, body, &out); err != nil {
+		return nil, err
+	}
+	return &out.Segment, nil
+}
+
+// ClaimReview asigna la revisión del job a la API key del cliente
+func (c *Client) ClaimReview(ctx context.Context, jobID string) (*JobReview, error) {
+	return c.review(ctx, jobID, "claim")
+}
+
+// ReleaseReview devuelve la revisión a needs_review
+func (c *Client) ReleaseReview(ctx context.Context, jobID string) (*JobReview, error) {
+	return c.review(ctx, jobID, "release")
+}
+
+// ApproveReview aprueba el job; requiere haber llamado antes a ClaimReview
+func (c *Client) ApproveReview(ctx context.Context, jobID string) (*JobReview, error) {
+	return c.review(ctx, jobID, "approve")
+}
+
+func (c *Client) review(ctx context.Context, jobID, action string) (*JobReview, error) {
+	var out JobReview
+	if err := c.do(ctx, http.MethodPost, "/jobs/"+url.PathEscape(jobID)+"/review/"+action, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Annotations lista las anotaciones del job en orden de start
+func (c *Client) Annotations(ctx context.Context, jobID string) ([]Annotation, error) {
+	var out struct {
+		Annotations []Annotation `json:"annotations"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(jobID)+"/annotations", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Annotations, nil
+}
+
+// CreateAnnotation comenta un tramo de la transcripción de un job completado
+func (c *Client) CreateAnnotation(ctx context.Context, jobID string, req AnnotationRequest) (*Annotation, error) {
+	var out Annotation
+	if err := c.do(ctx, http.MethodPost, "/jobs/"+url.PathEscape(jobID)+"/annotations", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteAnnotation borra una anotación
+func (c *Client) DeleteAnnotation(ctx context.Context, jobID, annotationID string) error {
+	return c.do(ctx, http.MethodDelete, "/jobs/"+url.PathEscape(jobID)+"/annotations/"+url.PathEscape(annotationID), nil, nil)
+}
+
+// Share crea un enlace firmado y con caducidad que muestra la transcripción
+// sin API key
+func (c *Client) Share(ctx context.Context, jobID string, req ShareRequest) (*ShareLink, error) {
+	var out ShareLink
+	if err := c.do(ctx, http.MethodPost, "/jobs/"+url.PathEscape(jobID)+"/share", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeShares invalida todos los enlaces públicos del job
+func (c *Client) RevokeShares(ctx context.Context, jobID string) error {
+	return c.do(ctx, http.MethodDelete, "/jobs/"+url.PathEscape(jobID)+"/share", nil, nil)
+}
+
+// ArtifactURL devuelve el enlace temporal de descarga de un artefacto
+func (c *Client) ArtifactURL(ctx context.Context, jobID, name string) (string, error) {
+	hc := *c.httpClient
+	hc.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		c.baseURL+"/jobs/"+url.PathEscape(jobID)+"/artifacts/"+url.PathEscape(name), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	c.sign(req, nil, 0)
+	resp, err := hc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(apiErr)
+		return "", apiErr
+	}
+	return resp.Header.Get("Location"), nil
+}
+
+// Glossary devuelve el glosario del tenant
+func (c *Client) Glossary(ctx context.Context) ([]GlossaryEntry, error) {
+	var out struct {
+		Entries []GlossaryEntry `json:"entries"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/glossary", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Entries, nil
+}
+
+// SetGlossary reemplaza el glosario del tenant
+func (c *Client) SetGlossary(ctx context.Context, entries []GlossaryEntry) error {
+	body := map[string][]GlossaryEntry{"entries": entries}
+	return c.do(ctx, http.MethodPut, "/glossary", body, nil)
+}
+
+// DeleteGlossary borra el glosario del tenant
+func (c *Client) DeleteGlossary(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/glossary", nil, nil)
+}
+
+// Retention devuelve la política de retención del tenant
+func (c *Client) Retention(ctx context.Context) (*RetentionPolicy, error) {
+	var out RetentionPolicy
+	if err := c.do(ctx, http.MethodGet, "/retention", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetRetention reemplaza la política; se aplica también a los jobs existentes
+func (c *Client) SetRetention(ctx context.Context, policy RetentionPolicy) (*RetentionPolicy, error) {
+	var out RetentionPolicy
+	if err := c.do(ctx, http.MethodPut, "/retention", policy, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RetentionDeletions lista los borrados de la política, el más reciente primero
+func (c *Client) RetentionDeletions(ctx context.Context, limit int) ([]RetentionDeletion, error) {
+	path := "/retention/deletions"
+	if limit > 0 {
+		path += "?limit=" + strconv.Itoa(limit)
+	}
+	var out struct {
+		Deletions []RetentionDeletion `json:"deletions"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Deletions, nil
+}
+
+// Templates lista las plantillas de opciones del tenant
+func (c *Client) Templates(ctx context.Context) ([]JobTemplate, error) {
+	var out struct {
+		Templates []JobTemplate `json:"templates"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/templates", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Templates, nil
+}
+
+// CreateTemplate crea una plantilla; falla con 409 si el nombre ya existe
+func (c *Client) CreateTemplate(ctx context.Context, req TemplateRequest) (*JobTemplate, error) {
+	var out JobTemplate
+	if err := c.do(ctx, http.MethodPost, "/templates", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) Template(ctx context.Context, name string) (*JobTemplate, error) {
+	var out JobTemplate
+	if err := c.do(ctx, http.MethodGet, "/templates/"+url.PathEscape(name), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) UpdateTemplate(ctx context.Context, name string, req TemplateRequest) (*JobTemplate, error) {
+	var out JobTemplate
+	if err := c.do(ctx, http.MethodPut, "/templates/"+url.PathEscape(name), req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteTemplate(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/templates/"+url.PathEscape(name), nil, nil)
+}
+
+// Features devuelve las funciones experimentales activas para el tenant
+func (c *Client) Features(ctx context.Context) (map[string]bool, error) {
+	var out struct {
+		Features map[string]bool `json:"features"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/features", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Features, nil
+}
+
+// Models lista los modelos propios del tenant y los modelos whisper estándar
+func (c *Client) Models(ctx context.Context) (custom []CustomModel, builtin []string, err error) {
+	var out struct {
+		Models  []CustomModel `json:"models"`
+		Builtin []string      `json:"builtin"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/models", nil, &out); err != nil {
+		return nil, nil, err
+	}
+	return out.Models, out.Builtin, nil
+}
+
+// PutModel registra o reemplaza un modelo afinado servido por un backend del pool
+func (c *Client) PutModel(ctx context.Context, name string, req CustomModelRequest) (*CustomModel, error) {
+	var out CustomModel
+	if err := c.do(ctx, http.MethodPut, "/models/"+url.PathEscape(name), req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteModel(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/models/"+url.PathEscape(name), nil, nil)
+}
+
+// Webhooks lista los webhooks del tenant (sin secretos)
+func (c *Client) Webhooks(ctx context.Context) ([]Webhook, error) {
+	var out struct {
+		Webhooks []Webhook `json:"webhooks"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/webhooks", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Webhooks, nil
+}
+
+// WebhookEvents devuelve el catálogo de eventos, con un cuerpo de ejemplo
+func (c *Client) WebhookEvents(ctx context.Context) ([]WebhookEventInfo, error) {
+	var out struct {
+		Events []WebhookEventInfo `json:"events"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/webhooks/events", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Events, nil
+}
+
+// CreateWebhook registra un webhook; el resultado incluye el secreto
+func (c *Client) CreateWebhook(ctx context.Context, req WebhookRequest) (*Webhook, error) {
+	var out Webhook
+	if err := c.do(ctx, http.MethodPost, "/webhooks", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) Webhook(ctx context.Context, webhookID string) (*Webhook, error) {
+	var out Webhook
+	if err := c.do(ctx, http.MethodGet, "/webhooks/"+url.PathEscape(webhookID), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) UpdateWebhook(ctx context.Context, webhookID string, req WebhookRequest) (*Webhook, error) {
+	var out Webhook
+	if err := c.do(ctx, http.MethodPatch, "/webhooks/"+url.PathEscape(webhookID), req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, webhookID string) error {
+	return c.do(ctx, http.MethodDelete, "/webhooks/"+url.PathEscape(webhookID), nil, nil)
+}
+
+// RotateWebhookSecret genera un secreto nuevo; el anterior sigue firmando
+// hasta la fecha devuelta
+func (c *Client) RotateWebhookSecret(ctx context.Context, webhookID string) (*Webhook, time.Time, error) {
+	var out struct {
+		Webhook                 Webhook   `json:"webhook"`
+		PreviousSecretExpiresAt time.Time `json:"previous_secret_expires_at"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/webhooks/"+url.PathEscape(webhookID)+"/rotate-secret", nil, &out); err != nil {
+		return nil, time.Time{}, err
+	}
+	return &out.Webhook, out.PreviousSecretExpiresAt, nil
+}
+
+// Integrations lista los destinos de exportación del tenant
+func (c *Client) Integrations(ctx context.Context) ([]Integration, error) {
+	var out struct {
+		Integrations []Integration `json:"integrations"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/integrations", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Integrations, nil
+}
+
+// CreateIntegration exporta a partir de ahora las transcripciones
+// completadas a Google Docs o Notion, vigila una carpeta de Drive o Dropbox
+// o acepta las grabaciones de una cuenta de Twilio o de Zoom, los audios
+// enviados por correo o las notas de voz de un bot de Telegram o WhatsApp
+func (c *Client) CreateIntegration(ctx context.Context, req IntegrationRequest) (*Integration, error) {
+	var out Integration
+	if err := c.do(ctx, http.MethodPost, "/integrations", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) Integration(ctx context.Context, integrationID string) (*Integration, error) {
+	var out Integration
+	if err := c.do(ctx, http.MethodGet, "/integrations/"+url.PathEscape(integrationID), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) UpdateIntegration(ctx context.Context, integrationID string, req IntegrationRequest) (*Integration, error) {
+	var out Integration
+	if err := c.do(ctx, http.MethodPatch, "/integrations/"+url.PathEscape(integrationID), req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteIntegration(ctx context.Context, integrationID string) error {
+	return c.do(ctx, http.MethodDelete, "/integrations/"+url.PathEscape(integrationID), nil, nil)
+}
+
+// SFTPCredentials lista los hosts SFTP del tenant (sin secretos)
+func (c *Client) SFTPCredentials(ctx context.Context) ([]SFTPCredential, error) {
+	var out struct {
+		Credentials []SFTPCredential `json:"credentials"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/sftp/credentials", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Credentials, nil
+}
+
+// PutSFTPCredential guarda con qué se descargan las URL sftp:// del host
+func (c *Client) PutSFTPCredential(ctx context.Context, host string, req SFTPCredentialRequest) (*SFTPCredential, error) {
+	var out SFTPCredential
+	if err := c.do(ctx, http.MethodPut, "/sftp/credentials/"+url.PathEscape(host), req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) DeleteSFTPCredential(ctx context.Context, host string) error {
+	return c.do(ctx, http.MethodDelete, "/sftp/credentials/"+url.PathEscape(host), nil, nil)
+}
+
+// Keys lista las API keys gestionadas del tenant (sin secretos)
+func (c *Client) Keys(ctx context.Context) ([]ManagedKey, error) {
+	var out struct {
+		Keys []ManagedKey `json:"keys"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/keys", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Keys, nil
+}
+
+// CreateKey crea una API key; el resultado incluye el secreto en Key
+func (c *Client) CreateKey(ctx context.Context, req KeyRequest) (*ManagedKey, error) {
+	var out ManagedKey
+	if err := c.do(ctx, http.MethodPost, "/keys", req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) Key(ctx context.Context, keyID string) (*ManagedKey, error) {
+	var out ManagedKey
+	if err := c.do(ctx, http.MethodGet, "/keys/"+url.PathEscape(keyID), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) RevokeKey(ctx context.Context, keyID string) error {
+	return c.do(ctx, http.MethodDelete, "/keys/"+url.PathEscape(keyID), nil, nil)
+}
+
+// RotateKey genera un secreto nuevo; el anterior vale hasta PreviousExpiresAt
+func (c *Client) RotateKey(ctx context.Context, keyID string) (*ManagedKey, error) {
+	var out ManagedKey
+	if err := c.do(ctx, http.MethodPost, "/keys/"+url.PathEscape(keyID)+"/rotate", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetKeyAllowedCIDRs sustituye los rangos de IP desde los que se acepta la
+// key; una lista vacía quita la restricción
+func (c *Client) SetKeyAllowedCIDRs(ctx context.Context, keyID string, cidrs []string) (*ManagedKey, error) {
+	if cidrs == nil {
+		cidrs = []string{}
+	}
+	var out ManagedKey
+	if err := c.do(ctx, http.MethodPatch, "/keys/"+url.PathEscape(keyID), KeyUpdateRequest{AllowedCIDRs: cidrs}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AuditEvents devuelve el registro de auditoría del tenant, el más reciente
+// primero; eventType vacío no filtra
+func (c *Client) AuditEvents(ctx context.Context, eventType string, limit int) ([]AuditEvent, error) {
+	q := url.Values{}
+	if eventType != "" {
+		q.Set("type", eventType)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	path := "/audit"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var out struct {
+		Events []AuditEvent `json:"events"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Events, nil
+}
+
+// Capacity devuelve la capacidad agregada de los backends
+func (c *Client) Capacity(ctx context.Context) (*CapacitySummary, error) {
+	var out CapacitySummary
+	if err := c.do(ctx, http.MethodGet, "/capacity", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// InvalidateCache borra los resultados en caché de la URL; los filtros
+// vacíos abarcan todos los valores
+func (c *Client) InvalidateCache(ctx context.Context, mediaURL, language, model string) (int, error) {
+	q := url.Values{"url": {mediaURL}}
+	if language != "" {
+		q.Set("language", language)
+	}
+	if model != "" {
+		q.Set("model", model)
+	}
+	var out struct {
+		Deleted int `json:"deleted"`
+	}
+	if err := c.do(ctx, http.MethodDelete, "/cache?"+q.Encode(), nil, &out); err != nil {
+		return 0, err
+	}
+	return out.Deleted, nil
+}
@@ -0,0 +1,977 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Tipos de la API tal como viajan por HTTP (ver openapi.yaml)
+
+// Estados de un job
+const (
+	StatusQueued      = "queued"
+	StatusDownloading = "downloading"
+	StatusTranscoding = "transcoding"
+	StatusProcessing  = "processing"
+	StatusCompleted   = "completed"
+	StatusFailed      = "failed"
+	StatusSkipped     = "skipped" // idioma fuera de OnlyIfLanguage; sin transcripción
+)
+
+// Tipos de job
+const (
+	JobTypeTranscription = "transcription"
+	JobTypeBurnSubtitles = "burn_subtitles"
+)
+
+// Sesión de una persona (POST /auth/session)
+type Session struct {
+	SessionToken string    `json:"session_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	User         string    `json:"user"`
+	Role         string    `json:"role"` // viewer, editor, admin u operator
+	Tenant       string    `json:"tenant"`
+}
+
+type Identity struct {
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	Tenant string `json:"tenant"`
+}
+
+type ProcessRequest struct {
+	Type            string           `json:"type,omitempty"`
+	Template        string           `json:"template,omitempty"` // sus opciones se aplican si aquí van vacías
+	URL             string           `json:"url,omitempty"`
+	UploadID        string           `json:"upload_id,omitempty"` // en lugar de URL, tras PresignUpload
+	Language        string           `json:"language,omitempty"`
+	Translate       bool             `json:"translate,omitempty"`
+	Model           string           `json:"model,omitempty"`
+	SHA256          string           `json:"sha256,omitempty"`
+	Accuracy        string           `json:"accuracy,omitempty"` // "high": dos pasadas, más lento
+	Review          bool             `json:"review,omitempty"`   // al completarse queda en needs_review
+	Diarize         bool             `json:"diarize,omitempty"`  // segmentos con speaker, si el backend lo soporta
+	Subtitles       *SubtitleOptions `json:"subtitles,omitempty"`
+	Format          *FormatOptions   `json:"format,omitempty"`
+	TranscriptJobID string           `json:"transcript_job_id,omitempty"`
+
+	// Si el idioma detectado no es uno de estos, el job termina como
+	// StatusSkipped sin transcribir
+	OnlyIfLanguage []string `json:"only_if_language,omitempty"`
+
+	// 0 a 9; los de más prioridad salen antes que los demás del tenant
+	Priority int `json:"priority,omitempty"`
+
+	// Identifican al job para EraseSubjectData
+	Tags     []string          `json:"tags,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Medio subido con Upload; URL y SHA256 van en ProcessRequest
+type Upload struct {
+	ID          string    `json:"upload_id"`
+	URL         string    `json:"url"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	ContentType string    `json:"content_type,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Enlace de PresignUpload: el medio se sube con PUT a UploadURL, sin API
+// key, y el job se crea con ProcessRequest.UploadID
+type PresignedUpload struct {
+	ID        string    `json:"upload_id"`
+	UploadURL string    `json:"upload_url"`
+	Method    string    `json:"method"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Medio sondeado con Probe
+type MediaProbe struct {
+	DurationSeconds  float64 `json:"duration_seconds"`
+	Format           string  `json:"format,omitempty"`
+	Codec            string  `json:"codec"`
+	Channels         int     `json:"channels"`
+	SampleRate       int     `json:"sample_rate"`
+	SizeBytes        int64   `json:"size_bytes,omitempty"`
+	Model            string  `json:"model,omitempty"`
+	EstimatedSeconds float64 `json:"estimated_seconds"` // sin la espera en cola
+}
+
+// DryRunResult es lo que haría Process con la petición. OK es false si
+// algún check está en "fail"; Code es el error con el que fallaría el job.
+type DryRunResult struct {
+	DryRun              bool          `json:"dry_run"`
+	OK                  bool          `json:"ok"`
+	Type                string        `json:"type"`
+	Model               string        `json:"model,omitempty"`
+	Backend             string        `json:"backend,omitempty"`
+	Cache               bool          `json:"cache,omitempty"`
+	GatewayDownload     bool          `json:"gateway_download"`
+	ContentType         string        `json:"content_type,omitempty"`
+	Media               *MediaProbe   `json:"media,omitempty"`
+	Lane                string        `json:"lane,omitempty"`
+	Chunked             bool          `json:"chunked,omitempty"`
+	EstimatedGPUMinutes float64       `json:"estimated_gpu_minutes,omitempty"`
+	Checks              []DryRunCheck `json:"checks"`
+	Sandbox             bool          `json:"sandbox,omitempty"`
+	RoutingRule         string        `json:"routing_rule,omitempty"`
+}
+
+type DryRunCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"` // ok, warn, fail o skipped
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type ProcessResponse struct {
+	JobID  string `json:"job_id"`
+	Status string `json:"status"`
+	Cache  bool   `json:"cache,omitempty"`
+}
+
+type Job struct {
+	Type          string            `json:"type"`
+	Status        string            `json:"status"`
+	Transcription string            `json:"transcription,omitempty"`
+	Translation   string            `json:"translation,omitempty"`
+	Language      string            `json:"language,omitempty"`
+	Segments      []Segment         `json:"segments,omitempty"`
+	Chapters      []Chapter         `json:"chapters,omitempty"`
+	Stats         *TranscriptStats  `json:"stats,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	ErrorCode     string            `json:"error_code,omitempty"`
+	Download      *DownloadProgress `json:"download,omitempty"`
+	APIKey        string            `json:"api_key,omitempty"`
+	Tags          []string          `json:"tags,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	Duration      float64           `json:"duration_seconds,omitempty"`
+	Lane          string            `json:"lane,omitempty"`
+	Backend       string            `json:"backend,omitempty"`
+	RoutingRule   string            `json:"routing_rule,omitempty"`
+	Cache         bool              `json:"cache,omitempty"`
+	Artifacts     []Artifact        `json:"artifacts,omitempty"`
+	Deliveries    []JobDelivery     `json:"deliveries,omitempty"`
+	Chunks        *ChunkProgress    `json:"chunks,omitempty"`
+	MediaFormat   string            `json:"media_format,omitempty"`
+	SpeechRatio   *float64          `json:"speech_ratio,omitempty"`
+	AudioQuality  *AudioQuality     `json:"audio_quality,omitempty"`
+	Review        *JobReview        `json:"review,omitempty"`
+	PurgedAt      *time.Time        `json:"purged_at,omitempty"` // la retención del tenant borró el texto
+	RequestID     string            `json:"request_id,omitempty"`
+	Timestamp     time.Time         `json:"timestamp"`
+
+	// Crece en cada cambio del job; un valor menor que el ya visto es una
+	// respuesta atrasada
+	UpdatedSeq int64 `json:"updated_seq"`
+
+	// Segments y Transcription aún provisionales, mientras se transcribe
+	Partial bool `json:"partial,omitempty"`
+
+	// Detección de idioma de los jobs con OnlyIfLanguage
+	LanguageCheck *LanguageCheck `json:"language_check,omitempty"`
+
+	// Job con el mismo audio cuyo resultado se copió
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+
+	// EffectivePriority solo mientras espera un worker: sube con la espera
+	Priority          int  `json:"priority,omitempty"`
+	EffectivePriority *int `json:"effective_priority,omitempty"`
+
+	// Coste estimado con el que cuenta en el tope de minutos de GPU
+	EstimatedGPUMinutes float64 `json:"estimated_gpu_minutes,omitempty"`
+
+	// Creado con una key de sandbox: transcripción de prueba, sin backend
+	Sandbox bool `json:"sandbox,omitempty"`
+}
+
+type LanguageCheck struct {
+	Detected      string   `json:"detected,omitempty"`
+	Allowed       []string `json:"allowed"`
+	Matched       bool     `json:"matched"`
+	Model         string   `json:"model"`
+	SampleSeconds float64  `json:"sample_seconds"`
+}
+
+// Estados de JobDelivery.Status
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+	DeliveryCanceled  = "canceled"
+)
+
+// Exportación del job a una integración (documento o almacén)
+type JobDelivery struct {
+	IntegrationID string    `json:"integration_id"`
+	Provider      string    `json:"provider"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts,omitempty"`
+	Message       string    `json:"message,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Estados de la revisión humana (JobReview.Status)
+const (
+	ReviewNeeded     = "needs_review"
+	ReviewInProgress = "in_review"
+	ReviewApproved   = "approved"
+)
+
+// Revisión humana de un job creado con Review
+type JobReview struct {
+	Status     string     `json:"status"`
+	Assignee   string     `json:"assignee,omitempty"`
+	ClaimedAt  *time.Time `json:"claimed_at,omitempty"`
+	ApprovedBy string     `json:"approved_by,omitempty"`
+	ApprovedAt *time.Time `json:"approved_at,omitempty"`
+}
+
+// Comentario sobre un tramo de la transcripción
+type Annotation struct {
+	ID        string    `json:"id"`
+	Author    string    `json:"author"`
+	Start     float64   `json:"start"`
+	End       float64   `json:"end"`
+	SegmentID *int      `json:"segment_id,omitempty"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Cuerpo de CreateAnnotation: Start y End, o solo SegmentID
+type AnnotationRequest struct {
+	Author    string   `json:"author,omitempty"` // vacío = nombre de la API key
+	Start     *float64 `json:"start,omitempty"`
+	End       *float64 `json:"end,omitempty"`
+	SegmentID *int     `json:"segment_id,omitempty"`
+	Text      string   `json:"text"`
+}
+
+// Cuerpo de Share; ExpiresIn es una duración Go como "72h", vacía = la
+// del servidor
+type ShareRequest struct {
+	ExpiresIn string `json:"expires_in,omitempty"`
+}
+
+// Enlace público de solo lectura a la transcripción
+type ShareLink struct {
+	URL       string    `json:"url"`
+	JSONURL   string    `json:"json_url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Filtros de FindJobs; los vacíos no filtran
+type JobFilter struct {
+	Status       string
+	ReviewStatus string
+	Assignee     string
+}
+
+// Calidad del audio de entrada (AUDIO_ANALYSIS en el servidor)
+type AudioQuality struct {
+	BackgroundMusic bool     `json:"background_music"`
+	SNRDB           *float64 `json:"snr_db,omitempty"`
+	NoiseFloorDB    *float64 `json:"noise_floor_db,omitempty"`
+	RMSLevelDB      float64  `json:"rms_level_db"`
+	PeakLevelDB     float64  `json:"peak_level_db"`
+	ClippingRatio   float64  `json:"clipping_ratio"`
+	Clipped         bool     `json:"clipped"`
+}
+
+// Done indica si el job ya no va a cambiar de estado
+func (j *Job) Done() bool {
+	return j.Status == StatusCompleted || j.Status == StatusFailed || j.Status == StatusSkipped
+}
+
+type JobEvent struct {
+	Type      string    `json:"type"`
+	Status    string    `json:"status,omitempty"`
+	Code      string    `json:"code,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Seq       int64     `json:"seq,omitempty"` // UpdatedSeq del job tras el evento
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type Segment struct {
+	ID       int     `json:"id"`
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Text     string  `json:"text"`
+	Language string  `json:"language,omitempty"`
+	Speaker  string  `json:"speaker,omitempty"`
+	Words    []Word  `json:"words,omitempty"`
+
+	AvgLogprob   *float64 `json:"avg_logprob,omitempty"`
+	NoSpeechProb *float64 `json:"no_speech_prob,omitempty"`
+}
+
+type Word struct {
+	Word        string  `json:"word"`
+	Start       float64 `json:"start"`
+	End         float64 `json:"end"`
+	Probability float64 `json:"probability,omitempty"`
+}
+
+// Capítulo del audio, solo si el backend los detecta
+type Chapter struct {
+	Title string  `json:"title"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// Transcripción en el esquema versionado (GET /result/:job_id/transcript).
+// Las versiones 1.x solo añaden campos opcionales.
+type TranscriptDocument struct {
+	SchemaVersion string              `json:"schema_version"`
+	JobID         string              `json:"job_id"`
+	Language      string              `json:"language,omitempty"`
+	Text          string              `json:"text"`
+	Translation   string              `json:"translation,omitempty"`
+	Duration      float64             `json:"duration_seconds,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+	PurgedAt      *time.Time          `json:"purged_at,omitempty"`
+	Segments      []TranscriptSegment `json:"segments"`
+	Speakers      []TranscriptSpeaker `json:"speakers"`
+	Chapters      []Chapter           `json:"chapters"`
+}
+
+type TranscriptSegment struct {
+	ID       int              `json:"id"`
+	Start    float64          `json:"start"`
+	End      float64          `json:"end"`
+	Text     string           `json:"text"`
+	Language string           `json:"language,omitempty"`
+	Speaker  string           `json:"speaker,omitempty"`
+	Words    []TranscriptWord `json:"words"`
+
+	AvgLogprob          *float64 `json:"avg_logprob,omitempty"`
+	NoSpeechProbability *float64 `json:"no_speech_probability,omitempty"`
+}
+
+type TranscriptWord struct {
+	Text       string   `json:"text"`
+	Start      float64  `json:"start"`
+	End        float64  `json:"end"`
+	Confidence *float64 `json:"confidence,omitempty"`
+}
+
+type TranscriptSpeaker struct {
+	ID              string  `json:"id"`
+	SegmentCount    int     `json:"segment_count"`
+	SpeakingSeconds float64 `json:"speaking_seconds"`
+}
+
+type TranscriptStats struct {
+	WordCount      int                `json:"word_count"`
+	CharacterCount int                `json:"character_count"`
+	WordsPerMinute float64            `json:"words_per_minute,omitempty"`
+	Languages      map[string]float64 `json:"languages,omitempty"`
+	Diacritics     *DiacriticsReport  `json:"diacritics,omitempty"`
+}
+
+// Cobertura de diacríticos de una transcripción en yorùbá
+type DiacriticsReport struct {
+	Words        int      `json:"words"`
+	MarkedWords  int      `json:"marked_words"`
+	Coverage     float64  `json:"coverage"`
+	FixedWords   int      `json:"fixed_words"`
+	InvalidWords []string `json:"invalid_words,omitempty"`
+}
+
+// Estado de un job sin el resultado (JobStatuses)
+type JobStatus struct {
+	Type      string            `json:"type"`
+	Status    string            `json:"status"`
+	Error     string            `json:"error,omitempty"`
+	ErrorCode string            `json:"error_code,omitempty"`
+	Download  *DownloadProgress `json:"download,omitempty"`
+	Chunks    *ChunkProgress    `json:"chunks,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+
+	UpdatedSeq int64 `json:"updated_seq"`
+}
+
+type DownloadProgress struct {
+	BytesDownloaded int64  `json:"bytes_downloaded"`
+	TotalBytes      int64  `json:"total_bytes,omitempty"`
+	Attempts        int    `json:"attempts"`
+	SHA256          string `json:"sha256,omitempty"`
+}
+
+type ChunkProgress struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+}
+
+type Artifact struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+}
+
+type SyncResponse struct {
+	Transcription string           `json:"transcription"`
+	Translation   string           `json:"translation,omitempty"`
+	Language      string           `json:"language,omitempty"`
+	Segments      []Segment        `json:"segments,omitempty"`
+	Chapters      []Chapter        `json:"chapters,omitempty"`
+	Stats         *TranscriptStats `json:"stats,omitempty"`
+	Duration      float64          `json:"duration_seconds,omitempty"`
+	Cache         bool             `json:"cache,omitempty"`
+}
+
+type SubtitleOptions struct {
+	MaxCharsPerLine int     `json:"max_chars_per_line,omitempty"`
+	MaxLinesPerCue  int     `json:"max_lines_per_cue,omitempty"`
+	MinCueSeconds   float64 `json:"min_cue_seconds,omitempty"`
+	MaxCueSeconds   float64 `json:"max_cue_seconds,omitempty"`
+	SpeakerPrefix   *bool   `json:"speaker_prefix,omitempty"` // false anula el valor del job
+
+	// TTML y SCC: 23.976, 24, 25, 29.97 (drop-frame), 29.97ndf o 30
+	FrameRate string `json:"frame_rate,omitempty"`
+}
+
+// Formato del texto: casing (sentence, lower, upper), punctuation (restore,
+// strip), numerals (digits, words) y diacritics (yorùbá)
+type FormatOptions struct {
+	Casing      string `json:"casing,omitempty"`
+	Punctuation string `json:"punctuation,omitempty"`
+	Numerals    string `json:"numerals,omitempty"`
+	Diacritics  bool   `json:"diacritics,omitempty"`
+}
+
+type TimeRange struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+type ClipsRequest struct {
+	Segments       []int       `json:"segments,omitempty"`
+	Ranges         []TimeRange `json:"ranges,omitempty"`
+	PaddingSeconds float64     `json:"padding_seconds,omitempty"`
+}
+
+// Job terminado de JobFeed, sin segmentos
+type FeedItem struct {
+	ID            string            `json:"id"` // igual a JobID
+	JobID         string            `json:"job_id"`
+	Type          string            `json:"type"`
+	Status        string            `json:"status"`
+	FinishedAt    time.Time         `json:"finished_at"`
+	Language      string            `json:"language,omitempty"`
+	Duration      float64           `json:"duration_seconds,omitempty"`
+	Transcription string            `json:"transcription,omitempty"`
+	Translation   string            `json:"translation,omitempty"`
+	ErrorCode     string            `json:"error_code,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	Tags          []string          `json:"tags,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	APIKey        string            `json:"api_key,omitempty"`
+	ResultURL     string            `json:"result_url,omitempty"`
+	Cursor        string            `json:"cursor"`
+}
+
+type JobFeed struct {
+	Items      []FeedItem `json:"items"` // el más reciente primero
+	NextCursor string     `json:"next_cursor"`
+	HasMore    bool       `json:"has_more"` // volver a pedir con NextCursor
+}
+
+// Resultado de Stats: totales del rango y un elemento por día (UTC)
+type Stats struct {
+	From   string        `json:"from"`
+	To     string        `json:"to"`
+	Totals StatsBucket   `json:"totals"`
+	Days   []StatsBucket `json:"days"`
+}
+
+type StatsBucket struct {
+	Date                 string  `json:"date,omitempty"` // vacío en Totals
+	Jobs                 int     `json:"jobs"`
+	Completed            int     `json:"completed"`
+	Failed               int     `json:"failed"`
+	MinutesTranscribed   float64 `json:"minutes_transcribed"`
+	AvgProcessingSeconds float64 `json:"avg_processing_seconds,omitempty"`
+	FailureRate          float64 `json:"failure_rate"` // de 0 a 1
+}
+
+type Clip struct {
+	Artifact
+	Start     float64 `json:"start"`
+	End       float64 `json:"end"`
+	SegmentID *int    `json:"segment_id,omitempty"`
+}
+
+// Política de retención del tenant; la vacía lo conserva todo
+type RetentionPolicy struct {
+	TranscriptDays int        `json:"transcript_days"`
+	DeleteMedia    bool       `json:"delete_media"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+}
+
+type RetentionDeletion struct {
+	JobID     string    `json:"job_id"`
+	Kind      string    `json:"kind"` // transcript o media
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Criterios de EraseSubjectData; el job tiene que cumplirlos todos
+type ErasureRequest struct {
+	Tenant   string            `json:"tenant,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Instantánea de los metadatos de los jobs en el almacén de artefactos
+type MetadataExport struct {
+	ID        string    `json:"id"`
+	Format    string    `json:"format"` // csv o parquet
+	Key       string    `json:"key"`
+	Rows      int       `json:"rows"`
+	Size      int64     `json:"size"`
+	Trigger   string    `json:"trigger"` // schedule o manual
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `json:"url,omitempty"` // enlace temporal de descarga
+}
+
+// Regla de alerta con el último valor calculado por el servidor
+type AlertStatus struct {
+	Name        string     `json:"name"`
+	Metric      string     `json:"metric"`    // failure_rate o queue_depth
+	Threshold   float64    `json:"threshold"` // failure_rate como fracción
+	Window      string     `json:"window,omitempty"`
+	MinJobs     int        `json:"min_jobs,omitempty"`
+	Value       float64    `json:"value"`
+	Firing      bool       `json:"firing"`
+	Since       *time.Time `json:"since,omitempty"`
+	EvaluatedAt *time.Time `json:"evaluated_at,omitempty"`
+}
+
+// Cuerpo que el servidor envía a ALERT_WEBHOOK_URL en cada cambio de estado
+type AlertNotification struct {
+	Rule      string    `json:"rule"`
+	Metric    string    `json:"metric"`
+	State     string    `json:"state"` // firing o resolved
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	At        time.Time `json:"at"`
+}
+
+// Informe firmado con ERASURE_SIGNING_KEY (HMAC-SHA256 del JSON sin signature)
+type ErasureReport struct {
+	ID           string         `json:"id"`
+	RequestedAt  time.Time      `json:"requested_at"`
+	CompletedAt  time.Time      `json:"completed_at"`
+	RequestedBy  string         `json:"requested_by,omitempty"`
+	Criteria     ErasureRequest `json:"criteria"`
+	Jobs         []string       `json:"jobs"`
+	Skipped      []string       `json:"skipped,omitempty"` // en curso; repetir cuando terminen
+	Artifacts    int            `json:"artifacts"`
+	Media        int            `json:"media"`
+	CacheEntries int            `json:"cache_entries"`
+	Signature    string         `json:"signature"`
+}
+
+type GlossaryEntry struct {
+	Source        string `json:"source"`
+	Target        string `json:"target"`
+	CaseSensitive bool   `json:"case_sensitive,omitempty"`
+}
+
+// Eventos de webhook
+const (
+	WebhookJobCompleted   = "job.completed"
+	WebhookJobFailed      = "job.failed"
+	WebhookJobSkipped     = "job.skipped"
+	WebhookBatchCompleted = "batch.completed"
+)
+
+// Opciones por defecto de una plantilla; mismos campos que ProcessRequest
+type TemplateOptions struct {
+	Language  string           `json:"language,omitempty"`
+	Translate bool             `json:"translate,omitempty"`
+	Model     string           `json:"model,omitempty"`
+	Accuracy  string           `json:"accuracy,omitempty"`
+	Review    bool             `json:"review,omitempty"`
+	Diarize   bool             `json:"diarize,omitempty"`
+	Subtitles *SubtitleOptions `json:"subtitles,omitempty"`
+	Format    *FormatOptions   `json:"format,omitempty"`
+
+	OnlyIfLanguage []string `json:"only_if_language,omitempty"`
+}
+
+type TemplateRequest struct {
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Options     TemplateOptions `json:"options"`
+}
+
+type JobTemplate struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Options     TemplateOptions `json:"options"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// Modelo afinado de un tenant; los jobs con Model = Name van a Backend
+type CustomModel struct {
+	Name         string    `json:"name"`
+	Backend      string    `json:"backend"`
+	BackendModel string    `json:"backend_model,omitempty"`
+	Language     string    `json:"language,omitempty"`
+	Description  string    `json:"description,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type CustomModelRequest struct {
+	Backend      string `json:"backend"`
+	BackendModel string `json:"backend_model,omitempty"`
+	Language     string `json:"language,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Enabled   bool      `json:"enabled"`
+	Secret    string    `json:"secret,omitempty"` // solo al crear o rotar
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Campos nil o vacíos no cambian en UpdateWebhook
+type WebhookRequest struct {
+	URL     *string  `json:"url,omitempty"`
+	Events  []string `json:"events,omitempty"`
+	Enabled *bool    `json:"enabled,omitempty"`
+}
+
+// Destino de exportación de las transcripciones completadas
+type Integration struct {
+	ID           string    `json:"id"`
+	Provider     string    `json:"provider"` // google_docs, notion, google_drive, dropbox, twilio, zoom, email, telegram, whatsapp, discord, s3, gcs, azure_blob, webdav o sftp
+	Name         string    `json:"name,omitempty"`
+	FolderID     string    `json:"folder_id,omitempty"`
+	ParentPageID string    `json:"parent_page_id,omitempty"`
+	Enabled      bool      `json:"enabled"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// Carpetas vigiladas
+	Path         string     `json:"path,omitempty"`
+	Template     string     `json:"template,omitempty"`
+	LastPolledAt *time.Time `json:"last_polled_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+
+	// Grabaciones de Twilio
+	AccountSID string `json:"account_sid,omitempty"`
+
+	// Grabaciones de Zoom
+	AccountID string `json:"account_id,omitempty"`
+
+	// Audios por correo
+	Address        string   `json:"address,omitempty"`
+	AllowedSenders []string `json:"allowed_senders,omitempty"`
+
+	// Bot de WhatsApp
+	PhoneNumberID string `json:"phone_number_id,omitempty"`
+
+	// Bot de Discord
+	ApplicationID string `json:"application_id,omitempty"`
+	PublicKey     string `json:"public_key,omitempty"`
+
+	// Almacenes a los que se copian los artefactos
+	Bucket       string   `json:"bucket,omitempty"`
+	Endpoint     string   `json:"endpoint,omitempty"`
+	Region       string   `json:"region,omitempty"`
+	AccessKeyID  string   `json:"access_key_id,omitempty"`
+	URL          string   `json:"url,omitempty"`
+	Username     string   `json:"username,omitempty"`
+	PathTemplate string   `json:"path_template,omitempty"`
+	Formats      []string `json:"formats,omitempty"`
+}
+
+// Campos nil no cambian en UpdateIntegration; los tokens nunca se devuelven
+type IntegrationRequest struct {
+	Provider     string  `json:"provider,omitempty"`
+	Name         *string `json:"name,omitempty"`
+	FolderID     *string `json:"folder_id,omitempty"`
+	ParentPageID *string `json:"parent_page_id,omitempty"`
+	Path         *string `json:"path,omitempty"`
+	Template     *string `json:"template,omitempty"`
+	AccountSID   *string `json:"account_sid,omitempty"`
+	Enabled      *bool   `json:"enabled,omitempty"`
+	AccessToken  *string `json:"access_token,omitempty"`
+	RefreshToken *string `json:"refresh_token,omitempty"`
+
+	// Grabaciones de Zoom; WebhookSecret también en email y los bots
+	AccountID     *string `json:"account_id,omitempty"`
+	WebhookSecret *string `json:"webhook_secret,omitempty"`
+
+	// Audios por correo; AllowedSenders nil no cambia
+	Address        *string  `json:"address,omitempty"`
+	AllowedSenders []string `json:"allowed_senders,omitempty"`
+
+	// Bot de WhatsApp
+	PhoneNumberID *string `json:"phone_number_id,omitempty"`
+	VerifyToken   *string `json:"verify_token,omitempty"`
+
+	// Bot de Discord; registra /transcribe con AccessToken
+	ApplicationID *string `json:"application_id,omitempty"`
+	PublicKey     *string `json:"public_key,omitempty"`
+
+	// Almacenes; AccessToken es el secreto (sftp usa las credenciales del
+	// host). Formats nil no cambia
+	Bucket       *string  `json:"bucket,omitempty"`
+	Endpoint     *string  `json:"endpoint,omitempty"`
+	Region       *string  `json:"region,omitempty"`
+	AccessKeyID  *string  `json:"access_key_id,omitempty"`
+	URL          *string  `json:"url,omitempty"`
+	Username     *string  `json:"username,omitempty"`
+	PathTemplate *string  `json:"path_template,omitempty"`
+	Formats      []string `json:"formats,omitempty"`
+}
+
+// Credenciales de un host para los jobs con url sftp://
+type SFTPCredential struct {
+	Host      string    `json:"host"`
+	Username  string    `json:"username"`
+	Auth      string    `json:"auth"` // password o private_key
+	HostKey   string    `json:"host_key"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Password o PrivateKey, no ambos; HostKey en formato authorized_keys
+type SFTPCredentialRequest struct {
+	Username   string `json:"username"`
+	Password   string `json:"password,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+	HostKey    string `json:"host_key"`
+}
+
+// Evento del catálogo de WebhookEvents
+type WebhookEventInfo struct {
+	Type        string         `json:"type"`
+	Description string         `json:"description"`
+	Emitted     bool           `json:"emitted"` // false: aún no se envía
+	Example     WebhookPayload `json:"example"`
+}
+
+// Cuerpo que recibe el endpoint del webhook
+type WebhookPayload struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Data de job.completed y job.failed
+type WebhookJobData struct {
+	JobID string `json:"job_id"`
+	Job   Job    `json:"job"`
+}
+
+// API key gestionada con /keys
+type ManagedKey struct {
+	ID                string     `json:"id"`
+	Name              string     `json:"name"`
+	Tenant            string     `json:"tenant,omitempty"`
+	Role              string     `json:"role"`
+	MaxConcurrentJobs int        `json:"max_concurrent_jobs,omitempty"`
+	Prefix            string     `json:"prefix"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	LastUsedAt        *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+	PreviousExpiresAt *time.Time `json:"previous_expires_at,omitempty"` // el secreto anterior vale hasta entonces
+	Key               string     `json:"key,omitempty"`                 // solo al crear o rotar
+	Sandbox           bool       `json:"sandbox,omitempty"`
+	RequireSignature  bool       `json:"require_signature,omitempty"` // usar con WithSigningKey(ID, Key)
+
+	AllowedCIDRs []string `json:"allowed_cidrs,omitempty"` // vacío: desde cualquier IP
+}
+
+type KeyRequest struct {
+	Name              string     `json:"name"`
+	Role              string     `json:"role,omitempty"` // por defecto editor
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	MaxConcurrentJobs int        `json:"max_concurrent_jobs,omitempty"`
+	Sandbox           bool       `json:"sandbox,omitempty"`           // jobs con resultados de prueba, sin GPU
+	RequireSignature  bool       `json:"require_signature,omitempty"` // solo peticiones firmadas
+
+	AllowedCIDRs []string `json:"allowed_cidrs,omitempty"` // CIDR o IP suelta
+}
+
+type KeyUpdateRequest struct {
+	AllowedCIDRs []string `json:"allowed_cidrs"` // vacío quita la restricción
+}
+
+// Entrada del registro de auditoría (GET /audit)
+type AuditEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"` // api_key.ip_denied o api_key.allowlist_updated
+	Time      time.Time `json:"time"`
+	Tenant    string    `json:"tenant,omitempty"`
+	APIKey    string    `json:"api_key,omitempty"`
+	Actor     string    `json:"actor,omitempty"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	Method    string    `json:"method,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+type BackendCapacity struct {
+	QueueLength      int     `json:"queue_length"`
+	GPUMemoryUsedMB  float64 `json:"gpu_memory_used_mb,omitempty"`
+	GPUMemoryTotalMB float64 `json:"gpu_memory_total_mb,omitempty"`
+	ModelLoaded      string  `json:"model_loaded,omitempty"`
+
+	// 2 si el backend admite el protocolo v2 (POST /jobs)
+	Protocol int `json:"protocol,omitempty"`
+}
+
+type BackendStatus struct {
+	URL            string           `json:"url"`
+	Healthy        bool             `json:"healthy"`
+	InFlight       int              `json:"in_flight"`
+	MaxConcurrency int              `json:"max_concurrency,omitempty"`
+	Capacity       *BackendCapacity `json:"capacity,omitempty"`
+	Error          string           `json:"error,omitempty"`
+	CheckedAt      time.Time        `json:"checked_at"`
+
+	// cold, warming o warm
+	WarmState string     `json:"warm_state,omitempty"`
+	WarmedAt  *time.Time `json:"warmed_at,omitempty"`
+}
+
+type CapacitySummary struct {
+	Backends        []BackendStatus `json:"backends"`
+	HealthyBackends int             `json:"healthy_backends"`
+	QueueLength     int             `json:"queue_length"`
+	InFlight        int             `json:"in_flight"`
+	Waiting         int             `json:"waiting"`
+}
+
+// QueueState es el estado de la cola de jobs
+type QueueState struct {
+	Paused    bool       `json:"paused"`
+	Reason    string     `json:"reason,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	Waiting   int        `json:"waiting"`
+}
+
+// SchedulerStats es el reparto justo de workers entre tenants: el siguiente
+// worker libre va al tenant con menor VirtualTime
+type SchedulerStats struct {
+	Paused          bool                `json:"paused"`
+	WorkersReserved int                 `json:"workers_reserved"`
+	WorkersGeneral  int                 `json:"workers_general"`
+	BusyReserved    int                 `json:"busy_reserved"`
+	BusyGeneral     int                 `json:"busy_general"`
+	VirtualClock    float64             `json:"virtual_clock"`
+	Tenants         []TenantShare       `json:"tenants"`
+	Recent          []SchedulerDecision `json:"recent"` // la más reciente primero
+
+	GPUMinutesInFlight float64 `json:"gpu_minutes_in_flight"`
+	GPUMinutesBudget   float64 `json:"gpu_minutes_budget"` // 0 = sin tope
+}
+
+type TenantShare struct {
+	Tenant      string  `json:"tenant"`
+	Weight      float64 `json:"weight"`
+	Waiting     int     `json:"waiting"`
+	Running     int     `json:"running"`
+	Dispatched  uint64  `json:"dispatched"`
+	VirtualTime float64 `json:"virtual_time"`
+}
+
+// SchedulerDecision es la asignación de un worker a un job
+type SchedulerDecision struct {
+	JobID             string    `json:"job_id"`
+	Tenant            string    `json:"tenant"`
+	Lane              string    `json:"lane"`
+	Worker            string    `json:"worker"`
+	Priority          int       `json:"priority"`
+	EffectivePriority int       `json:"effective_priority"`
+	GPUMinutes        float64   `json:"gpu_minutes"`
+	VirtualStart      float64   `json:"virtual_start"`
+	WaitedMS          int64     `json:"waited_ms"`
+	At                time.Time `json:"at"`
+}
+
+// MaintenanceRequest activa o desactiva el modo mantenimiento. RetryAfter
+// con formato de duración ("10m"); vacío usa el valor por defecto.
+type MaintenanceRequest struct {
+	Enabled    bool   `json:"enabled"`
+	Message    string `json:"message,omitempty"`
+	RetryAfter string `json:"retry_after,omitempty"`
+}
+
+// MaintenanceState es el modo mantenimiento efectivo
+type MaintenanceState struct {
+	Enabled    bool       `json:"enabled"`
+	Message    string     `json:"message,omitempty"`
+	RetryAfter string     `json:"retry_after"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+// ConfigReload es el resultado de una recarga de la configuración, con las
+// claves de CONFIG_FILE
+type ConfigReload struct {
+	Applied         []string  `json:"applied"`
+	RestartRequired []string  `json:"restart_required"`
+	ReloadedAt      time.Time `json:"reloaded_at"`
+}
+
+// RoutingInput son los datos de un job que miran las reglas de
+// backend_routing. Duration en 0 es una duración sin sondear.
+type RoutingInput struct {
+	Tenant   string  `json:"tenant,omitempty"`
+	Language string  `json:"language,omitempty"`
+	Model    string  `json:"model,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+	Accuracy string  `json:"accuracy,omitempty"`
+	Diarize  bool    `json:"diarize,omitempty"`
+}
+
+// RoutingExplanation es la regla que elegiría los backends de un job y, de
+// cada regla mirada, si se cumple o por qué no. Rule vacío es todo el pool.
+type RoutingExplanation struct {
+	Input          RoutingInput     `json:"input"`
+	Rule           string           `json:"rule,omitempty"`
+	Backends       []string         `json:"backends"`
+	Model          string           `json:"model,omitempty"`
+	CustomModel    string           `json:"custom_model,omitempty"`
+	Backend        string           `json:"backend,omitempty"`
+	Evaluations    []RuleEvaluation `json:"evaluations"`
+	JobBackend     string           `json:"job_backend,omitempty"`
+	JobRoutingRule string           `json:"job_routing_rule,omitempty"`
+}
+
+type RuleEvaluation struct {
+	Rule    string `json:"rule"`
+	Matched bool   `json:"matched"`
+	Reason  string `json:"reason"`
+}
+
+// AdminJob es un job en la vista de operación, con su concesión
+type AdminJob struct {
+	JobID          string     `json:"job_id"`
+	Type           string     `json:"type"`
+	Status         string     `json:"status"`
+	APIKey         string     `json:"api_key,omitempty"`
+	Tenant         string     `json:"tenant,omitempty"`
+	Backend        string     `json:"backend,omitempty"`
+	ClaimedBy      string     `json:"claimed_by,omitempty"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+	LeaseExpired   bool       `json:"lease_expired,omitempty"`
+	Timestamp      time.Time  `json:"timestamp"`
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Máximo de clips por petición
+const maxClipsPerRequest = 50
+
+// Rango de tiempo en segundos
+type TimeRange struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// Selección de fragmentos a recortar: IDs de segmento y/o rangos libres
+type ClipsRequestBody struct {
+	Segments       []int       `json:"segments"`
+	Ranges         []TimeRange `json:"ranges"`
+	PaddingSeconds float64     `json:"padding_seconds"` // margen añadido a cada lado
+}
+
+// Clip generado
+type ClipResult struct {
+	Artifact
+	Start     float64 `json:"start"`
+	End       float64 `json:"end"`
+	SegmentID *int    `json:"segment_id,omitempty"`
+}
+
+type clipSpec struct {
+	name      string
+	start     float64
+	end       float64
+	segmentID *int
+}
+
+func clipsHandler(c *gin.Context) {
+	jobID := c.Param("job_id")
+
+	var input ClipsRequestBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, exists := getJob(jobID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if job.Type != JobTypeTranscription || job.Status != "completed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "clips require a completed transcription job"})
+		return
+	}
+
+	specs, err := clipSpecs(job, input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	source, err := clipSource(jobID)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	defer applyMediaRetention(jobID)
+
+	results := make([]ClipResult, 0, len(specs))
+	for _, spec := range specs {
+		name := spec.name + filepath.Ext(source)
+		outPath := filepath.Join(filepath.Dir(source), name)
+		if err := cutClip(source, outPath, spec.start, spec.end); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "RENDER_FAILED"})
+			return
+		}
+		artifact, err := storeArtifact(jobID, name, outPath, clipContentType(name))
+		os.Remove(outPath)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "code": "STORAGE_FAILED"})
+			return
+		}
+		addArtifact(jobID, artifact)
+		results = append(results, ClipResult{Artifact: artifact, Start: spec.start, End: spec.end, SegmentID: spec.segmentID})
+	}
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusCreated, gin.H{"clips": results})
+}
+
+// Traduce la selección a rangos concretos, validando contra la duración
+func clipSpecs(job JobState, input ClipsRequestBody) ([]clipSpec, error) {
+	if len(input.Segments)+len(input.Ranges) == 0 {
+		return nil, errors.New("segments or ranges are required")
+	}
+	if len(input.Segments)+len(input.Ranges) > maxClipsPerRequest {
+		return nil, errors.Errorf("at most %d clips per request", maxClipsPerRequest)
+	}
+	if input.PaddingSeconds < 0 {
+		return nil, errors.New("padding_seconds cannot be negative")
+	}
+
+	var specs []clipSpec
+	for _, id := range input.Segments {
+		seg, ok := findSegment(job.Segments, id)
+		if !ok {
+			return nil, errors.Errorf("segment %d not found", id)
+		}
+		segID := id
+		specs = append(specs, clipSpec{start: seg.Start, end: seg.End, segmentID: &segID,
+			name: fmt.Sprintf("clip-seg-%d", id)})
+	}
+	for i, r := range input.Ranges {
+		if r.Start < 0 || r.End <= r.Start {
+			return nil, errors.Errorf("range %d must satisfy 0 <= start < end", i)
+		}
+		specs = append(specs, clipSpec{start: r.Start, end: r.End,
+			name: fmt.Sprintf("clip-%s-%s", formatClipTime(r.Start), formatClipTime(r.End))})
+	}
+
+	for i := range specs {
+		specs[i].start -= input.PaddingSeconds
+		if specs[i].start < 0 {
+			specs[i].start = 0
+		}
+		specs[i].end += input.PaddingSeconds
+		if job.Duration > 0 && specs[i].end > job.Duration {
+			specs[i].end = job.Duration
+		}
+	}
+	return specs, nil
+}
+
+func findSegment(segments []Segment, id int) (Segment, bool) {
+	for _, seg := range segments {
+		if seg.ID == id {
+			return seg, true
+		}
+	}
+	return Segment{}, false
+}
+
+func formatClipTime(seconds float64) string {
+	return strings.ReplaceAll(strconv.FormatFloat(seconds, 'f', 3, 64), ".", "_")
+}
+
+// Ruta local del audio original, descargándolo si el gateway no lo tenía
+func clipSource(jobID string) (string, error) {
+	meta, _ := getJobMeta(jobID)
+	if meta.MediaPath != "" {
+		if _, err := os.Stat(meta.MediaPath); err == nil {
+			return meta.MediaPath, nil
+		}
+	}
+
+	u, err := url.Parse(meta.Input.URL)
+	if err != nil || isBackendFetchHost(u) {
+		return "", errors.New("source media is not available to the gateway")
+	}
+	media, err := downloadMedia(jobID, meta.Tenant, meta.Input.URL)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to download source media")
+	}
+	mu.Lock()
+	jobMetas[jobID].MediaPath = media.Path
+	unlockJobs()
+	return media.Path, nil
+}
+
+// Recorta [start, end) del medio; ffmpeg deduce el formato por la extensión
+func cutClip(source, outPath string, start, end float64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.RenderTimeout.Duration)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, cfg.FFmpegPath,
+		"-y", "-v", "error",
+		"-ss", strconv.FormatFloat(start, 'f', 3, 64),
+		"-i", source,
+		"-t", strconv.FormatFloat(end-start, 'f', 3, 64),
+		"-vn",
+		outPath,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "ffmpeg failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func clipContentType(name string) string {
+	switch filepath.Ext(name) {
+	case ".wav":
+		return "audio/wav"
+	case ".m4a":
+		return "audio/mp4"
+	case ".ogg":
+		return "audio/ogg"
+	case ".flac":
+		return "audio/flac"
+	default:
+		return "audio/mpeg"
+	}
+}
+
+// Añade o reemplaza (por nombre) un artefacto del job
+func addArtifact(jobID string, artifact Artifact) {
+	updateJob(jobID, func(job *JobState) {
+		for i, a := range job.Artifacts {
+			if a.Name == artifact.Name {
+				job.Artifacts[i] = artifact
+				return
+			}
+		}
+		job.Artifacts = append(job.Artifacts, artifact)
+	})
+}
@@ -0,0 +1,268 @@
+// Prueba de carga contra una instancia en marcha: workers que crean jobs
+// sintéticos y esperan a que terminen, con percentiles de las latencias de
+// creación (POST /process) y de compleción (hasta el estado final).
+//
+//	go run ./cmd/loadtest -url http://localhost:8080 -concurrency 20 -duration 1m
+//
+// Con -mock arranca además el backend simulado, al que debe apuntar
+// WHISPER_URL del gateway:
+//
+//	go run ./cmd/loadtest -mock :8000 -mock-mode slow -mock-delay 2s
+//
+// Sin -media sirve un WAV de silencio y añade ?n= a cada URL para que la
+// caché de resultados no responda por el backend.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ai/youtube_transcriber/client"
+	"github.com/ai/youtube_transcriber/internal/mockwhisper"
+	"github.com/pkg/errors"
+)
+
+// Resumen final; con -json se imprime tal cual
+type Report struct {
+	Duration   float64        `json:"duration_seconds"`
+	Submitted  int            `json:"submitted"`
+	Rejected   map[string]int `json:"rejected,omitempty"` // por código de error
+	Completed  int            `json:"completed"`
+	Failed     int            `json:"failed"`
+	Unfinished int            `json:"unfinished"` // sin estado final al acabar el tiempo
+	Throughput float64        `json:"throughput"` // jobs terminados por segundo
+	Submit     Percentiles    `json:"submit"`
+	Completion Percentiles    `json:"completion"`
+}
+
+// En milisegundos
+type Percentiles struct {
+	P50 float64 `json:"p50_ms"`
+	P95 float64 `json:"p95_ms"`
+	P99 float64 `json:"p99_ms"`
+	Max float64 `json:"max_ms"`
+}
+
+type results struct {
+	mu         sync.Mutex
+	submit     []time.Duration
+	completion []time.Duration
+	rejected   map[string]int
+	completed  int
+	failed     int
+	unfinished int
+}
+
+func (r *results) reject(err error) {
+	code := "ERROR"
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		code = fmt.Sprintf("%d", apiErr.StatusCode)
+		if apiErr.Code != "" {
+			code += " " + apiErr.Code
+		}
+	}
+	r.mu.Lock()
+	r.rejected[code]++
+	r.mu.Unlock()
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "URL base del gateway")
+	apiKey := flag.String("api-key", os.Getenv("API_KEY"), "API key (editor o admin); por defecto $API_KEY")
+	concurrency := flag.Int("concurrency", 10, "workers creando y esperando jobs a la vez")
+	duration := flag.Duration("duration", 30*time.Second, "tiempo creando jobs; después se esperan los pendientes")
+	drain := flag.Duration("drain", time.Minute, "espera máxima de los jobs pendientes al acabar -duration")
+	poll := flag.Duration("poll", 200*time.Millisecond, "intervalo de consulta de cada job; acota la precisión de la compleción")
+	media := flag.String("media", "", "URL del medio de los jobs; vacío = WAV de silencio servido por este comando")
+	mediaAddr := flag.String("media-addr", "127.0.0.1:0", "dirección del WAV servido, alcanzable desde el gateway")
+	model := flag.String("model", "", "modelo de los jobs")
+	mock := flag.String("mock", "", "arranca el backend simulado en esta dirección (p. ej. :8000)")
+	mockMode := flag.String("mock-mode", string(mockwhisper.ModeOK), "modo del backend simulado: ok, slow, error, oom...")
+	mockDelay := flag.Duration("mock-delay", time.Second, "demora del modo slow del backend simulado")
+	asJSON := flag.Bool("json", false, "imprime el resumen en JSON")
+	flag.Parse()
+
+	if *mock != "" {
+		backend := mockwhisper.New(mockwhisper.WithMode(mockwhisper.Mode(*mockMode)), mockwhisper.WithDelay(*mockDelay))
+		go func() { log.Fatal(http.ListenAndServe(*mock, backend)) }()
+		log.Printf("🚀 Backend whisper simulado en %s (modo %s)", *mock, *mockMode)
+	}
+	if *media == "" {
+		*media = serveSilence(*mediaAddr)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	api := client.New(*baseURL, client.WithAPIKey(*apiKey), client.WithRetries(0, 0))
+	res := &results{rejected: make(map[string]int)}
+
+	log.Printf("🚀 %d workers durante %s contra %s", *concurrency, *duration, *baseURL)
+	start := time.Now()
+	submitUntil := start.Add(*duration)
+	waitCtx, cancel := context.WithDeadline(ctx, submitUntil.Add(*drain))
+	defer cancel()
+	var seq int64
+	var wg sync.WaitGroup
+	for w := 0; w < *concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(submitUntil) && ctx.Err() == nil {
+				runOne(waitCtx, api, res, jobURL(*media, atomic.AddInt64(&seq, 1)), *model, *poll)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	report := res.report(elapsed)
+	if *asJSON {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+	printReport(report)
+}
+
+// Un job: creación y espera hasta el estado final
+func runOne(ctx context.Context, api *client.Client, res *results, mediaURL, model string, poll time.Duration) {
+	started := time.Now()
+	created, err := api.Process(ctx, client.ProcessRequest{URL: mediaURL, Model: model})
+	submitted := time.Since(started)
+	if err != nil {
+		if ctx.Err() == nil {
+			res.reject(err)
+			// Sin esperar, un 429 sostenido sería un bucle cerrado contra el gateway
+			time.Sleep(poll)
+		}
+		return
+	}
+	res.mu.Lock()
+	res.submit = append(res.submit, submitted)
+	res.mu.Unlock()
+
+	job, err := api.Wait(ctx, created.JobID, poll)
+	res.mu.Lock()
+	defer res.mu.Unlock()
+	switch {
+	case err != nil || job == nil || !job.Done():
+		res.unfinished++
+	case job.Status == "completed":
+		res.completed++
+		res.completion = append(res.completion, time.Since(started))
+	default:
+		res.failed++
+		res.completion = append(res.completion, time.Since(started))
+	}
+}
+
+func jobURL(media string, n int64) string {
+	sep := "?"
+	if strings.Contains(media, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%sn=%d", media, sep, n)
+}
+
+// Sirve un segundo de silencio (WAV PCM de 16 kHz, mono) y devuelve su URL
+func serveSilence(addr string) string {
+	const rate, seconds = 16000, 1
+	data := make([]byte, rate*2*seconds)
+	var wav bytes.Buffer
+	wav.WriteString("RIFF")
+	_ = binary.Write(&wav, binary.LittleEndian, uint32(36+len(data)))
+	wav.WriteString("WAVEfmt ")
+	for _, field := range []interface{}{uint32(16), uint16(1), uint16(1), uint32(rate), uint32(rate * 2), uint16(2), uint16(16)} {
+		_ = binary.Write(&wav, binary.LittleEndian, field)
+	}
+	wav.WriteString("data")
+	_ = binary.Write(&wav, binary.LittleEndian, uint32(len(data)))
+	wav.Write(data)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("❌ No se pudo servir el medio en %s: %v", addr, err)
+	}
+	body := wav.Bytes()
+	go func() {
+		log.Fatal(http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "audio/wav")
+			http.ServeContent(w, r, "silence.wav", time.Time{}, bytes.NewReader(body))
+		})))
+	}()
+	return "http://" + listener.Addr().String() + "/silence.wav"
+}
+
+func (r *results) report(elapsed time.Duration) Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := Report{
+		Duration:   elapsed.Seconds(),
+		Submitted:  len(r.submit),
+		Completed:  r.completed,
+		Failed:     r.failed,
+		Unfinished: r.unfinished,
+		Submit:     percentiles(r.submit),
+		Completion: percentiles(r.completion),
+	}
+	if len(r.rejected) > 0 {
+		report.Rejected = r.rejected
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(r.completed+r.failed) / elapsed.Seconds()
+	}
+	return report
+}
+
+// Percentiles por rango más cercano
+func percentiles(samples []time.Duration) Percentiles {
+	if len(samples) == 0 {
+		return Percentiles{}
+	}
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	at := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return float64(sorted[i].Microseconds()) / 1000
+	}
+	return Percentiles{P50: at(0.50), P95: at(0.95), P99: at(0.99), Max: float64(sorted[len(sorted)-1].Microseconds()) / 1000}
+}
+
+func printReport(r Report) {
+	fmt.Printf("duración      %.1fs\n", r.Duration)
+	fmt.Printf("creados       %d\n", r.Submitted)
+	for code, n := range r.Rejected {
+		fmt.Printf("rechazados    %d (%s)\n", n, code)
+	}
+	fmt.Printf("completados   %d\n", r.Completed)
+	fmt.Printf("fallidos      %d\n", r.Failed)
+	fmt.Printf("sin terminar  %d\n", r.Unfinished)
+	fmt.Printf("rendimiento   %.2f jobs/s\n", r.Throughput)
+	fmt.Printf("\n%-12s %10s %10s %10s %10s\n", "latencia", "p50", "p95", "p99", "max")
+	for _, row := range []struct {
+		name string
+		p    Percentiles
+	}{{"creación", r.Submit}, {"compleción", r.Completion}} {
+		fmt.Printf("%-12s %8.1fms %8.1fms %8.1fms %8.1fms\n", row.name, row.p.P50, row.p.P95, row.p.P99, row.p.Max)
+	}
+}
@@ -0,0 +1,38 @@
+// Backend whisper simulado para levantar el gateway sin GPU:
+//
+//	go run ./cmd/mockwhisper -addr :8000 -mode slow -delay 3s
+//
+// Cada petición puede forzar su modo con ?mock=<modo> en la URL del medio.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ai/youtube_transcriber/internal/mockwhisper"
+)
+
+func main() {
+	addr := flag.String("addr", ":8000", "dirección de escucha")
+	mode := flag.String("mode", string(mockwhisper.ModeOK), "modo por defecto: ok, slow, error, oom, bad_input, malformed, stream, segments, hang")
+	script := flag.String("script", "", "modos para las primeras peticiones, separados por comas")
+	delay := flag.Duration("delay", 0, "demora de los modos slow, stream y segments")
+	flag.Parse()
+
+	opts := []mockwhisper.Option{mockwhisper.WithMode(mockwhisper.Mode(*mode))}
+	if *delay > 0 {
+		opts = append(opts, mockwhisper.WithDelay(*delay))
+	}
+	if *script != "" {
+		var modes []mockwhisper.Mode
+		for _, m := range strings.Split(*script, ",") {
+			modes = append(modes, mockwhisper.Mode(strings.TrimSpace(m)))
+		}
+		opts = append(opts, mockwhisper.WithScript(modes...))
+	}
+
+	log.Printf("🚀 Backend whisper simulado en %s (modo %s)", *addr, *mode)
+	log.Fatal(http.ListenAndServe(*addr, mockwhisper.New(opts...)))
+}
@@ -0,0 +1,1040 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Duración configurable como texto ("30s", "5m") tanto en JSON como en env
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return errors.Wrap(err, "duration must be a string like \"30s\"")
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return errors.Wrapf(err, "invalid duration %q", raw)
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// Configuración del servicio. Se parte de los valores por defecto, luego se
+// aplica el archivo JSON indicado en CONFIG_FILE y por último las variables
+// de entorno declaradas en el tag `env`.
+type Config struct {
+	Port       string `json:"port" env:"PORT"`
+	WhisperURL string `json:"whisper_url" env:"WHISPER_URL"`
+
+	// Modo de gin (debug, release, test) y log de accesos en JSON
+	GinMode             string  `json:"gin_mode" env:"GIN_MODE"`
+	AccessLog           bool    `json:"access_log" env:"ACCESS_LOG"`
+	AccessLogSampleRate float64 `json:"access_log_sample_rate" env:"ACCESS_LOG_SAMPLE_RATE"` // fracción registrada; los 5xx siempre
+
+	// GET /metrics con las peticiones por ruta, tenant y huella SHA-256 de la
+	// API key, solo para keys admin
+	Metrics bool `json:"metrics" env:"METRICS"`
+
+	// Idioma por defecto de los mensajes de error (en, es, yo) cuando
+	// Accept-Language no pide uno soportado
+	ErrorLanguage string `json:"error_language" env:"ERROR_LANGUAGE"`
+
+	// Reporte de pánicos a Sentry (deshabilitado si SentryDSN está vacío)
+	SentryDSN         string `json:"sentry_dsn" env:"SENTRY_DSN"`
+	SentryEnvironment string `json:"sentry_environment" env:"SENTRY_ENVIRONMENT"`
+
+	// Muestreo de fallos de jobs enviados al tracker; por categoría (backend,
+	// timeout, media, render, internal) solo desde CONFIG_FILE
+	ErrorSampleRate  float64            `json:"error_sample_rate" env:"ERROR_SAMPLE_RATE"`
+	ErrorSampleRates map[string]float64 `json:"error_sample_rates"`
+
+	// Entrega de webhooks: plazo por intento, intentos, espera inicial entre
+	// ellos (se duplica) y vigencia del secreto anterior tras una rotación
+	WebhookTimeout      Duration `json:"webhook_timeout" env:"WEBHOOK_TIMEOUT"`
+	WebhookMaxAttempts  int      `json:"webhook_max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+	WebhookRetryBackoff Duration `json:"webhook_retry_backoff" env:"WEBHOOK_RETRY_BACKOFF"`
+	WebhookSecretGrace  Duration `json:"webhook_secret_grace" env:"WEBHOOK_SECRET_GRACE"`
+
+	// Exportación a Google Docs y Notion (/integrations): APIs, cliente OAuth
+	// para renovar los tokens de Google y plazo por intento. Los reintentos
+	// siguen WEBHOOK_MAX_ATTEMPTS y WEBHOOK_RETRY_BACKOFF.
+	GoogleAPIURL       string   `json:"google_api_url" env:"GOOGLE_API_URL"`
+	GoogleTokenURL     string   `json:"google_token_url" env:"GOOGLE_TOKEN_URL"`
+	GoogleClientID     string   `json:"google_client_id" env:"GOOGLE_CLIENT_ID"`
+	GoogleClientSecret string   `json:"google_client_secret" env:"GOOGLE_CLIENT_SECRET"`
+	NotionAPIURL       string   `json:"notion_api_url" env:"NOTION_API_URL"`
+	IntegrationTimeout Duration `json:"integration_timeout" env:"INTEGRATION_TIMEOUT"`
+
+	// Carpetas vigiladas (/integrations con google_drive o dropbox): APIs de
+	// Dropbox, app para renovar sus tokens y cada cuánto se sondean
+	DropboxAPIURL         string   `json:"dropbox_api_url" env:"DROPBOX_API_URL"`
+	DropboxContentURL     string   `json:"dropbox_content_url" env:"DROPBOX_CONTENT_URL"`
+	DropboxTokenURL       string   `json:"dropbox_token_url" env:"DROPBOX_TOKEN_URL"`
+	DropboxAppKey         string   `json:"dropbox_app_key" env:"DROPBOX_APP_KEY"`
+	DropboxAppSecret      string   `json:"dropbox_app_secret" env:"DROPBOX_APP_SECRET"`
+	ConnectorPollInterval Duration `json:"connector_poll_interval" env:"CONNECTOR_POLL_INTERVAL"`
+
+	// API de Twilio para las grabaciones de /integrations/twilio
+	TwilioAPIURL string `json:"twilio_api_url" env:"TWILIO_API_URL"`
+
+	// Grabaciones de Zoom (/integrations/zoom): app OAuth para renovar los
+	// tokens y hosts (con sus subdominios) a los que se envían al descargar
+	ZoomTokenURL      string   `json:"zoom_token_url" env:"ZOOM_TOKEN_URL"`
+	ZoomClientID      string   `json:"zoom_client_id" env:"ZOOM_CLIENT_ID"`
+	ZoomClientSecret  string   `json:"zoom_client_secret" env:"ZOOM_CLIENT_SECRET"`
+	ZoomDownloadHosts []string `json:"zoom_download_hosts" env:"ZOOM_DOWNLOAD_HOSTS"`
+
+	// Audios por correo (/integrations/email): servidor SMTP (host:puerto,
+	// con STARTTLS si lo anuncia) con el que se responde y remitente de las
+	// respuestas; vacío = la dirección de la integración
+	SMTPAddr     string `json:"smtp_addr" env:"SMTP_ADDR"`
+	SMTPUsername string `json:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `json:"smtp_password" env:"SMTP_PASSWORD"`
+	SMTPFrom     string `json:"smtp_from" env:"SMTP_FROM"`
+
+	// Bots (/integrations/telegram, /integrations/whatsapp y
+	// /integrations/discord): Bot API de Telegram y APIs de WhatsApp (Graph) y
+	// Discord, con su versión
+	TelegramAPIURL string `json:"telegram_api_url" env:"TELEGRAM_API_URL"`
+	WhatsAppAPIURL string `json:"whatsapp_api_url" env:"WHATSAPP_API_URL"`
+	DiscordAPIURL  string `json:"discord_api_url" env:"DISCORD_API_URL"`
+
+	// Destinos gcs: XML API de Cloud Storage, compatible con S3
+	GCSEndpoint string `json:"gcs_endpoint" env:"GCS_ENDPOINT"`
+
+	// Publicación de eventos del ciclo de vida: "" (deshabilitada), nats o kafka
+	EventBus           string   `json:"event_bus" env:"EVENT_BUS"`
+	NATSURL            string   `json:"nats_url" env:"NATS_URL"`
+	KafkaBrokers       []string `json:"kafka_brokers" env:"KAFKA_BROKERS"`
+	EventSubjectPrefix string   `json:"event_subject_prefix" env:"EVENT_SUBJECT_PREFIX"` // subject/topic = prefijo.estado
+	EventBusTimeout    Duration `json:"event_bus_timeout" env:"EVENT_BUS_TIMEOUT"`
+
+	// Papel del proceso: all (API y ejecución), api (solo encola y lee) o
+	// worker (reclama jobs del almacén compartido). --role tiene prioridad.
+	// La concesión de un job se renueva cada ClaimLeaseTTL/3.
+	Role              string   `json:"role" env:"ROLE"`
+	WorkerID          string   `json:"worker_id" env:"WORKER_ID"` // por defecto host/uuid
+	ClaimPollInterval Duration `json:"claim_poll_interval" env:"CLAIM_POLL_INTERVAL"`
+	ClaimLeaseTTL     Duration `json:"claim_lease_ttl" env:"CLAIM_LEASE_TTL"`
+
+	// Cada cuánto relee cada proceso los ajustes de operación compartidos
+	// en el almacén (pausa de la cola, mantenimiento)
+	SettingsPollInterval Duration `json:"settings_poll_interval" env:"SETTINGS_POLL_INTERVAL"`
+
+	// Modo mantenimiento forzado: las escrituras responden 503 con el
+	// mensaje y Retry-After; también se activa con PUT /admin/maintenance
+	Maintenance           bool     `json:"maintenance" env:"MAINTENANCE"`
+	MaintenanceMessage    string   `json:"maintenance_message" env:"MAINTENANCE_MESSAGE"`
+	MaintenanceRetryAfter Duration `json:"maintenance_retry_after" env:"MAINTENANCE_RETRY_AFTER"`
+
+	// Elección de líder entre réplicas sobre un almacén compartido: ""
+	// (réplica única, siempre líder), redis (usa REDIS_URL) o postgres (usa
+	// DATABASE_URL). Solo el líder ejecuta los subsistemas en segundo plano.
+	LeaderElection string   `json:"leader_election" env:"LEADER_ELECTION"`
+	LeaderLockKey  string   `json:"leader_lock_key" env:"LEADER_LOCK_KEY"`
+	LeaderLeaseTTL Duration `json:"leader_lease_ttl" env:"LEADER_LEASE_TTL"` // se renueva cada TTL/3
+
+	// Outbox de webhooks y eventos del bus: cada cuánto se revisan los
+	// mensajes pendientes, entregas en paralelo y espera máxima entre intentos
+	OutboxPollInterval Duration `json:"outbox_poll_interval" env:"OUTBOX_POLL_INTERVAL"`
+	OutboxWorkers      int      `json:"outbox_workers" env:"OUTBOX_WORKERS"`
+	OutboxMaxBackoff   Duration `json:"outbox_max_backoff" env:"OUTBOX_MAX_BACKOFF"`
+
+	// Plazo por defecto de las peticiones y plazos por ruta ("GET /jobs": "5s",
+	// "0s" = sin plazo); las rutas solo se configuran desde CONFIG_FILE. Es
+	// el deadline del contexto (ver deadlineMiddleware), no un corte de la
+	// respuesta
+	RequestTimeout Duration            `json:"request_timeout" env:"REQUEST_TIMEOUT"`
+	RouteTimeouts  map[string]Duration `json:"route_timeouts"`
+
+	// Varios backends whisper; si está vacío se usa solo WhisperURL. Con
+	// grpc://host:puerto (grpcs:// con TLS) se usa el contrato gRPC de
+	// python_service/proto en lugar de HTTP, y con celery+redis://host/db?queue=q
+	// la cola de los workers Celery.
+	WhisperBackends      []string `json:"whisper_backends" env:"WHISPER_BACKENDS"`
+	CapacityPollInterval Duration `json:"capacity_poll_interval" env:"CAPACITY_POLL_INTERVAL"`
+
+	// Peticiones simultáneas por backend (límite de memoria GPU), aparte de
+	// WORKERS; por URL solo desde CONFIG_FILE. 0 = sin tope.
+	DefaultBackendConcurrency int            `json:"default_backend_concurrency" env:"DEFAULT_BACKEND_CONCURRENCY"`
+	BackendMaxConcurrency     map[string]int `json:"backend_max_concurrency"`
+
+	// Reintento único en otro backend (o con un modelo menor) ante fallos del backend
+	BackendFallback bool   `json:"backend_fallback" env:"BACKEND_FALLBACK"`
+	FallbackModel   string `json:"fallback_model" env:"FALLBACK_MODEL"` // si el job no pidió modelo
+
+	// Descarga de medios en el gateway en lugar del backend Python
+	GatewayDownload  bool     `json:"gateway_download" env:"GATEWAY_DOWNLOAD"`
+	DownloadDir      string   `json:"download_dir" env:"DOWNLOAD_DIR"`
+	BackendMediaDir  string   `json:"backend_media_dir" env:"BACKEND_MEDIA_DIR"` // ruta del mismo volumen vista desde el backend
+	DownloadTimeout  Duration `json:"download_timeout" env:"DOWNLOAD_TIMEOUT"`
+	DownloadRetries  int      `json:"download_retries" env:"DOWNLOAD_RETRIES"`
+	MaxDownloadMB    int64    `json:"max_download_mb" env:"MAX_DOWNLOAD_MB"`
+	BackendFetchHost []string `json:"backend_fetch_hosts" env:"BACKEND_FETCH_HOSTS"` // hosts que siempre descarga el backend (yt-dlp)
+
+	// Autenticación y límites por API key (las keys estáticas solo desde
+	// CONFIG_FILE; el resto se gestiona con /keys)
+	APIKeys                  []APIKey `json:"api_keys"`
+	DefaultMaxConcurrentJobs int      `json:"default_max_concurrent_jobs" env:"DEFAULT_MAX_CONCURRENT_JOBS"`
+	ConcurrencyLimitMode     string   `json:"concurrency_limit_mode" env:"CONCURRENCY_LIMIT_MODE"` // queue o reject
+	APIKeyRotationGrace      Duration `json:"api_key_rotation_grace" env:"API_KEY_ROTATION_GRACE"` // validez del secreto anterior
+
+	// Peticiones firmadas con HMAC: desfase admitido entre su timestamp y
+	// el reloj del gateway. Dentro de él una firma no se puede repetir.
+	RequestSignatureTolerance Duration `json:"request_signature_tolerance" env:"REQUEST_SIGNATURE_TOLERANCE"`
+
+	// Proxies (CIDR o IP) cuyo X-Forwarded-For se cree para la IP del
+	// cliente, p. ej. en allowed_cidrs. Vacío: cuenta la IP de la conexión.
+	TrustedProxies []string `json:"trusted_proxies" env:"TRUSTED_PROXIES"`
+
+	// Inicio de sesión de personas con OIDC (Google, Keycloak...), deshabilitado
+	// si OIDCIssuer está vacío. El ID token se canjea por una sesión firmada
+	// con SessionSecret; los grupos se asignan a roles solo desde CONFIG_FILE.
+	OIDCIssuer       string            `json:"oidc_issuer" env:"OIDC_ISSUER"`
+	OIDCClientID     string            `json:"oidc_client_id" env:"OIDC_CLIENT_ID"`
+	OIDCClientSecret string            `json:"oidc_client_secret" env:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL  string            `json:"oidc_redirect_url" env:"OIDC_REDIRECT_URL"` // por defecto PUBLIC_BASE_URL/auth/callback
+	OIDCScopes       []string          `json:"oidc_scopes" env:"OIDC_SCOPES"`
+	OIDCGroupsClaim  string            `json:"oidc_groups_claim" env:"OIDC_GROUPS_CLAIM"`
+	OIDCGroupRoles   map[string]string `json:"oidc_group_roles"`                          // grupo → viewer, editor o admin
+	OIDCDefaultRole  string            `json:"oidc_default_role" env:"OIDC_DEFAULT_ROLE"` // sin grupo asignado; vacío = sin acceso
+	OIDCTenant       string            `json:"oidc_tenant" env:"OIDC_TENANT"`             // tenant de todas las sesiones
+	SessionSecret    string            `json:"session_secret" env:"SESSION_SECRET"`
+	SessionTTL       Duration          `json:"session_ttl" env:"SESSION_TTL"`
+
+	// Cifrado en reposo de transcripciones y traducciones (estado, outbox y
+	// caché) con claves de datos por tenant, envueltas con la clave maestra
+	// o con el motor transit de un Vault. Deshabilitado si ambos están vacíos.
+	EncryptionMasterKey string `json:"encryption_master_key" env:"ENCRYPTION_MASTER_KEY"` // 32 bytes en base64
+	EncryptionKMSURL    string `json:"encryption_kms_url" env:"ENCRYPTION_KMS_URL"`       // p. ej. https://vault:8200/v1/transit
+	EncryptionKMSKey    string `json:"encryption_kms_key" env:"ENCRYPTION_KMS_KEY"`
+	EncryptionKMSToken  string `json:"encryption_kms_token" env:"ENCRYPTION_KMS_TOKEN"`
+
+	// Workers y lane reservado para audio corto
+	Workers               int      `json:"workers" env:"WORKERS"`
+	ShortLaneFraction     float64  `json:"short_lane_fraction" env:"SHORT_LANE_FRACTION"`
+	ShortAudioMaxDuration Duration `json:"short_audio_max_duration" env:"SHORT_AUDIO_MAX_DURATION"`
+	FFprobePath           string   `json:"ffprobe_path" env:"FFPROBE_PATH"`
+	SupportedFormats      []string `json:"supported_formats" env:"SUPPORTED_FORMATS"` // el resto se convierte a WAV
+	ProbeTimeout          Duration `json:"probe_timeout" env:"PROBE_TIMEOUT"`
+	PreprocessWorkers     int      `json:"preprocess_workers" env:"PREPROCESS_WORKERS"` // jobs descargando o convirtiendo a la vez
+
+	// Cada intervalo en espera sube un punto la prioridad de un job; 0 la
+	// deja fija
+	PriorityAgingInterval Duration `json:"priority_aging_interval" env:"PRIORITY_AGING_INTERVAL"`
+
+	// Peso de cada tenant en el reparto de workers, solo desde CONFIG_FILE;
+	// el que no figura pesa 1
+	TenantWeights map[string]float64 `json:"tenant_weights"`
+
+	// Flags de las funciones experimentales (ver features.go) y excepciones
+	// por tenant, solo desde CONFIG_FILE
+	FeatureFlags       map[string]bool            `json:"feature_flags"`
+	TenantFeatureFlags map[string]map[string]bool `json:"tenant_feature_flags"`
+
+	// Tope de minutos de GPU estimados (duración por realtime_factors) de
+	// los jobs en curso, aparte de WORKERS; 0 = sin tope. Sin duración
+	// sondeada un job cuenta como UNKNOWN_DURATION_ESTIMATE.
+	GPUMinutesBudget        float64  `json:"gpu_minutes_budget" env:"GPU_MINUTES_BUDGET"`
+	UnknownDurationEstimate Duration `json:"unknown_duration_estimate" env:"UNKNOWN_DURATION_ESTIMATE"`
+
+	// Comprobación de voz y análisis del audio antes de enviar el medio al
+	// backend; comparten la pasada de ffmpeg y VAD_TIMEOUT
+	VADCheck          string   `json:"vad_check" env:"VAD_CHECK"`           // vacío (desactivada), warn o fail
+	AudioAnalysis     bool     `json:"audio_analysis" env:"AUDIO_ANALYSIS"` // música de fondo, SNR y saturación
+	VADMinSpeechRatio float64  `json:"vad_min_speech_ratio" env:"VAD_MIN_SPEECH_RATIO"`
+	VADNoiseDB        float64  `json:"vad_noise_db" env:"VAD_NOISE_DB"` // por debajo cuenta como silencio
+	VADMinSilence     Duration `json:"vad_min_silence" env:"VAD_MIN_SILENCE"`
+	VADTimeout        Duration `json:"vad_timeout" env:"VAD_TIMEOUT"`
+
+	// Modelos de las dos pasadas de accuracy high; la segunda solo si la
+	// petición no indica modelo
+	TwoPassFirstModel  string `json:"two_pass_first_model" env:"TWO_PASS_FIRST_MODEL"`
+	TwoPassSecondModel string `json:"two_pass_second_model" env:"TWO_PASS_SECOND_MODEL"`
+
+	// Detección de idioma de only_if_language: modelo rápido sobre los
+	// primeros LanguageDetectSample del audio
+	LanguageDetectModel  string   `json:"language_detect_model" env:"LANGUAGE_DETECT_MODEL"`
+	LanguageDetectSample Duration `json:"language_detect_sample" env:"LANGUAGE_DETECT_SAMPLE"`
+
+	// Huella acústica (fpcalc de Chromaprint) de los medios descargados para
+	// reutilizar el resultado de otra URL con el mismo audio
+	AudioFingerprint         bool    `json:"audio_fingerprint" env:"AUDIO_FINGERPRINT"`
+	FpcalcPath               string  `json:"fpcalc_path" env:"FPCALC_PATH"`
+	FingerprintMinSimilarity float64 `json:"fingerprint_min_similarity" env:"FINGERPRINT_MIN_SIMILARITY"`
+
+	// Segundos de procesamiento por segundo de audio, por modelo, para la
+	// estimación de POST /probe
+	RealtimeFactors map[string]float64 `json:"realtime_factors"`
+
+	// POST /transcribe/sync: duración máxima del audio y plazo de respuesta
+	SyncMaxDuration Duration `json:"sync_max_duration" env:"SYNC_MAX_DURATION"`
+	SyncTimeout     Duration `json:"sync_timeout" env:"SYNC_TIMEOUT"`
+
+	// Máximo de IDs por petición a POST /jobs/status
+	BulkStatusMaxJobs int `json:"bulk_status_max_jobs" env:"BULK_STATUS_MAX_JOBS"`
+
+	// Backend de alineación forzada (POST {AlignerURL}/align)
+	AlignerURL   string   `json:"aligner_url" env:"ALIGNER_URL"`
+	AlignTimeout Duration `json:"align_timeout" env:"ALIGN_TIMEOUT"`
+
+	// Render con ffmpeg y almacenamiento de artefactos (local o s3)
+	FFmpegPath         string   `json:"ffmpeg_path" env:"FFMPEG_PATH"`
+	RenderTimeout      Duration `json:"render_timeout" env:"RENDER_TIMEOUT"`
+	StorageBackend     string   `json:"storage_backend" env:"STORAGE_BACKEND"`
+	ArtifactsDir       string   `json:"artifacts_dir" env:"ARTIFACTS_DIR"`
+	ArtifactSigningKey string   `json:"artifact_signing_key" env:"ARTIFACT_SIGNING_KEY"`
+	ArtifactURLTTL     Duration `json:"artifact_url_ttl" env:"ARTIFACT_URL_TTL"`
+	UploadURLTTL       Duration `json:"upload_url_ttl" env:"UPLOAD_URL_TTL"` // validez de la URL de POST /uploads
+	PublicBaseURL      string   `json:"public_base_url" env:"PUBLIC_BASE_URL"`
+	S3Endpoint         string   `json:"s3_endpoint" env:"S3_ENDPOINT"`
+	S3Bucket           string   `json:"s3_bucket" env:"S3_BUCKET"`
+	S3Region           string   `json:"s3_region" env:"S3_REGION"`
+	S3AccessKey        string   `json:"s3_access_key" env:"S3_ACCESS_KEY"`
+	S3SecretKey        string   `json:"s3_secret_key" env:"S3_SECRET_KEY"`
+	S3UseSSL           bool     `json:"s3_use_ssl" env:"S3_USE_SSL"`
+
+	// Ingesta desde S3: notificaciones de S3 (vía SQS) de los objetos nuevos
+	// de S3IngestBucket bajo S3IngestPrefix. Usa el endpoint y las
+	// credenciales de S3_*; los jobs son del tenant S3IngestTenant, con las
+	// opciones de su plantilla S3IngestTemplate, y el resultado se escribe
+	// junto al objeto con INTEGRATION_TIMEOUT por intento. Deshabilitada
+	// con S3IngestQueueURL vacía.
+	S3IngestQueueURL string `json:"s3_ingest_queue_url" env:"S3_INGEST_QUEUE_URL"`
+	S3IngestBucket   string `json:"s3_ingest_bucket" env:"S3_INGEST_BUCKET"`
+	S3IngestPrefix   string `json:"s3_ingest_prefix" env:"S3_INGEST_PREFIX"`
+	S3IngestTenant   string `json:"s3_ingest_tenant" env:"S3_INGEST_TENANT"`
+	S3IngestTemplate string `json:"s3_ingest_template" env:"S3_INGEST_TEMPLATE"`
+
+	// Cada cuánto el purgador aplica las políticas de /retention
+	RetentionInterval Duration `json:"retention_interval" env:"RETENTION_INTERVAL"`
+
+	// Exportación periódica de los metadatos de los jobs (sin transcripciones)
+	// al almacén de artefactos, para analítica; intervalo 0 = solo con
+	// POST /admin/exports
+	MetadataExportInterval Duration `json:"metadata_export_interval" env:"METADATA_EXPORT_INTERVAL"`
+	MetadataExportFormat   string   `json:"metadata_export_format" env:"METADATA_EXPORT_FORMAT"` // csv o parquet
+	MetadataExportPrefix   string   `json:"metadata_export_prefix" env:"METADATA_EXPORT_PREFIX"`
+
+	// Alertas sobre los jobs sin Prometheus: reglas (solo desde CONFIG_FILE)
+	// que evalúa el líder y notifica a un webhook entrante de Slack y/o a un
+	// webhook genérico, firmado si hay secreto
+	AlertRules              []AlertRule `json:"alert_rules"`
+	AlertEvaluationInterval Duration    `json:"alert_evaluation_interval" env:"ALERT_EVALUATION_INTERVAL"`
+	AlertSlackWebhookURL    string      `json:"alert_slack_webhook_url" env:"ALERT_SLACK_WEBHOOK_URL"`
+	AlertWebhookURL         string      `json:"alert_webhook_url" env:"ALERT_WEBHOOK_URL"`
+	AlertWebhookSecret      string      `json:"alert_webhook_secret" env:"ALERT_WEBHOOK_SECRET"`
+
+	// Clave HMAC de los informes de POST /admin/erasure; sin ella el
+	// endpoint responde 503
+	ErasureSigningKey string `json:"erasure_signing_key" env:"ERASURE_SIGNING_KEY"`
+
+	// Enlaces públicos de POST /jobs/:job_id/share: clave HMAC (sin ella el
+	// endpoint responde 503), caducidad por defecto y máxima
+	ShareSigningKey string   `json:"share_signing_key" env:"SHARE_SIGNING_KEY"`
+	ShareLinkTTL    Duration `json:"share_link_ttl" env:"SHARE_LINK_TTL"`
+	ShareLinkMaxTTL Duration `json:"share_link_max_ttl" env:"SHARE_LINK_MAX_TTL"`
+
+	// frame-ancestors de la CSP de /jobs/:job_id/embed: quién puede
+	// insertarlo en un iframe, p. ej. "https://cms.example.com"
+	EmbedFrameAncestors string `json:"embed_frame_ancestors" env:"EMBED_FRAME_ANCESTORS"`
+
+	// Estado persistente de los jobs (file con StateDir vacío = solo en
+	// memoria) y troceado de audio largo para reanudar solo los fragmentos
+	// pendientes
+	StateBackend  string   `json:"state_backend" env:"STATE_BACKEND"` // file o postgres
+	StateDir      string   `json:"state_dir" env:"STATE_DIR"`
+	ChunkDuration Duration `json:"chunk_duration" env:"CHUNK_DURATION"` // 0 desactiva el troceado
+
+	// Postgres para STATE_BACKEND=postgres; las migraciones embebidas se
+	// aplican al arrancar salvo con DATABASE_MIGRATE=false
+	DatabaseURL     string   `json:"database_url" env:"DATABASE_URL"`
+	DatabaseMigrate bool     `json:"database_migrate" env:"DATABASE_MIGRATE"`
+	DatabaseTimeout Duration `json:"database_timeout" env:"DATABASE_TIMEOUT"`
+
+	// Caché de resultados (deshabilitada si RedisURL está vacío)
+	RedisURL string   `json:"redis_url" env:"REDIS_URL"`
+	CacheTTL Duration `json:"cache_ttl" env:"CACHE_TTL"`
+
+	// Secretos desde un gestor: cualquier valor de texto puede ser
+	// vault:<ruta>#<campo>, aws-sm:<id>[#<campo>], file:<ruta> o
+	// encrypted:<base64> (ver secrets.go). Se releen cada
+	// SecretsRefreshInterval (0 = solo al arrancar).
+	VaultAddr              string   `json:"vault_addr" env:"VAULT_ADDR"`
+	VaultToken             string   `json:"vault_token" env:"VAULT_TOKEN"`
+	VaultNamespace         string   `json:"vault_namespace" env:"VAULT_NAMESPACE"`
+	AWSRegion              string   `json:"aws_region" env:"AWS_REGION"`
+	AWSAccessKeyID         string   `json:"aws_access_key_id" env:"AWS_ACCESS_KEY_ID"`
+	AWSSecretAccessKey     string   `json:"aws_secret_access_key" env:"AWS_SECRET_ACCESS_KEY"`
+	AWSSessionToken        string   `json:"aws_session_token" env:"AWS_SESSION_TOKEN"`
+	SecretsManagerURL      string   `json:"secrets_manager_url" env:"SECRETS_MANAGER_URL"`     // por defecto el de AWS_REGION
+	ConfigEncryptionKey    string   `json:"config_encryption_key" env:"CONFIG_ENCRYPTION_KEY"` // 32 bytes en base64
+	SecretsRefreshInterval Duration `json:"secrets_refresh_interval" env:"SECRETS_REFRESH_INTERVAL"`
+
+	// Protocolo con los backends whisper (ver asyncbackend.go): auto, v1 o
+	// v2. Con v2 el job se sondea cada BackendPollInterval, falla si no
+	// termina en BackendJobTimeout o si el backend no responde durante
+	// BackendRestartGrace. Sin BackendCallbackSecret no se pide callback.
+	BackendProtocol       string   `json:"backend_protocol" env:"BACKEND_PROTOCOL"`
+	BackendPollInterval   Duration `json:"backend_poll_interval" env:"BACKEND_POLL_INTERVAL"`
+	BackendJobTimeout     Duration `json:"backend_job_timeout" env:"BACKEND_JOB_TIMEOUT"`
+	BackendRestartGrace   Duration `json:"backend_restart_grace" env:"BACKEND_RESTART_GRACE"`
+	BackendCallbackURL    string   `json:"backend_callback_url" env:"BACKEND_CALLBACK_URL"` // por defecto PUBLIC_BASE_URL
+	BackendCallbackSecret string   `json:"backend_callback_secret" env:"BACKEND_CALLBACK_SECRET"`
+
+	// Calentamiento (ver warmup.go): al arrancar y cuando un backend lleva
+	// BackendWarmupIdle sin jobs se le pide cargar BackendWarmupModel
+	// (vacío = su modelo por defecto) para que el primer job no pague la carga
+	BackendWarmup      bool     `json:"backend_warmup" env:"BACKEND_WARMUP"`
+	BackendWarmupIdle  Duration `json:"backend_warmup_idle" env:"BACKEND_WARMUP_IDLE"`
+	BackendWarmupModel string   `json:"backend_warmup_model" env:"BACKEND_WARMUP_MODEL"`
+
+	// Reglas que mandan ciertos jobs a backends concretos (ver routing.go),
+	// solo desde CONFIG_FILE
+	BackendRouting []RoutingRule `json:"backend_routing"`
+
+	// Cada cuánto se mira si CONFIG_FILE cambió para recargarlo (0 = solo con
+	// SIGHUP o POST /admin/config/reload)
+	ConfigReloadInterval Duration `json:"config_reload_interval" env:"CONFIG_RELOAD_INTERVAL"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Port:       "8080",
+		WhisperURL: "http://whisper_service:8000",
+
+		GinMode:             gin.ReleaseMode,
+		AccessLog:           true,
+		AccessLogSampleRate: 1,
+
+		Metrics: true,
+
+		ErrorLanguage: LangEnglish,
+
+		ErrorSampleRate: 1,
+
+		WebhookTimeout:      Duration{10 * time.Second},
+		WebhookMaxAttempts:  5,
+		WebhookRetryBackoff: Duration{2 * time.Second},
+		WebhookSecretGrace:  Duration{24 * time.Hour},
+
+		GoogleAPIURL:       "https://www.googleapis.com",
+		GoogleTokenURL:     "https://oauth2.googleapis.com/token",
+		NotionAPIURL:       "https://api.notion.com",
+		IntegrationTimeout: Duration{30 * time.Second},
+
+		DropboxAPIURL:         "https://api.dropboxapi.com",
+		DropboxContentURL:     "https://content.dropboxapi.com",
+		DropboxTokenURL:       "https://api.dropboxapi.com/oauth2/token",
+		ConnectorPollInterval: Duration{time.Minute},
+
+		TwilioAPIURL: "https://api.twilio.com",
+
+		ZoomTokenURL:      "https://zoom.us/oauth/token",
+		ZoomDownloadHosts: []string{"zoom.us"},
+
+		TelegramAPIURL: "https://api.telegram.org",
+		WhatsAppAPIURL: "https://graph.facebook.com/v19.0",
+		DiscordAPIURL:  "https://discord.com/api/v10",
+
+		GCSEndpoint: "https://storage.googleapis.com",
+
+		NATSURL:            "nats://127.0.0.1:4222",
+		EventSubjectPrefix: "transcribe.job",
+		EventBusTimeout:    Duration{5 * time.Second},
+
+		Role:              RoleAll,
+		ClaimPollInterval: Duration{time.Second},
+		ClaimLeaseTTL:     Duration{30 * time.Second},
+
+		SettingsPollInterval: Duration{5 * time.Second},
+
+		MaintenanceRetryAfter: Duration{5 * time.Minute},
+
+		LeaderLockKey:  "transcribe:leader",
+		LeaderLeaseTTL: Duration{15 * time.Second},
+
+		OutboxPollInterval: Duration{time.Second},
+		OutboxWorkers:      8,
+		OutboxMaxBackoff:   Duration{5 * time.Minute},
+
+		RequestTimeout: Duration{30 * time.Second},
+		RouteTimeouts: map[string]Duration{
+			"GET /jobs":                     {5 * time.Second},
+			"POST /transcribe/sync":         {time.Minute},
+			"POST /jobs/:job_id/clips":      {10 * time.Minute},
+			"POST /jobs/:job_id/align":      {5 * time.Minute},
+			"GET /artifacts/*key":           {0}, // descargas de archivos grandes
+			"PUT /artifacts/*key":           {0},
+			"POST /uploads":                 {0}, // subidas desde enlaces lentos
+			"POST /probe":                   {time.Minute},
+			"PATCH /uploads/tus/:upload_id": {0},
+
+			"POST /jobs/:job_id/segments/:seg_id/retranscribe": {5 * time.Minute},
+
+			"GET /admin/debug/pprof/*profile": {0}, // profile y trace duran ?seconds=
+		},
+
+		CapacityPollInterval: Duration{15 * time.Second},
+		BackendFallback:      true,
+		DownloadDir:          "downloads",
+		DownloadTimeout:      Duration{30 * time.Minute},
+		DownloadRetries:      3,
+		MaxDownloadMB:        100,
+		BackendFetchHost:     []string{"youtube.com", "youtu.be"},
+
+		ConcurrencyLimitMode: LimitModeQueue,
+		APIKeyRotationGrace:  Duration{24 * time.Hour},
+
+		RequestSignatureTolerance: Duration{5 * time.Minute},
+
+		SecretsRefreshInterval: Duration{5 * time.Minute},
+
+		BackendProtocol:     BackendProtocolAuto,
+		BackendPollInterval: Duration{2 * time.Second},
+		BackendJobTimeout:   Duration{time.Hour},
+		BackendRestartGrace: Duration{2 * time.Minute},
+
+		BackendWarmup:     true,
+		BackendWarmupIdle: Duration{15 * time.Minute},
+
+		OIDCScopes:      []string{"openid", "email", "profile"},
+		OIDCGroupsClaim: "groups",
+		OIDCTenant:      "oidc",
+		SessionTTL:      Duration{12 * time.Hour},
+
+		Workers:               4,
+		PreprocessWorkers:     4,
+		ShortLaneFraction:     0.25,
+		ShortAudioMaxDuration: Duration{2 * time.Minute},
+		FFprobePath:           "ffprobe",
+		SupportedFormats:      []string{"wav", "mp3", "aac", "m4a", "mp4", "ogg", "flac", "webm", "mkv"},
+		ProbeTimeout:          Duration{30 * time.Second},
+
+		PriorityAgingInterval: Duration{time.Minute},
+
+		UnknownDurationEstimate: Duration{time.Hour},
+
+		VADMinSpeechRatio: 0.05,
+		VADNoiseDB:        -35,
+		VADMinSilence:     Duration{500 * time.Millisecond},
+		VADTimeout:        Duration{2 * time.Minute},
+
+		TwoPassFirstModel:  "base",
+		TwoPassSecondModel: "large",
+
+		LanguageDetectModel:  "base",
+		LanguageDetectSample: Duration{30 * time.Second},
+
+		FpcalcPath:               "fpcalc",
+		FingerprintMinSimilarity: 0.9,
+
+		RealtimeFactors: map[string]float64{
+			"tiny":   0.03,
+			"base":   0.05,
+			"small":  0.1,
+			"medium": 0.2,
+			"large":  0.35,
+		},
+
+		SyncMaxDuration: Duration{time.Minute},
+		SyncTimeout:     Duration{30 * time.Second},
+
+		BulkStatusMaxJobs: 500,
+
+		AlignTimeout: Duration{5 * time.Minute},
+
+		FFmpegPath:     "ffmpeg",
+		RenderTimeout:  Duration{30 * time.Minute},
+		StorageBackend: "local",
+		ArtifactsDir:   "artifacts",
+		ArtifactURLTTL: Duration{time.Hour},
+		UploadURLTTL:   Duration{24 * time.Hour},
+		S3UseSSL:       true,
+
+		RetentionInterval: Duration{time.Hour},
+
+		MetadataExportFormat: ExportFormatCSV,
+		MetadataExportPrefix: "exports/jobs",
+
+		AlertEvaluationInterval: Duration{time.Minute},
+
+		ShareLinkTTL:    Duration{7 * 24 * time.Hour},
+		ShareLinkMaxTTL: Duration{30 * 24 * time.Hour},
+
+		EmbedFrameAncestors: "*",
+
+		StateBackend:  "file",
+		StateDir:      "data",
+		ChunkDuration: Duration{10 * time.Minute},
+
+		DatabaseMigrate: true,
+		DatabaseTimeout: Duration{5 * time.Second},
+
+		CacheTTL: Duration{24 * time.Hour},
+	}
+}
+
+var cfg = defaultConfig()
+
+// Flags de la línea de comandos, leídos una sola vez al arrancar
+var (
+	roleFlag          string
+	encryptSecretFlag bool
+)
+
+// Carga la configuración completa; cualquier error es fatal al arrancar
+func loadConfig() Config {
+	flag.StringVar(&roleFlag, "role", "", "all, api o worker (sobrescribe ROLE)")
+	flag.BoolVar(&encryptSecretFlag, "encrypt-secret", false, "cifra stdin con CONFIG_ENCRYPTION_KEY como encrypted:<...> y termina")
+	flag.Parse()
+	c, refs := readConfig(log.Fatalf)
+	configSecrets.refs = refs
+	return c
+}
+
+// Lee CONFIG_FILE, el entorno y los secretos referenciados y valida el
+// resultado. fail no debe volver: al arrancar es log.Fatalf y en una
+// recarga en caliente aborta la lectura (ver reload.go).
+func readConfig(fail func(format string, args ...interface{})) (Config, []*secretRef) {
+	c := defaultConfig()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fail("❌ No se pudo leer CONFIG_FILE: %v", err)
+		}
+		if err := json.Unmarshal(data, &c); err != nil {
+			fail("❌ CONFIG_FILE inválido: %v", err)
+		}
+	}
+
+	if err := applyEnv(&c); err != nil {
+		fail("❌ Variable de entorno inválida: %v", err)
+	}
+
+	if roleFlag != "" {
+		c.Role = roleFlag
+	}
+	if encryptSecretFlag {
+		if err := printEncryptedSecret(&c); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		os.Exit(0)
+	}
+	refs, err := resolveConfigSecrets(&c)
+	if err != nil {
+		fail("❌ No se pudo leer un secreto de la configuración: %v", err)
+	}
+	if c.SecretsRefreshInterval.Duration < 0 {
+		fail("❌ SECRETS_REFRESH_INTERVAL no puede ser negativo")
+	}
+	if c.ConfigReloadInterval.Duration < 0 {
+		fail("❌ CONFIG_RELOAD_INTERVAL no puede ser negativo")
+	}
+	switch c.BackendProtocol {
+	case BackendProtocolAuto, BackendProtocolV1, BackendProtocolV2:
+	default:
+		fail("❌ BACKEND_PROTOCOL debe ser auto, v1 o v2")
+	}
+	if c.BackendPollInterval.Duration <= 0 || c.BackendJobTimeout.Duration <= 0 || c.BackendRestartGrace.Duration <= 0 {
+		fail("❌ BACKEND_POLL_INTERVAL, BACKEND_JOB_TIMEOUT y BACKEND_RESTART_GRACE deben ser positivos")
+	}
+	if c.BackendWarmupIdle.Duration <= 0 {
+		fail("❌ BACKEND_WARMUP_IDLE debe ser positivo")
+	}
+	if !isBuiltinModel(c.BackendWarmupModel) {
+		fail("❌ BACKEND_WARMUP_MODEL debe ser uno de %s", strings.Join(whisperModels, ", "))
+	}
+
+	if len(c.WhisperBackends) == 0 {
+		c.WhisperBackends = []string{c.WhisperURL}
+	}
+	for i, u := range c.WhisperBackends {
+		c.WhisperBackends[i] = strings.TrimRight(u, "/")
+	}
+	if err := validateRoutingRules(c.BackendRouting, c.WhisperBackends); err != nil {
+		fail("❌ backend_routing: %v", err)
+	}
+	if c.DefaultBackendConcurrency < 0 {
+		fail("❌ DEFAULT_BACKEND_CONCURRENCY no puede ser negativo")
+	}
+	limits := make(map[string]int, len(c.BackendMaxConcurrency))
+	for u, limit := range c.BackendMaxConcurrency {
+		if limit < 0 {
+			fail("❌ backend_max_concurrency[%s] no puede ser negativo", u)
+		}
+		limits[strings.TrimRight(u, "/")] = limit
+	}
+	c.BackendMaxConcurrency = limits
+	if c.BackendMediaDir == "" {
+		c.BackendMediaDir = c.DownloadDir
+	}
+	switch c.GinMode {
+	case gin.DebugMode, gin.ReleaseMode, gin.TestMode:
+	default:
+		fail("❌ GIN_MODE debe ser %q, %q o %q", gin.DebugMode, gin.ReleaseMode, gin.TestMode)
+	}
+	if c.AccessLogSampleRate < 0 || c.AccessLogSampleRate > 1 {
+		fail("❌ ACCESS_LOG_SAMPLE_RATE debe estar entre 0 y 1")
+	}
+	if !isSupportedLanguage(c.ErrorLanguage) {
+		fail("❌ ERROR_LANGUAGE debe ser uno de %s", strings.Join(supportedLanguages, ", "))
+	}
+	switch c.StateBackend {
+	case "file":
+	case "postgres":
+		if c.DatabaseURL == "" {
+			fail("❌ STATE_BACKEND=postgres requiere DATABASE_URL")
+		}
+	default:
+		fail("❌ STATE_BACKEND debe ser file o postgres")
+	}
+	switch c.Role {
+	case RoleAll:
+	case RoleAPI, RoleWorker:
+		if c.StateBackend == "file" && c.StateDir == "" {
+			fail("❌ ROLE=%s requiere un almacén compartido (STATE_DIR o STATE_BACKEND=postgres)", c.Role)
+		}
+	default:
+		fail("❌ ROLE debe ser %s, %s o %s", RoleAll, RoleAPI, RoleWorker)
+	}
+	if c.WorkerID == "" {
+		c.WorkerID = instanceID()
+	}
+	if c.ClaimPollInterval.Duration <= 0 || c.SettingsPollInterval.Duration <= 0 {
+		fail("❌ CLAIM_POLL_INTERVAL y SETTINGS_POLL_INTERVAL deben ser positivos")
+	}
+	if c.ClaimLeaseTTL.Duration < 3*time.Second {
+		fail("❌ CLAIM_LEASE_TTL debe ser al menos 3s")
+	}
+	switch c.LeaderElection {
+	case "":
+	case "redis":
+		if c.RedisURL == "" {
+			fail("❌ LEADER_ELECTION=redis requiere REDIS_URL")
+		}
+	case "postgres":
+		if c.DatabaseURL == "" {
+			fail("❌ LEADER_ELECTION=postgres requiere DATABASE_URL")
+		}
+	default:
+		fail("❌ LEADER_ELECTION debe ser redis o postgres")
+	}
+	if c.LeaderLeaseTTL.Duration < 3*time.Second {
+		fail("❌ LEADER_LEASE_TTL debe ser al menos 3s")
+	}
+	if c.EventBus == "kafka" && len(c.KafkaBrokers) == 0 {
+		fail("❌ EVENT_BUS=kafka requiere KAFKA_BROKERS")
+	}
+	if c.OutboxWorkers < 1 {
+		fail("❌ OUTBOX_WORKERS debe ser al menos 1")
+	}
+	if c.PreprocessWorkers < 1 {
+		fail("❌ PREPROCESS_WORKERS debe ser al menos 1")
+	}
+	if c.WebhookMaxAttempts < 1 {
+		fail("❌ WEBHOOK_MAX_ATTEMPTS debe ser al menos 1")
+	}
+	if c.IntegrationTimeout.Duration <= 0 {
+		fail("❌ INTEGRATION_TIMEOUT debe ser positivo")
+	}
+	if c.ConnectorPollInterval.Duration <= 0 {
+		fail("❌ CONNECTOR_POLL_INTERVAL debe ser positivo")
+	}
+	switch c.VADCheck {
+	case VADCheckOff, VADCheckWarn, VADCheckFail:
+	default:
+		fail("❌ VAD_CHECK debe ser %q o %q", VADCheckWarn, VADCheckFail)
+	}
+	if c.VADMinSpeechRatio < 0 || c.VADMinSpeechRatio > 1 {
+		fail("❌ VAD_MIN_SPEECH_RATIO debe estar entre 0 y 1")
+	}
+	if c.TwoPassFirstModel == "" || !isBuiltinModel(c.TwoPassFirstModel) || c.TwoPassSecondModel == "" || !isBuiltinModel(c.TwoPassSecondModel) {
+		fail("❌ TWO_PASS_FIRST_MODEL y TWO_PASS_SECOND_MODEL deben ser uno de %s", strings.Join(whisperModels, ", "))
+	}
+	if c.PriorityAgingInterval.Duration < 0 {
+		fail("❌ PRIORITY_AGING_INTERVAL no puede ser negativo")
+	}
+	if c.GPUMinutesBudget < 0 {
+		fail("❌ GPU_MINUTES_BUDGET no puede ser negativo")
+	}
+	if c.UnknownDurationEstimate.Duration <= 0 {
+		fail("❌ UNKNOWN_DURATION_ESTIMATE debe ser positivo")
+	}
+	for tenant, weight := range c.TenantWeights {
+		if weight <= 0 {
+			fail("❌ tenant_weights[%s] debe ser positivo", tenant)
+		}
+	}
+	if err := validateFeatureFlags(c.FeatureFlags); err != nil {
+		fail("❌ feature_flags: %v", err)
+	}
+	for tenant, flags := range c.TenantFeatureFlags {
+		if err := validateFeatureFlags(flags); err != nil {
+			fail("❌ tenant_feature_flags[%s]: %v", tenant, err)
+		}
+	}
+	if !isBuiltinModel(c.LanguageDetectModel) {
+		fail("❌ LANGUAGE_DETECT_MODEL debe ser uno de %s", strings.Join(whisperModels, ", "))
+	}
+	if c.LanguageDetectSample.Duration <= 0 {
+		fail("❌ LANGUAGE_DETECT_SAMPLE debe ser positivo")
+	}
+	if c.FingerprintMinSimilarity <= 0.5 || c.FingerprintMinSimilarity > 1 {
+		// Dos audios cualesquiera coinciden en la mitad de los bits
+		fail("❌ FINGERPRINT_MIN_SIMILARITY debe ser mayor que 0.5 y como mucho 1")
+	}
+	if c.AudioFingerprint && c.FpcalcPath == "" {
+		fail("❌ AUDIO_FINGERPRINT requiere FPCALC_PATH")
+	}
+	for model, factor := range c.RealtimeFactors {
+		if factor <= 0 {
+			fail("❌ realtime_factors[%s] debe ser positivo", model)
+		}
+	}
+	if c.BulkStatusMaxJobs < 1 {
+		fail("❌ BULK_STATUS_MAX_JOBS debe ser al menos 1")
+	}
+	if c.ErrorSampleRate < 0 || c.ErrorSampleRate > 1 {
+		fail("❌ ERROR_SAMPLE_RATE debe estar entre 0 y 1")
+	}
+	for category, rate := range c.ErrorSampleRates {
+		if rate < 0 || rate > 1 {
+			fail("❌ error_sample_rates[%s] debe estar entre 0 y 1", category)
+		}
+	}
+	if c.S3IngestQueueURL != "" {
+		if u, err := url.Parse(c.S3IngestQueueURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			fail("❌ S3_INGEST_QUEUE_URL debe ser una URL http(s)")
+		}
+		if c.S3IngestBucket == "" || c.S3Endpoint == "" || c.S3Region == "" {
+			fail("❌ S3_INGEST_QUEUE_URL requiere S3_INGEST_BUCKET, S3_ENDPOINT y S3_REGION")
+		}
+	}
+	if c.RetentionInterval.Duration <= 0 {
+		fail("❌ RETENTION_INTERVAL debe ser positivo")
+	}
+	if c.MetadataExportInterval.Duration < 0 {
+		fail("❌ METADATA_EXPORT_INTERVAL no puede ser negativo")
+	}
+	if c.MetadataExportFormat != ExportFormatCSV && c.MetadataExportFormat != ExportFormatParquet {
+		fail("❌ METADATA_EXPORT_FORMAT debe ser %q o %q", ExportFormatCSV, ExportFormatParquet)
+	}
+	if strings.Trim(c.MetadataExportPrefix, "/") == "" {
+		fail("❌ METADATA_EXPORT_PREFIX no puede estar vacío")
+	}
+	if c.AlertEvaluationInterval.Duration <= 0 {
+		fail("❌ ALERT_EVALUATION_INTERVAL debe ser positivo")
+	}
+	for name, target := range map[string]string{"ALERT_SLACK_WEBHOOK_URL": c.AlertSlackWebhookURL, "ALERT_WEBHOOK_URL": c.AlertWebhookURL} {
+		if target == "" {
+			continue
+		}
+		if u, err := url.Parse(target); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			fail("❌ %s debe ser una URL http(s)", name)
+		}
+	}
+	if len(c.AlertRules) > 0 && c.AlertSlackWebhookURL == "" && c.AlertWebhookURL == "" {
+		log.Printf("⚠️ alert_rules sin ALERT_SLACK_WEBHOOK_URL ni ALERT_WEBHOOK_URL: las alertas solo se verán en GET /admin/alerts")
+	}
+	ruleNames := make(map[string]bool, len(c.AlertRules))
+	for i, rule := range c.AlertRules {
+		if rule.Name == "" || ruleNames[rule.Name] {
+			fail("❌ alert_rules[%d] necesita un name único", i)
+		}
+		ruleNames[rule.Name] = true
+		switch rule.Metric {
+		case AlertFailureRate:
+			if rule.Threshold < 0 || rule.Threshold >= 1 {
+				fail("❌ alert_rules[%d].threshold de failure_rate debe ser una fracción entre 0 y 1", i)
+			}
+			if rule.Window.Duration == 0 {
+				c.AlertRules[i].Window = Duration{15 * time.Minute}
+			} else if rule.Window.Duration < 0 {
+				fail("❌ alert_rules[%d].window no puede ser negativo", i)
+			}
+			if rule.MinJobs < 0 {
+				fail("❌ alert_rules[%d].min_jobs no puede ser negativo", i)
+			}
+		case AlertQueueDepth:
+			if rule.Threshold < 0 {
+				fail("❌ alert_rules[%d].threshold no puede ser negativo", i)
+			}
+		default:
+			fail("❌ alert_rules[%d].metric debe ser %s o %s", i, AlertFailureRate, AlertQueueDepth)
+		}
+	}
+	if c.ErasureSigningKey != "" && len(c.ErasureSigningKey) < 32 {
+		fail("❌ ERASURE_SIGNING_KEY debe tener al menos 32 caracteres")
+	}
+	if c.ShareSigningKey != "" && len(c.ShareSigningKey) < 32 {
+		fail("❌ SHARE_SIGNING_KEY debe tener al menos 32 caracteres")
+	}
+	if c.ShareLinkTTL.Duration <= 0 || c.ShareLinkMaxTTL.Duration < c.ShareLinkTTL.Duration {
+		fail("❌ SHARE_LINK_TTL debe ser positivo y no mayor que SHARE_LINK_MAX_TTL")
+	}
+	if strings.TrimSpace(c.EmbedFrameAncestors) == "" || strings.ContainsAny(c.EmbedFrameAncestors, ";,\r\n") {
+		fail("❌ EMBED_FRAME_ANCESTORS debe ser una lista de orígenes separados por espacios")
+	}
+	if c.APIKeyRotationGrace.Duration < 0 {
+		fail("❌ API_KEY_ROTATION_GRACE no puede ser negativo")
+	}
+	if c.RequestSignatureTolerance.Duration <= 0 {
+		fail("❌ REQUEST_SIGNATURE_TOLERANCE debe ser positivo")
+	}
+	if c.ConcurrencyLimitMode != LimitModeQueue && c.ConcurrencyLimitMode != LimitModeReject {
+		fail("❌ CONCURRENCY_LIMIT_MODE debe ser %q o %q", LimitModeQueue, LimitModeReject)
+	}
+	for i, key := range c.APIKeys {
+		if key.Key == "" {
+			fail("❌ api_keys[%d] no tiene key", i)
+		}
+		if key.Name == "" {
+			c.APIKeys[i].Name = fmt.Sprintf("key-%d", i+1)
+		}
+		if key.Role == "" {
+			c.APIKeys[i].Role = AccessEditor
+		} else if !isAccessRole(key.Role) {
+			fail("❌ api_keys[%d].role debe ser %s, %s, %s u %s", i, AccessViewer, AccessEditor, AccessAdmin, AccessOperator)
+		}
+		cidrs, err := normalizeAllowedCIDRs(key.AllowedCIDRs)
+		if err != nil {
+			fail("❌ api_keys[%d]: %v", i, err)
+		}
+		c.APIKeys[i].AllowedCIDRs = cidrs
+	}
+	for _, proxy := range c.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				fail("❌ TRUSTED_PROXIES: %q no es una IP ni un CIDR", proxy)
+			}
+		}
+	}
+	if c.OIDCIssuer != "" {
+		if c.OIDCClientID == "" {
+			fail("❌ OIDC_ISSUER requiere OIDC_CLIENT_ID")
+		}
+		if len(c.SessionSecret) < 32 {
+			fail("❌ OIDC_ISSUER requiere SESSION_SECRET de al menos 32 caracteres")
+		}
+		if c.OIDCRedirectURL == "" && c.PublicBaseURL != "" {
+			c.OIDCRedirectURL = strings.TrimRight(c.PublicBaseURL, "/") + "/auth/callback"
+		}
+		if c.OIDCTenant == "" || c.OIDCGroupsClaim == "" {
+			fail("❌ OIDC_TENANT y OIDC_GROUPS_CLAIM no pueden estar vacíos")
+		}
+		if c.SessionTTL.Duration <= 0 {
+			fail("❌ SESSION_TTL debe ser positivo")
+		}
+	}
+	if c.EncryptionMasterKey != "" {
+		if c.EncryptionKMSURL != "" {
+			fail("❌ ENCRYPTION_MASTER_KEY y ENCRYPTION_KMS_URL son excluyentes")
+		}
+		if key, err := base64.StdEncoding.DecodeString(c.EncryptionMasterKey); err != nil || len(key) != 32 {
+			fail("❌ ENCRYPTION_MASTER_KEY debe ser una clave de 32 bytes en base64 (openssl rand -base64 32)")
+		}
+	}
+	if c.EncryptionKMSURL != "" && c.EncryptionKMSKey == "" {
+		fail("❌ ENCRYPTION_KMS_URL requiere ENCRYPTION_KMS_KEY")
+	}
+	for group, role := range c.OIDCGroupRoles {
+		if !isAccessRole(role) {
+			fail("❌ oidc_group_roles[%s] debe ser %s, %s, %s u %s", group, AccessViewer, AccessEditor, AccessAdmin, AccessOperator)
+		}
+	}
+	if c.OIDCDefaultRole != "" && !isAccessRole(c.OIDCDefaultRole) {
+		fail("❌ OIDC_DEFAULT_ROLE debe ser %s, %s, %s u %s", AccessViewer, AccessEditor, AccessAdmin, AccessOperator)
+	}
+	return c, refs
+}
+
+// Sobrescribe los campos que tengan tag `env` con el valor de la variable
+func applyEnv(c *Config) error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setFromString(v.Field(i), raw); err != nil {
+			return errors.Wrap(err, name)
+		}
+	}
+	return nil
+}
+
+func setFromString(field reflect.Value, raw string) error {
+	switch field.Interface().(type) {
+	case Duration:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(Duration{d}))
+		return nil
+	case []string:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return errors.Errorf("unsupported config type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Archivos que se leen de una carpeta por sondeo; el resto, en el siguiente
+const connectorPageSize = 100
+
+// Formato de createdTime en Drive, que también sirve de cursor
+const driveTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// Los IDs de los jobs salen de la integración y del archivo, para no crear
+// otro si el sondeo vuelve a ver el mismo
+var connectorNamespace = uuid.MustParse("a3c1f0d6-6b1e-4f55-8f8e-2d9f7c4b8e21")
+
+// Archivo nuevo de una carpeta vigilada
+type connectorFile struct {
+	ID   string
+	Name string
+	Path string // dropbox
+	Size int64
+}
+
+// Sondea en el líder las carpetas vigiladas cada CONNECTOR_POLL_INTERVAL
+func runConnectors(ctx context.Context) {
+	ticker := time.NewTicker(cfg.ConnectorPollInterval.Duration)
+	defer ticker.Stop()
+	for {
+		for _, item := range integrations.watched() {
+			if ctx.Err() != nil {
+				return
+			}
+			pollConnector(ctx, item)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Un sondeo: crea un job por archivo nuevo y avanza el cursor. Si algo
+// falla el cursor no avanza y el siguiente sondeo lo reintenta; los jobs
+// ya creados no se repiten.
+func pollConnector(ctx context.Context, item Integration) {
+	client := &http.Client{Timeout: cfg.IntegrationTimeout.Duration}
+	var cursor string
+	err := withAccessToken(client, item, func(accessToken string) error {
+		var files []connectorFile
+		var err error
+		switch item.Provider {
+		case ProviderGoogleDrive:
+			files, cursor, err = listDriveFiles(client, accessToken, item)
+		case ProviderDropbox:
+			files, cursor, err = listDropboxFiles(client, accessToken, item)
+		}
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err := ingestConnectorFile(ctx, accessToken, item, f); err != nil {
+				return errors.Wrapf(err, "file %s", f.Name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("⚠️ No se pudo sondear la carpeta de la integración %s: %v", item.ID, err)
+		cursor = ""
+	}
+	integrations.recordPoll(item, cursor, err)
+}
+
+// Archivos de la carpeta creados después del cursor (o, en el primer
+// sondeo, de updated_at), del más antiguo al más reciente
+func listDriveFiles(client *http.Client, accessToken string, item Integration) ([]connectorFile, string, error) {
+	since := item.cursor
+	if since == "" {
+		since = item.UpdatedAt.UTC().Format(driveTimeFormat)
+	}
+	query := url.Values{
+		"q":                         {fmt.Sprintf("'%s' in parents and trashed = false and createdTime > '%s'", strings.ReplaceAll(item.FolderID, "'", `\'`), since)},
+		"orderBy":                   {"createdTime"},
+		"pageSize":                  {strconv.Itoa(connectorPageSize)},
+		"fields":                    {"files(id,name,size,createdTime)"},
+		"supportsAllDrives":         {"true"},
+		"includeItemsFromAllDrives": {"true"},
+	}
+	req, err := http.NewRequest(http.MethodGet, providerAPIURL(ProviderGoogleDrive)+"/drive/v3/files?"+query.Encode(), nil)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "invalid provider request")
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	var out struct {
+		Files []struct {
+			ID          string `json:"id"`
+			Name        string `json:"name"`
+			Size        string `json:"size"` // int64 en texto
+			CreatedTime string `json:"createdTime"`
+		} `json:"files"`
+	}
+	if err := doProviderRequest(client, req, &out); err != nil {
+		return nil, "", err
+	}
+	var files []connectorFile
+	cursor := since
+	for _, f := range out.Files {
+		if created, err := time.Parse(time.RFC3339, f.CreatedTime); err == nil {
+			if c := created.UTC().Format(driveTimeFormat); c > cursor {
+				cursor = c
+			}
+		}
+		if !isIngestMedia(f.Name) {
+			continue
+		}
+		size, _ := strconv.ParseInt(f.Size, 10, 64)
+		files = append(files, connectorFile{ID: f.ID, Name: f.Name, Size: size})
+	}
+	return files, cursor, nil
+}
+
+// Cambios de la carpeta desde el cursor. El primer sondeo lista la carpeta
+// y se queda con lo modificado después de updated_at.
+func listDropboxFiles(client *http.Client, accessToken string, item Integration) ([]connectorFile, string, error) {
+	endpoint, body := "/2/files/list_folder/continue", map[string]interface{}{"cursor": item.cursor}
+	if item.cursor == "" {
+		endpoint, body = "/2/files/list_folder", map[string]interface{}{"path": item.Path, "limit": connectorPageSize}
+	}
+	req, err := dropboxRequest(providerAPIURL(ProviderDropbox)+endpoint, accessToken, body)
+	if err != nil {
+		return nil, "", err
+	}
+	var out struct {
+		Entries []struct {
+			Tag            string    `json:".tag"`
+			ID             string    `json:"id"`
+			Name           string    `json:"name"`
+			PathDisplay    string    `json:"path_display"`
+			Size           int64     `json:"size"`
+			ServerModified time.Time `json:"server_modified"`
+		} `json:"entries"`
+		Cursor string `json:"cursor"`
+	}
+	if err := doProviderRequest(client, req, &out); err != nil {
+		return nil, "", err
+	}
+	var files []connectorFile
+	for _, e := range out.Entries {
+		if e.Tag != "file" || !isIngestMedia(e.Name) || (item.cursor == "" && !e.ServerModified.After(item.UpdatedAt)) {
+			continue
+		}
+		files = append(files, connectorFile{ID: e.ID, Name: e.Name, Path: e.PathDisplay, Size: e.Size})
+	}
+	return files, out.Cursor, nil
+}
+
+func dropboxRequest(endpoint, accessToken string, body interface{}) (*http.Request, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal Dropbox request")
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid provider request")
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// Dropbox-API-Arg: JSON con lo que no es ASCII escapado, como exige la
+// cabecera
+func dropboxArg(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal Dropbox-API-Arg")
+	}
+	var b strings.Builder
+	for _, r := range string(data) {
+		if r < 0x80 {
+			b.WriteRune(r)
+			continue
+		}
+		for _, u := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(&b, `\u%04x`, u)
+		}
+	}
+	return b.String(), nil
+}
+
+// Copia el archivo al almacén como una subida y crea su job
+func ingestConnectorFile(ctx context.Context, accessToken string, item Integration, f connectorFile) error {
+	jobID := uuid.NewSHA1(connectorNamespace, []byte(item.ID+"/"+f.ID)).String()
+	if sourcedJobExists(jobID) {
+		return nil
+	}
+	if cfg.MaxDownloadMB > 0 && f.Size > cfg.MaxDownloadMB*1024*1024 {
+		log.Printf("⚠️ %s supera %d MB, no se procesa (integración %s)", f.Name, cfg.MaxDownloadMB, item.ID)
+		return nil
+	}
+	input := RequestBody{}
+	if item.Template != "" {
+		if _, err := applyTemplate(item.tenant, item.Template, &input); err != nil {
+			return err
+		}
+	}
+
+	var req *http.Request
+	var err error
+	switch item.Provider {
+	case ProviderGoogleDrive:
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet,
+			providerAPIURL(ProviderGoogleDrive)+"/drive/v3/files/"+url.PathEscape(f.ID)+"?alt=media&supportsAllDrives=true", nil)
+	case ProviderDropbox:
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(cfg.DropboxContentURL, "/")+"/2/files/download", nil)
+		if err == nil {
+			var arg string
+			if arg, err = dropboxArg(map[string]string{"path": f.ID}); err == nil {
+				req.Header.Set("Dropbox-API-Arg", arg)
+			}
+		}
+	}
+	if err != nil {
+		return errors.Wrap(err, "invalid provider request")
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := (&http.Client{Timeout: cfg.DownloadTimeout.Duration}).Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to download file")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return &providerError{status: resp.StatusCode, body: strings.TrimSpace(string(data))}
+	}
+	size := resp.ContentLength
+	if size < 0 {
+		size = f.Size
+	}
+	uploadID, err := stageSourceMedia(ctx, item.tenant, path.Ext(f.Name), resp.Body, size)
+	if err != nil {
+		return err
+	}
+
+	input.Type = JobTypeTranscription
+	input.URL = ""
+	input.UploadID = uploadID
+	input.Metadata = map[string]string{"integration_id": item.ID}
+	if len(f.Name) <= maxMetadataValueLength {
+		input.Metadata["file_name"] = f.Name
+	}
+	source := &jobSource{Kind: item.Provider, Key: f.ID, Integration: item.ID, Folder: item.FolderID, Name: f.Name}
+	if item.Provider == ProviderDropbox {
+		source.Key = f.Path
+	}
+	if createSourcedJob(jobID, item.tenant, input, source) {
+		jobLogf(jobID, "🚀 Job %s creado desde %s", jobID, source)
+	}
+	return nil
+}
+
+// Escribe junto al archivo de origen el .txt o el .srt del job
+func writeConnectorFile(job JobState, meta jobMeta, format string) (string, error) {
+	item, ok := integrations.lookup(meta.Source.Integration)
+	if !ok || !item.Enabled {
+		return "", errOutboxDiscard
+	}
+	var content, contentType string
+	switch format {
+	case "txt":
+		content = integrationExport{Text: job.Transcription, Translation: job.Translation}.body()
+		contentType = "text/plain; charset=utf-8"
+	case "srt":
+		content = renderSRT(buildCues(job.Segments, defaultSubtitleOptions().merge(meta.Input.Subtitles)))
+		contentType = "application/x-subrip; charset=utf-8"
+	default:
+		return "", errOutboxDiscard
+	}
+	name := siblingName(meta.Source.Name, format)
+
+	client := &http.Client{Timeout: cfg.IntegrationTimeout.Duration}
+	err := withAccessToken(client, item, func(accessToken string) error {
+		switch item.Provider {
+		case ProviderGoogleDrive:
+			metadata := map[string]interface{}{"name": name, "parents": []string{meta.Source.Folder}}
+			_, err := uploadDriveFile(client, accessToken, metadata, contentType, content)
+			return err
+		case ProviderDropbox:
+			name = path.Join(path.Dir(meta.Source.Key), name)
+			arg, err := dropboxArg(map[string]interface{}{"path": name, "mode": "overwrite", "mute": true})
+			if err != nil {
+				return err
+			}
+			req, err := http.NewRequest(http.MethodPost, strings.TrimRight(cfg.DropboxContentURL, "/")+"/2/files/upload", strings.NewReader(content))
+			if err != nil {
+				return errors.Wrap(err, "invalid provider request")
+			}
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+			req.Header.Set("Content-Type", "application/octet-stream")
+			req.Header.Set("Dropbox-API-Arg", arg)
+			return doProviderRequest(client, req, nil)
+		}
+		return errOutboxDiscard
+	})
+	if err != nil {
+		if err == errOutboxDiscard {
+			return "", err
+		}
+		return "", errors.Wrapf(err, "write %s to %s", name, item.Provider)
+	}
+	return fmt.Sprintf("wrote %s to %s", name, item.Provider), nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var processStarted = time.Now()
+
+// Diagnóstico en producción: solo con autenticación activa, porque sin
+// keys el servicio está abierto y los perfiles revelan memoria del proceso
+func debugAllowed(c *gin.Context) bool {
+	if !authEnabled() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "debug endpoints require authentication to be enabled", "code": "FORBIDDEN"})
+		return false
+	}
+	return true
+}
+
+// GET /admin/debug/pprof/*profile sirve net/http/pprof bajo /admin: el
+// índice, profile (CPU, ?seconds=), trace, cmdline, symbol y los perfiles
+// con nombre (heap, goroutine, allocs, block, mutex, threadcreate)
+func pprofHandler(c *gin.Context) {
+	if !debugAllowed(c) {
+		return
+	}
+	switch name := strings.TrimPrefix(c.Param("profile"), "/"); name {
+	case "":
+		// pprof.Index solo reconoce el prefijo /debug/pprof/; aquí siempre
+		// pinta el índice, con enlaces relativos
+		pprof.Index(c.Writer, c.Request)
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Handler(name).ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// Estadísticas del runtime y de los mapas en memoria del servicio
+type RuntimeStats struct {
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds float64   `json:"uptime_seconds"`
+	GoVersion     string    `json:"go_version"`
+	PID           int       `json:"pid"`
+	CPUs          int       `json:"cpus"`
+	Goroutines    int       `json:"goroutines"`
+
+	// Memoria (runtime.MemStats)
+	HeapAllocBytes  uint64     `json:"heap_alloc_bytes"`
+	HeapInuseBytes  uint64     `json:"heap_inuse_bytes"`
+	HeapObjects     uint64     `json:"heap_objects"`
+	SysBytes        uint64     `json:"sys_bytes"`
+	TotalAllocBytes uint64     `json:"total_alloc_bytes"`
+	NumGC           uint32     `json:"num_gc"`
+	LastGCPauseMS   float64    `json:"last_gc_pause_ms"`
+	GCCPUFraction   float64    `json:"gc_cpu_fraction"`
+	NextGCBytes     uint64     `json:"next_gc_bytes"`
+	LastGC          *time.Time `json:"last_gc,omitempty"`
+
+	// Estado de esta réplica
+	Jobs           int `json:"jobs"`            // entradas en el mapa de jobs
+	JobEvents      int `json:"job_events"`      // eventos de todos los historiales
+	WorkersBusy    int `json:"workers_busy"`    // jobs con un worker asignado
+	WorkersWaiting int `json:"workers_waiting"` // jobs esperando un worker
+	Preprocessing  int `json:"preprocessing"`   // jobs preparando su medio
+}
+
+// GET /admin/debug/vars devuelve goroutines, heap, GC y el tamaño de los
+// mapas de jobs de esta réplica, para seguir su crecimiento
+func runtimeStatsHandler(c *gin.Context) {
+	if !debugAllowed(c) {
+		return
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats := RuntimeStats{
+		StartedAt:       processStarted,
+		UptimeSeconds:   round2(time.Since(processStarted).Seconds()),
+		GoVersion:       runtime.Version(),
+		PID:             os.Getpid(),
+		CPUs:            runtime.NumCPU(),
+		Goroutines:      runtime.NumGoroutine(),
+		HeapAllocBytes:  mem.HeapAlloc,
+		HeapInuseBytes:  mem.HeapInuse,
+		HeapObjects:     mem.HeapObjects,
+		SysBytes:        mem.Sys,
+		TotalAllocBytes: mem.TotalAlloc,
+		NumGC:           mem.NumGC,
+		GCCPUFraction:   mem.GCCPUFraction,
+		NextGCBytes:     mem.NextGC,
+	}
+	if mem.NumGC > 0 {
+		stats.LastGCPauseMS = float64(mem.PauseNs[(mem.NumGC+255)%256]) / 1e6
+		last := time.Unix(0, int64(mem.LastGC))
+		stats.LastGC = &last
+	}
+
+	mu.RLock()
+	stats.Jobs = len(jobStore)
+	for _, events := range jobEvents {
+		stats.JobEvents += len(events)
+	}
+	mu.RUnlock()
+	if jobScheduler != nil {
+		stats.WorkersBusy = jobScheduler.busyCount()
+		stats.WorkersWaiting = jobScheduler.waitingCount()
+	}
+	stats.Preprocessing = len(preprocessSlots)
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, stats)
+}
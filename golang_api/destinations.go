@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/pkg/errors"
+)
+
+// Artefactos que se copian a los almacenes, en este orden
+var destinationFormats = []string{"txt", "srt", "json"}
+
+// Subtítulos de emisión que se copian solo si se piden en formats
+var destinationCaptionFormats = []string{"ttml", "scc"}
+
+// Artefacto que se copia a un almacén
+type destinationFile struct {
+	Key         string // ruta relativa según path_template
+	Content     []byte
+	ContentType string
+}
+
+// Ruta de los artefactos si la integración no tiene path_template
+const defaultDestinationPath = "transcripts/{date}/{job_id}.{ext}"
+
+var destinationPathPattern = regexp.MustCompile(`^[A-Za-z0-9_.{}/-]{1,512}$`)
+
+var s3BucketPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+func validateDestinationIntegration(item *Integration) error {
+	switch item.Provider {
+	case ProviderS3, ProviderGCS:
+		if !s3BucketPattern.MatchString(item.Bucket) {
+			return errors.Errorf("bucket is required for %s", item.Provider)
+		}
+		if item.AccessKeyID == "" {
+			return errors.Errorf("access_key_id is required for %s", item.Provider)
+		}
+		if item.Provider == ProviderS3 && item.Endpoint != "" {
+			if _, err := validateMediaURL(item.Endpoint); err != nil {
+				return errors.Wrap(err, "invalid endpoint")
+			}
+		}
+	case ProviderAzureBlob:
+		u, err := validateMediaURL(item.URL)
+		if err != nil {
+			return errors.Wrap(err, "invalid url")
+		}
+		if strings.Trim(u.Path, "/") == "" || u.RawQuery != "" {
+			return errors.New("url must be the container URL, without the SAS (that goes in access_token)")
+		}
+	case ProviderWebDAV:
+		if _, err := validateMediaURL(item.URL); err != nil {
+			return errors.Wrap(err, "invalid url")
+		}
+	case ProviderSFTP:
+		u, err := url.Parse(item.URL)
+		if err != nil || u.Scheme != "sftp" || u.Hostname() == "" || u.RawQuery != "" {
+			return errors.New("url must be sftp://host[:port]/directory")
+		}
+		if _, ok := u.User.Password(); ok {
+			return errors.New("sftp URLs must not embed a password; store credentials with PUT /sftp/credentials/{host}")
+		}
+		if item.token.AccessToken != "" {
+			return errors.New("access_token is not supported for sftp; store credentials with PUT /sftp/credentials/{host}")
+		}
+	}
+	if t := item.PathTemplate; t != "" {
+		if !destinationPathPattern.MatchString(t) || strings.HasPrefix(t, "/") || strings.Contains(t, "..") {
+			return errors.New("path_template must be a relative path of letters, digits, '_', '-', '.' and '/'")
+		}
+		if !strings.Contains(t, "{job_id}") || !strings.Contains(t, "{ext}") {
+			return errors.New("path_template must contain {job_id} and {ext}")
+		}
+	}
+	seen := make(map[string]bool)
+	for _, f := range item.Formats {
+		known := false
+		for _, name := range append(destinationFormats, destinationCaptionFormats...) {
+			known = known || f == name
+		}
+		if seen[f] || !known {
+			return errors.New("formats must list txt, srt, json, ttml or scc once each")
+		}
+		seen[f] = true
+	}
+	if item.token.RefreshToken != "" {
+		return errors.Errorf("refresh_token is not supported for %s", item.Provider)
+	}
+	return nil
+}
+
+// Clave (o ruta relativa) del artefacto según la plantilla de la integración
+func destinationPath(item Integration, jobID string, job JobState, ext string) string {
+	template := item.PathTemplate
+	if template == "" {
+		template = defaultDestinationPath
+	}
+	return strings.NewReplacer(
+		"{job_id}", jobID,
+		"{date}", job.Timestamp.UTC().Format("2006-01-02"),
+		"{ext}", ext,
+	).Replace(template)
+}
+
+// Copia los artefactos del job al almacén y devuelve adónde. Se vuelven a
+// copiar todos en cada intento: sobrescribir es idempotente.
+func deliverToDestination(item Integration, doc integrationExport) (string, error) {
+	job, ok := getJob(doc.JobID)
+	if !ok || job.PurgedAt != nil {
+		return "", errOutboxDiscard
+	}
+	meta, _ := getJobMeta(doc.JobID)
+	formats := item.Formats
+	if len(formats) == 0 {
+		formats = destinationFormats
+	}
+	var files []destinationFile
+	for _, format := range formats {
+		var content []byte
+		var contentType string
+		switch format {
+		case "txt":
+			content = []byte(integrationExport{Text: job.Transcription, Translation: job.Translation}.body())
+			contentType = "text/plain; charset=utf-8"
+		case "srt", "ttml", "scc":
+			if len(job.Segments) == 0 {
+				continue
+			}
+			var err error
+			content, contentType, err = renderSubtitles(job, format, defaultSubtitleOptions().merge(meta.Input.Subtitles))
+			if err != nil {
+				// p. ej. scc con un frame_rate de 25 en el job
+				jobLogf(doc.JobID, "⚠️ %s no se copia a la integración %s: %v", format, item.ID, err)
+				continue
+			}
+		case "json":
+			// El mismo objeto que GET /result/:job_id
+			data, err := json.Marshal(job)
+			if err != nil {
+				return "", errOutboxDiscard
+			}
+			content, contentType = data, "application/json; charset=utf-8"
+		}
+		files = append(files, destinationFile{Key: destinationPath(item, doc.JobID, job, format), Content: content, ContentType: contentType})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.IntegrationTimeout.Duration)
+	defer cancel()
+	if item.Provider == ProviderSFTP {
+		// Una sola sesión para todos los archivos
+		u, err := url.Parse(item.URL)
+		if err != nil {
+			return "", errOutboxDiscard
+		}
+		written, err := pushSFTP(ctx, item.tenant, u, files)
+		return strings.Join(written, ", "), err
+	}
+	var written []string
+	for _, f := range files {
+		location, err := putDestinationObject(ctx, item, f.Key, f.Content, f.ContentType)
+		if err != nil {
+			return "", errors.Wrapf(err, "copy %s", f.Key)
+		}
+		written = append(written, location)
+	}
+	return strings.Join(written, ", "), nil
+}
+
+func putDestinationObject(ctx context.Context, item Integration, key string, content []byte, contentType string) (string, error) {
+	switch item.Provider {
+	case ProviderS3, ProviderGCS:
+		endpoint, scheme := item.Endpoint, "s3://"
+		if item.Provider == ProviderGCS {
+			endpoint, scheme = cfg.GCSEndpoint, "gs://"
+		}
+		client, err := destinationS3Client(item, endpoint)
+		if err != nil {
+			return "", err
+		}
+		_, err = client.PutObject(ctx, item.Bucket, key, bytes.NewReader(content), int64(len(content)), minio.PutObjectOptions{ContentType: contentType})
+		if err != nil {
+			return "", errors.Wrap(err, "failed to upload object")
+		}
+		return scheme + item.Bucket + "/" + key, nil
+	case ProviderAzureBlob:
+		// Put Blob con el SAS del contenedor; el SAS no se devuelve
+		link := item.URL + "/" + escapeDestinationPath(key)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, link+"?"+strings.TrimPrefix(item.token.AccessToken, "?"), bytes.NewReader(content))
+		if err != nil {
+			return "", errors.Wrap(err, "invalid provider request")
+		}
+		req.Header.Set("x-ms-blob-type", "BlockBlob")
+		req.Header.Set("Content-Type", contentType)
+		return link, doProviderRequest(&http.Client{Timeout: cfg.IntegrationTimeout.Duration}, req, nil)
+	case ProviderWebDAV:
+		client := &http.Client{Timeout: cfg.IntegrationTimeout.Duration}
+		// Las colecciones intermedias se crean con MKCOL; 405 es que ya existen
+		dir := ""
+		for _, segment := range strings.Split(path.Dir(key), "/") {
+			if segment == "." {
+				break
+			}
+			dir += "/" + url.PathEscape(segment)
+			req, err := webDAVRequest(ctx, item, "MKCOL", item.URL+dir, nil, "")
+			if err != nil {
+				return "", err
+			}
+			perr, ok := errors.Cause(doProviderRequest(client, req, nil)).(*providerError)
+			if ok && perr.status != http.StatusMethodNotAllowed {
+				return "", perr
+			}
+		}
+		link := item.URL + "/" + escapeDestinationPath(key)
+		req, err := webDAVRequest(ctx, item, http.MethodPut, link, content, contentType)
+		if err != nil {
+			return "", err
+		}
+		return link, doProviderRequest(client, req, nil)
+	}
+	return "", errOutboxDiscard
+}
+
+// Cliente de S3 para el endpoint (vacío = AWS); gcs usa la interoperabilidad
+// con claves HMAC
+func destinationS3Client(item Integration, endpoint string) (*minio.Client, error) {
+	host, secure := "s3.amazonaws.com", true
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			return nil, errors.New("invalid storage endpoint")
+		}
+		host, secure = u.Host, u.Scheme == "https"
+	}
+	client, err := minio.New(host, &minio.Options{
+		Creds:  credentials.NewStaticV4(item.AccessKeyID, item.token.AccessToken, ""),
+		Secure: secure,
+		Region: item.Region,
+	})
+	return client, errors.Wrap(err, "failed to create S3 client")
+}
+
+func webDAVRequest(ctx context.Context, item Integration, method, link string, content []byte, contentType string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, link, bytes.NewReader(content))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid provider request")
+	}
+	if item.Username != "" || item.token.AccessToken != "" {
+		req.SetBasicAuth(item.Username, item.token.AccessToken)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+func escapeDestinationPath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
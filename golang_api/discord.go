@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Interactions endpoint URL de la aplicación de Discord; no lleva API key,
+// la autentica la firma Ed25519
+const discordInteractionsPath = "/integrations/discord"
+
+// Tamaño máximo del cuerpo de una interacción
+const maxDiscordInteractionBytes = 1 << 20
+
+var discordSnowflakePattern = regexp.MustCompile(`^[0-9]{1,20}$`)
+
+// Tipos de interacción y de respuesta de Discord que se usan
+const (
+	discordInteractionPing    = 1
+	discordInteractionCommand = 2
+
+	discordResponsePong    = 1
+	discordResponseMessage = 4 // CHANNEL_MESSAGE_WITH_SOURCE
+	discordEphemeral       = 64
+)
+
+// Comando que se registra al crear la integración
+var discordTranscribeCommand = map[string]interface{}{
+	"name":        "transcribe",
+	"description": "Transcribe an audio file or link; the transcript is posted in a thread",
+	"options": []map[string]interface{}{
+		{"type": 11, "name": "audio", "description": "Audio or video file"},
+		{"type": 3, "name": "url", "description": "Link to the audio"},
+	},
+}
+
+type discordUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+type discordAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+}
+
+type discordInteraction struct {
+	ID            string `json:"id"`
+	ApplicationID string `json:"application_id"`
+	Type          int    `json:"type"`
+	GuildID       string `json:"guild_id"`
+	ChannelID     string `json:"channel_id"`
+	Member        *struct {
+		User discordUser `json:"user"`
+	} `json:"member"`
+	Data struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string          `json:"name"`
+			Value json.RawMessage `json:"value"`
+		} `json:"options"`
+		Resolved struct {
+			Attachments map[string]discordAttachment `json:"attachments"`
+		} `json:"resolved"`
+	} `json:"data"`
+}
+
+func (i *discordInteraction) option(name string) string {
+	for _, o := range i.Data.Options {
+		var v string
+		if o.Name == name && json.Unmarshal(o.Value, &v) == nil {
+			return v
+		}
+	}
+	return ""
+}
+
+// Firma X-Signature-Ed25519 del timestamp seguido del cuerpo con la clave
+// pública de la aplicación
+func validDiscordSignature(publicKey, timestamp string, body []byte, signature string) bool {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return false
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(ed25519.PublicKey(key), append([]byte(timestamp), body...), sig)
+}
+
+func validateDiscordIntegration(item *Integration) error {
+	if !discordSnowflakePattern.MatchString(item.ApplicationID) {
+		return errors.New("application_id is required for discord")
+	}
+	if key, err := hex.DecodeString(item.PublicKey); err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("public_key must be the application's Ed25519 public key in hex")
+	}
+	if item.token.AccessToken == "" || item.token.RefreshToken != "" {
+		return errors.New("discord requires the bot token as access_token and no refresh_token")
+	}
+	return nil
+}
+
+func discordReply(c *gin.Context, content string, flags int) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"type": discordResponseMessage, "data": gin.H{
+		"content":          content,
+		"flags":            flags,
+		"allowed_mentions": gin.H{"parse": []string{}},
+	}})
+}
+
+// POST /integrations/discord recibe las interacciones de la aplicación. La
+// firma se comprueba con la public_key de las integraciones discord de la
+// aplicación. /transcribe con un audio adjunto o un enlace crea un job de
+// transcripción y, al terminar, el bot publica el texto en un hilo del
+// canal.
+func discordInteractionsHandler(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxDiscordInteractionBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Discord interaction", "code": "INVALID_REQUEST"})
+		return
+	}
+	timestamp, signature := c.GetHeader("X-Signature-Timestamp"), c.GetHeader("X-Signature-Ed25519")
+	var item *Integration
+	if interaction.ApplicationID != "" {
+		for _, candidate := range integrations.accounts(ProviderDiscord, interaction.ApplicationID) {
+			if validDiscordSignature(candidate.PublicKey, timestamp, body, signature) {
+				candidate := candidate
+				item = &candidate
+				break
+			}
+		}
+	}
+	if item == nil {
+		// Discord también prueba el endpoint con firmas inválidas
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid Discord signature", "code": "FORBIDDEN"})
+		return
+	}
+
+	switch {
+	case interaction.Type == discordInteractionPing:
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.JSON(http.StatusOK, gin.H{"type": discordResponsePong})
+		return
+	case interaction.Type != discordInteractionCommand || interaction.Data.Name != "transcribe":
+		discordReply(c, "Unknown command.", discordEphemeral)
+		return
+	case interaction.GuildID == "":
+		discordReply(c, "Use /transcribe in a server channel: the transcript is posted in a thread.", discordEphemeral)
+		return
+	}
+
+	msg := botMessage{
+		ChatID:    interaction.ChannelID,
+		MessageID: interaction.ID,
+		Metadata:  map[string]string{"discord_guild_id": interaction.GuildID, "discord_channel_id": interaction.ChannelID},
+	}
+	if interaction.Member != nil {
+		msg.Metadata["discord_user"] = interaction.Member.User.Username
+	}
+	if attachment, ok := interaction.Data.Resolved.Attachments[interaction.option("audio")]; ok {
+		name := headerSafe(path.Base(attachment.Filename))
+		mediaType, _, _ := mime.ParseMediaType(attachment.ContentType)
+		if !isIngestMedia(name) && !strings.HasPrefix(mediaType, "audio/") && !strings.HasPrefix(mediaType, "video/") {
+			discordReply(c, "The attachment is not an audio or video file.", discordEphemeral)
+			return
+		}
+		if path.Ext(name) == "" {
+			name += botAudioExtension(attachment.ContentType)
+		}
+		msg.MediaID, msg.FileName, msg.Size = attachment.URL, name, attachment.Size
+	} else if link := interaction.option("url"); link != "" {
+		// Solo http(s): los sftp:// usarían las credenciales del tenant
+		u, err := validateMediaURL(link)
+		if err != nil {
+			discordReply(c, "Invalid link: "+err.Error(), discordEphemeral)
+			return
+		}
+		msg.URL, msg.FileName = u.String(), "audio"
+		if base := headerSafe(path.Base(u.Path)); base != "/" && base != "." {
+			msg.FileName = base
+		}
+	} else {
+		discordReply(c, "Attach an audio file or give a link.", discordEphemeral)
+		return
+	}
+	msg.Metadata["file_name"] = msg.FileName
+
+	jobID, err := createBotJob(*item, msg)
+	if err != nil {
+		log.Printf("⚠️ /transcribe del canal %s no procesado (integración %s): %v", interaction.ChannelID, item.ID, err)
+		discordReply(c, "Could not transcribe: "+err.Error(), discordEphemeral)
+		return
+	}
+	discordReply(c, "Transcribing "+msg.FileName+" (job "+jobID+"). The transcript will be posted in a thread.", 0)
+}
+
+// API de Discord con el token del bot (access_token)
+type discordAdapter struct{}
+
+func discordRequest(ctx context.Context, item Integration, method, endpoint string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal Discord request")
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(cfg.DiscordAPIURL, "/")+endpoint, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "invalid provider request")
+	}
+	req.Header.Set("Authorization", "Bot "+item.token.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+	return doProviderRequest(&http.Client{Timeout: cfg.IntegrationTimeout.Duration}, req, out)
+}
+
+// Registra (o actualiza) /transcribe como comando global de la aplicación
+func registerDiscordCommand(item Integration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.IntegrationTimeout.Duration)
+	defer cancel()
+	err := discordRequest(ctx, item, http.MethodPost, "/applications/"+item.ApplicationID+"/commands", discordTranscribeCommand, nil)
+	return errors.Wrap(err, "failed to register the /transcribe command")
+}
+
+// Los adjuntos se descargan de su enlace firmado de la CDN, sin token
+func (discordAdapter) FetchMedia(ctx context.Context, item Integration, source *jobSource) (io.ReadCloser, int64, error) {
+	if u, err := url.Parse(source.Media); err != nil || (u.Scheme != "https" && !strings.HasPrefix(cfg.DiscordAPIURL, u.Scheme+"://")) {
+		return nil, 0, errors.New("invalid Discord attachment URL")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.Media, nil)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "invalid provider request")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to download attachment")
+	}
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		return nil, 0, &providerError{status: resp.StatusCode, body: strings.TrimSpace(string(data))}
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (discordAdapter) MessageLimit() int { return 2000 }
+
+// Abre un hilo en el canal del comando y publica en él la respuesta; si el
+// canal no admite hilos (p. ej. ya es uno), la publica en el canal
+func (discordAdapter) Reply(ctx context.Context, item Integration, source *jobSource, parts []string) error {
+	name := []rune("Transcript: " + source.Name)
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	thread := struct {
+		ID string `json:"id"`
+	}{ID: source.ReplyTo}
+	err := discordRequest(ctx, item, http.MethodPost, "/channels/"+source.ReplyTo+"/threads", map[string]interface{}{
+		"name":                  string(name),
+		"type":                  11, // PUBLIC_THREAD
+		"auto_archive_duration": 1440,
+	}, &thread)
+	if perr, ok := errors.Cause(err).(*providerError); ok && perr.status == http.StatusBadRequest {
+		thread.ID = source.ReplyTo
+	} else if err != nil {
+		return err
+	}
+	for _, text := range parts {
+		err := discordRequest(ctx, item, http.MethodPost, "/channels/"+thread.ID+"/messages", map[string]interface{}{
+			"content":          text,
+			"allowed_mentions": map[string]interface{}{"parse": []string{}},
+		}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Progreso de la descarga realizada por el gateway
+type DownloadProgress struct {
+	BytesDownloaded int64  `json:"bytes_downloaded"`
+	TotalBytes      int64  `json:"total_bytes,omitempty"` // 0 si el servidor no informa el tamaño
+	Attempts        int    `json:"attempts"`
+	SHA256          string `json:"sha256,omitempty"`
+}
+
+// Resultado de una descarga completa
+type downloadResult struct {
+	Path   string // ruta local en el gateway
+	SHA256 string
+	Size   int64
+}
+
+// Intervalo mínimo entre actualizaciones de progreso en el jobStore
+const progressInterval = 500 * time.Millisecond
+
+// URL de medio aceptable: http(s) con host
+func validateMediaURL(rawURL string) (*url.URL, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid URL format")
+	}
+	if parsedURL.Scheme != "https" && parsedURL.Scheme != "http" {
+		return nil, errors.New("URL must use http or https scheme")
+	}
+	if parsedURL.Host == "" {
+		return nil, errors.New("URL must have a valid host")
+	}
+	return parsedURL, nil
+}
+
+// Indica si la URL debe descargarla el gateway o delegarse al backend.
+// Pedir sha256 obliga a descargar en el gateway para poder verificarlo, y
+// sftp:// solo lo descarga el gateway.
+func gatewayShouldDownload(u *url.URL, input RequestBody) bool {
+	if u.Scheme == "sftp" {
+		return true
+	}
+	if !cfg.GatewayDownload && input.SHA256 == "" {
+		return false
+	}
+	return !isBackendFetchHost(u)
+}
+
+// Hosts que requieren yt-dlp en el backend (no son medios directos)
+func isBackendFetchHost(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	for _, h := range cfg.BackendFetchHost {
+		h = strings.ToLower(h)
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// Valida el campo sha256 antes de aceptar el job
+func validateChecksumRequest(input RequestBody) error {
+	if input.SHA256 == "" {
+		return nil
+	}
+	if _, err := hex.DecodeString(input.SHA256); err != nil || len(input.SHA256) != sha256.Size*2 {
+		return errors.New("sha256 must be a 64-character hex string")
+	}
+	if u, err := url.Parse(input.URL); err == nil && isBackendFetchHost(u) {
+		return errors.New("sha256 verification requires a direct media URL")
+	}
+	return nil
+}
+
+// Convierte una ruta local del gateway a la ruta equivalente en el backend
+func backendPath(localPath string) string {
+	rel, err := filepath.Rel(cfg.DownloadDir, localPath)
+	if err != nil {
+		return localPath
+	}
+	return filepath.ToSlash(filepath.Join(cfg.BackendMediaDir, rel))
+}
+
+// Descarga el medio al volumen compartido con reanudación por Range,
+// reintentos y sha256 del archivo final. Los sftp:// usan las credenciales
+// del tenant.
+func downloadMedia(jobID, tenant, rawURL string) (*downloadResult, error) {
+	dir := filepath.Join(cfg.DownloadDir, jobID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed to create download directory")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DownloadTimeout.Duration)
+	defer cancel()
+
+	partPath := filepath.Join(dir, "source.part")
+	var lastErr error
+	var contentType string
+
+	for attempt := 1; attempt <= cfg.DownloadRetries; attempt++ {
+		updateJob(jobID, func(job *JobState) {
+			if job.Download == nil {
+				job.Download = &DownloadProgress{}
+			}
+			job.Download.Attempts = attempt
+		})
+
+		if u, err := url.Parse(rawURL); err == nil && u.Scheme == "sftp" {
+			lastErr = fetchSFTP(ctx, jobID, tenant, u, partPath)
+		} else {
+			contentType, lastErr = fetchRange(ctx, jobID, rawURL, partPath)
+		}
+		if lastErr == nil {
+			break
+		}
+		if ctx.Err() != nil || !retryableDownload(lastErr) {
+			break
+		}
+		jobLogf(jobID, "⚠️ Descarga del job %s interrumpida (intento %d): %v", jobID, attempt, lastErr)
+		recordEvent(jobID, JobEvent{Type: EventRetry, Code: "DOWNLOAD_FAILED", Message: lastErr.Error()})
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+
+	sum, size, err := hashFile(partPath)
+	if err != nil {
+		return nil, err
+	}
+
+	finalPath := filepath.Join(dir, "source"+mediaExtension(rawURL, contentType))
+	if err := os.Rename(partPath, finalPath); err != nil {
+		return nil, errors.Wrap(err, "failed to finalize download")
+	}
+
+	updateJob(jobID, func(job *JobState) {
+		if job.Download != nil {
+			job.Download.BytesDownloaded = size
+			job.Download.SHA256 = sum
+		}
+	})
+
+	return &downloadResult{Path: finalPath, SHA256: sum, Size: size}, nil
+}
+
+var errTooLarge = errors.New("media exceeds maximum download size")
+
+// Respuesta HTTP no exitosa del servidor de medios
+type mediaStatusError struct {
+	code int
+}
+
+func (e *mediaStatusError) Error() string {
+	return fmt.Sprintf("media server responded with status %d", e.code)
+}
+
+// Los 4xx (salvo 408 y 429), el exceso de tamaño y un archivo SFTP que no
+// existe o no se puede leer no se arreglan reintentando
+func retryableDownload(err error) bool {
+	switch cause := errors.Cause(err).(type) {
+	case *mediaStatusError:
+		return cause.code >= 500 || cause.code == http.StatusRequestTimeout || cause.code == http.StatusTooManyRequests
+	case *sftpStatusError:
+		return cause.code != sftpStatusNoSuchFile && cause.code != sftpStatusPermissionDenied
+	default:
+		return cause != errTooLarge && cause != errNoSFTPCredential
+	}
+}
+
+// Descarga (o continúa) el archivo parcial. Devuelve el Content-Type recibido.
+func fetchRange(ctx context.Context, jobID, rawURL, partPath string) (string, error) {
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build download request")
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to download media")
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// El servidor ignoró el Range: se empieza desde cero
+		offset = 0
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// El archivo parcial ya estaba completo
+		return resp.Header.Get("Content-Type"), nil
+	default:
+		return "", &mediaStatusError{code: resp.StatusCode}
+	}
+
+	total := int64(0)
+	if resp.ContentLength > 0 {
+		total = offset + resp.ContentLength
+	}
+	maxBytes := cfg.MaxDownloadMB * 1024 * 1024
+	if maxBytes > 0 && total > maxBytes {
+		return "", errTooLarge
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0o644)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to open download file")
+	}
+	defer file.Close()
+
+	written := offset
+	lastReport := time.Time{}
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err := file.Write(buf[:n]); err != nil {
+				return "", errors.Wrap(err, "failed to write download file")
+			}
+			written += int64(n)
+			if maxBytes > 0 && written > maxBytes {
+				return "", errTooLarge
+			}
+			if time.Since(lastReport) >= progressInterval {
+				reportDownloadProgress(jobID, written, total)
+				lastReport = time.Now()
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return "", errors.Wrap(readErr, "download interrupted")
+		}
+	}
+	reportDownloadProgress(jobID, written, total)
+
+	return resp.Header.Get("Content-Type"), nil
+}
+
+func reportDownloadProgress(jobID string, written, total int64) {
+	updateJob(jobID, func(job *JobState) {
+		if job.Download == nil {
+			return
+		}
+		job.Download.BytesDownloaded = written
+		if total > 0 {
+			job.Download.TotalBytes = total
+		}
+	})
+}
+
+func hashFile(p string) (string, int64, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "failed to open downloaded media")
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "failed to hash downloaded media")
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// El backend valida por extensión, así que se conserva la de la URL o se
+// deduce del Content-Type.
+func mediaExtension(rawURL, contentType string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		if ext := strings.ToLower(path.Ext(u.Path)); ext != "" && len(ext) <= 5 {
+			return ext
+		}
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch mediaType {
+		case "audio/mpeg":
+			return ".mp3"
+		case "audio/wav", "audio/x-wav", "audio/wave":
+			return ".wav"
+		case "audio/mp4", "audio/x-m4a":
+			return ".m4a"
+		case "audio/ogg":
+			return ".ogg"
+		case "audio/flac", "audio/x-flac":
+			return ".flac"
+		}
+	}
+	return ".bin"
+}
+
+// Medio ya descargado en una ejecución anterior del job (p. ej. antes de un
+// reinicio). Devuelve nil si hay que descargarlo.
+func reuseDownloadedMedia(jobID string) (*downloadResult, error) {
+	meta, _ := getJobMeta(jobID)
+	if meta.MediaPath == "" {
+		return nil, nil
+	}
+	sum, size, err := hashFile(meta.MediaPath)
+	if err != nil {
+		return nil, nil
+	}
+	return &downloadResult{Path: meta.MediaPath, SHA256: sum, Size: size}, nil
+}
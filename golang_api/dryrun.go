@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Estados de un check de POST /process?dry_run=true
+const (
+	DryRunOK      = "ok"
+	DryRunWarn    = "warn"    // el job se crearía, pero conviene revisarlo
+	DryRunFail    = "fail"    // el job se rechazaría o fallaría
+	DryRunSkipped = "skipped" // no aplica o no se puede comprobar sin ejecutar el job
+)
+
+type DryRunCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Code    string `json:"code,omitempty"` // el código con el que fallaría el job
+	Message string `json:"message,omitempty"`
+}
+
+// Lo que haría POST /process con la petición, sin crear el job
+type DryRunResult struct {
+	DryRun              bool          `json:"dry_run"`
+	OK                  bool          `json:"ok"` // ningún check en fail
+	Type                string        `json:"type"`
+	Model               string        `json:"model,omitempty"`   // modelo que recibiría el backend; vacío = el suyo por defecto
+	Backend             string        `json:"backend,omitempty"` // el que se elegiría ahora
+	Cache               bool          `json:"cache,omitempty"`   // el job nacería completado desde la caché
+	GatewayDownload     bool          `json:"gateway_download"`
+	ContentType         string        `json:"content_type,omitempty"`
+	Media               *MediaProbe   `json:"media,omitempty"`
+	Lane                string        `json:"lane,omitempty"`
+	Chunked             bool          `json:"chunked,omitempty"`
+	EstimatedGPUMinutes float64       `json:"estimated_gpu_minutes,omitempty"`
+	Checks              []DryRunCheck `json:"checks"`
+
+	// Key de sandbox: el job se resolvería con el backend de prueba
+	Sandbox bool `json:"sandbox,omitempty"`
+
+	// Regla de backend_routing que elegiría los backends
+	RoutingRule string `json:"routing_rule,omitempty"`
+}
+
+func (r *DryRunResult) check(name, status, code, message string) {
+	r.Checks = append(r.Checks, DryRunCheck{Name: name, Status: status, Code: code, Message: message})
+	if status == DryRunFail {
+		r.OK = false
+	}
+}
+
+func isDryRun(c *gin.Context) (bool, error) {
+	raw := c.Query("dry_run")
+	if raw == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, errors.New("dry_run must be true or false")
+	}
+	return dryRun, nil
+}
+
+// Respuesta de POST /process?dry_run=true, ya pasada la validación de la
+// petición: comprueba lo que el job haría en segundo plano (URL, medio,
+// cupo de la key) y cómo se ejecutaría
+func dryRunProcess(c *gin.Context, input RequestBody) {
+	ctx := c.Request.Context()
+	tenant := currentTenant(c)
+	result := &DryRunResult{DryRun: true, OK: true, Type: input.Type, Model: input.Model, Checks: []DryRunCheck{}}
+	result.Sandbox = currentAPIKey(c).sandbox()
+
+	dryRunQuota(result, currentAPIKey(c))
+	if queuePaused() {
+		result.check("queue", DryRunWarn, "QUEUE_PAUSED", "the queue is paused: the job would wait in queued until it resumes")
+	} else {
+		result.check("queue", DryRunOK, "", "")
+	}
+	if input.Type == JobTypeBurnSubtitles {
+		// El medio y el backend son los del job de la transcripción
+		writeDryRun(c, result)
+		return
+	}
+
+	custom, _ := lookupModel(tenant, input.Model) // ya validado
+	if custom != nil {
+		result.Model = custom.backendModel()
+		result.Backend = custom.Backend
+	} else {
+		dryRunRouting(result, tenant, input, 0)
+	}
+	if input.Language != "" && !languageCodePattern.MatchString(strings.ToLower(input.Language)) {
+		result.check("language", DryRunWarn, "", fmt.Sprintf("%q is not a language code such as en or yo; the backend may reject it", input.Language))
+	} else {
+		result.check("language", DryRunOK, "", "")
+	}
+	if input.SHA256 == "" && !result.Sandbox {
+		if cached, ok := cache.get(ctx, input); ok && languageAllowed(input.OnlyIfLanguage, cached.Language) {
+			result.Cache = true
+		}
+	}
+
+	parsedURL, err := validateJobMediaURL(input.URL)
+	if err != nil {
+		result.check("url", DryRunFail, "INVALID_URL", err.Error())
+		writeDryRun(c, result)
+		return
+	}
+	result.check("url", DryRunOK, "", "")
+	if result.Sandbox {
+		dryRunSandbox(result, input)
+		writeDryRun(c, result)
+		return
+	}
+	result.GatewayDownload = gatewayShouldDownload(parsedURL, input)
+	if parsedURL.Scheme == "sftp" || isBackendFetchHost(parsedURL) {
+		message := "media from this host is fetched by the backend"
+		if parsedURL.Scheme == "sftp" {
+			message = "sftp media is only read when the job runs"
+		}
+		result.check("reachable", DryRunSkipped, "", message)
+		result.check("media", DryRunSkipped, "", message)
+		result.Lane = laneFor(0)
+		result.EstimatedGPUMinutes = round2(estimateGPUMinutes(0, PythonRequest{Model: result.Model, Accuracy: input.Accuracy}))
+		writeDryRun(c, result)
+		return
+	}
+
+	contentType, err := dryRunFetch(ctx, input.URL)
+	if err != nil {
+		result.check("reachable", DryRunFail, "DOWNLOAD_FAILED", err.Error())
+		writeDryRun(c, result)
+		return
+	}
+	result.check("reachable", DryRunOK, "", "")
+	result.ContentType = contentType
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && !isMediaContentType(mediaType) {
+		result.check("content_type", DryRunWarn, "", fmt.Sprintf("content type %s is not audio or video", mediaType))
+	} else {
+		result.check("content_type", DryRunOK, "", "")
+	}
+
+	probe, err := probeMedia(ctx, input.URL)
+	switch {
+	case errors.Is(err, errNoAudioStream):
+		result.check("media", DryRunFail, "UNSUPPORTED_MEDIA", err.Error())
+	case err != nil:
+		// El job seguiría sin duración: sin lane corto ni troceo
+		result.check("media", DryRunWarn, "PROBE_FAILED", err.Error())
+	default:
+		result.check("media", DryRunOK, "", "")
+		if custom == nil {
+			// Las reglas pueden mirar la duración
+			dryRunRouting(result, tenant, input, probe.DurationSeconds)
+		}
+		probe.Model = input.Model
+		probe.EstimatedSeconds = round2(probe.DurationSeconds * realtimeFactor(result.Model))
+		result.Media = probe
+	}
+	var duration float64
+	if result.Media != nil {
+		duration = result.Media.DurationSeconds
+	}
+	result.Lane = laneFor(duration)
+	result.Chunked = result.GatewayDownload && shouldChunk(input.URL, duration)
+	result.EstimatedGPUMinutes = round2(estimateGPUMinutes(duration, PythonRequest{Model: result.Model, Accuracy: input.Accuracy}))
+	writeDryRun(c, result)
+}
+
+// Modelo, backend y regla según backend_routing. Sin sondear, una regla con
+// duración no se cumple, como en el job.
+func dryRunRouting(result *DryRunResult, tenant string, input RequestBody, duration float64) {
+	decision := route(RoutingInput{
+		Tenant:   tenant,
+		Language: input.Language,
+		Model:    input.Model,
+		Duration: duration,
+		Accuracy: input.Accuracy,
+		Diarize:  input.Diarize,
+	})
+	result.RoutingRule = decision.Rule
+	result.Model = input.Model
+	if decision.Model != "" {
+		result.Model = decision.Model
+	}
+	result.Backend = backends.peekIn(decision.Backends)
+}
+
+// Con una key de sandbox no se descarga ni se sondea nada: el resultado
+// depende solo de la petición
+func dryRunSandbox(result *DryRunResult, input RequestBody) {
+	result.Backend = sandboxBackend
+	result.check("reachable", DryRunSkipped, "", "sandbox jobs do not fetch media")
+	if code, message, ok := sandboxError(input.URL); ok {
+		result.check("media", DryRunFail, code, message)
+		return
+	}
+	result.check("media", DryRunSkipped, "", "sandbox jobs do not fetch media")
+	_, duration := sandboxResponse(input)
+	result.Lane = laneFor(duration)
+}
+
+func writeDryRun(c *gin.Context, result *DryRunResult) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, result)
+}
+
+// Cupo de jobs simultáneos de la key, sin tomarlo
+func dryRunQuota(result *DryRunResult, key *APIKey) {
+	limit := key.concurrencyLimit()
+	if limit == 0 {
+		result.check("quota", DryRunOK, "", "")
+		return
+	}
+	active, waiting := jobLimiter.usage(key.Name)
+	switch {
+	case active < limit && waiting == 0:
+		result.check("quota", DryRunOK, "", "")
+	case live().ConcurrencyLimitMode == LimitModeReject && cfg.Role != RoleAPI:
+		result.check("quota", DryRunFail, "CONCURRENCY_LIMIT", fmt.Sprintf("API key already has %d jobs in progress", limit))
+	default:
+		result.check("quota", DryRunWarn, "CONCURRENCY_LIMIT", fmt.Sprintf("API key has %d jobs in progress and %d waiting: the job would wait in queued", active, waiting))
+	}
+}
+
+// Pide el primer byte del medio: responde el servidor y con qué tipo
+func dryRunFetch(ctx context.Context, rawURL string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.ProbeTimeout.Duration)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build download request")
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to download media")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return "", &mediaStatusError{code: resp.StatusCode}
+	}
+	if maxBytes := cfg.MaxDownloadMB * 1024 * 1024; maxBytes > 0 && responseMediaSize(resp) > maxBytes {
+		return "", errTooLarge
+	}
+	return resp.Header.Get("Content-Type"), nil
+}
+
+// Tamaño total del medio según Content-Range (o Content-Length si el
+// servidor ignoró el Range); 0 si no lo dice
+func responseMediaSize(resp *http.Response) int64 {
+	if resp.StatusCode == http.StatusOK {
+		return resp.ContentLength
+	}
+	contentRange := resp.Header.Get("Content-Range")
+	if i := strings.LastIndex(contentRange, "/"); i >= 0 {
+		if size, err := strconv.ParseInt(contentRange[i+1:], 10, 64); err == nil {
+			return size
+		}
+	}
+	return 0
+}
+
+// Tipos con los que suelen servirse medios; el resto (text/html de una
+// página de login...) no suele ser el archivo
+func isMediaContentType(mediaType string) bool {
+	if strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/") {
+		return true
+	}
+	switch mediaType {
+	case "application/octet-stream", "application/ogg", "application/mp4", "binary/octet-stream",
+		"application/vnd.apple.mpegurl", "application/x-mpegurl", "application/dash+xml":
+		return true
+	}
+	return false
+}
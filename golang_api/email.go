@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Ruta del inbound parse (SendGrid) o la route (Mailgun); no lleva API key,
+// la autentica la firma
+const emailInboundPath = "/integrations/email"
+
+// Tamaño máximo del correo, audios por correo, remitentes admitidos por
+// integración y antigüedad máxima de la firma de Mailgun
+const (
+	maxInboundEmailBytes = 64 << 20
+	maxEmailAttachments  = 5
+	maxAllowedSenders    = 20
+	mailgunTimestampSkew = 5 * time.Minute
+)
+
+// Los IDs de los jobs salen del Message-Id, para que un reenvío del
+// proveedor no cree otro job
+var emailNamespace = uuid.MustParse("5e1b7c24-93a0-4d6f-8b2e-71c4f9a0d358")
+
+// Campos del correo que usan los dos proveedores
+type inboundEmail struct {
+	Recipients []string
+	From       string
+	Subject    string
+	MessageID  string
+}
+
+func validateEmailIntegration(item *Integration) error {
+	if addr, err := mail.ParseAddress(item.Address); err != nil || addr.Address != item.Address {
+		return errors.New("address must be an email address")
+	}
+	if len(item.AllowedSenders) == 0 || len(item.AllowedSenders) > maxAllowedSenders {
+		return errors.Errorf("allowed_senders must list 1 to %d addresses or @domains", maxAllowedSenders)
+	}
+	for _, s := range item.AllowedSenders {
+		if strings.HasPrefix(s, "@") {
+			if len(s) == 1 || strings.ContainsAny(s[1:], "@ ") {
+				return errors.Errorf("invalid allowed sender %q", s)
+			}
+		} else if _, err := mail.ParseAddress(s); err != nil {
+			return errors.Errorf("invalid allowed sender %q", s)
+		}
+	}
+	if item.token.WebhookSecret == "" {
+		return errors.New("webhook_secret is required for email")
+	}
+	if item.token.AccessToken != "" || item.token.RefreshToken != "" {
+		return errors.New("access_token and refresh_token are not supported for email")
+	}
+	if cfg.SMTPAddr == "" {
+		return errors.New("email requires SMTP_ADDR to send the transcripts")
+	}
+	return nil
+}
+
+// Remitente admitido: una de las direcciones o de uno de los dominios
+func (h *Integration) allowsSender(from string) bool {
+	from = strings.ToLower(from)
+	for _, s := range h.AllowedSenders {
+		s = strings.ToLower(s)
+		if from == s || (strings.HasPrefix(s, "@") && strings.HasSuffix(from, s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Firma de Mailgun (HMAC-SHA256 de timestamp y token con la signing key) o,
+// en SendGrid, la contraseña de la autenticación básica de su URL
+func validInboundEmail(secret string, r *http.Request) bool {
+	form := r.MultipartForm.Value
+	if signature := firstValue(form, "signature"); signature != "" {
+		timestamp := firstValue(form, "timestamp")
+		if !freshUnixTimestamp(timestamp, mailgunTimestampSkew) {
+			return false
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + firstValue(form, "token")))
+		return hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(signature))
+	}
+	_, password, ok := r.BasicAuth()
+	return ok && subtle.ConstantTimeCompare([]byte(password), []byte(secret)) == 1
+}
+
+func firstValue(form map[string][]string, key string) string {
+	if v := form[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Destinatarios, remitente, asunto y Message-Id de los campos de Mailgun
+// (recipient, from, subject, Message-Id) o de SendGrid (envelope, to, from,
+// subject, headers)
+func parseInboundEmail(form map[string][]string) inboundEmail {
+	var e inboundEmail
+	var recipients []string
+	if r := firstValue(form, "recipient"); r != "" {
+		recipients = strings.Split(r, ",")
+	}
+	var envelope struct {
+		To []string `json:"to"`
+	}
+	if json.Unmarshal([]byte(firstValue(form, "envelope")), &envelope) == nil {
+		recipients = append(recipients, envelope.To...)
+	}
+	if len(recipients) == 0 {
+		if list, err := mail.ParseAddressList(firstValue(form, "to")); err == nil {
+			for _, addr := range list {
+				recipients = append(recipients, addr.Address)
+			}
+		}
+	}
+	for _, r := range recipients {
+		if addr, err := mail.ParseAddress(strings.TrimSpace(r)); err == nil {
+			e.Recipients = append(e.Recipients, strings.ToLower(addr.Address))
+		}
+	}
+	if addr, err := mail.ParseAddress(firstValue(form, "from")); err == nil {
+		e.From = strings.ToLower(addr.Address)
+	}
+	e.Subject = headerSafe(firstValue(form, "subject"))
+	e.MessageID = firstValue(form, "Message-Id")
+	if e.MessageID == "" {
+		headers := strings.TrimRight(firstValue(form, "headers"), "\r\n") + "\r\n\r\n"
+		if msg, err := mail.ReadMessage(strings.NewReader(headers)); err == nil {
+			e.MessageID = msg.Header.Get("Message-Id")
+		}
+	}
+	e.MessageID = headerSafe(e.MessageID)
+	return e
+}
+
+// Sin saltos de línea, que permitirían añadir cabeceras a la respuesta
+func headerSafe(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// POST /integrations/email recibe los correos de la dirección de una
+// integración email desde el inbound parse de SendGrid o una route de
+// Mailgun. Cada audio adjunto de un remitente admitido crea un job y, al
+// terminar, se responde al remitente con la transcripción (o el error).
+// Lo que no se procesa responde 204 para que el proveedor no lo reintente.
+func emailInboundHandler(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxInboundEmailBytes)
+	if err := c.Request.ParseMultipartForm(8 << 20); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer c.Request.MultipartForm.RemoveAll()
+	email := parseInboundEmail(c.Request.MultipartForm.Value)
+	var item *Integration
+	for _, recipient := range email.Recipients {
+		for _, candidate := range integrations.accounts(ProviderEmail, recipient) {
+			if validInboundEmail(candidate.token.WebhookSecret, c.Request) {
+				candidate := candidate
+				item = &candidate
+				break
+			}
+		}
+		if item != nil {
+			break
+		}
+	}
+	if item == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid inbound email signature", "code": "FORBIDDEN"})
+		return
+	}
+	if !item.allowsSender(email.From) {
+		log.Printf("⚠️ Correo de %q ignorado: remitente no admitido en la integración %s", email.From, item.ID)
+		c.Status(http.StatusNoContent)
+		return
+	}
+	jobIDs, err := ingestEmail(c.Request.Context(), *item, email, c.Request.MultipartForm.File)
+	if err != nil {
+		log.Printf("❌ Correo %s no procesado (integración %s): %v", email.MessageID, item.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STORAGE_FAILED"})
+		return
+	}
+	if len(jobIDs) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"job_ids": jobIDs})
+}
+
+// Crea un job por cada audio adjunto (hasta maxEmailAttachments), salvo los
+// que ya existan. Devuelve sus IDs.
+func ingestEmail(ctx context.Context, item Integration, email inboundEmail, files map[string][]*multipart.FileHeader) ([]string, error) {
+	fields := make([]string, 0, len(files))
+	for field := range files {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	messageID := email.MessageID
+	if messageID == "" {
+		// Sin Message-Id no se puede reconocer un reenvío
+		messageID = uuid.NewString()
+	}
+	var jobIDs []string
+	for _, field := range fields {
+		for i, fh := range files[field] {
+			name := headerSafe(path.Base(strings.ReplaceAll(fh.Filename, "\\", "/")))
+			if !isIngestMedia(name) {
+				continue
+			}
+			if len(jobIDs) == maxEmailAttachments {
+				log.Printf("⚠️ Correo %s: solo se transcriben %d adjuntos", messageID, maxEmailAttachments)
+				return jobIDs, nil
+			}
+			if cfg.MaxDownloadMB > 0 && fh.Size > cfg.MaxDownloadMB*1024*1024 {
+				log.Printf("⚠️ Correo %s: adjunto %s ignorado: %v", messageID, name, errTooLarge)
+				continue
+			}
+			jobID := uuid.NewSHA1(emailNamespace, []byte(fmt.Sprintf("%s/%s/%s/%d", item.ID, messageID, field, i))).String()
+			if sourcedJobExists(jobID) {
+				jobIDs = append(jobIDs, jobID)
+				continue
+			}
+			input := RequestBody{}
+			if item.Template != "" {
+				if _, err := applyTemplate(item.tenant, item.Template, &input); err != nil {
+					return jobIDs, err
+				}
+			}
+			f, err := fh.Open()
+			if err != nil {
+				return jobIDs, errors.Wrap(err, "failed to read attachment")
+			}
+			uploadID, err := stageSourceMedia(ctx, item.tenant, path.Ext(name), f, fh.Size)
+			f.Close()
+			if err != nil {
+				return jobIDs, err
+			}
+
+			input.Type = JobTypeTranscription
+			input.URL = ""
+			input.UploadID = uploadID
+			input.Metadata = map[string]string{"integration_id": item.ID, "email_from": email.From}
+			for k, v := range map[string]string{"email_subject": email.Subject, "file_name": name} {
+				if v != "" && len(v) <= maxMetadataValueLength {
+					input.Metadata[k] = v
+				}
+			}
+			source := &jobSource{Kind: ProviderEmail, Key: email.MessageID, Integration: item.ID, Name: name, ReplyTo: email.From}
+			if createSourcedJob(jobID, item.tenant, input, source) {
+				jobLogf(jobID, "🚀 Job %s creado desde %s", jobID, source)
+			}
+			jobIDs = append(jobIDs, jobID)
+		}
+	}
+	return jobIDs, nil
+}
+
+// Adjunto de la respuesta
+type emailAttachment struct {
+	Name        string
+	ContentType string
+	Content     string
+}
+
+// Un intento de respuesta desde el outbox: la transcripción en el cuerpo y
+// en .txt y, si hay segmentos, .srt adjuntos; o el error del job
+func sendEmailReply(job JobState, meta jobMeta, event string) (string, error) {
+	item, ok := integrations.lookup(meta.Source.Integration)
+	if !ok || !item.Enabled || cfg.SMTPAddr == "" || meta.Source.ReplyTo == "" {
+		return "", errOutboxDiscard
+	}
+	from := cfg.SMTPFrom
+	if from == "" {
+		from = item.Address
+	}
+	subject := "Transcription of " + meta.Source.Name
+	if s := job.Metadata["email_subject"]; s != "" {
+		subject = s
+		if !strings.HasPrefix(strings.ToLower(s), "re:") {
+			subject = "Re: " + s
+		}
+	}
+	var text string
+	var attachments []emailAttachment
+	if event == WebhookJobFailed {
+		reason := job.Error
+		if reason == "" {
+			reason = job.Status
+		}
+		text = fmt.Sprintf("The transcription of %s failed: %s\n", meta.Source.Name, reason)
+	} else {
+		text = integrationExport{Text: job.Transcription, Translation: job.Translation}.body()
+		attachments = append(attachments, emailAttachment{Name: siblingName(meta.Source.Name, "txt"), ContentType: "text/plain; charset=utf-8", Content: text})
+		if len(job.Segments) > 0 {
+			srt := renderSRT(buildCues(job.Segments, defaultSubtitleOptions().merge(meta.Input.Subtitles)))
+			attachments = append(attachments, emailAttachment{Name: siblingName(meta.Source.Name, "srt"), ContentType: "application/x-subrip; charset=utf-8", Content: srt})
+		}
+	}
+	msg, err := buildEmail(from, meta.Source.ReplyTo, subject, meta.Source.Key, text, attachments)
+	if err != nil {
+		return "", errOutboxDiscard
+	}
+	if err := sendSMTP(from, meta.Source.ReplyTo, msg); err != nil {
+		return "", err
+	}
+	return "emailed the result to " + meta.Source.ReplyTo, nil
+}
+
+// Mensaje multipart/mixed con el texto y los adjuntos en base64; con
+// inReplyTo queda en el hilo del correo original
+func buildEmail(from, to, subject, inReplyTo, text string, attachments []emailAttachment) ([]byte, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	writePart := func(header textproto.MIMEHeader, content string) error {
+		header.Set("Content-Transfer-Encoding", "base64")
+		part, err := w.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		encoded := base64.StdEncoding.EncodeToString([]byte(content))
+		for len(encoded) > 76 {
+			if _, err := part.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+				return err
+			}
+			encoded = encoded[76:]
+		}
+		_, err = part.Write([]byte(encoded + "\r\n"))
+		return err
+	}
+	if err := writePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}}, text); err != nil {
+		return nil, err
+	}
+	for _, a := range attachments {
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})
+		if disposition == "" {
+			disposition = "attachment"
+		}
+		if err := writePart(textproto.MIMEHeader{"Content-Type": {a.ContentType}, "Content-Disposition": {disposition}}, a.Content); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = from[i+1:]
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-Id: <%s@%s>\r\n", uuid.NewString(), domain)
+	if inReplyTo != "" {
+		fmt.Fprintf(&msg, "In-Reply-To: %s\r\nReferences: %s\r\n", inReplyTo, inReplyTo)
+	}
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=%q\r\n\r\n", w.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// Envía el mensaje por SMTP_ADDR, con STARTTLS si el servidor lo anuncia y
+// usuario y contraseña si los hay
+func sendSMTP(from, to string, msg []byte) error {
+	host, _, err := net.SplitHostPort(cfg.SMTPAddr)
+	if err != nil {
+		return errors.Wrap(err, "invalid SMTP_ADDR")
+	}
+	conn, err := net.DialTimeout("tcp", cfg.SMTPAddr, cfg.IntegrationTimeout.Duration)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to SMTP server")
+	}
+	conn.SetDeadline(time.Now().Add(cfg.IntegrationTimeout.Duration))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return errors.Wrap(err, "failed to connect to SMTP server")
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return errors.Wrap(err, "SMTP STARTTLS failed")
+		}
+	}
+	if cfg.SMTPUsername != "" {
+		if err := client.Auth(smtp.PlainAuth("", cfg.SMTPUsername, liveSecret(&cfg.SMTPPassword), host)); err != nil {
+			return errors.Wrap(err, "SMTP authentication failed")
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return errors.Wrap(err, "SMTP MAIL FROM failed")
+	}
+	if err := client.Rcpt(to); err != nil {
+		return errors.Wrap(err, "SMTP RCPT TO failed")
+	}
+	w, err := client.Data()
+	if err != nil {
+		return errors.Wrap(err, "SMTP DATA failed")
+	}
+	if _, err := w.Write(msg); err != nil {
+		return errors.Wrap(err, "failed to send email")
+	}
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "failed to send email")
+	}
+	return client.Quit()
+}
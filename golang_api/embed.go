@@ -0,0 +1,152 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Extensiones que se reproducen con <video>; el resto con <audio>
+var embedVideoExtensions = map[string]bool{".mp4": true, ".m4v": true, ".webm": true, ".mov": true, ".ogv": true}
+
+type embedPage struct {
+	Doc      TranscriptDocument
+	Labels   sharedLabels
+	MediaURL string
+	Video    bool
+	Nonce    string
+}
+
+// Medio del reproductor: media_url debe ser http(s) absoluta. player=audio o
+// video fuerza el elemento; si no, se decide por la extensión.
+func embedMedia(c *gin.Context) (*url.URL, bool, error) {
+	raw := c.Query("media_url")
+	if raw == "" {
+		return nil, false, errors.New("media_url is required")
+	}
+	media, err := url.Parse(raw)
+	if err != nil || (media.Scheme != "http" && media.Scheme != "https") || media.Host == "" {
+		return nil, false, errors.New("media_url must be an absolute http(s) URL")
+	}
+	switch c.Query("player") {
+	case "audio":
+		return media, false, nil
+	case "video":
+		return media, true, nil
+	case "":
+		return media, embedVideoExtensions[strings.ToLower(path.Ext(media.Path))], nil
+	}
+	return nil, false, errors.New("player must be audio or video")
+}
+
+// Página con el reproductor y los segmentos: resalta el que suena y un clic
+// en un segmento salta a su inicio. El script lleva nonce y la CSP solo deja
+// cargar el medio de su origen.
+func renderEmbed(c *gin.Context, doc TranscriptDocument) {
+	media, video, err := embedMedia(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_REQUEST"})
+		return
+	}
+	page := embedPage{Doc: doc, Labels: pageLabels(c), MediaURL: media.String(), Video: video, Nonce: randomToken()}
+	var out strings.Builder
+	if err := embedPageTemplate.Execute(&out, page); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render transcript", "code": "RENDER_FAILED"})
+		return
+	}
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; script-src 'nonce-"+page.Nonce+"'; media-src "+
+		media.Scheme+"://"+media.Host+"; frame-ancestors "+cfg.EmbedFrameAncestors)
+	c.Header("Cache-Control", "private, no-store")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(out.String()))
+}
+
+// GET /jobs/:job_id/embed?media_url= devuelve la transcripción sincronizada
+// con el medio, para insertarla en un iframe. Sin API key en el iframe, el
+// enlace de /jobs/:job_id/share con format=embed.
+func embedHandler(c *gin.Context) {
+	jobID := c.Param("job_id")
+	job, exists := getJob(jobID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if job.Type != JobTypeTranscription || job.Status != "completed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "the transcript is only available for completed jobs"})
+		return
+	}
+	if job.PurgedAt != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "the transcript was deleted by the retention policy"})
+		return
+	}
+	renderEmbed(c, transcriptDocumentV1(jobID, job))
+}
+
+var embedPageTemplate = template.Must(template.New("embed").Funcs(template.FuncMap{"clock": clockTime}).Parse(`<!DOCTYPE html>
+<html{{with .Doc.Language}} lang="{{.}}"{{end}}>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex, nofollow">
+<title>{{.Labels.Title}}</title>
+<style>
+html, body { height: 100%; margin: 0; }
+body { display: flex; flex-direction: column; font-family: system-ui, sans-serif; line-height: 1.5; color: #222; }
+audio, video { width: 100%; flex: none; background: #000; }
+video { max-height: 60%; }
+#transcript { flex: 1; overflow-y: auto; padding: .5rem 1rem; }
+.segment { margin: .2rem 0; padding: .1rem .3rem; border-radius: .2rem; cursor: pointer; }
+.segment:hover { background: #f2f2f2; }
+.segment.active { background: #fff3b0; }
+time { color: #777; margin-right: .5rem; font-variant-numeric: tabular-nums; }
+.speaker { font-weight: 600; margin-right: .5rem; }
+</style>
+</head>
+<body>
+{{if .Video}}<video id="player" src="{{.MediaURL}}" controls preload="metadata" playsinline></video>
+{{else}}<audio id="player" src="{{.MediaURL}}" controls preload="metadata"></audio>
+{{end}}<div id="transcript">
+{{range .Doc.Segments}}<p class="segment" data-start="{{.Start}}" data-end="{{.End}}"><time>{{clock .Start}}</time>{{with .Speaker}}<span class="speaker">{{.}}</span>{{end}}{{.Text}}</p>
+{{else}}<p>{{.Doc.Text}}</p>
+{{end}}</div>
+<script nonce="{{.Nonce}}">
+(function () {
+  var player = document.getElementById("player");
+  var box = document.getElementById("transcript");
+  var segments = Array.prototype.slice.call(box.querySelectorAll(".segment"));
+  var active = null;
+  segments.forEach(function (el) {
+    el.addEventListener("click", function () {
+      player.currentTime = parseFloat(el.dataset.start);
+      player.play();
+    });
+  });
+  player.addEventListener("timeupdate", function () {
+    var t = player.currentTime, current = null;
+    for (var i = 0; i < segments.length; i++) {
+      if (t >= parseFloat(segments[i].dataset.start) && t < parseFloat(segments[i].dataset.end)) {
+        current = segments[i];
+        break;
+      }
+    }
+    if (current === active) return;
+    if (active) active.classList.remove("active");
+    if (current) {
+      current.classList.add("active");
+      // Solo se desplaza la lista: scrollIntoView movería también la página del CMS
+      var top = current.offsetTop - box.offsetTop;
+      if (top < box.scrollTop || top + current.offsetHeight > box.scrollTop + box.clientHeight) {
+        box.scrollTop = top - box.clientHeight / 3;
+      }
+    }
+    active = current;
+  });
+})();
+</script>
+</body>
+</html>
+`))
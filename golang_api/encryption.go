@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Prefijo de los valores cifrados: enc1:<clave de datos envuelta>.<nonce y texto cifrado>
+const sealedPrefix = "enc1:"
+
+// Cada proceso genera una clave de datos nueva por tenant pasado este tiempo
+const dataKeyLifetime = 24 * time.Hour
+
+// Máximo de claves de datos descifradas en memoria
+const maxOpenedDataKeys = 1000
+
+// Ámbito de la caché de resultados, compartida entre tenants
+const cacheScope = "cache"
+
+var errEncryptionNotConfigured = errors.New("encrypted data found but encryption is not configured")
+
+func tenantScope(tenant string) string {
+	return "tenant:" + tenant
+}
+
+func isSealed(s string) bool {
+	return strings.HasPrefix(s, sealedPrefix)
+}
+
+// Envuelve las claves de datos con la clave maestra, que nunca sale de
+// ENCRYPTION_MASTER_KEY o del KMS
+type keyWrapper interface {
+	Wrap(ctx context.Context, scope string, dataKey []byte) ([]byte, error)
+	Unwrap(ctx context.Context, scope string, wrapped []byte) ([]byte, error)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce y texto cifrado, con el ámbito como datos adicionales
+func gcmSeal(aead cipher.AEAD, scope string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, []byte(scope)), nil
+}
+
+func gcmOpen(aead cipher.AEAD, scope string, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(scope))
+}
+
+// Clave maestra local (ENCRYPTION_MASTER_KEY)
+type masterKeyWrapper struct {
+	aead cipher.AEAD
+}
+
+func (w *masterKeyWrapper) Wrap(ctx context.Context, scope string, dataKey []byte) ([]byte, error) {
+	return gcmSeal(w.aead, scope, dataKey)
+}
+
+func (w *masterKeyWrapper) Unwrap(ctx context.Context, scope string, wrapped []byte) ([]byte, error) {
+	dataKey, err := gcmOpen(w.aead, scope, wrapped)
+	return dataKey, errors.Wrap(err, "failed to unwrap data key (wrong ENCRYPTION_MASTER_KEY?)")
+}
+
+// Motor transit de Vault (u OpenBao): ENCRYPTION_KMS_URL es el punto de
+// montaje, p. ej. https://vault:8200/v1/transit
+type transitWrapper struct {
+	url    string
+	key    string
+	token  string
+	client *http.Client
+}
+
+func (w *transitWrapper) call(ctx context.Context, op string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url+"/"+op+"/"+w.key, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", w.token)
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "KMS %s failed", op)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return errors.Errorf("KMS %s returned %d: %s", op, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(out), "invalid KMS %s response", op)
+}
+
+func (w *transitWrapper) Wrap(ctx context.Context, scope string, dataKey []byte) ([]byte, error) {
+	var out struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	body := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dataKey)}
+	if err := w.call(ctx, "encrypt", body, &out); err != nil {
+		return nil, err
+	}
+	return []byte(out.Data.Ciphertext), nil
+}
+
+func (w *transitWrapper) Unwrap(ctx context.Context, scope string, wrapped []byte) ([]byte, error) {
+	var out struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := w.call(ctx, "decrypt", map[string]string{"ciphertext": string(wrapped)}, &out); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(out.Data.Plaintext)
+}
+
+type dataKey struct {
+	aead      cipher.AEAD
+	wrapped   []byte
+	createdAt time.Time
+}
+
+// Cifrado por sobres: cada valor va cifrado con la clave de datos de su
+// tenant y lleva esa clave envuelta, así que se descifra en cualquier
+// réplica sin un registro compartido de claves
+type envelope struct {
+	wrapper keyWrapper
+
+	mu      sync.Mutex
+	current map[string]*dataKey    // por ámbito, la que cifra
+	opened  map[string]cipher.AEAD // por clave envuelta, para descifrar sin llamar al KMS
+}
+
+// nil si no hay ENCRYPTION_MASTER_KEY ni ENCRYPTION_KMS_URL
+var encryption *envelope
+
+func newEnvelope() (*envelope, error) {
+	var wrapper keyWrapper
+	switch {
+	case cfg.EncryptionMasterKey != "":
+		key, err := base64.StdEncoding.DecodeString(cfg.EncryptionMasterKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid ENCRYPTION_MASTER_KEY")
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid ENCRYPTION_MASTER_KEY")
+		}
+		wrapper = &masterKeyWrapper{aead: aead}
+		log.Printf("🚀 Cifrado en reposo con clave maestra local")
+	case cfg.EncryptionKMSURL != "":
+		wrapper = &transitWrapper{
+			url:    strings.TrimRight(cfg.EncryptionKMSURL, "/"),
+			key:    cfg.EncryptionKMSKey,
+			token:  cfg.EncryptionKMSToken,
+			client: &http.Client{Timeout: 10 * time.Second},
+		}
+		log.Printf("🚀 Cifrado en reposo con el KMS %s (clave %s)", cfg.EncryptionKMSURL, cfg.EncryptionKMSKey)
+	default:
+		return nil, nil
+	}
+	return &envelope{wrapper: wrapper, current: make(map[string]*dataKey), opened: make(map[string]cipher.AEAD)}, nil
+}
+
+func kmsContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 15*time.Second)
+}
+
+// Clave de datos vigente del ámbito; crea y envuelve una nueva si no hay
+// o si ya cumplió dataKeyLifetime
+func (e *envelope) dataKey(scope string) (*dataKey, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if k, ok := e.current[scope]; ok && time.Since(k.createdAt) < dataKeyLifetime {
+		return k, nil
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, errors.Wrap(err, "failed to generate data key")
+	}
+	ctx, cancel := kmsContext()
+	defer cancel()
+	wrapped, err := e.wrapper.Wrap(ctx, scope, raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to wrap data key")
+	}
+	aead, err := newGCM(raw)
+	if err != nil {
+		return nil, err
+	}
+	k := &dataKey{aead: aead, wrapped: wrapped, createdAt: time.Now()}
+	e.current[scope] = k
+	return k, nil
+}
+
+func (e *envelope) seal(scope string, plaintext []byte) (string, error) {
+	k, err := e.dataKey(scope)
+	if err != nil {
+		return "", err
+	}
+	data, err := gcmSeal(k.aead, scope, plaintext)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encrypt")
+	}
+	return sealedPrefix + base64.RawURLEncoding.EncodeToString(k.wrapped) + "." + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func (e *envelope) open(scope, sealed string) ([]byte, error) {
+	if e == nil {
+		return nil, errEncryptionNotConfigured
+	}
+	wrappedText, dataText, ok := strings.Cut(strings.TrimPrefix(sealed, sealedPrefix), ".")
+	if !ok {
+		return nil, errors.New("malformed encrypted value")
+	}
+	wrapped, err := base64.RawURLEncoding.DecodeString(wrappedText)
+	if err != nil {
+		return nil, errors.New("malformed encrypted value")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(dataText)
+	if err != nil {
+		return nil, errors.New("malformed encrypted value")
+	}
+
+	cacheKey := scope + "\x00" + wrappedText
+	e.mu.Lock()
+	aead, ok := e.opened[cacheKey]
+	e.mu.Unlock()
+	if !ok {
+		ctx, cancel := kmsContext()
+		raw, err := e.wrapper.Unwrap(ctx, scope, wrapped)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		if aead, err = newGCM(raw); err != nil {
+			return nil, errors.Wrap(err, "invalid data key")
+		}
+		e.mu.Lock()
+		if len(e.opened) >= maxOpenedDataKeys {
+			e.opened = make(map[string]cipher.AEAD)
+		}
+		e.opened[cacheKey] = aead
+		e.mu.Unlock()
+	}
+	plaintext, err := gcmOpen(aead, scope, data)
+	return plaintext, errors.Wrap(err, "failed to decrypt")
+}
+
+// Texto de un job que se guarda cifrado
+type sealedTranscript struct {
+	Transcription string    `json:"transcription,omitempty"`
+	Translation   string    `json:"translation,omitempty"`
+	Segments      []Segment `json:"segments,omitempty"`
+	Chapters      []Chapter `json:"chapters,omitempty"`
+
+	Annotations []Annotation `json:"annotations,omitempty"` // de jobMeta
+}
+
+// Cifra el texto de los jobs (transcripción, traducción, segmentos,
+// capítulos, anotaciones, payloads del outbox y fragmentos) al guardarlo y lo descifra al
+// leerlo. Lee lo que se guardó sin cifrar; sin cifrado configurado solo pasa
+// los datos.
+type encryptedStateStore struct {
+	StateStore
+}
+
+func (s encryptedStateStore) SaveJob(rec JobRecord) error {
+	if encryption == nil {
+		return s.StateStore.SaveJob(rec)
+	}
+	scope := tenantScope(rec.Meta.Tenant)
+	if rec.Job.Transcription != "" || rec.Job.Translation != "" || len(rec.Job.Segments) > 0 || len(rec.Job.Chapters) > 0 || len(rec.Meta.Annotations) > 0 {
+		data, err := json.Marshal(sealedTranscript{rec.Job.Transcription, rec.Job.Translation, rec.Job.Segments, rec.Job.Chapters, rec.Meta.Annotations})
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal job state")
+		}
+		if rec.Meta.Sealed, err = encryption.seal(scope, data); err != nil {
+			return errors.Wrapf(err, "failed to encrypt job %s", rec.ID)
+		}
+		rec.Job.Transcription, rec.Job.Translation, rec.Job.Segments, rec.Job.Chapters = "", "", nil, nil
+		rec.Meta.Annotations = nil
+	}
+	if len(rec.Outbox) > 0 {
+		outbox := make([]OutboxMessage, len(rec.Outbox))
+		for i, msg := range rec.Outbox {
+			sealed, err := encryption.seal(scope, msg.Payload)
+			if err != nil {
+				return errors.Wrapf(err, "failed to encrypt job %s", rec.ID)
+			}
+			msg.Payload, _ = json.Marshal(sealed)
+			outbox[i] = msg
+		}
+		rec.Outbox = outbox
+	}
+	return s.StateStore.SaveJob(rec)
+}
+
+func openJobRecord(rec *JobRecord) error {
+	scope := tenantScope(rec.Meta.Tenant)
+	if rec.Meta.Sealed != "" {
+		data, err := encryption.open(scope, rec.Meta.Sealed)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decrypt job %s", rec.ID)
+		}
+		var text sealedTranscript
+		if err := json.Unmarshal(data, &text); err != nil {
+			return errors.Wrapf(err, "corrupt state for job %s", rec.ID)
+		}
+		rec.Job.Transcription, rec.Job.Translation, rec.Job.Segments = text.Transcription, text.Translation, text.Segments
+		rec.Job.Chapters, rec.Meta.Annotations = text.Chapters, text.Annotations
+		rec.Meta.Sealed = ""
+	}
+	for i, msg := range rec.Outbox {
+		var sealed string
+		if json.Unmarshal(msg.Payload, &sealed) != nil || !isSealed(sealed) {
+			continue
+		}
+		payload, err := encryption.open(scope, sealed)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decrypt outbox of job %s", rec.ID)
+		}
+		rec.Outbox[i].Payload = payload
+	}
+	return nil
+}
+
+func (s encryptedStateStore) LoadJobs(ctx context.Context) ([]JobRecord, error) {
+	records, err := s.StateStore.LoadJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opened := records[:0]
+	for _, rec := range records {
+		if err := openJobRecord(&rec); err != nil {
+			log.Printf("⚠️ No se pudo descifrar el job %s: %v", rec.ID, err)
+			continue
+		}
+		opened = append(opened, rec)
+	}
+	return opened, nil
+}
+
+func (s encryptedStateStore) LoadJob(ctx context.Context, jobID string) (*JobRecord, error) {
+	rec, err := s.StateStore.LoadJob(ctx, jobID)
+	if err != nil || rec == nil {
+		return rec, err
+	}
+	return rec, openJobRecord(rec)
+}
+
+func (s encryptedStateStore) ClaimJob(workerID string, lease time.Duration) (*JobRecord, *JobClaim, error) {
+	rec, expired, err := s.StateStore.ClaimJob(workerID, lease)
+	if err != nil || rec == nil {
+		return rec, expired, err
+	}
+	if err := openJobRecord(rec); err != nil {
+		// Sin soltar la concesión: otro worker con la clave correcta lo
+		// tomará cuando caduque
+		return nil, nil, err
+	}
+	return rec, expired, nil
+}
+
+// Tenant del job para los fragmentos, que no lo llevan
+func chunkScope(jobID string) string {
+	meta, _ := getJobMeta(jobID)
+	return tenantScope(meta.Tenant)
+}
+
+func (s encryptedStateStore) SaveChunk(jobID string, index int, result BackendResponse) error {
+	if encryption == nil {
+		return s.StateStore.SaveChunk(jobID, index, result)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal chunk result")
+	}
+	sealed, err := encryption.seal(chunkScope(jobID), data)
+	if err != nil {
+		return errors.Wrap(err, "failed to encrypt chunk result")
+	}
+	return s.StateStore.SaveChunk(jobID, index, BackendResponse{Transcription: sealed})
+}
+
+func (s encryptedStateStore) LoadChunks(jobID string) (map[int]BackendResponse, error) {
+	chunks, err := s.StateStore.LoadChunks(jobID)
+	if err != nil {
+		return nil, err
+	}
+	scope := chunkScope(jobID)
+	for index, result := range chunks {
+		if !isSealed(result.Transcription) {
+			continue
+		}
+		var opened BackendResponse
+		data, err := encryption.open(scope, result.Transcription)
+		if err == nil {
+			err = json.Unmarshal(data, &opened)
+		}
+		if err != nil {
+			// Como un fragmento corrupto: se vuelve a transcribir
+			delete(chunks, index)
+			continue
+		}
+		chunks[index] = opened
+	}
+	return chunks, nil
+}
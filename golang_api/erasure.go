@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Límites de tags y metadata de un job
+const (
+	maxJobTags             = 20
+	maxTagLength           = 64
+	maxMetadataEntries     = 20
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 256
+)
+
+func validateJobLabels(input RequestBody) error {
+	if len(input.Tags) > maxJobTags {
+		return errors.Errorf("at most %d tags are allowed", maxJobTags)
+	}
+	for _, tag := range input.Tags {
+		if tag == "" || len(tag) > maxTagLength {
+			return errors.Errorf("tags must be 1 to %d characters", maxTagLength)
+		}
+	}
+	if len(input.Metadata) > maxMetadataEntries {
+		return errors.Errorf("at most %d metadata entries are allowed", maxMetadataEntries)
+	}
+	for k, v := range input.Metadata {
+		if k == "" || len(k) > maxMetadataKeyLength {
+			return errors.Errorf("metadata keys must be 1 to %d characters", maxMetadataKeyLength)
+		}
+		if len(v) > maxMetadataValueLength {
+			return errors.Errorf("metadata values must be at most %d characters", maxMetadataValueLength)
+		}
+	}
+	return nil
+}
+
+// Criterios de un borrado; el job tiene que cumplirlos todos
+type ErasureRequest struct {
+	Tenant   string            `json:"tenant,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`     // el job lleva todas
+	Metadata map[string]string `json:"metadata,omitempty"` // con los mismos valores
+}
+
+func (r ErasureRequest) matches(meta jobMeta) bool {
+	if r.Tenant != "" && meta.Tenant != r.Tenant {
+		return false
+	}
+	for _, want := range r.Tags {
+		found := false
+		for _, tag := range meta.Input.Tags {
+			if tag == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for k, v := range r.Metadata {
+		if got, ok := meta.Input.Metadata[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Informe de un borrado. Signature es el HMAC-SHA256 (base64url) con
+// ERASURE_SIGNING_KEY del JSON del informe sin signature, tal como se
+// devuelve.
+type ErasureReport struct {
+	ID           string         `json:"id"`
+	RequestedAt  time.Time      `json:"requested_at"`
+	CompletedAt  time.Time      `json:"completed_at"`
+	RequestedBy  string         `json:"requested_by,omitempty"` // key que lo pidió
+	Criteria     ErasureRequest `json:"criteria"`
+	Jobs         []string       `json:"jobs"`              // borrados
+	Skipped      []string       `json:"skipped,omitempty"` // aún en curso; repetir al terminar
+	Artifacts    int            `json:"artifacts"`
+	Media        int            `json:"media"`
+	CacheEntries int            `json:"cache_entries"`
+	Signature    string         `json:"signature,omitempty"`
+}
+
+func (r *ErasureReport) sign() error {
+	r.Signature = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal erasure report")
+	}
+	mac := hmac.New(sha256.New, []byte(cfg.ErasureSigningKey))
+	mac.Write(data)
+	r.Signature = base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	return nil
+}
+
+// Olvida la copia en memoria de un job. Requiere mu tomado.
+func forgetJobLocked(jobID string) {
+	delete(jobStore, jobID)
+	delete(jobMetas, jobID)
+	delete(jobEvents, jobID)
+	delete(jobOutbox, jobID)
+	delete(unadoptedJobs, jobID)
+	delete(fencedJobs, jobID)
+	delete(releasedJobs, jobID)
+}
+
+// Borra todo lo del job: artefactos, medio, estado (con fragmentos y
+// outbox) y la copia en memoria
+func eraseJob(jobID string, report *ErasureReport) error {
+	job, _ := getJob(jobID)
+	meta, _ := getJobMeta(jobID)
+	for _, a := range job.Artifacts {
+		if err := artifacts.Delete(context.Background(), artifactKey(jobID, a.Name)); err != nil {
+			return err
+		}
+		report.Artifacts++
+	}
+	media, err := deleteJobMedia(jobID, meta)
+	report.Media += media
+	if err != nil {
+		return err
+	}
+	if stateStore != nil {
+		// Con saveMu no hay copias del job a medio guardar, y las pendientes
+		// se descartan abajo: no lo deben resucitar tras borrarlo
+		saveMu.Lock()
+		defer saveMu.Unlock()
+		if err := stateStore.DeleteJob(jobID); err != nil {
+			return err
+		}
+	}
+	mu.Lock()
+	dropPendingSavesLocked(jobID)
+	forgetJobLocked(jobID)
+	mu.Unlock()
+	return nil
+}
+
+// POST /admin/erasure borra los jobs de un interesado (por tenant, tags o
+// metadata) con sus artefactos, su medio y las entradas de caché de sus
+// URLs, y devuelve un informe firmado. Los jobs en curso no se tocan y se
+// listan en skipped.
+func erasureHandler(c *gin.Context) {
+	if cfg.ErasureSigningKey == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "erasure signing key is not configured", "code": "ERASURE_NOT_CONFIGURED"})
+		return
+	}
+	var input ErasureRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Tenant == "" && len(input.Tags) == 0 && len(input.Metadata) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "erasure requires tenant, tags or metadata", "code": "INVALID_REQUEST"})
+		return
+	}
+	// Una key de tenant solo borra en el suyo, también por tags o metadata
+	if !isOperator(c) {
+		if input.Tenant != "" && input.Tenant != currentTenant(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key cannot erase data of another tenant", "code": "FORBIDDEN"})
+			return
+		}
+		input.Tenant = currentTenant(c)
+	}
+
+	report := ErasureReport{ID: uuid.NewString(), RequestedAt: time.Now(), Criteria: input, Jobs: []string{}}
+	if key := currentAPIKey(c); key != nil {
+		report.RequestedBy = key.Name
+	}
+	if cfg.Role == RoleAPI {
+		// Los workers escriben los jobs; se parte del último estado
+		if abortOnDeadline(c, refreshAllJobs(c.Request.Context())) {
+			return
+		}
+	}
+	var matched []string
+	urls := make(map[string]bool)
+	mu.RLock()
+	for jobID, job := range jobStore {
+		meta, ok := jobMetas[jobID]
+		if !ok || !input.matches(*meta) {
+			continue
+		}
+		if !isTerminalStatus(job.Status) {
+			report.Skipped = append(report.Skipped, jobID)
+			continue
+		}
+		matched = append(matched, jobID)
+		if meta.Input.URL != "" {
+			urls[meta.Input.URL] = true
+		}
+	}
+	mu.RUnlock()
+	sort.Strings(matched)
+	sort.Strings(report.Skipped)
+
+	for _, jobID := range matched {
+		if err := eraseJob(jobID, &report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "ERASURE_FAILED", "erased_jobs": report.Jobs})
+			return
+		}
+		report.Jobs = append(report.Jobs, jobID)
+	}
+	if cache != nil {
+		for u := range urls {
+			n, err := cache.invalidate(c.Request.Context(), u, "", "", "")
+			report.CacheEntries += n
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "ERASURE_FAILED", "erased_jobs": report.Jobs})
+				return
+			}
+		}
+	}
+
+	report.CompletedAt = time.Now()
+	if err := report.sign(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "INTERNAL_ERROR"})
+		return
+	}
+	log.Printf("🚀 Borrado %s: %d jobs, %d artefactos, %d medios, %d entradas de caché (%d en curso sin borrar)",
+		report.ID, len(report.Jobs), report.Artifacts, report.Media, report.CacheEntries, len(report.Skipped))
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestErasureTenantScope(t *testing.T) {
+	cfg.ErasureSigningKey = "erasure-test-key"
+	cfg.DownloadDir = t.TempDir()
+	t.Cleanup(func() { cfg.ErasureSigningKey = "" })
+
+	seed := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for id, tenant := range map[string]string{"erase-acme": "acme", "erase-beta": "beta"} {
+			jobStore[id] = &JobState{Status: "completed", Timestamp: time.Now()}
+			jobMetas[id] = &jobMeta{Tenant: tenant, Input: RequestBody{Tags: []string{"subject-42"}}}
+		}
+	}
+	exists := func(id string) bool {
+		_, ok := getJob(id)
+		return ok
+	}
+	t.Cleanup(func() {
+		mu.Lock()
+		forgetJobLocked("erase-acme")
+		forgetJobLocked("erase-beta")
+		mu.Unlock()
+	})
+
+	tests := []struct {
+		name       string
+		role       string
+		body       string
+		wantStatus int
+		wantAcme   bool // sigue existiendo
+		wantBeta   bool
+	}{
+		{"tenant admin by tags", AccessAdmin, `{"tags": ["subject-42"]}`, http.StatusOK, false, true},
+		{"tenant admin for another tenant", AccessAdmin, `{"tenant": "beta"}`, http.StatusForbidden, true, true},
+		{"tenant admin for own tenant", AccessAdmin, `{"tenant": "acme", "tags": ["subject-42"]}`, http.StatusOK, false, true},
+		{"operator across tenants", AccessOperator, `{"tags": ["subject-42"]}`, http.StatusOK, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seed()
+			router := gin.New()
+			router.Use(func(c *gin.Context) { c.Set(ctxAPIKey, &APIKey{Name: "k", Tenant: "acme", Role: tt.role}) })
+			router.POST("/admin/erasure", erasureHandler)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/erasure", bytes.NewBufferString(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if exists("erase-acme") != tt.wantAcme || exists("erase-beta") != tt.wantBeta {
+				t.Errorf("after erasure acme exists = %t, beta exists = %t; want %t and %t",
+					exists("erase-acme"), exists("erase-beta"), tt.wantAcme, tt.wantBeta)
+			}
+		})
+	}
+}
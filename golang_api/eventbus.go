@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/segmentio/kafka-go"
+)
+
+// Versión del esquema de LifecycleEvent. Solo se añaden campos; renombrar o
+// quitar uno exige subir la versión.
+const lifecycleSchemaVersion = 1
+
+// Evento del ciclo de vida publicado en el bus, uno por transición de estado,
+// en <EventSubjectPrefix>.<estado> (transcribe.job.completed...)
+type LifecycleEvent struct {
+	SchemaVersion int       `json:"schema_version"`
+	ID            string    `json:"id"`
+	Type          string    `json:"type"` // igual al subject/topic
+	Time          time.Time `json:"time"`
+	JobID         string    `json:"job_id"`
+	Tenant        string    `json:"tenant,omitempty"`
+	Status        string    `json:"status"`
+	Message       string    `json:"message,omitempty"`
+	Job           JobState  `json:"job"`
+}
+
+// Destino de los eventos: NATS o Kafka
+type eventPublisher interface {
+	// key agrupa los mensajes de un mismo job (partición en Kafka)
+	Publish(ctx context.Context, subject, key string, data []byte) error
+}
+
+// nil = publicación deshabilitada
+var eventBus eventPublisher
+
+func newEventBus() (eventPublisher, error) {
+	switch cfg.EventBus {
+	case "":
+		return nil, nil
+	case "nats":
+		conn, err := nats.Connect(cfg.NATSURL, nats.Name("transcribe-gateway"), nats.MaxReconnects(-1))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to connect to NATS")
+		}
+		return &natsPublisher{conn: conn}, nil
+	case "kafka":
+		return &kafkaPublisher{writer: &kafka.Writer{
+			Addr:                   kafka.TCP(cfg.KafkaBrokers...),
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+		}}, nil
+	default:
+		return nil, errors.Errorf("unknown EVENT_BUS %q", cfg.EventBus)
+	}
+}
+
+// Encola en el outbox la transición de estado del job. Requiere mu tomado.
+func publishLifecycleLocked(jobID string, event JobEvent) {
+	if eventBus == nil {
+		return
+	}
+	job, ok := jobStore[jobID]
+	if !ok {
+		return
+	}
+	subject := cfg.EventSubjectPrefix + "." + event.Status
+	payload := LifecycleEvent{
+		SchemaVersion: lifecycleSchemaVersion,
+		ID:            uuid.NewString(),
+		Type:          subject,
+		Time:          event.Timestamp,
+		JobID:         jobID,
+		Status:        event.Status,
+		Message:       event.Message,
+		Job:           *job,
+	}
+	if meta, ok := jobMetas[jobID]; ok {
+		payload.Tenant = meta.Tenant
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		jobLogfLocked(jobID, "❌ No se pudo serializar el evento %s del job %s: %v", subject, jobID, err)
+		return
+	}
+	enqueueOutboxLocked(jobID, OutboxMessage{ID: payload.ID, Kind: OutboxBus, Target: subject, Event: subject, Payload: data})
+}
+
+func publishBusMessage(jobID string, msg OutboxMessage) error {
+	if eventBus == nil {
+		// Bus deshabilitado tras un reinicio
+		return errOutboxDiscard
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.EventBusTimeout.Duration)
+	defer cancel()
+	return eventBus.Publish(ctx, msg.Target, jobID, msg.Payload)
+}
+
+type natsPublisher struct {
+	conn *nats.Conn
+}
+
+func (p *natsPublisher) Publish(ctx context.Context, subject, key string, data []byte) error {
+	if err := p.conn.Publish(subject, data); err != nil {
+		return errors.Wrap(err, "NATS publish failed")
+	}
+	// Publish solo encola en el cliente; el flush confirma que llegó al servidor
+	return errors.Wrap(p.conn.FlushWithContext(ctx), "NATS flush failed")
+}
+
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func (p *kafkaPublisher) Publish(ctx context.Context, subject, key string, data []byte) error {
+	err := p.writer.WriteMessages(ctx, kafka.Message{Topic: subject, Key: []byte(key), Value: data})
+	return errors.Wrap(err, "Kafka write failed")
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Formatos de la exportación de metadatos
+const (
+	ExportFormatCSV     = "csv"
+	ExportFormatParquet = "parquet"
+)
+
+// Exportaciones que se recuerdan en GET /admin/exports
+const maxExportHistory = 100
+
+const exportsSetting = "metadata_exports"
+
+// Columnas de la exportación: metadatos del job, nunca la transcripción, la
+// traducción ni la URL del medio. tags y metadata van como JSON.
+var exportColumns = []parquetColumn{
+	{"job_id", parquetByteArray, parquetUTF8, false},
+	{"type", parquetByteArray, parquetUTF8, false},
+	{"status", parquetByteArray, parquetUTF8, false},
+	{"tenant", parquetByteArray, parquetUTF8, false},
+	{"api_key", parquetByteArray, parquetUTF8, false},
+	{"backend", parquetByteArray, parquetUTF8, false},
+	{"model", parquetByteArray, parquetUTF8, false},
+	{"language", parquetByteArray, parquetUTF8, false},
+	{"lane", parquetByteArray, parquetUTF8, false},
+	{"media_format", parquetByteArray, parquetUTF8, false},
+	{"duration_seconds", parquetDouble, parquetNoConversion, false},
+	{"segments", parquetInt64, parquetNoConversion, false},
+	{"cache", parquetBoolean, parquetNoConversion, false},
+	{"error_code", parquetByteArray, parquetUTF8, false},
+	{"review_status", parquetByteArray, parquetUTF8, false},
+	{"tags", parquetByteArray, parquetJSON, false},
+	{"metadata", parquetByteArray, parquetJSON, false},
+	{"request_id", parquetByteArray, parquetUTF8, false},
+	{"created_at", parquetInt64, parquetTimestampMilli, false},
+	{"finished_at", parquetInt64, parquetTimestampMilli, true},
+	{"processing_seconds", parquetDouble, parquetNoConversion, true},
+	{"purged_at", parquetInt64, parquetTimestampMilli, true},
+}
+
+// Fila en el orden de exportColumns
+func exportRow(rec JobRecord) []interface{} {
+	job := rec.Job
+	jobType := job.Type
+	if jobType == "" {
+		jobType = JobTypeTranscription
+	}
+	review := ""
+	if job.Review != nil {
+		review = job.Review.Status
+	}
+	tags, metadata := "[]", "{}"
+	if len(job.Tags) > 0 {
+		data, _ := json.Marshal(job.Tags)
+		tags = string(data)
+	}
+	if len(job.Metadata) > 0 {
+		data, _ := json.Marshal(job.Metadata)
+		metadata = string(data)
+	}
+	var finished, processing, purged interface{}
+	if at, ok := finishedAt(rec.Events); ok && isTerminalStatus(job.Status) {
+		finished, processing = at.UTC(), round2(at.Sub(job.Timestamp).Seconds())
+	}
+	if job.PurgedAt != nil {
+		purged = job.PurgedAt.UTC()
+	}
+	return []interface{}{
+		rec.ID, jobType, job.Status, rec.Meta.Tenant, job.APIKey, job.Backend, rec.Meta.Input.Model, job.Language, job.Lane, job.MediaFormat,
+		job.Duration, int64(len(job.Segments)), job.Cache, job.ErrorCode, review, tags, metadata, job.RequestID,
+		job.Timestamp.UTC(), finished, processing, purged,
+	}
+}
+
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return ""
+}
+
+func encodeExport(w io.Writer, format string, rows [][]interface{}) error {
+	if format == ExportFormatParquet {
+		return errors.Wrap(writeParquet(w, exportColumns, rows), "failed to write parquet")
+	}
+	out := csv.NewWriter(w)
+	record := make([]string, len(exportColumns))
+	for i, col := range exportColumns {
+		record[i] = col.name
+	}
+	if err := out.Write(record); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		for i, v := range row {
+			record[i] = csvValue(v)
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return errors.Wrap(out.Error(), "failed to write csv")
+}
+
+// Exportación ya subida al almacén de objetos
+type MetadataExport struct {
+	ID        string    `json:"id"`
+	Format    string    `json:"format"`
+	Key       string    `json:"key"` // clave en el almacén de artefactos
+	Rows      int       `json:"rows"`
+	Size      int64     `json:"size"`
+	Trigger   string    `json:"trigger"` // schedule o manual
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `json:"url,omitempty"` // enlace temporal de descarga, solo en las respuestas
+}
+
+// Serializa las exportaciones de esta réplica y su historial
+var exportsMu sync.Mutex
+var exportHistory []MetadataExport
+
+// Vuelca los metadatos de todos los jobs (una instantánea completa) en
+// {METADATA_EXPORT_PREFIX}/dt=YYYY-MM-DD/, con la fecha como partición para
+// que el almacén de datos cargue solo la última
+func exportJobMetadata(ctx context.Context, format, trigger string) (MetadataExport, error) {
+	records, err := loadJobRecords(ctx)
+	if err != nil {
+		return MetadataExport{}, err
+	}
+	rows := make([][]interface{}, 0, len(records))
+	for _, rec := range records {
+		rows = append(rows, exportRow(rec))
+	}
+	var buf bytes.Buffer
+	if err := encodeExport(&buf, format, rows); err != nil {
+		return MetadataExport{}, err
+	}
+
+	now := time.Now().UTC()
+	export := MetadataExport{
+		ID:        uuid.NewString(),
+		Format:    format,
+		Rows:      len(rows),
+		Size:      int64(buf.Len()),
+		Trigger:   trigger,
+		CreatedAt: now,
+	}
+	export.Key = fmt.Sprintf("%s/dt=%s/jobs-%s.%s", strings.Trim(cfg.MetadataExportPrefix, "/"), now.Format("2006-01-02"), now.Format("20060102T150405Z"), format)
+	contentType := "text/csv; charset=utf-8"
+	if format == ExportFormatParquet {
+		contentType = "application/vnd.apache.parquet"
+	}
+	if err := artifacts.Put(ctx, export.Key, &buf, export.Size, contentType); err != nil {
+		return MetadataExport{}, errors.Wrap(err, "failed to upload export")
+	}
+	if err := recordExport(export); err != nil {
+		log.Printf("⚠️ Exportación %s subida pero no se pudo guardar el historial: %v", export.Key, err)
+	}
+	return export, nil
+}
+
+// Historial, el más reciente primero; del almacén si lo hay para ver las
+// de todas las réplicas. Requiere exportsMu tomado.
+func loadExportHistory() ([]MetadataExport, error) {
+	if stateStore == nil {
+		history := make([]MetadataExport, len(exportHistory))
+		copy(history, exportHistory)
+		return history, nil
+	}
+	data, err := stateStore.LoadSetting(exportsSetting)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var history []MetadataExport
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, errors.Wrap(err, "corrupt export history")
+	}
+	return history, nil
+}
+
+func recordExport(export MetadataExport) error {
+	exportsMu.Lock()
+	defer exportsMu.Unlock()
+	history, err := loadExportHistory()
+	if err != nil {
+		return err
+	}
+	history = append([]MetadataExport{export}, history...)
+	if len(history) > maxExportHistory {
+		history = history[:maxExportHistory]
+	}
+	if stateStore == nil {
+		exportHistory = history
+		return nil
+	}
+	data, err := json.Marshal(history)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal export history")
+	}
+	return stateStore.SaveSetting(exportsSetting, data)
+}
+
+// Exportación en el líder cada METADATA_EXPORT_INTERVAL
+func runMetadataExporter(ctx context.Context) {
+	ticker := time.NewTicker(cfg.MetadataExportInterval.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		export, err := exportJobMetadata(ctx, cfg.MetadataExportFormat, "schedule")
+		if err != nil {
+			log.Printf("❌ Exportación de metadatos fallida: %v", err)
+			continue
+		}
+		log.Printf("🚀 Metadatos de %d jobs exportados a %s", export.Rows, export.Key)
+	}
+}
+
+type ExportBody struct {
+	Format string `json:"format"` // csv o parquet; por defecto METADATA_EXPORT_FORMAT
+}
+
+// POST /admin/exports exporta ya los metadatos de los jobs y devuelve el
+// enlace de descarga
+func createExportHandler(c *gin.Context) {
+	var input ExportBody
+	// Cuerpo opcional
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Format == "" {
+		input.Format = cfg.MetadataExportFormat
+	}
+	if input.Format != ExportFormatCSV && input.Format != ExportFormatParquet {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or parquet", "code": "INVALID_REQUEST"})
+		return
+	}
+	export, err := exportJobMetadata(c.Request.Context(), input.Format, "manual")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STORAGE_FAILED"})
+		return
+	}
+	if export.URL, err = artifacts.DownloadURL(c.Request.Context(), export.Key, cfg.ArtifactURLTTL.Duration); err != nil {
+		export.URL = ""
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusCreated, export)
+}
+
+// GET /admin/exports lista las últimas exportaciones con enlaces de descarga
+func listExportsHandler(c *gin.Context) {
+	exportsMu.Lock()
+	history, err := loadExportHistory()
+	exportsMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+	if history == nil {
+		history = []MetadataExport{}
+	}
+	for i := range history {
+		if link, err := artifacts.DownloadURL(c.Request.Context(), history[i].Key, cfg.ArtifactURLTTL.Duration); err == nil {
+			history[i].URL = link
+		}
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"exports": history})
+}
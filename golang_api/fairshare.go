@@ -0,0 +1,181 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Workers que puede ocupar un job
+const (
+	workerReserved = "reserved"
+	workerGeneral  = "general"
+)
+
+// Decisiones recientes que guarda el scheduler para GET /admin/scheduler
+const maxSchedulerDecisions = 100
+
+// Reparto justo entre tenants (start-time fair queuing): cada job asignado
+// adelanta el tiempo virtual de su tenant 1/peso, y el siguiente worker
+// libre va al tenant con menor tiempo virtual. Un tenant con mil jobs en
+// cola avanza así a la par que otro con uno solo, en proporción a sus
+// pesos. Un tenant sin jobs no acumula crédito: vuelve al reloj actual.
+// Lo protege el mutex del scheduler.
+type fairShare struct {
+	clock      float64            // tiempo virtual del último job asignado
+	finish     map[string]float64 // por tenant; si no está, el reloj
+	running    map[string]string  // job → tenant
+	dispatches map[string]uint64  // jobs asignados por tenant desde el arranque
+	recent     []SchedulerDecision
+}
+
+// Asignación de un worker a un job
+type SchedulerDecision struct {
+	JobID             string    `json:"job_id"`
+	Tenant            string    `json:"tenant"`
+	Lane              string    `json:"lane"`
+	Worker            string    `json:"worker"` // reserved o general
+	Priority          int       `json:"priority"`
+	EffectivePriority int       `json:"effective_priority"`
+	GPUMinutes        float64   `json:"gpu_minutes"` // coste estimado
+	VirtualStart      float64   `json:"virtual_start"`
+	WaitedMS          int64     `json:"waited_ms"`
+	At                time.Time `json:"at"`
+}
+
+// Estado de un tenant en el scheduler
+type TenantShare struct {
+	Tenant      string  `json:"tenant"`
+	Weight      float64 `json:"weight"`
+	Waiting     int     `json:"waiting"`
+	Running     int     `json:"running"`
+	Dispatched  uint64  `json:"dispatched"`
+	VirtualTime float64 `json:"virtual_time"`
+}
+
+type SchedulerStats struct {
+	Paused       bool                `json:"paused"`
+	Reserved     int                 `json:"workers_reserved"`
+	General      int                 `json:"workers_general"`
+	BusyReserved int                 `json:"busy_reserved"`
+	BusyGeneral  int                 `json:"busy_general"`
+	VirtualClock float64             `json:"virtual_clock"`
+	Tenants      []TenantShare       `json:"tenants"`
+	Recent       []SchedulerDecision `json:"recent"` // la más reciente primero
+
+	// Minutos de GPU estimados en curso y el tope (0 = sin tope)
+	GPUMinutesInFlight float64 `json:"gpu_minutes_in_flight"`
+	GPUMinutesBudget   float64 `json:"gpu_minutes_budget"`
+}
+
+func newFairShare() fairShare {
+	return fairShare{
+		finish:     make(map[string]float64),
+		running:    make(map[string]string),
+		dispatches: make(map[string]uint64),
+	}
+}
+
+// Peso del tenant en tenant_weights; 1 si no figura
+func tenantWeight(tenant string) float64 {
+	if w, ok := live().TenantWeights[tenant]; ok {
+		return w
+	}
+	return 1
+}
+
+// Tiempo virtual en el que empezaría el siguiente job del tenant
+func (f *fairShare) start(tenant string) float64 {
+	if v, ok := f.finish[tenant]; ok && v > f.clock {
+		return v
+	}
+	return f.clock
+}
+
+func (f *fairShare) dispatched(w *schedWaiter, worker string, now time.Time) {
+	start := f.start(w.tenant)
+	f.clock = start
+	f.finish[w.tenant] = start + 1/tenantWeight(w.tenant)
+	for tenant, v := range f.finish {
+		if v <= f.clock {
+			delete(f.finish, tenant)
+		}
+	}
+	f.running[w.jobID] = w.tenant
+	f.dispatches[w.tenant]++
+
+	decision := SchedulerDecision{
+		JobID:             w.jobID,
+		Tenant:            w.tenant,
+		Lane:              w.lane,
+		Worker:            worker,
+		Priority:          w.priority,
+		EffectivePriority: w.effectivePriority(now),
+		GPUMinutes:        w.cost,
+		VirtualStart:      round2(start),
+		WaitedMS:          now.Sub(w.since).Milliseconds(),
+		At:                now,
+	}
+	if len(f.recent) >= maxSchedulerDecisions {
+		copy(f.recent, f.recent[1:])
+		f.recent = f.recent[:len(f.recent)-1]
+	}
+	f.recent = append(f.recent, decision)
+}
+
+func (f *fairShare) finished(jobID string) {
+	delete(f.running, jobID)
+}
+
+func (s *scheduler) stats() SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := SchedulerStats{
+		Paused:       s.paused,
+		Reserved:     s.reserved,
+		General:      s.general,
+		BusyReserved: s.busyReserved,
+		BusyGeneral:  s.busyGeneral,
+		VirtualClock: round2(s.fair.clock),
+		Tenants:      []TenantShare{},
+		Recent:       make([]SchedulerDecision, 0, len(s.fair.recent)),
+
+		GPUMinutesInFlight: round2(s.inFlightCost),
+		GPUMinutesBudget:   live().GPUMinutesBudget,
+	}
+	shares := make(map[string]*TenantShare)
+	share := func(tenant string) *TenantShare {
+		if ts, ok := shares[tenant]; ok {
+			return ts
+		}
+		ts := &TenantShare{Tenant: tenant, Weight: tenantWeight(tenant), VirtualTime: round2(s.fair.start(tenant))}
+		shares[tenant] = ts
+		return ts
+	}
+	for _, w := range s.waiting {
+		share(w.tenant).Waiting++
+	}
+	for _, tenant := range s.fair.running {
+		share(tenant).Running++
+	}
+	for tenant, n := range s.fair.dispatches {
+		share(tenant).Dispatched = n
+	}
+	for _, ts := range shares {
+		stats.Tenants = append(stats.Tenants, *ts)
+	}
+	sort.Slice(stats.Tenants, func(i, j int) bool { return stats.Tenants[i].Tenant < stats.Tenants[j].Tenant })
+	for i := len(s.fair.recent) - 1; i >= 0; i-- {
+		stats.Recent = append(stats.Recent, s.fair.recent[i])
+	}
+	return stats
+}
+
+// GET /admin/scheduler devuelve el reparto de workers de esta réplica entre
+// tenants y sus últimas asignaciones
+func schedulerStatsHandler(c *gin.Context) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, jobScheduler.stats())
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Modelos whisper de mayor a menor; el reintento sin backend alternativo
+// baja un escalón
+var whisperModels = []string{"large", "medium", "small", "base", "tiny"}
+
+// Error de la llamada a un backend con su código estable
+type backendError struct {
+	code      string
+	message   string
+	retryable bool // fallo del lado del backend (OOM, CUDA, caída)
+}
+
+func (e *backendError) Error() string {
+	return e.message
+}
+
+// Transporte con un backend whisper: transcribe una petición (publicando
+// los parciales en payload.Partials), consulta su capacidad y lo calienta
+type transcriber interface {
+	transcribe(ctx context.Context, baseURL string, payload PythonRequest) (*BackendResponse, error)
+	capacity(ctx context.Context, baseURL string) (*BackendCapacity, bool, error)
+	warmup(ctx context.Context, baseURL, model string) error
+}
+
+// Backends HTTP con JSON (v1 y v2)
+type httpTranscriber struct {
+	client *http.Client // consultas de capacidad y calentamiento
+}
+
+var httpBackend = &httpTranscriber{client: &http.Client{}}
+
+// Transporte según el esquema de la URL del backend
+func transcriberFor(baseURL string) transcriber {
+	switch {
+	case isGRPCBackend(baseURL):
+		return grpcBackend
+	case isCeleryBackend(baseURL):
+		return celeryBackend
+	}
+	return httpBackend
+}
+
+// Llamada a un backend con el transporte de su URL. Cancelar ctx la corta;
+// ese error no es un fallo del backend y no se reintenta.
+func callBackend(ctx context.Context, baseURL string, payload PythonRequest) (*BackendResponse, error) {
+	result, err := transcriberFor(baseURL).transcribe(ctx, baseURL, payload)
+	backends.used(baseURL, err == nil)
+	if err != nil && ctx.Err() != nil {
+		return nil, &backendError{code: "BACKEND_TIMEOUT", message: errors.Wrap(ctx.Err(), "gave up waiting for the backend").Error()}
+	}
+	return result, err
+}
+
+// POST {backend}/transcribe, o con el protocolo v2 un job en el backend
+func (t *httpTranscriber) transcribe(ctx context.Context, baseURL string, payload PythonRequest) (*BackendResponse, error) {
+	if backends.protocol(baseURL) == BackendProtocolV2 {
+		return callBackendAsync(ctx, baseURL, payload)
+	}
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, &backendError{code: "INTERNAL_ERROR", message: errors.Wrap(err, "failed to marshal JSON payload").Error()}
+	}
+
+	// Configurar cliente HTTP con timeout
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/transcribe", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, &backendError{code: "INTERNAL_ERROR", message: errors.Wrap(err, "failed to build backend request").Error()}
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Accept", ndjsonContentType+", application/json;q=0.9")
+	req.Header.Set("Accept-Charset", "utf-8")
+	if payload.RequestID != "" {
+		req.Header.Set(requestIDHeader, payload.RequestID)
+	}
+	payload.Partials.begin()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &backendError{code: "BACKEND_UNAVAILABLE", message: errors.Wrap(err, "failed to connect to whisper service").Error(), retryable: true}
+	}
+	defer resp.Body.Close()
+
+	var body []byte
+	if resp.StatusCode == http.StatusOK && isNDJSON(resp.Header.Get("Content-Type")) {
+		if body, err = readBackendStream(baseURL, resp.Body, payload.Partials); err != nil {
+			return nil, err
+		}
+	} else {
+		if body, err = io.ReadAll(resp.Body); err != nil {
+			return nil, &backendError{code: "BACKEND_UNAVAILABLE", message: errors.Wrap(err, "failed to read response body").Error(), retryable: true}
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, &backendError{code: "BACKEND_ERROR", message: string(body), retryable: resp.StatusCode >= 500}
+		}
+	}
+
+	// Un backend que responde en otro charset se convierte; UTF-8 roto no se
+	// guarda con U+FFFD en lugar de los diacríticos
+	if body, err = decodeBackendCharset(baseURL, body, resp.Header.Get("Content-Type")); err != nil {
+		return nil, err
+	}
+	return parseBackendResult(baseURL, body)
+}
+
+func decodeBackendCharset(baseURL string, body []byte, contentType string) ([]byte, error) {
+	body, err := decodeCharset(body, contentType)
+	if err != nil {
+		log.Printf("⚠️ Respuesta del backend %s con codificación no válida (%s): %v", baseURL, contentType, err)
+		return nil, &backendError{code: "INVALID_BACKEND_RESPONSE", message: errors.Wrap(err, "invalid backend response encoding").Error()}
+	}
+	return body, nil
+}
+
+// Respuesta completa del backend, validada y normalizada
+func parseBackendResult(baseURL string, body []byte) (*BackendResponse, error) {
+	// Un cambio de la respuesta del backend falla aquí con los campos
+	// afectados, en vez de guardarse a medias
+	result, violations, err := decodeBackendResponse(body)
+	if err != nil {
+		return nil, &backendError{code: "INVALID_BACKEND_RESPONSE", message: errors.Wrap(err, "failed to parse JSON response").Error(), retryable: true}
+	}
+	if len(violations) > 0 {
+		message := backendContractMessage(violations)
+		log.Printf("⚠️ Respuesta del backend %s fuera de contrato: %s", baseURL, message)
+		return nil, &backendError{code: "BACKEND_CONTRACT_MISMATCH", message: message}
+	}
+	result.normalize()
+	return result, nil
+}
+
+// Error de quien dejó de esperar un hueco en los backends
+func backendWaitError(err error) error {
+	return &backendError{code: "BACKEND_TIMEOUT", message: errors.Wrap(err, "gave up waiting for a free backend").Error()}
+}
+
+// Modelo inmediatamente inferior, o "" si no se conoce o ya es el menor
+func smallerModel(model string) string {
+	if model == "" {
+		return cfg.FallbackModel
+	}
+	for i, m := range whisperModels {
+		if m == model && i+1 < len(whisperModels) {
+			return whisperModels[i+1]
+		}
+	}
+	return ""
+}
+
+// Transcribe en el backend menos cargado. Ante un fallo del backend se
+// reintenta una vez en otro backend o, si no hay otro, con un modelo menor.
+// Devuelve el modelo finalmente usado ("" = el solicitado). Cancelar ctx
+// deja de esperar un hueco en los backends y corta la llamada en curso.
+func transcribeWithFallback(ctx context.Context, jobID string, payload PythonRequest) (*BackendResponse, string, error) {
+	var backend *BackendStatus
+	var err error
+	switch {
+	case payload.Backend != "":
+		if backend, err = backends.acquireURL(ctx, payload.Backend); backend == nil && err == nil {
+			return nil, "", &backendError{code: "BACKEND_UNAVAILABLE", message: fmt.Sprintf("backend %s of model %s is not in the pool", payload.Backend, payload.Model)}
+		}
+	case len(payload.Backends) > 0:
+		if backend, err = backends.acquireIn(ctx, payload.Backends); backend == nil && err == nil {
+			return nil, "", &backendError{code: "BACKEND_UNAVAILABLE", message: fmt.Sprintf("none of the routed backends %s is in the pool", strings.Join(payload.Backends, ", "))}
+		}
+	default:
+		backend, err = backends.acquire(ctx)
+	}
+	if err != nil {
+		return nil, "", backendWaitError(err)
+	}
+	updateJob(jobID, func(job *JobState) { job.Backend = backend.URL })
+	result, err := callBackend(ctx, backend.URL, payload)
+	backends.release(backend)
+
+	// Un modelo propio solo existe en su backend: sin respaldo
+	var berr *backendError
+	if err == nil || payload.Backend != "" || !live().BackendFallback || !errors.As(err, &berr) || !berr.retryable {
+		return result, "", err
+	}
+
+	// Una regla de backend_routing limita el respaldo a sus backends y, si
+	// fija el modelo, a ese modelo
+	next, waitErr := backends.acquireIn(ctx, payload.Backends, backend)
+	if waitErr != nil {
+		return nil, "", backendWaitError(waitErr)
+	}
+	model := ""
+	var message string
+	if next != nil {
+		message = fmt.Sprintf("backend %s failed (%s), retrying on %s", backend.URL, berr.code, next.URL)
+	} else if payload.RouteModel != "" {
+		return nil, "", err
+	} else if model = smallerModel(payload.Model); model != "" {
+		if next, waitErr = backends.acquireIn(ctx, payload.Backends); waitErr != nil {
+			return nil, "", backendWaitError(waitErr)
+		}
+		payload.Model = model
+		message = fmt.Sprintf("backend %s failed (%s), retrying with model %s", backend.URL, berr.code, model)
+	} else {
+		return nil, "", err
+	}
+	defer backends.release(next)
+
+	jobLogf(jobID, "⚠️ Job %s: %s", jobID, message)
+	recordEvent(jobID, JobEvent{Type: EventRetry, Code: berr.code, Message: message})
+	updateJob(jobID, func(job *JobState) { job.Backend = next.URL })
+
+	result, err = callBackend(ctx, next.URL, payload)
+	return result, model, err
+}
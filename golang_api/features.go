@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Funciones experimentales que se pueden activar por tenant
+const (
+	FeatureDiarization = "diarization" // diarize en las peticiones
+	FeatureStreaming   = "streaming"   // segmentos parciales mientras transcribe
+	FeatureTwoPass     = "two_pass"    // accuracy high
+)
+
+// Valor de cada flag sin feature_flags; las que ya existían siguen activas
+var featureDefaults = map[string]bool{
+	FeatureDiarization: true,
+	FeatureStreaming:   true,
+	FeatureTwoPass:     true,
+}
+
+func validateFeatureFlags(flags map[string]bool) error {
+	for name := range flags {
+		if _, ok := featureDefaults[name]; !ok {
+			return errors.Errorf("unknown feature flag %q", name)
+		}
+	}
+	return nil
+}
+
+// Flag efectiva para el tenant: su excepción en tenant_feature_flags, si
+// no la de feature_flags y si no la de por defecto
+func featureEnabled(tenant, name string) bool {
+	c := live()
+	if enabled, ok := c.TenantFeatureFlags[tenant][name]; ok {
+		return enabled
+	}
+	if enabled, ok := c.FeatureFlags[name]; ok {
+		return enabled
+	}
+	return featureDefaults[name]
+}
+
+// Flags efectivas del tenant
+func tenantFeatures(tenant string) map[string]bool {
+	out := make(map[string]bool, len(featureDefaults))
+	for name := range featureDefaults {
+		out[name] = featureEnabled(tenant, name)
+	}
+	return out
+}
+
+// Rechaza las opciones de la petición que dependen de una flag inactiva
+// para el tenant
+func validateRequestFeatures(tenant string, input RequestBody) error {
+	var required []string
+	if input.Diarize {
+		required = append(required, FeatureDiarization)
+	}
+	if input.Accuracy == AccuracyHigh {
+		required = append(required, FeatureTwoPass)
+	}
+	for _, name := range required {
+		if !featureEnabled(tenant, name) {
+			return errors.Errorf("feature %s is not enabled for this tenant", name)
+		}
+	}
+	return nil
+}
+
+// GET /features lista las flags efectivas del tenant
+func listFeaturesHandler(c *gin.Context) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"features": tenantFeatures(currentTenant(c))})
+}
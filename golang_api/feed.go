@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Elementos de GET /jobs/feed por defecto y como máximo
+const (
+	defaultFeedLimit = 50
+	maxFeedLimit     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Job terminado en la forma plana que esperan Zapier o Make: sin segmentos
+// ni estructuras anidadas salvo tags y metadata
+type FeedItem struct {
+	ID            string            `json:"id"` // igual a job_id: clave de deduplicación
+	JobID         string            `json:"job_id"`
+	Type          string            `json:"type"`
+	Status        string            `json:"status"`
+	FinishedAt    time.Time         `json:"finished_at"`
+	Language      string            `json:"language,omitempty"`
+	Duration      float64           `json:"duration_seconds,omitempty"`
+	Transcription string            `json:"transcription,omitempty"`
+	Translation   string            `json:"translation,omitempty"`
+	ErrorCode     string            `json:"error_code,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	Tags          []string          `json:"tags,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	APIKey        string            `json:"api_key,omitempty"`
+	ResultURL     string            `json:"result_url,omitempty"` // con PUBLIC_BASE_URL
+	Cursor        string            `json:"cursor"`
+}
+
+// Posición en el feed: momento en que el job terminó y su ID para desempatar
+type feedCursor struct {
+	at    time.Time
+	jobID string
+}
+
+func (k feedCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(k.at.UnixNano(), 10) + "|" + k.jobID))
+}
+
+func (k feedCursor) after(other feedCursor) bool {
+	if !k.at.Equal(other.at) {
+		return k.at.After(other.at)
+	}
+	return k.jobID > other.jobID
+}
+
+func parseFeedCursor(s string) (feedCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return feedCursor{}, errInvalidCursor
+	}
+	nanos, jobID, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return feedCursor{}, errInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return feedCursor{}, errInvalidCursor
+	}
+	return feedCursor{at: time.Unix(0, n), jobID: jobID}, nil
+}
+
+// Última transición del job a un estado terminal; requiere mu tomado
+func finishedAtLocked(jobID string) (time.Time, bool) {
+	return finishedAt(jobEvents[jobID])
+}
+
+// GET /jobs/feed lista los jobs terminados del tenant, el más reciente
+// primero, para triggers por sondeo. Con since solo devuelve los que
+// terminaron después del cursor: si son más que limit, los más antiguos, y
+// has_more indica que hay que volver a pedir con next_cursor.
+func jobFeedHandler(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && !isTerminalStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be completed, failed or skipped", "code": "INVALID_REQUEST"})
+		return
+	}
+	limit := defaultFeedLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxFeedLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxFeedLimit), "code": "INVALID_REQUEST"})
+			return
+		}
+		limit = n
+	}
+	var since *feedCursor
+	if v := c.Query("since"); v != "" {
+		cursor, err := parseFeedCursor(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_CURSOR"})
+			return
+		}
+		since = &cursor
+	}
+
+	tenant := currentTenant(c)
+	type entry struct {
+		cursor feedCursor
+		item   FeedItem
+	}
+	var entries []entry
+	mu.RLock()
+	for jobID, job := range jobStore {
+		meta, ok := jobMetas[jobID]
+		if !ok || meta.Tenant != tenant || !isTerminalStatus(job.Status) || (status != "" && job.Status != status) {
+			continue
+		}
+		at, ok := finishedAtLocked(jobID)
+		if !ok {
+			at = job.Timestamp
+		}
+		cursor := feedCursor{at: at, jobID: jobID}
+		if since != nil && !cursor.after(*since) {
+			continue
+		}
+		entries = append(entries, entry{cursor: cursor, item: FeedItem{
+			ID:            jobID,
+			JobID:         jobID,
+			Type:          job.Type,
+			Status:        job.Status,
+			FinishedAt:    at,
+			Language:      job.Language,
+			Duration:      job.Duration,
+			Transcription: job.Transcription,
+			Translation:   job.Translation,
+			ErrorCode:     job.ErrorCode,
+			Error:         job.Error,
+			Tags:          job.Tags,
+			Metadata:      job.Metadata,
+			APIKey:        job.APIKey,
+		}})
+	}
+	mu.RUnlock()
+
+	// Del más antiguo al más reciente para cortar sin saltarse ninguno
+	sort.Slice(entries, func(i, j int) bool { return entries[j].cursor.after(entries[i].cursor) })
+	hasMore := false
+	if len(entries) > limit {
+		hasMore = since != nil
+		if since != nil {
+			entries = entries[:limit]
+		} else {
+			entries = entries[len(entries)-limit:]
+		}
+	}
+
+	items := make([]FeedItem, 0, len(entries))
+	nextCursor := c.Query("since")
+	if len(entries) > 0 {
+		nextCursor = entries[len(entries)-1].cursor.String()
+	}
+	base := strings.TrimRight(cfg.PublicBaseURL, "/")
+	for i := len(entries) - 1; i >= 0; i-- {
+		item := entries[i].item
+		item.Cursor = entries[i].cursor.String()
+		if base != "" {
+			item.ResultURL = base + "/result/" + item.JobID
+		}
+		items = append(items, item)
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"items": items, "next_cursor": nextCursor, "has_more": hasMore})
+}
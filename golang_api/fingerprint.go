@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"os/exec"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// fpcalc solo calcula la huella de los primeros segundos del medio
+const fpcalcLength = 120
+
+const fpcalcTimeout = time.Minute
+
+// Desfase máximo entre dos huellas, en frames de Chromaprint (~0,124 s):
+// una resubida puede empezar un poco antes o después
+const fingerprintMaxOffset = 16
+
+// Diferencia de duración admitida entre dos medios con el mismo audio
+const fingerprintDurationTolerance = 2.0
+
+// Huella acústica cruda de Chromaprint (fpcalc -raw). En el almacén va en
+// base64, little-endian: 4 bytes por frame en vez de un número decimal.
+type Fingerprint []uint32
+
+func (f Fingerprint) MarshalJSON() ([]byte, error) {
+	buf := make([]byte, 4*len(f))
+	for i, v := range f {
+		binary.LittleEndian.PutUint32(buf[4*i:], v)
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(buf))
+}
+
+func (f *Fingerprint) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	buf, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(buf)%4 != 0 {
+		return errors.New("invalid audio fingerprint")
+	}
+	out := make(Fingerprint, len(buf)/4)
+	for i := range out {
+		out[i] = binary.LittleEndian.Uint32(buf[4*i:])
+	}
+	*f = out
+	return nil
+}
+
+// Huella del medio con fpcalc de Chromaprint
+func computeFingerprint(source string) (Fingerprint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fpcalcTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, cfg.FpcalcPath, "-raw", "-json", "-length", fmt.Sprint(fpcalcLength), source)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "fpcalc failed: %s", lastLine(stderr.String()))
+	}
+	// Según la versión de fpcalc los frames salen con o sin signo
+	var out struct {
+		Fingerprint []int64 `json:"fingerprint"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, errors.Wrap(err, "failed to parse fpcalc output")
+	}
+	if len(out.Fingerprint) == 0 {
+		return nil, errors.New("fpcalc returned an empty fingerprint")
+	}
+	fp := make(Fingerprint, len(out.Fingerprint))
+	for i, v := range out.Fingerprint {
+		fp[i] = uint32(v)
+	}
+	return fp, nil
+}
+
+// Fracción de bits iguales con el mejor desfase. Solo cuentan los desfases
+// en los que las huellas se solapan al menos en la mitad de la más corta.
+func fingerprintSimilarity(a, b Fingerprint) float64 {
+	shorter := len(a)
+	if len(b) < shorter {
+		shorter = len(b)
+	}
+	best := 0.0
+	for offset := -fingerprintMaxOffset; offset <= fingerprintMaxOffset; offset++ {
+		diff, n := 0, 0
+		for i := range a {
+			j := i + offset
+			if j < 0 || j >= len(b) {
+				continue
+			}
+			diff += bits.OnesCount32(a[i] ^ b[j])
+			n++
+		}
+		if n == 0 || 2*n < shorter {
+			continue
+		}
+		if sim := 1 - float64(diff)/float64(32*n); sim > best {
+			best = sim
+		}
+	}
+	return best
+}
+
+// Un resultado solo se reutiliza si se pidió igual: mismo idioma, modelo,
+// traducción, precisión, diarize y formato
+func sameTranscriptionOptions(a, b RequestBody) bool {
+	return strings.EqualFold(a.Language, b.Language) && strings.EqualFold(a.Model, b.Model) &&
+		a.Translate == b.Translate && a.Accuracy == b.Accuracy && a.Diarize == b.Diarize &&
+		reflect.DeepEqual(a.Format, b.Format)
+}
+
+// Job completado del tenant con el mismo audio y opciones compatibles; el
+// de mayor similitud. Requiere mu tomado (basta RLock).
+func findDuplicateLocked(jobID string, input RequestBody, tenant string, duration float64, fp Fingerprint) (string, float64) {
+	bestID, best := "", 0.0
+	for id, meta := range jobMetas {
+		job, ok := jobStore[id]
+		if id == jobID || !ok || len(meta.Fingerprint) == 0 || meta.Tenant != tenant {
+			continue
+		}
+		if job.Status != "completed" || job.PurgedAt != nil || job.Duration == 0 || math.Abs(job.Duration-duration) > fingerprintDurationTolerance {
+			continue
+		}
+		if !sameTranscriptionOptions(meta.Input, input) || !languageAllowed(input.OnlyIfLanguage, job.Language) {
+			continue
+		}
+		if sim := fingerprintSimilarity(fp, meta.Fingerprint); sim >= cfg.FingerprintMinSimilarity && sim > best {
+			bestID, best = id, sim
+		}
+	}
+	return bestID, best
+}
+
+// Si otro job del tenant tiene el mismo audio (otra URL, una resubida),
+// completa este con una copia de su resultado sin pasar por el backend.
+// Devuelve false si no hay ninguno.
+func completeDuplicate(jobID string, input RequestBody, tenant string, duration float64, fp Fingerprint) bool {
+	mu.RLock()
+	originalID, similarity := findDuplicateLocked(jobID, input, tenant, duration, fp)
+	mu.RUnlock()
+	if originalID == "" {
+		return false
+	}
+
+	mu.Lock()
+	defer unlockJobs()
+	original, ok := jobStore[originalID]
+	job, exists := jobStore[jobID]
+	if !ok || !exists || original.Status != "completed" || original.PurgedAt != nil {
+		// Borrado o purgado mientras tanto
+		return false
+	}
+	job.Status = "completed"
+	job.Partial = false
+	job.Transcription = original.Transcription
+	job.Translation = original.Translation
+	job.Language = original.Language
+	job.Segments = append([]Segment(nil), original.Segments...)
+	job.Chapters = append([]Chapter(nil), original.Chapters...)
+	if original.Stats != nil {
+		stats := *original.Stats
+		job.Stats = &stats
+	}
+	job.Review = newReview(input)
+	job.DuplicateOf = originalID
+	jobLogfLocked(jobID, "🚀 Job %s: mismo audio que el job %s (similitud %.2f), se reutiliza su resultado", jobID, originalID, similarity)
+	appendEventLocked(jobID, JobEvent{Type: EventStatus, Status: "completed", Message: fmt.Sprintf("same audio as job %s (similarity %.2f)", originalID, similarity)})
+	return true
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Opciones de formato del texto publicado, por job. Se aplican en el
+// gateway sobre la salida de whisper (transcripción, traducción y
+// segmentos; las palabras con marcas de tiempo quedan tal cual), así que la
+// caché guarda siempre el texto sin formatear.
+type FormatOptions struct {
+	Casing      string `json:"casing,omitempty"`      // sentence, lower o upper; "" = sin cambios
+	Punctuation string `json:"punctuation,omitempty"` // restore o strip; "" = sin cambios
+	Numerals    string `json:"numerals,omitempty"`    // digits o words (en, es); "" = sin cambios
+	Diacritics  bool   `json:"diacritics,omitempty"`  // normaliza tonos y subpuntos del yorùbá (ver yoruba.go)
+}
+
+const (
+	CasingSentence = "sentence"
+	CasingLower    = "lower"
+	CasingUpper    = "upper"
+
+	PunctuationRestore = "restore"
+	PunctuationStrip   = "strip"
+
+	NumeralsDigits = "digits"
+	NumeralsWords  = "words"
+)
+
+// Pausa entre segmentos que, al restaurar la puntuación, cierra una frase
+const sentencePauseSeconds = 0.8
+
+func (o *FormatOptions) validate() error {
+	if o == nil {
+		return nil
+	}
+	switch o.Casing {
+	case "", CasingSentence, CasingLower, CasingUpper:
+	default:
+		return errors.Errorf("format.casing must be %s, %s or %s", CasingSentence, CasingLower, CasingUpper)
+	}
+	switch o.Punctuation {
+	case "", PunctuationRestore, PunctuationStrip:
+	default:
+		return errors.Errorf("format.punctuation must be %s or %s", PunctuationRestore, PunctuationStrip)
+	}
+	switch o.Numerals {
+	case "", NumeralsDigits, NumeralsWords:
+	default:
+		return errors.Errorf("format.numerals must be %s or %s", NumeralsDigits, NumeralsWords)
+	}
+	return nil
+}
+
+// Devuelve el resultado formateado; los segmentos se copian. La traducción
+// está en translationLanguage, el resto en el idioma del resultado. Al
+// restaurar la puntuación, un segmento cierra frase si le sigue una pausa.
+func (o *FormatOptions) apply(result BackendResponse, translationLanguage string) BackendResponse {
+	if o == nil || *o == (FormatOptions{}) {
+		return result
+	}
+	result.Transcription, _ = o.formatText(result.Transcription, result.Language, true, true)
+	if result.Translation != "" {
+		result.Translation, _ = o.formatText(result.Translation, translationLanguage, true, true)
+	}
+	if len(result.Segments) > 0 {
+		segments := make([]Segment, len(result.Segments))
+		capNext := true
+		for i, seg := range result.Segments {
+			lang := seg.Language
+			if lang == "" {
+				lang = result.Language
+			}
+			ends := i == len(result.Segments)-1 || result.Segments[i+1].Start-seg.End >= sentencePauseSeconds
+			seg.Text, capNext = o.formatText(seg.Text, lang, capNext, ends)
+			segments[i] = seg
+		}
+		result.Segments = segments
+	}
+	return result
+}
+
+// Formatea un texto: diacríticos, números, puntuación y mayúsculas, en ese orden. capNext
+// indica si el texto empieza frase y endsSentence si debe cerrarla; devuelve
+// si el siguiente texto empieza frase.
+func (o *FormatOptions) formatText(text, language string, capNext, endsSentence bool) (string, bool) {
+	lang := baseLanguage(language)
+	if o.Diacritics && lang == LangYoruba {
+		text = normalizeYoruba(text)
+	}
+	switch o.Numerals {
+	case NumeralsDigits:
+		text = numberWordsToDigits(text, lang)
+	case NumeralsWords:
+		text = digitsToNumberWords(text, lang)
+	}
+	switch o.Punctuation {
+	case PunctuationRestore:
+		text = restorePunctuation(text, endsSentence)
+	case PunctuationStrip:
+		text = stripPunctuation(text)
+	}
+	switch o.Casing {
+	case CasingSentence:
+		text, capNext = sentenceCase(text, lang, capNext)
+	case CasingLower:
+		text = strings.ToLower(text)
+	case CasingUpper:
+		text = strings.ToUpper(text)
+	}
+	return text, capNext
+}
+
+// "es-MX" -> "es"
+func baseLanguage(language string) string {
+	lang, _, _ := strings.Cut(strings.ToLower(language), "-")
+	return lang
+}
+
+func isTerminalPunct(r rune) bool {
+	return r == '.' || r == '!' || r == '?' || r == '…'
+}
+
+func endsWithTerminal(text string) bool {
+	r, _ := utf8.DecodeLastRuneInString(strings.TrimRightFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"' || r == '»' || r == ')'
+	}))
+	return isTerminalPunct(r)
+}
+
+// Mayúscula al empezar cada frase (y "I" en inglés); el resto se respeta
+// para no perder los nombres propios que whisper ya escribe bien
+func sentenceCase(text, lang string, capNext bool) (string, bool) {
+	runes := []rune(text)
+	for i, r := range runes {
+		switch {
+		case unicode.IsLetter(r):
+			if capNext {
+				runes[i] = unicode.ToUpper(r)
+				capNext = false
+			} else if lang == LangEnglish && r == 'i' && isStandaloneI(runes, i) {
+				runes[i] = 'I'
+			}
+		case unicode.IsDigit(r):
+			capNext = false
+		case isTerminalPunct(r):
+			capNext = true
+		}
+	}
+	return string(runes), capNext
+}
+
+// "i" como palabra, incluidas las contracciones (i'm, i'll...)
+func isStandaloneI(runes []rune, i int) bool {
+	if i > 0 && (unicode.IsLetter(runes[i-1]) || runes[i-1] == '\'') {
+		return false
+	}
+	return i+1 == len(runes) || !unicode.IsLetter(runes[i+1])
+}
+
+var spaceBeforePunct = regexp.MustCompile(`\s+([,.!?;:…])`)
+
+// Quita los espacios antes de los signos y cierra la frase con punto si
+// endsSentence y no termina ya en un signo final
+func restorePunctuation(text string, endsSentence bool) string {
+	text = spaceBeforePunct.ReplaceAllString(text, "$1")
+	trimmed := strings.TrimRightFunc(text, unicode.IsSpace)
+	if !endsSentence || trimmed == "" || endsWithTerminal(trimmed) {
+		return text
+	}
+	last, _ := utf8.DecodeLastRuneInString(trimmed)
+	if trailing := strings.TrimRight(trimmed, ",;:"); trailing != trimmed {
+		// "hola," al final pasa a "hola."
+		return trailing + "." + text[len(trimmed):]
+	}
+	if !unicode.IsLetter(last) && !unicode.IsDigit(last) {
+		return text
+	}
+	return trimmed + "." + text[len(trimmed):]
+}
+
+// Quita la puntuación salvo apóstrofos y guiones dentro de palabras y
+// separadores dentro de números (3.5, 10:30)
+func stripPunctuation(text string) string {
+	runes := []rune(text)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsPunct(r) {
+			prev, next := rune(0), rune(0)
+			if i > 0 {
+				prev = runes[i-1]
+			}
+			if i+1 < len(runes) {
+				next = runes[i+1]
+			}
+			inWord := (r == '\'' || r == '’' || r == '-') && unicode.IsLetter(prev) && unicode.IsLetter(next)
+			inNumber := (r == '.' || r == ',' || r == ':') && unicode.IsDigit(prev) && unicode.IsDigit(next)
+			if !inWord && !inNumber {
+				continue
+			}
+		}
+		b.WriteRune(r)
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// Clase de una palabra numérica para validar la secuencia al leerla
+type numberWordKind int
+
+const (
+	numUnit     numberWordKind = iota // 1-9
+	numTeen                           // 10-19 (y 21-29 en español)
+	numTen                            // 20, 30... 90
+	numHundred                        // multiplicador (hundred)
+	numHundreds                       // centenas completas (doscientos)
+	numScale                          // thousand, million
+)
+
+type numberWord struct {
+	value int
+	kind  numberWordKind
+}
+
+var numberWordsEN = map[string]numberWord{
+	"zero": {0, numUnit}, "one": {1, numUnit}, "two": {2, numUnit}, "three": {3, numUnit}, "four": {4, numUnit},
+	"five": {5, numUnit}, "six": {6, numUnit}, "seven": {7, numUnit}, "eight": {8, numUnit}, "nine": {9, numUnit},
+	"ten": {10, numTeen}, "eleven": {11, numTeen}, "twelve": {12, numTeen}, "thirteen": {13, numTeen},
+	"fourteen": {14, numTeen}, "fifteen": {15, numTeen}, "sixteen": {16, numTeen}, "seventeen": {17, numTeen},
+	"eighteen": {18, numTeen}, "nineteen": {19, numTeen},
+	"twenty": {20, numTen}, "thirty": {30, numTen}, "forty": {40, numTen}, "fifty": {50, numTen},
+	"sixty": {60, numTen}, "seventy": {70, numTen}, "eighty": {80, numTen}, "ninety": {90, numTen},
+	"hundred": {100, numHundred}, "thousand": {1000, numScale}, "million": {1000000, numScale},
+}
+
+var numberWordsES = map[string]numberWord{
+	"cero": {0, numUnit}, "un": {1, numUnit}, "uno": {1, numUnit}, "una": {1, numUnit}, "dos": {2, numUnit},
+	"tres": {3, numUnit}, "cuatro": {4, numUnit}, "cinco": {5, numUnit}, "seis": {6, numUnit},
+	"siete": {7, numUnit}, "ocho": {8, numUnit}, "nueve": {9, numUnit},
+	"diez": {10, numTeen}, "once": {11, numTeen}, "doce": {12, numTeen}, "trece": {13, numTeen},
+	"catorce": {14, numTeen}, "quince": {15, numTeen}, "dieciséis": {16, numTeen}, "dieciseis": {16, numTeen},
+	"diecisiete": {17, numTeen}, "dieciocho": {18, numTeen}, "diecinueve": {19, numTeen},
+	"veinte": {20, numTeen}, "veintiún": {21, numTeen}, "veintiun": {21, numTeen}, "veintiuno": {21, numTeen},
+	"veintiuna": {21, numTeen}, "veintidós": {22, numTeen}, "veintidos": {22, numTeen},
+	"veintitrés": {23, numTeen}, "veintitres": {23, numTeen}, "veinticuatro": {24, numTeen},
+	"veinticinco": {25, numTeen}, "veintiséis": {26, numTeen}, "veintiseis": {26, numTeen},
+	"veintisiete": {27, numTeen}, "veintiocho": {28, numTeen}, "veintinueve": {29, numTeen},
+	"treinta": {30, numTen}, "cuarenta": {40, numTen}, "cincuenta": {50, numTen}, "sesenta": {60, numTen},
+	"setenta": {70, numTen}, "ochenta": {80, numTen}, "noventa": {90, numTen},
+	"cien": {100, numHundreds}, "ciento": {100, numHundreds}, "doscientos": {200, numHundreds},
+	"doscientas": {200, numHundreds}, "trescientos": {300, numHundreds}, "trescientas": {300, numHundreds},
+	"cuatrocientos": {400, numHundreds}, "cuatrocientas": {400, numHundreds}, "quinientos": {500, numHundreds},
+	"quinientas": {500, numHundreds}, "seiscientos": {600, numHundreds}, "seiscientas": {600, numHundreds},
+	"setecientos": {700, numHundreds}, "setecientas": {700, numHundreds}, "ochocientos": {800, numHundreds},
+	"ochocientas": {800, numHundreds}, "novecientos": {900, numHundreds}, "novecientas": {900, numHundreds},
+	"mil": {1000, numScale}, "millón": {1000000, numScale}, "millon": {1000000, numScale},
+	"millones": {1000000, numScale},
+}
+
+func numberWordsFor(lang string) (map[string]numberWord, string) {
+	switch lang {
+	case LangEnglish:
+		return numberWordsEN, "and"
+	case LangSpanish:
+		return numberWordsES, "y"
+	}
+	return nil, ""
+}
+
+// Lectura en curso de un número escrito con palabras
+type numberParse struct {
+	total     int // millares ya cerrados
+	current   int // parte por debajo del último millar
+	lastScale int
+	lastKind  numberWordKind
+	words     int
+	bareMil   bool // "mil" sin cantidad delante vale 1000 (no así "thousand")
+}
+
+// Añade una palabra; false si no puede continuar este número
+func (p *numberParse) add(w numberWord) bool {
+	if p.words > 0 && p.lastKind != numScale && p.current == 0 && p.total == 0 {
+		// "cero" solo vale solo
+		return false
+	}
+	tail := p.current % 100
+	switch w.kind {
+	case numUnit:
+		if p.words > 0 && (p.lastKind == numUnit || p.lastKind == numTeen || (tail != 0 && tail < 20)) {
+			return false
+		}
+		p.current += w.value
+	case numTeen, numTen:
+		if p.words > 0 && (p.lastKind == numUnit || p.lastKind == numTeen || p.lastKind == numTen || tail != 0) {
+			return false
+		}
+		p.current += w.value
+	case numHundred:
+		if p.lastKind != numUnit || p.words == 0 || p.current%100 == 0 || p.current >= 10 {
+			return false
+		}
+		p.current *= 100
+	case numHundreds:
+		if p.words > 0 && p.lastKind != numScale {
+			return false
+		}
+		p.current += w.value
+	case numScale:
+		if p.lastScale != 0 && w.value >= p.lastScale {
+			return false
+		}
+		if p.words > 0 && p.lastKind == numScale {
+			return false
+		}
+		if p.current == 0 {
+			if !p.bareMil || w.value != 1000 || p.words > 0 {
+				return false
+			}
+			p.current = 1
+		}
+		p.total += p.current * w.value
+		p.current = 0
+		p.lastScale = w.value
+	}
+	p.lastKind = w.kind
+	p.words++
+	return true
+}
+
+func (p *numberParse) value() int {
+	return p.total + p.current
+}
+
+var wordPattern = regexp.MustCompile(`\p{L}+`)
+
+// Sustituye los números escritos con palabras por cifras ("twenty-one" ->
+// "21"). Una sola palabra de unidad ("one", "un") se deja: suele ser un
+// artículo o un pronombre.
+func numberWordsToDigits(text, lang string) string {
+	dict, conj := numberWordsFor(lang)
+	if dict == nil {
+		return text
+	}
+	locs := wordPattern.FindAllStringIndex(text, -1)
+	var b strings.Builder
+	pos := 0
+	for i := 0; i < len(locs); {
+		p := numberParse{bareMil: lang == LangSpanish}
+		start, end, j := locs[i][0], locs[i][1], i
+		for k := i; k < len(locs); k++ {
+			if k > i && !numberSeparator(text[locs[k-1][1]:locs[k][0]]) {
+				break
+			}
+			word := strings.ToLower(text[locs[k][0]:locs[k][1]])
+			if word == conj && p.words > 0 && k+1 < len(locs) {
+				// "one hundred and five", "treinta y dos"
+				next, ok := dict[strings.ToLower(text[locs[k+1][0]:locs[k+1][1]])]
+				validConj := ok && next.kind != numScale && numberSeparator(text[locs[k][1]:locs[k+1][0]]) &&
+					((lang == LangEnglish && p.current%100 == 0) || (lang == LangSpanish && p.lastKind == numTen))
+				if validConj {
+					continue
+				}
+				break
+			}
+			w, ok := dict[word]
+			if !ok || !p.add(w) {
+				break
+			}
+			end, j = locs[k][1], k
+		}
+		if p.words == 0 || (p.words == 1 && p.lastKind == numUnit && p.value() == 1) {
+			i++
+			continue
+		}
+		b.WriteString(text[pos:start])
+		b.WriteString(strconv.Itoa(p.value()))
+		pos = end
+		i = j + 1
+	}
+	b.WriteString(text[pos:])
+	return b.String()
+}
+
+func numberSeparator(s string) bool {
+	return s == " " || s == "-"
+}
+
+var standaloneDigits = regexp.MustCompile(`\d+`)
+
+// Sustituye los enteros sueltos por palabras ("21" -> "twenty-one"). Los
+// decimales, horas y cifras con separadores se dejan como están.
+func digitsToNumberWords(text, lang string) string {
+	var toWords func(int) string
+	switch lang {
+	case LangEnglish:
+		toWords = englishNumberWords
+	case LangSpanish:
+		toWords = spanishNumberWords
+	default:
+		return text
+	}
+	locs := standaloneDigits.FindAllStringIndex(text, -1)
+	var b strings.Builder
+	pos := 0
+	for _, loc := range locs {
+		if !standaloneNumber(text, loc[0], loc[1]) {
+			continue
+		}
+		n, err := strconv.Atoi(text[loc[0]:loc[1]])
+		if err != nil || n >= 1000000000 {
+			continue
+		}
+		b.WriteString(text[pos:loc[0]])
+		b.WriteString(toWords(n))
+		pos = loc[1]
+	}
+	b.WriteString(text[pos:])
+	return b.String()
+}
+
+// Sin letras pegadas ni separadores seguidos de más cifras (3.5, 1,000, 10:30)
+func standaloneNumber(text string, start, end int) bool {
+	if start > 0 {
+		prev, _ := utf8.DecodeLastRuneInString(text[:start])
+		if unicode.IsLetter(prev) || ((prev == '.' || prev == ',' || prev == ':') && start > 1 && isASCIIDigit(text[start-2])) {
+			return false
+		}
+	}
+	if end < len(text) {
+		next, _ := utf8.DecodeRuneInString(text[end:])
+		if unicode.IsLetter(next) || ((next == '.' || next == ',' || next == ':') && end+1 < len(text) && isASCIIDigit(text[end+1])) {
+			return false
+		}
+	}
+	return true
+}
+
+func isASCIIDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+var (
+	englishOnes = []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine",
+		"ten", "eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen", "seventeen", "eighteen", "nineteen"}
+	englishTens = []string{"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety"}
+)
+
+func englishNumberWords(n int) string {
+	switch {
+	case n < 20:
+		return englishOnes[n]
+	case n < 100:
+		if n%10 == 0 {
+			return englishTens[n/10]
+		}
+		return englishTens[n/10] + "-" + englishOnes[n%10]
+	case n < 1000:
+		return joinNumberWords(englishOnes[n/100]+" hundred", n%100, englishNumberWords)
+	case n < 1000000:
+		return joinNumberWords(englishNumberWords(n/1000)+" thousand", n%1000, englishNumberWords)
+	}
+	return joinNumberWords(englishNumberWords(n/1000000)+" million", n%1000000, englishNumberWords)
+}
+
+// prefix seguido de rest en palabras, si rest no es cero
+func joinNumberWords(prefix string, rest int, toWords func(int) string) string {
+	if rest == 0 {
+		return prefix
+	}
+	return prefix + " " + toWords(rest)
+}
+
+var (
+	spanishOnes = []string{"cero", "uno", "dos", "tres", "cuatro", "cinco", "seis", "siete", "ocho", "nueve",
+		"diez", "once", "doce", "trece", "catorce", "quince", "dieciséis", "diecisiete", "dieciocho", "diecinueve",
+		"veinte", "veintiuno", "veintidós", "veintitrés", "veinticuatro", "veinticinco", "veintiséis",
+		"veintisiete", "veintiocho", "veintinueve"}
+	spanishTens     = []string{"", "", "", "treinta", "cuarenta", "cincuenta", "sesenta", "setenta", "ochenta", "noventa"}
+	spanishHundreds = []string{"", "ciento", "doscientos", "trescientos", "cuatrocientos", "quinientos",
+		"seiscientos", "setecientos", "ochocientos", "novecientos"}
+)
+
+func spanishNumberWords(n int) string {
+	switch {
+	case n < 30:
+		return spanishOnes[n]
+	case n < 100:
+		if n%10 == 0 {
+			return spanishTens[n/10]
+		}
+		return spanishTens[n/10] + " y " + spanishOnes[n%10]
+	case n == 100:
+		return "cien"
+	case n < 1000:
+		return joinNumberWords(spanishHundreds[n/100], n%100, spanishNumberWords)
+	case n < 2000:
+		return joinNumberWords("mil", n%1000, spanishNumberWords)
+	case n < 1000000:
+		return joinNumberWords(spanishApocope(spanishNumberWords(n/1000))+" mil", n%1000, spanishNumberWords)
+	case n < 2000000:
+		return joinNumberWords("un millón", n%1000000, spanishNumberWords)
+	}
+	return joinNumberWords(spanishApocope(spanishNumberWords(n/1000000))+" millones", n%1000000, spanishNumberWords)
+}
+
+// "veintiuno mil" -> "veintiún mil", "treinta y uno mil" -> "treinta y un mil"
+func spanishApocope(words string) string {
+	switch {
+	case strings.HasSuffix(words, "veintiuno"):
+		return strings.TrimSuffix(words, "veintiuno") + "veintiún"
+	case strings.HasSuffix(words, "uno"):
+		return strings.TrimSuffix(words, "uno") + "un"
+	}
+	return words
+}
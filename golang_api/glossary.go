@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Máximo de términos por glosario
+const maxGlossaryEntries = 1000
+
+// Término del glosario: cada aparición de Source en la traducción se
+// sustituye por Target (nombres propios, términos culturales yorùbá...)
+type GlossaryEntry struct {
+	Source        string `json:"source"`
+	Target        string `json:"target"`
+	CaseSensitive bool   `json:"case_sensitive,omitempty"`
+}
+
+type GlossaryBody struct {
+	Entries []GlossaryEntry `json:"entries"`
+}
+
+// Glosarios por tenant
+type glossaryStore struct {
+	mu      sync.RWMutex
+	entries map[string][]GlossaryEntry
+}
+
+var glossaries = &glossaryStore{entries: make(map[string][]GlossaryEntry)}
+
+func (g *glossaryStore) get(tenant string) []GlossaryEntry {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	entries := make([]GlossaryEntry, len(g.entries[tenant]))
+	copy(entries, g.entries[tenant])
+	return entries
+}
+
+func (g *glossaryStore) set(tenant string, entries []GlossaryEntry) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(entries) == 0 {
+		delete(g.entries, tenant)
+		return
+	}
+	g.entries[tenant] = entries
+}
+
+func validateGlossary(entries []GlossaryEntry) error {
+	if len(entries) > maxGlossaryEntries {
+		return errors.Errorf("at most %d glossary entries", maxGlossaryEntries)
+	}
+	seen := make(map[string]bool, len(entries))
+	for i, e := range entries {
+		if strings.TrimSpace(e.Source) == "" {
+			return errors.Errorf("entry %d: source is required", i)
+		}
+		key := e.Source
+		if !e.CaseSensitive {
+			key = strings.ToLower(key)
+		}
+		if seen[key] {
+			return errors.Errorf("entry %d: duplicate source %q", i, e.Source)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// Aplica el glosario en una sola pasada sobre palabras completas. Los
+// términos más largos ganan y el texto sustituido no se vuelve a procesar.
+func applyGlossary(text string, entries []GlossaryEntry) (string, int) {
+	if len(entries) == 0 || text == "" {
+		return text, 0
+	}
+	sorted := make([]GlossaryEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i].Source) > len(sorted[j].Source) })
+
+	var b strings.Builder
+	replaced := 0
+	prevWord := false
+	for i := 0; i < len(text); {
+		if !prevWord {
+			if e, n, ok := matchGlossary(text[i:], sorted); ok {
+				b.WriteString(e.Target)
+				replaced++
+				i += n
+				r, _ := utf8.DecodeLastRuneInString(text[:i])
+				prevWord = isWordRune(r)
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		b.WriteString(text[i : i+size])
+		prevWord = isWordRune(r)
+		i += size
+	}
+	return b.String(), replaced
+}
+
+// Término que empieza en s y termina en frontera de palabra
+func matchGlossary(s string, entries []GlossaryEntry) (GlossaryEntry, int, bool) {
+	for _, e := range entries {
+		n := len(e.Source)
+		if n > len(s) {
+			continue
+		}
+		candidate := s[:n]
+		if e.CaseSensitive && candidate != e.Source {
+			continue
+		}
+		if !e.CaseSensitive && !strings.EqualFold(candidate, e.Source) {
+			continue
+		}
+		if next, _ := utf8.DecodeRuneInString(s[n:]); n < len(s) && isWordRune(next) {
+			continue
+		}
+		return e, n, true
+	}
+	return GlossaryEntry{}, 0, false
+}
+
+// Las marcas combinantes (tonos en NFD) forman parte de la palabra
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+func glossaryEvent(replaced int) JobEvent {
+	return JobEvent{Type: EventEdit, Message: fmt.Sprintf("glossary applied to translation: %d replacements", replaced)}
+}
+
+// Tenant de la petición: el de la API key, o "" con el servicio abierto
+func currentTenant(c *gin.Context) string {
+	return currentAPIKey(c).tenant()
+}
+
+// GET /glossary
+func getGlossaryHandler(c *gin.Context) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, GlossaryBody{Entries: glossaries.get(currentTenant(c))})
+}
+
+// PUT /glossary reemplaza el glosario completo del tenant
+func putGlossaryHandler(c *gin.Context) {
+	var input GlossaryBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateGlossary(input.Entries); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Entries == nil {
+		input.Entries = []GlossaryEntry{}
+	}
+	glossaries.set(currentTenant(c), input.Entries)
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, input)
+}
+
+// DELETE /glossary
+func deleteGlossaryHandler(c *gin.Context) {
+	glossaries.set(currentTenant(c), nil)
+	c.Status(http.StatusNoContent)
+}
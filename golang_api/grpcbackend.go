@@ -0,0 +1,569 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Servicio de python_service/proto/whisper_backend.proto. Los mensajes se
+// codifican a mano con protowire: son pocos y así no hace falta protoc.
+const grpcService = "whisper.backend.v1.WhisperBackend"
+
+// Mensaje más grande aceptado del backend (el Result incluido)
+const maxGRPCMessage = 16 << 20
+
+// Espera a que el backend cierre el stream tras mandarle un Cancel
+const grpcCancelGrace = 5 * time.Second
+
+// Códigos de estado de gRPC que se tratan aparte
+const (
+	grpcOK               = 0
+	grpcCancelled        = 1
+	grpcInvalidArgument  = 3
+	grpcDeadlineExceeded = 4
+	grpcUnimplemented    = 12
+	grpcUnavailable      = 14
+)
+
+// Backends de WHISPER_BACKENDS con gRPC: grpc:// (HTTP/2 sin TLS) y grpcs://
+func isGRPCBackend(baseURL string) bool {
+	return strings.HasPrefix(baseURL, "grpc://") || strings.HasPrefix(baseURL, "grpcs://")
+}
+
+type grpcTranscriber struct {
+	plain *http2.Transport
+	tls   *http2.Transport
+}
+
+var grpcBackend = &grpcTranscriber{
+	plain: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	},
+	tls: &http2.Transport{},
+}
+
+// URL HTTP/2 del método y el transporte que le corresponde
+func (g *grpcTranscriber) endpoint(baseURL, method string) (string, http.RoundTripper) {
+	if host, ok := strings.CutPrefix(baseURL, "grpcs://"); ok {
+		return "https://" + host + "/" + grpcService + "/" + method, g.tls
+	}
+	return "http://" + strings.TrimPrefix(baseURL, "grpc://") + "/" + grpcService + "/" + method, g.plain
+}
+
+func (g *grpcTranscriber) newRequest(ctx context.Context, baseURL, method, requestID string, body io.Reader) (*http.Request, http.RoundTripper, error) {
+	target, rt := g.endpoint(baseURL, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("TE", "trailers")
+	if requestID != "" {
+		req.Header.Set(requestIDHeader, requestID)
+	}
+	return req, rt, nil
+}
+
+// Mensaje con su prefijo de gRPC: sin comprimir y la longitud
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// Siguiente mensaje del stream; io.EOF al terminar
+func readGRPCFrame(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, errors.New("compressed gRPC messages are not supported")
+	}
+	n := binary.BigEndian.Uint32(header[1:])
+	if n > maxGRPCMessage {
+		return nil, errors.Errorf("gRPC message of %d bytes exceeds the limit", n)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return msg, nil
+}
+
+// grpc-status de los trailers, o de las cabeceras si el backend respondió
+// solo con trailers; false si aún no hay
+func grpcResponseStatus(resp *http.Response) (int, string, bool) {
+	raw, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if raw == "" {
+		raw, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if raw == "" {
+		return 0, "", false
+	}
+	if decoded, err := url.PathUnescape(message); err == nil {
+		message = decoded
+	}
+	code, err := strconv.Atoi(raw)
+	if err != nil {
+		return 2, raw, true // UNKNOWN
+	}
+	return code, message, true
+}
+
+// Como con HTTP: los fallos de la petición no se reintentan en otro backend
+func grpcStatusError(code int, message string) *backendError {
+	text := fmt.Sprintf("backend gRPC status %d: %s", code, message)
+	switch code {
+	case grpcUnavailable:
+		return &backendError{code: "BACKEND_UNAVAILABLE", message: text, retryable: true}
+	case grpcDeadlineExceeded:
+		return &backendError{code: "BACKEND_TIMEOUT", message: text, retryable: true}
+	case grpcInvalidArgument, grpcUnimplemented:
+		return &backendError{code: "BACKEND_ERROR", message: text}
+	}
+	return &backendError{code: "BACKEND_ERROR", message: text, retryable: true}
+}
+
+// Transcribe abre el stream bidireccional: manda la petición, publica cada
+// Segment como parcial y espera el Result. Pasado BACKEND_JOB_TIMEOUT le
+// manda un Cancel y, si no cierra en grpcCancelGrace, corta el stream. Un
+// Cancelled del backend (p. ej. al apagarse) se reintenta en otro.
+func (g *grpcTranscriber) transcribe(ctx context.Context, baseURL string, payload PythonRequest) (*BackendResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	// Con el envío abierto el transporte no mira el contexto: si quien
+	// espera se va, cerrarlo con error resetea el stream
+	go func() {
+		<-ctx.Done()
+		pw.CloseWithError(context.Canceled)
+	}()
+	req, rt, err := g.newRequest(ctx, baseURL, "Transcribe", payload.RequestID, pr)
+	if err != nil {
+		return nil, &backendError{code: "INTERNAL_ERROR", message: errors.Wrap(err, "failed to build backend request").Error()}
+	}
+
+	// El envío no bloquea la respuesta; el pipe serializa las escrituras
+	var sendMu sync.Mutex
+	send := func(msg []byte) {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		pw.Write(grpcFrame(msg))
+	}
+	payload.Partials.begin()
+	go send(encodeTranscribeInput(1, encodeTranscribeRequest(payload)))
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return nil, &backendError{code: "BACKEND_UNAVAILABLE", message: errors.Wrap(err, "failed to connect to whisper service").Error(), retryable: true}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &backendError{code: "BACKEND_ERROR", message: fmt.Sprintf("backend responded with HTTP status %d", resp.StatusCode), retryable: resp.StatusCode >= 500}
+	}
+	if code, message, ok := grpcResponseStatus(resp); ok && code != grpcOK {
+		return nil, grpcStatusError(code, message)
+	}
+
+	limit := live().BackendJobTimeout.Duration
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(limit, func() {
+		timedOut.Store(true)
+		go send(encodeTranscribeInput(2, protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), "gateway timeout")))
+		// Con el envío abierto el transporte no mira el contexto: cerrarlo
+		// con error resetea el stream
+		time.AfterFunc(grpcCancelGrace, func() {
+			cancel()
+			pw.CloseWithError(context.Canceled)
+		})
+	})
+	defer timer.Stop()
+
+	var result *BackendResponse
+	cancelledReason := ""
+	for {
+		msg, err := readGRPCFrame(resp.Body)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if timedOut.Load() {
+				return nil, &backendError{code: "BACKEND_TIMEOUT", message: fmt.Sprintf("backend did not finish within %s", limit), retryable: true}
+			}
+			return nil, &backendError{code: "BACKEND_UNAVAILABLE", message: errors.Wrap(err, "failed to read gRPC stream").Error(), retryable: true}
+		}
+		event, err := decodeTranscribeEvent(msg)
+		if err != nil {
+			return nil, &backendError{code: "INVALID_BACKEND_RESPONSE", message: errors.Wrap(err, "failed to decode gRPC event").Error(), retryable: true}
+		}
+		switch {
+		case event.segment != nil:
+			payload.Partials.add(*event.segment)
+		case event.result != nil:
+			result = event.result
+		case event.cancelled:
+			cancelledReason = event.reason
+		}
+	}
+	pw.Close()
+
+	code, message, ok := grpcResponseStatus(resp)
+	switch {
+	case timedOut.Load() && result == nil:
+		return nil, &backendError{code: "BACKEND_TIMEOUT", message: fmt.Sprintf("backend did not finish within %s", limit), retryable: true}
+	case !ok:
+		return nil, &backendError{code: "INVALID_BACKEND_RESPONSE", message: "gRPC stream ended without a status", retryable: true}
+	case code == grpcCancelled || cancelledReason != "":
+		if cancelledReason == "" {
+			cancelledReason = message
+		}
+		return nil, &backendError{code: "BACKEND_ERROR", message: "backend cancelled the transcription: " + cancelledReason, retryable: true}
+	case code != grpcOK:
+		return nil, grpcStatusError(code, message)
+	case result == nil:
+		return nil, &backendError{code: "INVALID_BACKEND_RESPONSE", message: "gRPC stream ended without a result", retryable: true}
+	}
+	result.normalize()
+	return result, nil
+}
+
+// Llamada unaria: el mensaje de respuesta y el grpc-status; err si no se
+// completó
+func (g *grpcTranscriber) unary(ctx context.Context, baseURL, method string, msg []byte) ([]byte, int, string, error) {
+	name := strings.ToLower(method)
+	req, rt, err := g.newRequest(ctx, baseURL, method, "", bytes.NewReader(grpcFrame(msg)))
+	if err != nil {
+		return nil, 0, "", errors.Wrap(err, "invalid backend URL")
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return nil, 0, "", errors.Wrapf(err, "%s request failed", name)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, "", errors.Errorf("%s endpoint responded with status %d", name, resp.StatusCode)
+	}
+	reply, err := readGRPCFrame(resp.Body)
+	if err != nil && err != io.EOF {
+		return nil, 0, "", errors.Wrapf(err, "%s request failed", name)
+	}
+	io.Copy(io.Discard, resp.Body)
+	code, message, ok := grpcResponseStatus(resp)
+	switch {
+	case !ok:
+		return nil, 0, "", errors.Errorf("%s response has no gRPC status", name)
+	case code == grpcOK && reply == nil:
+		return nil, 0, "", errors.Errorf("%s response has no message", name)
+	}
+	return reply, code, message, nil
+}
+
+// Capacity; un backend que no la implementa cuenta como sano, igual que
+// uno sin GET /capacity
+func (g *grpcTranscriber) capacity(ctx context.Context, baseURL string) (*BackendCapacity, bool, error) {
+	reply, code, message, err := g.unary(ctx, baseURL, "Capacity", nil)
+	switch {
+	case err != nil:
+		return nil, false, err
+	case code == grpcUnimplemented:
+		return nil, true, errors.New("backend does not implement Capacity")
+	case code != grpcOK:
+		return nil, false, errors.Errorf("capacity endpoint responded with gRPC status %d: %s", code, message)
+	}
+	capacity, err := decodeCapacityReply(reply)
+	if err != nil {
+		return nil, true, errors.Wrap(err, "invalid capacity payload")
+	}
+	return capacity, true, nil
+}
+
+// Warmup carga el modelo en el backend
+func (g *grpcTranscriber) warmup(ctx context.Context, baseURL, model string) error {
+	_, code, message, err := g.unary(ctx, baseURL, "Warmup", appendProtoString(nil, 1, model))
+	switch {
+	case err != nil:
+		return err
+	case code == grpcUnimplemented:
+		return errWarmupUnsupported
+	case code != grpcOK:
+		return errors.Errorf("warm-up failed with gRPC status %d: %s", code, message)
+	}
+	return nil
+}
+
+// Codificación de los mensajes
+
+func appendProtoString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	return protowire.AppendString(protowire.AppendTag(b, num, protowire.BytesType), s)
+}
+
+func appendProtoBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	return protowire.AppendVarint(protowire.AppendTag(b, num, protowire.VarintType), 1)
+}
+
+func encodeTranscribeRequest(p PythonRequest) []byte {
+	var b []byte
+	b = appendProtoString(b, 1, p.URL)
+	b = appendProtoString(b, 2, p.FilePath)
+	b = appendProtoString(b, 3, p.Language)
+	b = appendProtoBool(b, 4, p.Translate)
+	b = appendProtoString(b, 5, p.Model)
+	b = appendProtoBool(b, 6, p.Diarize)
+	b = appendProtoString(b, 7, p.Prompt)
+	if len(p.ClipTimestamps) > 0 {
+		var packed []byte
+		for _, t := range p.ClipTimestamps {
+			packed = protowire.AppendFixed64(packed, math.Float64bits(t))
+		}
+		b = protowire.AppendBytes(protowire.AppendTag(b, 8, protowire.BytesType), packed)
+	}
+	return appendProtoString(b, 9, p.RequestID)
+}
+
+// TranscribeInput con la petición (1) o un Cancel (2)
+func encodeTranscribeInput(num protowire.Number, msg []byte) []byte {
+	return protowire.AppendBytes(protowire.AppendTag(nil, num, protowire.BytesType), msg)
+}
+
+// Decodificación: los campos desconocidos se ignoran, como en protobuf
+
+var errWireType = errors.New("unexpected protobuf wire type")
+
+func protoFields(b []byte, field func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err := field(num, typ, b[:n]); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func protoBytes(typ protowire.Type, v []byte) ([]byte, error) {
+	if typ != protowire.BytesType {
+		return nil, errWireType
+	}
+	b, _ := protowire.ConsumeBytes(v)
+	return b, nil
+}
+
+func protoString(typ protowire.Type, v []byte, out *string) error {
+	b, err := protoBytes(typ, v)
+	*out = string(b)
+	return err
+}
+
+func protoDouble(typ protowire.Type, v []byte, out *float64) error {
+	if typ != protowire.Fixed64Type {
+		return errWireType
+	}
+	bits, _ := protowire.ConsumeFixed64(v)
+	*out = math.Float64frombits(bits)
+	return nil
+}
+
+func protoInt(typ protowire.Type, v []byte, out *int) error {
+	if typ != protowire.VarintType {
+		return errWireType
+	}
+	n, _ := protowire.ConsumeVarint(v)
+	*out = int(int32(n))
+	return nil
+}
+
+func decodeWord(b []byte) (Word, error) {
+	var w Word
+	err := protoFields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case 1:
+			return protoString(typ, v, &w.Word)
+		case 2:
+			return protoDouble(typ, v, &w.Start)
+		case 3:
+			return protoDouble(typ, v, &w.End)
+		case 4:
+			return protoDouble(typ, v, &w.Probability)
+		}
+		return nil
+	})
+	return w, err
+}
+
+func decodeSegment(b []byte) (Segment, error) {
+	var seg Segment
+	err := protoFields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case 1:
+			return protoInt(typ, v, &seg.ID)
+		case 2:
+			return protoDouble(typ, v, &seg.Start)
+		case 3:
+			return protoDouble(typ, v, &seg.End)
+		case 4:
+			return protoString(typ, v, &seg.Text)
+		case 5:
+			return protoString(typ, v, &seg.Language)
+		case 6:
+			return protoString(typ, v, &seg.Speaker)
+		case 7:
+			msg, err := protoBytes(typ, v)
+			if err != nil {
+				return err
+			}
+			w, err := decodeWord(msg)
+			seg.Words = append(seg.Words, w)
+			return err
+		case 8:
+			seg.AvgLogprob = new(float64)
+			return protoDouble(typ, v, seg.AvgLogprob)
+		case 9:
+			seg.NoSpeechProb = new(float64)
+			return protoDouble(typ, v, seg.NoSpeechProb)
+		}
+		return nil
+	})
+	return seg, err
+}
+
+func decodeChapter(b []byte) (Chapter, error) {
+	var ch Chapter
+	err := protoFields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case 1:
+			return protoString(typ, v, &ch.Title)
+		case 2:
+			return protoDouble(typ, v, &ch.Start)
+		case 3:
+			return protoDouble(typ, v, &ch.End)
+		}
+		return nil
+	})
+	return ch, err
+}
+
+func decodeResult(b []byte) (*BackendResponse, error) {
+	var r BackendResponse
+	err := protoFields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case 1:
+			return protoString(typ, v, &r.Transcription)
+		case 2:
+			return protoString(typ, v, &r.Translation)
+		case 3:
+			return protoString(typ, v, &r.Language)
+		case 4:
+			return protoString(typ, v, &r.ModelUsed)
+		case 5:
+			msg, err := protoBytes(typ, v)
+			if err != nil {
+				return err
+			}
+			seg, err := decodeSegment(msg)
+			r.Segments = append(r.Segments, seg)
+			return err
+		case 6:
+			msg, err := protoBytes(typ, v)
+			if err != nil {
+				return err
+			}
+			ch, err := decodeChapter(msg)
+			r.Chapters = append(r.Chapters, ch)
+			return err
+		}
+		return nil
+	})
+	return &r, err
+}
+
+// TranscribeEvent decodificado: un segmento, el resultado o Cancelled
+type transcribeEvent struct {
+	segment   *Segment
+	result    *BackendResponse
+	cancelled bool
+	reason    string
+}
+
+func decodeTranscribeEvent(b []byte) (*transcribeEvent, error) {
+	var event transcribeEvent
+	err := protoFields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		msg, err := protoBytes(typ, v)
+		if err != nil {
+			return err
+		}
+		switch num {
+		case 1:
+			seg, err := decodeSegment(msg)
+			event.segment = &seg
+			return err
+		case 2:
+			event.result, err = decodeResult(msg)
+			return err
+		case 3:
+			event.cancelled = true
+			return protoFields(msg, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if num == 1 {
+					return protoString(typ, v, &event.reason)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return &event, err
+}
+
+func decodeCapacityReply(b []byte) (*BackendCapacity, error) {
+	var c BackendCapacity
+	err := protoFields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case 1:
+			return protoInt(typ, v, &c.QueueLength)
+		case 2:
+			return protoDouble(typ, v, &c.GPUMemoryUsedMB)
+		case 3:
+			return protoDouble(typ, v, &c.GPUMemoryTotalMB)
+		case 4:
+			return protoString(typ, v, &c.ModelLoaded)
+		}
+		return nil
+	})
+	return &c, err
+}
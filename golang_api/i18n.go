@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Idiomas de los mensajes de error. Los códigos ("code") no se traducen:
+// son el contrato estable para los clientes.
+const (
+	LangEnglish = "en"
+	LangSpanish = "es"
+	LangYoruba  = "yo"
+)
+
+var supportedLanguages = []string{LangEnglish, LangSpanish, LangYoruba}
+
+const ctxLanguage = "language"
+
+func isSupportedLanguage(lang string) bool {
+	for _, l := range supportedLanguages {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// Traducciones de los mensajes de error fijos, por el texto en inglés. Si un
+// handler cambia el mensaje hay que cambiar la clave (lo comprueba
+// TestErrorMessagesAreProducible)
+var errorMessages = map[string]map[string]string{
+	LangSpanish: {
+		"job not found":                   "job no encontrado",
+		"webhook not found":               "webhook no encontrado",
+		"artifact not found":              "artefacto no encontrado",
+		"link expired or invalid":         "enlace caducado o no válido",
+		"url is required":                 "url es obligatoria",
+		"job_ids is required":             "job_ids es obligatorio",
+		"upload is empty":                 "la subida está vacía",
+		"upload not found":                "subida no encontrada",
+		"upload expired":                  "la subida caducó",
+		"upload is not complete":          "la subida no está completa",
+		"upload interrupted":              "subida interrumpida",
+		"url query parameter is required": "el parámetro de consulta url es obligatorio",
+		"unknown job type":                "tipo de job desconocido",
+		"missing or invalid API key":      "API key ausente o no válida",
+		"internal server error":           "error interno del servidor",
+		"result cache is not enabled":     "la caché de resultados no está habilitada",
+		"retry_after cannot be negative":  "retry_after no puede ser negativo",
+		"job has no timed segments":       "el job no tiene segmentos con tiempos",
+		"service is under maintenance":    "el servicio está en mantenimiento",
+		"model not found":                 "modelo no encontrado",
+		"template not found":              "plantilla no encontrada",
+		"template already exists":         "la plantilla ya existe",
+		"media has no audio stream":       "el medio no tiene pista de audio",
+		"segment not found":               "segmento no encontrado",
+		"segment id must be an integer":   "el ID de segmento debe ser un entero",
+		"job does not require review":     "el job no requiere revisión",
+		"review must be claimed first":    "primero hay que asignarse la revisión",
+		"job is already approved":         "el job ya está aprobado",
+		"unknown review_status":           "review_status desconocido",
+		"API key not found":               "API key no encontrada",
+		"API key is revoked":              "la API key está revocada",
+		"API key name already exists":     "ya existe una API key con ese nombre",
+		"at most 20 tags are allowed":     "se admiten como máximo 20 tags",
+		"tags must be 1 to 64 characters": "los tags deben tener de 1 a 64 caracteres",
+		"integration not found":           "integración no encontrada",
+		"provider cannot be changed":      "provider no se puede cambiar",
+		"access_token is required":        "access_token es obligatorio",
+		"invalid cursor":                  "cursor no válido",
+
+		"url and upload_id are mutually exclusive":          "url y upload_id son excluyentes",
+		"accuracy must be standard or high":                 "accuracy debe ser standard o high",
+		"sync mode requires media the gateway can download": "el modo síncrono requiere un medio que el gateway pueda descargar",
+		"sync mode only supports transcription":             "el modo síncrono solo admite transcripciones",
+		"subtitles are only available for completed jobs":   "los subtítulos solo están disponibles para jobs completados",
+		"only completed jobs can be aligned":                "solo se pueden alinear jobs completados",
+		"only completed jobs can be re-transcribed":         "solo se pueden retranscribir jobs completados",
+		"review is claimed by another assignee":             "la revisión está asignada a otra persona",
+		"clips require a completed transcription job":       "los clips requieren un job de transcripción completado",
+		"alignment backend is not configured":               "el backend de alineación no está configurado",
+		"maintenance mode is enabled in the configuration":  "el modo mantenimiento está activado en la configuración",
+		"expires_at must be in the future":                  "expires_at debe estar en el futuro",
+		"max_concurrent_jobs cannot be negative":            "max_concurrent_jobs no puede ser negativo",
+		"role must be viewer, editor or admin":              "role debe ser viewer, editor o admin",
+		"transcript_days must be between 0 and 3650":        "transcript_days debe estar entre 0 y 3650",
+		"limit must be between 1 and 1000":                  "limit debe estar entre 1 y 1000",
+		"format must be srt, vtt, ttml or scc":              "el formato debe ser srt, vtt, ttml o scc",
+		"at most 20 metadata entries are allowed":           "se admiten como máximo 20 entradas de metadata",
+		"metadata keys must be 1 to 64 characters":          "las claves de metadata deben tener de 1 a 64 caracteres",
+		"metadata values must be at most 256 characters":    "los valores de metadata deben tener como máximo 256 caracteres",
+		"erasure requires tenant, tags or metadata":         "el borrado requiere tenant, tags o metadata",
+		"erasure signing key is not configured":             "la clave de firma de los borrados no está configurada",
+		"parent_page_id is required for notion":             "parent_page_id es obligatorio para notion",
+		"status must be completed, failed or skipped":       "status debe ser completed, failed o skipped",
+		"limit must be between 1 and 100":                   "limit debe estar entre 1 y 100",
+		"content is not valid UTF-8":                        "el contenido no es UTF-8 válido",
+		"unsupported charset, send UTF-8":                   "charset no soportado; envía UTF-8",
+		"responses are only available in UTF-8":             "las respuestas solo están disponibles en UTF-8",
+		"the path and query string must be valid UTF-8":     "la ruta y la query deben ser UTF-8 válido",
+
+		// Anotaciones
+		"annotations require a completed job with its transcript": "las anotaciones requieren un job completado con su transcripción",
+		"annotation not found":                         "anotación no encontrada",
+		"author is required":                           "author es obligatorio",
+		"text is required":                             "text es obligatorio",
+		"start and end must be set together":           "start y end deben indicarse juntos",
+		"start and end, or segment_id, are required":   "se requieren start y end, o segment_id",
+		"start must be non-negative and not after end": "start no puede ser negativo ni posterior a end",
+		// Enlaces compartidos
+		"share signing key is not configured":                     "la clave de firma de los enlaces compartidos no está configurada",
+		"only completed jobs with their transcript can be shared": "solo se pueden compartir jobs completados con su transcripción",
+		"the transcript was deleted by the retention policy":      "la política de retención borró la transcripción",
+		"format must be html, json or embed":                      "format debe ser html, json o embed",
+
+		// Reproductor incrustado
+		"media_url is required":                               "media_url es obligatorio",
+		"media_url must be an absolute http(s) URL":           "media_url debe ser una URL http(s) absoluta",
+		"player must be audio or video":                       "player debe ser audio o video",
+		"the transcript is only available for completed jobs": "la transcripción solo está disponible para jobs completados",
+
+		// Estadísticas
+		"from and to must be dates as YYYY-MM-DD": "from y to deben ser fechas YYYY-MM-DD",
+		"from must not be after to":               "from no puede ser posterior a to",
+		"the range must be at most 366 days":      "el rango debe ser de como máximo 366 días",
+
+		// Exportación de metadatos
+		"format must be csv or parquet": "format debe ser csv o parquet",
+
+		// Diagnóstico
+		"debug endpoints require authentication to be enabled": "los endpoints de diagnóstico requieren la autenticación activada",
+
+		// Detección de idioma
+		"only_if_language must list language codes such as en or yo": "only_if_language debe listar códigos de idioma como en o yo",
+		"at most 20 languages are allowed in only_if_language":       "only_if_language admite como máximo 20 idiomas",
+
+		// Integraciones
+		"provider must be google_docs, notion, google_drive, dropbox, twilio, zoom, email, telegram, whatsapp, discord, s3, gcs, azure_blob, webdav or sftp": "provider debe ser google_docs, notion, google_drive, dropbox, twilio, zoom, email, telegram, whatsapp, discord, s3, gcs, azure_blob, webdav o sftp",
+	},
+	LangYoruba: {
+		"job not found":                   "a kò rí iṣẹ́ náà",
+		"webhook not found":               "a kò rí webhook náà",
+		"artifact not found":              "a kò rí fáìlì náà",
+		"link expired or invalid":         "ìjápọ̀ náà ti pé tàbí kò wúlò",
+		"url is required":                 "url jẹ́ dandan",
+		"job_ids is required":             "job_ids jẹ́ dandan",
+		"upload is empty":                 "fáìlì tí a gbé sókè ṣófo",
+		"upload not found":                "a kò rí fáìlì tí a gbé sókè",
+		"upload expired":                  "àkókò fáìlì tí a gbé sókè ti pé",
+		"upload is not complete":          "fáìlì tí a gbé sókè kò tíì pé",
+		"upload interrupted":              "ìgbésókè dá dúró",
+		"url query parameter is required": "paramita url jẹ́ dandan",
+		"unknown job type":                "irú iṣẹ́ tí a kò mọ̀",
+		"missing or invalid API key":      "API key kò sí tàbí kò wúlò",
+		"internal server error":           "àṣìṣe inú olupin",
+		"result cache is not enabled":     "ibi ìpamọ́ èsì kò ṣiṣẹ́",
+		"retry_after cannot be negative":  "retry_after kò lè jẹ́ òdì",
+		"job has no timed segments":       "iṣẹ́ náà kò ní àwọn apá tí ó ní àkókò",
+		"service is under maintenance":    "iṣẹ́ náà wà lábẹ́ àtúnṣe",
+		"model not found":                 "a kò rí àwòṣe náà",
+		"template not found":              "a kò rí àdàkọ náà",
+		"template already exists":         "àdàkọ náà ti wà tẹ́lẹ̀",
+		"media has no audio stream":       "fáìlì náà kò ní ohùn",
+		"segment not found":               "a kò rí apá náà",
+		"segment id must be an integer":   "ID apá gbọ́dọ̀ jẹ́ nọ́mbà odidi",
+		"job does not require review":     "iṣẹ́ náà kò nílò àyẹ̀wò",
+		"review must be claimed first":    "ẹ gbọ́dọ̀ kọ́kọ́ gba àyẹ̀wò náà",
+		"job is already approved":         "a ti fọwọ́ sí iṣẹ́ náà tẹ́lẹ̀",
+		"unknown review_status":           "a kò mọ review_status náà",
+		"API key not found":               "a kò rí API key náà",
+		"API key is revoked":              "a ti fagilé API key náà",
+		"API key name already exists":     "API key tí ó ní orúkọ yìí ti wà tẹ́lẹ̀",
+		"at most 20 tags are allowed":     "tags kò gbọ́dọ̀ ju 20 lọ",
+		"tags must be 1 to 64 characters": "tag kọ̀ọ̀kan gbọ́dọ̀ ní lẹ́tà 1 sí 64",
+		"integration not found":           "a kò rí ìsopọ̀ náà",
+		"provider cannot be changed":      "a kò lè yí provider padà",
+		"access_token is required":        "access_token jẹ́ dandan",
+		"invalid cursor":                  "cursor kò wúlò",
+
+		"url and upload_id are mutually exclusive":          "a kò lè lo url àti upload_id papọ̀",
+		"accuracy must be standard or high":                 "accuracy gbọ́dọ̀ jẹ́ standard tàbí high",
+		"sync mode requires media the gateway can download": "ipò lẹ́sẹ̀kẹsẹ̀ nílò fáìlì tí gateway lè gbà sílẹ̀",
+		"sync mode only supports transcription":             "ipò lẹ́sẹ̀kẹsẹ̀ ń ṣe àkọsílẹ̀ ohùn nìkan",
+		"subtitles are only available for completed jobs":   "àkọlé wà fún àwọn iṣẹ́ tí ó ti parí nìkan",
+		"only completed jobs can be aligned":                "iṣẹ́ tí ó ti parí nìkan ni a lè tò",
+		"only completed jobs can be re-transcribed":         "iṣẹ́ tí ó ti parí nìkan ni a lè tún kọ",
+		"review is claimed by another assignee":             "ẹlòmíràn ti gba àyẹ̀wò náà",
+		"clips require a completed transcription job":       "àwọn gégé nílò iṣẹ́ àkọsílẹ̀ tí ó ti parí",
+		"alignment backend is not configured":               "a kò tíì ṣètò backend ìtòlẹ́sẹẹsẹ",
+		"maintenance mode is enabled in the configuration":  "ipò àtúnṣe wà ní títàn nínú ètò",
+		"expires_at must be in the future":                  "expires_at gbọ́dọ̀ jẹ́ ọjọ́ iwájú",
+		"max_concurrent_jobs cannot be negative":            "max_concurrent_jobs kò lè jẹ́ òdì",
+		"role must be viewer, editor or admin":              "role gbọ́dọ̀ jẹ́ viewer, editor tàbí admin",
+		"transcript_days must be between 0 and 3650":        "transcript_days gbọ́dọ̀ wà láàárín 0 àti 3650",
+		"limit must be between 1 and 1000":                  "limit gbọ́dọ̀ wà láàárín 1 àti 1000",
+		"format must be srt, vtt, ttml or scc":              "ọ̀nà kíkọ gbọ́dọ̀ jẹ́ srt, vtt, ttml tàbí scc",
+		"at most 20 metadata entries are allowed":           "metadata kò gbọ́dọ̀ ju 20 lọ",
+		"metadata keys must be 1 to 64 characters":          "kọ́kọ́rọ́ metadata gbọ́dọ̀ ní lẹ́tà 1 sí 64",
+		"metadata values must be at most 256 characters":    "iye metadata kò gbọ́dọ̀ ju lẹ́tà 256 lọ",
+		"erasure requires tenant, tags or metadata":         "píparẹ́ nílò tenant, tags tàbí metadata",
+		"erasure signing key is not configured":             "a kò tíì ṣètò kọ́kọ́rọ́ ìbuwọ́lù píparẹ́",
+		"parent_page_id is required for notion":             "parent_page_id jẹ́ dandan fún notion",
+		"status must be completed, failed or skipped":       "status gbọ́dọ̀ jẹ́ completed, failed tàbí skipped",
+		"limit must be between 1 and 100":                   "limit gbọ́dọ̀ wà láàárín 1 àti 100",
+		"content is not valid UTF-8":                        "ọ̀rọ̀ náà kì í ṣe UTF-8 tó wúlò",
+		"unsupported charset, send UTF-8":                   "a kò ṣe àtìlẹ́yìn fún charset yìí; fi UTF-8 ránṣẹ́",
+		"responses are only available in UTF-8":             "àwọn èsì wà ní UTF-8 nìkan",
+		"the path and query string must be valid UTF-8":     "ọ̀nà àti query gbọ́dọ̀ jẹ́ UTF-8 tó wúlò",
+
+		// Anotaciones
+		"annotations require a completed job with its transcript": "àkíyèsí nílò iṣẹ́ tí ó ti parí pẹ̀lú àkọsílẹ̀ rẹ̀",
+		"annotation not found":                         "a kò rí àkíyèsí náà",
+		"author is required":                           "author jẹ́ dandan",
+		"text is required":                             "text jẹ́ dandan",
+		"start and end must be set together":           "start àti end gbọ́dọ̀ wà papọ̀",
+		"start and end, or segment_id, are required":   "start àti end, tàbí segment_id, jẹ́ dandan",
+		"start must be non-negative and not after end": "start kò gbọdọ̀ kéré sí òdo tàbí kọjá end",
+		// Enlaces compartidos
+		"share signing key is not configured":                     "a kò tíì ṣètò kọ́kọ́rọ́ ìbuwọ́lù fún àwọn ìjápọ̀ pínpín",
+		"only completed jobs with their transcript can be shared": "iṣẹ́ tí ó ti parí pẹ̀lú àkọsílẹ̀ rẹ̀ nìkan ni a lè pín",
+		"the transcript was deleted by the retention policy":      "ìlànà ìpamọ́ ti pa àkọsílẹ̀ náà rẹ́",
+		"format must be html, json or embed":                      "format gbọ́dọ̀ jẹ́ html, json tàbí embed",
+
+		// Reproductor incrustado
+		"media_url is required":                               "media_url jẹ́ dandan",
+		"media_url must be an absolute http(s) URL":           "media_url gbọ́dọ̀ jẹ́ URL http(s) pípé",
+		"player must be audio or video":                       "player gbọ́dọ̀ jẹ́ audio tàbí video",
+		"the transcript is only available for completed jobs": "àkọsílẹ̀ wà fún àwọn iṣẹ́ tí ó ti parí nìkan",
+
+		// Estadísticas
+		"from and to must be dates as YYYY-MM-DD": "from àti to gbọ́dọ̀ jẹ́ ọjọ́ YYYY-MM-DD",
+		"from must not be after to":               "from kò gbọdọ̀ kọjá to",
+		"the range must be at most 366 days":      "ìgbà náà kò gbọdọ̀ ju ọjọ́ 366 lọ",
+
+		// Exportación de metadatos
+		"format must be csv or parquet": "format gbọ́dọ̀ jẹ́ csv tàbí parquet",
+
+		// Diagnóstico
+		"debug endpoints require authentication to be enabled": "àwọn endpoint àyẹ̀wò nílò kí ìjẹ́rìísí wà ní títàn",
+
+		// Detección de idioma
+		"only_if_language must list language codes such as en or yo": "only_if_language gbọ́dọ̀ ní àwọn kóòdù èdè bíi en tàbí yo",
+		"at most 20 languages are allowed in only_if_language":       "only_if_language kò gbọ́dọ̀ ju èdè 20 lọ",
+
+		// Integraciones
+		"provider must be google_docs, notion, google_drive, dropbox, twilio, zoom, email, telegram, whatsapp, discord, s3, gcs, azure_blob, webdav or sftp": "provider gbọ́dọ̀ jẹ́ google_docs, notion, google_drive, dropbox, twilio, zoom, email, telegram, whatsapp, discord, s3, gcs, azure_blob, webdav tàbí sftp",
+	},
+}
+
+// Mensaje genérico por código para los errores con detalles variables
+var errorCodeMessages = map[string]map[string]string{
+	LangSpanish: {
+		"UNAUTHORIZED":              "autenticación requerida",
+		"FORBIDDEN":                 "el rol de la API key no permite esta operación",
+		"CONCURRENCY_LIMIT":         "la API key alcanzó su límite de jobs simultáneos",
+		"TIMEOUT":                   "la petición superó el tiempo máximo",
+		"DEADLINE_EXCEEDED":         "la transcripción no terminó a tiempo",
+		"MAINTENANCE":               "el servicio está en mantenimiento",
+		"MAINTENANCE_FORCED":        "el modo mantenimiento está activado en la configuración",
+		"INVALID_URL":               "URL no válida",
+		"INVALID_REQUEST":           "petición no válida",
+		"UNKNOWN_MODEL":             "modelo desconocido",
+		"UNKNOWN_TEMPLATE":          "plantilla desconocida",
+		"DOWNLOAD_FAILED":           "no se pudo descargar el medio",
+		"CHECKSUM_MISMATCH":         "el sha256 del medio no coincide con el esperado",
+		"PROBE_FAILED":              "no se pudo analizar el medio",
+		"AUDIO_TOO_LONG":            "el audio es demasiado largo para el modo síncrono; usa POST /process",
+		"UNSUPPORTED_MEDIA":         "formato de medio no soportado",
+		"NO_SPEECH":                 "el medio apenas contiene voz",
+		"UNSUPPORTED_ENCODING":      "Content-Encoding debe ser gzip, zstd o identity",
+		"UPLOAD_TOO_LARGE":          "la subida supera el tamaño máximo",
+		"UPLOAD_NOT_FOUND":          "subida no encontrada",
+		"REVIEW_CONFLICT":           "la revisión no admite esa transición",
+		"BACKEND_UNAVAILABLE":       "el servicio de transcripción no está disponible",
+		"OIDC_UNAVAILABLE":          "el proveedor de identidad no está disponible",
+		"BACKEND_ERROR":             "el servicio de transcripción devolvió un error",
+		"INVALID_BACKEND_RESPONSE":  "respuesta no válida del servicio de transcripción",
+		"BACKEND_CONTRACT_MISMATCH": "la respuesta del servicio de transcripción no cumple el contrato",
+		"ALIGNMENT_FAILED":          "falló la alineación",
+		"RENDER_FAILED":             "falló el renderizado",
+		"STORAGE_FAILED":            "falló el almacenamiento",
+		"STATE_UNAVAILABLE":         "el almacén de estado no está disponible",
+		"INTERNAL_ERROR":            "error interno del servidor",
+		"NOT_ACCEPTABLE":            "las respuestas solo están disponibles en UTF-8",
+		"UNSUPPORTED_CHARSET":       "charset no soportado; envía UTF-8",
+		"INVALID_CHARSET":           "el texto no es UTF-8 válido",
+		"ANNOTATION_LIMIT":          "el job alcanzó el máximo de anotaciones",
+		// Enlaces compartidos
+		"SHARE_NOT_CONFIGURED": "los enlaces compartidos no están configurados",
+		// Keys de sandbox
+		"SANDBOX_UNSUPPORTED": "la operación no está disponible con keys de sandbox",
+		// Peticiones firmadas
+		"SIGNATURE_REQUIRED": "esta API key solo admite peticiones firmadas",
+		"INVALID_SIGNATURE":  "la firma de la petición no es válida",
+		"SIGNATURE_EXPIRED":  "el timestamp de la petición está fuera de la ventana admitida",
+		"REPLAYED_REQUEST":   "la firma de la petición ya se usó",
+		// Keys limitadas por IP
+		"IP_NOT_ALLOWED": "esta API key no se acepta desde esta dirección IP",
+		// Recarga de la configuración
+		"INVALID_CONFIG": "la nueva configuración no es válida; se mantiene la actual",
+		// Feature flags
+		"FEATURE_DISABLED": "esta función no está activa para el tenant",
+		// Protocolo v2 con los backends
+		"BACKEND_TIMEOUT": "el servicio de transcripción no terminó a tiempo",
+	},
+	LangYoruba: {
+		"UNAUTHORIZED":              "ìjẹ́rìísí jẹ́ dandan",
+		"FORBIDDEN":                 "ipa API key yìí kò gba iṣẹ́ yìí láàyè",
+		"CONCURRENCY_LIMIT":         "API key ti dé òpin iṣẹ́ tí ó lè ṣe lẹ́ẹ̀kan náà",
+		"TIMEOUT":                   "àkókò ìbéèrè ti kọjá",
+		"DEADLINE_EXCEEDED":         "àkọsílẹ̀ kò parí ní àkókò",
+		"MAINTENANCE":               "iṣẹ́ náà wà lábẹ́ àtúnṣe",
+		"MAINTENANCE_FORCED":        "ipò àtúnṣe wà ní títàn nínú ètò",
+		"INVALID_URL":               "URL kò wúlò",
+		"INVALID_REQUEST":           "ìbéèrè kò wúlò",
+		"UNKNOWN_MODEL":             "a kò mọ àwòṣe náà",
+		"UNKNOWN_TEMPLATE":          "a kò mọ àdàkọ náà",
+		"DOWNLOAD_FAILED":           "a kò lè gba fáìlì náà sílẹ̀",
+		"CHECKSUM_MISMATCH":         "sha256 fáìlì náà kò bá èyí tí a retí mu",
+		"PROBE_FAILED":              "a kò lè ṣàyẹ̀wò fáìlì náà",
+		"AUDIO_TOO_LONG":            "ohùn náà gùn jù fún ipò lẹ́sẹ̀kẹsẹ̀; lo POST /process",
+		"UNSUPPORTED_MEDIA":         "a kò ṣe àtìlẹ́yìn fún irú fáìlì yìí",
+		"NO_SPEECH":                 "ohùn ọ̀rọ̀ kò fẹ́rẹ̀ sí nínú fáìlì náà",
+		"UNSUPPORTED_ENCODING":      "Content-Encoding gbọ́dọ̀ jẹ́ gzip, zstd tàbí identity",
+		"UPLOAD_TOO_LARGE":          "fáìlì tí a gbé sókè tóbi jù",
+		"UPLOAD_NOT_FOUND":          "a kò rí fáìlì tí a gbé sókè",
+		"REVIEW_CONFLICT":           "àyẹ̀wò náà kò gba ìyípadà yìí",
+		"BACKEND_UNAVAILABLE":       "iṣẹ́ àkọsílẹ̀ kò sí ní àrọ́wọ́tó",
+		"OIDC_UNAVAILABLE":          "olùpèsè ìdánimọ̀ kò sí ní àrọ́wọ́tó",
+		"BACKEND_ERROR":             "iṣẹ́ àkọsílẹ̀ dá àṣìṣe padà",
+		"INVALID_BACKEND_RESPONSE":  "èsì iṣẹ́ àkọsílẹ̀ kò wúlò",
+		"BACKEND_CONTRACT_MISMATCH": "èsì iṣẹ́ àkọsílẹ̀ kò bá àdéhùn mu",
+		"ALIGNMENT_FAILED":          "ìtòlẹ́sẹẹsẹ kùnà",
+		"RENDER_FAILED":             "ṣíṣe fídíò kùnà",
+		"STORAGE_FAILED":            "ìpamọ́ kùnà",
+		"STATE_UNAVAILABLE":         "ibi ìpamọ́ ipò kò sí ní àrọ́wọ́tó",
+		"INTERNAL_ERROR":            "àṣìṣe inú olupin",
+		"NOT_ACCEPTABLE":            "àwọn èsì wà ní UTF-8 nìkan",
+		"UNSUPPORTED_CHARSET":       "a kò ṣe àtìlẹ́yìn fún charset yìí; fi UTF-8 ránṣẹ́",
+		"INVALID_CHARSET":           "ọ̀rọ̀ náà kì í ṣe UTF-8 tó wúlò",
+		"ANNOTATION_LIMIT":          "iṣẹ́ náà ti dé òpin àkíyèsí",
+		// Enlaces compartidos
+		"SHARE_NOT_CONFIGURED": "a kò tíì ṣètò àwọn ìjápọ̀ pínpín",
+		// Keys de sandbox
+		"SANDBOX_UNSUPPORTED": "iṣẹ́ yìí kò ṣeé ṣe pẹ̀lú kọ́kọ́rọ́ ìdánwò",
+		// Peticiones firmadas
+		"SIGNATURE_REQUIRED": "API key yìí gba ìbéèrè tí a fọwọ́ sí nìkan",
+		"INVALID_SIGNATURE":  "ìfọwọ́sí ìbéèrè náà kò wúlò",
+		"SIGNATURE_EXPIRED":  "àkókò ìbéèrè náà kọjá ààlà tí a gbà",
+		"REPLAYED_REQUEST":   "a ti lo ìfọwọ́sí ìbéèrè yìí tẹ́lẹ̀",
+		// Keys limitadas por IP
+		"IP_NOT_ALLOWED": "a kò gba API key yìí láti àdírẹ́sì IP yìí",
+		// Recarga de la configuración
+		"INVALID_CONFIG": "ètò tuntun náà kò tọ́; a ń lo ti ìsinsìnyí",
+		// Feature flags
+		"FEATURE_DISABLED": "iṣẹ́ yìí kò ṣí sílẹ̀ fún tenant yìí",
+		// Protocolo v2 con los backends
+		"BACKEND_TIMEOUT": "iṣẹ́ àkọsílẹ̀ kò parí lásìkò",
+	},
+}
+
+// Idioma preferido según Accept-Language (con pesos q); si ninguno está
+// soportado, ERROR_LANGUAGE
+func negotiateLanguage(header string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		// es-MX, yo-NG... cuentan como su idioma base
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if q > 0 && isSupportedLanguage(lang) {
+			candidates = append(candidates, candidate{lang, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return cfg.ErrorLanguage
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].lang
+}
+
+// Idioma de los errores de la petición
+func requestLanguage(c *gin.Context) string {
+	if lang := c.GetString(ctxLanguage); lang != "" {
+		return lang
+	}
+	return cfg.ErrorLanguage
+}
+
+// Traduce el mensaje de un error. Con el código solo se conoce un mensaje
+// genérico, así que el original (en inglés) se devuelve como detalle.
+func localizeError(lang, message, code string) (localized, detail string, ok bool) {
+	if text, found := errorMessages[lang][message]; found {
+		return text, "", true
+	}
+	if text, found := errorCodeMessages[lang][code]; found {
+		return text, message, true
+	}
+	return message, "", false
+}
+
+// Añade request_id a los errores JSON y traduce su mensaje al idioma de la
+// petición, sin tocar cada handler
+func errorBodyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lang := negotiateLanguage(c.GetHeader("Accept-Language"))
+		c.Set(ctxLanguage, lang)
+		c.Writer = &errorBodyWriter{ResponseWriter: c.Writer, requestID: requestID(c), lang: lang}
+		c.Next()
+	}
+}
+
+type errorBodyWriter struct {
+	gin.ResponseWriter
+	requestID string
+	lang      string
+}
+
+func (w *errorBodyWriter) Write(data []byte) (int, error) {
+	if w.Written() || w.Status() < 400 || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return w.ResponseWriter.Write(data)
+	}
+	var body map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if decoder.Decode(&body) != nil {
+		return w.ResponseWriter.Write(data)
+	}
+
+	if w.requestID != "" {
+		body["request_id"] = w.requestID
+	}
+	if message, ok := body["error"].(string); ok && w.lang != LangEnglish {
+		code, _ := body["code"].(string)
+		if localized, detail, ok := localizeError(w.lang, message, code); ok {
+			body["error"] = localized
+			if detail != "" {
+				body["detail"] = detail
+			}
+			w.Header().Set("Content-Language", w.lang)
+		}
+	}
+	rewritten, err := json.Marshal(body)
+	if err != nil {
+		return w.ResponseWriter.Write(data)
+	}
+	if _, err := w.ResponseWriter.Write(rewritten); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
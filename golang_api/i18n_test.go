@@ -0,0 +1,119 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var formatVerb = regexp.MustCompile(`%[-+# 0-9.]*[dsqvf]`)
+
+// Textos que el código del gateway puede producir: los literales tal cual y
+// los formatos de errors.Errorf/fmt.Sprintf como expresiones regulares. Un
+// %s solo cubre una palabra para que "%s" no case con cualquier mensaje.
+func producibleMessages(t *testing.T) (map[string]bool, []*regexp.Regexp) {
+	t.Helper()
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	literals := map[string]bool{}
+	var formats []*regexp.Regexp
+	for _, pkg := range pkgs {
+		ast.Inspect(pkg, func(n ast.Node) bool {
+			// Las claves de los catálogos no cuentan como mensajes producidos
+			if spec, ok := n.(*ast.ValueSpec); ok && len(spec.Names) == 1 &&
+				(spec.Names[0].Name == "errorMessages" || spec.Names[0].Name == "errorCodeMessages") {
+				return false
+			}
+			lit, ok := n.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			text, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				return true
+			}
+			literals[text] = true
+			if formatVerb.MatchString(text) {
+				pattern := "^"
+				rest := text
+				for _, loc := range formatVerb.FindAllStringIndex(text, -1) {
+					offset := len(text) - len(rest)
+					pattern += regexp.QuoteMeta(rest[:loc[0]-offset])
+					switch text[loc[1]-1] {
+					case 'd':
+						pattern += `-?\d+`
+					case 'f':
+						pattern += `-?[\d.]+`
+					default:
+						pattern += `\S+`
+					}
+					rest = text[loc[1]:]
+				}
+				formats = append(formats, regexp.MustCompile(pattern+regexp.QuoteMeta(rest)+"$"))
+			}
+			return true
+		})
+	}
+	return literals, formats
+}
+
+// Las traducciones van por el texto en inglés: si un handler cambia el
+// mensaje y no se actualiza la clave, el error se sirve sin traducir
+func TestErrorMessagesAreProducible(t *testing.T) {
+	literals, formats := producibleMessages(t)
+	producible := func(message string) bool {
+		if literals[message] {
+			return true
+		}
+		for _, format := range formats {
+			if format.MatchString(message) {
+				return true
+			}
+		}
+		return false
+	}
+	for lang, messages := range errorMessages {
+		for message := range messages {
+			if !producible(message) {
+				t.Errorf("%s: no handler produces %q", lang, message)
+			}
+		}
+	}
+	for lang, messages := range errorCodeMessages {
+		for code := range messages {
+			if !literals[code] {
+				t.Errorf("%s: no handler answers with code %q", lang, code)
+			}
+		}
+	}
+}
+
+func TestErrorMessagesSameKeys(t *testing.T) {
+	keys := func(m map[string]string) []string {
+		var out []string
+		for k := range m {
+			out = append(out, k)
+		}
+		sort.Strings(out)
+		return out
+	}
+	for _, catalog := range []map[string]map[string]string{errorMessages, errorCodeMessages} {
+		want := keys(catalog[LangSpanish])
+		for lang, messages := range catalog {
+			if got := keys(messages); strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("%s translates %d messages, %s translates %d", lang, len(got), LangSpanish, len(want))
+			}
+		}
+	}
+}
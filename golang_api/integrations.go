@@ -0,0 +1,1130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Nombre del ajuste compartido con las integraciones de los tenants
+const integrationsSetting = "integrations"
+
+// Destinos a los que se exportan las transcripciones completadas
+const (
+	ProviderGoogleDocs = "google_docs"
+	ProviderNotion     = "notion"
+)
+
+// Almacenes a los que se copian los artefactos (txt, srt y json) de las
+// transcripciones completadas
+const (
+	ProviderS3        = "s3"
+	ProviderGCS       = "gcs"
+	ProviderAzureBlob = "azure_blob"
+	ProviderWebDAV    = "webdav"
+	ProviderSFTP      = "sftp"
+)
+
+// Carpetas vigiladas: sus audios nuevos se transcriben y el .txt y el .srt
+// se escriben al lado
+const (
+	ProviderGoogleDrive = "google_drive"
+	ProviderDropbox     = "dropbox"
+)
+
+// Fuentes que avisan de sus grabaciones: cada una crea un job
+const (
+	ProviderTwilio = "twilio"
+	ProviderZoom   = "zoom"
+	ProviderEmail  = "email"
+)
+
+// Bots de mensajería: sus notas de voz se transcriben y se responde en el
+// chat con el texto
+const (
+	ProviderTelegram = "telegram"
+	ProviderWhatsApp = "whatsapp"
+	ProviderDiscord  = "discord"
+)
+
+// Máximo de integraciones por tenant
+const maxIntegrationsPerTenant = 10
+
+// Versión de la API de Notion con la que se crean las páginas
+const notionVersion = "2022-06-28"
+
+// Límites de Notion: caracteres por bloque de texto y bloques por petición
+const (
+	notionMaxBlockText = 2000
+	notionMaxBlocks    = 100
+)
+
+var errTooManyIntegrations = errors.Errorf("at most %d integrations per tenant", maxIntegrationsPerTenant)
+
+// Integración de un tenant. Los tokens OAuth nunca se devuelven.
+type Integration struct {
+	ID           string    `json:"id"`
+	Provider     string    `json:"provider"`
+	Name         string    `json:"name,omitempty"`
+	FolderID     string    `json:"folder_id,omitempty"`      // google_docs: carpeta de Drive; vacía = raíz
+	ParentPageID string    `json:"parent_page_id,omitempty"` // notion: página bajo la que se crean
+	Enabled      bool      `json:"enabled"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// Carpetas vigiladas (google_drive usa folder_id)
+	Path         string     `json:"path,omitempty"`     // dropbox: carpeta; vacía = raíz
+	Template     string     `json:"template,omitempty"` // plantilla del tenant con las opciones de los jobs
+	LastPolledAt *time.Time `json:"last_polled_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"` // del último sondeo; vacío si fue bien
+
+	// twilio: cuenta de la que se aceptan los callbacks (access_token es su auth token)
+	AccountSID string `json:"account_sid,omitempty"`
+
+	// zoom: cuenta de la que se aceptan los webhooks
+	AccountID string `json:"account_id,omitempty"`
+
+	// email: dirección a la que se envían los audios y remitentes admitidos
+	// (direcciones o @dominio), a los que se responde con la transcripción
+	Address        string   `json:"address,omitempty"`
+	AllowedSenders []string `json:"allowed_senders,omitempty"`
+
+	// whatsapp: número de WhatsApp Business cuyos mensajes se aceptan
+	PhoneNumberID string `json:"phone_number_id,omitempty"`
+
+	// discord: aplicación del bot y clave pública con la que se firman las
+	// interacciones
+	ApplicationID string `json:"application_id,omitempty"`
+	PublicKey     string `json:"public_key,omitempty"`
+
+	// Almacenes: dónde y qué se copia. access_token es la secret key (s3 y
+	// gcs, con la clave HMAC), el SAS del contenedor (azure_blob) o la
+	// contraseña (webdav); sftp usa las credenciales del host del tenant
+	Bucket       string   `json:"bucket,omitempty"`        // s3 y gcs
+	Endpoint     string   `json:"endpoint,omitempty"`      // s3: URL de un servicio compatible; vacío = AWS
+	Region       string   `json:"region,omitempty"`        // s3
+	AccessKeyID  string   `json:"access_key_id,omitempty"` // s3 y gcs
+	URL          string   `json:"url,omitempty"`           // azure_blob: URL del contenedor; webdav: colección base; sftp: sftp://host/carpeta
+	Username     string   `json:"username,omitempty"`      // webdav
+	PathTemplate string   `json:"path_template,omitempty"` // con {job_id}, {date} y {ext}
+	Formats      []string `json:"formats,omitempty"`       // txt, srt, json, ttml y scc; vacío = txt, srt y json
+
+	tenant string
+	token  integrationToken
+	cursor string // hasta dónde se sondeó la carpeta
+}
+
+type integrationToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"` // Google y Dropbox
+	Expiry       time.Time `json:"expiry,omitempty"`
+
+	// zoom: secret token de la app con el que se firman los webhooks; email:
+	// signing key de Mailgun o contraseña de la URL de SendGrid; telegram:
+	// secret_token de setWebhook; whatsapp: app secret
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+
+	// whatsapp: verify token de la suscripción del webhook
+	VerifyToken string `json:"verify_token,omitempty"`
+}
+
+// Cuerpo de POST y PATCH /integrations; en PATCH los campos ausentes no
+// cambian y provider no se puede cambiar
+type IntegrationBody struct {
+	Provider     string  `json:"provider"`
+	Name         *string `json:"name"`
+	FolderID     *string `json:"folder_id"`
+	ParentPageID *string `json:"parent_page_id"`
+	Path         *string `json:"path"`
+	Template     *string `json:"template"`
+	AccountSID   *string `json:"account_sid"`
+	Enabled      *bool   `json:"enabled"`
+	AccessToken  *string `json:"access_token"`
+	RefreshToken *string `json:"refresh_token"`
+
+	// zoom
+	AccountID     *string `json:"account_id"`
+	WebhookSecret *string `json:"webhook_secret"`
+
+	// email; allowed_senders ausente no cambia
+	Address        *string  `json:"address"`
+	AllowedSenders []string `json:"allowed_senders"`
+
+	// whatsapp
+	PhoneNumberID *string `json:"phone_number_id"`
+	VerifyToken   *string `json:"verify_token"`
+
+	// discord
+	ApplicationID *string `json:"application_id"`
+	PublicKey     *string `json:"public_key"`
+
+	// almacenes; formats ausente no cambia
+	Bucket       *string  `json:"bucket"`
+	Endpoint     *string  `json:"endpoint"`
+	Region       *string  `json:"region"`
+	AccessKeyID  *string  `json:"access_key_id"`
+	URL          *string  `json:"url"`
+	Username     *string  `json:"username"`
+	PathTemplate *string  `json:"path_template"`
+	Formats      []string `json:"formats"`
+}
+
+// Copia persistente; Token es el JSON de los tokens, cifrado si hay
+// ENCRYPTION_MASTER_KEY o ENCRYPTION_KMS_URL
+type IntegrationRecord struct {
+	Integration
+	Tenant string `json:"tenant"`
+	Token  string `json:"token"`
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// Estados de JobDelivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+	DeliveryCanceled  = "canceled" // la integración se borró o desactivó, o el job se purgó
+)
+
+// Entrega de un job completado a una integración de exportación
+type JobDelivery struct {
+	IntegrationID string    `json:"integration_id"`
+	Provider      string    `json:"provider"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts,omitempty"`
+	Message       string    `json:"message,omitempty"` // adónde se entregó o el último error
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Documento que se exporta al completarse un job
+type integrationExport struct {
+	JobID       string `json:"job_id"`
+	Title       string `json:"title"`
+	Text        string `json:"text"`
+	Translation string `json:"translation,omitempty"`
+}
+
+type integrationRegistry struct {
+	mu    sync.RWMutex
+	items map[string]*Integration
+}
+
+var integrations = &integrationRegistry{items: make(map[string]*Integration)}
+
+func (h *Integration) public() *Integration {
+	out := *h
+	out.token = integrationToken{}
+	return &out
+}
+
+// Requiere r.mu tomado
+func (r *integrationRegistry) persistLocked() error {
+	if stateStore == nil {
+		return nil
+	}
+	records := make([]IntegrationRecord, 0, len(r.items))
+	for _, item := range r.items {
+		token, err := json.Marshal(item.token)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal integration token")
+		}
+		rec := IntegrationRecord{Integration: *item, Tenant: item.tenant, Token: string(token), Cursor: item.cursor}
+		if encryption != nil {
+			if rec.Token, err = encryption.seal(tenantScope(item.tenant), token); err != nil {
+				return err
+			}
+		}
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].CreatedAt.Before(records[j].CreatedAt) })
+	data, err := json.Marshal(records)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal integrations")
+	}
+	return stateStore.SaveSetting(integrationsSetting, data)
+}
+
+func refreshIntegrations() error {
+	data, err := stateStore.LoadSetting(integrationsSetting)
+	if err != nil || data == nil {
+		return err
+	}
+	var records []IntegrationRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return errors.Wrap(err, "corrupt integrations")
+	}
+	items := make(map[string]*Integration, len(records))
+	for _, rec := range records {
+		item := rec.Integration
+		item.tenant = rec.Tenant
+		item.cursor = rec.Cursor
+		token := []byte(rec.Token)
+		if isSealed(rec.Token) {
+			if token, err = encryption.open(tenantScope(rec.Tenant), rec.Token); err != nil {
+				return errors.Wrapf(err, "integration %s", rec.ID)
+			}
+		}
+		if err := json.Unmarshal(token, &item.token); err != nil {
+			return errors.Wrapf(err, "corrupt token of integration %s", rec.ID)
+		}
+		items[item.ID] = &item
+	}
+	integrations.mu.Lock()
+	integrations.items = items
+	integrations.mu.Unlock()
+	return nil
+}
+
+func (r *integrationRegistry) list(tenant string) []*Integration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := []*Integration{}
+	for _, item := range r.items {
+		if item.tenant == tenant {
+			out = append(out, item.public())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// Integración del tenant sin tokens; nil si no existe o es de otro tenant
+func (r *integrationRegistry) get(tenant, id string) *Integration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	item, ok := r.items[id]
+	if !ok || item.tenant != tenant {
+		return nil
+	}
+	return item.public()
+}
+
+// Copia completa (con tokens) para exportar
+func (r *integrationRegistry) lookup(id string) (Integration, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	item, ok := r.items[id]
+	if !ok {
+		return Integration{}, false
+	}
+	return *item, true
+}
+
+func (r *integrationRegistry) create(tenant string, item *Integration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, i := range r.items {
+		if i.tenant == tenant {
+			count++
+		}
+	}
+	if count >= maxIntegrationsPerTenant {
+		return errTooManyIntegrations
+	}
+	item.tenant = tenant
+	r.items[item.ID] = item
+	if err := r.persistLocked(); err != nil {
+		delete(r.items, item.ID)
+		return err
+	}
+	return nil
+}
+
+// Aplica fn a la integración del tenant (tenant vacío: cualquiera) y
+// devuelve la copia resultante; nil si no existe
+func (r *integrationRegistry) update(tenant, id string, fn func(item *Integration)) (*Integration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	item, ok := r.items[id]
+	if !ok || (tenant != "" && item.tenant != tenant) {
+		return nil, nil
+	}
+	previous := *item
+	fn(item)
+	item.UpdatedAt = time.Now()
+	if err := r.persistLocked(); err != nil {
+		*item = previous
+		return nil, err
+	}
+	return item.public(), nil
+}
+
+func (r *integrationRegistry) delete(tenant, id string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	item, ok := r.items[id]
+	if !ok || item.tenant != tenant {
+		return false, nil
+	}
+	delete(r.items, id)
+	if err := r.persistLocked(); err != nil {
+		r.items[id] = item
+		return false, err
+	}
+	return true, nil
+}
+
+// IDs de las exportaciones activas del tenant
+func (r *integrationRegistry) active(tenant string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []string
+	for _, item := range r.items {
+		if item.tenant == tenant && item.Enabled && isExportProvider(item.Provider) {
+			out = append(out, item.ID)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Copias completas de las integraciones activas del proveedor y la cuenta
+// (account_sid, account_id, address o phone_number_id; vacía = todas), de
+// cualquier tenant:
+// la firma del callback decide cuál es
+func (r *integrationRegistry) accounts(provider, account string) []Integration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []Integration
+	for _, item := range r.items {
+		if !item.Enabled || item.Provider != provider {
+			continue
+		}
+		if account == "" || item.AccountSID == account || item.AccountID == account ||
+			strings.EqualFold(item.Address, account) || item.PhoneNumberID == account ||
+			item.ApplicationID == account {
+			out = append(out, *item)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// Copias completas de las carpetas vigiladas activas de todos los tenants
+func (r *integrationRegistry) watched() []Integration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []Integration
+	for _, item := range r.items {
+		if item.Enabled && isWatchProvider(item.Provider) {
+			out = append(out, *item)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// Guarda el resultado de un sondeo sin tocar updated_at; cursor vacío no
+// lo cambia. Si la carpeta cambió entretanto, el sondeo ya no cuenta.
+func (r *integrationRegistry) recordPoll(polled Integration, cursor string, pollErr error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	item, ok := r.items[polled.ID]
+	if !ok || item.FolderID != polled.FolderID || item.Path != polled.Path {
+		return
+	}
+	now := time.Now()
+	item.LastPolledAt = &now
+	item.LastError = ""
+	if pollErr != nil {
+		item.LastError = pollErr.Error()
+	}
+	if cursor != "" {
+		item.cursor = cursor
+	}
+	if err := r.persistLocked(); err != nil {
+		log.Printf("⚠️ No se pudo guardar el sondeo de la integración %s: %v", item.ID, err)
+	}
+}
+
+func isWatchProvider(provider string) bool {
+	return provider == ProviderGoogleDrive || provider == ProviderDropbox
+}
+
+func isExportProvider(provider string) bool {
+	return provider == ProviderGoogleDocs || provider == ProviderNotion || isDestinationProvider(provider)
+}
+
+func isDestinationProvider(provider string) bool {
+	switch provider {
+	case ProviderS3, ProviderGCS, ProviderAzureBlob, ProviderWebDAV, ProviderSFTP:
+		return true
+	}
+	return false
+}
+
+func validateIntegration(item *Integration) error {
+	switch item.Provider {
+	case ProviderGoogleDocs:
+		if item.token.RefreshToken != "" && (cfg.GoogleClientID == "" || liveSecret(&cfg.GoogleClientSecret) == "") {
+			return errors.New("refresh_token requires GOOGLE_CLIENT_ID and GOOGLE_CLIENT_SECRET")
+		}
+	case ProviderNotion:
+		if item.ParentPageID == "" {
+			return errors.New("parent_page_id is required for notion")
+		}
+	case ProviderGoogleDrive:
+		if item.FolderID == "" {
+			return errors.New("folder_id is required for google_drive")
+		}
+		if item.token.RefreshToken != "" && (cfg.GoogleClientID == "" || liveSecret(&cfg.GoogleClientSecret) == "") {
+			return errors.New("refresh_token requires GOOGLE_CLIENT_ID and GOOGLE_CLIENT_SECRET")
+		}
+	case ProviderDropbox:
+		if item.Path != "" && (!strings.HasPrefix(item.Path, "/") || strings.HasSuffix(item.Path, "/")) {
+			return errors.New("path must start with / and not end with /")
+		}
+		if item.token.RefreshToken != "" && (cfg.DropboxAppKey == "" || liveSecret(&cfg.DropboxAppSecret) == "") {
+			return errors.New("refresh_token requires DROPBOX_APP_KEY and DROPBOX_APP_SECRET")
+		}
+	case ProviderTwilio:
+		if !twilioAccountPattern.MatchString(item.AccountSID) {
+			return errors.New("account_sid must be a Twilio account SID (AC...)")
+		}
+		if item.token.RefreshToken != "" {
+			return errors.New("refresh_token is not supported for twilio")
+		}
+		if cfg.PublicBaseURL == "" {
+			return errors.New("twilio requires PUBLIC_BASE_URL to validate callback signatures")
+		}
+	case ProviderZoom:
+		if item.AccountID == "" || len(item.AccountID) > 64 {
+			return errors.New("account_id is required for zoom")
+		}
+		if item.token.WebhookSecret == "" {
+			return errors.New("webhook_secret is required for zoom")
+		}
+		if item.token.RefreshToken != "" && (cfg.ZoomClientID == "" || liveSecret(&cfg.ZoomClientSecret) == "") {
+			return errors.New("refresh_token requires ZOOM_CLIENT_ID and ZOOM_CLIENT_SECRET")
+		}
+	case ProviderTelegram:
+		if !telegramSecretPattern.MatchString(item.token.WebhookSecret) {
+			return errors.New("webhook_secret must be 1-256 letters, digits, '_' or '-' (the setWebhook secret_token)")
+		}
+		if item.token.AccessToken == "" || item.token.RefreshToken != "" {
+			return errors.New("telegram requires the bot token as access_token and no refresh_token")
+		}
+	case ProviderWhatsApp:
+		if !whatsAppPhoneNumberIDPattern.MatchString(item.PhoneNumberID) {
+			return errors.New("phone_number_id is required for whatsapp")
+		}
+		if item.token.WebhookSecret == "" || item.token.VerifyToken == "" {
+			return errors.New("webhook_secret (the app secret) and verify_token are required for whatsapp")
+		}
+		if item.token.AccessToken == "" || item.token.RefreshToken != "" {
+			return errors.New("whatsapp requires a system user access_token and no refresh_token")
+		}
+	case ProviderDiscord:
+		return validateDiscordIntegration(item)
+	case ProviderS3, ProviderGCS, ProviderAzureBlob, ProviderWebDAV:
+		if err := validateDestinationIntegration(item); err != nil {
+			return err
+		}
+	case ProviderSFTP:
+		// Sin tokens: usa las credenciales de PUT /sftp/credentials/{host}
+		return validateDestinationIntegration(item)
+	case ProviderEmail:
+		// Sin tokens OAuth: se firma con webhook_secret y se responde por SMTP
+		return validateEmailIntegration(item)
+	default:
+		return errors.New("provider must be google_docs, notion, google_drive, dropbox, twilio, zoom, email, telegram, whatsapp, discord, s3, gcs, azure_blob, webdav or sftp")
+	}
+	if item.token.AccessToken == "" && item.token.RefreshToken == "" {
+		return errors.New("access_token is required")
+	}
+	return nil
+}
+
+// URL de la API del proveedor sin la barra final
+func providerAPIURL(provider string) string {
+	switch provider {
+	case ProviderNotion:
+		return strings.TrimRight(cfg.NotionAPIURL, "/")
+	case ProviderDropbox:
+		return strings.TrimRight(cfg.DropboxAPIURL, "/")
+	}
+	return strings.TrimRight(cfg.GoogleAPIURL, "/")
+}
+
+// GET /integrations lista las integraciones del tenant
+func listIntegrationsHandler(c *gin.Context) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"integrations": integrations.list(currentTenant(c))})
+}
+
+// POST /integrations registra un destino (google_docs o notion), cuyas
+// transcripciones completadas se exportan a partir de ahí, una carpeta
+// vigilada (google_drive o dropbox), con su token OAuth, una cuenta de
+// Twilio o Zoom cuyas grabaciones llegan a POST /integrations/twilio o
+// /integrations/zoom, una dirección de correo (POST /integrations/email) o
+// un bot de Telegram o WhatsApp
+func createIntegrationHandler(c *gin.Context) {
+	var input IntegrationBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	item := &Integration{
+		ID:        uuid.NewString(),
+		Provider:  input.Provider,
+		Enabled:   input.Enabled == nil || *input.Enabled,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	input.apply(item)
+	if err := validateIntegration(item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_REQUEST"})
+		return
+	}
+	if item.Provider == ProviderDiscord {
+		// El comando /transcribe se registra con el token del bot
+		if err := registerDiscordCommand(*item); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "code": "INTEGRATION_FAILED"})
+			return
+		}
+	}
+	if err := integrations.create(currentTenant(c), item); err != nil {
+		if err == errTooManyIntegrations {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusCreated, item.public())
+}
+
+// Copia en item los campos presentes del cuerpo, salvo provider y enabled
+func (b IntegrationBody) apply(item *Integration) {
+	if b.Name != nil {
+		item.Name = *b.Name
+	}
+	if b.FolderID != nil {
+		item.FolderID = *b.FolderID
+	}
+	if b.ParentPageID != nil {
+		item.ParentPageID = *b.ParentPageID
+	}
+	if b.Path != nil {
+		item.Path = *b.Path
+	}
+	if b.Template != nil {
+		item.Template = *b.Template
+	}
+	if b.AccountSID != nil {
+		item.AccountSID = *b.AccountSID
+	}
+	if b.AccountID != nil {
+		item.AccountID = *b.AccountID
+	}
+	if b.WebhookSecret != nil {
+		item.token.WebhookSecret = *b.WebhookSecret
+	}
+	if b.Address != nil {
+		item.Address = strings.ToLower(strings.TrimSpace(*b.Address))
+	}
+	if b.AllowedSenders != nil {
+		item.AllowedSenders = b.AllowedSenders
+	}
+	if b.PhoneNumberID != nil {
+		item.PhoneNumberID = *b.PhoneNumberID
+	}
+	if b.VerifyToken != nil {
+		item.token.VerifyToken = *b.VerifyToken
+	}
+	if b.ApplicationID != nil {
+		item.ApplicationID = *b.ApplicationID
+	}
+	if b.PublicKey != nil {
+		item.PublicKey = strings.ToLower(strings.TrimSpace(*b.PublicKey))
+	}
+	if b.Bucket != nil {
+		item.Bucket = *b.Bucket
+	}
+	if b.Endpoint != nil {
+		item.Endpoint = strings.TrimRight(*b.Endpoint, "/")
+	}
+	if b.Region != nil {
+		item.Region = *b.Region
+	}
+	if b.AccessKeyID != nil {
+		item.AccessKeyID = *b.AccessKeyID
+	}
+	if b.URL != nil {
+		item.URL = strings.TrimRight(*b.URL, "/")
+	}
+	if b.Username != nil {
+		item.Username = *b.Username
+	}
+	if b.PathTemplate != nil {
+		item.PathTemplate = *b.PathTemplate
+	}
+	if b.Formats != nil {
+		item.Formats = b.Formats
+	}
+	if b.AccessToken != nil {
+		item.token.AccessToken = *b.AccessToken
+		item.token.Expiry = time.Time{}
+	}
+	if b.RefreshToken != nil {
+		item.token.RefreshToken = *b.RefreshToken
+	}
+}
+
+// GET /integrations/:integration_id
+func getIntegrationHandler(c *gin.Context) {
+	item := integrations.get(currentTenant(c), c.Param("integration_id"))
+	if item == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "integration not found"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, item)
+}
+
+// PATCH /integrations/:integration_id cambia el destino, enabled o los
+// tokens (p. ej. tras volver a autorizar la app)
+func updateIntegrationHandler(c *gin.Context) {
+	var input IntegrationBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	current, ok := integrations.lookup(c.Param("integration_id"))
+	if !ok || current.tenant != currentTenant(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "integration not found"})
+		return
+	}
+	if input.Provider != "" && input.Provider != current.Provider {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "provider cannot be changed", "code": "INVALID_REQUEST"})
+		return
+	}
+	input.apply(&current)
+	if err := validateIntegration(&current); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_REQUEST"})
+		return
+	}
+	if current.Provider == ProviderDiscord && (input.ApplicationID != nil || input.AccessToken != nil) {
+		if err := registerDiscordCommand(current); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "code": "INTEGRATION_FAILED"})
+			return
+		}
+	}
+
+	item, err := integrations.update(currentTenant(c), c.Param("integration_id"), func(item *Integration) {
+		if item.FolderID != current.FolderID || item.Path != current.Path {
+			// Otra carpeta: se vigila desde ahora (updated_at)
+			item.cursor = ""
+		}
+		input.apply(item)
+		if input.Enabled != nil {
+			item.Enabled = *input.Enabled
+		}
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+	if item == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "integration not found"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, item)
+}
+
+// DELETE /integrations/:integration_id; las exportaciones pendientes se descartan
+func deleteIntegrationHandler(c *gin.Context) {
+	deleted, err := integrations.delete(currentTenant(c), c.Param("integration_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "integration not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Título del documento: metadata.title del job o uno con la fecha
+func exportTitle(jobID string, job *JobState, meta *jobMeta) string {
+	if meta != nil && meta.Input.Metadata["title"] != "" {
+		return meta.Input.Metadata["title"]
+	}
+	return fmt.Sprintf("Transcript %s (%s)", job.Timestamp.UTC().Format("2006-01-02 15:04"), jobID[:8])
+}
+
+// Encola en el outbox una exportación por integración activa al completarse
+// una transcripción. Requiere mu tomado.
+func notifyIntegrationsLocked(jobID, status string) {
+	job, ok := jobStore[jobID]
+	if status != "completed" || !ok || job.Type != JobTypeTranscription || job.Transcription == "" {
+		return
+	}
+	meta := jobMetas[jobID]
+	var tenant string
+	if meta != nil {
+		tenant = meta.Tenant
+	}
+	ids := integrations.active(tenant)
+	if len(ids) == 0 {
+		return
+	}
+	body, err := json.Marshal(integrationExport{
+		JobID:       jobID,
+		Title:       exportTitle(jobID, job, meta),
+		Text:        job.Transcription,
+		Translation: job.Translation,
+	})
+	if err != nil {
+		jobLogf(jobID, "❌ No se pudo serializar la exportación del job %s: %v", jobID, err)
+		return
+	}
+	// Una nueva transcripción (p. ej. tras una revisión) se vuelve a entregar
+	job.Deliveries = nil
+	for _, id := range ids {
+		enqueueOutboxLocked(jobID, OutboxMessage{Kind: OutboxIntegration, Target: id, Event: WebhookJobCompleted, Payload: body})
+		item, _ := integrations.lookup(id)
+		job.Deliveries = append(job.Deliveries, JobDelivery{IntegrationID: id, Provider: item.Provider, Status: DeliveryPending, UpdatedAt: time.Now()})
+	}
+}
+
+// Actualiza el estado de la entrega del job a la integración. Requiere mu
+// tomado.
+func setDeliveryLocked(jobID, integrationID, status string, attempts int, message string) {
+	job, ok := jobStore[jobID]
+	if !ok {
+		return
+	}
+	for i := range job.Deliveries {
+		if d := &job.Deliveries[i]; d.IntegrationID == integrationID {
+			d.Status, d.Attempts, d.Message, d.UpdatedAt = status, attempts, message, time.Now()
+			nextUpdateSeqLocked(job)
+			return
+		}
+	}
+}
+
+// Un intento de exportación desde el outbox
+func deliverIntegration(msg OutboxMessage) (string, error) {
+	item, ok := integrations.lookup(msg.Target)
+	if !ok || !item.Enabled {
+		return "", errOutboxDiscard
+	}
+	var doc integrationExport
+	if err := json.Unmarshal(msg.Payload, &doc); err != nil {
+		return "", errOutboxDiscard
+	}
+	client := &http.Client{Timeout: cfg.IntegrationTimeout.Duration}
+	var link string
+	var err error
+	switch item.Provider {
+	case ProviderGoogleDocs:
+		link, err = exportGoogleDoc(client, item, doc)
+	case ProviderNotion:
+		link, err = exportNotionPage(client, item, doc)
+	case ProviderS3, ProviderGCS, ProviderAzureBlob, ProviderWebDAV, ProviderSFTP:
+		link, err = deliverToDestination(item, doc)
+	default:
+		return "", errOutboxDiscard
+	}
+	if err == errOutboxDiscard {
+		return "", err
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "export to %s", item.Provider)
+	}
+	return fmt.Sprintf("transcript exported to %s: %s", item.Provider, link), nil
+}
+
+// Texto completo del documento: la transcripción y, si la hay, la traducción
+func (d integrationExport) body() string {
+	if d.Translation == "" {
+		return d.Text
+	}
+	return d.Text + "\n\n---\n\n" + d.Translation
+}
+
+// Error de la API del proveedor con su código de estado
+type providerError struct {
+	status int
+	body   string
+}
+
+func (e *providerError) Error() string {
+	return fmt.Sprintf("provider returned %d: %s", e.status, e.body)
+}
+
+func doProviderRequest(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "provider request failed")
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &providerError{status: resp.StatusCode, body: strings.TrimSpace(string(data))}
+	}
+	if out == nil {
+		return nil
+	}
+	return errors.Wrap(json.Unmarshal(data, out), "invalid provider response")
+}
+
+// Llama a fn con el access_token. Si caducó, o el proveedor responde 401, y
+// hay refresh_token, lo renueva (y repite una vez).
+func withAccessToken(client *http.Client, item Integration, fn func(accessToken string) error) error {
+	if item.token.RefreshToken != "" && (item.token.AccessToken == "" || (!item.token.Expiry.IsZero() && time.Now().After(item.token.Expiry))) {
+		token, err := refreshOAuthToken(client, item)
+		if err != nil {
+			return err
+		}
+		item.token = token
+	}
+	err := fn(item.token.AccessToken)
+	if perr, ok := errors.Cause(err).(*providerError); ok && perr.status == http.StatusUnauthorized && item.token.RefreshToken != "" {
+		token, err := refreshOAuthToken(client, item)
+		if err != nil {
+			return err
+		}
+		return fn(token.AccessToken)
+	}
+	return err
+}
+
+// Crea un Google Doc convirtiendo el texto con una subida multipart a Drive
+func exportGoogleDoc(client *http.Client, item Integration, doc integrationExport) (string, error) {
+	var link string
+	err := withAccessToken(client, item, func(accessToken string) error {
+		var err error
+		link, err = createGoogleDoc(client, accessToken, item.FolderID, doc)
+		return err
+	})
+	return link, err
+}
+
+func createGoogleDoc(client *http.Client, accessToken, folderID string, doc integrationExport) (string, error) {
+	metadata := map[string]interface{}{
+		"name":     doc.Title,
+		"mimeType": "application/vnd.google-apps.document",
+	}
+	if folderID != "" {
+		metadata["parents"] = []string{folderID}
+	}
+	file, err := uploadDriveFile(client, accessToken, metadata, "text/plain; charset=UTF-8", doc.body())
+	if err != nil {
+		return "", err
+	}
+	if file.WebViewLink == "" {
+		return "https://docs.google.com/document/d/" + file.ID, nil
+	}
+	return file.WebViewLink, nil
+}
+
+// Archivo creado en Drive
+type driveFile struct {
+	ID          string `json:"id"`
+	WebViewLink string `json:"webViewLink"`
+}
+
+// Subida multipart a Drive: metadata y contenido en una sola petición
+func uploadDriveFile(client *http.Client, accessToken string, metadata map[string]interface{}, contentType, content string) (driveFile, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json; charset=UTF-8"}})
+	if err != nil {
+		return driveFile{}, errors.Wrap(err, "failed to build upload")
+	}
+	if err := json.NewEncoder(part).Encode(metadata); err != nil {
+		return driveFile{}, errors.Wrap(err, "failed to build upload")
+	}
+	if part, err = mw.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}}); err != nil {
+		return driveFile{}, errors.Wrap(err, "failed to build upload")
+	}
+	if _, err := io.WriteString(part, content); err != nil {
+		return driveFile{}, errors.Wrap(err, "failed to build upload")
+	}
+	if err := mw.Close(); err != nil {
+		return driveFile{}, errors.Wrap(err, "failed to build upload")
+	}
+
+	req, err := http.NewRequest(http.MethodPost,
+		providerAPIURL(ProviderGoogleDocs)+"/upload/drive/v3/files?uploadType=multipart&supportsAllDrives=true&fields=id,webViewLink", &buf)
+	if err != nil {
+		return driveFile{}, errors.Wrap(err, "invalid provider request")
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "multipart/related; boundary="+mw.Boundary())
+	var out driveFile
+	if err := doProviderRequest(client, req, &out); err != nil {
+		return driveFile{}, err
+	}
+	return out, nil
+}
+
+// Canjea el refresh_token por un access_token nuevo y lo guarda
+func refreshOAuthToken(client *http.Client, item Integration) (integrationToken, error) {
+	tokenURL, clientID, clientSecret := cfg.GoogleTokenURL, cfg.GoogleClientID, liveSecret(&cfg.GoogleClientSecret)
+	switch item.Provider {
+	case ProviderDropbox:
+		tokenURL, clientID, clientSecret = cfg.DropboxTokenURL, cfg.DropboxAppKey, liveSecret(&cfg.DropboxAppSecret)
+	case ProviderZoom:
+		tokenURL, clientID, clientSecret = cfg.ZoomTokenURL, cfg.ZoomClientID, liveSecret(&cfg.ZoomClientSecret)
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {item.token.RefreshToken},
+	}
+	if item.Provider != ProviderZoom {
+		form.Set("client_id", clientID)
+		form.Set("client_secret", clientSecret)
+	}
+	req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return integrationToken{}, errors.Wrap(err, "invalid token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if item.Provider == ProviderZoom {
+		// Zoom solo acepta las credenciales de la app en Authorization
+		req.SetBasicAuth(clientID, clientSecret)
+	}
+	var out struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	if err := doProviderRequest(client, req, &out); err != nil {
+		return integrationToken{}, errors.Wrapf(err, "failed to refresh %s token", item.Provider)
+	}
+	token := item.token
+	token.AccessToken = out.AccessToken
+	if out.RefreshToken != "" {
+		token.RefreshToken = out.RefreshToken
+	}
+	token.Expiry = time.Time{}
+	if out.ExpiresIn > 0 {
+		// Margen para no usarlo justo al caducar
+		token.Expiry = time.Now().Add(time.Duration(out.ExpiresIn)*time.Second - time.Minute)
+	}
+	if _, err := integrations.update("", item.ID, func(i *Integration) { i.token = token }); err != nil {
+		// El token sirve igual para este intento
+		log.Printf("⚠️ No se pudo guardar el token renovado de la integración %s: %v", item.ID, err)
+	}
+	return token, nil
+}
+
+// Bloques de párrafo de Notion: uno por párrafo, troceados al máximo de
+// caracteres por bloque
+func notionBlocks(text string) []interface{} {
+	var blocks []interface{}
+	for _, paragraph := range strings.Split(text, "\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		for _, piece := range splitRunes(paragraph, notionMaxBlockText) {
+			blocks = append(blocks, map[string]interface{}{
+				"object": "block",
+				"type":   "paragraph",
+				"paragraph": map[string]interface{}{
+					"rich_text": []interface{}{map[string]interface{}{"type": "text", "text": map[string]string{"content": piece}}},
+				},
+			})
+		}
+	}
+	return blocks
+}
+
+// Trozos de como mucho n runas
+func splitRunes(s string, n int) []string {
+	var out []string
+	for utf8.RuneCountInString(s) > n {
+		i, count := 0, 0
+		for count < n {
+			_, size := utf8.DecodeRuneInString(s[i:])
+			i += size
+			count++
+		}
+		out = append(out, s[:i])
+		s = s[i:]
+	}
+	return append(out, s)
+}
+
+func notionRequest(method, path, token string, body interface{}) (*http.Request, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal Notion request")
+	}
+	req, err := http.NewRequest(method, providerAPIURL(ProviderNotion)+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid provider request")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Notion-Version", notionVersion)
+	return req, nil
+}
+
+// Crea una página hija de parent_page_id con el texto; Notion admite 100
+// bloques por petición, así que el resto se añade por tandas
+func exportNotionPage(client *http.Client, item Integration, doc integrationExport) (string, error) {
+	blocks := notionBlocks(doc.body())
+	first := blocks
+	if len(first) > notionMaxBlocks {
+		first = first[:notionMaxBlocks]
+	}
+	req, err := notionRequest(http.MethodPost, "/v1/pages", item.token.AccessToken, map[string]interface{}{
+		"parent": map[string]string{"page_id": item.ParentPageID},
+		"properties": map[string]interface{}{
+			"title": map[string]interface{}{
+				"title": []interface{}{map[string]interface{}{"text": map[string]string{"content": doc.Title}}},
+			},
+		},
+		"children": first,
+	})
+	if err != nil {
+		return "", err
+	}
+	var page struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := doProviderRequest(client, req, &page); err != nil {
+		return "", err
+	}
+	for i := len(first); i < len(blocks); i += notionMaxBlocks {
+		end := i + notionMaxBlocks
+		if end > len(blocks) {
+			end = len(blocks)
+		}
+		req, err := notionRequest(http.MethodPatch, "/v1/blocks/"+page.ID+"/children", item.token.AccessToken,
+			map[string]interface{}{"children": blocks[i:end]})
+		if err != nil {
+			return "", err
+		}
+		if err := doProviderRequest(client, req, nil); err != nil {
+			return "", errors.Wrapf(err, "page %s created but incomplete", page.URL)
+		}
+	}
+	return page.URL, nil
+}
@@ -0,0 +1,326 @@
+// Package mockwhisper es un doble del backend whisper para pruebas de
+// integración: responde /transcribe, /align y /capacity y puede simular
+// lentitud, errores del modelo, JSON corrupto y respuestas en streaming
+// (trozos de un JSON o segmentos en NDJSON).
+package mockwhisper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Comportamiento de una petición a /transcribe
+type Mode string
+
+const (
+	ModeOK        Mode = "ok"
+	ModeSlow      Mode = "slow"      // responde tras Delay
+	ModeError     Mode = "error"     // 500 genérico
+	ModeOOM       Mode = "oom"       // 500 con el mensaje de CUDA sin memoria
+	ModeBadInput  Mode = "bad_input" // 422 como la validación de FastAPI
+	ModeMalformed Mode = "malformed" // 200 con JSON inválido
+	ModeStream    Mode = "stream"    // el cuerpo llega en trozos durante Delay
+	ModeSegments  Mode = "segments"  // NDJSON: un segmento por línea durante Delay y la respuesta al final
+	ModeHang      Mode = "hang"      // no responde hasta que el cliente corta
+)
+
+// Petición a /transcribe tal como la envía el gateway
+type Request struct {
+	URL       string `json:"url,omitempty"`
+	FilePath  string `json:"file_path,omitempty"`
+	Language  string `json:"language"`
+	Translate bool   `json:"translate"`
+	Model     string `json:"model,omitempty"`
+
+	Prompt         string    `json:"initial_prompt,omitempty"`
+	ClipTimestamps []float64 `json:"clip_timestamps,omitempty"`
+}
+
+type Word struct {
+	Word  string  `json:"word"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+type Segment struct {
+	ID       int     `json:"id"`
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Text     string  `json:"text"`
+	Language string  `json:"language,omitempty"`
+	Words    []Word  `json:"words,omitempty"`
+}
+
+type Response struct {
+	Transcription string    `json:"transcription"`
+	Translation   string    `json:"translation,omitempty"`
+	Language      string    `json:"language,omitempty"`
+	ModelUsed     string    `json:"model_used,omitempty"`
+	Segments      []Segment `json:"segments,omitempty"`
+}
+
+// Respuesta por defecto: un saludo yorùbá seguido de inglés
+func DefaultResponse() Response {
+	return Response{
+		Transcription: "ẹ kú àárọ̀ hello world",
+		Translation:   "good morning hello world",
+		Language:      "yo",
+		ModelUsed:     "large",
+		Segments: []Segment{
+			{ID: 0, Start: 0, End: 2, Text: "ẹ kú àárọ̀", Language: "yo", Words: []Word{
+				{Word: "ẹ", Start: 0, End: 0.4}, {Word: "kú", Start: 0.5, End: 1}, {Word: "àárọ̀", Start: 1.1, End: 2},
+			}},
+			{ID: 1, Start: 2, End: 4, Text: "hello world", Language: "en", Words: []Word{
+				{Word: "hello", Start: 2, End: 2.8}, {Word: "world", Start: 3, End: 4},
+			}},
+		},
+	}
+}
+
+// Server simula un backend. El modo se elige, por orden, con el parámetro
+// mock= en la URL del medio (p. ej. https://x/a.mp3?mock=oom), con la lista
+// de Script (un modo por petición) o con Default.
+type Server struct {
+	mu       sync.Mutex
+	mode     Mode
+	script   []Mode
+	delay    time.Duration
+	response Response
+	requests []Request
+	inFlight int
+}
+
+type Option func(*Server)
+
+func WithMode(mode Mode) Option {
+	return func(s *Server) { s.mode = mode }
+}
+
+// Modos para las siguientes peticiones, en orden; después se usa el modo por defecto
+func WithScript(modes ...Mode) Option {
+	return func(s *Server) { s.script = append([]Mode(nil), modes...) }
+}
+
+func WithDelay(d time.Duration) Option {
+	return func(s *Server) { s.delay = d }
+}
+
+func WithResponse(r Response) Option {
+	return func(s *Server) { s.response = r }
+}
+
+func New(opts ...Option) *Server {
+	s := &Server{mode: ModeOK, delay: time.Second, response: DefaultResponse()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Arranca el servidor en un puerto local libre
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewServer(s)
+}
+
+// Copia de las peticiones recibidas en /transcribe
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/capacity":
+		s.capacity(w)
+	case r.Method == http.MethodPost && r.URL.Path == "/transcribe":
+		s.transcribe(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/align":
+		s.align(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) capacity(w http.ResponseWriter) {
+	s.mu.Lock()
+	queue := s.inFlight
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"queue_length": queue, "model_loaded": s.response.ModelUsed})
+}
+
+func (s *Server) nextMode(req Request) Mode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	if u, err := url.Parse(req.URL); err == nil {
+		if m := u.Query().Get("mock"); m != "" {
+			return Mode(m)
+		}
+	}
+	if len(s.script) > 0 {
+		mode := s.script[0]
+		s.script = s.script[1:]
+		return mode
+	}
+	return s.mode
+}
+
+func (s *Server) transcribe(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"detail": err.Error()})
+		return
+	}
+	if detail := validate(req); detail != "" {
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		s.mu.Unlock()
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"detail": detail})
+		return
+	}
+	mode := s.nextMode(req)
+
+	s.mu.Lock()
+	s.inFlight++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+
+	response := s.response
+	if req.Model != "" {
+		response.ModelUsed = req.Model
+	}
+	if !req.Translate {
+		response.Translation = ""
+	}
+
+	switch mode {
+	case ModeOK:
+		writeJSON(w, http.StatusOK, response)
+	case ModeSlow:
+		if !sleep(r, s.delay) {
+			return
+		}
+		writeJSON(w, http.StatusOK, response)
+	case ModeError:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"detail": "Transcription failed: internal error"})
+	case ModeOOM:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"detail": "CUDA out of memory. Tried to allocate 2.00 GiB"})
+	case ModeBadInput:
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"detail": "Language must be one of: en, es, yo"})
+	case ModeMalformed:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"transcription": "ẹ kú`)
+	case ModeStream:
+		s.stream(w, r, response)
+	case ModeSegments:
+		s.segments(w, r, response)
+	case ModeHang:
+		<-r.Context().Done()
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"detail": fmt.Sprintf("unknown mock mode %q", mode)})
+	}
+}
+
+// Las reglas de TranscribeRequest en el backend Python: url solo http(s)
+// y, sin ella, file_path
+func validate(req Request) string {
+	if req.URL == "" {
+		if req.FilePath == "" {
+			return "url or file_path is required"
+		}
+		return ""
+	}
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "url: URL scheme should be 'http' or 'https'"
+	}
+	return ""
+}
+
+// Envía el JSON en varios trozos repartidos a lo largo de Delay, como un
+// backend que va escribiendo mientras transcribe
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, response Response) {
+	data, _ := json.Marshal(response)
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	const parts = 5
+	step := (len(data) + parts - 1) / parts
+	for i := 0; i < len(data); i += step {
+		end := i + step
+		if end > len(data) {
+			end = len(data)
+		}
+		w.Write(data[i:end])
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if end < len(data) && !sleep(r, s.delay/parts) {
+			return
+		}
+	}
+}
+
+// Streaming de segmentos como lo lee el gateway: {"segment": ...} por línea,
+// repartidos a lo largo de Delay, y la respuesta completa en la última
+func (s *Server) segments(w http.ResponseWriter, r *http.Request, response Response) {
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	for _, seg := range response.Segments {
+		encoder.Encode(map[string]Segment{"segment": seg})
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if !sleep(r, s.delay/time.Duration(len(response.Segments))) {
+			return
+		}
+	}
+	encoder.Encode(response)
+}
+
+// Alineación trivial: palabras repartidas a intervalos fijos
+func (s *Server) align(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"detail": err.Error()})
+		return
+	}
+	words := []Word{}
+	for i, token := range strings.Fields(req.Text) {
+		start := float64(i) * 0.5
+		words = append(words, Word{Word: token, Start: start, End: start + 0.4})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"words": words})
+}
+
+// Espera d salvo que el cliente cancele; devuelve false si canceló
+func sleep(r *http.Request, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"time"
+)
+
+// Tipos de evento en el historial de un job
+const (
+	EventStatus      = "status"      // transición de estado
+	EventRetry       = "retry"       // reintento de una etapa
+	EventError       = "error"       // error registrado (aunque el job siga)
+	EventWebhook     = "webhook"     // entrega de webhook
+	EventEdit        = "edit"        // cambio manual de la transcripción
+	EventReview      = "review"      // transición de la revisión humana
+	EventPurge       = "purge"       // borrado por la política de retención del tenant
+	EventIntegration = "integration" // exportación a Google Docs, Notion o un almacén
+	EventWriteBack   = "writeback"   // resultado escrito junto al medio de origen (ingesta de S3)
+	EventAnnotation  = "annotation"  // anotación añadida o borrada
+	EventShare       = "share"       // enlace público creado o revocado
+)
+
+// Evento del historial de un job, en orden de ocurrencia
+type JobEvent struct {
+	Type      string    `json:"type"`
+	Status    string    `json:"status,omitempty"`
+	Code      string    `json:"code,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Seq       int64     `json:"seq,omitempty"` // updated_seq del job tras el evento; ordena los de igual timestamp
+}
+
+// Historial por job; se guarda aparte para no inflar /jobs ni /result
+var jobEvents = make(map[string][]JobEvent)
+
+// Datos internos del job que no se exponen en la API
+type jobMeta struct {
+	Input     RequestBody
+	MediaPath string // medio descargado por el gateway (ruta local)
+	Tenant    string
+	Sealed    string `json:",omitempty"` // texto cifrado del job, solo en el almacén
+
+	// Medio de origen si lo creó la ingesta; el resultado se escribe ahí
+	Source *jobSource `json:",omitempty"`
+
+	// Comentarios de la revisión; se sirven en /jobs/:job_id/annotations
+	Annotations []Annotation `json:",omitempty"`
+
+	// Se incrementa al revocar los enlaces de /jobs/:job_id/share
+	ShareEpoch int `json:",omitempty"`
+
+	// Huella acústica; solo en jobs completados cuyo resultado es reutilizable
+	Fingerprint Fingerprint `json:",omitempty"`
+}
+
+var jobMetas = make(map[string]*jobMeta)
+
+// Copia de los datos internos del job
+func getJobMeta(jobID string) (jobMeta, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	meta, ok := jobMetas[jobID]
+	if !ok {
+		return jobMeta{}, false
+	}
+	return *meta, true
+}
+
+// Registra un evento. Requiere que mu NO esté tomado.
+func recordEvent(jobID string, event JobEvent) {
+	mu.Lock()
+	defer unlockJobs()
+	appendEventLocked(jobID, event)
+}
+
+func appendEventLocked(jobID string, event JobEvent) {
+	job, ok := jobStore[jobID]
+	if !ok {
+		// Peticiones síncronas sin job
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	// Antes de avisar: webhooks y eventos del bus llevan el job ya numerado
+	event.Seq = nextUpdateSeqLocked(job)
+	jobEvents[jobID] = append(jobEvents[jobID], event)
+	if event.Type == EventStatus {
+		notifyWebhooksLocked(jobID, event.Status)
+		notifyIntegrationsLocked(jobID, event.Status)
+		notifyWriteBackLocked(jobID, event.Status)
+		publishLifecycleLocked(jobID, event)
+	}
+	// El evento y sus mensajes del outbox se guardan en la misma escritura
+	persistJobLocked(jobID)
+}
+
+// Aplica una modificación al job bajo el lock global
+func updateJob(jobID string, fn func(job *JobState)) {
+	mu.Lock()
+	defer unlockJobs()
+	if job, ok := jobStore[jobID]; ok {
+		fn(job)
+		nextUpdateSeqLocked(job)
+	}
+}
+
+// Numera un cambio del job. No es consecutivo: nunca baja del reloj en
+// microsegundos, así sigue creciendo aunque un reinicio pierda cambios aún
+// sin persistir (los de updateJob esperan al siguiente evento) o el job
+// pase a otra réplica. Requiere mu tomado.
+func nextUpdateSeqLocked(job *JobState) int64 {
+	next := time.Now().UnixMicro()
+	if next <= job.UpdatedSeq {
+		next = job.UpdatedSeq + 1
+	}
+	job.UpdatedSeq = next
+	return next
+}
+
+// Cambia el estado del job y deja constancia en el historial
+func setJobStatus(jobID, status string) {
+	mu.Lock()
+	defer unlockJobs()
+	job, ok := jobStore[jobID]
+	if !ok || job.Status == status {
+		return
+	}
+	job.Status = status
+	appendEventLocked(jobID, JobEvent{Type: EventStatus, Status: status})
+}
+
+// Marca el job como fallido con un código estable y el mensaje de error, y
+// lo reporta al tracker de errores
+func failJob(jobID, code, message string) {
+	if job, ok := markJobFailed(jobID, code, message); ok {
+		reportJobFailure(jobID, job, code, message)
+	}
+}
+
+func markJobFailed(jobID, code, message string) (JobState, bool) {
+	mu.Lock()
+	defer unlockJobs()
+	job, ok := jobStore[jobID]
+	if !ok {
+		return JobState{}, false
+	}
+	job.Status = "failed"
+	job.ErrorCode = code
+	job.Error = message
+	if job.Partial {
+		// Lo parcial de un intento fallido no es un resultado
+		job.Segments, job.Transcription, job.Partial = nil, "", false
+	}
+	appendEventLocked(jobID, JobEvent{Type: EventError, Code: code, Message: message})
+	appendEventLocked(jobID, JobEvent{Type: EventStatus, Status: "failed"})
+	return *job, true
+}
+
+// Copia del historial de un job
+func getJobEvents(jobID string) ([]JobEvent, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if _, ok := jobStore[jobID]; !ok {
+		return nil, false
+	}
+	events := make([]JobEvent, len(jobEvents[jobID]))
+	copy(events, jobEvents[jobID])
+	return events, true
+}
+
+// Copia del estado del job
+func getJob(jobID string) (JobState, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	job, ok := jobStore[jobID]
+	if !ok {
+		return JobState{}, false
+	}
+	return *job, true
+}
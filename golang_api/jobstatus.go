@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BulkStatusBody struct {
+	JobIDs []string `json:"job_ids"`
+}
+
+// Estado de un job sin el resultado, para sondear muchos a la vez
+type JobStatusSummary struct {
+	Type      string            `json:"type"`
+	Status    string            `json:"status"`
+	Error     string            `json:"error,omitempty"`
+	ErrorCode string            `json:"error_code,omitempty"`
+	Download  *DownloadProgress `json:"download,omitempty"`
+	Chunks    *ChunkProgress    `json:"chunks,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+
+	UpdatedSeq int64 `json:"updated_seq"` // el de GET /result: si no cambió, tampoco el job
+}
+
+// POST /jobs/status devuelve el estado de varios jobs en una sola petición;
+// los IDs desconocidos o de otro tenant se listan en not_found
+func bulkJobStatusHandler(c *gin.Context) {
+	var input BulkStatusBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(input.JobIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "job_ids is required", "code": "INVALID_REQUEST"})
+		return
+	}
+	if len(input.JobIDs) > live().BulkStatusMaxJobs {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("at most %d job ids per request", live().BulkStatusMaxJobs),
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	ids := make([]string, 0, len(input.JobIDs))
+	seen := make(map[string]bool, len(input.JobIDs))
+	for _, id := range input.JobIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if cfg.Role == RoleAPI {
+		for _, id := range ids {
+			if abortOnDeadline(c, refreshJob(c.Request.Context(), id)) {
+				return
+			}
+		}
+	}
+
+	jobs := make(map[string]JobStatusSummary, len(ids))
+	notFound := []string{}
+	tenant, all := currentTenant(c), isOperator(c)
+	mu.RLock()
+	for _, id := range ids {
+		job, ok := jobStore[id]
+		if meta, found := jobMetas[id]; !all && (!found || meta.Tenant != tenant) {
+			// Los de otro tenant, como si no existieran
+			ok = false
+		}
+		if !ok {
+			notFound = append(notFound, id)
+			continue
+		}
+		summary := JobStatusSummary{
+			Type:      job.Type,
+			Status:    job.Status,
+			Error:     job.Error,
+			ErrorCode: job.ErrorCode,
+			Timestamp: job.Timestamp,
+
+			UpdatedSeq: job.UpdatedSeq,
+		}
+		// Copias: se serializan fuera de mu
+		if job.Download != nil {
+			download := *job.Download
+			summary.Download = &download
+		}
+		if job.Chunks != nil {
+			chunks := *job.Chunks
+			summary.Chunks = &chunks
+		}
+		jobs[id] = summary
+	}
+	mu.RUnlock()
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs, "not_found": notFound})
+}
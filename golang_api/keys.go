@@ -0,0 +1,652 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Nombres de los ajustes compartidos con las keys gestionadas y su último uso
+const (
+	keysSetting         = "api_keys"
+	keysLastUsedSetting = "api_keys_last_used"
+)
+
+// Máximo de keys (incluidas las revocadas) por tenant
+const maxKeysPerTenant = 100
+
+// Prefijo de los secretos generados, para reconocerlos en logs y escáneres
+const keySecretPrefix = "tw_"
+
+// Prefijo de los secretos de las keys de sandbox
+const sandboxKeySecretPrefix = keySecretPrefix + "test_"
+
+// Caracteres del secreto que se muestran para identificar la key
+const keyPrefixLength = 10
+
+var keyNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+var (
+	errTooManyKeys  = errors.Errorf("at most %d API keys per tenant", maxKeysPerTenant)
+	errKeyNameTaken = errors.New("API key name already exists")
+)
+
+// Key creada con POST /keys. Del secreto solo se guarda el hash; se muestra
+// una única vez al crearla o rotarla.
+type ManagedKey struct {
+	ID                string     `json:"id"`
+	Name              string     `json:"name"` // como en api_keys: aparece en los jobs
+	Tenant            string     `json:"tenant,omitempty"`
+	Role              string     `json:"role"`
+	MaxConcurrentJobs int        `json:"max_concurrent_jobs,omitempty"`
+	Prefix            string     `json:"prefix"` // inicio del secreto
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	LastUsedAt        *time.Time `json:"last_used_at,omitempty"` // con unos segundos de retraso entre réplicas
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+	PreviousExpiresAt *time.Time `json:"previous_expires_at,omitempty"` // el secreto anterior a una rotación vale hasta entonces
+
+	// Sus jobs los resuelve el backend de sandbox; no cambia al rotarla
+	Sandbox bool `json:"sandbox,omitempty"`
+
+	// Solo autentica peticiones firmadas (X-Key-ID y X-Signature), nunca el
+	// secreto en claro; para firmar se guarda el secreto, no solo su hash
+	RequireSignature bool `json:"require_signature,omitempty"`
+
+	// Rangos desde los que se acepta; se cambia con PATCH /keys/:key_id
+	AllowedCIDRs []string `json:"allowed_cidrs,omitempty"`
+
+	hash                  string
+	previousHash          string
+	signingSecret         string
+	previousSigningSecret string
+}
+
+// Formato persistido, con los hashes
+type managedKeyRecord struct {
+	ManagedKey
+	Hash         string `json:"hash"`
+	PreviousHash string `json:"previous_hash,omitempty"`
+
+	// Secretos de las keys con require_signature, sellados si hay cifrado
+	// en reposo
+	SigningSecret         string `json:"signing_secret,omitempty"`
+	PreviousSigningSecret string `json:"previous_signing_secret,omitempty"`
+}
+
+// Respuesta de creación y rotación: la única vez que se ve el secreto
+type KeyWithSecret struct {
+	ManagedKey
+	Key string `json:"key"`
+}
+
+type KeyBody struct {
+	Name              string     `json:"name"`
+	Role              string     `json:"role"` // por defecto editor
+	ExpiresAt         *time.Time `json:"expires_at"`
+	MaxConcurrentJobs int        `json:"max_concurrent_jobs"`
+	Sandbox           bool       `json:"sandbox"`
+	RequireSignature  bool       `json:"require_signature"`
+
+	AllowedCIDRs []string `json:"allowed_cidrs"`
+}
+
+// Cuerpo de PATCH /keys/:key_id; una lista vacía quita la restricción
+type KeyUpdateBody struct {
+	AllowedCIDRs *[]string `json:"allowed_cidrs"`
+}
+
+// Keys gestionadas de todos los tenants
+type keyRegistry struct {
+	mu     sync.RWMutex
+	keys   map[string]*ManagedKey // por ID
+	byHash map[string]string      // hash (actual o anterior) → ID
+	dirty  bool                   // último uso pendiente de guardar
+}
+
+var managedKeys = &keyRegistry{keys: make(map[string]*ManagedKey), byHash: make(map[string]string)}
+
+func hashKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func newKeySecret(sandbox bool) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate API key")
+	}
+	prefix := keySecretPrefix
+	if sandbox {
+		prefix = sandboxKeySecretPrefix
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Inicio del secreto que se muestra; en las de sandbox, sin contar "test_"
+func secretPrefix(secret string) string {
+	n := keyPrefixLength
+	if strings.HasPrefix(secret, sandboxKeySecretPrefix) {
+		n += len(sandboxKeySecretPrefix) - len(keySecretPrefix)
+	}
+	return secret[:n]
+}
+
+// Identidad con la que se atienden las peticiones de la key
+func (k *ManagedKey) apiKey() *APIKey {
+	return &APIKey{Name: k.Name, Tenant: k.Tenant, Role: k.Role, MaxConcurrentJobs: k.MaxConcurrentJobs, Sandbox: k.Sandbox, RequireSignature: k.RequireSignature, AllowedCIDRs: k.AllowedCIDRs}
+}
+
+func (r *keyRegistry) empty() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.keys) == 0
+}
+
+// Requiere r.mu tomado
+func (r *keyRegistry) indexLocked() {
+	r.byHash = make(map[string]string, len(r.keys))
+	for id, k := range r.keys {
+		r.byHash[k.hash] = id
+		if k.previousHash != "" {
+			r.byHash[k.previousHash] = id
+		}
+	}
+}
+
+// Key vigente con ese secreto, o nil; anota su último uso
+func (r *keyRegistry) lookup(secret string) *APIKey {
+	if secret == "" {
+		return nil
+	}
+	hash := hashKeySecret(secret)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k, ok := r.keys[r.byHash[hash]]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	switch {
+	case !k.activeAt(now):
+		return nil
+	case hash == k.previousHash && !k.previousActiveAt(now):
+		return nil
+	}
+	k.LastUsedAt = &now
+	r.dirty = true
+	return k.apiKey()
+}
+
+// Ni revocada ni caducada
+func (k *ManagedKey) activeAt(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// El secreto anterior a una rotación sigue en su gracia
+func (k *ManagedKey) previousActiveAt(now time.Time) bool {
+	return k.PreviousExpiresAt != nil && now.Before(*k.PreviousExpiresAt)
+}
+
+// Key vigente con ese ID que acepta peticiones firmadas, y sus secretos
+// (con el anterior durante la gracia de una rotación)
+func (r *keyRegistry) signingKey(id string) (*APIKey, []string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	k, ok := r.keys[id]
+	now := time.Now()
+	if !ok || k.signingSecret == "" || !k.activeAt(now) {
+		return nil, nil
+	}
+	secrets := []string{k.signingSecret}
+	if k.previousSigningSecret != "" && k.previousActiveAt(now) {
+		secrets = append(secrets, k.previousSigningSecret)
+	}
+	return k.apiKey(), secrets
+}
+
+// Anota el último uso de la key por una petición firmada
+func (r *keyRegistry) touch(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if k, ok := r.keys[id]; ok {
+		now := time.Now()
+		k.LastUsedAt = &now
+		r.dirty = true
+	}
+}
+
+func (r *keyRegistry) findByName(name string) *APIKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, k := range r.keys {
+		if k.Name == name {
+			return k.apiKey()
+		}
+	}
+	return nil
+}
+
+func (r *keyRegistry) get(tenant, id string) (ManagedKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	k, ok := r.keys[id]
+	if !ok || k.Tenant != tenant {
+		return ManagedKey{}, false
+	}
+	return *k, true
+}
+
+func (r *keyRegistry) list(tenant string) []ManagedKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := []ManagedKey{}
+	for _, k := range r.keys {
+		if k.Tenant == tenant {
+			out = append(out, *k)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// Guarda el registro completo; requiere r.mu tomado
+func (r *keyRegistry) persistLocked() error {
+	if stateStore == nil {
+		return nil
+	}
+	records := make([]managedKeyRecord, 0, len(r.keys))
+	for _, k := range r.keys {
+		rec := managedKeyRecord{ManagedKey: *k, Hash: k.hash, PreviousHash: k.previousHash}
+		var err error
+		if rec.SigningSecret, err = sealKeySecret(k.Tenant, k.signingSecret); err != nil {
+			return err
+		}
+		if rec.PreviousSigningSecret, err = sealKeySecret(k.Tenant, k.previousSigningSecret); err != nil {
+			return err
+		}
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].CreatedAt.Before(records[j].CreatedAt) })
+	data, err := json.Marshal(records)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal API keys")
+	}
+	return stateStore.SaveSetting(keysSetting, data)
+}
+
+func sealKeySecret(tenant, secret string) (string, error) {
+	if secret == "" || encryption == nil {
+		return secret, nil
+	}
+	return encryption.seal(tenantScope(tenant), []byte(secret))
+}
+
+func openKeySecret(tenant, stored string) (string, error) {
+	if !isSealed(stored) {
+		return stored, nil
+	}
+	secret, err := encryption.open(tenantScope(tenant), stored)
+	return string(secret), err
+}
+
+func (r *keyRegistry) create(k *ManagedKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, other := range r.keys {
+		if other.Name == k.Name {
+			return errKeyNameTaken
+		}
+		if other.Tenant == k.Tenant {
+			count++
+		}
+	}
+	if count >= maxKeysPerTenant {
+		return errTooManyKeys
+	}
+	r.keys[k.ID] = k
+	if err := r.persistLocked(); err != nil {
+		delete(r.keys, k.ID)
+		return err
+	}
+	r.indexLocked()
+	return nil
+}
+
+// Aplica fn a la key del tenant y guarda; false si no existe
+func (r *keyRegistry) update(tenant, id string, fn func(k *ManagedKey)) (ManagedKey, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k, ok := r.keys[id]
+	if !ok || k.Tenant != tenant {
+		return ManagedKey{}, false, nil
+	}
+	previous := *k
+	fn(k)
+	if err := r.persistLocked(); err != nil {
+		*k = previous
+		return ManagedKey{}, true, err
+	}
+	r.indexLocked()
+	return *k, true, nil
+}
+
+// Relee del almacén las keys, que pudo crear o revocar otra réplica. El
+// último uso se combina con el conocido aquí.
+func refreshKeys() error {
+	data, err := stateStore.LoadSetting(keysSetting)
+	if err != nil || data == nil {
+		return err
+	}
+	var records []managedKeyRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return errors.Wrap(err, "corrupt API keys")
+	}
+	lastUsed, err := loadKeysLastUsed()
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]*ManagedKey, len(records))
+	for _, rec := range records {
+		k := rec.ManagedKey
+		k.hash, k.previousHash = rec.Hash, rec.PreviousHash
+		if k.signingSecret, err = openKeySecret(k.Tenant, rec.SigningSecret); err != nil {
+			return errors.Wrapf(err, "signing secret of API key %s", k.Name)
+		}
+		if k.previousSigningSecret, err = openKeySecret(k.Tenant, rec.PreviousSigningSecret); err != nil {
+			return errors.Wrapf(err, "signing secret of API key %s", k.Name)
+		}
+		if t, ok := lastUsed[k.ID]; ok {
+			k.LastUsedAt = &t
+		}
+		keys[k.ID] = &k
+	}
+	managedKeys.mu.Lock()
+	for id, k := range keys {
+		if current, ok := managedKeys.keys[id]; ok && current.LastUsedAt != nil && (k.LastUsedAt == nil || current.LastUsedAt.After(*k.LastUsedAt)) {
+			k.LastUsedAt = current.LastUsedAt
+		}
+	}
+	managedKeys.keys = keys
+	managedKeys.indexLocked()
+	managedKeys.mu.Unlock()
+	return nil
+}
+
+func loadKeysLastUsed() (map[string]time.Time, error) {
+	data, err := stateStore.LoadSetting(keysLastUsedSetting)
+	if err != nil || data == nil {
+		return map[string]time.Time{}, err
+	}
+	var lastUsed map[string]time.Time
+	if err := json.Unmarshal(data, &lastUsed); err != nil {
+		return nil, errors.Wrap(err, "corrupt API key usage")
+	}
+	return lastUsed, nil
+}
+
+// Guarda el último uso aparte del registro, para que una réplica no
+// deshaga con su copia una revocación hecha en otra
+func flushKeysLastUsed() error {
+	managedKeys.mu.Lock()
+	if !managedKeys.dirty {
+		managedKeys.mu.Unlock()
+		return nil
+	}
+	managedKeys.dirty = false
+	local := make(map[string]time.Time, len(managedKeys.keys))
+	for id, k := range managedKeys.keys {
+		if k.LastUsedAt != nil {
+			local[id] = *k.LastUsedAt
+		}
+	}
+	managedKeys.mu.Unlock()
+
+	lastUsed, err := loadKeysLastUsed()
+	if err != nil {
+		return err
+	}
+	for id, t := range local {
+		if t.After(lastUsed[id]) {
+			lastUsed[id] = t
+		}
+	}
+	data, err := json.Marshal(lastUsed)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal API key usage")
+	}
+	return stateStore.SaveSetting(keysLastUsedSetting, data)
+}
+
+// GET /keys lista las keys gestionadas del tenant, sin secretos
+func listKeysHandler(c *gin.Context) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"keys": managedKeys.list(currentTenant(c))})
+}
+
+// GET /keys/:key_id
+func getKeyHandler(c *gin.Context) {
+	k, ok := managedKeys.get(currentTenant(c), c.Param("key_id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, k)
+}
+
+// POST /keys crea una key del tenant y devuelve su secreto
+func createKeyHandler(c *gin.Context) {
+	var input KeyBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Role == "" {
+		input.Role = AccessEditor
+	}
+	switch {
+	case !keyNamePattern.MatchString(input.Name):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key name must be 1-64 lowercase letters, digits, '.', '_' or '-'", "code": "INVALID_REQUEST"})
+		return
+	case !isAccessRole(input.Role) || input.Role == AccessOperator:
+		// operator abarca todos los tenants: solo desde api_keys
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be viewer, editor or admin", "code": "INVALID_REQUEST"})
+		return
+	case input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future", "code": "INVALID_REQUEST"})
+		return
+	case input.MaxConcurrentJobs < 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_concurrent_jobs cannot be negative", "code": "INVALID_REQUEST"})
+		return
+	case findAPIKeyByName(input.Name) != nil:
+		c.JSON(http.StatusConflict, gin.H{"error": errKeyNameTaken.Error()})
+		return
+	}
+	cidrs, err := normalizeAllowedCIDRs(input.AllowedCIDRs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_REQUEST"})
+		return
+	}
+	secret, err := newKeySecret(input.Sandbox)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "INTERNAL_ERROR"})
+		return
+	}
+	tenant := currentTenant(c)
+	if tenant == "" {
+		// Primera key de un servicio abierto: como una key estática sin tenant
+		tenant = input.Name
+	}
+	k := &ManagedKey{
+		ID:                uuid.NewString(),
+		Name:              input.Name,
+		Tenant:            tenant,
+		Role:              input.Role,
+		MaxConcurrentJobs: input.MaxConcurrentJobs,
+		Prefix:            secretPrefix(secret),
+		ExpiresAt:         input.ExpiresAt,
+		CreatedAt:         time.Now(),
+		Sandbox:           input.Sandbox,
+		RequireSignature:  input.RequireSignature,
+		AllowedCIDRs:      cidrs,
+		hash:              hashKeySecret(secret),
+	}
+	if k.RequireSignature {
+		k.signingSecret = secret
+	}
+	switch err := managedKeys.create(k); {
+	case errors.Is(err, errKeyNameTaken), errors.Is(err, errTooManyKeys):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+	logWithRequestID(requestID(c), "🚀 API key creada: "+k.Name+" ("+k.Role+")")
+	if len(k.AllowedCIDRs) > 0 {
+		recordAllowlistChange(c, k)
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusCreated, KeyWithSecret{ManagedKey: *k, Key: secret})
+}
+
+// POST /keys/:key_id/rotate genera un secreto nuevo. El anterior sigue
+// valiendo durante API_KEY_ROTATION_GRACE para poder desplegarlo sin cortes.
+func rotateKeyHandler(c *gin.Context) {
+	current, ok := managedKeys.get(currentTenant(c), c.Param("key_id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	// El secreto nuevo conserva el prefijo de sandbox
+	secret, err := newKeySecret(current.Sandbox)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "INTERNAL_ERROR"})
+		return
+	}
+	var revoked bool
+	k, found, err := managedKeys.update(currentTenant(c), c.Param("key_id"), func(k *ManagedKey) {
+		if k.RevokedAt != nil {
+			revoked = true
+			return
+		}
+		if cfg.APIKeyRotationGrace.Duration > 0 {
+			expires := time.Now().Add(cfg.APIKeyRotationGrace.Duration)
+			k.previousHash, k.PreviousExpiresAt = k.hash, &expires
+			k.previousSigningSecret = k.signingSecret
+		} else {
+			k.previousHash, k.PreviousExpiresAt = "", nil
+			k.previousSigningSecret = ""
+		}
+		k.hash = hashKeySecret(secret)
+		if k.RequireSignature {
+			k.signingSecret = secret
+		}
+		k.Prefix = secretPrefix(secret)
+	})
+	switch {
+	case !found:
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	case revoked:
+		c.JSON(http.StatusConflict, gin.H{"error": "API key is revoked"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, KeyWithSecret{ManagedKey: k, Key: secret})
+}
+
+// PATCH /keys/:key_id cambia los rangos desde los que se acepta la key
+func updateKeyHandler(c *gin.Context) {
+	var input KeyUpdateBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.AllowedCIDRs == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "allowed_cidrs is required", "code": "INVALID_REQUEST"})
+		return
+	}
+	cidrs, err := normalizeAllowedCIDRs(*input.AllowedCIDRs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_REQUEST"})
+		return
+	}
+	if len(cidrs) == 0 {
+		cidrs = nil
+	}
+	k, found, err := managedKeys.update(currentTenant(c), c.Param("key_id"), func(k *ManagedKey) {
+		k.AllowedCIDRs = cidrs
+	})
+	switch {
+	case !found:
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+	recordAllowlistChange(c, &k)
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, k)
+}
+
+// Deja en el registro de auditoría quién cambió allowed_cidrs de la key
+func recordAllowlistChange(c *gin.Context, k *ManagedKey) {
+	event := AuditEvent{
+		Type:      AuditAllowlistUpdated,
+		Tenant:    k.Tenant,
+		APIKey:    k.Name,
+		ClientIP:  allowlistClientIP(c),
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		RequestID: requestID(c),
+		Message:   "allowed_cidrs: any address",
+	}
+	if len(k.AllowedCIDRs) > 0 {
+		event.Message = "allowed_cidrs: " + strings.Join(k.AllowedCIDRs, ", ")
+	}
+	if actor := currentAPIKey(c); actor != nil {
+		event.Actor = actor.Name
+	}
+	audit.record(event)
+}
+
+// DELETE /keys/:key_id revoca la key (y su secreto anterior); el registro
+// se conserva para la auditoría de los jobs
+func revokeKeyHandler(c *gin.Context) {
+	k, found, err := managedKeys.update(currentTenant(c), c.Param("key_id"), func(k *ManagedKey) {
+		if k.RevokedAt == nil {
+			now := time.Now()
+			k.RevokedAt = &now
+		}
+	})
+	switch {
+	case !found:
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+	log.Printf("⚠️ API key revocada: %s", k.Name)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Máximo de idiomas en only_if_language
+const maxOnlyIfLanguages = 20
+
+// Códigos como los que devuelve whisper: ISO 639-1, o 639-3 si no hay
+var languageCodePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// Resultado de la detección de only_if_language
+type LanguageCheck struct {
+	Detected      string   `json:"detected,omitempty"` // vacío si el backend no lo determinó
+	Allowed       []string `json:"allowed"`
+	Matched       bool     `json:"matched"`
+	Model         string   `json:"model"`
+	SampleSeconds float64  `json:"sample_seconds"`
+}
+
+func validateOnlyIfLanguage(languages []string) error {
+	if len(languages) > maxOnlyIfLanguages {
+		return errors.Errorf("at most %d languages are allowed in only_if_language", maxOnlyIfLanguages)
+	}
+	for i, lang := range languages {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if !languageCodePattern.MatchString(lang) {
+			return errors.New("only_if_language must list language codes such as en or yo")
+		}
+		languages[i] = lang
+	}
+	return nil
+}
+
+// Sin lista se admite cualquier idioma
+func languageAllowed(allowed []string, lang string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	lang = strings.ToLower(lang)
+	for _, l := range allowed {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// Detecta el idioma con una pasada rápida sobre el comienzo del audio. Si no
+// está en allowed el job termina como skipped y ok es false. Si la
+// detección falla se transcribe igualmente: ante la duda no se descarta.
+func checkJobLanguage(ctx context.Context, jobID string, payload PythonRequest, duration float64, allowed []string) (detected string, ok bool) {
+	sample := cfg.LanguageDetectSample.Seconds()
+	if duration > 0 {
+		sample = math.Min(sample, duration)
+	}
+	detect := payload
+	detect.Model = cfg.LanguageDetectModel
+	detect.Backend = "" // el backend de un modelo propio puede no servir el rápido
+	detect.Language = ""
+	detect.Translate = false
+	detect.Prompt = ""
+	detect.ClipTimestamps = []float64{0, sample}
+	detect.Partials = nil
+
+	result, _, err := transcribeWithFallback(ctx, jobID, detect)
+	if err != nil {
+		jobLogf(jobID, "⚠️ Falló la detección de idioma del job %s, se transcribe igualmente: %v", jobID, err)
+		recordEvent(jobID, JobEvent{Type: EventError, Code: "LANGUAGE_DETECTION_FAILED", Message: err.Error()})
+		return "", true
+	}
+
+	check := LanguageCheck{
+		Detected:      strings.ToLower(result.Language),
+		Allowed:       allowed,
+		Model:         cfg.LanguageDetectModel,
+		SampleSeconds: round2(sample),
+	}
+	check.Matched = check.Detected != "" && languageAllowed(allowed, check.Detected)
+	if check.Detected == "" {
+		// Sin idioma no hay con qué comparar; como un fallo de la detección
+		jobLogf(jobID, "⚠️ El backend no detectó el idioma del job %s, se transcribe igualmente", jobID)
+		recordEvent(jobID, JobEvent{Type: EventError, Code: "LANGUAGE_DETECTION_FAILED", Message: "backend returned no language"})
+	}
+	if check.Matched || check.Detected == "" {
+		updateJob(jobID, func(job *JobState) { job.LanguageCheck = &check })
+		return check.Detected, true
+	}
+
+	jobLogf(jobID, "🚀 Job %s omitido: idioma %s fuera de only_if_language", jobID, check.Detected)
+	mu.Lock()
+	defer unlockJobs()
+	if job, exists := jobStore[jobID]; exists {
+		job.Status = "skipped"
+		job.Language = check.Detected
+		job.LanguageCheck = &check
+		message := fmt.Sprintf("detected language %s is not in only_if_language (%s)", check.Detected, strings.Join(allowed, ", "))
+		appendEventLocked(jobID, JobEvent{Type: EventStatus, Status: "skipped", Message: message})
+	}
+	return check.Detected, false
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// Cerrojo compartido entre réplicas; solo quien lo tiene ejecuta los
+// subsistemas en segundo plano
+type leaderLock interface {
+	// Intenta tomar el cerrojo o, si ya se tiene, renovarlo. false = lo tiene
+	// otra réplica o se perdió.
+	acquire(ctx context.Context) (bool, error)
+}
+
+// Subsistema que solo corre en el líder; debe terminar al cancelarse ctx
+type leaderTask struct {
+	name string
+	run  func(ctx context.Context)
+}
+
+type leaderElection struct {
+	lock  leaderLock
+	mu    sync.Mutex
+	tasks []leaderTask
+
+	leader bool
+	ctx    context.Context // vigente mientras se es líder
+	cancel context.CancelFunc
+}
+
+var election = &leaderElection{}
+
+// Registra un subsistema exclusivo del líder. Sin elección configurada la
+// réplica es siempre líder.
+func runAsLeader(name string, run func(ctx context.Context)) {
+	election.mu.Lock()
+	defer election.mu.Unlock()
+	task := leaderTask{name: name, run: run}
+	election.tasks = append(election.tasks, task)
+	if election.leader {
+		go task.run(election.ctx)
+	}
+}
+
+func (e *leaderElection) setLeader(leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if leader == e.leader {
+		return
+	}
+	e.leader = leader
+	if !leader {
+		log.Printf("⚠️ Liderazgo perdido, deteniendo %d subsistemas", len(e.tasks))
+		e.cancel()
+		return
+	}
+	log.Printf("🚀 Réplica elegida líder")
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+	for _, task := range e.tasks {
+		log.Printf("🚀 Arrancando %s", task.name)
+		go task.run(e.ctx)
+	}
+}
+
+func startLeaderElection() error {
+	switch cfg.LeaderElection {
+	case "":
+		election.setLeader(true)
+		return nil
+	case "redis":
+		opts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return errors.Wrap(err, "invalid REDIS_URL")
+		}
+		election.lock = &redisLeaderLock{client: redis.NewClient(opts), key: cfg.LeaderLockKey, token: instanceID()}
+	case "postgres":
+		pool, err := pgxpool.New(context.Background(), cfg.DatabaseURL)
+		if err != nil {
+			return errors.Wrap(err, "failed to connect to Postgres")
+		}
+		election.lock = &pgLeaderLock{pool: pool, key: advisoryLockKey(cfg.LeaderLockKey)}
+	default:
+		return errors.Errorf("unknown LEADER_ELECTION %q", cfg.LeaderElection)
+	}
+
+	// Primer intento síncrono para que el arranque sepa ya si es líder
+	election.campaign()
+	go func() {
+		ticker := time.NewTicker(cfg.LeaderLeaseTTL.Duration / 3)
+		defer ticker.Stop()
+		for range ticker.C {
+			election.campaign()
+		}
+	}()
+	return nil
+}
+
+func (e *leaderElection) campaign() {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.LeaderLeaseTTL.Duration/3)
+	defer cancel()
+	leader, err := e.lock.acquire(ctx)
+	if err != nil {
+		log.Printf("⚠️ Elección de líder: %v", err)
+		// Sin poder renovar no hay garantía de exclusividad
+		leader = false
+	}
+	e.setLeader(leader)
+}
+
+// Identifica a la réplica en el cerrojo de Redis y en las concesiones de jobs
+func instanceID() string {
+	host, _ := os.Hostname()
+	return host + "/" + uuid.NewString()
+}
+
+// SET NX con caducidad; renovar comprueba el token para no alargar un
+// cerrojo que ya tomó otra réplica. Al morir el líder caduca en LeaderLeaseTTL.
+type redisLeaderLock struct {
+	client *redis.Client
+	key    string
+	token  string
+}
+
+var renewLeaderScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+func (l *redisLeaderLock) acquire(ctx context.Context) (bool, error) {
+	ttl := cfg.LeaderLeaseTTL.Duration
+	renewed, err := renewLeaderScript.Run(ctx, l.client, []string{l.key}, l.token, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to renew leader lock")
+	}
+	if renewed == 1 {
+		return true, nil
+	}
+	ok, err := l.client.SetNX(ctx, l.key, l.token, ttl).Result()
+	return ok, errors.Wrap(err, "failed to acquire leader lock")
+}
+
+// Advisory lock de sesión: se mantiene mientras viva la conexión que lo tomó
+// y Postgres lo suelta si el proceso muere
+type pgLeaderLock struct {
+	pool *pgxpool.Pool
+	key  int64
+	conn *pgxpool.Conn
+}
+
+func advisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+func (l *pgLeaderLock) acquire(ctx context.Context) (bool, error) {
+	if l.conn != nil {
+		// Si la conexión cayó, Postgres ya soltó el cerrojo
+		if err := l.conn.Ping(ctx); err != nil {
+			l.conn.Release()
+			l.conn = nil
+			return false, errors.Wrap(err, "lost leader lock connection")
+		}
+		return true, nil
+	}
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to acquire Postgres connection")
+	}
+	var ok bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&ok); err != nil {
+		conn.Release()
+		return false, errors.Wrap(err, "failed to acquire leader lock")
+	}
+	if !ok {
+		conn.Release()
+		return false, nil
+	}
+	l.conn = conn
+	return true, nil
+}
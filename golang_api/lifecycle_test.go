@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ai/youtube_transcriber/internal/mockwhisper"
+)
+
+const testAPIKey = "testkey1234567890"
+
+// Gateway completo contra los backends simulados, con la configuración de
+// extra encima de la mínima. Los jobs viven en memoria, como sin STATE_DIR.
+func newTestGateway(t *testing.T, extra map[string]interface{}, mocks ...*httptest.Server) *httptest.Server {
+	t.Helper()
+	urls := make([]string, len(mocks))
+	for i, m := range mocks {
+		urls[i] = m.URL
+	}
+	dir := t.TempDir()
+	config := map[string]interface{}{
+		"api_keys":         []map[string]string{{"key": testAPIKey, "name": "tests", "role": "admin", "tenant": "acme"}},
+		"whisper_backends": urls,
+		"gateway_download": false,
+		"ffprobe_path":     filepath.Join(dir, "no-ffprobe"),
+		"download_dir":     filepath.Join(dir, "downloads"),
+		"artifacts_dir":    filepath.Join(dir, "artifacts"),
+		"backend_warmup":   false,
+	}
+	for k, v := range extra {
+		config[k] = v
+	}
+	data, _ := json.Marshal(config)
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg, _ = readConfig(t.Fatalf)
+	initLiveConfig()
+	jobScheduler = newScheduler(cfg.Workers, cfg.ShortLaneFraction)
+	preprocessSlots = make(chan struct{}, cfg.PreprocessWorkers)
+	backends = newBackendPool(cfg.WhisperBackends)
+	var err error
+	if artifacts, err = newObjectStore(); err != nil {
+		t.Fatal(err)
+	}
+	if eventBus, err = newEventBus(); err != nil {
+		t.Fatal(err)
+	}
+	if encryption, err = newEnvelope(); err != nil {
+		t.Fatal(err)
+	}
+	gateway := httptest.NewServer(newRouter())
+	t.Cleanup(gateway.Close)
+	// Antes de cerrar el gateway y los backends: los jobs de la prueba leen
+	// cfg y los demás globales hasta terminar, y la siguiente los reemplaza
+	t.Cleanup(runningJobs.Wait)
+	return gateway
+}
+
+func startMock(t *testing.T, opts ...mockwhisper.Option) (*mockwhisper.Server, *httptest.Server) {
+	t.Helper()
+	mock := mockwhisper.New(opts...)
+	srv := mock.Start()
+	t.Cleanup(srv.Close)
+	return mock, srv
+}
+
+func apiRequest(t *testing.T, method, url string, body interface{}) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, _ := http.NewRequest(method, url, reader)
+	req.Header.Set("X-API-Key", testAPIKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp, out
+}
+
+func submitJob(t *testing.T, gateway *httptest.Server, body map[string]interface{}) string {
+	t.Helper()
+	resp, out := apiRequest(t, http.MethodPost, gateway.URL+"/process", body)
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /process: status %d, body %v", resp.StatusCode, out)
+	}
+	id, _ := out["job_id"].(string)
+	if id == "" {
+		t.Fatalf("POST /process without job_id: %v", out)
+	}
+	return id
+}
+
+// Consulta GET /result hasta que el job termina
+func waitJob(t *testing.T, gateway *httptest.Server, jobID string) map[string]interface{} {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	var seen []string
+	for time.Now().Before(deadline) {
+		_, job := apiRequest(t, http.MethodGet, gateway.URL+"/result/"+jobID, nil)
+		status, _ := job["status"].(string)
+		if len(seen) == 0 || seen[len(seen)-1] != status {
+			seen = append(seen, status)
+		}
+		if isTerminalStatus(status) {
+			return job
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish; statuses seen: %v", jobID, seen)
+	return nil
+}
+
+func eventTypes(t *testing.T, gateway *httptest.Server, jobID string) []string {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, gateway.URL+"/jobs/"+jobID+"/events", nil)
+	req.Header.Set("X-API-Key", testAPIKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Events []JobEvent `json:"events"`
+	}
+	json.NewDecoder(resp.Body).Decode(&out)
+	types := make([]string, len(out.Events))
+	for i, e := range out.Events {
+		types[i] = e.Type
+	}
+	return types
+}
+
+func TestJobLifecycleCompleted(t *testing.T) {
+	mock, backend := startMock(t, mockwhisper.WithMode(mockwhisper.ModeSlow), mockwhisper.WithDelay(200*time.Millisecond))
+	gateway := newTestGateway(t, nil, backend)
+
+	jobID := submitJob(t, gateway, map[string]interface{}{"url": "https://media.example/a.mp3", "language": "yo"})
+	_, job := apiRequest(t, http.MethodGet, gateway.URL+"/result/"+jobID, nil)
+	if status := job["status"]; isTerminalStatus(status.(string)) {
+		t.Fatalf("job finished before the backend answered: %v", status)
+	}
+
+	job = waitJob(t, gateway, jobID)
+	if job["status"] != "completed" {
+		t.Fatalf("status = %v, want completed (error %v)", job["status"], job["error"])
+	}
+	if want := mockwhisper.DefaultResponse().Transcription; job["transcription"] != want {
+		t.Errorf("transcription = %q, want %q", job["transcription"], want)
+	}
+	if job["backend"] != backend.URL {
+		t.Errorf("backend = %v, want %s", job["backend"], backend.URL)
+	}
+	reqs := mock.Requests()
+	if len(reqs) != 1 || reqs[0].URL != "https://media.example/a.mp3" || reqs[0].Language != "yo" {
+		t.Errorf("backend requests = %+v", reqs)
+	}
+}
+
+func TestJobLifecycleFailed(t *testing.T) {
+	tests := []struct {
+		name string
+		mode mockwhisper.Mode
+	}{
+		{"invalid input", mockwhisper.ModeBadInput},
+		{"backend error", mockwhisper.ModeError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, backend := startMock(t, mockwhisper.WithMode(tt.mode))
+			gateway := newTestGateway(t, map[string]interface{}{"backend_fallback": false}, backend)
+
+			job := waitJob(t, gateway, submitJob(t, gateway, map[string]interface{}{"url": "https://media.example/a.mp3"}))
+			if job["status"] != "failed" {
+				t.Fatalf("status = %v, want failed", job["status"])
+			}
+			if msg, _ := job["error"].(string); msg == "" {
+				t.Errorf("failed job without error message: %v", job)
+			}
+		})
+	}
+}
+
+func TestJobLifecycleRetryOnOtherBackend(t *testing.T) {
+	// A igual carga el pool elige el primero, que se queda sin memoria
+	first, backendA := startMock(t, mockwhisper.WithScript(mockwhisper.ModeOOM))
+	second, backendB := startMock(t)
+	gateway := newTestGateway(t, nil, backendA, backendB)
+
+	jobID := submitJob(t, gateway, map[string]interface{}{"url": "https://media.example/a.mp3"})
+	job := waitJob(t, gateway, jobID)
+	if job["status"] != "completed" || job["backend"] != backendB.URL {
+		t.Fatalf("job = %v, want completed on %s", job, backendB.URL)
+	}
+	if len(first.Requests()) != 1 || len(second.Requests()) != 1 {
+		t.Errorf("backend requests = %d and %d, want 1 each", len(first.Requests()), len(second.Requests()))
+	}
+	retried := false
+	for _, typ := range eventTypes(t, gateway, jobID) {
+		retried = retried || typ == EventRetry
+	}
+	if !retried {
+		t.Errorf("no %s event recorded", EventRetry)
+	}
+}
+
+func TestJobLifecycleRetryWithSmallerModel(t *testing.T) {
+	mock, backend := startMock(t, mockwhisper.WithScript(mockwhisper.ModeOOM))
+	gateway := newTestGateway(t, nil, backend)
+
+	job := waitJob(t, gateway, submitJob(t, gateway, map[string]interface{}{"url": "https://media.example/a.mp3", "model": "large"}))
+	if job["status"] != "completed" {
+		t.Fatalf("status = %v, want completed (error %v)", job["status"], job["error"])
+	}
+	reqs := mock.Requests()
+	if len(reqs) != 2 || reqs[0].Model != "large" || reqs[1].Model != smallerModel("large") {
+		t.Errorf("backend requests = %+v, want large then %s", reqs, smallerModel("large"))
+	}
+}
+
+func TestJobLifecycleNoRetryWithoutFallback(t *testing.T) {
+	mock, backend := startMock(t, mockwhisper.WithScript(mockwhisper.ModeOOM))
+	gateway := newTestGateway(t, map[string]interface{}{"backend_fallback": false}, backend)
+
+	job := waitJob(t, gateway, submitJob(t, gateway, map[string]interface{}{"url": "https://media.example/a.mp3", "model": "large"}))
+	if job["status"] != "failed" || !strings.Contains(job["error"].(string), "CUDA out of memory") {
+		t.Fatalf("job = %v, want failed with the backend error", job)
+	}
+	if n := len(mock.Requests()); n != 1 {
+		t.Errorf("backend received %d requests, want 1", n)
+	}
+}
+
+func TestJobLifecycleMalformedResponse(t *testing.T) {
+	_, backend := startMock(t, mockwhisper.WithMode(mockwhisper.ModeMalformed))
+	gateway := newTestGateway(t, map[string]interface{}{"backend_fallback": false}, backend)
+
+	job := waitJob(t, gateway, submitJob(t, gateway, map[string]interface{}{"url": "https://media.example/a.mp3"}))
+	if job["status"] != "failed" || job["error_code"] != "INVALID_BACKEND_RESPONSE" {
+		t.Fatalf("job = %v, want failed with INVALID_BACKEND_RESPONSE", job)
+	}
+	if job["transcription"] != nil && job["transcription"] != "" {
+		t.Errorf("partial body stored as transcription: %q", job["transcription"])
+	}
+}
+
+func TestJobLifecycleStreamedResponse(t *testing.T) {
+	_, backend := startMock(t, mockwhisper.WithMode(mockwhisper.ModeStream), mockwhisper.WithDelay(200*time.Millisecond))
+	gateway := newTestGateway(t, nil, backend)
+
+	job := waitJob(t, gateway, submitJob(t, gateway, map[string]interface{}{"url": "https://media.example/a.mp3"}))
+	if job["status"] != "completed" {
+		t.Fatalf("status = %v, want completed (error %v)", job["status"], job["error"])
+	}
+	want := mockwhisper.DefaultResponse()
+	if job["transcription"] != want.Transcription {
+		t.Errorf("transcription = %q, want %q", job["transcription"], want.Transcription)
+	}
+	if segments, _ := job["segments"].([]interface{}); len(segments) != len(want.Segments) {
+		t.Errorf("got %d segments, want %d", len(segments), len(want.Segments))
+	}
+}
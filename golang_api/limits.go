@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+)
+
+// Modos de CONCURRENCY_LIMIT_MODE
+const (
+	LimitModeQueue  = "queue"  // el job espera en queued detrás de los de su key
+	LimitModeReject = "reject" // la petición se rechaza con 429
+)
+
+// Cupos de jobs en curso por API key, con espera FIFO por key
+type keyLimiter struct {
+	mu      sync.Mutex
+	active  map[string]int
+	waiting map[string][]chan struct{}
+}
+
+var jobLimiter = &keyLimiter{
+	active:  make(map[string]int),
+	waiting: make(map[string][]chan struct{}),
+}
+
+// Toma un cupo sin esperar; false si la key ya está en su límite
+func (l *keyLimiter) tryAcquire(key string, limit int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[key] >= limit || len(l.waiting[key]) > 0 {
+		return false
+	}
+	l.active[key]++
+	return true
+}
+
+// Jobs de la key en curso y esperando cupo
+func (l *keyLimiter) usage(key string) (active, waiting int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active[key], len(l.waiting[key])
+}
+
+// Espera (en orden de llegada) hasta obtener un cupo
+func (l *keyLimiter) acquire(key string, limit int) {
+	l.mu.Lock()
+	if l.active[key] < limit && len(l.waiting[key]) == 0 {
+		l.active[key]++
+		l.mu.Unlock()
+		return
+	}
+	ready := make(chan struct{})
+	l.waiting[key] = append(l.waiting[key], ready)
+	l.mu.Unlock()
+
+	<-ready
+}
+
+// Libera un cupo y se lo cede directamente al siguiente en espera
+func (l *keyLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if queue := l.waiting[key]; len(queue) > 0 {
+		next := queue[0]
+		if len(queue) == 1 {
+			delete(l.waiting, key)
+		} else {
+			l.waiting[key] = queue[1:]
+		}
+		close(next)
+		return
+	}
+	l.active[key]--
+	if l.active[key] <= 0 {
+		delete(l.active, key)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Línea del log de accesos en formato JSON
+type accessLogEntry struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	LatencyMS float64   `json:"latency_ms"`
+	ClientIP  string    `json:"client_ip"`
+	Bytes     int       `json:"bytes"`
+	APIKey    string    `json:"api_key,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+var accessLogger = log.New(os.Stdout, "", 0)
+
+// Log de accesos estructurado. Con AccessLogSampleRate < 1 solo se registra
+// esa fracción de las peticiones; los errores 5xx se registran siempre.
+func accessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		if status < 500 && live().AccessLogSampleRate < 1 && rand.Float64() >= live().AccessLogSampleRate {
+			return
+		}
+
+		entry := accessLogEntry{
+			Time:      start,
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Status:    status,
+			LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			ClientIP:  c.ClientIP(),
+			Bytes:     c.Writer.Size(),
+			RequestID: requestID(c),
+			Error:     c.Errors.ByType(gin.ErrorTypePrivate).String(),
+		}
+		if entry.Bytes < 0 {
+			entry.Bytes = 0
+		}
+		if key := currentAPIKey(c); key != nil {
+			entry.APIKey = key.Name
+		}
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		accessLogger.Println(string(line))
+	}
+}
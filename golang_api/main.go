@@ -1,13 +1,11 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
-	"io"
+	"context"
+	"fmt"
 	"log"
 	"net/http"
-	"net/url"
-	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,63 +16,546 @@ import (
 
 // Estructura del estado del job
 type JobState struct {
-	Status        string    `json:"status"`                  // queued, processing, completed, failed
-	Transcription string    `json:"transcription,omitempty"` // puede incluir letras yorùbá
-	Translation   string    `json:"translation,omitempty"`
-	Error         string    `json:"error,omitempty"`
-	Timestamp     time.Time `json:"timestamp"`
+	Type          string            `json:"type"`
+	Status        string            `json:"status"`                  // queued, downloading, transcoding, processing, completed, failed
+	Transcription string            `json:"transcription,omitempty"` // puede incluir letras yorùbá
+	Translation   string            `json:"translation,omitempty"`
+	Language      string            `json:"language,omitempty"` // idioma detectado por el backend
+	Segments      []Segment         `json:"segments,omitempty"`
+	Chapters      []Chapter         `json:"chapters,omitempty"` // solo si el backend los detecta
+	Stats         *TranscriptStats  `json:"stats,omitempty"`
+	AudioQuality  *AudioQuality     `json:"audio_quality,omitempty"` // con AUDIO_ANALYSIS
+	Review        *JobReview        `json:"review,omitempty"`        // solo jobs creados con review = true
+	PurgedAt      *time.Time        `json:"purged_at,omitempty"`     // la retención del tenant borró el texto y los artefactos
+	Error         string            `json:"error,omitempty"`
+	ErrorCode     string            `json:"error_code,omitempty"` // código estable, p. ej. CHECKSUM_MISMATCH
+	Download      *DownloadProgress `json:"download,omitempty"`   // solo si el gateway descarga el medio
+	APIKey        string            `json:"api_key,omitempty"`    // nombre de la key que creó el job
+	Tags          []string          `json:"tags,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	Duration      float64           `json:"duration_seconds,omitempty"`
+	Lane          string            `json:"lane,omitempty"` // short o standard
+	Backend       string            `json:"backend,omitempty"`
+	RoutingRule   string            `json:"routing_rule,omitempty"`
+	Cache         bool              `json:"cache,omitempty"` // resultado servido desde la caché
+	Artifacts     []Artifact        `json:"artifacts,omitempty"`
+	Deliveries    []JobDelivery     `json:"deliveries,omitempty"`   // exportaciones a las integraciones del tenant
+	Chunks        *ChunkProgress    `json:"chunks,omitempty"`       // solo audio largo troceado
+	MediaFormat   string            `json:"media_format,omitempty"` // contenedor detectado en el medio descargado
+	SpeechRatio   *float64          `json:"speech_ratio,omitempty"` // fracción con voz, con VAD_CHECK o AUDIO_ANALYSIS
+	RequestID     string            `json:"request_id,omitempty"`   // X-Request-ID de la petición que lo creó
+	Timestamp     time.Time         `json:"timestamp"`
+
+	// Crece en cada cambio del job (ver nextUpdateSeqLocked): un valor menor
+	// que el ya visto es una actualización atrasada y un salto indica
+	// cambios que no llegaron
+	UpdatedSeq int64 `json:"updated_seq"`
+
+	// Segments y transcription son provisionales: el backend aún los manda
+	// en streaming o faltan fragmentos del audio troceado
+	Partial bool `json:"partial,omitempty"`
+
+	// Resultado de la detección, solo en jobs con only_if_language
+	LanguageCheck *LanguageCheck `json:"language_check,omitempty"`
+
+	// Job con el mismo audio del que se copió el resultado
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+
+	// Prioridad pedida y, mientras espera un worker, la que sube con la
+	// espera (solo en la réplica que lo ejecuta)
+	Priority          int  `json:"priority,omitempty"`
+	EffectivePriority *int `json:"effective_priority,omitempty"`
+
+	// Coste con el que cuenta en GPU_MINUTES_BUDGET
+	EstimatedGPUMinutes float64 `json:"estimated_gpu_minutes,omitempty"`
+
+	// Creado con una key de sandbox: el resultado es de prueba
+	Sandbox bool `json:"sandbox,omitempty"`
 }
 
 // Entrada del cliente
 type RequestBody struct {
+	Type      string `json:"type,omitempty"`     // transcription (por defecto) o burn_subtitles
+	Template  string `json:"template,omitempty"` // plantilla del tenant con las opciones por defecto
 	URL       string `json:"url"`
+	UploadID  string `json:"upload_id,omitempty"` // medio subido con un enlace de POST /uploads, en lugar de url
 	Language  string `json:"language"`
 	Translate bool   `json:"translate"`
+	Model     string `json:"model,omitempty"`  // modelo whisper (tiny..large)
+	SHA256    string `json:"sha256,omitempty"` // checksum esperado del medio original
+
+	Accuracy string `json:"accuracy,omitempty"` // standard (por defecto) o high: dos pasadas
+	Review   bool   `json:"review,omitempty"`   // al completarse queda pendiente de revisión humana
+	Diarize  bool   `json:"diarize,omitempty"`  // pedir al backend segmentos con speaker
+
+	// Si el idioma detectado no está en la lista el job termina como
+	// skipped, sin transcribir
+	OnlyIfLanguage []string `json:"only_if_language,omitempty"`
+
+	// 0 (por defecto) a 9: en la cola pasan antes los de más prioridad
+	Priority int `json:"priority,omitempty"`
+
+	// Identifican al job (y al interesado) para POST /admin/erasure
+	Tags     []string          `json:"tags,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	Subtitles *SubtitleOptions `json:"subtitles,omitempty"` // estilo por defecto de los subtítulos
+	Format    *FormatOptions   `json:"format,omitempty"`    // mayúsculas, puntuación y números del texto
+
+	TranscriptJobID string `json:"transcript_job_id,omitempty"` // solo burn_subtitles
 }
 
 // Petición al microservicio Python
 type PythonRequest struct {
-	URL       string `json:"url"`
+	URL       string `json:"url,omitempty"`       // vacía con los sftp://: el backend lee file_path
+	FilePath  string `json:"file_path,omitempty"` // medio ya descargado en el volumen compartido
 	Language  string `json:"language"`
 	Translate bool   `json:"translate"`
+	Model     string `json:"model,omitempty"`
+	Diarize   bool   `json:"diarize,omitempty"`
+	RequestID string `json:"-"` // se envía como X-Request-ID
+	JobID     string `json:"-"` // job del gateway, para el ID del job en el backend (v2)
+	Backend   string `json:"-"` // backend fijo de un modelo propio
+	Accuracy  string `json:"-"`
+
+	// Backends y modelo de la regla de backend_routing del job; vacíos =
+	// todo el pool y sin modelo fijado
+	Backends   []string `json:"-"`
+	RouteModel string   `json:"-"`
+
+	// Segunda pasada del modo high
+	Prompt         string    `json:"initial_prompt,omitempty"`
+	ClipTimestamps []float64 `json:"clip_timestamps,omitempty"`
+
+	// Destino de los segmentos en streaming; nil = sin parciales
+	Partials *partialTranscript `json:"-"`
 }
 
 var jobStore = make(map[string]*JobState)
 var mu sync.RWMutex
 
 func main() {
-	router := gin.Default()
+	cfg = loadConfig()
+	initLiveConfig()
+	if err := initErrorTracker(); err != nil {
+		log.Fatalf("❌ No se pudo inicializar Sentry: %v", err)
+	}
+	jobScheduler = newScheduler(cfg.Workers, cfg.ShortLaneFraction)
+	preprocessSlots = make(chan struct{}, cfg.PreprocessWorkers)
+	backends = newBackendPool(cfg.WhisperBackends)
+	backends.startPolling(cfg.CapacityPollInterval.Duration)
+	backends.startWarmup()
+	if cfg.RedisURL != "" {
+		rc, err := newResultCache(cfg.RedisURL, cfg.CacheTTL.Duration)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		cache = rc
+		// Las firmas ya usadas se comparten entre réplicas en el mismo Redis
+		signatureReplays.client = rc.client
+	}
+	store, err := newObjectStore()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	artifacts = store
+	if eventBus, err = newEventBus(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if encryption, err = newEnvelope(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if stateStore, err = newStateStore(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	if cfg.S3IngestQueueURL != "" {
+		if s3Ingest, err = newS3Ingester(); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	}
+	if stateStore != nil {
+		if err := webhooks.restore(); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if cfg.Role != RoleWorker {
+			restoreJobs()
+		}
+		if err := refreshQueueState(); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if err := refreshMaintenance(); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if err := refreshModels(); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if err := refreshTemplates(); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if err := refreshKeys(); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if err := flushAuditLog(); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if err := refreshRetention(); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if err := refreshIntegrations(); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if err := refreshSFTPCredentials(); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		go runSettingsSync()
+	}
+	if err := startLeaderElection(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	go runOutboxDispatcher()
+	startTusJanitor(10 * time.Minute)
+	go runSecretsRefresher()
+	go runConfigWatcher()
+	if cfg.Role == RoleWorker {
+		runWorker()
+		return
+	}
+	runAsLeader("purga por retención", runRetentionPurger)
+	if len(cfg.AlertRules) > 0 {
+		runAsLeader("evaluación de alertas", runAlertEvaluator)
+	}
+	if cfg.MetadataExportInterval.Duration > 0 {
+		runAsLeader("exportación de metadatos", runMetadataExporter)
+	}
+	if s3Ingest != nil {
+		runAsLeader("ingesta de S3", runS3Ingest)
+	}
+	runAsLeader("sondeo de carpetas vigiladas", runConnectors)
+
+	router := newRouter()
+	log.Printf("🚀 API corriendo en http://localhost:%s", cfg.Port)
+	router.Run(":" + cfg.Port)
+}
+
+// Middlewares y rutas de la API
+func newRouter() *gin.Engine {
+	gin.SetMode(cfg.GinMode)
+	router := gin.New()
+	// Sin proxies de confianza gin cree el X-Forwarded-For de cualquiera
+	if len(cfg.TrustedProxies) > 0 {
+		if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	}
+	router.Use(requestIDMiddleware())
+	router.Use(errorBodyMiddleware())
+	if cfg.AccessLog {
+		router.Use(accessLogMiddleware())
+	}
+	if cfg.Metrics {
+		router.Use(metricsMiddleware())
+	}
+	router.Use(recoveryMiddleware())
+	router.Use(charsetMiddleware())
+	router.Use(deadlineMiddleware())
+	router.Use(authMiddleware())
+	router.Use(rbacMiddleware())
+	router.Use(maintenanceMiddleware())
+	if cfg.Role == RoleAPI {
+		router.Use(storeReadMiddleware())
+	}
+	router.Use(jobTenantMiddleware())
+
+	if local, ok := artifacts.(*localStore); ok {
+		// Enlaces firmados, sin API key
+		router.GET("/artifacts/*key", local.serve)
+		router.PUT("/artifacts/*key", local.receive)
+	}
+
+	if oidcEnabled() {
+		// ✅ Inicio de sesión OIDC para personas
+		router.GET("/auth/login", loginHandler)
+		router.GET("/auth/callback", callbackHandler)
+		router.POST("/auth/session", createSessionHandler)
+		router.POST("/auth/logout", logoutHandler)
+	}
+
+	// ✅ Métricas de las peticiones para Prometheus
+	if cfg.Metrics {
+		router.GET("/metrics", metricsHandler)
+	}
+
+	// ✅ Identidad de la petición (API key o sesión)
+	router.GET("/auth/me", meHandler)
+
+	// ✅ API keys gestionadas: crear, revocar, rotar y limitar por IP
+	router.GET("/keys", listKeysHandler)
+	router.POST("/keys", createKeyHandler)
+	router.GET("/keys/:key_id", getKeyHandler)
+	router.DELETE("/keys/:key_id", revokeKeyHandler)
+	router.PATCH("/keys/:key_id", updateKeyHandler)
+	router.POST("/keys/:key_id/rotate", rotateKeyHandler)
 
-	// ✅ Listar todos los jobs
+	// ✅ Registro de auditoría del tenant (cambios de allowed_cidrs, accesos
+	// rechazados por IP)
+	router.GET("/audit", listAuditHandler)
+
+	// ✅ Listar los jobs del tenant, con filtros opcionales de estado y revisión
 	router.GET("/jobs", func(c *gin.Context) {
+		status, reviewStatus, assignee := c.Query("status"), c.Query("review_status"), c.Query("assignee")
+		if err := validateReviewStatus(reviewStatus); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		tenant, all := currentTenant(c), isOperator(c)
 		mu.RLock()
 		defer mu.RUnlock()
 
 		response := make(map[string]*JobState)
 		for id, job := range jobStore {
-			response[id] = job
+			if meta, ok := jobMetas[id]; !all && (!ok || meta.Tenant != tenant) {
+				continue
+			}
+			if status != "" && job.Status != status {
+				continue
+			}
+			if (reviewStatus != "" || assignee != "") && job.Review == nil {
+				continue
+			}
+			if reviewStatus != "" && job.Review.Status != reviewStatus {
+				continue
+			}
+			if assignee != "" && job.Review.Assignee != assignee {
+				continue
+			}
+			response[id] = withEffectivePriority(id, job)
 		}
 		c.Header("Content-Type", "application/json; charset=utf-8")
 		c.JSON(http.StatusOK, response)
 	})
 
+	// ✅ Jobs terminados por cursor, para triggers por sondeo (Zapier, Make)
+	router.GET("/jobs/feed", jobFeedHandler)
+
+	// ✅ Totales y series por día del tenant, para informes
+	router.GET("/stats", statsHandler)
+
+	// ✅ Estado de muchos jobs en una sola petición
+	router.POST("/jobs/status", bulkJobStatusHandler)
+
+	// ✅ Vista de operación: jobs con el worker que los ejecuta y su concesión
+	router.GET("/admin/jobs", adminJobsHandler)
+
+	// ✅ Pausar y reanudar la asignación de jobs a los backends
+	router.GET("/admin/queue", getQueueHandler)
+	router.POST("/admin/queue/pause", pauseQueueHandler)
+	router.POST("/admin/queue/resume", resumeQueueHandler)
+
+	// ✅ Reparto de workers entre tenants y últimas asignaciones
+	router.GET("/admin/scheduler", schedulerStatsHandler)
+
+	// ✅ Modo mantenimiento: escrituras con 503, lecturas normales
+	router.GET("/admin/maintenance", getMaintenanceHandler)
+	router.PUT("/admin/maintenance", putMaintenanceHandler)
+
+	// ✅ Borrado de los datos de un interesado, con informe firmado
+	router.POST("/admin/erasure", erasureHandler)
+
+	// ✅ Exportación de los metadatos de los jobs (CSV o Parquet) para analítica
+	router.GET("/admin/exports", listExportsHandler)
+	router.POST("/admin/exports", createExportHandler)
+
+	// ✅ Reglas de alerta con su último valor
+	router.GET("/admin/alerts", listAlertsHandler)
+
+	// ✅ Recargar la configuración sin reiniciar (también con SIGHUP)
+	router.POST("/admin/config/reload", reloadConfigHandler)
+
+	// ✅ Qué regla de backend_routing elegiría el backend de un job y por qué
+	router.POST("/admin/routing/explain", explainRoutingHandler)
+
+	// ✅ Diagnóstico en producción: pprof y estadísticas del runtime
+	router.GET("/admin/debug/pprof/*profile", pprofHandler)
+	router.POST("/admin/debug/pprof/*profile", pprofHandler) // symbol
+	router.GET("/admin/debug/vars", runtimeStatsHandler)
+
+	// ✅ Funciones experimentales activas para el tenant
+	router.GET("/features", listFeaturesHandler)
+
+	// ✅ Sondear un medio antes de crear el job
+	router.POST("/probe", probeHandler)
+
 	// ✅ Crear un nuevo job asincrónico
 	router.POST("/process", func(c *gin.Context) {
 		var input RequestBody
-		if err := c.ShouldBindJSON(&input); err != nil {
+		if code, err := bindRequestBody(c, &input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": code})
+			return
+		}
+		if status, code, err := resolveUpload(c.Request.Context(), currentTenant(c), &input); err != nil {
+			c.JSON(status, gin.H{"error": err.Error(), "code": code})
+			return
+		}
+		if err := validateChecksumRequest(input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := defaultSubtitleOptions().merge(input.Subtitles).validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := input.Format.validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateAccuracy(input.Accuracy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateOnlyIfLanguage(input.OnlyIfLanguage); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validatePriority(input.Priority); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validateJobLabels(input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		switch input.Type {
+		case "", JobTypeTranscription:
+			input.Type = JobTypeTranscription
+			if code, err := validateRequestModel(currentTenant(c), input); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": code})
+				return
+			}
+			if err := validateRequestFeatures(currentTenant(c), input); err != nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "FEATURE_DISABLED"})
+				return
+			}
+		case JobTypeBurnSubtitles:
+			if currentAPIKey(c).sandbox() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "burn_subtitles jobs are not available with sandbox API keys", "code": "SANDBOX_UNSUPPORTED"})
+				return
+			}
+			if cfg.Role == RoleAPI {
+				if abortOnDeadline(c, refreshJob(c.Request.Context(), input.TranscriptJobID)) {
+					return
+				}
+			}
+			if err := validateBurnRequest(input, currentAPIKey(c)); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown job type"})
+			return
+		}
+		dryRun, err := isDryRun(c)
+		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if dryRun {
+			dryRunProcess(c, input)
+			return
+		}
+
+		// Resultado en caché: el job nace completado. Con sha256 siempre se
+		// procesa para verificar el medio. Las keys de sandbox no la usan.
+		if input.Type == JobTypeTranscription && input.SHA256 == "" && !currentAPIKey(c).sandbox() {
+			// Un resultado en otro idioma no vale: el job se procesa y termina skipped
+			if cached, ok := cache.get(c.Request.Context(), input); ok && languageAllowed(input.OnlyIfLanguage, cached.Language) {
+				// La caché guarda el texto sin formatear
+				formatted := input.Format.apply(cached.backendResponse(), input.Language)
+				jobID := uuid.NewString()
+				job := &JobState{
+					Type:          input.Type,
+					Status:        "completed",
+					Transcription: formatted.Transcription,
+					Translation:   formatted.Translation,
+					Language:      formatted.Language,
+					Segments:      formatted.Segments,
+					Chapters:      formatted.Chapters,
+					Stats:         input.Format.withDiacritics(cached.Stats, cached.backendResponse()),
+					Review:        newReview(input),
+					Tags:          input.Tags,
+					Metadata:      input.Metadata,
+					Cache:         true,
+					RequestID:     requestID(c),
+					Timestamp:     time.Now(),
+				}
+				if key := currentAPIKey(c); key != nil {
+					job.APIKey = key.Name
+				}
+				// La caché guarda la traducción sin glosario
+				replaced := 0
+				if input.Translate {
+					job.Translation, replaced = applyGlossary(job.Translation, glossaries.get(currentTenant(c)))
+				}
+				mu.Lock()
+				jobStore[jobID] = job
+				jobMetas[jobID] = &jobMeta{Input: input, Tenant: currentTenant(c)}
+				if replaced > 0 {
+					appendEventLocked(jobID, glossaryEvent(replaced))
+				}
+				appendEventLocked(jobID, JobEvent{Type: EventStatus, Status: "completed", Message: "served from cache"})
+				unlockJobs()
+
+				c.Header("Content-Type", "application/json; charset=utf-8")
+				c.JSON(http.StatusOK, gin.H{
+					"job_id": jobID,
+					"status": "completed",
+					"cache":  true,
+				})
+				return
+			}
+		}
+
+		key := currentAPIKey(c)
+		limit := key.concurrencyLimit()
+		reserved := false
+		// Con ROLE=api el límite lo aplica cada worker, en modo cola
+		if limit > 0 && live().ConcurrencyLimitMode == LimitModeReject && cfg.Role != RoleAPI {
+			if !jobLimiter.tryAcquire(key.Name, limit) {
+				c.JSON(http.StatusTooManyRequests, gin.H{
+					"error": fmt.Sprintf("API key already has %d jobs in progress", limit),
+					"code":  "CONCURRENCY_LIMIT",
+				})
+				return
+			}
+			reserved = true
+		}
 
 		jobID := uuid.NewString()
-		mu.Lock()
-		jobStore[jobID] = &JobState{
+		job := &JobState{
+			Type:      input.Type,
 			Status:    "queued",
+			Tags:      input.Tags,
+			Metadata:  input.Metadata,
+			Priority:  input.Priority,
+			Sandbox:   key.sandbox(),
+			RequestID: requestID(c),
 			Timestamp: time.Now(),
 		}
-		mu.Unlock()
+		if key != nil {
+			job.APIKey = key.Name
+		}
+		mu.Lock()
+		jobStore[jobID] = job
+		jobMetas[jobID] = &jobMeta{Input: input, Tenant: key.tenant()}
+		if cfg.Role == RoleAPI {
+			// Lo ejecuta, y entrega su outbox, el worker que lo reclame
+			unadoptedJobs[jobID] = true
+		}
+		appendEventLocked(jobID, JobEvent{Type: EventStatus, Status: "queued"})
+		unlockJobs()
 
-		go processJob(jobID, input)
+		if cfg.Role == RoleAll {
+			startJob(jobID, input, key, reserved)
+		}
 
 		c.Header("Content-Type", "application/json; charset=utf-8")
 		c.JSON(http.StatusAccepted, gin.H{
@@ -83,12 +564,32 @@ func main() {
 		})
 	})
 
+	// ✅ Subir un medio (admite gzip y zstd) para procesarlo con POST /process
+	router.POST("/uploads", uploadHandler)
+
+	// ✅ Subidas reanudables con el protocolo tus
+	tus := router.Group("/uploads/tus", tusMiddleware())
+	tus.OPTIONS("", tusOptionsHandler)
+	tus.POST("", tusCreateHandler)
+	tus.HEAD("/:upload_id", tusHeadHandler)
+	tus.PATCH("/:upload_id", tusPatchHandler)
+	tus.GET("/:upload_id", tusGetHandler)
+	tus.DELETE("/:upload_id", tusDeleteHandler)
+
+	// ✅ Transcripción síncrona de audio corto, sin job
+	router.POST("/transcribe/sync", syncTranscribeHandler)
+
 	// ✅ Obtener resultado de un job por ID
 	router.GET("/result/:job_id", func(c *gin.Context) {
 		jobID := c.Param("job_id")
 
 		mu.RLock()
 		job, exists := jobStore[jobID]
+		if exists {
+			// Copia: se serializa fuera de mu
+			copied := *job
+			job = withEffectivePriority(jobID, &copied)
+		}
 		mu.RUnlock()
 
 		if !exists {
@@ -100,103 +601,454 @@ func main() {
 		c.JSON(http.StatusOK, job)
 	})
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// ✅ Historial de eventos de un job
+	router.GET("/jobs/:job_id/events", func(c *gin.Context) {
+		events, exists := getJobEvents(c.Param("job_id"))
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.JSON(http.StatusOK, gin.H{"events": events})
+	})
+
+	// ✅ Subtítulos SRT, VTT, TTML o SCC de un job completado
+	router.GET("/result/:job_id/subtitles", subtitlesHandler)
+
+	// ✅ Transcripción en el esquema versionado y el esquema JSON
+	router.GET("/result/:job_id/transcript", transcriptDocumentHandler)
+	router.GET("/schemas/transcript/:version", transcriptSchemaHandler)
+
+	// ✅ Descargar un artefacto generado (vídeo con subtítulos, clips...)
+	router.GET("/jobs/:job_id/artifacts/:name", artifactHandler)
+
+	// ✅ Recortar clips del audio a partir de la transcripción
+	router.POST("/jobs/:job_id/clips", clipsHandler)
+
+	// ✅ Re-alinear una transcripción corregida con el audio
+	router.POST("/jobs/:job_id/align", alignJobHandler)
+
+	// ✅ Repetir la transcripción de un único segmento
+	router.POST("/jobs/:job_id/segments/:seg_id/retranscribe", retranscribeSegmentHandler)
+
+	// ✅ Revisión humana: asignar, liberar y aprobar
+	router.POST("/jobs/:job_id/review/claim", claimReviewHandler)
+	router.POST("/jobs/:job_id/review/release", releaseReviewHandler)
+	router.POST("/jobs/:job_id/review/approve", approveReviewHandler)
+
+	// ✅ Anotaciones sobre tramos de la transcripción
+	router.GET("/jobs/:job_id/annotations", listAnnotationsHandler)
+	router.POST("/jobs/:job_id/annotations", createAnnotationHandler)
+	router.DELETE("/jobs/:job_id/annotations/:annotation_id", deleteAnnotationHandler)
+
+	// ✅ Enlaces públicos de solo lectura a la transcripción
+	router.POST("/jobs/:job_id/share", createShareHandler)
+	router.DELETE("/jobs/:job_id/share", revokeSharesHandler)
+	router.GET("/shared/:job_id", sharedTranscriptHandler)
+
+	// ✅ Transcripción sincronizada con el medio, para iframes
+	router.GET("/jobs/:job_id/embed", embedHandler)
+
+	// ✅ Glosario de traducción del tenant
+	router.GET("/glossary", getGlossaryHandler)
+	router.PUT("/glossary", putGlossaryHandler)
+	router.DELETE("/glossary", deleteGlossaryHandler)
+
+	// ✅ Plantillas de opciones para POST /process
+	router.GET("/templates", listTemplatesHandler)
+	router.POST("/templates", createTemplateHandler)
+	router.GET("/templates/:name", getTemplateHandler)
+	router.PUT("/templates/:name", putTemplateHandler)
+	router.DELETE("/templates/:name", deleteTemplateHandler)
+
+	// ✅ Política de retención del tenant y registro de lo que borró
+	router.GET("/retention", getRetentionHandler)
+	router.PUT("/retention", putRetentionHandler)
+	router.GET("/retention/deletions", retentionDeletionsHandler)
+
+	// ✅ Modelos afinados del tenant, servidos por un backend concreto
+	router.GET("/models", listModelsHandler)
+	router.PUT("/models/:name", putModelHandler)
+	router.DELETE("/models/:name", deleteModelHandler)
+
+	// ✅ Webhooks del tenant (job.completed, job.failed...)
+	router.GET("/webhooks", listWebhooksHandler)
+	router.GET("/webhooks/events", webhookEventsHandler)
+	router.POST("/webhooks", createWebhookHandler)
+	router.GET("/webhooks/:webhook_id", getWebhookHandler)
+	router.PATCH("/webhooks/:webhook_id", updateWebhookHandler)
+	router.DELETE("/webhooks/:webhook_id", deleteWebhookHandler)
+	router.POST("/webhooks/:webhook_id/rotate-secret", rotateWebhookSecretHandler)
+
+	// ✅ Exportar las transcripciones completadas a Google Docs o Notion
+	router.GET("/integrations", listIntegrationsHandler)
+	router.POST("/integrations", createIntegrationHandler)
+	router.GET("/integrations/:integration_id", getIntegrationHandler)
+	router.PATCH("/integrations/:integration_id", updateIntegrationHandler)
+	router.DELETE("/integrations/:integration_id", deleteIntegrationHandler)
+
+	// ✅ Aviso de los backends con protocolo v2 de que un job terminó
+	router.POST(backendCallbackPrefix+":backend_job_id", backendCallbackHandler)
+
+	// ✅ Grabaciones de llamadas de Twilio (recordingStatusCallback)
+	router.POST(twilioCallbackPath, twilioCallbackHandler)
+
+	// ✅ Grabaciones en la nube de Zoom (webhook recording.completed)
+	router.POST(zoomWebhookPath, zoomWebhookHandler)
+
+	// ✅ Audios por correo (inbound parse de SendGrid o route de Mailgun)
+	router.POST(emailInboundPath, emailInboundHandler)
+
+	// ✅ Bots de Telegram, WhatsApp y Discord: audios transcritos en el chat
+	router.POST(telegramWebhookPath, telegramWebhookHandler)
+	router.GET(whatsAppWebhookPath, whatsAppVerifyHandler)
+	router.POST(whatsAppWebhookPath, whatsAppWebhookHandler)
+	router.POST(discordInteractionsPath, discordInteractionsHandler)
+
+	// ✅ Credenciales de los hosts de los sftp:// del tenant
+	router.GET("/sftp/credentials", listSFTPCredentialsHandler)
+	router.PUT("/sftp/credentials/:host", putSFTPCredentialHandler)
+	router.DELETE("/sftp/credentials/:host", deleteSFTPCredentialHandler)
+
+	// ✅ Capacidad agregada de los backends whisper
+	router.GET("/capacity", func(c *gin.Context) {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.JSON(http.StatusOK, backends.summary())
+	})
+
+	// ✅ Invalidar resultados en caché de una URL (p. ej. si cambió el audio)
+	router.DELETE("/cache", func(c *gin.Context) {
+		if cache == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "result cache is not enabled"})
+			return
+		}
+		rawURL := c.Query("url")
+		if rawURL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "url query parameter is required"})
+			return
+		}
+
+		deleted, err := cache.invalidate(c.Request.Context(), rawURL, c.Query("language"), c.Query("model"), c.Query("translate"))
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+	})
+	return router
+}
+
+// Jobs que se ejecutan en este proceso; las pruebas esperan a que terminen
+// antes de cambiar la configuración
+var runningJobs sync.WaitGroup
+
+// Ejecuta el job en segundo plano
+func startJob(jobID string, input RequestBody, key *APIKey, reserved bool) {
+	runningJobs.Add(1)
+	go func() {
+		defer runningJobs.Done()
+		runJob(jobID, input, key, reserved)
+	}()
+}
+
+// Ejecuta el job respetando el límite de la key. reserved indica que el
+// hueco ya se tomó al aceptar la petición.
+func runJob(jobID string, input RequestBody, key *APIKey, reserved bool) {
+	defer applyMediaRetention(jobID)
+	defer recoverJob(jobID)
+	if limit := key.concurrencyLimit(); limit > 0 {
+		if !reserved {
+			jobLimiter.acquire(key.Name, limit)
+		}
+		defer jobLimiter.release(key.Name)
+	}
+	if job, _ := getJob(jobID); job.Sandbox {
+		processSandboxJob(jobID, input)
+		return
+	}
+	if input.Type == JobTypeBurnSubtitles {
+		processBurnJob(jobID, input, key)
+		return
 	}
-	log.Printf("🚀 API corriendo en http://localhost:%s", port)
-	router.Run(":" + port)
+	processJob(jobID, input)
 }
 
 // Ejecuta el trabajo en background
 func processJob(jobID string, input RequestBody) {
-	mu.Lock()
-	jobStore[jobID].Status = "processing"
-	mu.Unlock()
-
-	// Validar URL
-	parsedURL, err := url.Parse(input.URL)
-	if err != nil {
+	meta, _ := getJobMeta(jobID)
+	// La preparación del medio ocupa disco y CPU del gateway: se limita
+	// aparte hasta que el job pasa a esperar worker
+	releasePreprocess := acquirePreprocess()
+	defer releasePreprocess()
+	// Grabaciones de Zoom y notas de voz de los bots: se copian al almacén
+	// en el primer intento
+	if stage := sourceStager(meta.Source); stage != nil && input.UploadID == "" {
+		setJobStatus(jobID, "downloading")
+		uploadID, err := stage(meta)
+		if err != nil {
+			failJob(jobID, "DOWNLOAD_FAILED", errors.Wrap(err, "failed to download recording").Error())
+			return
+		}
+		input.UploadID = uploadID
 		mu.Lock()
-		jobStore[jobID].Status = "failed"
-		jobStore[jobID].Error = errors.Wrap(err, "invalid URL format").Error()
-		mu.Unlock()
-		return
+		if m, ok := jobMetas[jobID]; ok {
+			m.Input.UploadID = uploadID
+		}
+		unlockJobs()
+	}
+	// El enlace firmado al aceptar el job pudo caducar (job restaurado...)
+	if input.UploadID != "" {
+		input.URL = ""
+		if _, code, err := resolveUpload(context.Background(), meta.Tenant, &input); err != nil {
+			failJob(jobID, code, err.Error())
+			return
+		}
 	}
 
-	if parsedURL.Scheme != "https" && parsedURL.Scheme != "http" {
-		mu.Lock()
-		jobStore[jobID].Status = "failed"
-		jobStore[jobID].Error = "URL must use http or https scheme"
-		mu.Unlock()
-		return
+	// Medio de la ingesta de S3: enlace firmado nuevo en cada intento
+	if meta.Source != nil && meta.Source.Kind == SourceS3 && input.UploadID == "" {
+		link, err := sourceURL(context.Background(), meta.Source)
+		if err != nil {
+			failJob(jobID, "STORAGE_FAILED", err.Error())
+			return
+		}
+		input.URL = link
 	}
 
-	if parsedURL.Host == "" {
-		mu.Lock()
-		jobStore[jobID].Status = "failed"
-		jobStore[jobID].Error = "URL must have a valid host"
-		mu.Unlock()
+	// Validar URL
+	parsedURL, err := validateJobMediaURL(input.URL)
+	if err != nil {
+		failJob(jobID, "INVALID_URL", err.Error())
 		return
 	}
 
+	job, _ := getJob(jobID)
 	payload := PythonRequest{
-		URL:       input.URL,
+		URL:       backendMediaURL(input.URL),
 		Language:  input.Language,
 		Translate: input.Translate,
+		Model:     input.Model,
+		RequestID: job.RequestID,
+		JobID:     jobID,
+		Accuracy:  input.Accuracy,
+		Diarize:   input.Diarize,
+	}
+	// Los jobs de integraciones no pasan por validateRequestFeatures, y una
+	// flag pudo desactivarse desde que se encoló: la opción se ignora
+	if payload.Diarize && !featureEnabled(meta.Tenant, FeatureDiarization) {
+		payload.Diarize = false
+	}
+	if payload.Accuracy == AccuracyHigh && !featureEnabled(meta.Tenant, FeatureTwoPass) {
+		payload.Accuracy = AccuracyStandard
 	}
-	jsonData, err := json.Marshal(payload)
+	if featureEnabled(meta.Tenant, FeatureStreaming) {
+		payload.Partials = &partialTranscript{jobID: jobID}
+	}
+	// Un modelo propio pudo borrarse desde que se encoló
+	custom, err := lookupModel(meta.Tenant, input.Model)
 	if err != nil {
-		mu.Lock()
-		jobStore[jobID].Status = "failed"
-		jobStore[jobID].Error = errors.Wrap(err, "failed to marshal JSON payload").Error()
-		mu.Unlock()
+		failJob(jobID, "UNKNOWN_MODEL", err.Error())
 		return
 	}
-
-	// Configurar cliente HTTP con timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	if custom != nil {
+		payload.Model = custom.backendModel()
+		payload.Backend = custom.Backend
 	}
 
-	resp, err := client.Post("http://whisper_service:8000/transcribe", "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
+	// Descarga en el gateway para aislar fallos de red del trabajo en GPU
+	source := input.URL
+	if gatewayShouldDownload(parsedURL, input) {
+		media, err := reuseDownloadedMedia(jobID)
+		if media == nil {
+			setJobStatus(jobID, "downloading")
+			media, err = downloadMedia(jobID, meta.Tenant, input.URL)
+		}
+		if err != nil {
+			failJob(jobID, "DOWNLOAD_FAILED", errors.Wrap(err, "failed to download media").Error())
+			return
+		}
+		if input.SHA256 != "" && !strings.EqualFold(input.SHA256, media.SHA256) {
+			failJob(jobID, "CHECKSUM_MISMATCH", fmt.Sprintf("media sha256 %s does not match expected %s", media.SHA256, strings.ToLower(input.SHA256)))
+			return
+		}
+		payload.FilePath = backendPath(media.Path)
+		source = media.Path
 		mu.Lock()
-		jobStore[jobID].Status = "failed"
-		jobStore[jobID].Error = errors.Wrap(err, "failed to connect to whisper service").Error()
-		mu.Unlock()
-		return
+		jobMetas[jobID].MediaPath = media.Path
+		unlockJobs()
+
+		// Contenedores que el backend no sabe leer (AMR, 3GP...) pasan a WAV
+		format, err := sniffContainer(media.Path)
+		if err != nil {
+			failJob(jobID, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		updateJob(jobID, func(job *JobState) { job.MediaFormat = format })
+		if !isSupportedContainer(format) {
+			setJobStatus(jobID, "transcoding")
+			wav, err := transcodeToWAV(media.Path)
+			if err != nil {
+				if format == "" {
+					format = "unrecognized"
+				}
+				failJob(jobID, "UNSUPPORTED_MEDIA", errors.Wrapf(err, "failed to transcode %s media", format).Error())
+				return
+			}
+			payload.FilePath = backendPath(wav)
+			source = wav
+		}
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		mu.Lock()
-		jobStore[jobID].Status = "failed"
-		jobStore[jobID].Error = errors.Wrap(err, "failed to read response body").Error()
-		mu.Unlock()
-		return
+	// Sondeo previo: la duración decide el lane de ejecución
+	var duration float64
+	if !isBackendFetchHost(parsedURL) {
+		if d, err := probeDuration(source); err != nil {
+			jobLogf(jobID, "⚠️ No se pudo sondear el medio del job %s: %v", jobID, err)
+			recordEvent(jobID, JobEvent{Type: EventError, Code: "PROBE_FAILED", Message: err.Error()})
+		} else {
+			duration = d
+		}
 	}
+	lane := laneFor(duration)
+	updateJob(jobID, func(job *JobState) {
+		job.Duration = duration
+		job.Lane = lane
+	})
 
-	var result map[string]string
-	if err := json.Unmarshal(body, &result); err != nil {
-		mu.Lock()
-		jobStore[jobID].Status = "failed"
-		jobStore[jobID].Error = errors.Wrap(err, "failed to parse JSON response").Error()
-		mu.Unlock()
-		return
+	// Otra URL con el mismo audio ya transcrito: se reutiliza su resultado.
+	// Solo con el medio en local, como el análisis del audio.
+	var fingerprint Fingerprint
+	if cfg.AudioFingerprint && payload.FilePath != "" && duration > 0 {
+		if fp, err := computeFingerprint(source); err != nil {
+			jobLogf(jobID, "⚠️ No se pudo calcular la huella acústica del job %s: %v", jobID, err)
+			recordEvent(jobID, JobEvent{Type: EventError, Code: "FINGERPRINT_FAILED", Message: err.Error()})
+		} else if completeDuplicate(jobID, input, meta.Tenant, duration, fp) {
+			return
+		} else {
+			fingerprint = fp
+		}
 	}
 
-	mu.Lock()
-	defer mu.Unlock()
+	// Sin voz no merece la pena ocupar la GPU; el análisis del audio sale de
+	// la misma pasada. Solo con el medio en local: sobre una URL habría que
+	// descargarlo dos veces.
+	if (live().VADCheck != VADCheckOff || cfg.AudioAnalysis) && payload.FilePath != "" && duration > 0 {
+		if analysis, err := analyzeAudio(source, duration, cfg.AudioAnalysis); err != nil {
+			jobLogf(jobID, "⚠️ No se pudo analizar el audio del job %s: %v", jobID, err)
+			recordEvent(jobID, JobEvent{Type: EventError, Code: "AUDIO_ANALYSIS_FAILED", Message: err.Error()})
+		} else {
+			ratio := analysis.SpeechRatio
+			updateJob(jobID, func(job *JobState) {
+				job.SpeechRatio = &ratio
+				job.AudioQuality = analysis.Quality
+			})
+			if live().VADCheck != VADCheckOff && ratio < live().VADMinSpeechRatio {
+				if live().VADCheck == VADCheckFail {
+					failJob(jobID, "NO_SPEECH", noSpeechError(ratio).Error())
+					return
+				}
+				recordEvent(jobID, JobEvent{Type: EventError, Code: "NO_SPEECH", Message: noSpeechError(ratio).Error()})
+			}
+		}
+	}
+
+	cost := round2(estimateGPUMinutes(duration, payload))
+	updateJob(jobID, func(job *JobState) { job.EstimatedGPUMinutes = cost })
+	setJobStatus(jobID, "queued")
+	releasePreprocess()
+	jobScheduler.acquire(jobID, lane, meta.Tenant, input.Priority, cost)
+	defer jobScheduler.release(jobID)
+	setJobStatus(jobID, "processing")
+
+	if len(input.OnlyIfLanguage) > 0 {
+		detected, ok := checkJobLanguage(context.Background(), jobID, payload, duration, input.OnlyIfLanguage)
+		if !ok {
+			return
+		}
+		if payload.Language == "" {
+			// La transcripción no vuelve a detectarlo
+			payload.Language = detected
+		}
+	}
+
+	// Reglas de backend_routing, ya con el idioma detectado
+	if custom == nil {
+		decision := route(RoutingInput{
+			Tenant:   meta.Tenant,
+			Language: payload.Language,
+			Model:    input.Model,
+			Duration: duration,
+			Accuracy: payload.Accuracy,
+			Diarize:  payload.Diarize,
+		})
+		decision.apply(&payload)
+		updateJob(jobID, func(job *JobState) { job.RoutingRule = decision.Rule })
+	}
 
-	if resp.StatusCode != http.StatusOK {
-		jobStore[jobID].Status = "failed"
-		jobStore[jobID].Error = string(body)
+	var res *BackendResponse
+	var fallbackModel string
+	if payload.FilePath != "" && shouldChunk(source, duration) {
+		res, fallbackModel, err = transcribeChunked(context.Background(), jobID, source, duration, payload)
+	} else {
+		res, fallbackModel, err = transcribePayload(context.Background(), jobID, payload)
+	}
+	if err != nil {
+		code := "BACKEND_ERROR"
+		var berr *backendError
+		if errors.As(err, &berr) {
+			code = berr.code
+		}
+		failJob(jobID, code, err.Error())
 		return
 	}
+	result := *res
+
+	stats := computeStats(&result, duration)
+	formatted := input.Format.apply(result, input.Language)
+	jobStats := input.Format.withDiacritics(stats, result)
+
+	translation, replaced := formatted.Translation, 0
+	if input.Translate {
+		meta, _ := getJobMeta(jobID)
+		translation, replaced = applyGlossary(formatted.Translation, glossaries.get(meta.Tenant))
+	}
 
+	mu.Lock()
 	jobStore[jobID].Status = "completed"
-	jobStore[jobID].Transcription = result["transcription"]
-	jobStore[jobID].Translation = result["translation"]
+	jobStore[jobID].Partial = false
+	jobStore[jobID].Transcription = formatted.Transcription
+	jobStore[jobID].Translation = translation
+	jobStore[jobID].Language = formatted.Language
+	jobStore[jobID].Segments = formatted.Segments
+	jobStore[jobID].Chapters = formatted.Chapters
+	jobStore[jobID].Stats = jobStats
+	jobStore[jobID].Review = newReview(input)
+	if m, ok := jobMetas[jobID]; ok && fingerprint != nil && fallbackModel == "" {
+		// Con modelo de respaldo el resultado no es el que se pidió
+		m.Fingerprint = fingerprint
+	}
+	if replaced > 0 {
+		appendEventLocked(jobID, glossaryEvent(replaced))
+	}
+	appendEventLocked(jobID, JobEvent{Type: EventStatus, Status: "completed"})
+	unlockJobs()
+
+	// Con modelo de respaldo el resultado no corresponde a la clave de caché,
+	// y con el de una regla se guarda bajo ese modelo. La caché es compartida
+	// y no sabe de la retención del tenant.
+	if input.SHA256 == "" && fallbackModel == "" && retentionPolicies.get(meta.Tenant).TranscriptDays == 0 {
+		cached := CachedResult{
+			Transcription: result.Transcription,
+			Translation:   result.Translation,
+			Language:      result.Language,
+			Segments:      result.Segments,
+			Chapters:      result.Chapters,
+			Stats:         stats,
+			CachedAt:      time.Now(),
+		}
+		if err := cache.set(context.Background(), cacheInput(input, payload), cached); err != nil {
+			jobLogf(jobID, "⚠️ No se pudo guardar en caché el job %s: %v", jobID, err)
+		}
+	}
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Nombre del ajuste compartido con el modo mantenimiento
+const maintenanceSetting = "maintenance"
+
+const defaultMaintenanceMessage = "service is under maintenance"
+
+// Modo mantenimiento: las escrituras responden 503, las lecturas siguen
+// sirviendo resultados. MAINTENANCE=true lo fuerza desde la configuración.
+type MaintenanceState struct {
+	Enabled    bool       `json:"enabled"`
+	Message    string     `json:"message,omitempty"`
+	RetryAfter Duration   `json:"retry_after"` // sugerencia para los clientes
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+var maintenanceMu sync.RWMutex
+var maintenanceState MaintenanceState
+
+// Estado efectivo: el del almacén o el forzado por configuración
+func currentMaintenance() MaintenanceState {
+	maintenanceMu.RLock()
+	state := maintenanceState
+	maintenanceMu.RUnlock()
+	if cfg.Maintenance && !state.Enabled {
+		state = MaintenanceState{Enabled: true, Message: cfg.MaintenanceMessage}
+	}
+	if !state.Enabled {
+		return MaintenanceState{UpdatedAt: state.UpdatedAt}
+	}
+	if state.Message == "" {
+		state.Message = defaultMaintenanceMessage
+	}
+	if state.RetryAfter.Duration <= 0 {
+		state.RetryAfter = cfg.MaintenanceRetryAfter
+	}
+	return state
+}
+
+func applyMaintenance(state MaintenanceState) {
+	maintenanceMu.Lock()
+	changed := state.Enabled != maintenanceState.Enabled
+	maintenanceState = state
+	maintenanceMu.Unlock()
+	if !changed {
+		return
+	}
+	if state.Enabled {
+		log.Printf("⚠️ Modo mantenimiento activado: %s", state.Message)
+	} else {
+		log.Printf("🚀 Modo mantenimiento desactivado")
+	}
+}
+
+// Relee del almacén el modo mantenimiento, que pudo cambiar otra réplica
+func refreshMaintenance() error {
+	data, err := stateStore.LoadSetting(maintenanceSetting)
+	if err != nil || data == nil {
+		return err
+	}
+	var state MaintenanceState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return errors.Wrap(err, "corrupt maintenance state")
+	}
+	applyMaintenance(state)
+	return nil
+}
+
+// Rechaza con 503 las peticiones que escriben. Las lecturas y la
+// administración (para poder salir del modo) no se ven afectadas.
+func maintenanceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		// Los callbacks de los backends son de jobs ya en curso
+		if strings.HasPrefix(c.Request.URL.Path, "/admin/") || strings.HasPrefix(c.Request.URL.Path, "/auth/") ||
+			strings.HasPrefix(c.Request.URL.Path, backendCallbackPrefix) {
+			c.Next()
+			return
+		}
+		state := currentMaintenance()
+		if !state.Enabled {
+			c.Next()
+			return
+		}
+		seconds := int(state.RetryAfter.Seconds())
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error":       state.Message,
+			"code":        "MAINTENANCE",
+			"retry_after": seconds,
+		})
+	}
+}
+
+// GET /admin/maintenance devuelve el modo mantenimiento efectivo
+func getMaintenanceHandler(c *gin.Context) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, currentMaintenance())
+}
+
+// PUT /admin/maintenance activa o desactiva el modo mantenimiento
+func putMaintenanceHandler(c *gin.Context) {
+	var input MaintenanceState
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !input.Enabled && cfg.Maintenance {
+		c.JSON(http.StatusConflict, gin.H{"error": "maintenance mode is enabled in the configuration", "code": "MAINTENANCE_FORCED"})
+		return
+	}
+	if input.RetryAfter.Duration < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "retry_after cannot be negative"})
+		return
+	}
+	now := time.Now()
+	input.UpdatedAt = &now
+	if stateStore != nil {
+		data, err := json.Marshal(input)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "INTERNAL_ERROR"})
+			return
+		}
+		if err := stateStore.SaveSetting(maintenanceSetting, data); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+			return
+		}
+	}
+	applyMaintenance(input)
+	getMaintenanceHandler(c)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Nombre del WAV generado cuando el contenedor original no es compatible
+const transcodedMediaName = "transcoded.wav"
+
+// Identifica el contenedor real por sus primeros bytes, sin fiarse de la
+// extensión. Devuelve "" si no se reconoce.
+func sniffContainer(p string) (string, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to open media")
+	}
+	defer file.Close()
+
+	head := make([]byte, 64)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", errors.Wrap(err, "failed to read media header")
+	}
+	return containerFromHeader(head[:n]), nil
+}
+
+func containerFromHeader(h []byte) string {
+	switch {
+	case bytes.HasPrefix(h, []byte("#!AMR-WB")):
+		return "amr-wb"
+	case bytes.HasPrefix(h, []byte("#!AMR")):
+		return "amr"
+	case len(h) >= 12 && bytes.Equal(h[:4], []byte("RIFF")) && bytes.Equal(h[8:12], []byte("WAVE")):
+		return "wav"
+	case bytes.HasPrefix(h, []byte("OggS")):
+		return "ogg"
+	case bytes.HasPrefix(h, []byte("fLaC")):
+		return "flac"
+	case bytes.HasPrefix(h, []byte("caff")):
+		return "caf"
+	case bytes.HasPrefix(h, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		if bytes.Contains(h, []byte("webm")) {
+			return "webm"
+		}
+		return "mkv"
+	case bytes.HasPrefix(h, []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11}):
+		return "asf" // wma/wmv
+	case len(h) >= 12 && bytes.Equal(h[4:8], []byte("ftyp")):
+		brand := string(h[8:12])
+		switch {
+		case strings.HasPrefix(brand, "3g"):
+			return "3gp"
+		case brand == "M4A " || brand == "M4B ":
+			return "m4a"
+		default:
+			return "mp4"
+		}
+	case bytes.HasPrefix(h, []byte("ID3")):
+		return "mp3"
+	case len(h) >= 2 && h[0] == 0xFF && h[1]&0xE0 == 0xE0:
+		// Sincronía de trama MPEG (mp3) o ADTS (aac)
+		if h[1]&0x06 == 0 {
+			return "aac"
+		}
+		return "mp3"
+	}
+	return ""
+}
+
+func isSupportedContainer(format string) bool {
+	for _, f := range cfg.SupportedFormats {
+		if strings.EqualFold(f, format) {
+			return true
+		}
+	}
+	return false
+}
+
+// Convierte el medio a WAV mono de 16 kHz, el formato nativo de whisper
+func transcodeToWAV(source string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.RenderTimeout.Duration)
+	defer cancel()
+
+	outPath := filepath.Join(filepath.Dir(source), transcodedMediaName)
+	cmd := exec.CommandContext(ctx, cfg.FFmpegPath,
+		"-y", "-v", "error",
+		"-i", source,
+		"-vn", "-ac", "1", "-ar", "16000",
+		"-c:a", "pcm_s16le",
+		outPath,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(err, "ffmpeg failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return outPath, nil
+}
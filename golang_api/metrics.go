@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Límites (en segundos) del histograma de latencia
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Etiquetas de una serie. route es la plantilla de gin (/result/:job_id),
+// no la ruta pedida, para que los IDs no disparen la cardinalidad.
+type requestLabels struct {
+	method, route, status, tenant, apiKey string
+}
+
+type latencySeries struct {
+	buckets []uint64 // acumulados, uno por latencyBuckets
+	count   uint64
+	sum     float64
+}
+
+// Contadores en memoria de esta réplica, con el formato de texto de
+// Prometheus en GET /metrics
+type requestMetrics struct {
+	mu       sync.Mutex
+	requests map[requestLabels]uint64
+	latency  map[requestLabels]*latencySeries // sin status
+}
+
+var httpMetrics = &requestMetrics{
+	requests: make(map[requestLabels]uint64),
+	latency:  make(map[requestLabels]*latencySeries),
+}
+
+// Huella de la API key en las etiquetas: los 12 primeros hex del SHA-256 de
+// su nombre (echo -n nombre | sha256sum | cut -c1-12), nunca la key
+func apiKeyLabel(key *APIKey) string {
+	if key == nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key.Name))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func (m *requestMetrics) observe(labels requestLabels, elapsed time.Duration) {
+	seconds := elapsed.Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[labels]++
+	labels.status = ""
+	series, ok := m.latency[labels]
+	if !ok {
+		series = &latencySeries{buckets: make([]uint64, len(latencyBuckets))}
+		m.latency[labels] = series
+	}
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			series.buckets[i]++
+		}
+	}
+	series.count++
+	series.sum += seconds
+}
+
+// Cuenta cada petición por método, ruta, código, tenant y API key. Va antes
+// de authMiddleware: la key se lee al terminar, y los 401 cuentan sin ella.
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		key := currentAPIKey(c)
+		httpMetrics.observe(requestLabels{
+			method: c.Request.Method,
+			route:  route,
+			status: strconv.Itoa(c.Writer.Status()),
+			tenant: key.tenant(),
+			apiKey: apiKeyLabel(key),
+		}, time.Since(start))
+	}
+}
+
+func (l requestLabels) format(extra ...string) string {
+	pairs := []string{
+		`method="` + escapeLabel(l.method) + `"`,
+		`route="` + escapeLabel(l.route) + `"`,
+	}
+	if l.status != "" {
+		pairs = append(pairs, `status="`+l.status+`"`)
+	}
+	pairs = append(pairs, `tenant="`+escapeLabel(l.tenant)+`"`, `api_key="`+l.apiKey+`"`)
+	return "{" + strings.Join(append(pairs, extra...), ",") + "}"
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// Series ordenadas para que la salida sea estable entre scrapes
+func sortedLabels(keys []requestLabels) {
+	sort.Slice(keys, func(i, j int) bool { return keys[i].format() < keys[j].format() })
+}
+
+// GET /metrics expone las peticiones de esta réplica en el formato de texto
+// de Prometheus; el scraper manda una API key admin como Bearer
+func metricsHandler(c *gin.Context) {
+	var out strings.Builder
+	httpMetrics.mu.Lock()
+	requests := make([]requestLabels, 0, len(httpMetrics.requests))
+	for labels := range httpMetrics.requests {
+		requests = append(requests, labels)
+	}
+	sortedLabels(requests)
+	out.WriteString("# HELP http_requests_total HTTP requests by route, status, tenant and hashed API key.\n")
+	out.WriteString("# TYPE http_requests_total counter\n")
+	for _, labels := range requests {
+		fmt.Fprintf(&out, "http_requests_total%s %d\n", labels.format(), httpMetrics.requests[labels])
+	}
+
+	latency := make([]requestLabels, 0, len(httpMetrics.latency))
+	for labels := range httpMetrics.latency {
+		latency = append(latency, labels)
+	}
+	sortedLabels(latency)
+	out.WriteString("# HELP http_request_duration_seconds HTTP request latency by route, tenant and hashed API key.\n")
+	out.WriteString("# TYPE http_request_duration_seconds histogram\n")
+	for _, labels := range latency {
+		series := httpMetrics.latency[labels]
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(&out, "http_request_duration_seconds_bucket%s %d\n", labels.format(`le="`+strconv.FormatFloat(bound, 'g', -1, 64)+`"`), series.buckets[i])
+		}
+		fmt.Fprintf(&out, "http_request_duration_seconds_bucket%s %d\n", labels.format(`le="+Inf"`), series.count)
+		fmt.Fprintf(&out, "http_request_duration_seconds_sum%s %g\n", labels.format(), series.sum)
+		fmt.Fprintf(&out, "http_request_duration_seconds_count%s %d\n", labels.format(), series.count)
+	}
+	httpMetrics.mu.Unlock()
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(out.String()))
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS job_chunks;
+DROP TABLE IF EXISTS outbox;
+DROP TABLE IF EXISTS jobs;
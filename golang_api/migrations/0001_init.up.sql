@@ -0,0 +1,47 @@
+-- Jobs: columnas para filtrar y ordenar, el resto en JSONB tal como lo
+-- guarda el StateStore de ficheros
+CREATE TABLE jobs (
+    id         TEXT PRIMARY KEY,
+    version    BIGINT      NOT NULL DEFAULT 1, -- concurrencia optimista
+    type       TEXT        NOT NULL,
+    status     TEXT        NOT NULL,
+    api_key    TEXT        NOT NULL DEFAULT '',
+    tenant     TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    job        JSONB       NOT NULL,
+    meta       JSONB       NOT NULL,
+    events     JSONB       NOT NULL DEFAULT '[]'
+);
+
+CREATE INDEX jobs_created_at_idx ON jobs (created_at);
+CREATE INDEX jobs_status_created_at_idx ON jobs (status, created_at);
+CREATE INDEX jobs_api_key_created_at_idx ON jobs (api_key, created_at);
+CREATE INDEX jobs_tenant_created_at_idx ON jobs (tenant, created_at);
+CREATE INDEX jobs_type_created_at_idx ON jobs (type, created_at);
+
+-- Entregas pendientes; se escriben en la misma transacción que el job
+CREATE TABLE outbox (
+    id         TEXT PRIMARY KEY,
+    job_id     TEXT        NOT NULL REFERENCES jobs (id) ON DELETE CASCADE,
+    message    JSONB       NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX outbox_job_id_created_at_idx ON outbox (job_id, created_at);
+
+CREATE TABLE job_chunks (
+    job_id      TEXT    NOT NULL REFERENCES jobs (id) ON DELETE CASCADE,
+    chunk_index INTEGER NOT NULL,
+    result      JSONB   NOT NULL,
+    PRIMARY KEY (job_id, chunk_index)
+);
+
+CREATE TABLE webhooks (
+    id         TEXT PRIMARY KEY,
+    tenant     TEXT        NOT NULL,
+    record     JSONB       NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX webhooks_tenant_idx ON webhooks (tenant);
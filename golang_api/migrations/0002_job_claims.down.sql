@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS jobs_claimable_idx;
+ALTER TABLE jobs DROP COLUMN IF EXISTS lease_expires_at;
+ALTER TABLE jobs DROP COLUMN IF EXISTS claimed_by;
@@ -0,0 +1,7 @@
+-- Concesión de un job al worker que lo ejecuta (ROLE=worker)
+ALTER TABLE jobs ADD COLUMN claimed_by TEXT;
+ALTER TABLE jobs ADD COLUMN lease_expires_at TIMESTAMPTZ;
+
+-- Jobs pendientes sin dueño, en el orden en que se reclaman
+CREATE INDEX jobs_claimable_idx ON jobs (created_at)
+    WHERE claimed_by IS NULL AND status NOT IN ('completed', 'failed');
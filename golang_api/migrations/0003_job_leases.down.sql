@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS jobs_pending_created_at_idx;
+CREATE INDEX jobs_claimable_idx ON jobs (created_at)
+    WHERE claimed_by IS NULL AND status NOT IN ('completed', 'failed');
@@ -0,0 +1,4 @@
+-- Los jobs con la concesión caducada también se pueden reclamar
+DROP INDEX IF EXISTS jobs_claimable_idx;
+CREATE INDEX jobs_pending_created_at_idx ON jobs (created_at)
+    WHERE status NOT IN ('completed', 'failed');
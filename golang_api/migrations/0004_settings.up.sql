@@ -0,0 +1,6 @@
+-- Ajustes de operación compartidos entre réplicas (pausa de la cola...)
+CREATE TABLE settings (
+    name       TEXT PRIMARY KEY,
+    value      JSONB       NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
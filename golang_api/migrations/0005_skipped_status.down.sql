@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS jobs_pending_created_at_idx;
+CREATE INDEX jobs_pending_created_at_idx ON jobs (created_at)
+    WHERE status NOT IN ('completed', 'failed');
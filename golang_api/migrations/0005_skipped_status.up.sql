@@ -0,0 +1,4 @@
+-- Los jobs saltados por only_if_language también son terminales
+DROP INDEX IF EXISTS jobs_pending_created_at_idx;
+CREATE INDEX jobs_pending_created_at_idx ON jobs (created_at)
+    WHERE status NOT IN ('completed', 'failed', 'skipped');
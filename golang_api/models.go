@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Nombre del ajuste compartido con los modelos propios de los tenants
+const modelsSetting = "models"
+
+// Máximo de modelos propios por tenant
+const maxModelsPerTenant = 50
+
+var modelNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+var errTooManyModels = errors.Errorf("at most %d custom models per tenant", maxModelsPerTenant)
+
+// Modelo afinado de un tenant (p. ej. un whisper yorùbá), servido por un
+// backend concreto del pool. Los jobs con model = Name van siempre a ese
+// backend, sin respaldo en otro backend ni en un modelo menor.
+type CustomModel struct {
+	Name         string    `json:"name"`
+	Backend      string    `json:"backend"`                 // URL de WHISPER_BACKENDS
+	BackendModel string    `json:"backend_model,omitempty"` // modelo que se pide al backend; por defecto name
+	Language     string    `json:"language,omitempty"`      // si se indica, solo se acepta ese idioma
+	Description  string    `json:"description,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type CustomModelBody struct {
+	Backend      string `json:"backend"`
+	BackendModel string `json:"backend_model"`
+	Language     string `json:"language"`
+	Description  string `json:"description"`
+}
+
+func (m *CustomModel) backendModel() string {
+	if m.BackendModel != "" {
+		return m.BackendModel
+	}
+	return m.Name
+}
+
+// Modelos propios por tenant
+type modelRegistry struct {
+	mu     sync.RWMutex
+	models map[string]map[string]CustomModel
+}
+
+var customModels = &modelRegistry{models: make(map[string]map[string]CustomModel)}
+
+func isBuiltinModel(name string) bool {
+	if name == "" {
+		return true
+	}
+	for _, m := range whisperModels {
+		if m == strings.ToLower(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *modelRegistry) get(tenant, name string) (CustomModel, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.models[tenant][name]
+	return m, ok
+}
+
+func (r *modelRegistry) list(tenant string) []CustomModel {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]CustomModel, 0, len(r.models[tenant]))
+	for _, m := range r.models[tenant] {
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Guarda el registro completo; requiere r.mu tomado
+func (r *modelRegistry) persistLocked() error {
+	if stateStore == nil {
+		return nil
+	}
+	byTenant := make(map[string][]CustomModel, len(r.models))
+	for tenant, models := range r.models {
+		for _, m := range models {
+			byTenant[tenant] = append(byTenant[tenant], m)
+		}
+		sort.Slice(byTenant[tenant], func(i, j int) bool { return byTenant[tenant][i].Name < byTenant[tenant][j].Name })
+	}
+	data, err := json.Marshal(byTenant)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal custom models")
+	}
+	return stateStore.SaveSetting(modelsSetting, data)
+}
+
+func (r *modelRegistry) put(tenant string, m CustomModel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	models := r.models[tenant]
+	if _, exists := models[m.Name]; !exists && len(models) >= maxModelsPerTenant {
+		return errTooManyModels
+	}
+	if models == nil {
+		models = make(map[string]CustomModel)
+		r.models[tenant] = models
+	}
+	previous, existed := models[m.Name]
+	models[m.Name] = m
+	if err := r.persistLocked(); err != nil {
+		if existed {
+			models[m.Name] = previous
+		} else {
+			delete(models, m.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// false si el modelo no existía
+func (r *modelRegistry) remove(tenant, name string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.models[tenant][name]
+	if !ok {
+		return false, nil
+	}
+	delete(r.models[tenant], name)
+	if err := r.persistLocked(); err != nil {
+		r.models[tenant][name] = m
+		return true, err
+	}
+	if len(r.models[tenant]) == 0 {
+		delete(r.models, tenant)
+	}
+	return true, nil
+}
+
+// Relee del almacén los modelos, que pudo registrar otra réplica
+func refreshModels() error {
+	data, err := stateStore.LoadSetting(modelsSetting)
+	if err != nil || data == nil {
+		return err
+	}
+	var byTenant map[string][]CustomModel
+	if err := json.Unmarshal(data, &byTenant); err != nil {
+		return errors.Wrap(err, "corrupt custom models")
+	}
+	models := make(map[string]map[string]CustomModel, len(byTenant))
+	for tenant, list := range byTenant {
+		models[tenant] = make(map[string]CustomModel, len(list))
+		for _, m := range list {
+			models[tenant][m.Name] = m
+		}
+	}
+	customModels.mu.Lock()
+	customModels.models = models
+	customModels.mu.Unlock()
+	return nil
+}
+
+// Modelo propio del tenant; nil si es un modelo whisper estándar. Si no se
+// conoce se relee el almacén por si acaba de registrarse en otra réplica.
+func lookupModel(tenant, name string) (*CustomModel, error) {
+	if isBuiltinModel(name) {
+		return nil, nil
+	}
+	m, ok := customModels.get(tenant, name)
+	if !ok && stateStore != nil {
+		if err := refreshModels(); err != nil {
+			log.Printf("⚠️ No se pudieron releer los modelos: %v", err)
+		}
+		m, ok = customModels.get(tenant, name)
+	}
+	if !ok {
+		return nil, errors.Errorf("unknown model %q: neither a whisper model nor registered for this tenant", name)
+	}
+	return &m, nil
+}
+
+// Comprueba el modelo de una petición; el error lleva su código
+func validateRequestModel(tenant string, input RequestBody) (code string, err error) {
+	m, err := lookupModel(tenant, input.Model)
+	if err != nil {
+		return "UNKNOWN_MODEL", err
+	}
+	if m != nil && m.Language != "" && !strings.EqualFold(m.Language, input.Language) {
+		return "INVALID_REQUEST", errors.Errorf("model %s only supports language %s", m.Name, m.Language)
+	}
+	return "", nil
+}
+
+func isPoolBackend(url string) bool {
+	for _, u := range live().WhisperBackends {
+		if u == url {
+			return true
+		}
+	}
+	return false
+}
+
+// GET /models lista los modelos propios del tenant
+func listModelsHandler(c *gin.Context) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"models": customModels.list(currentTenant(c)), "builtin": whisperModels})
+}
+
+// PUT /models/:name registra o reemplaza un modelo propio
+func putModelHandler(c *gin.Context) {
+	name := c.Param("name")
+	if !modelNamePattern.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "model name must be 1-64 lowercase letters, digits, '.', '_' or '-'"})
+		return
+	}
+	if isBuiltinModel(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "model name is reserved for a whisper model"})
+		return
+	}
+	var input CustomModelBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	backend := strings.TrimRight(input.Backend, "/")
+	if !isPoolBackend(backend) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "backend must be one of the configured whisper backends", "code": "INVALID_REQUEST"})
+		return
+	}
+	m := CustomModel{
+		Name:         name,
+		Backend:      backend,
+		BackendModel: input.BackendModel,
+		Language:     strings.ToLower(input.Language),
+		Description:  input.Description,
+		UpdatedAt:    time.Now(),
+	}
+	if err := customModels.put(currentTenant(c), m); errors.Is(err, errTooManyModels) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, m)
+}
+
+// DELETE /models/:name
+func deleteModelHandler(c *gin.Context) {
+	found, err := customModels.remove(currentTenant(c), c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "model not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Margen para la diferencia de reloj con el proveedor
+const oidcClockSkew = time.Minute
+
+// Como mucho una recarga de las claves por minuto ante un kid desconocido
+const jwksRefreshInterval = time.Minute
+
+// Documento de descubrimiento del proveedor (Google, Keycloak...)
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Proveedor OIDC_ISSUER: descubrimiento y claves de firma, en caché
+type oidcProvider struct {
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]crypto.PublicKey // por kid
+	fetchedAt time.Time
+}
+
+var oidcIssuer = &oidcProvider{}
+
+// Fallos al hablar con el proveedor, distintos de un token no válido
+var errOIDCUnavailable = errors.New("identity provider is unavailable")
+
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+func oidcEnabled() bool {
+	return cfg.OIDCIssuer != ""
+}
+
+// "aud" puede ser un texto o una lista
+type oidcAudience []string
+
+func (a *oidcAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = oidcAudience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("aud must be a string or a list of strings")
+	}
+	*a = list
+	return nil
+}
+
+func (a oidcAudience) contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// Claims del ID token que usa el gateway
+type oidcClaims struct {
+	Issuer            string       `json:"iss"`
+	Subject           string       `json:"sub"`
+	Audience          oidcAudience `json:"aud"`
+	Expiry            int64        `json:"exp"`
+	NotBefore         int64        `json:"nbf"`
+	Nonce             string       `json:"nonce"`
+	Email             string       `json:"email"`
+	PreferredUsername string       `json:"preferred_username"`
+	Groups            []string     `json:"-"` // claim OIDC_GROUPS_CLAIM
+}
+
+// Nombre visible del usuario: email, usuario o sub
+func (c *oidcClaims) user() string {
+	switch {
+	case c.Email != "":
+		return c.Email
+	case c.PreferredUsername != "":
+		return c.PreferredUsername
+	}
+	return c.Subject
+}
+
+func getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(out), "invalid JSON from %s", url)
+}
+
+func (p *oidcProvider) config(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.configLocked(ctx)
+}
+
+func (p *oidcProvider) configLocked(ctx context.Context) (*oidcDiscovery, error) {
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	issuer := strings.TrimRight(cfg.OIDCIssuer, "/")
+	var d oidcDiscovery
+	if err := getJSON(ctx, issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, errors.Wrap(errOIDCUnavailable, "OIDC discovery failed: "+err.Error())
+	}
+	if strings.TrimRight(d.Issuer, "/") != issuer {
+		return nil, errors.Errorf("OIDC discovery issuer %q does not match %q", d.Issuer, cfg.OIDCIssuer)
+	}
+	if d.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery has no jwks_uri")
+	}
+	p.discovery = &d
+	return &d, nil
+}
+
+// Clave de firma por kid; recarga el JWKS si no la conoce (rotación)
+func (p *oidcProvider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	if p.keys != nil && time.Since(p.fetchedAt) < jwksRefreshInterval {
+		return nil, errors.Errorf("unknown signing key %q", kid)
+	}
+	d, err := p.configLocked(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, errors.Wrap(errOIDCUnavailable, "failed to fetch OIDC signing keys: "+err.Error())
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if k, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = k
+		}
+	}
+	p.keys, p.fetchedAt = keys, time.Now()
+	if k, ok := keys[kid]; ok {
+		return k, nil
+	}
+	return nil, errors.Errorf("unknown signing key %q", kid)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, errors.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, errors.Errorf("unsupported key type %q", k.Kty)
+}
+
+// Comprueba la firma de un JWT con la clave del algoritmo de su cabecera
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return errors.Errorf("unsupported signing algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			break
+		}
+		return errors.Wrap(rsa.VerifyPKCS1v15(k, hash, digest, sig), "invalid token signature")
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(sig) != 2*size {
+			break
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	}
+	return errors.Errorf("signing key does not match algorithm %q", alg)
+}
+
+// Valida un ID token del proveedor: firma, emisor, audiencia y vigencia. Con
+// nonce no vacío también debe coincidir (flujo de GET /auth/callback).
+func verifyIDToken(ctx context.Context, token, nonce string) (*oidcClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(rawHeader, &header) != nil {
+		return nil, errors.New("malformed ID token header")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed ID token signature")
+	}
+	key, err := oidcIssuer.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed ID token payload")
+	}
+	var claims oidcClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.Wrap(err, "malformed ID token claims")
+	}
+	now := time.Now()
+	switch {
+	case strings.TrimRight(claims.Issuer, "/") != strings.TrimRight(cfg.OIDCIssuer, "/"):
+		return nil, errors.New("ID token issuer does not match")
+	case !claims.Audience.contains(cfg.OIDCClientID):
+		return nil, errors.New("ID token audience does not match")
+	case claims.Subject == "":
+		return nil, errors.New("ID token has no subject")
+	case now.After(time.Unix(claims.Expiry, 0).Add(oidcClockSkew)):
+		return nil, errors.New("ID token expired")
+	case claims.NotBefore != 0 && now.Add(oidcClockSkew).Before(time.Unix(claims.NotBefore, 0)):
+		return nil, errors.New("ID token is not valid yet")
+	case nonce != "" && claims.Nonce != nonce:
+		return nil, errors.New("ID token nonce does not match")
+	}
+
+	// El claim de grupos es configurable (Keycloak: groups; Azure: roles...)
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &raw); err == nil {
+		if value, ok := raw[cfg.OIDCGroupsClaim]; ok {
+			var groups []string
+			if json.Unmarshal(value, &groups) != nil {
+				var single string
+				if json.Unmarshal(value, &single) == nil {
+					groups = []string{single}
+				}
+			}
+			claims.Groups = groups
+		}
+	}
+	return &claims, nil
+}
+
+// Rol de mayor nivel entre los grupos del usuario, o OIDC_DEFAULT_ROLE
+func roleForGroups(groups []string) string {
+	role := ""
+	for _, g := range groups {
+		if r, ok := cfg.OIDCGroupRoles[g]; ok && accessLevels[r] > accessLevels[role] {
+			role = r
+		}
+	}
+	if role == "" {
+		role = cfg.OIDCDefaultRole
+	}
+	return role
+}
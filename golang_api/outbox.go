@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Tipos de mensaje del outbox
+const (
+	OutboxWebhook     = "webhook"
+	OutboxBus         = "bus"
+	OutboxIntegration = "integration" // exportación a Google Docs, Notion o un almacén
+	OutboxWriteBack   = "writeback"   // resultado junto al medio de origen
+)
+
+// Mensaje pendiente de entrega. Se escribe junto con el job, en la misma
+// escritura que el evento que lo origina, así que un reinicio no lo pierde;
+// se borra solo cuando la entrega se confirma o se agota.
+type OutboxMessage struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	Target      string          `json:"target"` // id del webhook o de la integración, subject del bus o bucket de origen
+	Event       string          `json:"event"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// Mensajes pendientes por job, en orden de creación; protegido por mu
+var jobOutbox = make(map[string][]OutboxMessage)
+
+// Avisa al dispatcher de que hay mensajes nuevos
+var outboxWake = make(chan struct{}, 1)
+
+// El destino ya no existe o está deshabilitado: el mensaje se descarta
+var errOutboxDiscard = errors.New("outbox target unavailable")
+
+// Requiere mu tomado; el mensaje se persiste en la siguiente escritura del job
+func enqueueOutboxLocked(jobID string, msg OutboxMessage) {
+	if msg.ID == "" {
+		msg.ID = uuid.NewString()
+	}
+	msg.CreatedAt = time.Now()
+	msg.NextAttempt = msg.CreatedAt
+	jobOutbox[jobID] = append(jobOutbox[jobID], msg)
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+type outboxItem struct {
+	jobID string
+	msg   OutboxMessage
+}
+
+// Entrega los mensajes pendientes fuera del lock de jobs
+func runOutboxDispatcher() {
+	ticker := time.NewTicker(cfg.OutboxPollInterval.Duration)
+	defer ticker.Stop()
+	for {
+		// Tras una entrega puede haber otro mensaje del mismo destino listo
+		for dispatchOutbox() > 0 {
+		}
+		select {
+		case <-outboxWake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Devuelve cuántos mensajes salieron del outbox
+func dispatchOutbox() int {
+	due := dueOutbox(time.Now())
+	sem := make(chan struct{}, cfg.OutboxWorkers)
+	var wg sync.WaitGroup
+	var settled int32
+	for _, item := range due {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(item outboxItem) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result, err := deliverOutbox(item)
+			if settleOutbox(item, result, err) {
+				atomic.AddInt32(&settled, 1)
+			}
+		}(item)
+	}
+	wg.Wait()
+	return int(settled)
+}
+
+// Primer mensaje pendiente de cada destino por job, si ya toca reintentarlo.
+// Un destino no recibe un evento hasta que se entregó el anterior; en el bus
+// todos los subjects de un job cuentan como un destino para no desordenar
+// las transiciones.
+func dueOutbox(now time.Time) []outboxItem {
+	mu.RLock()
+	defer mu.RUnlock()
+	var due []outboxItem
+	for jobID, msgs := range jobOutbox {
+		if unadoptedJobs[jobID] {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, msg := range msgs {
+			target := msg.Kind
+			if msg.Kind != OutboxBus {
+				target += ":" + msg.Target
+			}
+			if seen[target] {
+				continue
+			}
+			seen[target] = true
+			if !msg.NextAttempt.After(now) {
+				due = append(due, outboxItem{jobID: jobID, msg: msg})
+			}
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].msg.CreatedAt.Before(due[j].msg.CreatedAt) })
+	return due
+}
+
+func deliverOutbox(item outboxItem) (string, error) {
+	switch item.msg.Kind {
+	case OutboxWebhook:
+		return deliverWebhook(item.msg)
+	case OutboxBus:
+		return "", publishBusMessage(item.jobID, item.msg)
+	case OutboxIntegration:
+		return deliverIntegration(item.msg)
+	case OutboxWriteBack:
+		return deliverWriteBack(item.jobID, item.msg)
+	}
+	return "", errOutboxDiscard
+}
+
+// Borra el mensaje entregado o agotado, o programa el siguiente intento.
+// Indica si el mensaje salió del outbox.
+func settleOutbox(item outboxItem, result string, err error) bool {
+	mu.Lock()
+	defer unlockJobs()
+	msgs := jobOutbox[item.jobID]
+	i := 0
+	for i < len(msgs) && msgs[i].ID != item.msg.ID {
+		i++
+	}
+	if i == len(msgs) {
+		return false
+	}
+
+	msg := &msgs[i]
+	if err != nil && err != errOutboxDiscard {
+		msg.Attempts++
+		msg.LastError = err.Error()
+		log.Printf("⚠️ Entrega %d de %s (%s) fallida: %v", msg.Attempts, msg.Event, msg.Kind, err)
+		if msg.Kind == OutboxBus || msg.Attempts < cfg.WebhookMaxAttempts {
+			msg.NextAttempt = time.Now().Add(outboxBackoff(msg.Kind, msg.Attempts))
+			if msg.Kind == OutboxIntegration {
+				setDeliveryLocked(item.jobID, msg.Target, DeliveryPending, msg.Attempts, msg.LastError)
+			}
+			persistJobLocked(item.jobID)
+			return false
+		}
+	}
+
+	removed := *msg
+	msgs = append(msgs[:i], msgs[i+1:]...)
+	if len(msgs) == 0 {
+		delete(jobOutbox, item.jobID)
+	} else {
+		jobOutbox[item.jobID] = msgs
+	}
+	eventType, failedCode := EventWebhook, "WEBHOOK_FAILED"
+	switch removed.Kind {
+	case OutboxIntegration:
+		eventType, failedCode = EventIntegration, "INTEGRATION_FAILED"
+	case OutboxWriteBack:
+		eventType, failedCode = EventWriteBack, "WRITEBACK_FAILED"
+	}
+	if removed.Kind == OutboxIntegration {
+		switch {
+		case err == errOutboxDiscard:
+			setDeliveryLocked(item.jobID, removed.Target, DeliveryCanceled, removed.Attempts, "integration or job no longer available")
+		case err == nil:
+			setDeliveryLocked(item.jobID, removed.Target, DeliveryDelivered, removed.Attempts+1, result)
+		default:
+			setDeliveryLocked(item.jobID, removed.Target, DeliveryFailed, removed.Attempts, removed.LastError)
+		}
+	}
+	switch {
+	case removed.Kind == OutboxBus || err == errOutboxDiscard:
+		persistJobLocked(item.jobID)
+	case err == nil:
+		appendEventLocked(item.jobID, JobEvent{Type: eventType, Message: result})
+	default:
+		appendEventLocked(item.jobID, JobEvent{
+			Type:    eventType,
+			Code:    failedCode,
+			Message: fmt.Sprintf("failed after %d attempts: %s", removed.Attempts, removed.LastError),
+		})
+	}
+	evictReleasedJobLocked(item.jobID)
+	return true
+}
+
+// Espera exponencial desde la base del tipo de mensaje, con tope
+func outboxBackoff(kind string, attempts int) time.Duration {
+	base := cfg.OutboxPollInterval.Duration
+	if kind != OutboxBus {
+		base = cfg.WebhookRetryBackoff.Duration
+	}
+	d := base
+	for i := 1; i < attempts && d < cfg.OutboxMaxBackoff.Duration; i++ {
+		d *= 2
+	}
+	if d > cfg.OutboxMaxBackoff.Duration {
+		d = cfg.OutboxMaxBackoff.Duration
+	}
+	return d
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Escritor Parquet mínimo para tablas planas: un row group, una página
+// PLAIN sin comprimir por columna y los metadatos en thrift compact. Basta
+// para las exportaciones de analítica, que cualquier lector (Spark, DuckDB,
+// BigQuery, pyarrow) carga; no hay columnas anidadas ni diccionarios.
+
+// Tipos físicos de Parquet
+const (
+	parquetBoolean   int32 = 0
+	parquetInt64     int32 = 2
+	parquetDouble    int32 = 5
+	parquetByteArray int32 = 6
+)
+
+// Tipos convertidos (lógicos) de Parquet; -1 = ninguno
+const (
+	parquetNoConversion   int32 = -1
+	parquetUTF8           int32 = 0
+	parquetTimestampMilli int32 = 9
+	parquetJSON           int32 = 19
+)
+
+type parquetColumn struct {
+	name      string
+	kind      int32
+	converted int32
+	optional  bool // admite nil
+}
+
+// Valores admitidos: string, int64, float64, bool, time.Time y nil en las
+// columnas opcionales
+func writeParquet(w io.Writer, columns []parquetColumn, rows [][]interface{}) error {
+	out := &countingWriter{w: w}
+	if _, err := out.Write([]byte("PAR1")); err != nil {
+		return err
+	}
+	var chunks []thriftStruct
+	var totalSize int64
+	for i, col := range columns {
+		page, err := parquetPage(col, i, rows)
+		if err != nil {
+			return err
+		}
+		offset := out.n
+		header := thriftStruct{
+			{1, int32(0)}, // DATA_PAGE
+			{2, int32(len(page))},
+			{3, int32(len(page))},
+			{5, thriftStruct{
+				{1, int32(len(rows))},
+				{2, int32(0)}, // PLAIN
+				{3, int32(3)}, // RLE
+				{4, int32(3)},
+			}},
+		}
+		var buf bytes.Buffer
+		header.encode(&buf)
+		size := int64(buf.Len() + len(page))
+		buf.Write(page)
+		if _, err := out.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		totalSize += size
+		chunks = append(chunks, thriftStruct{
+			{2, offset},
+			{3, thriftStruct{
+				{1, col.kind},
+				{2, []int32{0, 3}}, // PLAIN, RLE
+				{3, []string{col.name}},
+				{4, int32(0)}, // UNCOMPRESSED
+				{5, int64(len(rows))},
+				{6, size},
+				{7, size},
+				{9, offset},
+			}},
+		})
+	}
+
+	schema := []thriftStruct{{{4, "schema"}, {5, int32(len(columns))}}}
+	for _, col := range columns {
+		repetition := int32(0) // REQUIRED
+		if col.optional {
+			repetition = 1 // OPTIONAL
+		}
+		element := thriftStruct{{1, col.kind}, {3, repetition}, {4, col.name}}
+		if col.converted != parquetNoConversion {
+			element = append(element, thriftField{6, col.converted})
+		}
+		schema = append(schema, element)
+	}
+	var rowGroups []thriftStruct
+	if len(rows) > 0 {
+		rowGroups = append(rowGroups, thriftStruct{{1, chunks}, {2, totalSize}, {3, int64(len(rows))}})
+	}
+	meta := thriftStruct{
+		{1, int32(1)},
+		{2, schema},
+		{3, int64(len(rows))},
+		{4, rowGroups},
+		{6, "transcribe_whisper"},
+	}
+	var footer bytes.Buffer
+	meta.encode(&footer)
+	_ = binary.Write(&footer, binary.LittleEndian, uint32(footer.Len()))
+	footer.WriteString("PAR1")
+	_, err := out.Write(footer.Bytes())
+	return err
+}
+
+// Niveles de definición (si la columna es opcional) seguidos de los valores
+// no nulos en PLAIN
+func parquetPage(col parquetColumn, index int, rows [][]interface{}) ([]byte, error) {
+	var page, values bytes.Buffer
+	defined := make([]bool, len(rows))
+	var bits []bool
+	for r, row := range rows {
+		v := row[index]
+		if v == nil {
+			if !col.optional {
+				return nil, errors.Errorf("parquet column %s: null in required column", col.name)
+			}
+			continue
+		}
+		defined[r] = true
+		switch v := v.(type) {
+		case string:
+			_ = binary.Write(&values, binary.LittleEndian, uint32(len(v)))
+			values.WriteString(v)
+		case int64:
+			_ = binary.Write(&values, binary.LittleEndian, v)
+		case time.Time:
+			_ = binary.Write(&values, binary.LittleEndian, v.UnixMilli())
+		case float64:
+			_ = binary.Write(&values, binary.LittleEndian, math.Float64bits(v))
+		case bool:
+			bits = append(bits, v)
+		default:
+			return nil, errors.Errorf("parquet column %s: unsupported value %T", col.name, v)
+		}
+	}
+	if col.optional {
+		levels := bitPack(defined)
+		// Un único run bit-packed de ancho 1: cabecera (grupos de 8 << 1) | 1
+		var run bytes.Buffer
+		run.Write(binary.AppendUvarint(nil, uint64(len(levels))<<1|1))
+		run.Write(levels)
+		_ = binary.Write(&page, binary.LittleEndian, uint32(run.Len()))
+		page.Write(run.Bytes())
+	}
+	if col.kind == parquetBoolean {
+		values.Write(bitPack(bits))
+	}
+	page.Write(values.Bytes())
+	return page.Bytes(), nil
+}
+
+// Bits en bytes, el menos significativo primero
+func bitPack(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Thrift compact, solo lo que usan los metadatos de Parquet
+type thriftField struct {
+	id    int16
+	value interface{} // int32, int64, string, thriftStruct o listas de ellos
+}
+
+type thriftStruct []thriftField
+
+// Tipos del protocolo compact
+const (
+	thriftTypeI32    = 5
+	thriftTypeI64    = 6
+	thriftTypeBinary = 8
+	thriftTypeList   = 9
+	thriftTypeStruct = 12
+)
+
+func (s thriftStruct) encode(buf *bytes.Buffer) {
+	var last int16
+	for _, f := range s {
+		kind := thriftType(f.value)
+		if delta := f.id - last; delta > 0 && delta <= 15 {
+			buf.WriteByte(byte(delta)<<4 | kind)
+		} else {
+			buf.WriteByte(kind)
+			buf.Write(binary.AppendVarint(nil, int64(f.id)))
+		}
+		last = f.id
+		thriftValue(buf, f.value)
+	}
+	buf.WriteByte(0) // STOP
+}
+
+func thriftType(v interface{}) byte {
+	switch v.(type) {
+	case int32:
+		return thriftTypeI32
+	case int64:
+		return thriftTypeI64
+	case string:
+		return thriftTypeBinary
+	case thriftStruct:
+		return thriftTypeStruct
+	}
+	return thriftTypeList
+}
+
+func thriftValue(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case int32:
+		buf.Write(binary.AppendVarint(nil, int64(v)))
+	case int64:
+		buf.Write(binary.AppendVarint(nil, v))
+	case string:
+		buf.Write(binary.AppendUvarint(nil, uint64(len(v))))
+		buf.WriteString(v)
+	case thriftStruct:
+		v.encode(buf)
+	case []int32:
+		thriftListHeader(buf, len(v), thriftTypeI32)
+		for _, item := range v {
+			thriftValue(buf, item)
+		}
+	case []string:
+		thriftListHeader(buf, len(v), thriftTypeBinary)
+		for _, item := range v {
+			thriftValue(buf, item)
+		}
+	case []thriftStruct:
+		thriftListHeader(buf, len(v), thriftTypeStruct)
+		for _, item := range v {
+			item.encode(buf)
+		}
+	}
+}
+
+func thriftListHeader(buf *bytes.Buffer, size int, kind byte) {
+	if size < 15 {
+		buf.WriteByte(byte(size)<<4 | kind)
+		return
+	}
+	buf.WriteByte(0xF0 | kind)
+	buf.Write(binary.AppendUvarint(nil, uint64(size)))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Respuesta en streaming de POST {backend}/transcribe: una línea
+// {"segment": {...}} por segmento según se transcribe y, al final, la
+// respuesta completa de siempre. Un error a mitad llega como {"error": "..."}.
+// Los backends que no lo soportan responden JSON y el job no tiene parciales.
+const ndjsonContentType = "application/x-ndjson"
+
+// Línea más larga aceptada en el streaming (la respuesta final incluida)
+const maxStreamLine = 16 << 20
+
+// Transcripción provisional de un job mientras el backend trabaja
+type partialTranscript struct {
+	jobID    string
+	offset   float64   // inicio del fragmento en el audio (jobs troceados)
+	segments []Segment // fragmentos ya terminados, ya desplazados
+	text     string
+}
+
+// Vuelve a lo ya terminado al empezar cada llamada al backend: un reintento
+// en otro backend manda otra vez todos los segmentos
+func (p *partialTranscript) begin() {
+	if p == nil {
+		return
+	}
+	updateJob(p.jobID, func(job *JobState) {
+		job.Segments = append([]Segment(nil), p.segments...)
+		job.Transcription = p.text
+		job.Partial = len(p.segments) > 0
+	})
+}
+
+func (p *partialTranscript) add(seg Segment) {
+	if p == nil {
+		return
+	}
+	normalizeStrings(reflect.ValueOf(&seg))
+	if seg.End < seg.Start {
+		seg.End = seg.Start
+	}
+	seg = shiftSegment(seg, p.offset)
+	updateJob(p.jobID, func(job *JobState) {
+		seg.ID = len(job.Segments)
+		job.Segments = append(job.Segments, seg)
+		if t := strings.TrimSpace(seg.Text); t != "" {
+			job.Transcription = strings.TrimSpace(job.Transcription + " " + t)
+		}
+		job.Partial = true
+	})
+}
+
+func isNDJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == ndjsonContentType
+}
+
+// Lee el streaming publicando cada segmento como parcial. Devuelve la última
+// línea, la respuesta completa, que se valida como el cuerpo JSON.
+func readBackendStream(baseURL string, body io.Reader, partials *partialTranscript) ([]byte, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLine)
+	var final []byte
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if !utf8.Valid(line) {
+			return nil, &backendError{code: "INVALID_BACKEND_RESPONSE", message: errors.Wrap(errInvalidUTF8, "invalid backend response encoding").Error()}
+		}
+		var probe struct {
+			Segment json.RawMessage `json:"segment"`
+			Error   string          `json:"error"`
+		}
+		if err := json.Unmarshal(line, &probe); err != nil {
+			return nil, &backendError{code: "INVALID_BACKEND_RESPONSE", message: errors.Wrap(err, "failed to parse stream line").Error(), retryable: true}
+		}
+		switch {
+		case probe.Error != "":
+			return nil, &backendError{code: "BACKEND_ERROR", message: probe.Error, retryable: true}
+		case probe.Segment != nil:
+			// Un parcial fuera de contrato no se publica; la respuesta final
+			// decide si el job falla
+			seg, violations, err := decodeBackendSegment(probe.Segment)
+			if err != nil {
+				log.Printf("⚠️ Segmento parcial del backend %s descartado: %v", baseURL, err)
+				continue
+			}
+			if len(violations) > 0 {
+				log.Printf("⚠️ Segmento parcial del backend %s descartado: %s", baseURL, backendContractMessage(violations))
+				continue
+			}
+			partials.add(seg)
+		default:
+			// El scanner reutiliza su buffer
+			final = append(final[:0], line...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, &backendError{code: "BACKEND_UNAVAILABLE", message: errors.Wrap(err, "failed to read response stream").Error(), retryable: true}
+	}
+	if final == nil {
+		return nil, &backendError{code: "INVALID_BACKEND_RESPONSE", message: "backend stream ended without a final response", retryable: true}
+	}
+	return final, nil
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Otro proceso guardó el job después de nuestra última lectura
+var errVersionConflict = errors.New("job was modified concurrently")
+
+// StateStore sobre Postgres. Cada job lleva una versión: una escritura solo
+// se aplica si la versión en la base es la última que vio este proceso.
+type pgStateStore struct {
+	pool *pgxpool.Pool
+
+	mu       sync.Mutex
+	versions map[string]int64
+}
+
+func newPgStateStore(databaseURL string) (*pgStateStore, error) {
+	if cfg.DatabaseMigrate {
+		if err := migrateDatabase(databaseURL); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DatabaseTimeout.Duration)
+	defer cancel()
+	pool, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to Postgres")
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, errors.Wrap(err, "failed to connect to Postgres")
+	}
+	return &pgStateStore{pool: pool, versions: make(map[string]int64)}, nil
+}
+
+// Aplica las migraciones embebidas pendientes
+func migrateDatabase(databaseURL string) error {
+	src, err := iofs.New(migrationFiles, "migrations")
+	if err != nil {
+		return errors.Wrap(err, "failed to load migrations")
+	}
+	// El driver pgx/v5 de golang-migrate se registra con el esquema pgx5
+	dsn := databaseURL
+	for _, prefix := range []string{"postgres://", "postgresql://"} {
+		if strings.HasPrefix(dsn, prefix) {
+			dsn = "pgx5://" + strings.TrimPrefix(dsn, prefix)
+		}
+	}
+	m, err := migrate.NewWithSourceInstance("iofs", src, dsn)
+	if err != nil {
+		return errors.Wrap(err, "failed to initialize migrations")
+	}
+	defer m.Close()
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return errors.Wrap(err, "failed to apply migrations")
+	}
+	return nil
+}
+
+func (s *pgStateStore) ctx() (context.Context, context.CancelFunc) {
+	return s.ctxFrom(context.Background())
+}
+
+// DATABASE_TIMEOUT, o antes si vence parent (el plazo de la petición)
+func (s *pgStateStore) ctxFrom(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, cfg.DatabaseTimeout.Duration)
+}
+
+// Guarda el job, su historial y su outbox en una transacción
+func (s *pgStateStore) SaveJob(rec JobRecord) error {
+	job, err := json.Marshal(rec.Job)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal job state")
+	}
+	meta, err := json.Marshal(rec.Meta)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal job state")
+	}
+	events, err := json.Marshal(rec.Events)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal job state")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.ctx()
+	defer cancel()
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+
+	expected := s.versions[rec.ID]
+	var version int64
+	if expected == 0 {
+		err = tx.QueryRow(ctx, `
+			INSERT INTO jobs (id, type, status, api_key, tenant, created_at, updated_at, job, meta, events)
+			VALUES ($1, $2, $3, $4, $5, $6, now(), $7, $8, $9)
+			ON CONFLICT (id) DO NOTHING
+			RETURNING version`,
+			rec.ID, rec.Job.Type, rec.Job.Status, rec.Job.APIKey, rec.Meta.Tenant, rec.Job.Timestamp, job, meta, events,
+		).Scan(&version)
+	} else {
+		err = tx.QueryRow(ctx, `
+			UPDATE jobs
+			SET status = $3, updated_at = now(), job = $4, meta = $5, events = $6, version = version + 1
+			WHERE id = $1 AND version = $2
+			RETURNING version`,
+			rec.ID, expected, rec.Job.Status, job, meta, events,
+		).Scan(&version)
+	}
+	if err == pgx.ErrNoRows {
+		return errors.Wrapf(errVersionConflict, "job %s (version %d)", rec.ID, expected)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to write job state")
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM outbox WHERE job_id = $1`, rec.ID); err != nil {
+		return errors.Wrap(err, "failed to write outbox")
+	}
+	for _, msg := range rec.Outbox {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal outbox message")
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO outbox (id, job_id, message, created_at) VALUES ($1, $2, $3, $4)`,
+			msg.ID, rec.ID, data, msg.CreatedAt); err != nil {
+			return errors.Wrap(err, "failed to write outbox")
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errors.Wrap(err, "failed to commit job state")
+	}
+	s.versions[rec.ID] = version
+	return nil
+}
+
+func (s *pgStateStore) LoadJobs(parent context.Context) ([]JobRecord, error) {
+	ctx, cancel := s.ctxFrom(parent)
+	defer cancel()
+	rows, err := s.pool.Query(ctx, `SELECT `+jobColumns+` FROM jobs ORDER BY created_at`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read jobs")
+	}
+	defer rows.Close()
+
+	var records []JobRecord
+	index := make(map[string]int)
+	versions := make(map[string]int64)
+	for rows.Next() {
+		rec, version, err := scanJobRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[rec.ID] = len(records)
+		versions[rec.ID] = version
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read jobs")
+	}
+
+	outbox, err := s.pool.Query(ctx, `SELECT job_id, message FROM outbox ORDER BY created_at`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read outbox")
+	}
+	defer outbox.Close()
+	for outbox.Next() {
+		var jobID string
+		var data []byte
+		if err := outbox.Scan(&jobID, &data); err != nil {
+			return nil, errors.Wrap(err, "failed to read outbox")
+		}
+		var msg OutboxMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, errors.Wrapf(err, "corrupt outbox message for job %s", jobID)
+		}
+		if i, ok := index[jobID]; ok {
+			records[i].Outbox = append(records[i].Outbox, msg)
+		}
+	}
+	if err := outbox.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read outbox")
+	}
+
+	s.mu.Lock()
+	for id, v := range versions {
+		s.versions[id] = v
+	}
+	s.mu.Unlock()
+	return records, nil
+}
+
+// Columnas que lee scanJobRecord
+const jobColumns = `jobs.id, jobs.version, jobs.job, jobs.meta, jobs.events, jobs.claimed_by, jobs.lease_expires_at`
+
+// Fila con jobColumns seguida de las columnas de extra
+func scanJobRecord(row pgx.Row, extra ...interface{}) (JobRecord, int64, error) {
+	var rec JobRecord
+	var version int64
+	var job, meta, events []byte
+	var claimedBy *string
+	var leaseExpiresAt *time.Time
+	dest := append([]interface{}{&rec.ID, &version, &job, &meta, &events, &claimedBy, &leaseExpiresAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return rec, 0, err
+	}
+	if claimedBy != nil && leaseExpiresAt != nil {
+		rec.Claim = &JobClaim{WorkerID: *claimedBy, LeaseExpiresAt: *leaseExpiresAt}
+	}
+	if err := json.Unmarshal(job, &rec.Job); err != nil {
+		return rec, 0, errors.Wrapf(err, "corrupt state for job %s", rec.ID)
+	}
+	if err := json.Unmarshal(meta, &rec.Meta); err != nil {
+		return rec, 0, errors.Wrapf(err, "corrupt state for job %s", rec.ID)
+	}
+	if err := json.Unmarshal(events, &rec.Events); err != nil {
+		return rec, 0, errors.Wrapf(err, "corrupt state for job %s", rec.ID)
+	}
+	return rec, version, nil
+}
+
+// Completa el registro con su outbox y recuerda la versión leída
+func (s *pgStateStore) finishRecord(ctx context.Context, rec *JobRecord, version int64) error {
+	rows, err := s.pool.Query(ctx, `SELECT message FROM outbox WHERE job_id = $1 ORDER BY created_at`, rec.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to read outbox")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return errors.Wrap(err, "failed to read outbox")
+		}
+		var msg OutboxMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return errors.Wrapf(err, "corrupt outbox message for job %s", rec.ID)
+		}
+		rec.Outbox = append(rec.Outbox, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "failed to read outbox")
+	}
+	s.mu.Lock()
+	s.versions[rec.ID] = version
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *pgStateStore) LoadJob(parent context.Context, jobID string) (*JobRecord, error) {
+	ctx, cancel := s.ctxFrom(parent)
+	defer cancel()
+	rec, version, err := scanJobRecord(s.pool.QueryRow(ctx,
+		`SELECT `+jobColumns+` FROM jobs WHERE id = $1`, jobID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read job")
+	}
+	if err := s.finishRecord(ctx, &rec, version); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// SKIP LOCKED: dos workers que reclaman a la vez nunca toman el mismo job.
+// El orden es el de agedPriority: prioridad más un punto por cada
+// PRIORITY_AGING_INTERVAL desde created_at y, a igualdad, el más antiguo.
+func (s *pgStateStore) ClaimJob(workerID string, lease time.Duration) (*JobRecord, *JobClaim, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+	var prevWorker *string
+	var prevExpiry *time.Time
+	rec, version, err := scanJobRecord(s.pool.QueryRow(ctx, `
+		WITH candidate AS (
+			SELECT id, claimed_by, lease_expires_at FROM jobs
+			WHERE status NOT IN ('completed', 'failed', 'skipped')
+				AND (claimed_by IS NULL OR lease_expires_at < now())
+			ORDER BY COALESCE((job->>'priority')::int, 0) + CASE WHEN $3::float8 > 0
+					THEN floor(extract(epoch FROM now() - created_at) / $3::float8)::int
+					ELSE 0 END DESC,
+				created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE jobs
+		SET claimed_by = $1, lease_expires_at = now() + make_interval(secs => $2)
+		FROM candidate
+		WHERE jobs.id = candidate.id
+		RETURNING `+jobColumns+`, candidate.claimed_by, candidate.lease_expires_at`,
+		workerID, lease.Seconds(), live().PriorityAgingInterval.Duration.Seconds()), &prevWorker, &prevExpiry)
+	if err == pgx.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to claim job")
+	}
+	if err := s.finishRecord(ctx, &rec, version); err != nil {
+		return nil, nil, err
+	}
+	var expired *JobClaim
+	if prevWorker != nil && prevExpiry != nil {
+		expired = &JobClaim{WorkerID: *prevWorker, LeaseExpiresAt: *prevExpiry}
+	}
+	return &rec, expired, nil
+}
+
+func (s *pgStateStore) RenewClaim(jobID, workerID string, lease time.Duration) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE jobs SET lease_expires_at = now() + make_interval(secs => $3)
+		WHERE id = $1 AND claimed_by = $2`,
+		jobID, workerID, lease.Seconds())
+	if err != nil {
+		return errors.Wrap(err, "failed to renew job claim")
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.Wrapf(errClaimLost, "job %s", jobID)
+	}
+	return nil
+}
+
+func (s *pgStateStore) ReleaseClaim(jobID, workerID string) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+	_, err := s.pool.Exec(ctx, `
+		UPDATE jobs SET claimed_by = NULL, lease_expires_at = NULL
+		WHERE id = $1 AND claimed_by = $2`,
+		jobID, workerID)
+	return errors.Wrap(err, "failed to release job claim")
+}
+
+func (s *pgStateStore) SaveChunk(jobID string, index int, result BackendResponse) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal chunk result")
+	}
+	ctx, cancel := s.ctx()
+	defer cancel()
+	_, err = s.pool.Exec(ctx, `
+		INSERT INTO job_chunks (job_id, chunk_index, result) VALUES ($1, $2, $3)
+		ON CONFLICT (job_id, chunk_index) DO UPDATE SET result = EXCLUDED.result`,
+		jobID, index, data)
+	return errors.Wrap(err, "failed to write chunk result")
+}
+
+func (s *pgStateStore) LoadChunks(jobID string) (map[int]BackendResponse, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+	rows, err := s.pool.Query(ctx, `SELECT chunk_index, result FROM job_chunks WHERE job_id = $1`, jobID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read chunk results")
+	}
+	defer rows.Close()
+	chunks := make(map[int]BackendResponse)
+	for rows.Next() {
+		var index int
+		var data []byte
+		if err := rows.Scan(&index, &data); err != nil {
+			return nil, errors.Wrap(err, "failed to read chunk results")
+		}
+		var result BackendResponse
+		if err := json.Unmarshal(data, &result); err != nil {
+			// Se vuelve a transcribir
+			continue
+		}
+		chunks[index] = result
+	}
+	return chunks, errors.Wrap(rows.Err(), "failed to read chunk results")
+}
+
+func (s *pgStateStore) DeleteChunks(jobID string) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+	_, err := s.pool.Exec(ctx, `DELETE FROM job_chunks WHERE job_id = $1`, jobID)
+	return errors.Wrap(err, "failed to delete chunk results")
+}
+
+// El outbox y los fragmentos se borran en cascada
+func (s *pgStateStore) DeleteJob(jobID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, cancel := s.ctx()
+	defer cancel()
+	if _, err := s.pool.Exec(ctx, `DELETE FROM jobs WHERE id = $1`, jobID); err != nil {
+		return errors.Wrap(err, "failed to delete job state")
+	}
+	delete(s.versions, jobID)
+	return nil
+}
+
+// Reemplaza la tabla entera: los webhooks se guardan siempre en bloque
+func (s *pgStateStore) SaveWebhooks(hooks []WebhookRecord) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `DELETE FROM webhooks`); err != nil {
+		return errors.Wrap(err, "failed to write webhooks")
+	}
+	for _, hook := range hooks {
+		data, err := json.Marshal(hook)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal webhooks")
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO webhooks (id, tenant, record, created_at) VALUES ($1, $2, $3, $4)`,
+			hook.ID, hook.Tenant, data, hook.CreatedAt); err != nil {
+			return errors.Wrap(err, "failed to write webhooks")
+		}
+	}
+	return errors.Wrap(tx.Commit(ctx), "failed to write webhooks")
+}
+
+func (s *pgStateStore) LoadWebhooks() ([]WebhookRecord, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+	rows, err := s.pool.Query(ctx, `SELECT record FROM webhooks ORDER BY created_at`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read webhooks")
+	}
+	defer rows.Close()
+	var hooks []WebhookRecord
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, errors.Wrap(err, "failed to read webhooks")
+		}
+		var hook WebhookRecord
+		if err := json.Unmarshal(data, &hook); err != nil {
+			return nil, errors.Wrap(err, "failed to decode webhooks")
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, errors.Wrap(rows.Err(), "failed to read webhooks")
+}
+
+func (s *pgStateStore) SaveSetting(name string, value json.RawMessage) error {
+	ctx, cancel := s.ctx()
+	defer cancel()
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO settings (name, value, updated_at) VALUES ($1, $2, now())
+		ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value, updated_at = now()`,
+		name, []byte(value))
+	return errors.Wrapf(err, "failed to write setting %s", name)
+}
+
+func (s *pgStateStore) LoadSetting(name string) (json.RawMessage, error) {
+	ctx, cancel := s.ctx()
+	defer cancel()
+	var value []byte
+	err := s.pool.QueryRow(ctx, `SELECT value FROM settings WHERE name = $1`, name).Scan(&value)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read setting %s", name)
+	}
+	return value, nil
+}
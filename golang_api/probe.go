@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Obtiene la duración en segundos del medio (archivo local o URL) con ffprobe
+func probeDuration(source string) (float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ProbeTimeout.Duration)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, cfg.FFprobePath,
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		source,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, errors.Wrapf(err, "ffprobe failed: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "ffprobe returned no duration")
+	}
+	return duration, nil
+}
+
+// Resultado de POST /probe
+type MediaProbe struct {
+	DurationSeconds  float64 `json:"duration_seconds"`
+	Format           string  `json:"format,omitempty"` // contenedor según ffprobe, p. ej. mov,mp4,m4a
+	Codec            string  `json:"codec"`
+	Channels         int     `json:"channels"`
+	SampleRate       int     `json:"sample_rate"`
+	SizeBytes        int64   `json:"size_bytes,omitempty"`
+	Model            string  `json:"model,omitempty"`
+	EstimatedSeconds float64 `json:"estimated_seconds"` // procesamiento en el backend, sin la espera en cola
+}
+
+type ProbeBody struct {
+	URL      string `json:"url"`
+	UploadID string `json:"upload_id"`
+	Model    string `json:"model"`
+}
+
+var errNoAudioStream = errors.New("media has no audio stream")
+
+// Sondea duración y primera pista de audio. Con una URL, ffprobe solo puede
+// usar protocolos de red: una lista HLS no puede remitir a file://.
+func probeMedia(ctx context.Context, source string) (*MediaProbe, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.ProbeTimeout.Duration)
+	defer cancel()
+
+	args := []string{"-v", "error"}
+	if u, err := url.Parse(source); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		args = append(args, "-protocol_whitelist", "http,https,tcp,tls,crypto")
+	}
+	args = append(args,
+		"-select_streams", "a:0",
+		"-show_entries", "format=format_name,duration,size:stream=codec_name,channels,sample_rate",
+		"-of", "json",
+		source,
+	)
+	cmd := exec.CommandContext(ctx, cfg.FFprobePath, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "ffprobe failed: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	var parsed struct {
+		Streams []struct {
+			CodecName  string `json:"codec_name"`
+			Channels   int    `json:"channels"`
+			SampleRate string `json:"sample_rate"`
+		} `json:"streams"`
+		Format struct {
+			FormatName string `json:"format_name"`
+			Duration   string `json:"duration"`
+			Size       string `json:"size"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return nil, errors.Wrap(err, "failed to parse ffprobe output")
+	}
+	if len(parsed.Streams) == 0 {
+		return nil, errNoAudioStream
+	}
+	duration, err := strconv.ParseFloat(parsed.Format.Duration, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "ffprobe returned no duration")
+	}
+	stream := parsed.Streams[0]
+	probe := &MediaProbe{
+		DurationSeconds: duration,
+		Format:          parsed.Format.FormatName,
+		Codec:           stream.CodecName,
+		Channels:        stream.Channels,
+	}
+	probe.SampleRate, _ = strconv.Atoi(stream.SampleRate)
+	probe.SizeBytes, _ = strconv.ParseInt(parsed.Format.Size, 10, 64)
+	return probe, nil
+}
+
+// Factor de tiempo real del modelo. Sin modelo (el del backend) o con uno
+// sin factor configurado se usa el más lento, para no prometer de menos.
+func realtimeFactor(model string) float64 {
+	if f, ok := cfg.RealtimeFactors[strings.ToLower(model)]; ok {
+		return f
+	}
+	var slowest float64
+	for _, f := range cfg.RealtimeFactors {
+		if f > slowest {
+			slowest = f
+		}
+	}
+	return slowest
+}
+
+// POST /probe sondea una URL o un upload_id sin crear el job: duración,
+// códec y una estimación del tiempo de transcripción
+func probeHandler(c *gin.Context) {
+	var input ProbeBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenant := currentTenant(c)
+	request := RequestBody{URL: input.URL, UploadID: input.UploadID}
+	if status, code, err := resolveUpload(c.Request.Context(), tenant, &request); err != nil {
+		c.JSON(status, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+	parsedURL, err := validateMediaURL(request.URL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_URL"})
+		return
+	}
+	if isBackendFetchHost(parsedURL) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "media from this host is fetched by the backend and cannot be probed", "code": "PROBE_FAILED"})
+		return
+	}
+	custom, err := lookupModel(tenant, input.Model)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "UNKNOWN_MODEL"})
+		return
+	}
+
+	probe, err := probeMedia(c.Request.Context(), request.URL)
+	if errors.Is(err, errNoAudioStream) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": "UNSUPPORTED_MEDIA"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": "PROBE_FAILED"})
+		return
+	}
+	factorModel := input.Model
+	if custom != nil {
+		factorModel = custom.backendModel()
+	}
+	probe.Model = input.Model
+	probe.EstimatedSeconds = math.Round(probe.DurationSeconds*realtimeFactor(factorModel)*10) / 10
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, probe)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Nombre del ajuste compartido con el estado de la cola
+const queueSetting = "queue"
+
+// Estado de la cola fijado por un operador. Pausada, los jobs nuevos se
+// aceptan pero esperan en queued; los que ya están en un backend terminan.
+type QueueState struct {
+	Paused    bool       `json:"paused"`
+	Reason    string     `json:"reason,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+var queueMu sync.RWMutex
+var queueState QueueState
+
+func currentQueueState() QueueState {
+	queueMu.RLock()
+	defer queueMu.RUnlock()
+	return queueState
+}
+
+func queuePaused() bool {
+	return currentQueueState().Paused
+}
+
+func applyQueueState(state QueueState) {
+	queueMu.Lock()
+	changed := state.Paused != queueState.Paused
+	queueState = state
+	queueMu.Unlock()
+	if !changed {
+		return
+	}
+	if state.Paused {
+		log.Printf("⚠️ Cola pausada: %s", state.Reason)
+	} else {
+		log.Printf("🚀 Cola reanudada")
+	}
+	jobScheduler.setPaused(state.Paused)
+}
+
+// Relee del almacén el estado de la cola, que pudo cambiar otra réplica
+func refreshQueueState() error {
+	data, err := stateStore.LoadSetting(queueSetting)
+	if err != nil || data == nil {
+		return err
+	}
+	var state QueueState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return errors.Wrap(err, "corrupt queue state")
+	}
+	applyQueueState(state)
+	return nil
+}
+
+// Relee los ajustes compartidos cada SETTINGS_POLL_INTERVAL
+func runSettingsSync() {
+	ticker := time.NewTicker(cfg.SettingsPollInterval.Duration)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := refreshQueueState(); err != nil {
+			log.Printf("⚠️ No se pudo releer el estado de la cola: %v", err)
+		}
+		if err := refreshMaintenance(); err != nil {
+			log.Printf("⚠️ No se pudo releer el modo mantenimiento: %v", err)
+		}
+		if err := refreshModels(); err != nil {
+			log.Printf("⚠️ No se pudieron releer los modelos: %v", err)
+		}
+		if err := refreshTemplates(); err != nil {
+			log.Printf("⚠️ No se pudieron releer las plantillas: %v", err)
+		}
+		if err := refreshKeys(); err != nil {
+			log.Printf("⚠️ No se pudieron releer las API keys: %v", err)
+		}
+		if err := flushKeysLastUsed(); err != nil {
+			log.Printf("⚠️ No se pudo guardar el último uso de las API keys: %v", err)
+		}
+		if err := flushAuditLog(); err != nil {
+			log.Printf("⚠️ No se pudo sincronizar el registro de auditoría: %v", err)
+		}
+		if err := refreshRetention(); err != nil {
+			log.Printf("⚠️ No se pudieron releer las políticas de retención: %v", err)
+		}
+		if err := refreshIntegrations(); err != nil {
+			log.Printf("⚠️ No se pudieron releer las integraciones: %v", err)
+		}
+		if err := refreshSFTPCredentials(); err != nil {
+			log.Printf("⚠️ No se pudieron releer las credenciales SFTP: %v", err)
+		}
+	}
+}
+
+func setQueueState(state QueueState) error {
+	now := time.Now()
+	state.UpdatedAt = &now
+	if stateStore != nil {
+		data, err := json.Marshal(state)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal queue state")
+		}
+		if err := stateStore.SaveSetting(queueSetting, data); err != nil {
+			return err
+		}
+	}
+	applyQueueState(state)
+	return nil
+}
+
+type queueResponse struct {
+	QueueState
+	Waiting int `json:"waiting"` // jobs de este proceso esperando un worker
+}
+
+func writeQueueState(c *gin.Context) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, queueResponse{QueueState: currentQueueState(), Waiting: jobScheduler.waitingCount()})
+}
+
+// GET /admin/queue devuelve el estado de la cola
+func getQueueHandler(c *gin.Context) {
+	writeQueueState(c)
+}
+
+// POST /admin/queue/pause deja de asignar trabajo a los backends
+func pauseQueueHandler(c *gin.Context) {
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := setQueueState(QueueState{Paused: true, Reason: input.Reason}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+	writeQueueState(c)
+}
+
+// POST /admin/queue/resume vuelve a asignar trabajo
+func resumeQueueHandler(c *gin.Context) {
+	if err := setQueueState(QueueState{}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+	writeQueueState(c)
+}
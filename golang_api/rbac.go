@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Roles de acceso de una API key, de menos a más permisos
+const (
+	AccessViewer = "viewer" // leer jobs, resultados y configuración del tenant
+	AccessEditor = "editor" // además crear jobs y editar transcripciones
+	AccessAdmin  = "admin"  // además /keys, /audit, integraciones, credenciales SFTP, modelos propios, retención, caché y borrado de datos, en su tenant
+
+	// Operación del servicio que comparten los tenants: cola, mantenimiento,
+	// configuración, diagnóstico, /metrics y los jobs de todos. Solo keys
+	// de api_keys o grupos de OIDC, nunca una de POST /keys.
+	AccessOperator = "operator"
+)
+
+var accessLevels = map[string]int{AccessViewer: 1, AccessEditor: 2, AccessAdmin: 3, AccessOperator: 4}
+
+func isAccessRole(role string) bool {
+	_, ok := accessLevels[role]
+	return ok
+}
+
+// Rol mínimo para una ruta (FullPath de gin, vacío si no existe)
+func requiredAccess(method, route string) string {
+	switch {
+	case route == "/admin/jobs", route == "/admin/erasure":
+		// Solo los jobs del tenant de la key, salvo para operator
+		return AccessAdmin
+	case strings.HasPrefix(route, "/admin/"), route == "/metrics":
+		return AccessOperator
+	case route == "/keys", strings.HasPrefix(route, "/keys/"), route == "/audit":
+		return AccessAdmin
+	case method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions:
+		return AccessViewer
+	case method == http.MethodPost && route == "/jobs/status", strings.HasPrefix(route, "/auth/"):
+		// Solo consulta (o cierre de sesión), aunque sea POST
+		return AccessViewer
+	case strings.HasPrefix(route, "/models/") || route == "/cache" || route == "/retention":
+		return AccessAdmin
+	case route == "/integrations", strings.HasPrefix(route, "/integrations/"):
+		// Guardan tokens OAuth del tenant
+		return AccessAdmin
+	case strings.HasPrefix(route, "/sftp/"):
+		// Guardan contraseñas y claves privadas
+		return AccessAdmin
+	}
+	return AccessEditor
+}
+
+// La petición ve los jobs de todos los tenants: key operator o sin keys
+// configuradas
+func isOperator(c *gin.Context) bool {
+	key := currentAPIKey(c)
+	return key == nil || key.Role == AccessOperator
+}
+
+// El job es del tenant de la petición, o la petición los ve todos
+func canSeeJob(c *gin.Context, meta jobMeta) bool {
+	return currentAPIKey(c).canSee(meta)
+}
+
+// El job es del tenant de la key, o la key es operator (nil: servicio sin
+// autenticación)
+func (k *APIKey) canSee(meta jobMeta) bool {
+	return k == nil || k.Role == AccessOperator || meta.Tenant == k.tenant()
+}
+
+// En las rutas con :job_id un job de otro tenant responde 404, como uno que
+// no existe. Los enlaces de /shared/ no llevan key: los protege su firma.
+func jobTenantMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID := c.Param("job_id")
+		if jobID == "" || strings.HasPrefix(c.FullPath(), sharedPathPrefix) {
+			c.Next()
+			return
+		}
+		if meta, _ := getJobMeta(jobID); !canSeeJob(c, meta) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Tras authMiddleware: rechaza con 403 lo que el rol de la key no permite.
+// Sin keys configuradas no hay roles.
+func rbacMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := currentAPIKey(c)
+		if key == nil {
+			c.Next()
+			return
+		}
+		if accessLevels[key.Role] < accessLevels[requiredAccess(c.Request.Method, c.FullPath())] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key role does not allow this operation", "code": "FORBIDDEN"})
+			return
+		}
+		c.Next()
+	}
+}
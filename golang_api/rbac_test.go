@@ -0,0 +1,411 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequiredAccess(t *testing.T) {
+	tests := []struct {
+		method, route, want string
+	}{
+		{http.MethodGet, "/result/:job_id", AccessViewer},
+		{http.MethodPost, "/jobs/status", AccessViewer},
+		{http.MethodPost, "/auth/logout", AccessViewer},
+		{http.MethodPost, "/process", AccessEditor},
+		{http.MethodPut, "/jobs/:job_id/segments/:seg_id", AccessEditor},
+		{http.MethodGet, "/keys", AccessAdmin},
+		{http.MethodPost, "/keys/:key_id/rotate", AccessAdmin},
+		{http.MethodGet, "/audit", AccessAdmin},
+		{http.MethodPut, "/models/:name", AccessAdmin},
+		{http.MethodDelete, "/cache", AccessAdmin},
+		{http.MethodPut, "/retention", AccessAdmin},
+		{http.MethodPost, "/integrations/:provider", AccessAdmin},
+		{http.MethodPut, "/sftp/credentials/:host", AccessAdmin},
+		{http.MethodGet, "/admin/jobs", AccessAdmin},
+		{http.MethodPost, "/admin/erasure", AccessAdmin},
+		{http.MethodPost, "/admin/queue/pause", AccessOperator},
+		{http.MethodPut, "/admin/maintenance", AccessOperator},
+		{http.MethodGet, "/admin/maintenance", AccessOperator},
+		{http.MethodPost, "/admin/config/reload", AccessOperator},
+		{http.MethodGet, "/admin/debug/pprof/*profile", AccessOperator},
+		{http.MethodPost, "/admin/routing/explain", AccessOperator},
+		{http.MethodGet, "/metrics", AccessOperator},
+	}
+	for _, tt := range tests {
+		if got := requiredAccess(tt.method, tt.route); got != tt.want {
+			t.Errorf("requiredAccess(%s %s) = %s, want %s", tt.method, tt.route, got, tt.want)
+		}
+	}
+}
+
+// Router con las rutas pedidas tras rbacMiddleware y una key del rol dado
+func rbacRouter(role string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(ctxAPIKey, &APIKey{Name: "k-" + role, Tenant: "acme", Role: role})
+	})
+	router.Use(rbacMiddleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	router.GET("/result/:job_id", ok)
+	router.POST("/jobs/status", ok)
+	router.POST("/process", ok)
+	router.GET("/keys", ok)
+	router.GET("/admin/jobs", ok)
+	router.POST("/admin/erasure", ok)
+	router.POST("/admin/queue/pause", ok)
+	router.PUT("/admin/maintenance", ok)
+	router.GET("/admin/debug/pprof/*profile", ok)
+	router.GET("/metrics", ok)
+	return router
+}
+
+func TestRBACMiddleware(t *testing.T) {
+	routes := []struct {
+		method, path string
+		allowed      []string // roles con acceso
+	}{
+		{http.MethodGet, "/result/j1", []string{AccessViewer, AccessEditor, AccessAdmin, AccessOperator}},
+		{http.MethodPost, "/jobs/status", []string{AccessViewer, AccessEditor, AccessAdmin, AccessOperator}},
+		{http.MethodPost, "/process", []string{AccessEditor, AccessAdmin, AccessOperator}},
+		{http.MethodGet, "/keys", []string{AccessAdmin, AccessOperator}},
+		{http.MethodGet, "/admin/jobs", []string{AccessAdmin, AccessOperator}},
+		{http.MethodPost, "/admin/erasure", []string{AccessAdmin, AccessOperator}},
+		{http.MethodPost, "/admin/queue/pause", []string{AccessOperator}},
+		{http.MethodPut, "/admin/maintenance", []string{AccessOperator}},
+		{http.MethodGet, "/admin/debug/pprof/heap", []string{AccessOperator}},
+		{http.MethodGet, "/metrics", []string{AccessOperator}},
+	}
+	for _, role := range []string{AccessViewer, AccessEditor, AccessAdmin, AccessOperator} {
+		router := rbacRouter(role)
+		for _, r := range routes {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(r.method, r.path, nil))
+			want := http.StatusForbidden
+			if containsString(r.allowed, role) {
+				want = http.StatusNoContent
+			}
+			if w.Code != want {
+				t.Errorf("%s: %s %s = %d, want %d", role, r.method, r.path, w.Code, want)
+			}
+		}
+	}
+}
+
+func TestAdminJobsTenantScope(t *testing.T) {
+	mu.Lock()
+	for id, tenant := range map[string]string{"rbac-acme": "acme", "rbac-beta": "beta"} {
+		jobStore[id] = &JobState{Status: "completed", Timestamp: time.Now()}
+		jobMetas[id] = &jobMeta{Tenant: tenant}
+	}
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		for _, id := range []string{"rbac-acme", "rbac-beta"} {
+			delete(jobStore, id)
+			delete(jobMetas, id)
+		}
+		mu.Unlock()
+	})
+
+	tests := []struct {
+		role string
+		want map[string]bool
+	}{
+		{AccessAdmin, map[string]bool{"rbac-acme": true}},
+		{AccessOperator, map[string]bool{"rbac-acme": true, "rbac-beta": true}},
+	}
+	for _, tt := range tests {
+		router := gin.New()
+		router.Use(func(c *gin.Context) { c.Set(ctxAPIKey, &APIKey{Name: "k", Tenant: "acme", Role: tt.role}) })
+		router.GET("/admin/jobs", adminJobsHandler)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/jobs", nil))
+		var out struct {
+			Jobs []AdminJob `json:"jobs"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &out)
+		got := make(map[string]bool)
+		for _, j := range out.Jobs {
+			if j.JobID == "rbac-acme" || j.JobID == "rbac-beta" {
+				got[j.JobID] = true
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s sees %v, want %v", tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestStaticKeyDefaultRole(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"api_keys": [{"key": "norolekey1234567"}, {"key": "opkey12345678901", "role": "operator"}]}`), 0o600)
+	t.Setenv("CONFIG_FILE", path)
+	c, _ := readConfig(t.Fatalf)
+	if got := c.APIKeys[0].Role; got != AccessEditor {
+		t.Errorf("role-less key has role %s, want %s", got, AccessEditor)
+	}
+	if got := c.APIKeys[1].Role; got != AccessOperator {
+		t.Errorf("operator key has role %s", got)
+	}
+}
+
+func TestJobTenantIsolation(t *testing.T) {
+	_, backend := startMock(t)
+	keys := map[string]string{"acme": "acmeviewerkey1234", "beta": "betaviewerkey1234", "ops": "operatorkey123456"}
+	gateway := newTestGateway(t, map[string]interface{}{"api_keys": []map[string]string{
+		{"key": keys["acme"], "name": "acme", "role": AccessViewer, "tenant": "acme"},
+		{"key": keys["beta"], "name": "beta", "role": AccessViewer, "tenant": "beta"},
+		{"key": keys["ops"], "name": "ops", "role": AccessOperator},
+	}}, backend)
+
+	mu.Lock()
+	for id, tenant := range map[string]string{"tenant-acme": "acme", "tenant-beta": "beta"} {
+		jobStore[id] = &JobState{Type: JobTypeTranscription, Status: "completed", Transcription: "hola", Timestamp: time.Now()}
+		jobMetas[id] = &jobMeta{Tenant: tenant}
+	}
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		for _, id := range []string{"tenant-acme", "tenant-beta"} {
+			delete(jobStore, id)
+			delete(jobMetas, id)
+			delete(jobEvents, id)
+		}
+		mu.Unlock()
+	})
+
+	get := func(key, path string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, gateway.URL+path, nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	listed := func(key string) map[string]bool {
+		var jobs map[string]JobState
+		json.NewDecoder(get(key, "/jobs").Body).Decode(&jobs)
+		got := make(map[string]bool)
+		for id := range jobs {
+			if strings.HasPrefix(id, "tenant-") {
+				got[id] = true
+			}
+		}
+		return got
+	}
+	if got, want := listed(keys["acme"]), map[string]bool{"tenant-acme": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("acme lists %v, want %v", got, want)
+	}
+	if got, want := listed(keys["beta"]), map[string]bool{"tenant-beta": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("beta lists %v, want %v", got, want)
+	}
+	if got, want := listed(keys["ops"]), map[string]bool{"tenant-acme": true, "tenant-beta": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("operator lists %v, want %v", got, want)
+	}
+
+	paths := []string{"/result/%s", "/jobs/%s/events", "/result/%s/transcript", "/result/%s/subtitles?format=srt", "/jobs/%s/annotations", "/jobs/%s/embed"}
+	for _, path := range paths {
+		for _, tt := range []struct {
+			key, job string
+			visible  bool
+		}{
+			{keys["acme"], "tenant-acme", true},
+			{keys["acme"], "tenant-beta", false},
+			{keys["beta"], "tenant-acme", false},
+			{keys["ops"], "tenant-beta", true},
+		} {
+			url := fmt.Sprintf(path, tt.job)
+			code := get(tt.key, url).StatusCode
+			if tt.visible == (code == http.StatusNotFound) {
+				t.Errorf("GET %s with the %s key = %d, visible %v", url, tt.key[:4], code, tt.visible)
+			}
+		}
+	}
+}
+
+// Los handlers de /share comprueban el tenant aunque falte el middleware
+func TestShareTenantScope(t *testing.T) {
+	saved := cfg
+	cfg.ShareSigningKey = "share-test-key"
+	cfg.ShareLinkTTL = Duration{time.Hour}
+	cfg.ShareLinkMaxTTL = Duration{24 * time.Hour}
+	t.Cleanup(func() { cfg = saved })
+
+	mu.Lock()
+	jobStore["share-beta"] = &JobState{Type: JobTypeTranscription, Status: "completed", Timestamp: time.Now()}
+	jobMetas["share-beta"] = &jobMeta{Tenant: "beta"}
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		delete(jobStore, "share-beta")
+		delete(jobMetas, "share-beta")
+		delete(jobEvents, "share-beta")
+		mu.Unlock()
+	})
+
+	for _, tt := range []struct {
+		tenant string
+		create int
+		revoke int
+	}{
+		{"acme", http.StatusNotFound, http.StatusNotFound},
+		{"beta", http.StatusCreated, http.StatusNoContent},
+	} {
+		router := gin.New()
+		router.Use(func(c *gin.Context) { c.Set(ctxAPIKey, &APIKey{Name: "k", Tenant: tt.tenant, Role: AccessEditor}) })
+		router.POST("/jobs/:job_id/share", createShareHandler)
+		router.DELETE("/jobs/:job_id/share", revokeSharesHandler)
+		for method, want := range map[string]int{http.MethodPost: tt.create, http.MethodDelete: tt.revoke} {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(method, "/jobs/share-beta/share", nil))
+			if w.Code != want {
+				t.Errorf("%s %s share = %d, want %d", tt.tenant, method, w.Code, want)
+			}
+		}
+	}
+	if meta, _ := getJobMeta("share-beta"); meta.ShareEpoch != 1 {
+		t.Errorf("share epoch = %d, want 1 (only the owner revokes)", meta.ShareEpoch)
+	}
+}
+
+func TestBulkJobStatusTenantScope(t *testing.T) {
+	initLiveConfig()
+	mu.Lock()
+	for id, tenant := range map[string]string{"bulk-acme": "acme", "bulk-beta": "beta"} {
+		jobStore[id] = &JobState{Status: "completed", Timestamp: time.Now()}
+		jobMetas[id] = &jobMeta{Tenant: tenant}
+	}
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		for _, id := range []string{"bulk-acme", "bulk-beta"} {
+			delete(jobStore, id)
+			delete(jobMetas, id)
+		}
+		mu.Unlock()
+	})
+
+	tests := []struct {
+		role     string
+		found    []string
+		notFound []string
+	}{
+		{AccessViewer, []string{"bulk-acme"}, []string{"bulk-beta", "bulk-missing"}},
+		{AccessOperator, []string{"bulk-acme", "bulk-beta"}, []string{"bulk-missing"}},
+	}
+	for _, tt := range tests {
+		router := gin.New()
+		router.Use(func(c *gin.Context) { c.Set(ctxAPIKey, &APIKey{Name: "k", Tenant: "acme", Role: tt.role}) })
+		router.POST("/jobs/status", bulkJobStatusHandler)
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"job_ids": ["bulk-acme", "bulk-beta", "bulk-missing"]}`)
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/jobs/status", body))
+		var out struct {
+			Jobs     map[string]JobStatusSummary `json:"jobs"`
+			NotFound []string                    `json:"not_found"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &out)
+		found := make([]string, 0, len(out.Jobs))
+		for id := range out.Jobs {
+			found = append(found, id)
+		}
+		sort.Strings(found)
+		sort.Strings(out.NotFound)
+		if !reflect.DeepEqual(found, tt.found) || !reflect.DeepEqual(out.NotFound, tt.notFound) {
+			t.Errorf("%s: jobs %v, not_found %v; want %v, %v", tt.role, found, out.NotFound, tt.found, tt.notFound)
+		}
+	}
+}
+
+// El revisor sale de la API key: el assignee del cuerpo se ignora
+func TestReviewAssigneeFromKey(t *testing.T) {
+	mu.Lock()
+	jobStore["review-job"] = &JobState{Type: JobTypeTranscription, Status: "completed", Timestamp: time.Now(), Review: &JobReview{Status: ReviewNeeded}}
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		delete(jobStore, "review-job")
+		delete(jobEvents, "review-job")
+		mu.Unlock()
+	})
+
+	review := func(name, action, assignee string) (int, JobReview) {
+		router := gin.New()
+		router.Use(func(c *gin.Context) { c.Set(ctxAPIKey, &APIKey{Name: name, Role: AccessEditor}) })
+		router.POST("/jobs/:job_id/review/claim", claimReviewHandler)
+		router.POST("/jobs/:job_id/review/release", releaseReviewHandler)
+		router.POST("/jobs/:job_id/review/approve", approveReviewHandler)
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"assignee":"` + assignee + `"}`)
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/jobs/review-job/review/"+action, body))
+		var out JobReview
+		json.Unmarshal(w.Body.Bytes(), &out)
+		return w.Code, out
+	}
+
+	if code, out := review("alice", "claim", "bob"); code != http.StatusOK || out.Assignee != "alice" {
+		t.Fatalf("claim = %d %+v, want 200 assigned to alice", code, out)
+	}
+	for _, action := range []string{"release", "approve"} {
+		if code, _ := review("bob", action, "alice"); code != http.StatusConflict {
+			t.Errorf("bob %s posing as alice = %d, want %d", action, code, http.StatusConflict)
+		}
+	}
+	if code, out := review("alice", "approve", "bob"); code != http.StatusOK || out.ApprovedBy != "alice" {
+		t.Errorf("approve = %d %+v, want 200 approved by alice", code, out)
+	}
+}
+
+// transcript_job_id llega en el cuerpo: otro tenant no lo puede usar ni
+// saber si existe o en qué estado está
+func TestBurnTranscriptTenantScope(t *testing.T) {
+	mu.Lock()
+	jobStore["burn-beta"] = &JobState{Type: JobTypeTranscription, Status: "completed", Segments: []Segment{{Start: 0, End: 1, Text: "hola"}}, Timestamp: time.Now()}
+	jobMetas["burn-beta"] = &jobMeta{Tenant: "beta"}
+	jobStore["burn-beta-queued"] = &JobState{Type: JobTypeTranscription, Status: "queued", Timestamp: time.Now()}
+	jobMetas["burn-beta-queued"] = &jobMeta{Tenant: "beta"}
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		forgetJobLocked("burn-beta")
+		forgetJobLocked("burn-beta-queued")
+		mu.Unlock()
+	})
+
+	acme := &APIKey{Name: "a", Tenant: "acme", Role: AccessEditor}
+	beta := &APIKey{Name: "b", Tenant: "beta", Role: AccessEditor}
+	ops := &APIKey{Name: "ops", Tenant: "acme", Role: AccessOperator}
+	for _, tt := range []struct {
+		key   *APIKey
+		jobID string
+		want  string
+	}{
+		{acme, "burn-beta", "transcript job not found"},
+		{acme, "burn-beta-queued", "transcript job not found"},
+		{acme, "burn-missing", "transcript job not found"},
+		{beta, "burn-beta", ""},
+		{beta, "burn-beta-queued", "transcript job must be completed and have timed segments"},
+		{ops, "burn-beta", ""},
+	} {
+		err := validateBurnRequest(RequestBody{Type: JobTypeBurnSubtitles, TranscriptJobID: tt.jobID}, tt.key)
+		if got := fmt.Sprint(err); (tt.want == "" && err != nil) || (tt.want != "" && got != tt.want) {
+			t.Errorf("%s burning %s: error %v, want %q", tt.key.Name, tt.jobID, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gin-gonic/gin"
+)
+
+// Inicializa Sentry si hay DSN; sin él los pánicos solo se registran en el log
+func initErrorTracker() error {
+	if cfg.SentryDSN == "" {
+		return nil
+	}
+	return sentry.Init(sentry.ClientOptions{
+		Dsn:         cfg.SentryDSN,
+		Environment: cfg.SentryEnvironment,
+	})
+}
+
+// Reporta un pánico con el contexto disponible (ruta, job...)
+func reportPanic(recovered interface{}, stack []byte, tags map[string]string) {
+	if id := tags["request_id"]; id != "" {
+		log.Printf("❌ Pánico: %v [request_id=%s]\n%s", recovered, id, stack)
+	} else {
+		log.Printf("❌ Pánico: %v\n%s", recovered, stack)
+	}
+	if cfg.SentryDSN == "" {
+		return
+	}
+	for k, v := range tags {
+		if v == "" {
+			delete(tags, k)
+		}
+	}
+	hub := sentry.CurrentHub().Clone()
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetLevel(sentry.LevelFatal)
+		scope.SetTags(tags)
+		scope.SetExtra("stack", string(stack))
+		hub.Recover(recovered)
+	})
+	hub.Flush(2 * time.Second)
+}
+
+// Sustituye a gin.Recovery: responde 500 con el formato de error de la API
+func recoveryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				// Conexión cortada por el cliente
+				panic(recovered)
+			}
+			tags := map[string]string{"method": c.Request.Method, "route": c.FullPath(), "request_id": requestID(c)}
+			if key := currentAPIKey(c); key != nil {
+				tags["api_key"] = key.Name
+			}
+			if jobID := c.Param("job_id"); jobID != "" {
+				tags["job_id"] = jobID
+			}
+			reportPanic(recovered, debug.Stack(), tags)
+			if !c.Writer.Written() {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error", "code": "INTERNAL_ERROR"})
+				return
+			}
+			c.Abort()
+		}()
+		c.Next()
+	}
+}
+
+// Para usar con defer al inicio de la goroutine de un job: un pánico marca
+// el job como fallido en lugar de tumbar el proceso
+func recoverJob(jobID string) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	tags := map[string]string{"job_id": jobID}
+	if job, ok := getJob(jobID); ok {
+		tags["job_type"] = job.Type
+		tags["status"] = job.Status
+		tags["backend"] = job.Backend
+		tags["api_key"] = job.APIKey
+		tags["request_id"] = job.RequestID
+	}
+	reportPanic(recovered, debug.Stack(), tags)
+	// Ya reportado como pánico
+	markJobFailed(jobID, "INTERNAL_ERROR", fmt.Sprintf("internal error: %v", recovered))
+}
+
+// Categorías de fallo de un job para agrupar en el tracker
+const (
+	FailureBackend  = "backend"
+	FailureTimeout  = "timeout"
+	FailureMedia    = "media"
+	FailureRender   = "render"
+	FailureInternal = "internal"
+)
+
+func failureCategory(code, message string) string {
+	lower := strings.ToLower(message)
+	if strings.Contains(lower, "timeout") || strings.Contains(lower, "deadline exceeded") {
+		return FailureTimeout
+	}
+	switch code {
+	case "BACKEND_UNAVAILABLE", "BACKEND_ERROR", "BACKEND_TIMEOUT", "INVALID_BACKEND_RESPONSE", "BACKEND_CONTRACT_MISMATCH", "ALIGNMENT_FAILED":
+		return FailureBackend
+	case "INVALID_URL", "DOWNLOAD_FAILED", "CHECKSUM_MISMATCH", "PROBE_FAILED", "UNSUPPORTED_MEDIA", "NO_SPEECH":
+		return FailureMedia
+	case "RENDER_FAILED", "STORAGE_FAILED":
+		return FailureRender
+	}
+	return FailureInternal
+}
+
+// Fracción de fallos de la categoría que se envía al tracker
+func failureSampleRate(category string) float64 {
+	if rate, ok := live().ErrorSampleRates[category]; ok {
+		return rate
+	}
+	return live().ErrorSampleRate
+}
+
+// Envía un fallo de job a Sentry, agrupado por categoría y código para que
+// los picos se vean como un único issue
+func reportJobFailure(jobID string, job JobState, code, message string) {
+	if cfg.SentryDSN == "" {
+		return
+	}
+	category := failureCategory(code, message)
+	if rand.Float64() >= failureSampleRate(category) {
+		return
+	}
+
+	tags := map[string]string{
+		"job_id":     jobID,
+		"category":   category,
+		"code":       code,
+		"job_type":   job.Type,
+		"backend":    job.Backend,
+		"api_key":    job.APIKey,
+		"lane":       job.Lane,
+		"request_id": job.RequestID,
+	}
+	hub := sentry.CurrentHub().Clone()
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetLevel(sentry.LevelError)
+		for k, v := range tags {
+			if v != "" {
+				scope.SetTag(k, v)
+			}
+		}
+		scope.SetFingerprint([]string{"job-failure", category, code})
+		scope.SetExtra("error", message)
+		scope.SetExtra("duration_seconds", job.Duration)
+		hub.CaptureMessage(fmt.Sprintf("job failed: %s (%s)", code, category))
+	})
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Campos de Config que una recarga aplica sin reiniciar. Se leen con
+// live(); el resto de cfg no cambia después de arrancar y sus cambios
+// esperan al siguiente reinicio.
+var reloadableConfig = []string{
+	// Límites
+	"DefaultMaxConcurrentJobs",
+	"ConcurrencyLimitMode",
+	"GPUMinutesBudget",
+	"TenantWeights",
+	"PriorityAgingInterval",
+	"BulkStatusMaxJobs",
+
+	// Backends y workers: los jobs en curso siguen en su backend y worker
+	"WhisperBackends",
+	"BackendMaxConcurrency",
+	"DefaultBackendConcurrency",
+	"BackendFallback",
+	"BackendProtocol",
+	"BackendPollInterval",
+	"BackendJobTimeout",
+	"BackendRestartGrace",
+	"BackendWarmup",
+	"BackendWarmupIdle",
+	"BackendWarmupModel",
+	"BackendRouting",
+	"Workers",
+	"ShortLaneFraction",
+
+	// Comportamiento
+	"AccessLogSampleRate",
+	"VADCheck",
+	"VADMinSpeechRatio",
+	"ErrorSampleRate",
+	"ErrorSampleRates",
+	"FeatureFlags",
+	"TenantFeatureFlags",
+}
+
+// Campos que cambian en cada lectura sin que cambie la configuración
+var reloadIgnoredConfig = map[string]bool{"WorkerID": true}
+
+// Copia de cfg con los valores vigentes de reloadableConfig
+var liveConfig atomic.Value
+
+// Serializa las recargas
+var reloadMu sync.Mutex
+
+// Resultado de una recarga, con las claves de CONFIG_FILE
+type ConfigReload struct {
+	Applied         []string  `json:"applied"`          // ya en vigor
+	RestartRequired []string  `json:"restart_required"` // cambiadas, se aplican al reiniciar
+	ReloadedAt      time.Time `json:"reloaded_at"`
+}
+
+// Configuración vigente de los campos de reloadableConfig
+func live() *Config {
+	return liveConfig.Load().(*Config)
+}
+
+func initLiveConfig() {
+	snapshot := cfg
+	liveConfig.Store(&snapshot)
+}
+
+// Error de validación de una recarga
+type invalidConfigError struct {
+	message string
+}
+
+// Lee la configuración como al arrancar, pero un error la aborta en lugar
+// de terminar el proceso
+func readConfigForReload() (c Config, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			invalid, ok := r.(invalidConfigError)
+			if !ok {
+				panic(r)
+			}
+			err = errors.New(invalid.message)
+		}
+	}()
+	c, _ = readConfig(func(format string, args ...interface{}) {
+		panic(invalidConfigError{strings.TrimPrefix(fmt.Sprintf(format, args...), "❌ ")})
+	})
+	return c, nil
+}
+
+// Clave de CONFIG_FILE de un campo de Config
+func configKey(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// Relee CONFIG_FILE, el entorno y los secretos y aplica los campos de
+// reloadableConfig que cambiaron. Una configuración inválida no cambia nada.
+func reloadConfig() (*ConfigReload, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	next, err := readConfigForReload()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid configuration")
+	}
+
+	current := live()
+	updated := *current
+	result := &ConfigReload{Applied: []string{}, RestartRequired: []string{}, ReloadedAt: time.Now()}
+	nv, cv, uv := reflect.ValueOf(&next).Elem(), reflect.ValueOf(current).Elem(), reflect.ValueOf(&updated).Elem()
+	t := nv.Type()
+	reloadable := make(map[string]bool, len(reloadableConfig))
+	for _, name := range reloadableConfig {
+		reloadable[name] = true
+		field, _ := t.FieldByName(name)
+		if !reflect.DeepEqual(nv.FieldByName(name).Interface(), cv.FieldByName(name).Interface()) {
+			uv.FieldByName(name).Set(nv.FieldByName(name))
+			result.Applied = append(result.Applied, configKey(field))
+		}
+	}
+
+	// El resto se compara con la configuración con la que arrancó
+	configSecrets.mu.RLock()
+	startup := reflect.ValueOf(&cfg).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Name
+		if reloadable[name] || reloadIgnoredConfig[name] {
+			continue
+		}
+		if !reflect.DeepEqual(nv.Field(i).Interface(), startup.Field(i).Interface()) {
+			result.RestartRequired = append(result.RestartRequired, configKey(t.Field(i)))
+		}
+	}
+	configSecrets.mu.RUnlock()
+
+	if len(result.Applied) > 0 {
+		liveConfig.Store(&updated)
+		jobScheduler.resize(updated.Workers, updated.ShortLaneFraction)
+		backends.reconfigure(updated.WhisperBackends)
+		log.Printf("🚀 Configuración recargada: %s", strings.Join(result.Applied, ", "))
+	}
+	if len(result.RestartRequired) > 0 {
+		log.Printf("⚠️ Cambios de configuración que se aplican al reiniciar: %s", strings.Join(result.RestartRequired, ", "))
+	}
+	return result, nil
+}
+
+// Huella de CONFIG_FILE para detectar cambios; vacía si no se puede leer
+func configFileStamp(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+}
+
+// Recarga la configuración con SIGHUP y, con CONFIG_RELOAD_INTERVAL,
+// cuando cambia CONFIG_FILE (también si lo sustituye un ConfigMap)
+func runConfigWatcher() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	path := os.Getenv("CONFIG_FILE")
+	last := configFileStamp(path)
+	var tick <-chan time.Time
+	if path != "" && cfg.ConfigReloadInterval.Duration > 0 {
+		ticker := time.NewTicker(cfg.ConfigReloadInterval.Duration)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-hup:
+			log.Printf("🚀 SIGHUP recibido: recargando la configuración")
+		case <-tick:
+			stamp := configFileStamp(path)
+			if stamp == last || stamp == "" {
+				continue
+			}
+			last = stamp
+		}
+		if _, err := reloadConfig(); err != nil {
+			log.Printf("⚠️ No se pudo recargar la configuración: %v", err)
+		}
+	}
+}
+
+// POST /admin/config/reload aplica los cambios de la configuración que no
+// requieren reiniciar; solo en la réplica que atiende la petición
+func reloadConfigHandler(c *gin.Context) {
+	result, err := reloadConfig()
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": "INVALID_CONFIG"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, result)
+}
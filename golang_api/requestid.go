@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Cabecera con el identificador de correlación de la petición. Se acepta la
+// del cliente, se devuelve siempre y se reenvía al backend de whisper.
+const requestIDHeader = "X-Request-ID"
+
+const ctxRequestID = "request_id"
+
+const maxRequestIDLength = 128
+
+// Solo ASCII visible y de longitud acotada, para poder copiarlo tal cual a
+// logs y cabeceras
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Request ID de la petición ("" fuera de requestIDMiddleware)
+func requestID(c *gin.Context) string {
+	return c.GetString(ctxRequestID)
+}
+
+// Asigna el request ID (el del cliente si es válido) y lo devuelve en la
+// cabecera de la respuesta; errorBodyMiddleware lo añade a los errores
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Set(ctxRequestID, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// Request ID del job; requiere mu tomado
+func jobRequestIDLocked(jobID string) string {
+	if job, ok := jobStore[jobID]; ok {
+		return job.RequestID
+	}
+	return ""
+}
+
+// log.Printf de una línea sobre un job, con su request ID para poder
+// seguirlo desde la petición del cliente. Requiere mu tomado.
+func jobLogfLocked(jobID, format string, args ...interface{}) {
+	logWithRequestID(jobRequestIDLocked(jobID), fmt.Sprintf(format, args...))
+}
+
+// Como jobLogfLocked; requiere que mu NO esté tomado
+func jobLogf(jobID, format string, args ...interface{}) {
+	mu.RLock()
+	id := jobRequestIDLocked(jobID)
+	mu.RUnlock()
+	logWithRequestID(id, fmt.Sprintf(format, args...))
+}
+
+func logWithRequestID(id, line string) {
+	if id != "" {
+		line += " [request_id=" + id + "]"
+	}
+	log.Print(line)
+}
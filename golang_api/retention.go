@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Nombre del ajuste compartido con las políticas de retención de los tenants
+const retentionSetting = "retention"
+
+// Máximo de días de transcript_days (10 años)
+const maxRetentionDays = 3650
+
+// Entradas de GET /retention/deletions por defecto y como máximo
+const (
+	defaultRetentionDeletions = 100
+	maxRetentionDeletions     = 1000
+)
+
+// Política de retención de un tenant; la vacía lo conserva todo
+type RetentionPolicy struct {
+	TranscriptDays int        `json:"transcript_days"` // días desde la creación del job; 0 = sin límite
+	DeleteMedia    bool       `json:"delete_media"`    // borrar el medio original en cuanto termina el job
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+}
+
+// Borrado registrado en el historial de un job
+type RetentionDeletion struct {
+	JobID     string    `json:"job_id"`
+	Kind      string    `json:"kind"` // transcript o media
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Códigos de los eventos purge
+const (
+	PurgeTranscript = "transcript"
+	PurgeMedia      = "media"
+)
+
+// Políticas por tenant
+type retentionRegistry struct {
+	mu       sync.RWMutex
+	policies map[string]RetentionPolicy
+}
+
+var retentionPolicies = &retentionRegistry{policies: make(map[string]RetentionPolicy)}
+
+func (r *retentionRegistry) get(tenant string) RetentionPolicy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.policies[tenant]
+}
+
+// Guarda el registro completo; requiere r.mu tomado
+func (r *retentionRegistry) persistLocked() error {
+	if stateStore == nil {
+		return nil
+	}
+	data, err := json.Marshal(r.policies)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal retention policies")
+	}
+	return stateStore.SaveSetting(retentionSetting, data)
+}
+
+func (r *retentionRegistry) set(tenant string, p RetentionPolicy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous, existed := r.policies[tenant]
+	if p.TranscriptDays == 0 && !p.DeleteMedia {
+		delete(r.policies, tenant)
+	} else {
+		r.policies[tenant] = p
+	}
+	if err := r.persistLocked(); err != nil {
+		if existed {
+			r.policies[tenant] = previous
+		} else {
+			delete(r.policies, tenant)
+		}
+		return err
+	}
+	return nil
+}
+
+func refreshRetention() error {
+	data, err := stateStore.LoadSetting(retentionSetting)
+	if err != nil || data == nil {
+		return err
+	}
+	var policies map[string]RetentionPolicy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return errors.Wrap(err, "corrupt retention policies")
+	}
+	if policies == nil {
+		policies = make(map[string]RetentionPolicy)
+	}
+	retentionPolicies.mu.Lock()
+	retentionPolicies.policies = policies
+	retentionPolicies.mu.Unlock()
+	return nil
+}
+
+// GET /retention devuelve la política del tenant
+func getRetentionHandler(c *gin.Context) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, retentionPolicies.get(currentTenant(c)))
+}
+
+// PUT /retention reemplaza la política del tenant; se aplica también a
+// los jobs que ya existen
+func putRetentionHandler(c *gin.Context) {
+	var input RetentionPolicy
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.TranscriptDays < 0 || input.TranscriptDays > maxRetentionDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("transcript_days must be between 0 and %d", maxRetentionDays), "code": "INVALID_REQUEST"})
+		return
+	}
+	now := time.Now()
+	input.UpdatedAt = &now
+	if err := retentionPolicies.set(currentTenant(c), input); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, input)
+}
+
+// GET /retention/deletions lista los borrados de los jobs del tenant, el
+// más reciente primero. Sale de los eventos purge de cada job, que se
+// conservan aunque se borre su transcripción.
+func retentionDeletionsHandler(c *gin.Context) {
+	limit := defaultRetentionDeletions
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxRetentionDeletions {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxRetentionDeletions), "code": "INVALID_REQUEST"})
+			return
+		}
+		limit = n
+	}
+	tenant := currentTenant(c)
+	deletions := []RetentionDeletion{}
+	mu.RLock()
+	for jobID, events := range jobEvents {
+		if meta, ok := jobMetas[jobID]; !ok || meta.Tenant != tenant {
+			continue
+		}
+		for _, e := range events {
+			if e.Type == EventPurge {
+				deletions = append(deletions, RetentionDeletion{JobID: jobID, Kind: e.Code, Message: e.Message, Timestamp: e.Timestamp})
+			}
+		}
+	}
+	mu.RUnlock()
+	sort.Slice(deletions, func(i, j int) bool { return deletions[i].Timestamp.After(deletions[j].Timestamp) })
+	if len(deletions) > limit {
+		deletions = deletions[:limit]
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"deletions": deletions})
+}
+
+// Borra el medio original de un job terminado si su tenant lo pide: la
+// descarga del gateway y la subida de upload_id. Llamarlo sin medio no hace nada.
+func applyMediaRetention(jobID string) {
+	job, ok := getJob(jobID)
+	meta, _ := getJobMeta(jobID)
+	if !ok || !isTerminalStatus(job.Status) || !retentionPolicies.get(meta.Tenant).DeleteMedia {
+		return
+	}
+	deleted, err := deleteJobMedia(jobID, meta)
+	if err != nil {
+		jobLogf(jobID, "⚠️ No se pudo borrar el medio del job %s: %v", jobID, err)
+		return
+	}
+	mu.Lock()
+	defer unlockJobs()
+	if m, ok := jobMetas[jobID]; ok {
+		m.MediaPath = ""
+	}
+	if deleted > 0 {
+		appendEventLocked(jobID, JobEvent{Type: EventPurge, Code: PurgeMedia, Message: "source media deleted by retention policy"})
+	}
+}
+
+// Borra la descarga del gateway y la subida de upload_id de un job;
+// devuelve cuántas de las dos existían
+func deleteJobMedia(jobID string, meta jobMeta) (int, error) {
+	deleted := 0
+	dir := filepath.Join(cfg.DownloadDir, jobID)
+	if _, err := os.Stat(dir); err == nil {
+		if err := os.RemoveAll(dir); err != nil {
+			return deleted, errors.Wrap(err, "failed to delete downloaded media")
+		}
+		deleted++
+	}
+	if meta.Input.UploadID != "" && presignedUploadIDPattern.MatchString(meta.Input.UploadID) {
+		key := presignedUploadKey(meta.Tenant, meta.Input.UploadID)
+		if _, err := artifacts.Stat(context.Background(), key); err == nil {
+			if err := artifacts.Delete(context.Background(), key); err != nil {
+				return deleted, errors.Wrap(err, "failed to delete uploaded media")
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Candidato del purgador: job terminado con texto o artefactos, más
+// antiguo que los días de su tenant
+func transcriptExpiredLocked(jobID string, job *JobState, now time.Time) (int, bool) {
+	meta, ok := jobMetas[jobID]
+	if !ok || job.PurgedAt != nil || !isTerminalStatus(job.Status) {
+		return 0, false
+	}
+	days := retentionPolicies.get(meta.Tenant).TranscriptDays
+	if days == 0 || now.Sub(job.Timestamp) < time.Duration(days)*24*time.Hour {
+		return 0, false
+	}
+	if job.Transcription == "" && job.Translation == "" && len(job.Segments) == 0 && len(job.Artifacts) == 0 {
+		return 0, false
+	}
+	return days, true
+}
+
+// Borra la transcripción, la traducción, los segmentos, los fragmentos y
+// los artefactos de un job; el job y su historial se conservan
+func purgeTranscript(jobID string, days int) error {
+	job, ok := getJob(jobID)
+	if !ok {
+		return nil
+	}
+	for _, a := range job.Artifacts {
+		if err := artifacts.Delete(context.Background(), artifactKey(jobID, a.Name)); err != nil {
+			return err
+		}
+	}
+	if stateStore != nil {
+		if err := stateStore.DeleteChunks(jobID); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	mu.Lock()
+	defer unlockJobs()
+	j, ok := jobStore[jobID]
+	if !ok {
+		return nil
+	}
+	j.Transcription, j.Translation, j.Segments, j.Chapters, j.Artifacts = "", "", nil, nil, nil
+	if meta, ok := jobMetas[jobID]; ok {
+		// Comentan y citan el texto borrado
+		meta.Annotations = nil
+	}
+	j.PurgedAt = &now
+	appendEventLocked(jobID, JobEvent{
+		Type:    EventPurge,
+		Code:    PurgeTranscript,
+		Message: fmt.Sprintf("transcript and %d artifacts deleted after %d days by retention policy", len(job.Artifacts), days),
+	})
+	return nil
+}
+
+// Una pasada del purgador; devuelve cuántos jobs purgó
+func purgeExpiredTranscripts() int {
+	if cfg.Role == RoleAPI {
+		// Los workers escriben los jobs; se parte del último estado
+		refreshAllJobs(context.Background())
+	}
+	now := time.Now()
+	expired := make(map[string]int)
+	mu.RLock()
+	for jobID, job := range jobStore {
+		if days, ok := transcriptExpiredLocked(jobID, job, now); ok {
+			expired[jobID] = days
+		}
+	}
+	mu.RUnlock()
+
+	purged := 0
+	for jobID, days := range expired {
+		if err := purgeTranscript(jobID, days); err != nil {
+			jobLogf(jobID, "⚠️ No se pudo purgar el job %s: %v", jobID, err)
+			continue
+		}
+		purged++
+	}
+	return purged
+}
+
+// Purgador en el líder cada RETENTION_INTERVAL
+func runRetentionPurger(ctx context.Context) {
+	ticker := time.NewTicker(cfg.RetentionInterval.Duration)
+	defer ticker.Stop()
+	for {
+		if n := purgeExpiredTranscripts(); n > 0 {
+			log.Printf("🚀 Retención: %d transcripciones borradas", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Opciones para repetir un segmento; vacías = las del job
+type RetranscribeBody struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"` // vocabulario o contexto para whisper
+}
+
+// POST /jobs/:job_id/segments/:seg_id/retranscribe transcribe de nuevo solo
+// el audio del segmento y lo sustituye en la transcripción guardada
+func retranscribeSegmentHandler(c *gin.Context) {
+	jobID := c.Param("job_id")
+	segID, err := strconv.Atoi(c.Param("seg_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "segment id must be an integer"})
+		return
+	}
+	var input RetranscribeBody
+	// Cuerpo opcional
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, exists := getJob(jobID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if job.Type != JobTypeTranscription || job.Status != "completed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "only completed jobs can be re-transcribed"})
+		return
+	}
+	seg, ok := findSegment(job.Segments, segID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "segment not found"})
+		return
+	}
+	meta, _ := getJobMeta(jobID)
+	model := input.Model
+	if model == "" {
+		model = meta.Input.Model
+	}
+	language := seg.Language
+	if language == "" {
+		language = job.Language
+	}
+	if code, err := validateRequestModel(meta.Tenant, RequestBody{Model: model, Language: language}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+
+	source, err := clipSource(jobID)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	defer applyMediaRetention(jobID)
+	clipPath := filepath.Join(filepath.Dir(source), fmt.Sprintf("retranscribe-%d.wav", segID))
+	if err := cutClip(source, clipPath, seg.Start, seg.End); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "RENDER_FAILED"})
+		return
+	}
+	defer os.Remove(clipPath)
+
+	payload := PythonRequest{
+		URL:       backendMediaURL(meta.Input.URL),
+		FilePath:  backendPath(clipPath),
+		Language:  language,
+		Model:     model,
+		Prompt:    input.Prompt,
+		RequestID: requestID(c),
+		JobID:     jobID,
+	}
+	if custom, _ := lookupModel(meta.Tenant, model); custom != nil {
+		payload.Model = custom.backendModel()
+		payload.Backend = custom.Backend
+	} else {
+		// Con la duración del job: el segmento va a los backends de su regla
+		route(RoutingInput{
+			Tenant:   meta.Tenant,
+			Language: language,
+			Model:    model,
+			Duration: job.Duration,
+			Accuracy: meta.Input.Accuracy,
+		}).apply(&payload)
+	}
+	result, fallbackModel, err := transcribeWithFallback(c.Request.Context(), jobID, payload)
+	if err != nil {
+		code := "BACKEND_ERROR"
+		var berr *backendError
+		if errors.As(err, &berr) {
+			code = berr.code
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+	if result.Language == "" {
+		result.Language = language
+	}
+	formatted := meta.Input.Format.apply(*result, result.Language)
+	replacement := mergeRetranscribed(seg, formatted)
+
+	var updated bool
+	updateJob(jobID, func(job *JobState) {
+		// El job pudo editarse mientras tanto; se busca de nuevo
+		for i := range job.Segments {
+			if job.Segments[i].ID == segID {
+				job.Segments[i] = replacement
+				updated = true
+			}
+		}
+		if !updated {
+			return
+		}
+		texts := make([]string, 0, len(job.Segments))
+		for _, s := range job.Segments {
+			if t := strings.TrimSpace(s.Text); t != "" {
+				texts = append(texts, t)
+			}
+		}
+		job.Transcription = strings.Join(texts, " ")
+		job.Stats = computeStats(&BackendResponse{
+			Transcription: job.Transcription,
+			Language:      job.Language,
+			Segments:      job.Segments,
+		}, job.Duration)
+	})
+	if !updated {
+		c.JSON(http.StatusNotFound, gin.H{"error": "segment not found"})
+		return
+	}
+	message := fmt.Sprintf("segment %d re-transcribed", segID)
+	if fallbackModel != "" {
+		model = fallbackModel
+	}
+	if model != "" {
+		message += " with model " + model
+	}
+	recordEvent(jobID, JobEvent{Type: EventEdit, Message: message})
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"job_id": jobID, "segment": replacement})
+}
+
+// Un único segmento con el ID y los límites del original; las palabras se
+// desplazan al tiempo del job
+func mergeRetranscribed(original Segment, result BackendResponse) Segment {
+	merged := Segment{
+		ID:       original.ID,
+		Start:    original.Start,
+		End:      original.End,
+		Language: original.Language,
+		Speaker:  original.Speaker,
+	}
+	var texts []string
+	for _, s := range result.Segments {
+		if t := strings.TrimSpace(s.Text); t != "" {
+			texts = append(texts, t)
+		}
+		for _, w := range s.Words {
+			w.Start += original.Start
+			w.End += original.Start
+			merged.Words = append(merged.Words, w)
+		}
+	}
+	merged.Text = strings.Join(texts, " ")
+	if len(result.Segments) == 1 {
+		merged.AvgLogprob, merged.NoSpeechProb = result.Segments[0].AvgLogprob, result.Segments[0].NoSpeechProb
+	}
+	if merged.Text == "" {
+		merged.Text = strings.TrimSpace(result.Transcription)
+	}
+	return merged
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Estados de la revisión humana de un job completado con review = true
+const (
+	ReviewNeeded     = "needs_review"
+	ReviewInProgress = "in_review"
+	ReviewApproved   = "approved"
+)
+
+// Revisión de un job; el status del job sigue en completed
+type JobReview struct {
+	Status     string     `json:"status"`             // needs_review, in_review o approved
+	Assignee   string     `json:"assignee,omitempty"` // quien revisa (o revisó)
+	ClaimedAt  *time.Time `json:"claimed_at,omitempty"`
+	ApprovedBy string     `json:"approved_by,omitempty"`
+	ApprovedAt *time.Time `json:"approved_at,omitempty"`
+}
+
+var (
+	errReviewNotRequested = errors.New("job does not require review")
+	errReviewClaimed      = errors.New("review is claimed by another assignee")
+	errReviewNotClaimed   = errors.New("review must be claimed first")
+	errReviewApproved     = errors.New("job is already approved")
+)
+
+func validateReviewStatus(status string) error {
+	switch status {
+	case "", ReviewNeeded, ReviewInProgress, ReviewApproved:
+		return nil
+	}
+	return errors.New("unknown review_status")
+}
+
+// Revisión inicial de un job que acaba de completarse
+func newReview(input RequestBody) *JobReview {
+	if !input.Review {
+		return nil
+	}
+	return &JobReview{Status: ReviewNeeded}
+}
+
+// Revisor de la petición: el nombre de la API key (o de la sesión OIDC).
+// No se acepta del cliente, así nadie revisa en nombre de otro
+func reviewAssignee(c *gin.Context) string {
+	if key := currentAPIKey(c); key != nil {
+		return key.Name
+	}
+	return "anonymous"
+}
+
+// Aplica una transición de la revisión bajo mu y la guarda con su evento
+func transitionReview(jobID string, fn func(review *JobReview) (string, error)) (JobReview, bool, error) {
+	mu.Lock()
+	defer unlockJobs()
+	job, ok := jobStore[jobID]
+	if !ok {
+		return JobReview{}, false, nil
+	}
+	if job.Review == nil {
+		return JobReview{}, true, errReviewNotRequested
+	}
+	next := *job.Review
+	message, err := fn(&next)
+	if err != nil {
+		return *job.Review, true, err
+	}
+	if message != "" {
+		job.Review = &next
+		appendEventLocked(jobID, JobEvent{Type: EventReview, Status: next.Status, Message: message})
+	}
+	return next, true, nil
+}
+
+// Respuesta común de los endpoints de revisión
+func respondReview(c *gin.Context, review JobReview, found bool, err error) {
+	switch {
+	case !found:
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+	case err != nil:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "REVIEW_CONFLICT"})
+	default:
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.JSON(http.StatusOK, review)
+	}
+}
+
+// POST /jobs/:job_id/review/claim asigna la revisión; repetirlo con el
+// mismo revisor no cambia nada
+func claimReviewHandler(c *gin.Context) {
+	assignee := reviewAssignee(c)
+	review, found, err := transitionReview(c.Param("job_id"), func(r *JobReview) (string, error) {
+		switch r.Status {
+		case ReviewApproved:
+			return "", errReviewApproved
+		case ReviewInProgress:
+			if r.Assignee != assignee {
+				return "", errReviewClaimed
+			}
+			return "", nil
+		}
+		now := time.Now()
+		r.Status = ReviewInProgress
+		r.Assignee = assignee
+		r.ClaimedAt = &now
+		return fmt.Sprintf("review claimed by %s", assignee), nil
+	})
+	respondReview(c, review, found, err)
+}
+
+// POST /jobs/:job_id/review/release devuelve la revisión a needs_review
+func releaseReviewHandler(c *gin.Context) {
+	assignee := reviewAssignee(c)
+	review, found, err := transitionReview(c.Param("job_id"), func(r *JobReview) (string, error) {
+		switch {
+		case r.Status == ReviewApproved:
+			return "", errReviewApproved
+		case r.Status != ReviewInProgress:
+			return "", errReviewNotClaimed
+		case r.Assignee != assignee:
+			return "", errReviewClaimed
+		}
+		r.Status = ReviewNeeded
+		r.Assignee = ""
+		r.ClaimedAt = nil
+		return fmt.Sprintf("review released by %s", assignee), nil
+	})
+	respondReview(c, review, found, err)
+}
+
+// POST /jobs/:job_id/review/approve aprueba un job; solo puede hacerlo
+// quien tiene asignada la revisión
+func approveReviewHandler(c *gin.Context) {
+	assignee := reviewAssignee(c)
+	review, found, err := transitionReview(c.Param("job_id"), func(r *JobReview) (string, error) {
+		switch {
+		case r.Status == ReviewApproved:
+			return "", errReviewApproved
+		case r.Status != ReviewInProgress:
+			return "", errReviewNotClaimed
+		case r.Assignee != assignee:
+			return "", errReviewClaimed
+		}
+		now := time.Now()
+		r.Status = ReviewApproved
+		r.ApprovedBy = assignee
+		r.ApprovedAt = &now
+		return fmt.Sprintf("approved by %s", assignee), nil
+	})
+	respondReview(c, review, found, err)
+}
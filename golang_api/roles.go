@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Papeles del proceso (ROLE o --role). Con api y worker el almacén de
+// estado es la única fuente de verdad: la API escribe los jobs en queued y
+// los workers los reclaman, así que ambos escalan por separado. No se deben
+// mezclar procesos all y worker sobre el mismo almacén.
+const (
+	RoleAll    = "all"    // API y ejecución de jobs en el mismo proceso
+	RoleAPI    = "api"    // solo encola y lee
+	RoleWorker = "worker" // reclama jobs y los ejecuta, sin API HTTP
+)
+
+// Reemplaza la copia en memoria por la del almacén. El outbox se conserva
+// si el job es de este proceso; si no, se carga pero lo entrega su dueño.
+// Requiere mu tomado.
+func loadJobRecordLocked(rec JobRecord) {
+	_, known := jobStore[rec.ID]
+	owned := known && !unadoptedJobs[rec.ID]
+	job := rec.Job
+	meta := rec.Meta
+	jobStore[rec.ID] = &job
+	jobMetas[rec.ID] = &meta
+	jobEvents[rec.ID] = rec.Events
+	if owned {
+		return
+	}
+	unadoptedJobs[rec.ID] = true
+	if len(rec.Outbox) > 0 {
+		jobOutbox[rec.ID] = rec.Outbox
+	} else {
+		delete(jobOutbox, rec.ID)
+	}
+}
+
+// Relee un job del almacén; con ROLE=api lo escriben los workers. Si falla
+// se sigue con la copia en memoria; el error solo importa si venció ctx.
+func refreshJob(ctx context.Context, jobID string) error {
+	rec, err := stateStore.LoadJob(ctx, jobID)
+	if err != nil {
+		log.Printf("⚠️ No se pudo releer el job %s: %v", jobID, err)
+		return err
+	}
+	mu.Lock()
+	defer unlockJobs()
+	if rec == nil {
+		// Borrado en otra réplica (POST /admin/erasure)
+		if unadoptedJobs[jobID] {
+			forgetJobLocked(jobID)
+		}
+		return nil
+	}
+	loadJobRecordLocked(*rec)
+	return nil
+}
+
+func refreshAllJobs(ctx context.Context) error {
+	records, err := stateStore.LoadJobs(ctx)
+	if err != nil {
+		log.Printf("⚠️ No se pudieron releer los jobs: %v", err)
+		return err
+	}
+	mu.Lock()
+	for _, rec := range records {
+		loadJobRecordLocked(rec)
+	}
+	unlockJobs()
+	return nil
+}
+
+// Con ROLE=api relee del almacén lo que va a servir la petición: el job de
+// la ruta, el listado de jobs o los webhooks (los puede cambiar otra réplica).
+// Si la lectura agota el plazo de la ruta responde 504 sin llegar al handler.
+func storeReadMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var err error
+		switch path := c.FullPath(); {
+		case c.Param("job_id") != "":
+			err = refreshJob(c.Request.Context(), c.Param("job_id"))
+		case path == "/jobs" || path == "/jobs/feed":
+			err = refreshAllJobs(c.Request.Context())
+		case path == "/webhooks" || strings.HasPrefix(path, "/webhooks/"):
+			if err := webhooks.restore(); err != nil {
+				log.Printf("⚠️ No se pudieron releer los webhooks: %v", err)
+			}
+		}
+		if abortOnDeadline(c, err) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// Jobs cuya concesión perdió este worker: otro los reclamó y los ejecuta.
+// Se siguen ejecutando aquí hasta terminar, pero ya no se persisten ni se
+// entregan sus eventos. Protegido por mu.
+var fencedJobs = make(map[string]bool)
+
+// Jobs que este worker ya soltó; salen de memoria en cuanto se vacía su
+// outbox. Protegido por mu.
+var releasedJobs = make(map[string]bool)
+
+// Olvida un job soltado sin entregas pendientes: la copia buena es la del
+// almacén. Requiere mu tomado.
+func evictReleasedJobLocked(jobID string) {
+	if releasedJobs[jobID] && len(jobOutbox[jobID]) == 0 {
+		forgetJobLocked(jobID)
+	}
+}
+
+// Jobs que ejecuta este worker, con la última renovación de su concesión
+type workerClaims struct {
+	mu     sync.Mutex
+	claims map[string]time.Time
+	wake   chan struct{} // se liberó un hueco
+}
+
+var claims = &workerClaims{claims: make(map[string]time.Time), wake: make(chan struct{}, 1)}
+
+func (w *workerClaims) active() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.claims)
+}
+
+func (w *workerClaims) renewed(jobID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.claims[jobID] = time.Now()
+}
+
+// Última renovación; false si el job ya no está en curso
+func (w *workerClaims) lastRenewal(jobID string) (time.Time, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	t, ok := w.claims[jobID]
+	return t, ok
+}
+
+func (w *workerClaims) remove(jobID string) {
+	w.mu.Lock()
+	delete(w.claims, jobID)
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *workerClaims) list() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ids := make([]string, 0, len(w.claims))
+	for id := range w.claims {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Bucle de ROLE=worker: reclama jobs mientras tenga huecos (WORKERS) y los
+// ejecuta. No vuelve.
+func runWorker() {
+	log.Printf("🚀 Worker %s reclamando jobs", cfg.WorkerID)
+	go runClaimHeartbeats()
+	ticker := time.NewTicker(cfg.ClaimPollInterval.Duration)
+	defer ticker.Stop()
+	for {
+		// Los webhooks los gestiona la API; se necesitan para encolar entregas
+		if err := webhooks.restore(); err != nil {
+			log.Printf("⚠️ No se pudieron releer los webhooks: %v", err)
+		}
+		// Con la cola pausada los jobs se quedan en el almacén para cualquier worker
+		for !queuePaused() && claims.active() < live().Workers {
+			rec, expired, err := stateStore.ClaimJob(cfg.WorkerID, cfg.ClaimLeaseTTL.Duration)
+			if err != nil {
+				log.Printf("⚠️ No se pudo reclamar un job: %v", err)
+				break
+			}
+			if rec == nil {
+				break
+			}
+			claims.renewed(rec.ID)
+			go runClaimedJob(*rec, expired)
+		}
+		select {
+		case <-ticker.C:
+		case <-claims.wake:
+		}
+	}
+}
+
+// expired es la concesión caducada del worker anterior, si la había
+func runClaimedJob(rec JobRecord, expired *JobClaim) {
+	defer claims.remove(rec.ID)
+	mu.Lock()
+	delete(unadoptedJobs, rec.ID)
+	delete(fencedJobs, rec.ID)
+	delete(releasedJobs, rec.ID)
+	jobStore[rec.ID] = &rec.Job
+	jobMetas[rec.ID] = &rec.Meta
+	jobEvents[rec.ID] = rec.Events
+	if len(rec.Outbox) > 0 {
+		jobOutbox[rec.ID] = rec.Outbox
+	}
+	unlockJobs()
+	// Entregas que dejó pendientes la API al encolar el job
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+
+	if expired != nil {
+		jobLogf(rec.ID, "🚀 Job %s reclamado tras caducar la concesión de %s", rec.ID, expired.WorkerID)
+		recordEvent(rec.ID, JobEvent{Type: EventRetry, Message: fmt.Sprintf("resumed after lease of worker %s expired", expired.WorkerID)})
+	} else {
+		jobLogf(rec.ID, "🚀 Job %s reclamado", rec.ID)
+	}
+	input := rec.Meta.Input
+	if input.Type == JobTypeBurnSubtitles {
+		refreshJob(context.Background(), input.TranscriptJobID)
+	}
+	runJob(rec.ID, input, findAPIKeyByName(rec.Job.APIKey), false)
+
+	mu.Lock()
+	fenced := fencedJobs[rec.ID]
+	if fenced {
+		// La copia buena es la del worker que lo reclamó
+		forgetJobLocked(rec.ID)
+	}
+	unlockJobs()
+	if fenced {
+		return
+	}
+	if err := stateStore.ReleaseClaim(rec.ID, cfg.WorkerID); err != nil {
+		jobLogf(rec.ID, "⚠️ No se pudo soltar el job %s: %v", rec.ID, err)
+	}
+	mu.Lock()
+	releasedJobs[rec.ID] = true
+	evictReleasedJobLocked(rec.ID)
+	unlockJobs()
+}
+
+// Renueva las concesiones de los jobs en curso cada ClaimLeaseTTL/3. Si una
+// se perdió, o lleva un TTL sin renovarse y otro worker pudo tomarla, el job
+// deja de escribir en el almacén.
+func runClaimHeartbeats() {
+	ticker := time.NewTicker(cfg.ClaimLeaseTTL.Duration / 3)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, jobID := range claims.list() {
+			err := stateStore.RenewClaim(jobID, cfg.WorkerID, cfg.ClaimLeaseTTL.Duration)
+			switch {
+			case err == nil:
+				claims.renewed(jobID)
+			case errors.Is(err, errClaimLost):
+				fenceJob(jobID, "otro worker reclamó el job")
+			default:
+				jobLogf(jobID, "⚠️ No se pudo renovar el job %s: %v", jobID, err)
+				if last, ok := claims.lastRenewal(jobID); ok && time.Since(last) >= cfg.ClaimLeaseTTL.Duration {
+					fenceJob(jobID, "la concesión caducó sin poder renovarla")
+				}
+			}
+		}
+	}
+}
+
+func fenceJob(jobID, reason string) {
+	mu.Lock()
+	defer unlockJobs()
+	if fencedJobs[jobID] {
+		return
+	}
+	jobLogfLocked(jobID, "⚠️ El worker %s deja el job %s: %s", cfg.WorkerID, jobID, reason)
+	fencedJobs[jobID] = true
+	unadoptedJobs[jobID] = true
+}
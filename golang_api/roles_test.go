@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Con ROLE=worker un job soltado sigue en memoria hasta entregar su outbox
+func TestReleasedJobEvictedAfterOutbox(t *testing.T) {
+	msg := OutboxMessage{ID: "evict-msg", Kind: OutboxBus, Event: "job.completed"}
+	mu.Lock()
+	jobStore["evict-job"] = &JobState{Type: JobTypeTranscription, Status: "completed", Timestamp: time.Now()}
+	jobMetas["evict-job"] = &jobMeta{}
+	jobOutbox["evict-job"] = []OutboxMessage{msg}
+	releasedJobs["evict-job"] = true
+	evictReleasedJobLocked("evict-job")
+	_, kept := jobStore["evict-job"]
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		forgetJobLocked("evict-job")
+		mu.Unlock()
+	})
+	if !kept {
+		t.Fatal("job evicted with a pending outbox message")
+	}
+
+	if !settleOutbox(outboxItem{jobID: "evict-job", msg: msg}, "", nil) {
+		t.Fatal("message not settled")
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if _, ok := jobStore["evict-job"]; ok {
+		t.Error("job still in memory after its outbox was delivered")
+	}
+	if releasedJobs["evict-job"] || jobMetas["evict-job"] != nil || jobEvents["evict-job"] != nil {
+		t.Error("released job left state behind")
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Regla de backend_routing: los jobs que cumplen todas sus condiciones van
+// solo a sus backends y, con model, con ese modelo (p. ej. el yorùbá afinado
+// o el large en la GPU grande). Las condiciones vacías no filtran; gana la
+// primera regla que se cumple y, sin ninguna, el job va a todo el pool.
+type RoutingRule struct {
+	Name string `json:"name"`
+
+	// Condiciones
+	Languages   []string `json:"languages,omitempty"`
+	Tenants     []string `json:"tenants,omitempty"`
+	Models      []string `json:"models,omitempty"` // modelo solicitado
+	MinDuration Duration `json:"min_duration,omitempty"`
+	MaxDuration Duration `json:"max_duration,omitempty"`
+	Accuracy    string   `json:"accuracy,omitempty"`
+	Diarize     *bool    `json:"diarize,omitempty"`
+
+	// Destino
+	Backends []string `json:"backends"`        // URLs de WHISPER_BACKENDS
+	Model    string   `json:"model,omitempty"` // modelo que se pide a esos backends; vacío = el solicitado
+}
+
+// Lo que las reglas miran de un job
+type RoutingInput struct {
+	Tenant   string  `json:"tenant,omitempty"`
+	Language string  `json:"language,omitempty"` // vacío = sin indicar ni detectar
+	Model    string  `json:"model,omitempty"`
+	Duration float64 `json:"duration_seconds"` // 0 = sin sondear
+	Accuracy string  `json:"accuracy,omitempty"`
+	Diarize  bool    `json:"diarize,omitempty"`
+}
+
+type RuleEvaluation struct {
+	Rule    string `json:"rule"`
+	Matched bool   `json:"matched"`
+	Reason  string `json:"reason"` // la primera condición que no se cumple
+}
+
+type RoutingDecision struct {
+	Rule        string           `json:"rule,omitempty"` // vacío = ninguna regla: todo el pool
+	Backends    []string         `json:"backends"`
+	Model       string           `json:"model,omitempty"`
+	Evaluations []RuleEvaluation `json:"evaluations"`
+}
+
+func validateRoutingRules(rules []RoutingRule, pool []string) error {
+	names := make(map[string]bool)
+	for i := range rules {
+		r := &rules[i]
+		if r.Name == "" {
+			return errors.Errorf("rule %d has no name", i)
+		}
+		if names[r.Name] {
+			return errors.Errorf("duplicate rule %q", r.Name)
+		}
+		names[r.Name] = true
+		if len(r.Backends) == 0 {
+			return errors.Errorf("rule %q has no backends", r.Name)
+		}
+		for j, u := range r.Backends {
+			r.Backends[j] = strings.TrimRight(u, "/")
+			if !containsString(pool, r.Backends[j]) {
+				return errors.Errorf("rule %q: backend %s is not in WHISPER_BACKENDS", r.Name, u)
+			}
+		}
+		if r.MinDuration.Duration < 0 || r.MaxDuration.Duration < 0 {
+			return errors.Errorf("rule %q: durations must not be negative", r.Name)
+		}
+		if r.MaxDuration.Duration > 0 && r.MaxDuration.Duration < r.MinDuration.Duration {
+			return errors.Errorf("rule %q: max_duration is below min_duration", r.Name)
+		}
+		if err := validateAccuracy(r.Accuracy); err != nil {
+			return errors.Wrapf(err, "rule %q", r.Name)
+		}
+		if !isBuiltinModel(r.Model) {
+			return errors.Errorf("rule %q: model must be one of %s", r.Name, strings.Join(whisperModels, ", "))
+		}
+		r.Model = strings.ToLower(r.Model)
+	}
+	return nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Por qué el job no cumple la regla; vacío si la cumple
+func (r RoutingRule) mismatch(in RoutingInput) string {
+	switch {
+	case len(r.Tenants) > 0 && !containsString(r.Tenants, in.Tenant):
+		return fmt.Sprintf("tenant %q is not in %s", in.Tenant, strings.Join(r.Tenants, ", "))
+	case len(r.Languages) > 0 && in.Language == "":
+		return "language is neither requested nor detected"
+	case len(r.Languages) > 0 && !containsFold(r.Languages, in.Language):
+		return fmt.Sprintf("language %q is not in %s", in.Language, strings.Join(r.Languages, ", "))
+	case len(r.Models) > 0 && !containsFold(r.Models, in.Model):
+		return fmt.Sprintf("model %q is not in %s", in.Model, strings.Join(r.Models, ", "))
+	case (r.MinDuration.Duration > 0 || r.MaxDuration.Duration > 0) && in.Duration <= 0:
+		return "media duration is unknown"
+	case r.MinDuration.Duration > 0 && in.Duration < r.MinDuration.Seconds():
+		return fmt.Sprintf("duration %.0fs is below min_duration %s", in.Duration, r.MinDuration.Duration)
+	case r.MaxDuration.Duration > 0 && in.Duration > r.MaxDuration.Seconds():
+		return fmt.Sprintf("duration %.0fs is above max_duration %s", in.Duration, r.MaxDuration.Duration)
+	case r.Accuracy != "" && r.Accuracy != accuracyOrDefault(in.Accuracy):
+		return fmt.Sprintf("accuracy is %s, not %s", accuracyOrDefault(in.Accuracy), r.Accuracy)
+	case r.Diarize != nil && *r.Diarize != in.Diarize:
+		return fmt.Sprintf("diarize is %t", in.Diarize)
+	}
+	return ""
+}
+
+func accuracyOrDefault(accuracy string) string {
+	if accuracy == "" {
+		return AccuracyStandard
+	}
+	return accuracy
+}
+
+// Evalúa backend_routing en orden; las reglas tras la elegida no se miran
+func route(in RoutingInput) RoutingDecision {
+	decision := RoutingDecision{Backends: live().WhisperBackends, Evaluations: []RuleEvaluation{}}
+	for _, r := range live().BackendRouting {
+		reason := r.mismatch(in)
+		if reason != "" {
+			decision.Evaluations = append(decision.Evaluations, RuleEvaluation{Rule: r.Name, Reason: reason})
+			continue
+		}
+		decision.Evaluations = append(decision.Evaluations, RuleEvaluation{Rule: r.Name, Matched: true, Reason: "all conditions hold"})
+		decision.Rule = r.Name
+		decision.Backends = r.Backends
+		decision.Model = r.Model
+		break
+	}
+	return decision
+}
+
+// Lleva la decisión a la petición al backend. Un modelo propio ya fija su
+// backend y no se enruta.
+func (d RoutingDecision) apply(payload *PythonRequest) {
+	if payload.Backend != "" || d.Rule == "" {
+		return
+	}
+	payload.Backends = d.Backends
+	if d.Model != "" {
+		payload.Model = d.Model
+		payload.RouteModel = d.Model
+	}
+}
+
+// Petición de POST /admin/routing/explain: un job existente o los datos de
+// uno hipotético
+type RoutingExplainBody struct {
+	JobID string `json:"job_id"` // si se indica, el resto se ignora
+	RoutingInput
+}
+
+type RoutingExplanation struct {
+	Input RoutingInput `json:"input"`
+	RoutingDecision
+	CustomModel string `json:"custom_model,omitempty"` // modelo propio: va a su backend sin mirar las reglas
+	Backend     string `json:"backend,omitempty"`      // el que se elegiría ahora; vacío si están llenos
+
+	// Con job_id: dónde se ejecutó y con qué regla
+	JobBackend     string `json:"job_backend,omitempty"`
+	JobRoutingRule string `json:"job_routing_rule,omitempty"`
+}
+
+// POST /admin/routing/explain muestra qué regla de backend_routing se
+// aplicaría y por qué no se cumplen las anteriores
+func explainRoutingHandler(c *gin.Context) {
+	var body RoutingExplainBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_REQUEST"})
+		return
+	}
+	var result RoutingExplanation
+	in := body.RoutingInput
+	if body.JobID != "" {
+		job, ok := getJob(body.JobID)
+		meta, hasMeta := getJobMeta(body.JobID)
+		if !ok || !hasMeta {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+		in = RoutingInput{
+			Tenant:   meta.Tenant,
+			Language: meta.Input.Language,
+			Model:    meta.Input.Model,
+			Duration: job.Duration,
+			Accuracy: meta.Input.Accuracy,
+			Diarize:  meta.Input.Diarize,
+		}
+		// El job enrutó con el idioma detectado para only_if_language
+		if in.Language == "" && len(meta.Input.OnlyIfLanguage) > 0 {
+			in.Language = job.Language
+		}
+		result.JobBackend = job.Backend
+		result.JobRoutingRule = job.RoutingRule
+	} else {
+		if in.Tenant == "" {
+			in.Tenant = currentTenant(c)
+		}
+		if err := validateAccuracy(in.Accuracy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_REQUEST"})
+			return
+		}
+		if in.Duration < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "duration_seconds must not be negative", "code": "INVALID_REQUEST"})
+			return
+		}
+	}
+	result.Input = in
+	result.RoutingDecision = route(in)
+	if custom, _ := lookupModel(in.Tenant, in.Model); custom != nil {
+		result.CustomModel = custom.Name
+		result.Rule = ""
+		result.Backends = []string{custom.Backend}
+		result.Model = custom.backendModel()
+	}
+	result.Backend = backends.peekIn(result.Backends)
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, result)
+}
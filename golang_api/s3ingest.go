@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/pkg/errors"
+)
+
+// Sufijos de lo que se escribe junto al objeto de origen
+const (
+	s3ResultSuffix = ".transcript.json" // job completado, como GET /result
+	s3ErrorSuffix  = ".error.json"      // job fallido
+)
+
+// Espera larga de ReceiveMessage (máximo de SQS) y pausa tras un error
+const (
+	sqsWaitSeconds     = 20
+	s3IngestRetryDelay = 5 * time.Second
+)
+
+// Los IDs de los jobs de la ingesta salen del evento, para que una entrega
+// repetida de SQS no cree otro job
+var s3IngestNamespace = uuid.MustParse("5b0e7a52-1f0c-4c43-9d3c-7f3f29a6c1e4")
+
+// Cliente del bucket de origen y de la cola SQS
+type s3Ingester struct {
+	client   *minio.Client
+	endpoint string // raíz del servicio SQS de la cola
+	http     *http.Client
+}
+
+// nil sin S3_INGEST_QUEUE_URL
+var s3Ingest *s3Ingester
+
+func newS3Ingester() (*s3Ingester, error) {
+	client, err := minio.New(cfg.S3Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, ""),
+		Secure: cfg.S3UseSSL,
+		Region: cfg.S3Region,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create S3 ingest client")
+	}
+	u, err := url.Parse(cfg.S3IngestQueueURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid S3 ingest queue URL")
+	}
+	return &s3Ingester{
+		client:   client,
+		endpoint: u.Scheme + "://" + u.Host + "/",
+		http:     &http.Client{Timeout: (sqsWaitSeconds + 10) * time.Second},
+	}, nil
+}
+
+type sqsMessage struct {
+	MessageID     string `json:"MessageId"`
+	ReceiptHandle string `json:"ReceiptHandle"`
+	Body          string `json:"Body"`
+}
+
+// Llamada al protocolo JSON de SQS firmada con SigV4
+func (s *s3Ingester) sqs(ctx context.Context, action string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal SQS request")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create SQS request")
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	signAWSRequest(req, body, "sqs", s3Credentials(), time.Now())
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "SQS %s failed", action)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return errors.Wrapf(err, "failed to read SQS %s response", action)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &apiErr)
+		return errors.Errorf("SQS %s failed with status %d: %s %s", action, resp.StatusCode, apiErr.Type, apiErr.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return errors.Wrapf(err, "invalid SQS %s response", action)
+	}
+	return nil
+}
+
+// Credenciales de una petición firmada con SigV4
+type awsCredentials struct {
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string // de credenciales temporales (STS)
+}
+
+func s3Credentials() awsCredentials {
+	return awsCredentials{Region: cfg.S3Region, AccessKey: cfg.S3AccessKey, SecretKey: cfg.S3SecretKey}
+}
+
+// Firma AWS Signature Version 4 en la cabecera Authorization
+func signAWSRequest(req *http.Request, body []byte, service string, creds awsCredentials, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + creds.Region + "/" + service + "/aws4_request"
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalPath := req.URL.EscapedPath()
+	if canonicalPath == "" {
+		canonicalPath = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath,
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + creds.SecretKey)
+	for _, part := range []string{amzDate[:8], creds.Region, service, "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKey, scope, signedHeaders, hex.EncodeToString(key)))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Notificación de S3; llega tal cual o dentro de una de SNS
+type s3Event struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key       string `json:"key"` // codificada como en una query
+				Size      int64  `json:"size"`
+				Sequencer string `json:"sequencer"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+	Event   string `json:"Event"`   // s3:TestEvent al configurar la notificación
+	Type    string `json:"Type"`    // Notification si viene de SNS
+	Message string `json:"Message"` // evento de S3 dentro de SNS
+}
+
+// Escucha la cola en el líder y crea un job por cada medio nuevo
+func runS3Ingest(ctx context.Context) {
+	for ctx.Err() == nil {
+		var out struct {
+			Messages []sqsMessage `json:"Messages"`
+		}
+		err := s3Ingest.sqs(ctx, "ReceiveMessage", map[string]interface{}{
+			"QueueUrl":            cfg.S3IngestQueueURL,
+			"MaxNumberOfMessages": 10,
+			"WaitTimeSeconds":     sqsWaitSeconds,
+		}, &out)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("⚠️ No se pudo leer la cola de ingesta de S3: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s3IngestRetryDelay):
+			}
+			continue
+		}
+		for _, m := range out.Messages {
+			if err := ingestS3Message(m.Body); err != nil {
+				// Se queda en la cola: tras maxReceiveCount va a la DLQ
+				log.Printf("⚠️ Mensaje %s de la ingesta de S3 no procesado: %v", m.MessageID, err)
+				continue
+			}
+			if err := s3Ingest.sqs(ctx, "DeleteMessage", map[string]string{
+				"QueueUrl":      cfg.S3IngestQueueURL,
+				"ReceiptHandle": m.ReceiptHandle,
+			}, nil); err != nil {
+				// Se volverá a recibir, pero el job ya existe con el mismo ID
+				log.Printf("⚠️ No se pudo borrar el mensaje %s de la cola de ingesta: %v", m.MessageID, err)
+			}
+		}
+	}
+}
+
+func ingestS3Message(body string) error {
+	var event s3Event
+	if err := json.Unmarshal([]byte(body), &event); err != nil {
+		return errors.Wrap(err, "invalid S3 event")
+	}
+	if event.Type == "Notification" && event.Message != "" {
+		if err := json.Unmarshal([]byte(event.Message), &event); err != nil {
+			return errors.Wrap(err, "invalid S3 event in SNS notification")
+		}
+	}
+	for _, r := range event.Records {
+		if !strings.HasPrefix(r.EventName, "ObjectCreated:") || r.S3.Bucket.Name != cfg.S3IngestBucket {
+			continue
+		}
+		key, err := url.QueryUnescape(r.S3.Object.Key)
+		if err != nil {
+			return errors.Wrapf(err, "invalid object key %q", r.S3.Object.Key)
+		}
+		if !strings.HasPrefix(key, cfg.S3IngestPrefix) || !isIngestMedia(key) {
+			continue
+		}
+		source := &jobSource{Kind: SourceS3, Bucket: r.S3.Bucket.Name, Key: key}
+		if cfg.MaxDownloadMB > 0 && r.S3.Object.Size > cfg.MaxDownloadMB*1024*1024 {
+			log.Printf("⚠️ Ingesta de S3: %s supera %d MB, no se procesa", source, cfg.MaxDownloadMB)
+			continue
+		}
+		input := RequestBody{}
+		if cfg.S3IngestTemplate != "" {
+			if _, err := applyTemplate(cfg.S3IngestTenant, cfg.S3IngestTemplate, &input); err != nil {
+				return err
+			}
+		}
+		input.Type = JobTypeTranscription
+		input.Metadata = map[string]string{"s3_bucket": source.Bucket}
+		if len(key) <= maxMetadataValueLength {
+			input.Metadata["s3_key"] = key
+		}
+		jobID := uuid.NewSHA1(s3IngestNamespace, []byte(source.String()+"@"+r.S3.Object.Sequencer)).String()
+		if createSourcedJob(jobID, cfg.S3IngestTenant, input, source) {
+			jobLogf(jobID, "🚀 Job %s creado desde %s", jobID, source)
+		}
+	}
+	return nil
+}
+
+// Escribe junto al objeto el resultado del job completado o el error
+func writeS3Result(jobID string, job JobState, source *jobSource, event string) (string, error) {
+	if s3Ingest == nil {
+		return "", errOutboxDiscard
+	}
+	var body interface{} = job
+	key := source.Key + s3ResultSuffix
+	if event == WebhookJobFailed {
+		key = source.Key + s3ErrorSuffix
+		body = map[string]string{"job_id": jobID, "status": job.Status, "error_code": job.ErrorCode, "error": job.Error}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", errOutboxDiscard
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.IntegrationTimeout.Duration)
+	defer cancel()
+	_, err = s3Ingest.client.PutObject(ctx, source.Bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/json; charset=utf-8"})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to write result to source bucket")
+	}
+	return "wrote " + (&jobSource{Kind: SourceS3, Bucket: source.Bucket, Key: key}).String(), nil
+}
+
+// Enlace firmado y nuevo al objeto de origen
+func s3SourceURL(ctx context.Context, source *jobSource) (string, error) {
+	if s3Ingest == nil {
+		return "", errors.New("S3 ingestion is not configured")
+	}
+	link, err := s3Ingest.client.PresignedGetObject(ctx, source.Bucket, source.Key, cfg.UploadURLTTL.Duration, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to sign source object URL")
+	}
+	return link.String(), nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Backend con el que figuran los jobs de las keys de sandbox
+const sandboxBackend = "sandbox"
+
+// Duración de cada segmento de una transcripción de sandbox, en segundos
+const sandboxSegmentSeconds = 4.0
+
+// Frases de las transcripciones de sandbox. Cada posición es la misma frase
+// en los tres idiomas: la inglesa sirve de traducción. Otros idiomas usan
+// las inglesas.
+var sandboxPhrases = map[string][]string{
+	"en": {
+		"Welcome to the transcription sandbox.",
+		"This transcript was generated without any audio.",
+		"The same request always returns the same text.",
+		"No GPU time was used for this job.",
+		"Use a live API key to transcribe real media.",
+		"Every segment lasts exactly four seconds.",
+	},
+	"es": {
+		"Bienvenido al sandbox de transcripción.",
+		"Esta transcripción se generó sin ningún audio.",
+		"La misma petición siempre devuelve el mismo texto.",
+		"Este job no usó tiempo de GPU.",
+		"Usa una API key real para transcribir medios reales.",
+		"Cada segmento dura exactamente cuatro segundos.",
+	},
+	"yo": {
+		"Ẹ kú àbọ̀ sí ibi ìdánwò àkọsílẹ̀.",
+		"A ṣe àkọsílẹ̀ yìí láìsí ohùn kankan.",
+		"Ìbéèrè kan náà máa ń dá ọ̀rọ̀ kan náà padà.",
+		"Iṣẹ́ yìí kò lo àkókò GPU kankan.",
+		"Lo kọ́kọ́rọ́ API gidi láti kọ ohùn gidi sílẹ̀.",
+		"Apá kọ̀ọ̀kan gba ìṣẹ́jú àáyá mẹ́rin gangan.",
+	},
+}
+
+// Fallos que se simulan con ?sandbox_error=CODE en la URL del medio
+var sandboxErrors = map[string]string{
+	"DOWNLOAD_FAILED":   "sandbox: simulated download failure",
+	"UNSUPPORTED_MEDIA": "sandbox: simulated unsupported media",
+	"NO_SPEECH":         "sandbox: simulated media without speech",
+	"BACKEND_ERROR":     "sandbox: simulated backend failure",
+}
+
+// Fallo pedido en la URL de un job de sandbox; un código desconocido es un
+// BACKEND_ERROR
+func sandboxError(rawURL string) (code, message string, ok bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", false
+	}
+	code = strings.ToUpper(u.Query().Get("sandbox_error"))
+	if code == "" {
+		return "", "", false
+	}
+	if message, known := sandboxErrors[code]; known {
+		return code, message, true
+	}
+	return "BACKEND_ERROR", sandboxErrors["BACKEND_ERROR"], true
+}
+
+// Respuesta del backend de sandbox y la duración del audio que simula. Solo
+// depende del medio (URL o subida) y de las opciones de la petición.
+func sandboxResponse(input RequestBody) (BackendResponse, float64) {
+	seed := input.URL
+	if input.UploadID != "" {
+		// El enlace firmado de la subida cambia en cada intento
+		seed = "upload:" + input.UploadID
+	}
+	sum := sha256.Sum256([]byte(seed))
+	lang := strings.ToLower(input.Language)
+	if lang == "" {
+		lang = "en"
+	}
+	phrases, ok := sandboxPhrases[lang]
+	if !ok {
+		phrases = sandboxPhrases["en"]
+	}
+
+	n := 3 + int(sum[0]%4)
+	result := BackendResponse{Language: lang, ModelUsed: sandboxBackend}
+	translations := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		p := (int(sum[1]) + i) % len(phrases)
+		start := float64(i) * sandboxSegmentSeconds
+		seg := Segment{
+			ID:    i,
+			Start: start,
+			End:   start + sandboxSegmentSeconds - 0.5,
+			Text:  phrases[p],
+		}
+		seg.Words = sandboxWords(seg.Text, seg.Start, seg.End)
+		if input.Diarize {
+			seg.Speaker = fmt.Sprintf("SPEAKER_%02d", i%2)
+		}
+		result.Segments = append(result.Segments, seg)
+		translations = append(translations, sandboxPhrases["en"][p])
+	}
+	if input.Translate {
+		result.Translation = strings.Join(translations, " ")
+	}
+	result.normalize()
+	return result, float64(n) * sandboxSegmentSeconds
+}
+
+// Palabras repartidas por igual en el segmento
+func sandboxWords(text string, start, end float64) []Word {
+	fields := strings.Fields(text)
+	step := (end - start) / float64(len(fields))
+	words := make([]Word, len(fields))
+	for i, w := range fields {
+		words[i] = Word{Word: w, Start: round2(start + float64(i)*step), End: round2(start + float64(i+1)*step), Probability: 1}
+	}
+	return words
+}
+
+// Job de una key de sandbox: sin descarga, sondeo, scheduler ni backend.
+// Recorre los mismos estados y eventos que uno real y termina al momento.
+func processSandboxJob(jobID string, input RequestBody) {
+	if input.UploadID == "" {
+		if _, err := validateJobMediaURL(input.URL); err != nil {
+			markJobFailed(jobID, "INVALID_URL", err.Error())
+			return
+		}
+	}
+	setJobStatus(jobID, "processing")
+	if code, message, ok := sandboxError(input.URL); ok {
+		// Fallo pedido por el cliente: no se reporta al tracker de errores
+		markJobFailed(jobID, code, message)
+		return
+	}
+
+	result, duration := sandboxResponse(input)
+	meta, _ := getJobMeta(jobID)
+	if !languageAllowed(input.OnlyIfLanguage, result.Language) {
+		check := LanguageCheck{
+			Detected:      result.Language,
+			Allowed:       input.OnlyIfLanguage,
+			Model:         sandboxBackend,
+			SampleSeconds: duration,
+		}
+		mu.Lock()
+		defer unlockJobs()
+		if job, exists := jobStore[jobID]; exists {
+			job.Status = "skipped"
+			job.Language = check.Detected
+			job.LanguageCheck = &check
+			job.Duration = duration
+			job.Backend = sandboxBackend
+			message := fmt.Sprintf("detected language %s is not in only_if_language (%s)", check.Detected, strings.Join(check.Allowed, ", "))
+			appendEventLocked(jobID, JobEvent{Type: EventStatus, Status: "skipped", Message: message})
+		}
+		return
+	}
+
+	stats := computeStats(&result, duration)
+	formatted := input.Format.apply(result, input.Language)
+	translation, replaced := formatted.Translation, 0
+	if input.Translate {
+		translation, replaced = applyGlossary(formatted.Translation, glossaries.get(meta.Tenant))
+	}
+
+	mu.Lock()
+	defer unlockJobs()
+	job, exists := jobStore[jobID]
+	if !exists {
+		return
+	}
+	job.Status = "completed"
+	job.Transcription = formatted.Transcription
+	job.Translation = translation
+	job.Language = formatted.Language
+	job.Segments = formatted.Segments
+	job.Stats = input.Format.withDiacritics(stats, result)
+	job.Review = newReview(input)
+	job.Duration = duration
+	job.Lane = laneFor(duration)
+	job.Backend = sandboxBackend
+	if replaced > 0 {
+		appendEventLocked(jobID, glossaryEvent(replaced))
+	}
+	appendEventLocked(jobID, JobEvent{Type: EventStatus, Status: "completed", Message: "sandbox result"})
+}
+
+// Respuesta de POST /transcribe/sync con una key de sandbox
+func sandboxSync(input RequestBody, tenant string) (*SyncResponse, *syncError) {
+	if code, message, ok := sandboxError(input.URL); ok {
+		return nil, &syncError{http.StatusBadGateway, code, errors.New(message)}
+	}
+	result, duration := sandboxResponse(input)
+	stats := computeStats(&result, duration)
+	formatted := input.Format.apply(result, input.Language)
+	response := &SyncResponse{
+		Transcription: formatted.Transcription,
+		Translation:   formatted.Translation,
+		Language:      formatted.Language,
+		Segments:      formatted.Segments,
+		Stats:         input.Format.withDiacritics(stats, result),
+		Duration:      duration,
+	}
+	if input.Translate {
+		response.Translation, _ = applyGlossary(formatted.Translation, glossaries.get(tenant))
+	}
+	return response, nil
+}
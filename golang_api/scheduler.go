@@ -0,0 +1,325 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Lanes de ejecución
+const (
+	LaneShort    = "short"    // audio corto: puede usar cualquier worker
+	LaneStandard = "standard" // resto (o duración desconocida): solo workers generales
+)
+
+// Prioridad máxima de POST /process; sin indicar es 0
+const maxJobPriority = 9
+
+// Reparte los workers entre jobs en espera. Una parte queda reservada para
+// audio corto, de modo que los clips rápidos no esperan detrás de
+// grabaciones de varias horas.
+type scheduler struct {
+	mu             sync.Mutex
+	reserved       int // workers solo para LaneShort
+	general        int // workers para cualquier lane
+	busyReserved   int
+	busyGeneral    int
+	waiting        []*schedWaiter
+	reservedForJob map[string]bool // true si el job ocupa un worker reservado
+	paused         bool            // cola pausada: no se asignan workers
+
+	// Minutos de GPU estimados de los jobs con worker, con GPU_MINUTES_BUDGET
+	inFlightCost float64
+	costForJob   map[string]float64
+
+	// Reparto justo entre tenants (ver fairshare.go)
+	fair fairShare
+}
+
+type schedWaiter struct {
+	jobID    string
+	lane     string
+	tenant   string
+	priority int
+	cost     float64   // minutos de GPU estimados
+	since    time.Time // entrada en la espera
+	ready    chan struct{}
+}
+
+var jobScheduler *scheduler
+
+// Plazas para preparar el medio (descarga, conversión, sondeo y análisis),
+// que va antes de pedir worker porque la duración decide el lane. Sin
+// límite, una ráfaga de jobs descargaría y convertiría todo a la vez.
+var preprocessSlots chan struct{}
+
+// Ocupa una plaza de preparación. La función devuelta la libera y admite
+// varias llamadas.
+func acquirePreprocess() (release func()) {
+	preprocessSlots <- struct{}{}
+	var once sync.Once
+	return func() { once.Do(func() { <-preprocessSlots }) }
+}
+
+func newScheduler(workers int, shortFraction float64) *scheduler {
+	s := &scheduler{
+		reservedForJob: make(map[string]bool),
+		costForJob:     make(map[string]float64),
+		fair:           newFairShare(),
+	}
+	s.reserved, s.general = schedulerLanes(workers, shortFraction)
+	return s
+}
+
+// Workers reservados para audio corto y generales
+func schedulerLanes(workers int, shortFraction float64) (reserved, general int) {
+	if workers < 1 {
+		workers = 1
+	}
+	reserved = int(math.Ceil(float64(workers) * shortFraction))
+	if reserved > workers-1 {
+		reserved = workers - 1 // siempre queda al menos un worker general
+	}
+	if reserved < 0 {
+		reserved = 0
+	}
+	return reserved, workers - reserved
+}
+
+// Cambia el número de workers al recargar la configuración. Con menos, los
+// jobs en curso terminan y no se asignan nuevos hasta bajar del tope.
+func (s *scheduler) resize(workers int, shortFraction float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reserved, s.general = schedulerLanes(workers, shortFraction)
+	s.dispatchLocked()
+}
+
+// Lane según la duración sondeada (0 = desconocida)
+func laneFor(durationSeconds float64) string {
+	if durationSeconds > 0 && durationSeconds < cfg.ShortAudioMaxDuration.Seconds() {
+		return LaneShort
+	}
+	return LaneStandard
+}
+
+// Minutos de GPU estimados de un job: la duración por el factor de tiempo
+// real de cada pasada. Sin duración sondeada se supone
+// UNKNOWN_DURATION_ESTIMATE.
+func estimateGPUMinutes(duration float64, payload PythonRequest) float64 {
+	if duration <= 0 {
+		duration = cfg.UnknownDurationEstimate.Seconds()
+	}
+	factor := realtimeFactor(payload.Model)
+	if payload.Accuracy == AccuracyHigh {
+		if payload.Model == "" {
+			factor = realtimeFactor(cfg.TwoPassSecondModel)
+		}
+		factor += realtimeFactor(cfg.TwoPassFirstModel)
+	}
+	return duration * factor / 60
+}
+
+func validatePriority(priority int) error {
+	if priority < 0 || priority > maxJobPriority {
+		return errors.Errorf("priority must be between 0 and %d", maxJobPriority)
+	}
+	return nil
+}
+
+// La prioridad sube un punto por cada PRIORITY_AGING_INTERVAL en espera: un
+// job de prioridad baja acaba por adelantar a los que llegan después aunque
+// no dejen de llegar de prioridad alta
+func (w *schedWaiter) effectivePriority(now time.Time) int {
+	return agedPriority(w.priority, w.since, now)
+}
+
+// Prioridad de un job que espera desde since; ClaimJob de los almacenes
+// ordena igual, contando la espera desde que se creó el job
+func agedPriority(priority int, since, now time.Time) int {
+	interval := live().PriorityAgingInterval.Duration
+	if interval <= 0 {
+		return priority
+	}
+	return priority + int(now.Sub(since)/interval)
+}
+
+// Bloquea hasta que haya un worker disponible para el lane del job
+func (s *scheduler) acquire(jobID, lane, tenant string, priority int, cost float64) {
+	s.mu.Lock()
+	w := &schedWaiter{jobID: jobID, lane: lane, tenant: tenant, priority: priority, cost: cost, since: time.Now(), ready: make(chan struct{})}
+	s.waiting = append(s.waiting, w)
+	s.dispatchLocked()
+	s.mu.Unlock()
+
+	<-w.ready
+}
+
+// Devuelve el worker ocupado por el job
+func (s *scheduler) release(jobID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reservedForJob[jobID] {
+		s.busyReserved--
+	} else {
+		s.busyGeneral--
+	}
+	delete(s.reservedForJob, jobID)
+	s.inFlightCost -= s.costForJob[jobID]
+	if len(s.costForJob) == 1 {
+		s.inFlightCost = 0 // sin restos de redondeo
+	}
+	delete(s.costForJob, jobID)
+	s.fair.finished(jobID)
+	s.dispatchLocked()
+}
+
+// Con la cola pausada los jobs esperan en queued; los que ya tienen worker
+// siguen hasta terminar
+func (s *scheduler) setPaused(paused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = paused
+	s.dispatchLocked()
+}
+
+// Jobs esperando un worker
+func (s *scheduler) waitingCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.waiting)
+}
+
+// Jobs con un worker asignado
+func (s *scheduler) busyCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.busyReserved + s.busyGeneral
+}
+
+// Prioridad efectiva de un job en espera de worker
+func (s *scheduler) effectivePriority(jobID string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, w := range s.waiting {
+		if w.jobID == jobID {
+			return w.effectivePriority(now), true
+		}
+	}
+	return 0, false
+}
+
+// Asigna workers libres a los jobs en espera. Entre tenants decide el
+// reparto justo; dentro de cada tenant, la prioridad efectiva y, a igual
+// prioridad, el orden de llegada. Un job largo bloqueado no impide que
+// avancen los cortos que vienen detrás.
+func (s *scheduler) dispatchLocked() {
+	if s.paused {
+		return
+	}
+	now := time.Now()
+	for {
+		i := s.nextLocked(now)
+		if i < 0 {
+			return
+		}
+		w := s.waiting[i]
+		worker := workerGeneral
+		if w.lane == LaneShort && s.busyReserved < s.reserved {
+			worker = workerReserved
+			s.busyReserved++
+			s.reservedForJob[w.jobID] = true
+		} else {
+			s.busyGeneral++
+		}
+		s.inFlightCost += w.cost
+		s.costForJob[w.jobID] = w.cost
+		s.fair.dispatched(w, worker, now)
+		close(w.ready)
+		copy(s.waiting[i:], s.waiting[i+1:])
+		s.waiting[len(s.waiting)-1] = nil
+		s.waiting = s.waiting[:len(s.waiting)-1]
+	}
+}
+
+// Puede ocupar ahora un worker libre
+func (s *scheduler) canRunLocked(w *schedWaiter) bool {
+	return (w.lane == LaneShort && s.busyReserved < s.reserved) || s.busyGeneral < s.general
+}
+
+// Cabe en GPU_MINUTES_BUDGET. Un job mayor que el presupuesto entero entra
+// cuando no hay otro en curso.
+func (s *scheduler) fitsBudgetLocked(w *schedWaiter) bool {
+	budget := live().GPUMinutesBudget
+	return budget <= 0 || len(s.costForJob) == 0 || s.inFlightCost+w.cost <= budget
+}
+
+// Índice en waiting del siguiente job, o -1 si ninguno puede ocupar un
+// worker. Si el elegido no cabe en el presupuesto los demás no lo adelantan,
+// o un job largo esperaría indefinidamente detrás de los cortos; solo los
+// workers reservados siguen tomando audio corto que quepa.
+func (s *scheduler) nextLocked(now time.Time) int {
+	next := s.fairPickLocked(now, s.canRunLocked)
+	if next < 0 || s.fitsBudgetLocked(s.waiting[next]) {
+		return next
+	}
+	if s.busyReserved >= s.reserved {
+		return -1
+	}
+	return s.fairPickLocked(now, func(w *schedWaiter) bool {
+		return w.lane == LaneShort && s.fitsBudgetLocked(w)
+	})
+}
+
+// El mejor de cada tenant entre los que cumplen eligible y, de ellos, el
+// del tenant con menor tiempo virtual
+func (s *scheduler) fairPickLocked(now time.Time, eligible func(*schedWaiter) bool) int {
+	best := make(map[string]int)
+	for i, w := range s.waiting {
+		if !eligible(w) {
+			continue
+		}
+		if j, ok := best[w.tenant]; !ok || w.before(s.waiting[j], now) {
+			best[w.tenant] = i
+		}
+	}
+	next := -1
+	for tenant, i := range best {
+		if next < 0 {
+			next = i
+			continue
+		}
+		current := s.waiting[next]
+		vi, vn := s.fair.start(tenant), s.fair.start(current.tenant)
+		if vi < vn || (vi == vn && s.waiting[i].since.Before(current.since)) {
+			next = i
+		}
+	}
+	return next
+}
+
+// Orden dentro de un tenant
+func (w *schedWaiter) before(other *schedWaiter, now time.Time) bool {
+	if pw, po := w.effectivePriority(now), other.effectivePriority(now); pw != po {
+		return pw > po
+	}
+	return w.since.Before(other.since)
+}
+
+// Copia del job con la prioridad efectiva si espera un worker; si no, el
+// mismo job. Requiere mu tomado (basta RLock).
+func withEffectivePriority(jobID string, job *JobState) *JobState {
+	if job.Status != "queued" {
+		return job
+	}
+	priority, ok := jobScheduler.effectivePriority(jobID)
+	if !ok {
+		return job
+	}
+	copied := *job
+	copied.EffectivePriority = &priority
+	return &copied
+}
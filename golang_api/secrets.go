@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Referencias a secretos que puede llevar cualquier valor de texto de la
+// configuración, en el entorno o en CONFIG_FILE
+const (
+	secretRefVault     = "vault:"     // vault:<ruta>#<campo>, KV v1 o v2 (secret/data/...)
+	secretRefAWS       = "aws-sm:"    // aws-sm:<id o ARN>[#<campo del JSON>]
+	secretRefFile      = "file:"      // file:<ruta>, p. ej. un secreto montado de Kubernetes
+	secretRefEncrypted = "encrypted:" // encrypted:<base64>, de -encrypt-secret
+)
+
+// Datos adicionales del cifrado de encrypted:
+const configEncryptionScope = "config"
+
+// Tiempo máximo de cada lectura de Vault o Secrets Manager
+const secretFetchTimeout = 10 * time.Second
+
+// Campos que se renuevan en caliente cuando su secreto rota: se leen con
+// liveSecret en cada uso. El resto se usa al arrancar (conexiones, claves
+// de firma de enlaces ya emitidos) y el cambio se aplica al reiniciar.
+var reloadableSecrets = map[string]bool{
+	"APIKeys[].Key":      true,
+	"AlertWebhookSecret": true,
+	"SMTPPassword":       true,
+	"GoogleClientSecret": true,
+	"DropboxAppSecret":   true,
+	"ZoomClientSecret":   true,
+	"OIDCClientSecret":   true,
+
+	// Solo los usa la renovación, p. ej. el token que escribe Vault Agent
+	"VaultToken":         true,
+	"AWSAccessKeyID":     true,
+	"AWSSecretAccessKey": true,
+	"AWSSessionToken":    true,
+}
+
+// Configuración de los propios gestores: solo admite file: (y encrypted:
+// salvo la clave de cifrado)
+var secretSourceFields = map[string]bool{
+	"VaultAddr":           true,
+	"VaultToken":          true,
+	"VaultNamespace":      true,
+	"AWSRegion":           true,
+	"AWSAccessKeyID":      true,
+	"AWSSecretAccessKey":  true,
+	"AWSSessionToken":     true,
+	"SecretsManagerURL":   true,
+	"ConfigEncryptionKey": true,
+}
+
+var secretIndexPattern = regexp.MustCompile(`\[\d+\]`)
+
+// Campo de la configuración que viene de una referencia
+type secretRef struct {
+	path       string // p. ej. SMTPPassword o APIKeys[0].Key
+	ref        string
+	value      string // último valor leído
+	reloadable bool
+	at         func(root reflect.Value) reflect.Value
+}
+
+// Referencias de la configuración cargada. mu protege los campos
+// renovables de cfg frente a la renovación.
+type configSecretSet struct {
+	mu   sync.RWMutex
+	refs []*secretRef
+}
+
+var configSecrets = &configSecretSet{}
+
+// Valor actual de un campo renovable de cfg, p. ej. liveSecret(&cfg.SMTPPassword)
+func liveSecret(field *string) string {
+	configSecrets.mu.RLock()
+	defer configSecrets.mu.RUnlock()
+	return *field
+}
+
+func isSecretRef(s string) bool {
+	for _, prefix := range []string{secretRefVault, secretRefAWS, secretRefFile, secretRefEncrypted} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Referencias en los textos de v, también dentro de structs y listas (los
+// mapas no se recorren)
+func collectSecretRefs(v reflect.Value, path string, at func(reflect.Value) reflect.Value, out *[]*secretRef) {
+	switch v.Kind() {
+	case reflect.String:
+		if isSecretRef(v.String()) {
+			*out = append(*out, &secretRef{
+				path:       path,
+				ref:        v.String(),
+				reloadable: reloadableSecrets[secretIndexPattern.ReplaceAllString(path, "[]")],
+				at:         at,
+			})
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			i := i
+			name := t.Field(i).Name
+			if path != "" {
+				name = path + "." + name
+			}
+			collectSecretRefs(v.Field(i), name, func(root reflect.Value) reflect.Value { return at(root).Field(i) }, out)
+		}
+	case reflect.Slice:
+		for j := 0; j < v.Len(); j++ {
+			j := j
+			collectSecretRefs(v.Index(j), fmt.Sprintf("%s[%d]", path, j), func(root reflect.Value) reflect.Value { return at(root).Index(j) }, out)
+		}
+	}
+}
+
+// Lector de referencias; guarda cada secreto remoto leído para no pedirlo
+// una vez por campo
+type secretResolver struct {
+	c      *Config
+	client *http.Client
+	vault  map[string]map[string]interface{}
+	aws    map[string]string
+}
+
+func newSecretResolver(c *Config) *secretResolver {
+	return &secretResolver{
+		c:      c,
+		client: &http.Client{Timeout: secretFetchTimeout},
+		vault:  make(map[string]map[string]interface{}),
+		aws:    make(map[string]string),
+	}
+}
+
+func (r *secretResolver) resolve(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, secretRefFile):
+		return readSecretFile(strings.TrimPrefix(ref, secretRefFile))
+	case strings.HasPrefix(ref, secretRefEncrypted):
+		return decryptConfigSecret(r.c.ConfigEncryptionKey, strings.TrimPrefix(ref, secretRefEncrypted))
+	case strings.HasPrefix(ref, secretRefVault):
+		return r.vaultSecret(strings.TrimPrefix(ref, secretRefVault))
+	default:
+		return r.awsSecret(strings.TrimPrefix(ref, secretRefAWS))
+	}
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read secret file")
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Campo de un secreto KV de Vault; en KV v2 la ruta lleva data/
+func (r *secretResolver) vaultSecret(ref string) (string, error) {
+	path, field, _ := strings.Cut(ref, "#")
+	if path == "" || field == "" {
+		return "", errors.New("vault references must be vault:<path>#<field>")
+	}
+	if r.c.VaultAddr == "" || r.c.VaultToken == "" {
+		return "", errors.New("vault references require VAULT_ADDR and VAULT_TOKEN")
+	}
+	data, ok := r.vault[path]
+	if !ok {
+		var err error
+		if data, err = r.fetchVault(path); err != nil {
+			return "", err
+		}
+		r.vault[path] = data
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return "", errors.Errorf("vault secret %s has no string field %q", path, field)
+	}
+	return value, nil
+}
+
+func (r *secretResolver) fetchVault(path string) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(r.c.VaultAddr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid VAULT_ADDR")
+	}
+	req.Header.Set("X-Vault-Token", r.c.VaultToken)
+	if r.c.VaultNamespace != "" {
+		req.Header.Set("X-Vault-Namespace", r.c.VaultNamespace)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read vault secret %s", path)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, errors.Errorf("vault secret %s returned %d: %s", path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	var out struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, errors.Wrapf(err, "invalid vault response for %s", path)
+	}
+	// KV v2 anida los campos en data.data junto a data.metadata
+	if inner, ok := out.Data["data"].(map[string]interface{}); ok {
+		if _, v2 := out.Data["metadata"]; v2 {
+			return inner, nil
+		}
+	}
+	return out.Data, nil
+}
+
+// SecretString de AWS Secrets Manager, entero o uno de los campos de su JSON
+func (r *secretResolver) awsSecret(ref string) (string, error) {
+	id, field, _ := strings.Cut(ref, "#")
+	if id == "" {
+		return "", errors.New("aws-sm references must be aws-sm:<secret id>[#<field>]")
+	}
+	if r.c.AWSRegion == "" || r.c.AWSAccessKeyID == "" || r.c.AWSSecretAccessKey == "" {
+		return "", errors.New("aws-sm references require AWS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	secret, ok := r.aws[id]
+	if !ok {
+		var err error
+		if secret, err = r.fetchAWS(id); err != nil {
+			return "", err
+		}
+		r.aws[id] = secret
+	}
+	if field == "" {
+		return secret, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", errors.Errorf("secret %s is not a JSON object", id)
+	}
+	value, ok := fields[field].(string)
+	if !ok {
+		return "", errors.Errorf("secret %s has no string field %q", id, field)
+	}
+	return value, nil
+}
+
+func (r *secretResolver) fetchAWS(id string) (string, error) {
+	endpoint := r.c.SecretsManagerURL
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + r.c.AWSRegion + ".amazonaws.com/"
+	}
+	body, err := json.Marshal(map[string]string{"SecretId": id})
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", errors.Wrap(err, "invalid SECRETS_MANAGER_URL")
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWSRequest(req, body, "secretsmanager", awsCredentials{
+		Region:       r.c.AWSRegion,
+		AccessKey:    r.c.AWSAccessKeyID,
+		SecretKey:    r.c.AWSSecretAccessKey,
+		SessionToken: r.c.AWSSessionToken,
+	}, time.Now())
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read secret %s", id)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read secret %s", id)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &apiErr)
+		return "", errors.Errorf("secret %s returned %d: %s %s", id, resp.StatusCode, apiErr.Type, apiErr.Message)
+	}
+	var out struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary []byte `json:"SecretBinary"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return "", errors.Wrapf(err, "invalid response for secret %s", id)
+	}
+	if out.SecretString == "" && out.SecretBinary != nil {
+		return string(out.SecretBinary), nil
+	}
+	return out.SecretString, nil
+}
+
+func configEncryptionGCM(key string) (cipher.AEAD, error) {
+	if strings.HasPrefix(key, secretRefFile) {
+		var err error
+		if key, err = readSecretFile(strings.TrimPrefix(key, secretRefFile)); err != nil {
+			return nil, err
+		}
+	}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		return nil, errors.New("CONFIG_ENCRYPTION_KEY must be 32 bytes in base64")
+	}
+	return newGCM(raw)
+}
+
+// Valor para encrypted:, cifrado con CONFIG_ENCRYPTION_KEY
+func encryptConfigSecret(key, plaintext string) (string, error) {
+	aead, err := configEncryptionGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := gcmSeal(aead, configEncryptionScope, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return secretRefEncrypted + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptConfigSecret(key, encoded string) (string, error) {
+	aead, err := configEncryptionGCM(key)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errors.New("encrypted value is not valid base64")
+	}
+	plaintext, err := gcmOpen(aead, configEncryptionScope, data)
+	if err != nil {
+		return "", errors.New("failed to decrypt value (wrong CONFIG_ENCRYPTION_KEY?)")
+	}
+	return string(plaintext), nil
+}
+
+// Orden de resolución: los ficheros primero, que pueden traer la clave de
+// encrypted: o las credenciales de los gestores; luego encrypted: y por
+// último Vault y Secrets Manager
+func secretRefStage(ref string) int {
+	switch {
+	case strings.HasPrefix(ref, secretRefFile):
+		return 0
+	case strings.HasPrefix(ref, secretRefEncrypted):
+		return 1
+	}
+	return 2
+}
+
+// Sustituye las referencias de c por sus secretos; devuelve las
+// referencias para renovarlas
+func resolveConfigSecrets(c *Config) ([]*secretRef, error) {
+	root := reflect.ValueOf(c).Elem()
+	var refs []*secretRef
+	collectSecretRefs(root, "", func(r reflect.Value) reflect.Value { return r }, &refs)
+	resolver := newSecretResolver(c)
+	for stage := 0; stage <= 2; stage++ {
+		for _, ref := range refs {
+			if secretRefStage(ref.ref) != stage {
+				continue
+			}
+			if secretSourceFields[ref.path] && (stage == 2 || (stage == 1 && ref.path == "ConfigEncryptionKey")) {
+				return nil, errors.Errorf("%s cannot reference a secret it is needed to read", ref.path)
+			}
+			value, err := resolver.resolve(ref.ref)
+			if err != nil {
+				return nil, errors.Wrap(err, ref.path)
+			}
+			ref.at(root).SetString(value)
+			ref.value = value
+		}
+	}
+	return refs, nil
+}
+
+// Relee los secretos de Vault, Secrets Manager y los ficheros. Los
+// renovables se aplican al momento; de los demás solo se avisa.
+func refreshConfigSecrets() {
+	root := reflect.ValueOf(&cfg).Elem()
+	resolver := newSecretResolver(&cfg)
+	// Primero los ficheros, por si rotan las credenciales de los gestores;
+	// encrypted: no cambia sin cambiar la configuración
+	var refs []*secretRef
+	for _, stage := range []int{0, 2} {
+		for _, ref := range configSecrets.refs {
+			if secretRefStage(ref.ref) == stage {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	for _, ref := range refs {
+		value, err := resolver.resolve(ref.ref)
+		if err != nil {
+			log.Printf("⚠️ No se pudo releer el secreto de %s: %v", ref.path, err)
+			continue
+		}
+		if value == ref.value {
+			continue
+		}
+		ref.value = value
+		if !ref.reloadable {
+			log.Printf("⚠️ El secreto de %s cambió; se aplicará al reiniciar", ref.path)
+			continue
+		}
+		configSecrets.mu.Lock()
+		ref.at(root).SetString(value)
+		configSecrets.mu.Unlock()
+		log.Printf("🚀 Secreto de %s renovado", ref.path)
+	}
+}
+
+// Relee cada SECRETS_REFRESH_INTERVAL los secretos referenciados
+func runSecretsRefresher() {
+	if len(configSecrets.refs) == 0 || cfg.SecretsRefreshInterval.Duration <= 0 {
+		return
+	}
+	ticker := time.NewTicker(cfg.SecretsRefreshInterval.Duration)
+	defer ticker.Stop()
+	for range ticker.C {
+		refreshConfigSecrets()
+	}
+}
+
+// -encrypt-secret: cifra lo que llega por stdin para CONFIG_FILE o el entorno
+func printEncryptedSecret(c *Config) error {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return errors.Wrap(err, "failed to read stdin")
+	}
+	value, err := encryptConfigSecret(c.ConfigEncryptionKey, strings.TrimRight(string(data), "\r\n"))
+	if err != nil {
+		return err
+	}
+	fmt.Println(value)
+	return nil
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Las sesiones se envían como Bearer con este prefijo o en la cookie
+const sessionTokenPrefix = "ses_"
+
+const (
+	sessionCookieName = "transcribe_session"
+	loginCookieName   = "transcribe_login"
+)
+
+// Vigencia del inicio de sesión en el proveedor
+const loginStateTTL = 10 * time.Minute
+
+var errInvalidSession = errors.New("invalid or expired session")
+
+// Sesión de una persona que inició sesión con OIDC. Va firmada con
+// SESSION_SECRET, así que vale en cualquier réplica sin guardarla; no se
+// puede revocar antes de SESSION_TTL.
+type userSession struct {
+	User   string `json:"user"`
+	Role   string `json:"role"`
+	Tenant string `json:"tenant"`
+	Expiry int64  `json:"exp"`
+}
+
+// Identidad con la que se atienden sus peticiones: una key sin secreto
+func (s *userSession) apiKey() *APIKey {
+	return &APIKey{Name: "oidc:" + s.User, Tenant: s.Tenant, Role: s.Role}
+}
+
+// Inicio de sesión en curso, en una cookie del navegador
+type loginState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`           // PKCE
+	Redirect string `json:"redirect,omitempty"` // ruta a la que volver
+	Expiry   int64  `json:"exp"`
+}
+
+type SessionBody struct {
+	IDToken string `json:"id_token"`
+}
+
+type SessionResponse struct {
+	SessionToken string    `json:"session_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	User         string    `json:"user"`
+	Role         string    `json:"role"`
+	Tenant       string    `json:"tenant"`
+}
+
+func tokenMAC(purpose, payload string) string {
+	mac := hmac.New(sha256.New, []byte(cfg.SessionSecret))
+	fmt.Fprintf(mac, "%s\n%s", purpose, payload)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Serializa v y lo firma; purpose evita usar un tipo de token por otro
+func signToken(purpose string, v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal token")
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + tokenMAC(purpose, payload), nil
+}
+
+func parseSignedToken(purpose, token string, v interface{}) error {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(tokenMAC(purpose, payload))) {
+		return errInvalidSession
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || json.Unmarshal(data, v) != nil {
+		return errInvalidSession
+	}
+	return nil
+}
+
+func parseSession(token string) (*userSession, error) {
+	var s userSession
+	if err := parseSignedToken("session", strings.TrimPrefix(token, sessionTokenPrefix), &s); err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() >= s.Expiry {
+		return nil, errInvalidSession
+	}
+	return &s, nil
+}
+
+// Key de la sesión del Bearer (o de la cookie si no hay credenciales); nil
+// si no hay una sesión válida
+func sessionAPIKey(c *gin.Context, provided string) *APIKey {
+	token := provided
+	if token == "" {
+		token, _ = c.Cookie(sessionCookieName)
+	}
+	if !strings.HasPrefix(token, sessionTokenPrefix) {
+		return nil
+	}
+	s, err := parseSession(token)
+	if err != nil {
+		return nil
+	}
+	return s.apiKey()
+}
+
+// Rutas de inicio de sesión, sin credenciales
+func isLoginPath(path string) bool {
+	switch path {
+	case "/auth/login", "/auth/callback", "/auth/session":
+		return oidcEnabled()
+	}
+	return false
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(errors.Wrap(err, "failed to read random bytes"))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func secureCookies() bool {
+	return strings.HasPrefix(cfg.OIDCRedirectURL, "https://")
+}
+
+// Crea la sesión de un ID token ya validado; el error lleva estado y código
+func newSession(claims *oidcClaims) (SessionResponse, int, string, error) {
+	role := roleForGroups(claims.Groups)
+	if role == "" {
+		return SessionResponse{}, http.StatusForbidden, "FORBIDDEN", errors.New("no role is mapped to this user")
+	}
+	expires := time.Now().Add(cfg.SessionTTL.Duration)
+	s := userSession{User: claims.user(), Role: role, Tenant: cfg.OIDCTenant, Expiry: expires.Unix()}
+	token, err := signToken("session", s)
+	if err != nil {
+		return SessionResponse{}, http.StatusInternalServerError, "INTERNAL_ERROR", err
+	}
+	log.Printf("🚀 Sesión OIDC iniciada: %s (%s)", s.User, s.Role)
+	return SessionResponse{
+		SessionToken: sessionTokenPrefix + token,
+		ExpiresAt:    expires,
+		User:         s.User,
+		Role:         s.Role,
+		Tenant:       s.Tenant,
+	}, 0, "", nil
+}
+
+// Estado HTTP y código de un fallo al validar un ID token
+func idTokenError(err error) (int, string) {
+	if errors.Is(err, errOIDCUnavailable) {
+		return http.StatusBadGateway, "OIDC_UNAVAILABLE"
+	}
+	return http.StatusUnauthorized, "UNAUTHORIZED"
+}
+
+// POST /auth/session canjea un ID token del proveedor (obtenido por la app
+// o la CLI) por una sesión del gateway
+func createSessionHandler(c *gin.Context) {
+	var input SessionBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.IDToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id_token is required", "code": "INVALID_REQUEST"})
+		return
+	}
+	claims, err := verifyIDToken(c.Request.Context(), input.IDToken, "")
+	if err != nil {
+		status, code := idTokenError(err)
+		c.JSON(status, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+	session, status, code, err := newSession(claims)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusCreated, session)
+}
+
+// GET /auth/login redirige al proveedor (flujo authorization code con
+// PKCE); redirect es la ruta del gateway a la que volver después
+func loginHandler(c *gin.Context) {
+	if cfg.OIDCRedirectURL == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC login redirect is not configured"})
+		return
+	}
+	redirect := c.Query("redirect")
+	// Solo rutas propias, para no servir de redirección abierta
+	if redirect != "" && (!strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.HasPrefix(redirect, "/\\")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "redirect must be a path on this service", "code": "INVALID_REQUEST"})
+		return
+	}
+	d, err := oidcIssuer.config(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "code": "OIDC_UNAVAILABLE"})
+		return
+	}
+	state := loginState{
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		Verifier: randomToken(),
+		Redirect: redirect,
+		Expiry:   time.Now().Add(loginStateTTL).Unix(),
+	}
+	cookie, err := signToken("login", state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "INTERNAL_ERROR"})
+		return
+	}
+	challenge := sha256.Sum256([]byte(state.Verifier))
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", cfg.OIDCClientID)
+	q.Set("redirect_uri", cfg.OIDCRedirectURL)
+	q.Set("scope", strings.Join(cfg.OIDCScopes, " "))
+	q.Set("state", state.State)
+	q.Set("nonce", state.Nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(loginCookieName, cookie, int(loginStateTTL.Seconds()), "/auth/", "", secureCookies(), true)
+	c.Redirect(http.StatusFound, d.AuthorizationEndpoint+"?"+q.Encode())
+}
+
+// Canjea el código de autorización por el ID token en el proveedor
+func exchangeCode(c *gin.Context, d *oidcDiscovery, code, verifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", cfg.OIDCRedirectURL)
+	form.Set("client_id", cfg.OIDCClientID)
+	form.Set("code_verifier", verifier)
+	if liveSecret(&cfg.OIDCClientSecret) != "" {
+		form.Set("client_secret", liveSecret(&cfg.OIDCClientSecret))
+	}
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(errOIDCUnavailable, err.Error())
+	}
+	defer resp.Body.Close()
+	var out struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", errors.Wrap(errOIDCUnavailable, "invalid token endpoint response")
+	}
+	if out.Error != "" {
+		return "", errors.Errorf("token exchange failed: %s %s", out.Error, out.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || out.IDToken == "" {
+		return "", errors.Errorf("token exchange failed with status %d", resp.StatusCode)
+	}
+	return out.IDToken, nil
+}
+
+// GET /auth/callback recibe la vuelta del proveedor, abre la sesión en una
+// cookie y redirige a la ruta pedida en /auth/login (o devuelve la sesión)
+func callbackHandler(c *gin.Context) {
+	if e := c.Query("error"); e != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login failed: " + e, "code": "UNAUTHORIZED"})
+		return
+	}
+	raw, _ := c.Cookie(loginCookieName)
+	var state loginState
+	// La cookie ata la vuelta al navegador que inició el login
+	if err := parseSignedToken("login", raw, &state); err != nil || state.State != c.Query("state") || time.Now().Unix() >= state.Expiry {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "login state is invalid or expired", "code": "INVALID_REQUEST"})
+		return
+	}
+	c.SetCookie(loginCookieName, "", -1, "/auth/", "", secureCookies(), true)
+
+	d, err := oidcIssuer.config(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "code": "OIDC_UNAVAILABLE"})
+		return
+	}
+	idToken, err := exchangeCode(c, d, c.Query("code"), state.Verifier)
+	var claims *oidcClaims
+	if err == nil {
+		claims, err = verifyIDToken(c.Request.Context(), idToken, state.Nonce)
+	}
+	if err != nil {
+		status, code := idTokenError(err)
+		c.JSON(status, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+	session, status, code, err := newSession(claims)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookieName, session.SessionToken, int(cfg.SessionTTL.Seconds()), "/", "", secureCookies(), true)
+	if state.Redirect != "" {
+		c.Redirect(http.StatusFound, state.Redirect)
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, session)
+}
+
+// GET /auth/me devuelve la identidad de la petición (key o sesión)
+func meHandler(c *gin.Context) {
+	key := currentAPIKey(c)
+	if key == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "authentication is not enabled"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"name": key.Name, "role": key.Role, "tenant": key.tenant()})
+}
+
+// POST /auth/logout borra la cookie de sesión
+func logoutHandler(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookieName, "", -1, "/", "", secureCookies(), true)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,784 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// Nombre del ajuste compartido con las credenciales SFTP de los tenants
+const sftpCredentialsSetting = "sftp_credentials"
+
+// Máximo de hosts SFTP por tenant
+const maxSFTPCredentialsPerTenant = 20
+
+// Bytes por petición READ y peticiones en vuelo a la vez
+const (
+	sftpReadSize   = 32 * 1024
+	sftpReadWindow = 16
+)
+
+// Paquetes de la versión 3 del protocolo SFTP que usan la descarga y los
+// destinos sftp
+const (
+	sftpInit    = 1
+	sftpVersion = 2
+	sftpOpen    = 3
+	sftpClose   = 4
+	sftpRead    = 5
+	sftpWrite   = 6
+	sftpFstat   = 8
+	sftpRemove  = 13
+	sftpMkdir   = 14
+	sftpRename  = 18
+	sftpStatus  = 101
+	sftpHandle  = 102
+	sftpData    = 103
+	sftpAttrs   = 105
+)
+
+// Códigos de SSH_FXP_STATUS
+const (
+	sftpStatusOK               = 0
+	sftpStatusEOF              = 1
+	sftpStatusNoSuchFile       = 2
+	sftpStatusPermissionDenied = 3
+)
+
+var (
+	errTooManySFTPCredentials = errors.Errorf("at most %d SFTP hosts per tenant", maxSFTPCredentialsPerTenant)
+	errNoSFTPCredential       = errors.New("no SFTP credentials for this host; store them with PUT /sftp/credentials/{host}")
+)
+
+// Credenciales de un tenant para un host SFTP. La contraseña y la clave
+// privada nunca se devuelven.
+type SFTPCredential struct {
+	Host      string    `json:"host"`
+	Username  string    `json:"username"`
+	Auth      string    `json:"auth"`     // password o private_key
+	HostKey   string    `json:"host_key"` // clave pública del servidor, formato authorized_keys
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	tenant string
+	secret sftpSecret
+}
+
+type sftpSecret struct {
+	Password   string `json:"password,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+// Cuerpo de PUT /sftp/credentials/:host
+type SFTPCredentialBody struct {
+	Username   string `json:"username" binding:"required"`
+	Password   string `json:"password"`
+	PrivateKey string `json:"private_key"` // PEM u OpenSSH
+	Passphrase string `json:"passphrase"`
+	HostKey    string `json:"host_key" binding:"required"`
+}
+
+// Forma persistida: los secretos van sellados si hay cifrado en reposo
+type SFTPCredentialRecord struct {
+	SFTPCredential
+	Tenant string `json:"tenant"`
+	Secret string `json:"secret"`
+}
+
+type sftpRegistry struct {
+	mu    sync.RWMutex
+	items map[string]*SFTPCredential // por tenant y host
+}
+
+var sftpCredentials = &sftpRegistry{items: make(map[string]*SFTPCredential)}
+
+func sftpCredentialKey(tenant, host string) string {
+	return tenant + "\x00" + strings.ToLower(host)
+}
+
+// Requiere r.mu tomado
+func (r *sftpRegistry) persistLocked() error {
+	if stateStore == nil {
+		return nil
+	}
+	records := make([]SFTPCredentialRecord, 0, len(r.items))
+	for _, item := range r.items {
+		secret, err := json.Marshal(item.secret)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal SFTP secret")
+		}
+		rec := SFTPCredentialRecord{SFTPCredential: *item, Tenant: item.tenant, Secret: string(secret)}
+		if encryption != nil {
+			if rec.Secret, err = encryption.seal(tenantScope(item.tenant), secret); err != nil {
+				return err
+			}
+		}
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].CreatedAt.Before(records[j].CreatedAt) })
+	data, err := json.Marshal(records)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal SFTP credentials")
+	}
+	return stateStore.SaveSetting(sftpCredentialsSetting, data)
+}
+
+func refreshSFTPCredentials() error {
+	data, err := stateStore.LoadSetting(sftpCredentialsSetting)
+	if err != nil || data == nil {
+		return err
+	}
+	var records []SFTPCredentialRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return errors.Wrap(err, "corrupt SFTP credentials")
+	}
+	items := make(map[string]*SFTPCredential, len(records))
+	for _, rec := range records {
+		item := rec.SFTPCredential
+		item.tenant = rec.Tenant
+		secret := []byte(rec.Secret)
+		if isSealed(rec.Secret) {
+			if secret, err = encryption.open(tenantScope(rec.Tenant), rec.Secret); err != nil {
+				return errors.Wrapf(err, "SFTP credentials for %s", rec.Host)
+			}
+		}
+		if err := json.Unmarshal(secret, &item.secret); err != nil {
+			return errors.Wrapf(err, "corrupt SFTP secret for %s", rec.Host)
+		}
+		items[sftpCredentialKey(item.tenant, item.Host)] = &item
+	}
+	sftpCredentials.mu.Lock()
+	sftpCredentials.items = items
+	sftpCredentials.mu.Unlock()
+	return nil
+}
+
+func (r *sftpRegistry) list(tenant string) []SFTPCredential {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := []SFTPCredential{}
+	for _, item := range r.items {
+		if item.tenant == tenant {
+			public := *item
+			public.secret = sftpSecret{}
+			out = append(out, public)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Host < out[j].Host })
+	return out
+}
+
+// Copia completa (con secretos) para conectarse
+func (r *sftpRegistry) lookup(tenant, host string) (SFTPCredential, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	item, ok := r.items[sftpCredentialKey(tenant, host)]
+	if !ok {
+		return SFTPCredential{}, false
+	}
+	return *item, true
+}
+
+// Crea o reemplaza las credenciales del host; conserva created_at
+func (r *sftpRegistry) put(tenant string, item *SFTPCredential) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := sftpCredentialKey(tenant, item.Host)
+	previous, existed := r.items[key]
+	if existed {
+		item.CreatedAt = previous.CreatedAt
+	} else {
+		count := 0
+		for _, i := range r.items {
+			if i.tenant == tenant {
+				count++
+			}
+		}
+		if count >= maxSFTPCredentialsPerTenant {
+			return errTooManySFTPCredentials
+		}
+	}
+	item.tenant = tenant
+	r.items[key] = item
+	if err := r.persistLocked(); err != nil {
+		if existed {
+			r.items[key] = previous
+		} else {
+			delete(r.items, key)
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *sftpRegistry) delete(tenant, host string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := sftpCredentialKey(tenant, host)
+	previous, ok := r.items[key]
+	if !ok {
+		return false, nil
+	}
+	delete(r.items, key)
+	if err := r.persistLocked(); err != nil {
+		r.items[key] = previous
+		return false, err
+	}
+	return true, nil
+}
+
+// URL de medio de un job: además de http(s), sftp:// con las credenciales
+// que el tenant guardó para el host
+func validateJobMediaURL(rawURL string) (*url.URL, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.Scheme != "sftp" {
+		return validateMediaURL(rawURL)
+	}
+	if parsedURL.Hostname() == "" {
+		return nil, errors.New("URL must have a valid host")
+	}
+	if _, ok := parsedURL.User.Password(); ok {
+		return nil, errors.New("sftp URLs must not embed a password; store credentials with PUT /sftp/credentials/{host}")
+	}
+	if parsedURL.Path == "" || strings.HasSuffix(parsedURL.Path, "/") {
+		return nil, errors.New("sftp URL must point to a file")
+	}
+	return parsedURL, nil
+}
+
+// URL del medio para el backend. Los sftp:// los descarga siempre el
+// gateway y el backend, cuya url solo admite http(s), lee file_path.
+func backendMediaURL(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Scheme == "sftp" {
+		return ""
+	}
+	return rawURL
+}
+
+// Configuración SSH de las credenciales; valida la clave privada y la del host
+func (s SFTPCredential) clientConfig() (*ssh.ClientConfig, error) {
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s.HostKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid host_key")
+	}
+	config := &ssh.ClientConfig{
+		User:            s.Username,
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+	}
+	if s.secret.PrivateKey != "" {
+		var signer ssh.Signer
+		if s.secret.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(s.secret.PrivateKey), []byte(s.secret.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(s.secret.PrivateKey))
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid private_key")
+		}
+		config.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
+	} else {
+		config.Auth = []ssh.AuthMethod{ssh.Password(s.secret.Password)}
+	}
+	return config, nil
+}
+
+// GET /sftp/credentials lista los hosts SFTP del tenant, sin secretos
+func listSFTPCredentialsHandler(c *gin.Context) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"credentials": sftpCredentials.list(currentTenant(c))})
+}
+
+// PUT /sftp/credentials/:host guarda con qué usuario y contraseña o clave
+// privada se descargan los sftp:// de ese host, y la clave que debe
+// presentar el servidor
+func putSFTPCredentialHandler(c *gin.Context) {
+	var input SFTPCredentialBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	host := strings.ToLower(c.Param("host"))
+	if host == "" || len(host) > 253 || strings.ContainsAny(host, "/@?# ") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid host", "code": "INVALID_REQUEST"})
+		return
+	}
+	if (input.Password == "") == (input.PrivateKey == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of password or private_key is required", "code": "INVALID_REQUEST"})
+		return
+	}
+	now := time.Now()
+	item := &SFTPCredential{
+		Host:      host,
+		Username:  input.Username,
+		Auth:      "password",
+		CreatedAt: now,
+		UpdatedAt: now,
+		secret:    sftpSecret{Password: input.Password, PrivateKey: input.PrivateKey, Passphrase: input.Passphrase},
+	}
+	if input.PrivateKey != "" {
+		item.Auth = "private_key"
+	}
+	if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(input.HostKey)); err == nil {
+		item.HostKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	}
+	if _, err := item.clientConfig(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_REQUEST"})
+		return
+	}
+	if err := sftpCredentials.put(currentTenant(c), item); err != nil {
+		if err == errTooManySFTPCredentials {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+	public := *item
+	public.secret = sftpSecret{}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, public)
+}
+
+// DELETE /sftp/credentials/:host
+func deleteSFTPCredentialHandler(c *gin.Context) {
+	deleted, err := sftpCredentials.delete(currentTenant(c), c.Param("host"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SFTP credentials not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Respuesta SSH_FXP_STATUS distinta de OK
+type sftpStatusError struct {
+	code    uint32
+	message string
+}
+
+func (e *sftpStatusError) Error() string {
+	return fmt.Sprintf("SFTP server responded with status %d: %s", e.code, e.message)
+}
+
+// Subsistema sftp de una sesión SSH; una sola descarga a la vez
+type sftpConn struct {
+	w      io.WriteCloser
+	r      io.Reader
+	nextID uint32
+}
+
+func (s *sftpConn) send(kind byte, payload ...interface{}) (uint32, error) {
+	s.nextID++
+	buf := []byte{0, 0, 0, 0, kind}
+	if kind != sftpInit {
+		buf = binary.BigEndian.AppendUint32(buf, s.nextID)
+	}
+	for _, p := range payload {
+		switch v := p.(type) {
+		case uint32:
+			buf = binary.BigEndian.AppendUint32(buf, v)
+		case uint64:
+			buf = binary.BigEndian.AppendUint64(buf, v)
+		case string:
+			buf = binary.BigEndian.AppendUint32(buf, uint32(len(v)))
+			buf = append(buf, v...)
+		}
+	}
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+	if _, err := s.w.Write(buf); err != nil {
+		return 0, errors.Wrap(err, "failed to write SFTP request")
+	}
+	return s.nextID, nil
+}
+
+// Paquete recibido: tipo, id (salvo VERSION) y el resto
+func (s *sftpConn) recv() (byte, uint32, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(s.r, header[:]); err != nil {
+		return 0, 0, nil, errors.Wrap(err, "failed to read SFTP response")
+	}
+	n := binary.BigEndian.Uint32(header[:])
+	if n < 1 || n > sftpReadSize+1024 {
+		return 0, 0, nil, errors.Errorf("invalid SFTP packet length %d", n)
+	}
+	packet := make([]byte, n)
+	if _, err := io.ReadFull(s.r, packet); err != nil {
+		return 0, 0, nil, errors.Wrap(err, "failed to read SFTP response")
+	}
+	if packet[0] == sftpVersion || len(packet) < 5 {
+		return packet[0], 0, packet[1:], nil
+	}
+	return packet[0], binary.BigEndian.Uint32(packet[1:5]), packet[5:], nil
+}
+
+// Cadena SFTP al principio de data y lo que queda detrás
+func sftpString(data []byte) (string, []byte, bool) {
+	if len(data) < 4 {
+		return "", nil, false
+	}
+	n := binary.BigEndian.Uint32(data)
+	if uint64(len(data)-4) < uint64(n) {
+		return "", nil, false
+	}
+	return string(data[4 : 4+n]), data[4+n:], true
+}
+
+func sftpStatusErr(data []byte) error {
+	if len(data) < 4 {
+		return errors.New("invalid SFTP status response")
+	}
+	message, _, _ := sftpString(data[4:])
+	return &sftpStatusError{code: binary.BigEndian.Uint32(data), message: message}
+}
+
+// Respuesta a una petición que no sea READ
+func (s *sftpConn) expect(id uint32, kind byte) ([]byte, error) {
+	got, gotID, data, err := s.recv()
+	if err != nil {
+		return nil, err
+	}
+	if gotID != id {
+		return nil, errors.Errorf("unexpected SFTP response id %d", gotID)
+	}
+	if got == sftpStatus && kind != sftpStatus {
+		return nil, sftpStatusErr(data)
+	}
+	if got != kind {
+		return nil, errors.Errorf("unexpected SFTP response type %d", got)
+	}
+	return data, nil
+}
+
+// Petición cuya respuesta es un SSH_FXP_STATUS; nil si es OK
+func (s *sftpConn) call(kind byte, payload ...interface{}) error {
+	id, err := s.send(kind, payload...)
+	if err != nil {
+		return err
+	}
+	data, err := s.expect(id, sftpStatus)
+	if err != nil {
+		return err
+	}
+	if err := sftpStatusErr(data); err.(*sftpStatusError).code != sftpStatusOK {
+		return err
+	}
+	return nil
+}
+
+// Abre el subsistema sftp en el host de u con las credenciales del tenant
+// (y el usuario de u, si lo lleva). La función devuelta cierra la sesión y
+// la conexión; cancelar ctx desbloquea cualquier lectura.
+func openSFTP(ctx context.Context, tenant string, u *url.URL) (*sftpConn, func(), error) {
+	cred, ok := sftpCredentials.lookup(tenant, u.Hostname())
+	if !ok {
+		return nil, nil, errNoSFTPCredential
+	}
+	config, err := cred.clientConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.User != nil && u.User.Username() != "" {
+		config.User = u.User.Username()
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to connect to SFTP server")
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	var client *ssh.Client
+	var session *ssh.Session
+	shutdown := func() {
+		if session != nil {
+			session.Close()
+		}
+		if client != nil {
+			client.Close()
+		}
+		close(done)
+		conn.Close()
+	}
+	fail := func(err error) (*sftpConn, func(), error) {
+		shutdown()
+		return nil, nil, err
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		return fail(errors.Wrap(err, "SSH handshake failed"))
+	}
+	client = ssh.NewClient(sshConn, chans, reqs)
+	if session, err = client.NewSession(); err != nil {
+		return fail(errors.Wrap(err, "failed to open SSH session"))
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		return fail(errors.Wrap(err, "failed to open SFTP channel"))
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		return fail(errors.Wrap(err, "failed to open SFTP channel"))
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return fail(errors.Wrap(err, "SFTP subsystem not available"))
+	}
+
+	s := &sftpConn{w: w, r: r}
+	if _, err := s.send(sftpInit, uint32(3)); err != nil {
+		return fail(err)
+	}
+	if kind, _, _, err := s.recv(); err != nil {
+		return fail(err)
+	} else if kind != sftpVersion {
+		return fail(errors.Errorf("unexpected SFTP response type %d", kind))
+	}
+	return s, shutdown, nil
+}
+
+// Descarga (o continúa) por SFTP el archivo parcial con las credenciales
+// del tenant para el host
+func fetchSFTP(ctx context.Context, jobID, tenant string, u *url.URL, partPath string) error {
+	s, closeSFTP, err := openSFTP(ctx, tenant, u)
+	if err != nil {
+		return err
+	}
+	defer closeSFTP()
+	id, err := s.send(sftpOpen, u.Path, uint32(1), uint32(0)) // SSH_FXF_READ, sin atributos
+	if err != nil {
+		return err
+	}
+	data, err := s.expect(id, sftpHandle)
+	if err != nil {
+		return err
+	}
+	handle, _, ok := sftpString(data)
+	if !ok {
+		return errors.New("invalid SFTP handle response")
+	}
+	defer s.send(sftpClose, handle)
+
+	// Tamaño del archivo si el servidor lo da (SSH_FILEXFER_ATTR_SIZE)
+	total := int64(-1)
+	if id, err = s.send(sftpFstat, handle); err != nil {
+		return err
+	}
+	if data, err = s.expect(id, sftpAttrs); err != nil {
+		return err
+	}
+	if len(data) >= 12 && binary.BigEndian.Uint32(data)&1 != 0 {
+		total = int64(binary.BigEndian.Uint64(data[4:]))
+	}
+	maxBytes := cfg.MaxDownloadMB * 1024 * 1024
+	if maxBytes > 0 && total > maxBytes {
+		return errTooLarge
+	}
+
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+	if total >= 0 && offset > total {
+		offset = 0
+	}
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open download file")
+	}
+	defer file.Close()
+	if err := file.Truncate(offset); err != nil {
+		return errors.Wrap(err, "failed to open download file")
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to open download file")
+	}
+
+	// Varias lecturas en vuelo; se escriben en orden. Ante una lectura corta
+	// se descartan las pendientes y se sigue desde donde acabó.
+	type pendingRead struct {
+		id     uint32
+		offset int64
+	}
+	var pending []pendingRead
+	responses := make(map[uint32][]byte)
+	kinds := make(map[uint32]byte)
+	written, next := offset, offset
+	lastReport := time.Time{}
+	for {
+		for len(pending) < sftpReadWindow && (total < 0 || next < total) && (total >= 0 || len(pending) == 0) {
+			id, err := s.send(sftpRead, handle, uint64(next), uint32(sftpReadSize))
+			if err != nil {
+				return err
+			}
+			pending = append(pending, pendingRead{id: id, offset: next})
+			next += sftpReadSize
+		}
+		if len(pending) == 0 {
+			break
+		}
+		head := pending[0]
+		for {
+			if _, ok := kinds[head.id]; ok {
+				break
+			}
+			kind, id, data, err := s.recv()
+			if err != nil {
+				return err
+			}
+			for _, p := range pending {
+				if p.id == id {
+					kinds[id], responses[id] = kind, data
+					break
+				}
+			}
+		}
+		kind, data := kinds[head.id], responses[head.id]
+		delete(kinds, head.id)
+		delete(responses, head.id)
+		pending = pending[1:]
+
+		if kind == sftpStatus {
+			err := sftpStatusErr(data)
+			if status, ok := err.(*sftpStatusError); ok && status.code == sftpStatusEOF {
+				break
+			}
+			return err
+		}
+		if kind != sftpData {
+			return errors.Errorf("unexpected SFTP response type %d", kind)
+		}
+		chunk, _, ok := sftpString(data)
+		if !ok {
+			return errors.New("invalid SFTP data response")
+		}
+		if _, err := file.WriteString(chunk); err != nil {
+			return errors.Wrap(err, "failed to write download file")
+		}
+		written += int64(len(chunk))
+		if maxBytes > 0 && written > maxBytes {
+			return errTooLarge
+		}
+		if len(chunk) < sftpReadSize && (total < 0 || written < total) {
+			for _, p := range pending {
+				delete(kinds, p.id)
+				delete(responses, p.id)
+			}
+			pending = nil
+			next = written
+			if total < 0 && len(chunk) == 0 {
+				break
+			}
+		}
+		if time.Since(lastReport) >= progressInterval {
+			reportDownloadProgress(jobID, written, total)
+			lastReport = time.Now()
+		}
+	}
+	reportDownloadProgress(jobID, written, total)
+	return nil
+}
+
+// Crea (o trunca) el archivo p en el servidor y escribe content
+func (s *sftpConn) writeFile(p string, content []byte) error {
+	id, err := s.send(sftpOpen, p, uint32(0x02|0x08|0x10), uint32(0)) // SSH_FXF_WRITE|CREAT|TRUNC, sin atributos
+	if err != nil {
+		return err
+	}
+	data, err := s.expect(id, sftpHandle)
+	if err != nil {
+		return err
+	}
+	handle, _, ok := sftpString(data)
+	if !ok {
+		return errors.New("invalid SFTP handle response")
+	}
+	for offset := 0; offset < len(content); offset += sftpReadSize {
+		end := offset + sftpReadSize
+		if end > len(content) {
+			end = len(content)
+		}
+		if err := s.call(sftpWrite, handle, uint64(offset), string(content[offset:end])); err != nil {
+			s.call(sftpClose, handle)
+			return err
+		}
+	}
+	return s.call(sftpClose, handle)
+}
+
+// Sube los archivos bajo la ruta de u con las credenciales del tenant para
+// el host y devuelve sus URLs. Cada uno se escribe como .part y se renombra
+// al terminar, para que quien vigile la carpeta no lea uno a medias.
+func pushSFTP(ctx context.Context, tenant string, u *url.URL, files []destinationFile) ([]string, error) {
+	s, closeSFTP, err := openSFTP(ctx, tenant, u)
+	if err != nil {
+		return nil, err
+	}
+	defer closeSFTP()
+	created := make(map[string]bool)
+	var written []string
+	for _, f := range files {
+		// Directorios intermedios; MKDIR falla si ya existen
+		dir := u.Path
+		for _, segment := range strings.Split(path.Dir(f.Key), "/") {
+			if segment == "." {
+				break
+			}
+			dir = path.Join(dir, segment)
+			if created[dir] {
+				continue
+			}
+			created[dir] = true
+			if err := s.call(sftpMkdir, dir, uint32(0)); err != nil {
+				if _, ok := err.(*sftpStatusError); !ok {
+					return nil, err
+				}
+			}
+		}
+		target := path.Join(u.Path, f.Key)
+		part := target + ".part"
+		if err := s.writeFile(part, f.Content); err != nil {
+			return nil, errors.Wrapf(err, "write %s", part)
+		}
+		// RENAME de la versión 3 no sobrescribe
+		if err := s.call(sftpRemove, target); err != nil {
+			if status, ok := err.(*sftpStatusError); !ok || status.code != sftpStatusNoSuchFile {
+				return nil, errors.Wrapf(err, "replace %s", target)
+			}
+		}
+		if err := s.call(sftpRename, part, target); err != nil {
+			return nil, errors.Wrapf(err, "rename %s", part)
+		}
+		written = append(written, "sftp://"+u.Host+"/"+strings.TrimPrefix(target, "/"))
+	}
+	return written, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Servidor SFTP mínimo para las pruebas: solo lectura de files, con lo
+// que usa fetchSFTP (OPEN, FSTAT, READ y CLOSE)
+type testSFTPServer struct {
+	addr    string
+	hostKey string // formato authorized_keys
+	files   map[string][]byte
+}
+
+func startSFTPServer(t *testing.T, user, password string, files map[string][]byte) *testSFTPServer {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if conn.User() == user && string(pass) == password {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	s := &testSFTPServer{
+		addr:    listener.Addr().String(),
+		hostKey: strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))),
+		files:   files,
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serveConn(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *testSFTPServer) serveConn(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "only sessions")
+			continue
+		}
+		ch, requests, err := newChan.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					go s.serveSFTP(ch)
+				}
+			}
+		}()
+	}
+}
+
+func (s *testSFTPServer) serveSFTP(ch ssh.Channel) {
+	defer ch.Close()
+	reply := func(kind byte, id uint32, payload ...interface{}) {
+		buf := []byte{0, 0, 0, 0, kind}
+		if kind != sftpVersion {
+			buf = binary.BigEndian.AppendUint32(buf, id)
+		}
+		for _, p := range payload {
+			switch v := p.(type) {
+			case uint32:
+				buf = binary.BigEndian.AppendUint32(buf, v)
+			case uint64:
+				buf = binary.BigEndian.AppendUint64(buf, v)
+			case string:
+				buf = binary.BigEndian.AppendUint32(buf, uint32(len(v)))
+				buf = append(buf, v...)
+			}
+		}
+		binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+		ch.Write(buf)
+	}
+	status := func(id, code uint32) { reply(sftpStatus, id, code, "", "") }
+
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(ch, header[:]); err != nil {
+			return
+		}
+		packet := make([]byte, binary.BigEndian.Uint32(header[:]))
+		if _, err := io.ReadFull(ch, packet); err != nil || len(packet) < 5 {
+			return
+		}
+		kind, id, data := packet[0], binary.BigEndian.Uint32(packet[1:5]), packet[5:]
+		switch kind {
+		case sftpInit:
+			reply(sftpVersion, 0, uint32(3))
+		case sftpOpen:
+			p, _, _ := sftpString(data)
+			if _, ok := s.files[p]; !ok {
+				status(id, sftpStatusNoSuchFile)
+				continue
+			}
+			reply(sftpHandle, id, p)
+		case sftpFstat:
+			handle, _, _ := sftpString(data)
+			reply(sftpAttrs, id, uint32(1), uint64(len(s.files[handle])))
+		case sftpRead:
+			handle, rest, _ := sftpString(data)
+			content := s.files[handle]
+			offset, size := binary.BigEndian.Uint64(rest), binary.BigEndian.Uint32(rest[8:])
+			if offset >= uint64(len(content)) {
+				status(id, sftpStatusEOF)
+				continue
+			}
+			end := offset + uint64(size)
+			if end > uint64(len(content)) {
+				end = uint64(len(content))
+			}
+			reply(sftpData, id, string(content[offset:end]))
+		case sftpClose:
+			status(id, sftpStatusOK)
+		default:
+			status(id, 8) // SSH_FX_OP_UNSUPPORTED
+		}
+	}
+}
+
+// Un job sftp:// se descarga en el gateway y llega al backend solo con
+// file_path: la url del backend Python no admite sftp
+func TestSFTPJobLifecycle(t *testing.T) {
+	wav := append([]byte("RIFF\x24\x00\x00\x00WAVEfmt "), make([]byte, 100*1024)...)
+	server := startSFTPServer(t, "media", "s3cret", map[string][]byte{"/inbox/call.wav": wav})
+	mock, backend := startMock(t)
+	gateway := newTestGateway(t, nil, backend)
+
+	host, _, _ := net.SplitHostPort(server.addr)
+	resp, out := apiRequest(t, http.MethodPut, gateway.URL+"/sftp/credentials/"+host, map[string]string{
+		"username": "media",
+		"password": "s3cret",
+		"host_key": server.hostKey,
+	})
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT /sftp/credentials: status %d, body %v", resp.StatusCode, out)
+	}
+	t.Cleanup(func() { sftpCredentials.delete("acme", host) })
+
+	job := waitJob(t, gateway, submitJob(t, gateway, map[string]interface{}{"url": "sftp://" + server.addr + "/inbox/call.wav"}))
+	if job["status"] != "completed" {
+		t.Fatalf("status = %v, want completed (error %v)", job["status"], job["error"])
+	}
+	reqs := mock.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("backend requests = %+v, want 1", reqs)
+	}
+	if reqs[0].URL != "" || !strings.HasSuffix(reqs[0].FilePath, ".wav") {
+		t.Errorf("backend request url %q, file_path %q; want no url and the downloaded file", reqs[0].URL, reqs[0].FilePath)
+	}
+}
+
+// La caché es de todos los tenants: un sftp:// se lee con las credenciales
+// de uno y su resultado no se le sirve a otro
+func TestSFTPResultsNotCached(t *testing.T) {
+	rc := &resultCache{}
+	for rawURL, want := range map[string]bool{
+		"https://example.com/a.mp3":     true,
+		"http://example.com/a.mp3":      true,
+		"sftp://media.acme/inbox/a.wav": false,
+		"":                              false,
+	} {
+		if got := rc.cacheable(RequestBody{URL: rawURL}); got != want {
+			t.Errorf("cacheable(%q) = %v, want %v", rawURL, got, want)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Ruta pública de los enlaces de POST /jobs/:job_id/share
+const sharedPathPrefix = "/shared/"
+
+type ShareBody struct {
+	ExpiresIn Duration `json:"expires_in"` // por defecto SHARE_LINK_TTL
+}
+
+// Enlace público de solo lectura a la transcripción de un job
+type ShareLink struct {
+	URL       string    `json:"url"`      // página HTML
+	JSONURL   string    `json:"json_url"` // documento versionado, como /result/:job_id/transcript
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Firma de un enlace. epoch es el de jobMeta: revocar lo incrementa y
+// invalida todos los enlaces anteriores del job.
+func shareSignature(jobID string, expires int64, epoch int) string {
+	mac := hmac.New(sha256.New, []byte(cfg.ShareSigningKey))
+	fmt.Fprintf(mac, "share\n%s\n%d\n%d", jobID, expires, epoch)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func shareURL(jobID string, expires int64, epoch int, format string) string {
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("sig", shareSignature(jobID, expires, epoch))
+	if format != "" {
+		q.Set("format", format)
+	}
+	return strings.TrimRight(cfg.PublicBaseURL, "/") + sharedPathPrefix + url.PathEscape(jobID) + "?" + q.Encode()
+}
+
+// POST /jobs/:job_id/share crea un enlace firmado y con caducidad que
+// muestra la transcripción sin autenticación
+func createShareHandler(c *gin.Context) {
+	if cfg.ShareSigningKey == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "share signing key is not configured", "code": "SHARE_NOT_CONFIGURED"})
+		return
+	}
+	var input ShareBody
+	// Cuerpo opcional
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ttl := input.ExpiresIn.Duration
+	if ttl == 0 {
+		ttl = cfg.ShareLinkTTL.Duration
+	}
+	if ttl < time.Minute || ttl > cfg.ShareLinkMaxTTL.Duration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("expires_in must be between 1m and %s", cfg.ShareLinkMaxTTL.Duration), "code": "INVALID_REQUEST"})
+		return
+	}
+	jobID := c.Param("job_id")
+	job, exists := getJob(jobID)
+	// Un enlace firmado no lleva tenant: se comprueba antes de firmarlo
+	if meta, _ := getJobMeta(jobID); !exists || !canSeeJob(c, meta) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if job.Type != JobTypeTranscription || job.Status != "completed" || job.PurgedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "only completed jobs with their transcript can be shared"})
+		return
+	}
+
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	by := "anonymous"
+	if key := currentAPIKey(c); key != nil {
+		by = key.Name
+	}
+	mu.Lock()
+	meta, ok := jobMetas[jobID]
+	epoch := 0
+	if ok {
+		epoch = meta.ShareEpoch
+		appendEventLocked(jobID, JobEvent{Type: EventShare, Message: fmt.Sprintf("share link created by %s, expires %s", by, expiresAt.UTC().Format(time.RFC3339))})
+	}
+	unlockJobs()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusCreated, ShareLink{
+		URL:       shareURL(jobID, expiresAt.Unix(), epoch, ""),
+		JSONURL:   shareURL(jobID, expiresAt.Unix(), epoch, "json"),
+		ExpiresAt: expiresAt,
+	})
+}
+
+// DELETE /jobs/:job_id/share revoca todos los enlaces creados hasta ahora
+func revokeSharesHandler(c *gin.Context) {
+	jobID := c.Param("job_id")
+	mu.Lock()
+	meta, ok := jobMetas[jobID]
+	ok = ok && canSeeJob(c, *meta)
+	if ok {
+		meta.ShareEpoch++
+		appendEventLocked(jobID, JobEvent{Type: EventShare, Message: "share links revoked"})
+	}
+	unlockJobs()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GET /shared/:job_id?expires=&sig= muestra la transcripción en HTML, el
+// documento versionado con format=json o el reproductor de /jobs/:job_id/embed
+// con format=embed. Sin API key: vale la firma.
+func sharedTranscriptHandler(c *gin.Context) {
+	jobID := c.Param("job_id")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	meta, ok := getJobMeta(jobID)
+	// Un job borrado da el mismo error que una firma mala
+	if cfg.ShareSigningKey == "" || err != nil || time.Now().Unix() > expires || !ok ||
+		!hmac.Equal([]byte(shareSignature(jobID, expires, meta.ShareEpoch)), []byte(c.Query("sig"))) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "link expired or invalid"})
+		return
+	}
+	job, ok := getJob(jobID)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "link expired or invalid"})
+		return
+	}
+	if job.PurgedAt != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "the transcript was deleted by the retention policy"})
+		return
+	}
+	doc := transcriptDocumentV1(jobID, job)
+	c.Header("Cache-Control", "private, no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("X-Robots-Tag", "noindex, nofollow")
+	switch c.DefaultQuery("format", "html") {
+	case "json":
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.JSON(http.StatusOK, doc)
+	case "html":
+		var page strings.Builder
+		if err := sharedPageTemplate.Execute(&page, sharedPage{Doc: doc, Labels: pageLabels(c)}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render transcript", "code": "RENDER_FAILED"})
+			return
+		}
+		// La página no carga nada de fuera; solo su propio estilo
+		c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page.String()))
+	case "embed":
+		renderEmbed(c, doc)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be html, json or embed", "code": "INVALID_REQUEST"})
+	}
+}
+
+// Textos de la página, en el idioma de Accept-Language
+type sharedLabels struct {
+	Title, Translation, Duration string
+}
+
+var sharedPageLabels = map[string]sharedLabels{
+	LangEnglish: {"Transcript", "Translation", "Duration"},
+	LangSpanish: {"Transcripción", "Traducción", "Duración"},
+	LangYoruba:  {"Àkọsílẹ̀", "Ìtumọ̀", "Gígùn"},
+}
+
+// Textos en el idioma negociado para el error (inglés si no hay)
+func pageLabels(c *gin.Context) sharedLabels {
+	if labels, ok := sharedPageLabels[c.GetString(ctxLanguage)]; ok {
+		return labels
+	}
+	return sharedPageLabels[LangEnglish]
+}
+
+type sharedPage struct {
+	Doc    TranscriptDocument
+	Labels sharedLabels
+}
+
+// 75.5 -> "1:15"; con horas, "1:02:03"
+func clockTime(seconds float64) string {
+	s := int(seconds)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+var sharedPageTemplate = template.Must(template.New("shared").Funcs(template.FuncMap{"clock": clockTime}).Parse(`<!DOCTYPE html>
+<html{{with .Doc.Language}} lang="{{.}}"{{end}}>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex, nofollow">
+<title>{{.Labels.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; line-height: 1.5; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+.meta, time { color: #777; font-variant-numeric: tabular-nums; }
+time { margin-right: .5rem; }
+.speaker { font-weight: 600; margin-right: .5rem; }
+p { margin: .3rem 0; }
+</style>
+</head>
+<body>
+<h1>{{.Labels.Title}}</h1>
+<p class="meta">{{.Labels.Duration}}: {{clock .Doc.Duration}}</p>
+{{range .Doc.Segments}}<p><time>{{clock .Start}}</time>{{with .Speaker}}<span class="speaker">{{.}}</span>{{end}}{{.Text}}</p>
+{{else}}<p>{{.Doc.Text}}</p>
+{{end}}{{with .Doc.Translation}}<h2>{{$.Labels.Translation}}</h2>
+<p>{{.}}</p>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// Cabeceras de una petición firmada
+const (
+	keyIDHeader     = "X-Key-ID"    // ID de la key gestionada o nombre de la estática
+	signatureHeader = "X-Signature" // como X-Webhook-Signature: t=<unix>,v1=<hex>
+)
+
+// El cuerpo se lee entero para comprobar la firma; los medios más grandes
+// se suben por partes con tus, cada PATCH firmado
+const maxSignedBodyBytes = 64 << 20
+
+// Prefijo en Redis de las firmas ya usadas
+const signatureReplayPrefix = "tw:signature:"
+
+// Error de autenticación de una petición firmada, con su código estable
+type signatureError struct {
+	status int
+	code   string
+	err    error
+}
+
+func (e *signatureError) Error() string {
+	return e.err.Error()
+}
+
+func unauthorizedSignature(code, message string) *signatureError {
+	return &signatureError{http.StatusUnauthorized, code, errors.New(message)}
+}
+
+// Firmas vistas dentro de la ventana de REQUEST_SIGNATURE_TOLERANCE. Con
+// REDIS_URL se comparten entre réplicas; sin Redis cada réplica recuerda
+// solo las suyas.
+type replayGuard struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time // firma → hasta cuándo se recuerda
+	nextSweep time.Time
+	client    *redis.Client
+}
+
+var signatureReplays = &replayGuard{seen: make(map[string]time.Time)}
+
+// Anota la firma; false si ya se había usado
+func (g *replayGuard) claim(ctx context.Context, sig string, ttl time.Duration) (bool, error) {
+	if g.client != nil {
+		ok, err := g.client.SetNX(ctx, signatureReplayPrefix+sig, 1, ttl).Result()
+		return ok, errors.Wrap(err, "failed to check request signature replay")
+	}
+	now := time.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if now.After(g.nextSweep) {
+		for s, until := range g.seen {
+			if now.After(until) {
+				delete(g.seen, s)
+			}
+		}
+		g.nextSweep = now.Add(ttl)
+	}
+	if until, ok := g.seen[sig]; ok && now.Before(until) {
+		return false, nil
+	}
+	g.seen[sig] = now.Add(ttl)
+	return true, nil
+}
+
+// Texto firmado: "<t>.<método>.<ruta con query>.<cuerpo>". A diferencia de
+// los webhooks entran el método y la ruta, para que la firma de una
+// petición no sirva para otra con el mismo cuerpo.
+func requestHMAC(secret, ts, method, uri string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "." + method + "." + uri + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Timestamp y firmas v1 de X-Signature
+func parseSignatureHeader(header string) (int64, []string, error) {
+	var ts int64
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "t":
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return 0, nil, errors.New("invalid signature timestamp")
+			}
+			ts = parsed
+		case "v1":
+			sigs = append(sigs, strings.ToLower(value))
+		}
+	}
+	if ts == 0 || len(sigs) == 0 {
+		return 0, nil, errors.New("X-Signature must be t=<unix>,v1=<hex>")
+	}
+	return ts, sigs, nil
+}
+
+// Key que firma la petición y los secretos con los que puede hacerlo
+func signingKey(id string) (*APIKey, []string) {
+	for i := range cfg.APIKeys {
+		if cfg.APIKeys[i].Name == id {
+			return &cfg.APIKeys[i], []string{liveSecret(&cfg.APIKeys[i].Key)}
+		}
+	}
+	return managedKeys.signingKey(id)
+}
+
+// Autentica una petición con X-Key-ID y X-Signature en lugar del secreto:
+// el timestamp debe estar dentro de REQUEST_SIGNATURE_TOLERANCE y la firma
+// no puede haberse usado antes. Deja el cuerpo listo para el handler.
+func verifySignedRequest(c *gin.Context) (*APIKey, *signatureError) {
+	ts, sigs, err := parseSignatureHeader(c.GetHeader(signatureHeader))
+	if err != nil {
+		return nil, unauthorizedSignature("INVALID_SIGNATURE", err.Error())
+	}
+	tolerance := cfg.RequestSignatureTolerance.Duration
+	if skew := time.Since(time.Unix(ts, 0)); skew > tolerance || skew < -tolerance {
+		return nil, unauthorizedSignature("SIGNATURE_EXPIRED", "request timestamp is outside the allowed window")
+	}
+	id := c.GetHeader(keyIDHeader)
+	key, secrets := signingKey(id)
+	if key == nil || len(secrets) == 0 {
+		return nil, unauthorizedSignature("INVALID_SIGNATURE", "unknown key or key does not accept signed requests")
+	}
+
+	var body []byte
+	if c.Request.Body != nil {
+		body, err = io.ReadAll(io.LimitReader(c.Request.Body, maxSignedBodyBytes+1))
+		if err != nil {
+			return nil, &signatureError{http.StatusBadRequest, "INVALID_REQUEST", errors.Wrap(err, "failed to read request body")}
+		}
+		if len(body) > maxSignedBodyBytes {
+			return nil, &signatureError{http.StatusRequestEntityTooLarge, "UPLOAD_TOO_LARGE", errors.Errorf("signed request bodies are limited to %d MB; upload larger media with tus", maxSignedBodyBytes>>20)}
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	stamp := strconv.FormatInt(ts, 10)
+	matched := ""
+	for _, secret := range secrets {
+		expected := requestHMAC(secret, stamp, c.Request.Method, c.Request.URL.RequestURI(), body)
+		for _, sig := range sigs {
+			if hmac.Equal([]byte(expected), []byte(sig)) {
+				matched = expected
+			}
+		}
+	}
+	if matched == "" {
+		return nil, unauthorizedSignature("INVALID_SIGNATURE", "request signature does not match")
+	}
+	// Pasada la ventana el timestamp ya la rechaza
+	fresh, err := signatureReplays.claim(c.Request.Context(), matched, 2*tolerance)
+	if err != nil {
+		return nil, &signatureError{http.StatusServiceUnavailable, "STATE_UNAVAILABLE", err}
+	}
+	if !fresh {
+		return nil, unauthorizedSignature("REPLAYED_REQUEST", "request signature was already used")
+	}
+	managedKeys.touch(id)
+	return key, nil
+}
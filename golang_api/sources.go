@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Origen de los jobs de la ingesta de S3; los de las integraciones usan su
+// proveedor (google_drive, dropbox, twilio, zoom, email, telegram o whatsapp)
+const SourceS3 = "s3"
+
+// Medio del que sale un job
+type jobSource struct {
+	Kind        string `json:"kind"`
+	Bucket      string `json:"bucket,omitempty"`      // s3
+	Key         string `json:"key,omitempty"`         // s3: clave; dropbox: ruta; google_drive: id del archivo; twilio y zoom: grabación; email y bots: mensaje
+	Integration string `json:"integration,omitempty"` // carpeta vigilada, twilio, zoom, email o bot
+	Folder      string `json:"folder,omitempty"`      // google_drive: carpeta en la que se escribe
+	Name        string `json:"name,omitempty"`        // nombre del archivo
+	URL         string `json:"url,omitempty"`         // zoom: download_url de la grabación
+	ReplyTo     string `json:"reply_to,omitempty"`    // email: remitente al que se responde; bots: chat
+	Media       string `json:"media,omitempty"`       // bots: id (discord: enlace) del audio adjunto
+}
+
+func (s *jobSource) String() string {
+	switch s.Kind {
+	case SourceS3:
+		return s.Kind + "://" + s.Bucket + "/" + s.Key
+	case ProviderDropbox, ProviderTwilio, ProviderZoom:
+		return s.Kind + ":" + s.Key
+	case ProviderTelegram, ProviderWhatsApp, ProviderDiscord:
+		return s.Kind + ":" + s.ReplyTo + "/" + s.Key
+	}
+	return s.Kind + ":" + s.Name
+}
+
+// Extensión de uno de los formatos admitidos; excluye lo que escribe la
+// propia ingesta
+func isIngestMedia(name string) bool {
+	ext := strings.TrimPrefix(strings.ToLower(path.Ext(name)), ".")
+	for _, f := range cfg.SupportedFormats {
+		if ext == f {
+			return true
+		}
+	}
+	return false
+}
+
+// Nombre del archivo hermano con otra extensión: memo.m4a -> memo.txt
+func siblingName(name, ext string) string {
+	return strings.TrimSuffix(name, path.Ext(name)) + "." + ext
+}
+
+// Crea el job de un medio de origen, salvo que ya exista. Devuelve si lo
+// creó.
+func createSourcedJob(jobID, tenant string, input RequestBody, source *jobSource) bool {
+	if sourcedJobExists(jobID) {
+		return false
+	}
+	mu.Lock()
+	if _, exists := jobStore[jobID]; exists {
+		unlockJobs()
+		return false
+	}
+	jobStore[jobID] = &JobState{
+		Type:      input.Type,
+		Status:    "queued",
+		Tags:      input.Tags,
+		Metadata:  input.Metadata,
+		Priority:  input.Priority,
+		Timestamp: time.Now(),
+	}
+	jobMetas[jobID] = &jobMeta{Input: input, Tenant: tenant, Source: source}
+	if cfg.Role == RoleAPI {
+		unadoptedJobs[jobID] = true
+	}
+	appendEventLocked(jobID, JobEvent{Type: EventStatus, Status: "queued", Message: "created from " + source.String()})
+	unlockJobs()
+
+	if cfg.Role == RoleAll {
+		startJob(jobID, input, nil, false)
+	}
+	return true
+}
+
+// Indica si ya hay un job con ese ID, aunque lo creara un líder anterior
+func sourcedJobExists(jobID string) bool {
+	if cfg.Role == RoleAPI {
+		refreshJob(context.Background(), jobID)
+	}
+	_, exists := getJob(jobID)
+	return exists
+}
+
+// Descarga de los orígenes cuyo medio se copia al almacén al ejecutar el
+// job (Zoom y los audios de los bots); nil en el resto
+func sourceStager(source *jobSource) func(meta jobMeta) (string, error) {
+	switch {
+	case source == nil:
+		return nil
+	case source.Kind == ProviderZoom:
+		return stageZoomRecording
+	case isBotProvider(source.Kind) && source.Media != "":
+		return stageBotMedia
+	}
+	return nil
+}
+
+// Enlace firmado y nuevo al medio de origen. Las carpetas vigiladas copian
+// el archivo al almacén y el job lo lee de su upload_id.
+func sourceURL(ctx context.Context, source *jobSource) (string, error) {
+	if source.Kind != SourceS3 {
+		return "", errors.Errorf("unsupported job source %q", source.Kind)
+	}
+	return s3SourceURL(ctx, source)
+}
+
+// Copia el medio de origen al almacén como un upload del tenant; el job lo
+// lee de su upload_id
+func stageSourceMedia(ctx context.Context, tenant, ext string, r io.Reader, size int64) (string, error) {
+	uploadID := uuid.NewString() + strings.ToLower(ext)
+	if err := artifacts.Put(ctx, presignedUploadKey(tenant, uploadID), r, size, "application/octet-stream"); err != nil {
+		return "", errors.Wrap(err, "failed to store file")
+	}
+	return uploadID, nil
+}
+
+// Archivo que escribe un mensaje writeback de una carpeta vigilada
+type writeBackFile struct {
+	Format string `json:"format"` // txt o srt
+}
+
+// Al terminar un job con origen, encola la escritura del resultado junto
+// al medio: en S3 el JSON del resultado (o del error), en las carpetas
+// vigiladas el .txt y, si hay segmentos, el .srt, y por correo o en el chat
+// del bot la respuesta al remitente. Requiere mu tomado.
+func notifyWriteBackLocked(jobID, status string) {
+	meta, ok := jobMetas[jobID]
+	// Un job skipped no deja nada junto al medio ni responde al remitente
+	if !ok || meta.Source == nil || !isTerminalStatus(status) || status == "skipped" {
+		return
+	}
+	if meta.Source.Kind == SourceS3 {
+		event := WebhookJobCompleted
+		if status != "completed" {
+			event = WebhookJobFailed
+		}
+		enqueueOutboxLocked(jobID, OutboxMessage{Kind: OutboxWriteBack, Target: meta.Source.Bucket, Event: event})
+		return
+	}
+	if meta.Source.Kind == ProviderEmail || isBotProvider(meta.Source.Kind) {
+		event := WebhookJobCompleted
+		if status != "completed" {
+			event = WebhookJobFailed
+		}
+		enqueueOutboxLocked(jobID, OutboxMessage{Kind: OutboxWriteBack, Target: meta.Source.ReplyTo, Event: event})
+		return
+	}
+	job := jobStore[jobID]
+	if !isWatchProvider(meta.Source.Kind) || status != "completed" || job.Transcription == "" {
+		return
+	}
+	formats := []string{"txt"}
+	if len(job.Segments) > 0 {
+		formats = append(formats, "srt")
+	}
+	for _, format := range formats {
+		payload, _ := json.Marshal(writeBackFile{Format: format})
+		enqueueOutboxLocked(jobID, OutboxMessage{Kind: OutboxWriteBack, Target: meta.Source.Integration, Event: WebhookJobCompleted, Payload: payload})
+	}
+}
+
+// Un intento de escritura desde el outbox. El resultado se lee al
+// entregar, así que incluye lo editado mientras esperaba.
+func deliverWriteBack(jobID string, msg OutboxMessage) (string, error) {
+	job, ok := getJob(jobID)
+	meta, _ := getJobMeta(jobID)
+	if !ok || meta.Source == nil {
+		return "", errOutboxDiscard
+	}
+	if meta.Source.Kind == SourceS3 {
+		return writeS3Result(jobID, job, meta.Source, msg.Event)
+	}
+	if meta.Source.Kind == ProviderEmail {
+		return sendEmailReply(job, meta, msg.Event)
+	}
+	if isBotProvider(meta.Source.Kind) {
+		return sendBotReply(job, meta, msg.Event)
+	}
+	var file writeBackFile
+	if err := json.Unmarshal(msg.Payload, &file); err != nil {
+		return "", errOutboxDiscard
+	}
+	return writeConnectorFile(job, meta, file.Format)
+}
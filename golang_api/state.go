@@ -0,0 +1,515 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Copia persistente de un job: estado público, datos internos, historial y
+// entregas pendientes
+type JobRecord struct {
+	ID     string          `json:"id"`
+	Job    JobState        `json:"job"`
+	Meta   jobMeta         `json:"meta"`
+	Events []JobEvent      `json:"events"`
+	Outbox []OutboxMessage `json:"outbox,omitempty"`
+
+	// Concesión vigente o caducada; el almacén la guarda aparte del job
+	Claim *JobClaim `json:"-"`
+}
+
+// Persistencia del estado de los jobs para sobrevivir a reinicios
+type StateStore interface {
+	SaveJob(rec JobRecord) error
+	// Las lecturas paran cuando vence ctx (el plazo de la petición)
+	LoadJobs(ctx context.Context) ([]JobRecord, error)
+	// nil si el job no existe
+	LoadJob(ctx context.Context, jobID string) (*JobRecord, error)
+	// Resultado de un fragmento ya transcrito de un job troceado
+	SaveChunk(jobID string, index int, result BackendResponse) error
+	LoadChunks(jobID string) (map[int]BackendResponse, error)
+	DeleteChunks(jobID string) error
+	// Borra el job con sus eventos, outbox, fragmentos y concesión
+	DeleteJob(jobID string) error
+	// Webhooks de todos los tenants; las entregas pendientes los necesitan
+	SaveWebhooks(hooks []WebhookRecord) error
+	LoadWebhooks() ([]WebhookRecord, error)
+	// Reparto entre workers: ClaimJob toma de forma atómica el job pendiente
+	// más antiguo sin dueño o cuya concesión caducó (nil si no hay) y
+	// devuelve también la concesión caducada que reemplazó. La concesión se
+	// renueva mientras se ejecuta y se suelta al terminar.
+	ClaimJob(workerID string, lease time.Duration) (*JobRecord, *JobClaim, error)
+	RenewClaim(jobID, workerID string, lease time.Duration) error
+	ReleaseClaim(jobID, workerID string) error
+	// Ajustes de operación compartidos entre procesos (pausa de la cola...);
+	// nil si no se guardó nunca
+	SaveSetting(name string, value json.RawMessage) error
+	LoadSetting(name string) (json.RawMessage, error)
+}
+
+// La concesión del job ya no es de este worker
+var errClaimLost = errors.New("job claim lost")
+
+// nil si STATE_DIR está vacío (todo en memoria)
+var stateStore StateStore
+
+func newStateStore() (StateStore, error) {
+	store, err := openStateStore()
+	if store == nil || err != nil {
+		return nil, err
+	}
+	return encryptedStateStore{store}, nil
+}
+
+func openStateStore() (StateStore, error) {
+	switch cfg.StateBackend {
+	case "postgres":
+		return newPgStateStore(cfg.DatabaseURL)
+	default:
+		if cfg.StateDir == "" {
+			return nil, nil
+		}
+		return newFileStateStore(cfg.StateDir)
+	}
+}
+
+// Un directorio por job: STATE_DIR/jobs/<id>/job.json, claim.json y
+// chunks/<n>.json. Los ajustes en STATE_DIR/settings/<nombre>.json.
+type fileStateStore struct {
+	dir string
+}
+
+func newFileStateStore(dir string) (*fileStateStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "jobs"), 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed to create state directory")
+	}
+	return &fileStateStore{dir: dir}, nil
+}
+
+func (s *fileStateStore) jobDir(jobID string) string {
+	return filepath.Join(s.dir, "jobs", jobID)
+}
+
+// Escritura atómica: un reinicio nunca deja un JSON a medias. El temporal
+// es único porque varios procesos pueden escribir el mismo archivo.
+func writeFileAtomic(p string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *fileStateStore) SaveJob(rec JobRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal job state")
+	}
+	return errors.Wrap(writeFileAtomic(filepath.Join(s.jobDir(rec.ID), "job.json"), data), "failed to write job state")
+}
+
+func (s *fileStateStore) LoadJobs(ctx context.Context) ([]JobRecord, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, "jobs"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read state directory")
+	}
+	var records []JobRecord
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		rec, err := s.LoadJob(ctx, entry.Name())
+		if ctx.Err() != nil {
+			return nil, errors.Wrap(ctx.Err(), "failed to read job state")
+		}
+		if err != nil {
+			log.Printf("⚠️ Estado corrupto del job %s: %v", entry.Name(), err)
+			continue
+		}
+		if rec != nil {
+			records = append(records, *rec)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Job.Timestamp.Before(records[j].Job.Timestamp) })
+	return records, nil
+}
+
+func (s *fileStateStore) LoadJob(ctx context.Context, jobID string) (*JobRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read job state")
+	}
+	data, err := os.ReadFile(filepath.Join(s.jobDir(jobID), "job.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read job state")
+	}
+	var rec JobRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, errors.Wrap(err, "failed to decode job state")
+	}
+	if rec.Claim, err = s.readClaim(jobID); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (s *fileStateStore) SaveChunk(jobID string, index int, result BackendResponse) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal chunk result")
+	}
+	p := filepath.Join(s.jobDir(jobID), "chunks", strconv.Itoa(index)+".json")
+	return errors.Wrap(writeFileAtomic(p, data), "failed to write chunk result")
+}
+
+func (s *fileStateStore) LoadChunks(jobID string) (map[int]BackendResponse, error) {
+	chunks := make(map[int]BackendResponse)
+	entries, err := os.ReadDir(filepath.Join(s.jobDir(jobID), "chunks"))
+	if os.IsNotExist(err) {
+		return chunks, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read chunk results")
+	}
+	for _, entry := range entries {
+		index, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.jobDir(jobID), "chunks", entry.Name()))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read chunk result")
+		}
+		var result BackendResponse
+		if err := json.Unmarshal(data, &result); err != nil {
+			// Se vuelve a transcribir
+			continue
+		}
+		chunks[index] = result
+	}
+	return chunks, nil
+}
+
+func (s *fileStateStore) DeleteChunks(jobID string) error {
+	return errors.Wrap(os.RemoveAll(filepath.Join(s.jobDir(jobID), "chunks")), "failed to delete chunk results")
+}
+
+func (s *fileStateStore) DeleteJob(jobID string) error {
+	return errors.Wrap(os.RemoveAll(s.jobDir(jobID)), "failed to delete job state")
+}
+
+func (s *fileStateStore) SaveWebhooks(hooks []WebhookRecord) error {
+	data, err := json.Marshal(hooks)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal webhooks")
+	}
+	return errors.Wrap(writeFileAtomic(filepath.Join(s.dir, "webhooks.json"), data), "failed to write webhooks")
+}
+
+func (s *fileStateStore) LoadWebhooks() ([]WebhookRecord, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, "webhooks.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read webhooks")
+	}
+	var hooks []WebhookRecord
+	if err := json.Unmarshal(data, &hooks); err != nil {
+		return nil, errors.Wrap(err, "failed to decode webhooks")
+	}
+	return hooks, nil
+}
+
+func (s *fileStateStore) SaveSetting(name string, value json.RawMessage) error {
+	p := filepath.Join(s.dir, "settings", name+".json")
+	return errors.Wrapf(writeFileAtomic(p, value), "failed to write setting %s", name)
+}
+
+func (s *fileStateStore) LoadSetting(name string) (json.RawMessage, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, "settings", name+".json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, errors.Wrapf(err, "failed to read setting %s", name)
+}
+
+// Concesión de un job a un worker, en STATE_DIR/jobs/<id>/claim.json
+type JobClaim struct {
+	WorkerID       string    `json:"worker_id"`
+	LeaseExpiresAt time.Time `json:"lease_expires_at"`
+}
+
+// Serializa las concesiones entre procesos con un flock sobre
+// STATE_DIR/claims.lock; devuelve la función que lo suelta
+func (s *fileStateStore) lockClaims() (func(), error) {
+	f, err := os.OpenFile(filepath.Join(s.dir, "claims.lock"), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open claims lock")
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "failed to lock claims")
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+func (s *fileStateStore) readClaim(jobID string) (*JobClaim, error) {
+	data, err := os.ReadFile(filepath.Join(s.jobDir(jobID), "claim.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read job claim")
+	}
+	var claim JobClaim
+	if err := json.Unmarshal(data, &claim); err != nil {
+		return nil, errors.Wrap(err, "failed to decode job claim")
+	}
+	return &claim, nil
+}
+
+func (s *fileStateStore) writeClaim(jobID string, claim JobClaim) error {
+	data, err := json.Marshal(claim)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal job claim")
+	}
+	return errors.Wrap(writeFileAtomic(filepath.Join(s.jobDir(jobID), "claim.json"), data), "failed to write job claim")
+}
+
+func (s *fileStateStore) ClaimJob(workerID string, lease time.Duration) (*JobRecord, *JobClaim, error) {
+	unlock, err := s.lockClaims()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+	records, err := s.LoadJobs(context.Background())
+	if err != nil {
+		return nil, nil, err
+	}
+	// Mayor prioridad efectiva primero; a igualdad, el más antiguo (LoadJobs
+	// los devuelve por fecha de creación)
+	now := time.Now()
+	var best *JobRecord
+	bestPriority := 0
+	for i, rec := range records {
+		if isTerminalStatus(rec.Job.Status) {
+			continue
+		}
+		if rec.Claim != nil && rec.Claim.LeaseExpiresAt.After(now) {
+			continue
+		}
+		if priority := agedPriority(rec.Job.Priority, rec.Job.Timestamp, now); best == nil || priority > bestPriority {
+			best, bestPriority = &records[i], priority
+		}
+	}
+	if best == nil {
+		return nil, nil, nil
+	}
+	expired := best.Claim
+	claim := JobClaim{WorkerID: workerID, LeaseExpiresAt: now.Add(lease)}
+	if err := s.writeClaim(best.ID, claim); err != nil {
+		return nil, nil, err
+	}
+	best.Claim = &claim
+	return best, expired, nil
+}
+
+func (s *fileStateStore) RenewClaim(jobID, workerID string, lease time.Duration) error {
+	unlock, err := s.lockClaims()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	claim, err := s.readClaim(jobID)
+	if err != nil {
+		return err
+	}
+	if claim == nil || claim.WorkerID != workerID {
+		return errors.Wrapf(errClaimLost, "job %s", jobID)
+	}
+	claim.LeaseExpiresAt = time.Now().Add(lease)
+	return s.writeClaim(jobID, *claim)
+}
+
+func (s *fileStateStore) ReleaseClaim(jobID, workerID string) error {
+	unlock, err := s.lockClaims()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	claim, err := s.readClaim(jobID)
+	if err != nil || claim == nil || claim.WorkerID != workerID {
+		return err
+	}
+	return errors.Wrap(os.Remove(filepath.Join(s.jobDir(jobID), "claim.json")), "failed to release job claim")
+}
+
+// Copias de jobs por guardar, en el orden en que se tomaron; protegido por mu
+var pendingSaves []JobRecord
+
+// Serializa las escrituras de pendingSaves para que una copia vieja no pise
+// a una nueva. Se toma siempre antes que mu.
+var saveMu sync.Mutex
+
+// Guarda el job tras cada evento. Requiere mu tomado: aquí solo se copia, y
+// la escritura la hace unlockJobs al soltar mu para no bloquear con la E/S
+// del almacén a todo el que espera el lock.
+func persistJobLocked(jobID string) {
+	if stateStore == nil || fencedJobs[jobID] {
+		return
+	}
+	job, ok := jobStore[jobID]
+	if !ok {
+		return
+	}
+	rec := JobRecord{ID: jobID, Job: *job, Events: jobEvents[jobID], Outbox: jobOutbox[jobID]}
+	if meta, ok := jobMetas[jobID]; ok {
+		rec.Meta = *meta
+	}
+	// Copia profunda: segmentos, outbox y demás se siguen cambiando bajo mu
+	data, err := json.Marshal(rec)
+	if err == nil {
+		var snapshot JobRecord
+		if err = json.Unmarshal(data, &snapshot); err == nil {
+			pendingSaves = append(pendingSaves, snapshot)
+			return
+		}
+	}
+	jobLogfLocked(jobID, "⚠️ No se pudo persistir el job %s: %v", jobID, err)
+}
+
+// Suelta mu y guarda lo que quedó en pendingSaves. Al volver, las copias
+// tomadas antes de soltarlo ya están en el almacén.
+func unlockJobs() {
+	pending := len(pendingSaves) > 0
+	mu.Unlock()
+	if pending {
+		flushPendingSaves()
+	}
+}
+
+// Descarta las copias del job aún sin guardar. Requiere mu tomado.
+func dropPendingSavesLocked(jobID string) {
+	kept := pendingSaves[:0]
+	for _, rec := range pendingSaves {
+		if rec.ID != jobID {
+			kept = append(kept, rec)
+		}
+	}
+	pendingSaves = kept
+}
+
+func flushPendingSaves() {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+	mu.Lock()
+	records := pendingSaves
+	pendingSaves = nil
+	mu.Unlock()
+	for _, rec := range records {
+		if err := stateStore.SaveJob(rec); err != nil {
+			jobLogf(rec.ID, "⚠️ No se pudo persistir el job %s: %v", rec.ID, err)
+		}
+	}
+}
+
+func isTerminalStatus(status string) bool {
+	return status == "completed" || status == "failed" || status == "skipped"
+}
+
+// Jobs cuyo trabajo pendiente (reanudar, entregas del outbox) no es de este
+// proceso: restaurados que aún no adoptó el líder o, con ROLE=api, los que
+// ejecutan los workers; protegido por mu
+var unadoptedJobs = make(map[string]bool)
+
+// Carga los jobs guardados. Reanudar los que quedaron a medias y entregar
+// su outbox lo hace solo el líder, para que varias réplicas sobre el mismo
+// almacén no lo dupliquen. Con ROLE=api se cargan solo para lecturas.
+func restoreJobs() {
+	records, err := stateStore.LoadJobs(context.Background())
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	mu.Lock()
+	for _, rec := range records {
+		job := rec.Job
+		meta := rec.Meta
+		jobStore[rec.ID] = &job
+		jobMetas[rec.ID] = &meta
+		jobEvents[rec.ID] = rec.Events
+		if len(rec.Outbox) > 0 {
+			jobOutbox[rec.ID] = rec.Outbox
+		}
+		if cfg.Role == RoleAPI || !isTerminalStatus(job.Status) || len(rec.Outbox) > 0 {
+			unadoptedJobs[rec.ID] = true
+		}
+	}
+	unlockJobs()
+	if len(records) > 0 {
+		log.Printf("🚀 %d jobs restaurados", len(records))
+	}
+	if cfg.Role == RoleAll {
+		runAsLeader("adopción de jobs restaurados", adoptRestoredJobs)
+	}
+}
+
+func adoptRestoredJobs(ctx context.Context) {
+	var pending []string
+	mu.Lock()
+	for jobID := range unadoptedJobs {
+		if !isTerminalStatus(jobStore[jobID].Status) {
+			pending = append(pending, jobID)
+		}
+		delete(unadoptedJobs, jobID)
+	}
+	unlockJobs()
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+
+	sort.Strings(pending)
+	for _, jobID := range pending {
+		job, _ := getJob(jobID)
+		meta, _ := getJobMeta(jobID)
+		jobLogf(jobID, "🚀 Reanudando job %s tras el reinicio", jobID)
+		recordEvent(jobID, JobEvent{Type: EventRetry, Message: "resumed after restart"})
+		startJob(jobID, meta.Input, findAPIKeyByName(job.APIKey), false)
+	}
+	if len(pending) > 0 {
+		log.Printf("🚀 %d jobs reanudados", len(pending))
+	}
+}
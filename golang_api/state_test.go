@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Almacén que comprueba que SaveJob no se llama con mu tomado
+type lockCheckStore struct {
+	StateStore
+	saved  []JobRecord
+	locked bool
+}
+
+func (s *lockCheckStore) SaveJob(rec JobRecord) error {
+	if mu.TryLock() {
+		mu.Unlock()
+	} else {
+		s.locked = true
+	}
+	s.saved = append(s.saved, rec)
+	return nil
+}
+
+func TestPersistJobOutsideLock(t *testing.T) {
+	store := &lockCheckStore{}
+	saved := stateStore
+	stateStore = store
+	t.Cleanup(func() { stateStore = saved })
+
+	mu.Lock()
+	jobStore["persist-job"] = &JobState{Type: JobTypeTranscription, Status: "processing", Timestamp: time.Now(), Segments: []Segment{{Text: "uno"}}}
+	jobMetas["persist-job"] = &jobMeta{Tenant: "acme"}
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		forgetJobLocked("persist-job")
+		mu.Unlock()
+	})
+
+	setJobStatus("persist-job", "completed")
+	if store.locked {
+		t.Error("SaveJob called while holding mu")
+	}
+	if len(store.saved) != 1 || store.saved[0].Job.Status != "completed" || store.saved[0].Meta.Tenant != "acme" {
+		t.Fatalf("saved = %+v, want the completed job once", store.saved)
+	}
+
+	// La copia guardada no comparte memoria con el job
+	mu.Lock()
+	jobStore["persist-job"].Segments[0].Text = "dos"
+	mu.Unlock()
+	if got := store.saved[0].Job.Segments[0].Text; got != "uno" {
+		t.Errorf("saved segment = %q, want the snapshot taken under the lock", got)
+	}
+}
+
+// Los almacenes reclaman por prioridad efectiva (con la espera desde que se
+// creó el job) y, a igualdad, por antigüedad
+func testClaimOrder(t *testing.T, store StateStore) {
+	saved := cfg
+	cfg.PriorityAgingInterval = Duration{time.Minute}
+	initLiveConfig()
+	t.Cleanup(func() {
+		cfg = saved
+		initLiveConfig()
+	})
+
+	now := time.Now()
+	for _, j := range []struct {
+		id       string
+		priority int
+		age      time.Duration
+	}{
+		{"claim-new-high", 5, 0},
+		{"claim-old-low", 0, 10 * time.Minute},
+		{"claim-high", 5, time.Minute},
+		{"claim-tie", 6, 0},
+		{"claim-low", 0, 2 * time.Minute},
+	} {
+		rec := JobRecord{ID: j.id, Job: JobState{Type: JobTypeTranscription, Status: "queued", Priority: j.priority, Timestamp: now.Add(-j.age)}}
+		if err := store.SaveJob(rec); err != nil {
+			t.Fatal(err)
+		}
+		id := j.id
+		t.Cleanup(func() { store.DeleteJob(id) })
+	}
+
+	for _, want := range []string{"claim-old-low", "claim-high", "claim-tie", "claim-new-high", "claim-low"} {
+		rec, _, err := store.ClaimJob("worker-1", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec == nil || rec.ID != want {
+			t.Fatalf("claimed %+v, want %s", rec, want)
+		}
+	}
+	if rec, _, err := store.ClaimJob("worker-1", time.Minute); err != nil || rec != nil {
+		t.Errorf("claimed %+v (%v) with every job leased", rec, err)
+	}
+}
+
+func TestFileClaimJobOrder(t *testing.T) {
+	store, err := newFileStateStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testClaimOrder(t, store)
+}
+
+func TestPgClaimJobOrder(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	saved := cfg
+	cfg.DatabaseMigrate = true
+	cfg.DatabaseTimeout = Duration{5 * time.Second}
+	t.Cleanup(func() { cfg = saved })
+	store, err := newPgStateStore(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(store.pool.Close)
+	testClaimOrder(t, store)
+}
+
+// Almacén que tarda más que cualquier plazo de ruta
+type slowStore struct {
+	StateStore
+}
+
+func (slowStore) LoadJobs(ctx context.Context) ([]JobRecord, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (slowStore) LoadJob(ctx context.Context, jobID string) (*JobRecord, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// El plazo de la ruta llega a la lectura del almacén y se responde 504 sin
+// ejecutar el handler
+func TestStoreReadDeadline(t *testing.T) {
+	saved, savedStore := cfg, stateStore
+	cfg.RequestTimeout = Duration{time.Minute}
+	cfg.RouteTimeouts = map[string]Duration{"GET /jobs": {20 * time.Millisecond}, "GET /result/:job_id": {20 * time.Millisecond}}
+	stateStore = slowStore{}
+	t.Cleanup(func() { cfg, stateStore = saved, savedStore })
+
+	router := gin.New()
+	router.Use(deadlineMiddleware(), storeReadMiddleware())
+	handled := false
+	handler := func(c *gin.Context) {
+		handled = true
+		c.JSON(http.StatusOK, gin.H{})
+	}
+	router.GET("/jobs", handler)
+	router.GET("/result/:job_id", handler)
+	for _, path := range []string{"/jobs", "/result/some-job"} {
+		w := httptest.NewRecorder()
+		start := time.Now()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusGatewayTimeout || handled {
+			t.Errorf("GET %s = %d (handler ran: %v), want 504 before the handler", path, w.Code, handled)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("GET %s took %s, want about the 20ms route deadline", path, elapsed)
+		}
+	}
+}
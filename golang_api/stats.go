@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rango de GET /stats por defecto y como máximo, en días
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 366
+)
+
+const statsDateLayout = "2006-01-02"
+
+// Agregados de un día, o del rango en totals. Los jobs en curso cuentan en
+// jobs pero no en los tiempos ni en failure_rate.
+type StatsBucket struct {
+	Date                 string  `json:"date,omitempty"` // YYYY-MM-DD en UTC; vacío en totals
+	Jobs                 int     `json:"jobs"`
+	Completed            int     `json:"completed"`
+	Failed               int     `json:"failed"`
+	MinutesTranscribed   float64 `json:"minutes_transcribed"`              // duración del medio de las transcripciones completadas
+	AvgProcessingSeconds float64 `json:"avg_processing_seconds,omitempty"` // de la creación al estado final
+	FailureRate          float64 `json:"failure_rate"`                     // failed / (completed + failed)
+
+	processingSeconds float64
+}
+
+func (b *StatsBucket) add(rec JobRecord) {
+	b.Jobs++
+	switch rec.Job.Status {
+	case "completed":
+		b.Completed++
+		if rec.Job.Type == JobTypeTranscription {
+			seconds := rec.Job.Duration
+			if seconds == 0 {
+				// Sin duración medida del medio: la del último segmento
+				seconds = transcriptEnd(rec.Job)
+			}
+			b.MinutesTranscribed += seconds / 60
+		}
+	case "failed":
+		b.Failed++
+	default:
+		return
+	}
+	if at, ok := finishedAt(rec.Events); ok && at.After(rec.Job.Timestamp) {
+		b.processingSeconds += at.Sub(rec.Job.Timestamp).Seconds()
+	}
+}
+
+// Redondea y calcula las medias una vez sumado todo
+func (b *StatsBucket) finish() {
+	b.MinutesTranscribed = round2(b.MinutesTranscribed)
+	if finished := b.Completed + b.Failed; finished > 0 {
+		b.AvgProcessingSeconds = round2(b.processingSeconds / float64(finished))
+		b.FailureRate = math.Round(float64(b.Failed)/float64(finished)*1e4) / 1e4
+	}
+}
+
+// Última transición a un estado terminal en un historial
+func finishedAt(events []JobEvent) (time.Time, bool) {
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Type == EventStatus && isTerminalStatus(events[i].Status) {
+			return events[i].Timestamp, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Días pedidos con from y to (incluidos, YYYY-MM-DD); por defecto los
+// últimos 30 hasta hoy
+func statsRange(c *gin.Context) (time.Time, time.Time, string) {
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse(statsDateLayout, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, "from and to must be dates as YYYY-MM-DD"
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -(defaultStatsDays - 1))
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse(statsDateLayout, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, "from and to must be dates as YYYY-MM-DD"
+		}
+		from = t
+	}
+	switch {
+	case from.After(to):
+		return time.Time{}, time.Time{}, "from must not be after to"
+	case to.Sub(from) >= maxStatsDays*24*time.Hour:
+		return time.Time{}, time.Time{}, "the range must be at most 366 days"
+	}
+	return from, to, ""
+}
+
+// GET /stats?from=&to= devuelve los totales del tenant y una serie por día
+// de creación (UTC) con jobs, minutos transcritos, tiempo medio de proceso
+// y tasa de fallos. Se calcula del almacén de estado: sin STATE_DIR ni
+// Postgres solo cuenta los jobs en memoria.
+func statsHandler(c *gin.Context) {
+	from, to, problem := statsRange(c)
+	if problem != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": problem, "code": "INVALID_REQUEST"})
+		return
+	}
+	records, err := loadJobRecords(c.Request.Context())
+	if abortOnDeadline(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+
+	days := make([]StatsBucket, int(to.Sub(from).Hours()/24)+1)
+	for i := range days {
+		days[i].Date = from.AddDate(0, 0, i).Format(statsDateLayout)
+	}
+	var totals StatsBucket
+	tenant := currentTenant(c)
+	for _, rec := range records {
+		created := rec.Job.Timestamp.UTC()
+		if rec.Meta.Tenant != tenant || created.Before(from) || !created.Before(to.AddDate(0, 0, 1)) {
+			continue
+		}
+		days[int(created.Sub(from).Hours()/24)].add(rec)
+		totals.add(rec)
+	}
+	for i := range days {
+		days[i].finish()
+	}
+	totals.finish()
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{
+		"from":   from.Format(statsDateLayout),
+		"to":     to.Format(statsDateLayout),
+		"totals": totals,
+		"days":   days,
+	})
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/pkg/errors"
+)
+
+// Almacenamiento de artefactos generados (vídeos, clips, exportaciones)
+type objectStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Enlace de descarga temporal para la clave
+	DownloadURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// Enlace temporal para subir la clave con PUT, sin pasar por la API
+	UploadURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// Tamaño del objeto; errObjectNotFound si no existe
+	Stat(ctx context.Context, key string) (int64, error)
+	// Borrar una clave que no existe no es un error
+	Delete(ctx context.Context, key string) error
+}
+
+var errObjectNotFound = errors.New("object not found")
+
+// Artefacto producido por un job
+type Artifact struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"` // ruta de la API que redirige al enlace firmado
+}
+
+var artifacts objectStore
+
+func newObjectStore() (objectStore, error) {
+	switch cfg.StorageBackend {
+	case "local":
+		key := []byte(cfg.ArtifactSigningKey)
+		if len(key) == 0 {
+			// Sin clave configurada los enlaces solo valen hasta el reinicio
+			key = make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return nil, errors.Wrap(err, "failed to generate artifact signing key")
+			}
+		}
+		return &localStore{dir: cfg.ArtifactsDir, baseURL: cfg.PublicBaseURL, key: key}, nil
+	case "s3":
+		client, err := minio.New(cfg.S3Endpoint, &minio.Options{
+			Creds:  credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, ""),
+			Secure: cfg.S3UseSSL,
+			Region: cfg.S3Region,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create S3 client")
+		}
+		return &s3Store{client: client, bucket: cfg.S3Bucket}, nil
+	default:
+		return nil, errors.Errorf("unknown STORAGE_BACKEND %q", cfg.StorageBackend)
+	}
+}
+
+// S3 o MinIO
+type s3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return errors.Wrap(err, "failed to upload artifact")
+}
+
+func (s *s3Store) DownloadURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, url.Values{})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to presign artifact URL")
+	}
+	return u.String(), nil
+}
+
+func (s *s3Store) UploadURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedPutObject(ctx, s.bucket, key, expiry)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to presign upload URL")
+	}
+	return u.String(), nil
+}
+
+func (s *s3Store) Stat(ctx context.Context, key string) (int64, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return 0, errObjectNotFound
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to stat object")
+	}
+	return info.Size, nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+	return errors.Wrap(err, "failed to delete object")
+}
+
+// Directorio local servido por GET /artifacts/*key con enlaces firmados
+type localStore struct {
+	dir     string
+	baseURL string
+	key     []byte
+}
+
+func (s *localStore) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" {
+		return "", errors.New("empty artifact key")
+	}
+	return filepath.Join(s.dir, clean), nil
+}
+
+func (s *localStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return errors.Wrap(err, "failed to create artifact directory")
+	}
+	// Se escribe aparte y se renombra: Stat no ve artefactos a medias
+	part := p + ".part"
+	file, err := os.Create(part)
+	if err != nil {
+		return errors.Wrap(err, "failed to create artifact")
+	}
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(part)
+		return errors.Wrap(err, "failed to write artifact")
+	}
+	return errors.Wrap(os.Rename(part, p), "failed to write artifact")
+}
+
+func (s *localStore) sign(key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%s\n%d", key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Firma de los enlaces de subida, distinta de la de descarga
+func (s *localStore) signUpload(key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "PUT\n%s\n%d", key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *localStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to delete object")
+	}
+	return nil
+}
+
+func (s *localStore) UploadURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	expires := time.Now().Add(expiry).Unix()
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("sig", s.signUpload(key, expires))
+	return strings.TrimRight(s.baseURL, "/") + "/artifacts/" + key + "?" + q.Encode(), nil
+}
+
+func (s *localStore) Stat(ctx context.Context, key string) (int64, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return 0, errObjectNotFound
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to stat object")
+	}
+	return info.Size(), nil
+}
+
+func (s *localStore) DownloadURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	expires := time.Now().Add(expiry).Unix()
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("sig", s.sign(key, expires))
+	return strings.TrimRight(s.baseURL, "/") + "/artifacts/" + key + "?" + q.Encode(), nil
+}
+
+// GET /artifacts/*key: descarga pública validada por firma y expiración
+func (s *localStore) serve(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		c.JSON(http.StatusForbidden, gin.H{"error": "link expired or invalid"})
+		return
+	}
+	if !hmac.Equal([]byte(s.sign(key, expires)), []byte(c.Query("sig"))) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "link expired or invalid"})
+		return
+	}
+	p, err := s.path(key)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "artifact not found"})
+		return
+	}
+	c.File(p)
+}
+
+// PUT /artifacts/*key: subida con un enlace de UploadURL, como un PUT
+// presignado de S3. El tope es MAX_DOWNLOAD_MB.
+func (s *localStore) receive(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		c.JSON(http.StatusForbidden, gin.H{"error": "link expired or invalid"})
+		return
+	}
+	if !hmac.Equal([]byte(s.signUpload(key, expires)), []byte(c.Query("sig"))) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "link expired or invalid"})
+		return
+	}
+	body := io.Reader(c.Request.Body)
+	if maxBytes := cfg.MaxDownloadMB * 1024 * 1024; maxBytes > 0 {
+		body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	}
+	err = s.Put(c.Request.Context(), key, body, c.Request.ContentLength, c.ContentType())
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "upload exceeds maximum size", "code": "UPLOAD_TOO_LARGE"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STORAGE_FAILED"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func artifactKey(jobID, name string) string {
+	return fmt.Sprintf("jobs/%s/%s", jobID, name)
+}
+
+// Sube un archivo local como artefacto del job
+func storeArtifact(jobID, name, localPath, contentType string) (Artifact, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return Artifact{}, errors.Wrap(err, "failed to open artifact")
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return Artifact{}, errors.Wrap(err, "failed to stat artifact")
+	}
+
+	key := artifactKey(jobID, name)
+	if err := artifacts.Put(context.Background(), key, file, info.Size(), contentType); err != nil {
+		return Artifact{}, err
+	}
+	return Artifact{
+		Name:        name,
+		ContentType: contentType,
+		Size:        info.Size(),
+		URL:         fmt.Sprintf("/jobs/%s/artifacts/%s", jobID, name),
+	}, nil
+}
+
+// GET /jobs/:job_id/artifacts/:name redirige a un enlace temporal
+func artifactHandler(c *gin.Context) {
+	job, exists := getJob(c.Param("job_id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	for _, a := range job.Artifacts {
+		if a.Name != c.Param("name") {
+			continue
+		}
+		link, err := artifacts.DownloadURL(c.Request.Context(), artifactKey(c.Param("job_id"), a.Name), cfg.ArtifactURLTTL.Duration)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		c.Redirect(http.StatusFound, link)
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "artifact not found"})
+}
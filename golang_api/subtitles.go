@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Opciones de estilo de subtítulos; los campos en cero usan el valor por defecto
+type SubtitleOptions struct {
+	MaxCharsPerLine int     `json:"max_chars_per_line,omitempty"`
+	MaxLinesPerCue  int     `json:"max_lines_per_cue,omitempty"`
+	MinCueSeconds   float64 `json:"min_cue_seconds,omitempty"`
+	MaxCueSeconds   float64 `json:"max_cue_seconds,omitempty"`
+	SpeakerPrefix   *bool   `json:"speaker_prefix,omitempty"` // "Hablante: " al cambiar de hablante; false explícito anula el del job
+
+	// TTML y SCC: 23.976, 24, 25, 29.97 (drop-frame), 29.97ndf o 30
+	FrameRate string `json:"frame_rate,omitempty"`
+}
+
+func defaultSubtitleOptions() SubtitleOptions {
+	return SubtitleOptions{
+		MaxCharsPerLine: 42,
+		MaxLinesPerCue:  2,
+		MinCueSeconds:   1,
+		MaxCueSeconds:   7,
+	}
+}
+
+// Sobrescribe con los campos no vacíos de other
+func (o SubtitleOptions) merge(other *SubtitleOptions) SubtitleOptions {
+	if other == nil {
+		return o
+	}
+	if other.MaxCharsPerLine > 0 {
+		o.MaxCharsPerLine = other.MaxCharsPerLine
+	}
+	if other.MaxLinesPerCue > 0 {
+		o.MaxLinesPerCue = other.MaxLinesPerCue
+	}
+	if other.MinCueSeconds > 0 {
+		o.MinCueSeconds = other.MinCueSeconds
+	}
+	if other.MaxCueSeconds > 0 {
+		o.MaxCueSeconds = other.MaxCueSeconds
+	}
+	if other.SpeakerPrefix != nil {
+		o.SpeakerPrefix = other.SpeakerPrefix
+	}
+	if other.FrameRate != "" {
+		o.FrameRate = other.FrameRate
+	}
+	return o
+}
+
+func (o SubtitleOptions) validate() error {
+	if o.MaxCharsPerLine < 10 {
+		return errors.New("max_chars_per_line must be at least 10")
+	}
+	if o.MinCueSeconds > o.MaxCueSeconds {
+		return errors.New("min_cue_seconds cannot exceed max_cue_seconds")
+	}
+	if _, ok := frameRates[o.FrameRate]; o.FrameRate != "" && !ok {
+		return errors.New("frame_rate must be 23.976, 24, 25, 29.97, 29.97ndf or 30")
+	}
+	return nil
+}
+
+// Subtítulo ya maquetado
+type Cue struct {
+	Start float64
+	End   float64
+	Lines []string
+}
+
+// Parte los segmentos en cues que respetan longitud de línea, número de
+// líneas y duración máxima, y alarga los cues demasiado breves.
+func buildCues(segments []Segment, opts SubtitleOptions) []Cue {
+	var cues []Cue
+	lastSpeaker := ""
+
+	for _, seg := range segments {
+		words := segmentWords(seg)
+		if len(words) == 0 {
+			continue
+		}
+
+		prefix := ""
+		if opts.SpeakerPrefix != nil && *opts.SpeakerPrefix && seg.Speaker != "" && seg.Speaker != lastSpeaker {
+			prefix = seg.Speaker + ": "
+		}
+		lastSpeaker = seg.Speaker
+
+		var current []Word
+		flush := func() {
+			if len(current) == 0 {
+				return
+			}
+			text := joinWords(current)
+			if prefix != "" {
+				text = prefix + text
+				prefix = ""
+			}
+			cues = append(cues, Cue{
+				Start: current[0].Start,
+				End:   current[len(current)-1].End,
+				Lines: wrapLines(text, opts.MaxCharsPerLine),
+			})
+			current = nil
+		}
+
+		for _, w := range words {
+			candidate := append(append([]Word{}, current...), w)
+			text := prefix + joinWords(candidate)
+			tooLong := len(wrapLines(text, opts.MaxCharsPerLine)) > opts.MaxLinesPerCue
+			tooSlow := w.End-candidate[0].Start > opts.MaxCueSeconds
+			if len(current) > 0 && (tooLong || tooSlow) {
+				flush()
+			}
+			current = append(current, w)
+		}
+		flush()
+	}
+
+	// Duración mínima sin solaparse con el siguiente cue
+	for i := range cues {
+		if cues[i].End-cues[i].Start >= opts.MinCueSeconds {
+			continue
+		}
+		end := cues[i].Start + opts.MinCueSeconds
+		if i+1 < len(cues) && end > cues[i+1].Start {
+			end = cues[i+1].Start
+		}
+		if end > cues[i].End {
+			cues[i].End = end
+		}
+	}
+	return cues
+}
+
+// Palabras del segmento; sin marcas por palabra se reparten uniformemente
+func segmentWords(seg Segment) []Word {
+	if len(seg.Words) > 0 {
+		words := make([]Word, 0, len(seg.Words))
+		for _, w := range seg.Words {
+			if text := strings.TrimSpace(w.Word); text != "" {
+				w.Word = text
+				words = append(words, w)
+			}
+		}
+		return words
+	}
+
+	fields := strings.Fields(seg.Text)
+	if len(fields) == 0 {
+		return nil
+	}
+	step := (seg.End - seg.Start) / float64(len(fields))
+	words := make([]Word, len(fields))
+	for i, f := range fields {
+		words[i] = Word{
+			Word:  f,
+			Start: seg.Start + step*float64(i),
+			End:   seg.Start + step*float64(i+1),
+		}
+	}
+	return words
+}
+
+func joinWords(words []Word) string {
+	parts := make([]string, len(words))
+	for i, w := range words {
+		parts[i] = w.Word
+	}
+	return strings.Join(parts, " ")
+}
+
+// Ajuste de línea por palabras contando runas, no bytes
+func wrapLines(text string, maxChars int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		switch {
+		case line == "":
+			line = word
+		case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= maxChars:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func renderSRT(cues []Cue) string {
+	var b strings.Builder
+	for i, cue := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1,
+			formatTimestamp(cue.Start, ","), formatTimestamp(cue.End, ","), strings.Join(cue.Lines, "\n"))
+	}
+	return b.String()
+}
+
+func renderVTT(cues []Cue) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for _, cue := range cues {
+		fmt.Fprintf(&b, "%s --> %s\n%s\n\n",
+			formatTimestamp(cue.Start, "."), formatTimestamp(cue.End, "."), strings.Join(cue.Lines, "\n"))
+	}
+	return b.String()
+}
+
+// HH:MM:SS,mmm (SRT) o HH:MM:SS.mmm (VTT)
+func formatTimestamp(seconds float64, sep string) string {
+	ms := int64(math.Round(seconds * 1000))
+	if ms < 0 {
+		ms = 0
+	}
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// Opciones recibidas por query string, p. ej. ?max_chars_per_line=32
+func subtitleOptionsFromQuery(c *gin.Context) (*SubtitleOptions, error) {
+	opts := &SubtitleOptions{}
+	ints := map[string]*int{
+		"max_chars_per_line": &opts.MaxCharsPerLine,
+		"max_lines_per_cue":  &opts.MaxLinesPerCue,
+	}
+	for name, target := range ints {
+		if raw := c.Query(name); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 {
+				return nil, errors.Errorf("%s must be a positive integer", name)
+			}
+			*target = n
+		}
+	}
+	floats := map[string]*float64{
+		"min_cue_seconds": &opts.MinCueSeconds,
+		"max_cue_seconds": &opts.MaxCueSeconds,
+	}
+	for name, target := range floats {
+		if raw := c.Query(name); raw != "" {
+			f, err := strconv.ParseFloat(raw, 64)
+			if err != nil || f <= 0 {
+				return nil, errors.Errorf("%s must be a positive number", name)
+			}
+			*target = f
+		}
+	}
+	if raw := c.Query("speaker_prefix"); raw != "" {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errors.New("speaker_prefix must be a boolean")
+		}
+		opts.SpeakerPrefix = &b
+	}
+	opts.FrameRate = c.Query("frame_rate")
+	return opts, nil
+}
+
+// Subtítulos del job en format (srt, vtt, ttml o scc) y su Content-Type
+func renderSubtitles(job JobState, format string, opts SubtitleOptions) ([]byte, string, error) {
+	switch format {
+	case "srt":
+		return []byte(renderSRT(buildCues(job.Segments, opts))), "application/x-subrip; charset=utf-8", nil
+	case "vtt":
+		return []byte(renderVTT(buildCues(job.Segments, opts))), "text/vtt; charset=utf-8", nil
+	case "ttml":
+		var rate *frameRate
+		if r, ok := frameRates[opts.FrameRate]; ok {
+			rate = &r
+		}
+		return []byte(renderTTML(buildCues(job.Segments, opts), job.Language, rate)), "application/ttml+xml; charset=utf-8", nil
+	case "scc":
+		if opts.FrameRate == "" {
+			opts.FrameRate = defaultSCCFrameRate
+		}
+		supported := false
+		for _, r := range sccFrameRates {
+			supported = supported || r == opts.FrameRate
+		}
+		if !supported {
+			return nil, "", errors.New("scc requires frame_rate 29.97, 29.97ndf or 30")
+		}
+		// Límites de la pantalla de CEA-608
+		if opts.MaxCharsPerLine > sccMaxColumns {
+			opts.MaxCharsPerLine = sccMaxColumns
+		}
+		if opts.MaxLinesPerCue > sccMaxRows {
+			opts.MaxLinesPerCue = sccMaxRows
+		}
+		return []byte(renderSCC(buildCues(job.Segments, opts), frameRates[opts.FrameRate])), "text/plain; charset=us-ascii", nil
+	}
+	return nil, "", errors.New("format must be srt, vtt, ttml or scc")
+}
+
+// GET /result/:job_id/subtitles?format=srt|vtt|ttml|scc
+func subtitlesHandler(c *gin.Context) {
+	jobID := c.Param("job_id")
+	job, exists := getJob(jobID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if job.Status != "completed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "subtitles are only available for completed jobs"})
+		return
+	}
+	if len(job.Segments) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "job has no timed segments"})
+		return
+	}
+
+	queryOpts, err := subtitleOptionsFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	meta, _ := getJobMeta(jobID)
+	opts := defaultSubtitleOptions().merge(meta.Input.Subtitles).merge(queryOpts)
+	if err := opts.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, contentType, err := renderSubtitles(job, c.DefaultQuery("format", "srt"), opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
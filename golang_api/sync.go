@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Respuesta de POST /transcribe/sync
+type SyncResponse struct {
+	Transcription string           `json:"transcription"`
+	Translation   string           `json:"translation,omitempty"`
+	Language      string           `json:"language,omitempty"`
+	Segments      []Segment        `json:"segments,omitempty"`
+	Chapters      []Chapter        `json:"chapters,omitempty"`
+	Stats         *TranscriptStats `json:"stats,omitempty"`
+	Duration      float64          `json:"duration_seconds,omitempty"`
+	Cache         bool             `json:"cache,omitempty"`
+}
+
+// Error del modo síncrono con su código estable
+type syncError struct {
+	status int
+	code   string
+	err    error
+}
+
+func (e *syncError) Error() string {
+	return e.err.Error()
+}
+
+type syncOutcome struct {
+	response *SyncResponse
+	err      *syncError
+}
+
+// POST /transcribe/sync: audio corto (buzón de voz, IVR) procesado en la
+// misma petición, sin crear job y con un plazo máximo
+func syncTranscribeHandler(c *gin.Context) {
+	var input RequestBody
+	if code, err := bindRequestBody(c, &input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+	if status, code, err := resolveUpload(c.Request.Context(), currentTenant(c), &input); err != nil {
+		c.JSON(status, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+	if input.Type != "" && input.Type != JobTypeTranscription {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sync mode only supports transcription", "code": "INVALID_REQUEST"})
+		return
+	}
+	if err := validateChecksumRequest(input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := input.Format.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateAccuracy(input.Accuracy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	parsedURL, err := validateJobMediaURL(input.URL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_URL"})
+		return
+	}
+	if isBackendFetchHost(parsedURL) {
+		// Sin descargar no se puede comprobar la duración
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sync mode requires media the gateway can download", "code": "INVALID_REQUEST"})
+		return
+	}
+
+	tenant := currentTenant(c)
+	if code, err := validateRequestModel(tenant, input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+	if err := validateRequestFeatures(tenant, input); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "FEATURE_DISABLED"})
+		return
+	}
+	if currentAPIKey(c).sandbox() {
+		response, serr := sandboxSync(input, tenant)
+		if serr != nil {
+			c.JSON(serr.status, gin.H{"error": serr.Error(), "code": serr.code})
+			return
+		}
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	if input.SHA256 == "" {
+		if cached, ok := cache.get(c.Request.Context(), input); ok {
+			formatted := input.Format.apply(cached.backendResponse(), input.Language)
+			response := &SyncResponse{
+				Transcription: formatted.Transcription,
+				Translation:   formatted.Translation,
+				Language:      formatted.Language,
+				Segments:      formatted.Segments,
+				Chapters:      formatted.Chapters,
+				Stats:         input.Format.withDiacritics(cached.Stats, cached.backendResponse()),
+				Cache:         true,
+			}
+			if input.Translate {
+				response.Translation, _ = applyGlossary(response.Translation, glossaries.get(tenant))
+			}
+			c.Header("Content-Type", "application/json; charset=utf-8")
+			c.JSON(http.StatusOK, response)
+			return
+		}
+	}
+
+	// Sin cola: si la key está al límite se rechaza en cualquier modo
+	key := currentAPIKey(c)
+	limit := key.concurrencyLimit()
+	if limit > 0 && !jobLimiter.tryAcquire(key.Name, limit) {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": fmt.Sprintf("API key already has %d jobs in progress", limit),
+			"code":  "CONCURRENCY_LIMIT",
+		})
+		return
+	}
+
+	reqID := requestID(c)
+	// Al vencer SYNC_TIMEOUT, o si el cliente se va, se deja de esperar al
+	// backend y se libera el hueco de la key
+	ctx, cancel := context.WithTimeout(c.Request.Context(), cfg.SyncTimeout.Duration)
+	defer cancel()
+	done := make(chan syncOutcome, 1)
+	go func() {
+		if limit > 0 {
+			defer jobLimiter.release(key.Name)
+		}
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				reportPanic(recovered, debug.Stack(), map[string]string{"route": "POST /transcribe/sync", "request_id": reqID})
+				done <- syncOutcome{err: &syncError{http.StatusInternalServerError, "INTERNAL_ERROR", errors.New("internal server error")}}
+			}
+		}()
+		response, err := runSync(ctx, input, tenant, reqID)
+		done <- syncOutcome{response: response, err: err}
+	}()
+
+	select {
+	case outcome := <-done:
+		if outcome.err != nil {
+			c.JSON(outcome.err.status, gin.H{"error": outcome.err.Error(), "code": outcome.err.code})
+			return
+		}
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.JSON(http.StatusOK, outcome.response)
+	case <-ctx.Done():
+		if c.Request.Context().Err() != nil {
+			return
+		}
+		// El procesamiento se corta en segundo plano y limpia al terminar
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error": fmt.Sprintf("transcription did not finish within %s", cfg.SyncTimeout.Duration),
+			"code":  "DEADLINE_EXCEEDED",
+		})
+	}
+}
+
+// Descarga, comprueba la duración y transcribe. Los archivos temporales se
+// borran siempre. Cancelar ctx corta la espera y la llamada al backend.
+func runSync(ctx context.Context, input RequestBody, tenant, requestID string) (*SyncResponse, *syncError) {
+	id := "sync-" + uuid.NewString()
+	defer os.RemoveAll(filepath.Join(cfg.DownloadDir, id))
+
+	media, err := downloadMedia(id, tenant, input.URL)
+	if err != nil {
+		return nil, &syncError{http.StatusBadGateway, "DOWNLOAD_FAILED", errors.Wrap(err, "failed to download media")}
+	}
+	if input.SHA256 != "" && !strings.EqualFold(input.SHA256, media.SHA256) {
+		return nil, &syncError{http.StatusUnprocessableEntity, "CHECKSUM_MISMATCH",
+			errors.Errorf("media sha256 %s does not match expected %s", media.SHA256, strings.ToLower(input.SHA256))}
+	}
+
+	duration, err := probeDuration(media.Path)
+	if err != nil {
+		return nil, &syncError{http.StatusUnprocessableEntity, "PROBE_FAILED", err}
+	}
+	if duration > cfg.SyncMaxDuration.Seconds() {
+		return nil, &syncError{http.StatusRequestEntityTooLarge, "AUDIO_TOO_LONG",
+			errors.Errorf("audio lasts %.1fs, sync mode accepts up to %s; use POST /process", duration, cfg.SyncMaxDuration.Duration)}
+	}
+	if live().VADCheck == VADCheckFail && duration > 0 {
+		if analysis, err := analyzeAudio(media.Path, duration, false); err != nil {
+			logWithRequestID(requestID, fmt.Sprintf("⚠️ No se pudo analizar el audio: %v", err))
+		} else if analysis.SpeechRatio < live().VADMinSpeechRatio {
+			return nil, &syncError{http.StatusUnprocessableEntity, "NO_SPEECH", noSpeechError(analysis.SpeechRatio)}
+		}
+	}
+
+	source := media.Path
+	format, err := sniffContainer(media.Path)
+	if err != nil {
+		return nil, &syncError{http.StatusInternalServerError, "INTERNAL_ERROR", err}
+	}
+	if !isSupportedContainer(format) {
+		if source, err = transcodeToWAV(media.Path); err != nil {
+			return nil, &syncError{http.StatusUnprocessableEntity, "UNSUPPORTED_MEDIA", errors.Wrap(err, "failed to transcode media")}
+		}
+	}
+
+	payload := PythonRequest{
+		URL:       backendMediaURL(input.URL),
+		FilePath:  backendPath(source),
+		Language:  input.Language,
+		Translate: input.Translate,
+		Model:     input.Model,
+		RequestID: requestID,
+		Accuracy:  input.Accuracy,
+		Diarize:   input.Diarize,
+	}
+	if custom, err := lookupModel(tenant, input.Model); err != nil {
+		return nil, &syncError{http.StatusBadRequest, "UNKNOWN_MODEL", err}
+	} else if custom != nil {
+		payload.Model = custom.backendModel()
+		payload.Backend = custom.Backend
+	} else {
+		route(RoutingInput{
+			Tenant:   tenant,
+			Language: input.Language,
+			Model:    input.Model,
+			Duration: duration,
+			Accuracy: input.Accuracy,
+			Diarize:  input.Diarize,
+		}).apply(&payload)
+	}
+	result, fallbackModel, err := transcribePayload(ctx, id, payload)
+	if err != nil {
+		code := "BACKEND_ERROR"
+		var berr *backendError
+		if errors.As(err, &berr) {
+			code = berr.code
+		}
+		return nil, &syncError{http.StatusBadGateway, code, err}
+	}
+
+	stats := computeStats(result, duration)
+	formatted := input.Format.apply(*result, input.Language)
+	response := &SyncResponse{
+		Transcription: formatted.Transcription,
+		Translation:   formatted.Translation,
+		Language:      formatted.Language,
+		Segments:      formatted.Segments,
+		Chapters:      formatted.Chapters,
+		Stats:         input.Format.withDiacritics(stats, *result),
+		Duration:      duration,
+	}
+	if input.Translate {
+		response.Translation, _ = applyGlossary(formatted.Translation, glossaries.get(tenant))
+	}
+
+	if input.SHA256 == "" && fallbackModel == "" && retentionPolicies.get(tenant).TranscriptDays == 0 {
+		cached := CachedResult{
+			Transcription: result.Transcription,
+			Translation:   result.Translation,
+			Language:      result.Language,
+			Segments:      result.Segments,
+			Chapters:      result.Chapters,
+			Stats:         stats,
+			CachedAt:      time.Now(),
+		}
+		if err := cache.set(context.Background(), cacheInput(input, payload), cached); err != nil {
+			log.Printf("⚠️ No se pudo guardar en caché la transcripción síncrona: %v", err)
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Ruta del webhook (setWebhook) de los bots de Telegram; no lleva API key,
+// la autentica el secret_token
+const telegramWebhookPath = "/integrations/telegram"
+
+// Caracteres que Telegram admite en el secret_token de setWebhook
+var telegramSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// Update de la Bot API; solo interesan las notas de voz y los audios
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		MessageID int64 `json:"message_id"`
+		Chat      struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		From *struct {
+			ID       int64  `json:"id"`
+			Username string `json:"username"`
+		} `json:"from"`
+		Voice *telegramFile `json:"voice"`
+		Audio *telegramFile `json:"audio"`
+	} `json:"message"`
+}
+
+type telegramFile struct {
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name"` // solo audio
+	MimeType string `json:"mime_type"`
+	FileSize int64  `json:"file_size"`
+	Duration int    `json:"duration"` // segundos
+}
+
+// POST /integrations/telegram recibe los updates de los bots registrados
+// con setWebhook y su secret_token (el webhook_secret de la integración).
+// Cada nota de voz o audio crea un job de transcripción y, al terminar, el
+// bot responde al mensaje con el texto.
+func telegramWebhookHandler(c *gin.Context) {
+	secret := c.GetHeader("X-Telegram-Bot-Api-Secret-Token")
+	var item *Integration
+	for _, candidate := range integrations.accounts(ProviderTelegram, "") {
+		if secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(candidate.token.WebhookSecret)) == 1 {
+			candidate := candidate
+			item = &candidate
+			break
+		}
+	}
+	if item == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid Telegram secret token", "code": "FORBIDDEN"})
+		return
+	}
+	var update telegramUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	msg := update.Message
+	if msg == nil || (msg.Voice == nil && msg.Audio == nil) {
+		// Texto, fotos...: nada que transcribir
+		c.Status(http.StatusNoContent)
+		return
+	}
+	file, name := msg.Voice, "voice"+botAudioExtension("")
+	if file == nil {
+		file, name = msg.Audio, "audio"+botAudioExtension(msg.Audio.MimeType)
+		if base := headerSafe(path.Base(msg.Audio.FileName)); isIngestMedia(base) {
+			name = base
+		}
+	}
+	metadata := map[string]string{"telegram_chat_id": strconv.FormatInt(msg.Chat.ID, 10)}
+	if file.Duration > 0 {
+		metadata["telegram_duration"] = strconv.Itoa(file.Duration)
+	}
+	if msg.From != nil {
+		metadata["telegram_from"] = strconv.FormatInt(msg.From.ID, 10)
+		if msg.From.Username != "" {
+			metadata["telegram_from"] = "@" + msg.From.Username
+		}
+	}
+	jobID, err := createBotJob(*item, botMessage{
+		ChatID:    strconv.FormatInt(msg.Chat.ID, 10),
+		MessageID: strconv.FormatInt(msg.MessageID, 10),
+		MediaID:   file.FileID,
+		FileName:  name,
+		Size:      file.FileSize,
+		Metadata:  metadata,
+	})
+	if err != nil {
+		// Telegram reintentaría el update: se descarta
+		log.Printf("⚠️ Nota de voz del chat %d no procesada (integración %s): %v", msg.Chat.ID, item.ID, err)
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"job_id": jobID})
+}
+
+// Bot API de Telegram; access_token es el token del bot
+type telegramAdapter struct{}
+
+func telegramMethodURL(item Integration, method string) string {
+	return strings.TrimRight(cfg.TelegramAPIURL, "/") + "/bot" + item.token.AccessToken + "/" + method
+}
+
+// El token del bot va en la URL: se quita de los errores, que acaban en el
+// historial del job
+func redactTelegramToken(item Integration, err error) error {
+	if err == nil || item.token.AccessToken == "" {
+		return err
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), item.token.AccessToken, "<bot-token>"))
+}
+
+func (telegramAdapter) FetchMedia(ctx context.Context, item Integration, source *jobSource) (io.ReadCloser, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, telegramMethodURL(item, "getFile")+"?file_id="+url.QueryEscape(source.Media), nil)
+	if err != nil {
+		return nil, 0, redactTelegramToken(item, errors.Wrap(err, "invalid provider request"))
+	}
+	var file struct {
+		Result struct {
+			FilePath string `json:"file_path"`
+		} `json:"result"`
+	}
+	if err := doProviderRequest(&http.Client{Timeout: cfg.IntegrationTimeout.Duration}, req, &file); err != nil {
+		return nil, 0, redactTelegramToken(item, err)
+	}
+	if file.Result.FilePath == "" {
+		return nil, 0, errors.New("Telegram returned no file_path")
+	}
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(cfg.TelegramAPIURL, "/")+
+		"/file/bot"+item.token.AccessToken+"/"+file.Result.FilePath, nil)
+	if err != nil {
+		return nil, 0, redactTelegramToken(item, errors.Wrap(err, "invalid provider request"))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, redactTelegramToken(item, errors.Wrap(err, "failed to download voice note"))
+	}
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		return nil, 0, &providerError{status: resp.StatusCode, body: strings.TrimSpace(string(data))}
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (telegramAdapter) MessageLimit() int { return 4096 }
+
+func (telegramAdapter) Reply(ctx context.Context, item Integration, source *jobSource, parts []string) error {
+	for _, text := range parts {
+		body := map[string]interface{}{"chat_id": source.ReplyTo, "text": text}
+		if id, err := strconv.ParseInt(source.Key, 10, 64); err == nil {
+			body["reply_parameters"] = map[string]interface{}{"message_id": id, "allow_sending_without_reply": true}
+		}
+		data, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal Telegram message")
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, telegramMethodURL(item, "sendMessage"), bytes.NewReader(data))
+		if err != nil {
+			return redactTelegramToken(item, errors.Wrap(err, "invalid provider request"))
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if err := doProviderRequest(&http.Client{Timeout: cfg.IntegrationTimeout.Duration}, req, nil); err != nil {
+			return redactTelegramToken(item, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Nombre del ajuste compartido con las plantillas de los tenants
+const templatesSetting = "templates"
+
+// Máximo de plantillas por tenant
+const maxTemplatesPerTenant = 100
+
+var templateNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+var errTooManyTemplates = errors.Errorf("at most %d templates per tenant", maxTemplatesPerTenant)
+
+// Opciones de una plantilla; mismos nombres JSON que en POST /process
+type TemplateOptions struct {
+	Language  string           `json:"language,omitempty"`
+	Translate bool             `json:"translate,omitempty"`
+	Model     string           `json:"model,omitempty"`
+	Accuracy  string           `json:"accuracy,omitempty"`
+	Review    bool             `json:"review,omitempty"`
+	Diarize   bool             `json:"diarize,omitempty"`
+	Subtitles *SubtitleOptions `json:"subtitles,omitempty"`
+	Format    *FormatOptions   `json:"format,omitempty"`
+
+	OnlyIfLanguage []string `json:"only_if_language,omitempty"`
+}
+
+// Plantilla de un tenant: POST /process con template = Name parte de sus
+// opciones, y lo que traiga la petición tiene prioridad
+type JobTemplate struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Options     TemplateOptions `json:"options"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+type TemplateBody struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Options     TemplateOptions `json:"options"`
+}
+
+// Plantillas por tenant
+type templateRegistry struct {
+	mu        sync.RWMutex
+	templates map[string]map[string]JobTemplate
+}
+
+var jobTemplates = &templateRegistry{templates: make(map[string]map[string]JobTemplate)}
+
+func (r *templateRegistry) get(tenant, name string) (JobTemplate, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.templates[tenant][name]
+	return t, ok
+}
+
+func (r *templateRegistry) list(tenant string) []JobTemplate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]JobTemplate, 0, len(r.templates[tenant]))
+	for _, t := range r.templates[tenant] {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Guarda el registro completo; requiere r.mu tomado
+func (r *templateRegistry) persistLocked() error {
+	if stateStore == nil {
+		return nil
+	}
+	byTenant := make(map[string][]JobTemplate, len(r.templates))
+	for tenant, templates := range r.templates {
+		for _, t := range templates {
+			byTenant[tenant] = append(byTenant[tenant], t)
+		}
+		sort.Slice(byTenant[tenant], func(i, j int) bool { return byTenant[tenant][i].Name < byTenant[tenant][j].Name })
+	}
+	data, err := json.Marshal(byTenant)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal templates")
+	}
+	return stateStore.SaveSetting(templatesSetting, data)
+}
+
+// Guarda t; con create falla si ya existe y si no, si no existe. Devuelve
+// la plantilla guardada (conserva created_at al reemplazar).
+func (r *templateRegistry) save(tenant string, t JobTemplate, create bool) (JobTemplate, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	templates := r.templates[tenant]
+	previous, existed := templates[t.Name]
+	if existed == create {
+		return JobTemplate{}, existed, nil
+	}
+	if !existed && len(templates) >= maxTemplatesPerTenant {
+		return JobTemplate{}, false, errTooManyTemplates
+	}
+	if templates == nil {
+		templates = make(map[string]JobTemplate)
+		r.templates[tenant] = templates
+	}
+	if existed {
+		t.CreatedAt = previous.CreatedAt
+	}
+	templates[t.Name] = t
+	if err := r.persistLocked(); err != nil {
+		if existed {
+			templates[t.Name] = previous
+		} else {
+			delete(templates, t.Name)
+		}
+		return JobTemplate{}, existed, err
+	}
+	return t, existed, nil
+}
+
+// false si la plantilla no existía
+func (r *templateRegistry) remove(tenant, name string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.templates[tenant][name]
+	if !ok {
+		return false, nil
+	}
+	delete(r.templates[tenant], name)
+	if err := r.persistLocked(); err != nil {
+		r.templates[tenant][name] = t
+		return true, err
+	}
+	if len(r.templates[tenant]) == 0 {
+		delete(r.templates, tenant)
+	}
+	return true, nil
+}
+
+// Relee del almacén las plantillas, que pudo crear otra réplica
+func refreshTemplates() error {
+	data, err := stateStore.LoadSetting(templatesSetting)
+	if err != nil || data == nil {
+		return err
+	}
+	var byTenant map[string][]JobTemplate
+	if err := json.Unmarshal(data, &byTenant); err != nil {
+		return errors.Wrap(err, "corrupt templates")
+	}
+	templates := make(map[string]map[string]JobTemplate, len(byTenant))
+	for tenant, list := range byTenant {
+		templates[tenant] = make(map[string]JobTemplate, len(list))
+		for _, t := range list {
+			templates[tenant][t.Name] = t
+		}
+	}
+	jobTemplates.mu.Lock()
+	jobTemplates.templates = templates
+	jobTemplates.mu.Unlock()
+	return nil
+}
+
+// Lee el cuerpo de POST /process (o /transcribe/sync) sobre las opciones de
+// su plantilla, si indica una. El error lleva su código.
+func bindRequestBody(c *gin.Context, input *RequestBody) (code string, err error) {
+	data, err := c.GetRawData()
+	if err != nil {
+		return "INVALID_REQUEST", errors.Wrap(err, "failed to read request body")
+	}
+	if data, err = decodeCharset(data, c.GetHeader("Content-Type")); err != nil {
+		return "INVALID_CHARSET", err
+	}
+	var ref struct {
+		Template string `json:"template"`
+	}
+	if err := json.Unmarshal(data, &ref); err != nil {
+		return "INVALID_REQUEST", err
+	}
+	if ref.Template != "" {
+		if code, err := applyTemplate(currentTenant(c), ref.Template, input); err != nil {
+			return code, err
+		}
+	}
+	if err := json.Unmarshal(data, input); err != nil {
+		return "INVALID_REQUEST", err
+	}
+	normalizeStrings(reflect.ValueOf(input))
+	return "", nil
+}
+
+// Copia en input las opciones de la plantilla name del tenant
+func applyTemplate(tenant, name string, input *RequestBody) (code string, err error) {
+	t, ok := jobTemplates.get(tenant, name)
+	if !ok && stateStore != nil {
+		if err := refreshTemplates(); err != nil {
+			return "STATE_UNAVAILABLE", err
+		}
+		t, ok = jobTemplates.get(tenant, name)
+	}
+	if !ok {
+		return "UNKNOWN_TEMPLATE", errors.Errorf("unknown template %q", name)
+	}
+	// Por JSON para no compartir los punteros de la plantilla guardada
+	defaults, err := json.Marshal(t.Options)
+	if err != nil {
+		return "INTERNAL_ERROR", errors.Wrap(err, "failed to marshal template options")
+	}
+	if err := json.Unmarshal(defaults, input); err != nil {
+		return "INTERNAL_ERROR", errors.Wrap(err, "failed to apply template options")
+	}
+	return "", nil
+}
+
+func validateTemplate(tenant string, input TemplateBody) error {
+	if !templateNamePattern.MatchString(input.Name) {
+		return errors.New("template name must be 1-64 lowercase letters, digits, '.', '_' or '-'")
+	}
+	o := input.Options
+	if err := defaultSubtitleOptions().merge(o.Subtitles).validate(); err != nil {
+		return err
+	}
+	if err := o.Format.validate(); err != nil {
+		return err
+	}
+	if err := validateAccuracy(o.Accuracy); err != nil {
+		return err
+	}
+	if err := validateOnlyIfLanguage(o.OnlyIfLanguage); err != nil {
+		return err
+	}
+	_, err := validateRequestModel(tenant, RequestBody{Language: o.Language, Model: o.Model})
+	return err
+}
+
+// GET /templates lista las plantillas del tenant
+func listTemplatesHandler(c *gin.Context) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"templates": jobTemplates.list(currentTenant(c))})
+}
+
+// GET /templates/:name
+func getTemplateHandler(c *gin.Context) {
+	t, ok := jobTemplates.get(currentTenant(c), c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, t)
+}
+
+// POST /templates crea una plantilla
+func createTemplateHandler(c *gin.Context) {
+	var input TemplateBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	saveTemplate(c, input, true)
+}
+
+// PUT /templates/:name reemplaza una plantilla existente
+func putTemplateHandler(c *gin.Context) {
+	var input TemplateBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Name = c.Param("name")
+	saveTemplate(c, input, false)
+}
+
+func saveTemplate(c *gin.Context, input TemplateBody, create bool) {
+	tenant := currentTenant(c)
+	if err := validateTemplate(tenant, input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_REQUEST"})
+		return
+	}
+	now := time.Now()
+	t := JobTemplate{
+		Name:        input.Name,
+		Description: input.Description,
+		Options:     input.Options,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	saved, existed, err := jobTemplates.save(tenant, t, create)
+	switch {
+	case errors.Is(err, errTooManyTemplates):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	case create && existed:
+		c.JSON(http.StatusConflict, gin.H{"error": "template already exists"})
+		return
+	case !create && !existed:
+		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+		return
+	}
+	status := http.StatusOK
+	if create {
+		status = http.StatusCreated
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(status, saved)
+}
+
+// DELETE /templates/:name
+func deleteTemplateHandler(c *gin.Context) {
+	found, err := jobTemplates.remove(currentTenant(c), c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STATE_UNAVAILABLE"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/unicode/norm"
+)
+
+// El texto circula en UTF-8 y en NFC. Una misma letra yorùbá llega
+// precompuesta (ọ̀) o con marcas combinantes (ọ + ◌̀) según quién la escribió,
+// y sin componerla los glosarios, las búsquedas y la caché no la reconocen.
+
+var (
+	errInvalidUTF8        = errors.New("content is not valid UTF-8")
+	errUnsupportedCharset = errors.New("unsupported charset, send UTF-8")
+)
+
+func init() {
+	// Todos los ShouldBindJSON pasan por aquí
+	binding.JSON = utf8JSONBinding{inner: binding.JSON}
+}
+
+// Binding JSON que convierte el cuerpo a UTF-8 según el charset del
+// Content-Type, rechaza el UTF-8 no válido (encoding/json lo cambiaría por
+// U+FFFD sin avisar) y compone en NFC los strings decodificados
+type utf8JSONBinding struct {
+	inner binding.BindingBody
+}
+
+func (b utf8JSONBinding) Name() string {
+	return b.inner.Name()
+}
+
+func (b utf8JSONBinding) Bind(req *http.Request, obj interface{}) error {
+	if req == nil || req.Body == nil {
+		return errors.New("invalid request")
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	if body, err = decodeCharset(body, req.Header.Get("Content-Type")); err != nil {
+		return err
+	}
+	return b.BindBody(body, obj)
+}
+
+func (b utf8JSONBinding) BindBody(body []byte, obj interface{}) error {
+	if !utf8.Valid(body) {
+		return errInvalidUTF8
+	}
+	if err := b.inner.BindBody(body, obj); err != nil {
+		return err
+	}
+	normalizeStrings(reflect.ValueOf(obj))
+	return nil
+}
+
+// Charset del Content-Type; vacío si no lo declara
+func contentCharset(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(params["charset"])
+}
+
+func isUTF8Charset(charset string) bool {
+	return charset == "" || charset == "utf-8" || charset == "utf8"
+}
+
+// Pasa a UTF-8 un cuerpo en el charset declarado. Sin charset se asume
+// UTF-8, como manda RFC 8259 para JSON.
+func decodeCharset(body []byte, contentType string) ([]byte, error) {
+	charset := contentCharset(contentType)
+	if isUTF8Charset(charset) {
+		if !utf8.Valid(body) {
+			return nil, errInvalidUTF8
+		}
+		return body, nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, errUnsupportedCharset
+	}
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil || !utf8.Valid(decoded) {
+		return nil, errInvalidUTF8
+	}
+	return decoded, nil
+}
+
+// Compone en NFC todos los strings alcanzables desde v: campos de structs,
+// slices, mapas (también las claves) e interface{}
+func normalizeStrings(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		if v.Kind() == reflect.Interface {
+			// El valor de una interfaz no es direccionable: se copia
+			elem := reflect.New(v.Elem().Type()).Elem()
+			elem.Set(v.Elem())
+			normalizeStrings(elem)
+			if v.CanSet() {
+				v.Set(elem)
+			}
+			return
+		}
+		normalizeStrings(v.Elem())
+	case reflect.String:
+		if v.CanSet() && !norm.NFC.IsNormalString(v.String()) {
+			v.SetString(norm.NFC.String(v.String()))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				normalizeStrings(v.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			normalizeStrings(v.Index(i))
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return
+		}
+		// Se recorren las claves antes de escribir: cambiar una clave mientras
+		// se itera el mapa puede visitarla dos veces
+		for _, original := range v.MapKeys() {
+			key := reflect.New(v.Type().Key()).Elem()
+			key.Set(original)
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(original))
+			normalizeStrings(key)
+			normalizeStrings(value)
+			if key.Interface() != original.Interface() {
+				v.SetMapIndex(original, reflect.Value{})
+			}
+			v.SetMapIndex(key, value)
+		}
+	}
+}
+
+// Rechaza lo que no se puede servir o leer como UTF-8: un Accept-Charset
+// que no lo admite (406), un cuerpo de texto en un charset desconocido (415)
+// o una query que no es UTF-8 (400). Los cuerpos no se tocan aquí: los
+// webhooks firmados verifican los bytes originales.
+func charsetMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if header := c.GetHeader("Accept-Charset"); header != "" && !acceptsUTF8(header) {
+			c.AbortWithStatusJSON(http.StatusNotAcceptable, gin.H{"error": "responses are only available in UTF-8", "code": "NOT_ACCEPTABLE"})
+			return
+		}
+		if charset := contentCharset(c.GetHeader("Content-Type")); !isUTF8Charset(charset) {
+			if _, err := htmlindex.Get(charset); err != nil {
+				c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": errUnsupportedCharset.Error(), "code": "UNSUPPORTED_CHARSET"})
+				return
+			}
+		}
+		if !utf8.ValidString(c.Request.URL.Path) || !validQueryUTF8(c.Request.URL.RawQuery) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "the path and query string must be valid UTF-8", "code": "INVALID_CHARSET"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Accept-Charset admite UTF-8 si lo nombra, o nombra *, con q > 0
+func acceptsUTF8(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "utf-8" && name != "*" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func validQueryUTF8(rawQuery string) bool {
+	// Los pares mal escritos los ignora también gin; no se rechaza por ellos
+	values, _ := url.ParseQuery(rawQuery)
+	for key, list := range values {
+		if !utf8.ValidString(key) {
+			return false
+		}
+		for _, value := range list {
+			if !utf8.ValidString(value) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Letras yorùbá en NFC: las subpuntuadas existen precompuestas y el tono
+// queda como marca combinante detrás (ẹ̀ = U+1EB9 U+0300)
+const (
+	yoEDot = "\u1eb9" // ẹ
+	yoODot = "\u1ecd" // ọ
+	yoSDot = "\u1e63" // ṣ
+	grave  = "\u0300"
+	acute  = "\u0301"
+	dotBel = "\u0323"
+)
+
+func TestNormalizeStringsYoruba(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"precomposed stays", yoODot + "k" + yoODot + grave, yoODot + "k" + yoODot + grave},
+		{"combining under-dot", "o" + dotBel + "k" + "o" + dotBel + grave, yoODot + "k" + yoODot + grave},
+		{"tone before under-dot", "e" + grave + dotBel, yoEDot + grave},
+		{"subdotted s", "s" + dotBel + "e" + acute, yoSDot + "é"},
+		{"decomposed tone", "a" + grave + "a" + acute, "àá"},
+		{"greeting", "E" + dotBel + " ku" + acute + " a" + grave + "a" + acute + "r" + "o" + dotBel + grave, "Ẹ kú àár" + yoODot + grave},
+		{"ascii", "hello world", "hello world"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := struct {
+				Text  string
+				Ptr   *string
+				List  []string
+				Map   map[string]string
+				Any   interface{}
+				inner string
+			}{
+				Text:  tt.in,
+				Ptr:   &[]string{tt.in}[0],
+				List:  []string{tt.in},
+				Map:   map[string]string{tt.in: tt.in},
+				Any:   map[string]interface{}{"k": []interface{}{tt.in}},
+				inner: tt.in,
+			}
+			normalizeStrings(reflect.ValueOf(&v))
+			if v.Text != tt.want || *v.Ptr != tt.want || v.List[0] != tt.want || v.Map[tt.want] != tt.want {
+				t.Errorf("got %+q %+q %+q %+q, want %+q", v.Text, *v.Ptr, v.List[0], v.Map, tt.want)
+			}
+			if len(v.Map) != 1 {
+				t.Errorf("map has %d keys after normalising, want 1", len(v.Map))
+			}
+			if got := v.Any.(map[string]interface{})["k"].([]interface{})[0]; got != tt.want {
+				t.Errorf("interface value %+q, want %+q", got, tt.want)
+			}
+			if v.inner != tt.in {
+				t.Errorf("unexported field changed to %+q", v.inner)
+			}
+		})
+	}
+}
+
+func TestDecodeCharset(t *testing.T) {
+	tests := []struct {
+		name, contentType string
+		body              []byte
+		want              string
+		wantErr           error
+	}{
+		{"utf-8", "application/json; charset=utf-8", []byte("àár" + yoODot + grave), "àár" + yoODot + grave, nil},
+		{"no charset", "application/json", []byte(yoSDot + "é"), yoSDot + "é", nil},
+		{"latin-1", "application/json; charset=ISO-8859-1", []byte{'B', 0xe0, 'b', 0xe1}, "Bàbá", nil},
+		{"windows-1252", "text/plain; charset=windows-1252", []byte{'O', 'y', 0xe9}, "Oyé", nil},
+		{"broken utf-8", "application/json", []byte{'o', 0xcc}, "", errInvalidUTF8},
+		{"latin-1 sent as utf-8", "application/json; charset=utf-8", []byte{'B', 0xe0, 'b', 0xe1}, "", errInvalidUTF8},
+		{"unknown charset", "application/json; charset=x-klingon", []byte("a"), "", errUnsupportedCharset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeCharset(tt.body, tt.contentType)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != tt.want {
+				t.Errorf("got %+q, want %+q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Un cuerpo JSON llega en NFD, en Latin-1 o roto y sale en UTF-8 NFC
+func TestJSONBindingRoundTrip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(charsetMiddleware())
+	router.POST("/echo", func(c *gin.Context) {
+		var body struct {
+			Text string            `json:"text"`
+			Tags []string          `json:"tags"`
+			Meta map[string]string `json:"meta"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_CHARSET"})
+			return
+		}
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.JSON(http.StatusOK, body)
+	})
+
+	nfcGreeting := "Ẹ kú àár" + yoODot + grave
+	tests := []struct {
+		name, contentType, accept string
+		body                      []byte
+		wantStatus                int
+		wantText                  string
+	}{
+		{"precomposed", "application/json", "", []byte(`{"text":"` + nfcGreeting + `","tags":["` + yoSDot + `"],"meta":{"` + yoEDot + `":"` + yoODot + `"}}`), http.StatusOK, nfcGreeting},
+		{"combining", "application/json; charset=utf-8", "", []byte(`{"text":"` + norm.NFD.String(nfcGreeting) + `","tags":["s` + dotBel + `"],"meta":{"e` + dotBel + `":"o` + dotBel + `"}}`), http.StatusOK, nfcGreeting},
+		{"escaped combining", "application/json", "", []byte(`{"text":"E\u0323 ku\u0301","tags":["s\u0323"],"meta":{"e\u0323":"o\u0323"}}`), http.StatusOK, "\u1eb8 kú"},
+		{"latin-1 body", "application/json; charset=iso-8859-1", "", []byte("{\"text\":\"B\xe0b\xe1\"}"), http.StatusOK, "Bàbá"},
+		{"broken utf-8", "application/json", "", []byte("{\"text\":\"o\xcc\"}"), http.StatusBadRequest, ""},
+		{"unknown charset", "application/json; charset=x-klingon", "", []byte(`{}`), http.StatusUnsupportedMediaType, ""},
+		{"utf-8 not accepted", "application/json", "iso-8859-1", []byte(`{}`), http.StatusNotAcceptable, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/echo", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Charset", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if !utf8.Valid(w.Body.Bytes()) {
+				t.Fatalf("response is not valid UTF-8: %+q", w.Body.Bytes())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var out struct {
+				Text string            `json:"text"`
+				Tags []string          `json:"tags"`
+				Meta map[string]string `json:"meta"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+				t.Fatal(err)
+			}
+			if out.Text != tt.wantText {
+				t.Errorf("text = %+q, want %+q", out.Text, tt.wantText)
+			}
+			for _, s := range append(out.Tags, out.Text) {
+				if !norm.NFC.IsNormalString(s) {
+					t.Errorf("%+q is not NFC", s)
+				}
+			}
+			for k, v := range out.Meta {
+				if !norm.NFC.IsNormalString(k) || !norm.NFC.IsNormalString(v) {
+					t.Errorf("meta %+q: %+q is not NFC", k, v)
+				}
+			}
+		})
+	}
+}
+
+// La respuesta del backend se guarda en NFC venga como venga
+func TestBackendResponseNormalized(t *testing.T) {
+	nfc := yoEDot + " kú àár" + yoODot + grave
+	nfd := norm.NFD.String(nfc)
+	body, _ := json.Marshal(map[string]interface{}{
+		"transcription": nfd,
+		"language":      "yo",
+		"segments": []map[string]interface{}{{
+			"id": 0, "start": 0, "end": 2, "text": nfd,
+			"words": []map[string]interface{}{{"word": norm.NFD.String("àár" + yoODot + grave), "start": 1, "end": 2}},
+		}},
+	})
+
+	result, err := decodeAndParse(body, "application/json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Transcription != nfc || result.Segments[0].Text != nfc {
+		t.Errorf("transcription %+q, segment %+q, want %+q", result.Transcription, result.Segments[0].Text, nfc)
+	}
+	if w := result.Segments[0].Words[0].Word; w != "àár"+yoODot+grave {
+		t.Errorf("word = %+q", w)
+	}
+
+	latin1 := []byte("{\"transcription\":\"B\xe0b\xe1 o\",\"language\":\"yo\"}")
+	if result, err = decodeAndParse(latin1, "application/json; charset=iso-8859-1"); err != nil || result.Transcription != "Bàbá o" {
+		t.Errorf("latin-1 response = %+v, %v", result, err)
+	}
+
+	broken := []byte("{\"transcription\":\"o\xcc\xa3\xcc\",\"language\":\"yo\"}")
+	if _, err := decodeAndParse(broken, "application/json"); err == nil {
+		t.Error("broken UTF-8 accepted")
+	} else if be, ok := err.(*backendError); !ok || be.code != "INVALID_BACKEND_RESPONSE" {
+		t.Errorf("error = %v, want INVALID_BACKEND_RESPONSE", err)
+	}
+}
+
+func decodeAndParse(body []byte, contentType string) (*BackendResponse, error) {
+	body, err := decodeBackendCharset("http://backend", body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	return parseBackendResult("http://backend", body)
+}
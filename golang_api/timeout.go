@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Plazo de la ruta ("MÉTODO /ruta" tal como se registró); 0 = sin plazo
+func routeTimeout(method, fullPath string) time.Duration {
+	if d, ok := cfg.RouteTimeouts[method+" "+fullPath]; ok {
+		return d.Duration
+	}
+	return cfg.RequestTimeout.Duration
+}
+
+// Pone el plazo de la ruta como deadline del contexto de la petición. No
+// corta al handler: las lecturas del almacén y las llamadas a un backend lo
+// reciben y paran al vencer, y quien las hace responde 504 con
+// abortOnDeadline. Si el handler vuelve tras el deadline sin haber escrito
+// nada también se responde 504; lo que ya escribió se deja tal cual.
+func deadlineMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d := routeTimeout(c.Request.Method, c.FullPath())
+		if d <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			respondDeadline(c)
+		}
+	}
+}
+
+// Responde 504 si err se debe a que venció el plazo de la petición; un
+// DATABASE_TIMEOUT propio del almacén no cuenta
+func abortOnDeadline(c *gin.Context, err error) bool {
+	if err == nil || !errors.Is(err, context.DeadlineExceeded) || c.Request.Context().Err() == nil {
+		return false
+	}
+	respondDeadline(c)
+	c.Abort()
+	return true
+}
+
+func respondDeadline(c *gin.Context) {
+	d := routeTimeout(c.Request.Method, c.FullPath())
+	c.JSON(http.StatusGatewayTimeout, gin.H{"error": "request timed out after " + d.String(), "code": "TIMEOUT"})
+}
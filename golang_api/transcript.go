@@ -0,0 +1,161 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Palabra con marcas de tiempo (segundos desde el inicio del audio)
+type Word struct {
+	Word        string  `json:"word"`
+	Start       float64 `json:"start"`
+	End         float64 `json:"end"`
+	Probability float64 `json:"probability,omitempty"`
+}
+
+// Segmento de la transcripción tal como lo devuelve whisper
+type Segment struct {
+	ID       int     `json:"id"`
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Text     string  `json:"text"`
+	Language string  `json:"language,omitempty"` // solo si el backend detecta por segmento
+	Speaker  string  `json:"speaker,omitempty"`  // solo con diarización
+	Words    []Word  `json:"words,omitempty"`
+
+	// Confianza de whisper en el segmento, si el backend la devuelve
+	AvgLogprob   *float64 `json:"avg_logprob,omitempty"`
+	NoSpeechProb *float64 `json:"no_speech_prob,omitempty"`
+}
+
+// Capítulo del audio, solo si el backend los detecta
+type Chapter struct {
+	Title string  `json:"title"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// Respuesta del microservicio Python
+type BackendResponse struct {
+	Transcription string    `json:"transcription"`
+	Translation   string    `json:"translation,omitempty"`
+	Language      string    `json:"language,omitempty"` // idioma detectado o solicitado
+	ModelUsed     string    `json:"model_used,omitempty"`
+	Segments      []Segment `json:"segments,omitempty"`
+	Chapters      []Chapter `json:"chapters,omitempty"`
+}
+
+// Lleva la respuesta del backend al modelo del gateway: segmentos y
+// capítulos en orden, IDs consecutivos, sin tiempos invertidos y con el
+// texto completo aunque el backend solo devuelva segmentos.
+func (r *BackendResponse) normalize() {
+	normalizeStrings(reflect.ValueOf(r))
+	sort.SliceStable(r.Segments, func(i, j int) bool { return r.Segments[i].Start < r.Segments[j].Start })
+	texts := make([]string, 0, len(r.Segments))
+	for i := range r.Segments {
+		seg := &r.Segments[i]
+		seg.ID = i
+		if seg.End < seg.Start {
+			seg.End = seg.Start
+		}
+		for j := range seg.Words {
+			if seg.Words[j].End < seg.Words[j].Start {
+				seg.Words[j].End = seg.Words[j].Start
+			}
+		}
+		if t := strings.TrimSpace(seg.Text); t != "" {
+			texts = append(texts, t)
+		}
+	}
+	if strings.TrimSpace(r.Transcription) == "" {
+		r.Transcription = strings.Join(texts, " ")
+	}
+
+	sort.SliceStable(r.Chapters, func(i, j int) bool { return r.Chapters[i].Start < r.Chapters[j].Start })
+	for i := range r.Chapters {
+		r.Chapters[i].Title = strings.TrimSpace(r.Chapters[i].Title)
+		if r.Chapters[i].End < r.Chapters[i].Start {
+			r.Chapters[i].End = r.Chapters[i].Start
+		}
+	}
+}
+
+// Estadísticas calculadas sobre la transcripción completada
+type TranscriptStats struct {
+	WordCount      int                `json:"word_count"`
+	CharacterCount int                `json:"character_count"`
+	WordsPerMinute float64            `json:"words_per_minute,omitempty"`
+	Languages      map[string]float64 `json:"languages,omitempty"`  // fracción de palabras por idioma
+	Diacritics     *DiacriticsReport  `json:"diacritics,omitempty"` // solo yorùbá con format.diacritics
+}
+
+// Calcula las estadísticas. durationSeconds viene del sondeo previo; si no
+// se conoce se usa el final del último segmento.
+func computeStats(result *BackendResponse, durationSeconds float64) *TranscriptStats {
+	stats := &TranscriptStats{
+		WordCount:      len(strings.Fields(result.Transcription)),
+		CharacterCount: countCharacters(result.Transcription),
+	}
+
+	if durationSeconds <= 0 && len(result.Segments) > 0 {
+		durationSeconds = result.Segments[len(result.Segments)-1].End
+	}
+	if durationSeconds > 0 {
+		stats.WordsPerMinute = round2(float64(stats.WordCount) / (durationSeconds / 60))
+	}
+
+	stats.Languages = languageDistribution(result)
+	return stats
+}
+
+// Cuenta caracteres visibles: las marcas combinantes (tonos yorùbá en NFD)
+// no cuentan como caracteres propios.
+func countCharacters(text string) int {
+	count := 0
+	for _, r := range text {
+		if !unicode.Is(unicode.Mn, r) {
+			count++
+		}
+	}
+	return count
+}
+
+// Reparto de palabras por idioma. Para audio con cambio de código el
+// backend puede indicar el idioma de cada segmento; si no, todo cuenta para
+// el idioma detectado.
+func languageDistribution(result *BackendResponse) map[string]float64 {
+	counts := make(map[string]int)
+	total := 0
+	for _, seg := range result.Segments {
+		lang := seg.Language
+		if lang == "" {
+			lang = result.Language
+		}
+		if lang == "" {
+			continue
+		}
+		n := len(strings.Fields(seg.Text))
+		counts[lang] += n
+		total += n
+	}
+
+	if total == 0 {
+		if result.Language == "" {
+			return nil
+		}
+		return map[string]float64{result.Language: 1}
+	}
+
+	distribution := make(map[string]float64, len(counts))
+	for lang, n := range counts {
+		distribution[lang] = round2(float64(n) / float64(total))
+	}
+	return distribution
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Versión del documento de la transcripción. Los campos nuevos opcionales
+// suben la menor; un cambio incompatible es una mayor nueva, y las
+// anteriores se siguen sirviendo con ?schema_version.
+const transcriptSchemaVersion = "1.1"
+
+//go:embed schemas/transcript.v1.json
+var transcriptSchemaV1 []byte
+
+// Documento estable de la transcripción (esquema v1). No depende de los
+// nombres de campos del backend: si cambian, cambia la conversión.
+type TranscriptDocument struct {
+	SchemaVersion string              `json:"schema_version"`
+	JobID         string              `json:"job_id"`
+	Language      string              `json:"language,omitempty"`
+	Text          string              `json:"text"`
+	Translation   string              `json:"translation,omitempty"`
+	Duration      float64             `json:"duration_seconds,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+	PurgedAt      *time.Time          `json:"purged_at,omitempty"` // la retención borró el contenido
+	Segments      []TranscriptSegment `json:"segments"`
+	Speakers      []TranscriptSpeaker `json:"speakers"`
+	Chapters      []TranscriptChapter `json:"chapters"`
+}
+
+type TranscriptSegment struct {
+	ID       int              `json:"id"`
+	Start    float64          `json:"start"`
+	End      float64          `json:"end"`
+	Text     string           `json:"text"`
+	Language string           `json:"language,omitempty"`
+	Speaker  string           `json:"speaker,omitempty"`
+	Words    []TranscriptWord `json:"words"`
+
+	// Desde 1.1, si el backend las devuelve
+	AvgLogprob          *float64 `json:"avg_logprob,omitempty"`
+	NoSpeechProbability *float64 `json:"no_speech_probability,omitempty"`
+}
+
+type TranscriptWord struct {
+	Text       string   `json:"text"`
+	Start      float64  `json:"start"`
+	End        float64  `json:"end"`
+	Confidence *float64 `json:"confidence,omitempty"` // probabilidad de whisper, si la hay
+}
+
+// Hablante de la diarización, en orden de aparición
+type TranscriptSpeaker struct {
+	ID              string  `json:"id"`
+	SegmentCount    int     `json:"segment_count"`
+	SpeakingSeconds float64 `json:"speaking_seconds"`
+}
+
+type TranscriptChapter struct {
+	Title string  `json:"title"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// Conversión del job a cada versión mayor del esquema
+var transcriptConverters = map[string]func(jobID string, job JobState) interface{}{
+	"1": func(jobID string, job JobState) interface{} { return transcriptDocumentV1(jobID, job) },
+}
+
+// Esquemas JSON publicados, por versión mayor
+var transcriptSchemas = map[string][]byte{
+	"1": transcriptSchemaV1,
+}
+
+func transcriptDocumentV1(jobID string, job JobState) TranscriptDocument {
+	doc := TranscriptDocument{
+		SchemaVersion: transcriptSchemaVersion,
+		JobID:         jobID,
+		Language:      job.Language,
+		Text:          job.Transcription,
+		Translation:   job.Translation,
+		Duration:      job.Duration,
+		CreatedAt:     job.Timestamp,
+		PurgedAt:      job.PurgedAt,
+		Segments:      make([]TranscriptSegment, 0, len(job.Segments)),
+		Speakers:      []TranscriptSpeaker{},
+		Chapters:      make([]TranscriptChapter, 0, len(job.Chapters)),
+	}
+	speakers := make(map[string]int)
+	for _, seg := range job.Segments {
+		out := TranscriptSegment{
+			ID:       seg.ID,
+			Start:    seg.Start,
+			End:      seg.End,
+			Text:     strings.TrimSpace(seg.Text),
+			Language: seg.Language,
+			Speaker:  seg.Speaker,
+			Words:    make([]TranscriptWord, 0, len(seg.Words)),
+
+			AvgLogprob:          seg.AvgLogprob,
+			NoSpeechProbability: seg.NoSpeechProb,
+		}
+		for _, w := range seg.Words {
+			word := TranscriptWord{Text: strings.TrimSpace(w.Word), Start: w.Start, End: w.End}
+			if w.Probability > 0 {
+				p := w.Probability
+				word.Confidence = &p
+			}
+			out.Words = append(out.Words, word)
+		}
+		doc.Segments = append(doc.Segments, out)
+
+		if seg.Speaker != "" {
+			i, ok := speakers[seg.Speaker]
+			if !ok {
+				i = len(doc.Speakers)
+				speakers[seg.Speaker] = i
+				doc.Speakers = append(doc.Speakers, TranscriptSpeaker{ID: seg.Speaker})
+			}
+			doc.Speakers[i].SegmentCount++
+			doc.Speakers[i].SpeakingSeconds = round2(doc.Speakers[i].SpeakingSeconds + seg.End - seg.Start)
+		}
+	}
+	if doc.Duration == 0 && len(job.Segments) > 0 {
+		doc.Duration = job.Segments[len(job.Segments)-1].End
+	}
+	for _, ch := range job.Chapters {
+		doc.Chapters = append(doc.Chapters, TranscriptChapter{Title: ch.Title, Start: ch.Start, End: ch.End})
+	}
+	return doc
+}
+
+// Versión mayor pedida, p. ej. "1" o "1.0"; vacío es la actual. Las
+// menores solo añaden campos, así que se sirve la última de la mayor.
+func transcriptMajorVersion(raw string) string {
+	if raw == "" {
+		raw = transcriptSchemaVersion
+	}
+	major, _, _ := strings.Cut(raw, ".")
+	return major
+}
+
+// GET /result/:job_id/transcript?schema_version=1 devuelve la transcripción
+// completa en el esquema versionado
+func transcriptDocumentHandler(c *gin.Context) {
+	convert, ok := transcriptConverters[transcriptMajorVersion(c.Query("schema_version"))]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "schema_version must be 1", "code": "INVALID_REQUEST"})
+		return
+	}
+	jobID := c.Param("job_id")
+	job, exists := getJob(jobID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if job.Status != "completed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "the transcript is only available for completed jobs"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, convert(jobID, job))
+}
+
+// GET /schemas/transcript/:version devuelve el esquema JSON, p. ej. v1.json
+func transcriptSchemaHandler(c *gin.Context) {
+	version := strings.TrimSuffix(strings.TrimPrefix(c.Param("version"), "v"), ".json")
+	schema, ok := transcriptSchemas[version]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown schema version"})
+		return
+	}
+	c.Data(http.StatusOK, "application/schema+json; charset=utf-8", schema)
+}
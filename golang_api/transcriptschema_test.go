@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Validador mínimo del subconjunto de JSON Schema que usa transcript.v1.json
+func validateSchema(root, schema map[string]interface{}, value interface{}, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		def := root["$defs"].(map[string]interface{})[strings.TrimPrefix(ref, "#/$defs/")]
+		return validateSchema(root, def.(map[string]interface{}), value, path)
+	}
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: want object, got %T", path, value)
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := obj[name.(string)]; !ok {
+				return fmt.Errorf("%s: missing required %s", path, name)
+			}
+		}
+		for name, v := range obj {
+			prop, ok := props[name].(map[string]interface{})
+			if !ok {
+				if schema["additionalProperties"] == false {
+					return fmt.Errorf("%s: unknown field %s", path, name)
+				}
+				continue
+			}
+			if err := validateSchema(root, prop, v, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: want array, got %T", path, value)
+		}
+		for i, v := range arr {
+			if err := validateSchema(root, schema["items"].(map[string]interface{}), v, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: want string, got %T", path, value)
+		}
+		if n, ok := schema["minLength"].(float64); ok && float64(len(s)) < n {
+			return fmt.Errorf("%s: shorter than %v", path, n)
+		}
+		if p, ok := schema["pattern"].(string); ok && !regexp.MustCompile(p).MatchString(s) {
+			return fmt.Errorf("%s: %q does not match %s", path, s, p)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", path, s)
+			}
+		}
+	case "number", "integer":
+		n, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("%s: want %s, got %T", path, schema["type"], value)
+		}
+		if schema["type"] == "integer" && n != float64(int64(n)) {
+			return fmt.Errorf("%s: %v is not an integer", path, n)
+		}
+		if min, ok := schema["minimum"].(float64); ok && n < min {
+			return fmt.Errorf("%s: %v is below %v", path, n, min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && n > max {
+			return fmt.Errorf("%s: %v is above %v", path, n, max)
+		}
+	}
+	return nil
+}
+
+func validateTranscript(t *testing.T, doc []byte) error {
+	t.Helper()
+	var schema map[string]interface{}
+	if err := json.Unmarshal(transcriptSchemaV1, &schema); err != nil {
+		t.Fatal(err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(doc, &value); err != nil {
+		t.Fatal(err)
+	}
+	return validateSchema(schema, schema, value, "$")
+}
+
+const validTranscript = `{
+	"schema_version": "1.1",
+	"job_id": "j1",
+	"language": "yo",
+	"text": "Ẹ kú àárọ̀",
+	"duration_seconds": 3.5,
+	"created_at": "2026-01-02T15:04:05Z",
+	"segments": [{"id": 0, "start": 0, "end": 3.5, "text": "Ẹ kú àárọ̀", "speaker": "SPEAKER_00",
+		"words": [{"text": "Ẹ", "start": 0, "end": 0.4, "confidence": 0.9}], "no_speech_probability": 0.01}],
+	"speakers": [{"id": "SPEAKER_00", "segment_count": 1, "speaking_seconds": 3.5}],
+	"chapters": [{"title": "Ìkíni", "start": 0, "end": 3.5}]
+}`
+
+func TestTranscriptSchemaValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(doc map[string]interface{})
+		wantErr string // vacío = válido
+	}{
+		{"valid", func(map[string]interface{}) {}, ""},
+		{"missing required field", func(doc map[string]interface{}) { delete(doc, "job_id") }, "missing required job_id"},
+		{"missing required nested field", func(doc map[string]interface{}) {
+			delete(segment(doc), "words")
+		}, "$.segments[0]: missing required words"},
+		{"wrong type", func(doc map[string]interface{}) { doc["text"] = 42 }, "$.text: want string"},
+		{"wrong nested type", func(doc map[string]interface{}) { segment(doc)["id"] = "0" }, "$.segments[0].id: want integer"},
+		{"float id", func(doc map[string]interface{}) { segment(doc)["id"] = 1.5 }, "is not an integer"},
+		{"unknown field", func(doc map[string]interface{}) { doc["transcription"] = "x" }, "$: unknown field transcription"},
+		{"unknown nested field", func(doc map[string]interface{}) {
+			segment(doc)["no_speech_prob"] = 0.1
+		}, "$.segments[0]: unknown field no_speech_prob"},
+		{"other major version", func(doc map[string]interface{}) { doc["schema_version"] = "2.0" }, "does not match"},
+		{"bad date", func(doc map[string]interface{}) { doc["created_at"] = "yesterday" }, "is not a date-time"},
+		{"probability out of range", func(doc map[string]interface{}) {
+			segment(doc)["no_speech_probability"] = 1.5
+		}, "is above 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc map[string]interface{}
+			if err := json.Unmarshal([]byte(validTranscript), &doc); err != nil {
+				t.Fatal(err)
+			}
+			tt.edit(doc)
+			data, _ := json.Marshal(doc)
+			err := validateTranscript(t, data)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("document accepted, want error %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func segment(doc map[string]interface{}) map[string]interface{} {
+	return doc["segments"].([]interface{})[0].(map[string]interface{})
+}
+
+// La conversión desde la respuesta del backend cumple el esquema publicado
+func TestTranscriptDocumentMatchesSchema(t *testing.T) {
+	logprob, noSpeech := -0.3, 0.02
+	tests := []struct {
+		name string
+		job  JobState
+	}{
+		{"empty", JobState{Status: "completed", Timestamp: time.Now()}},
+		{"full", JobState{
+			Status:        "completed",
+			Timestamp:     time.Now(),
+			Language:      "yo",
+			Transcription: " Ẹ kú àárọ̀ ",
+			Translation:   "Good morning",
+			Segments: []Segment{
+				{ID: 0, Start: 0, End: 1.2, Text: " Ẹ kú ", Speaker: "SPEAKER_00", AvgLogprob: &logprob, NoSpeechProb: &noSpeech,
+					Words: []Word{{Word: " Ẹ", Start: 0, End: 0.5, Probability: 0.8}, {Word: " kú", Start: 0.5, End: 1.2}}},
+				{ID: 1, Start: 1.2, End: 2.4, Text: "àárọ̀", Language: "yo"},
+			},
+			Chapters: []Chapter{{Title: "Ìkíni", Start: 0, End: 2.4}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(transcriptDocumentV1("j1", tt.job))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := validateTranscript(t, data); err != nil {
+				t.Fatalf("%v\n%s", err, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Protocolo tus 1.0.0 (núcleo + creation, termination y expiration) en
+// /uploads/tus para reanudar subidas grandes desde conexiones inestables.
+// Los fragmentos se guardan en DOWNLOAD_DIR/tus, así que con varias
+// réplicas el volumen debe ser compartido o las peticiones de una subida
+// deben ir a la misma réplica.
+const tusVersion = "1.0.0"
+
+const tusExtensions = "creation,termination,expiration"
+
+// Subida tus en curso o terminada; se guarda junto a los datos como JSON
+type tusUpload struct {
+	ID          string    `json:"id"`
+	Tenant      string    `json:"tenant"`
+	Length      int64     `json:"length"`
+	Filename    string    `json:"filename,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"` // de la subida incompleta
+	Result      *Upload   `json:"result,omitempty"`
+}
+
+// Una sola escritura a la vez por subida
+var tusLocks = struct {
+	mu    sync.Mutex
+	locks map[string]bool
+}{locks: make(map[string]bool)}
+
+func tusDir() string {
+	return filepath.Join(cfg.DownloadDir, "tus")
+}
+
+func tusDataPath(id string) string {
+	return filepath.Join(tusDir(), id)
+}
+
+func tusInfoPath(id string) string {
+	return filepath.Join(tusDir(), id+".json")
+}
+
+func tryLockTus(id string) bool {
+	tusLocks.mu.Lock()
+	defer tusLocks.mu.Unlock()
+	if tusLocks.locks[id] {
+		return false
+	}
+	tusLocks.locks[id] = true
+	return true
+}
+
+func unlockTus(id string) {
+	tusLocks.mu.Lock()
+	delete(tusLocks.locks, id)
+	tusLocks.mu.Unlock()
+}
+
+func loadTusUpload(id string) (*tusUpload, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil
+	}
+	data, err := os.ReadFile(tusInfoPath(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read upload info")
+	}
+	var u tusUpload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, errors.Wrap(err, "corrupt upload info")
+	}
+	return &u, nil
+}
+
+func saveTusUpload(u *tusUpload) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal upload info")
+	}
+	tmp := tusInfoPath(u.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return errors.Wrap(err, "failed to write upload info")
+	}
+	return errors.Wrap(os.Rename(tmp, tusInfoPath(u.ID)), "failed to write upload info")
+}
+
+func removeTusUpload(id string) {
+	os.Remove(tusDataPath(id))
+	os.Remove(tusInfoPath(id))
+}
+
+// Bytes recibidos: el tamaño del archivo de datos
+func tusOffset(u *tusUpload) int64 {
+	if u.Result != nil {
+		return u.Length
+	}
+	info, err := os.Stat(tusDataPath(u.ID))
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// Upload-Metadata: "clave base64,clave base64"
+func parseTusMetadata(header string) (map[string]string, error) {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.Errorf("invalid Upload-Metadata value for %q", key)
+		}
+		meta[key] = string(value)
+	}
+	return meta, nil
+}
+
+// Cabeceras comunes y comprobación de Tus-Resumable (salvo OPTIONS)
+func tusMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Resumable", tusVersion)
+		if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != tusVersion {
+			c.Header("Tus-Version", tusVersion)
+			c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": "unsupported Tus-Resumable version", "code": "INVALID_REQUEST"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Subida del tenant de la petición; responde 404/410 si no existe o caducó
+func tusUploadFor(c *gin.Context) *tusUpload {
+	u, err := loadTusUpload(c.Param("upload_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STORAGE_FAILED"})
+		return nil
+	}
+	if u == nil || u.Tenant != currentTenant(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "upload not found"})
+		return nil
+	}
+	if u.Result == nil && time.Now().After(u.ExpiresAt) {
+		removeTusUpload(u.ID)
+		c.JSON(http.StatusGone, gin.H{"error": "upload expired"})
+		return nil
+	}
+	return u
+}
+
+// OPTIONS /uploads/tus anuncia versión, extensiones y tamaño máximo
+func tusOptionsHandler(c *gin.Context) {
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	if cfg.MaxDownloadMB > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(cfg.MaxDownloadMB*1024*1024, 10))
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// POST /uploads/tus crea una subida de Upload-Length bytes
+func tusCreateHandler(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Length must be a positive integer", "code": "INVALID_REQUEST"})
+		return
+	}
+	if maxBytes := cfg.MaxDownloadMB * 1024 * 1024; maxBytes > 0 && length > maxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "upload exceeds maximum size", "code": "UPLOAD_TOO_LARGE"})
+		return
+	}
+	meta, err := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_REQUEST"})
+		return
+	}
+	if err := os.MkdirAll(tusDir(), 0o755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errors.Wrap(err, "failed to create upload directory").Error(), "code": "STORAGE_FAILED"})
+		return
+	}
+
+	u := &tusUpload{
+		ID:          uuid.NewString(),
+		Tenant:      currentTenant(c),
+		Length:      length,
+		Filename:    meta["filename"],
+		ContentType: meta["filetype"],
+		ExpiresAt:   time.Now().Add(cfg.UploadURLTTL.Duration),
+	}
+	if err := os.WriteFile(tusDataPath(u.ID), nil, 0o644); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errors.Wrap(err, "failed to create upload file").Error(), "code": "STORAGE_FAILED"})
+		return
+	}
+	if err := saveTusUpload(u); err != nil {
+		removeTusUpload(u.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "STORAGE_FAILED"})
+		return
+	}
+	logWithRequestID(requestID(c), fmt.Sprintf("🚀 Subida tus %s creada: %d bytes", u.ID, length))
+
+	c.Header("Location", "/uploads/tus/"+u.ID)
+	c.Header("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// HEAD /uploads/tus/:upload_id devuelve el offset desde el que reanudar
+func tusHeadHandler(c *gin.Context) {
+	u := tusUploadFor(c)
+	if u == nil {
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(tusOffset(u), 10))
+	c.Header("Upload-Length", strconv.FormatInt(u.Length, 10))
+	if u.Result == nil {
+		c.Header("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	c.Status(http.StatusOK)
+}
+
+// PATCH /uploads/tus/:upload_id añade bytes en Upload-Offset. Lo recibido
+// antes de un corte se conserva; al completarse se publica como POST
+// /uploads.
+func tusPatchHandler(c *gin.Context) {
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/offset+octet-stream", "code": "INVALID_REQUEST"})
+		return
+	}
+	u := tusUploadFor(c)
+	if u == nil {
+		return
+	}
+	if !tryLockTus(u.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "upload is being written by another request"})
+		return
+	}
+	defer unlockTus(u.ID)
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	current := tusOffset(u)
+	if err != nil || offset != current || u.Result != nil {
+		c.Header("Upload-Offset", strconv.FormatInt(current, 10))
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload-Offset does not match the upload offset"})
+		return
+	}
+
+	file, err := os.OpenFile(tusDataPath(u.ID), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errors.Wrap(err, "failed to open upload file").Error(), "code": "STORAGE_FAILED"})
+		return
+	}
+	// Lo que exceda Upload-Length se descarta
+	_, copyErr := io.Copy(file, io.LimitReader(c.Request.Body, u.Length-offset))
+	closeErr := file.Close()
+	current = tusOffset(u)
+	c.Header("Upload-Offset", strconv.FormatInt(current, 10))
+	if copyErr != nil || closeErr != nil {
+		// El cliente reanuda con HEAD desde lo que sí se escribió
+		logWithRequestID(requestID(c), fmt.Sprintf("⚠️ Subida tus %s cortada en %d/%d bytes", u.ID, current, u.Length))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "upload interrupted", "code": "INVALID_REQUEST"})
+		return
+	}
+	if current < u.Length {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	if err := finishTusUpload(c.Request.Context(), u); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "code": "STORAGE_FAILED"})
+		return
+	}
+	logWithRequestID(requestID(c), fmt.Sprintf("🚀 Subida tus %s completada", u.ID))
+	c.Header("Upload-URL", u.Result.URL)
+	c.Status(http.StatusNoContent)
+}
+
+// Publica los datos completos y deja solo la información con el resultado
+func finishTusUpload(ctx context.Context, u *tusUpload) error {
+	file, err := os.Open(tusDataPath(u.ID))
+	if err != nil {
+		return errors.Wrap(err, "failed to open upload file")
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return errors.Wrap(err, "failed to hash upload")
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to rewind upload")
+	}
+	result, err := publishUpload(ctx, u.ID, file, u.Length, hex.EncodeToString(hash.Sum(nil)), u.Filename, u.ContentType)
+	if err != nil {
+		return err
+	}
+	u.Result = result
+	if err := saveTusUpload(u); err != nil {
+		return err
+	}
+	os.Remove(tusDataPath(u.ID))
+	return nil
+}
+
+// GET /uploads/tus/:upload_id devuelve la URL para POST /process una vez
+// completada la subida
+func tusGetHandler(c *gin.Context) {
+	u := tusUploadFor(c)
+	if u == nil {
+		return
+	}
+	if u.Result == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "upload is not complete"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, u.Result)
+}
+
+// DELETE /uploads/tus/:upload_id (extensión termination)
+func tusDeleteHandler(c *gin.Context) {
+	u := tusUploadFor(c)
+	if u == nil {
+		return
+	}
+	if !tryLockTus(u.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "upload is being written by another request"})
+		return
+	}
+	defer unlockTus(u.ID)
+	removeTusUpload(u.ID)
+	c.Status(http.StatusNoContent)
+}
+
+// Borra periódicamente las subidas incompletas caducadas y la información
+// de las completadas cuya URL ya expiró
+func startTusJanitor(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			sweepTusUploads()
+		}
+	}()
+}
+
+func sweepTusUploads() {
+	entries, err := os.ReadDir(tusDir())
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		u, err := loadTusUpload(id)
+		if err != nil || u == nil {
+			continue
+		}
+		expired := u.Result == nil && now.After(u.ExpiresAt)
+		if u.Result != nil && now.After(u.Result.ExpiresAt) {
+			expired = true
+		}
+		if expired && tryLockTus(id) {
+			removeTusUpload(id)
+			unlockTus(id)
+			log.Printf("🚀 Subida tus %s caducada y borrada", id)
+		}
+	}
+}
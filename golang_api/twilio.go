@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Ruta del recordingStatusCallback; no lleva API key, la autentica la firma
+const twilioCallbackPath = "/integrations/twilio"
+
+var (
+	twilioAccountPattern   = regexp.MustCompile(`^AC[0-9a-f]{32}$`)
+	twilioRecordingPattern = regexp.MustCompile(`^RE[0-9a-f]{32}$`)
+	twilioCallPattern      = regexp.MustCompile(`^CA[0-9a-f]{32}$`)
+)
+
+// Los IDs de los jobs salen de la grabación, para que un callback repetido
+// no cree otro job
+var twilioNamespace = uuid.MustParse("0c7f3b9e-52d4-4f5e-8a61-2b9d4e7c1a03")
+
+// Firma X-Twilio-Signature: HMAC-SHA1 con el auth token de la URL completa
+// seguida de cada parámetro del formulario (nombre y valor) por orden
+func validTwilioSignature(authToken, fullURL string, form url.Values, signature string) bool {
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(fullURL)
+	for _, k := range keys {
+		for _, v := range form[k] {
+			b.WriteString(k + v)
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(b.String()))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) == 1
+}
+
+// POST /integrations/twilio recibe el recordingStatusCallback de Twilio. La
+// firma se comprueba con el auth token de las integraciones twilio de la
+// cuenta (AccountSid); con la grabación completada se descarga el audio y
+// se crea un job con los datos de la llamada en metadata.
+func twilioCallbackHandler(c *gin.Context) {
+	if err := c.Request.ParseForm(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	form := c.Request.PostForm
+	fullURL := strings.TrimRight(cfg.PublicBaseURL, "/") + c.Request.URL.RequestURI()
+	signature := c.GetHeader("X-Twilio-Signature")
+	var item *Integration
+	for _, candidate := range integrations.accounts(ProviderTwilio, form.Get("AccountSid")) {
+		if validTwilioSignature(candidate.token.AccessToken, fullURL, form, signature) {
+			candidate := candidate
+			item = &candidate
+			break
+		}
+	}
+	if item == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid Twilio signature", "code": "FORBIDDEN"})
+		return
+	}
+	if form.Get("RecordingStatus") != "completed" {
+		// in-progress o absent: no hay audio que transcribir
+		c.Status(http.StatusNoContent)
+		return
+	}
+	jobID, err := ingestTwilioRecording(c.Request.Context(), *item, form)
+	if err != nil {
+		log.Printf("⚠️ Grabación %s de Twilio no procesada (integración %s): %v", form.Get("RecordingSid"), item.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "code": "DOWNLOAD_FAILED"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"job_id": jobID})
+}
+
+// Descarga la grabación a un upload del tenant y crea su job, salvo que ya
+// exista. Devuelve el ID del job.
+func ingestTwilioRecording(ctx context.Context, item Integration, form url.Values) (string, error) {
+	recordingSID, callSID := form.Get("RecordingSid"), form.Get("CallSid")
+	if !twilioRecordingPattern.MatchString(recordingSID) {
+		return "", errors.New("invalid RecordingSid")
+	}
+	jobID := uuid.NewSHA1(twilioNamespace, []byte(item.ID+"/"+recordingSID)).String()
+	if sourcedJobExists(jobID) {
+		return jobID, nil
+	}
+	input := RequestBody{}
+	if item.Template != "" {
+		if _, err := applyTemplate(item.tenant, item.Template, &input); err != nil {
+			return "", err
+		}
+	}
+
+	// Solo se envían las credenciales de la cuenta a la API de Twilio
+	api, err := url.Parse(strings.TrimRight(cfg.TwilioAPIURL, "/"))
+	if err != nil {
+		return "", errors.Wrap(err, "invalid TWILIO_API_URL")
+	}
+	recording, err := url.Parse(form.Get("RecordingUrl"))
+	if err != nil || recording.Scheme != api.Scheme || recording.Host != api.Host {
+		return "", errors.New("RecordingUrl is not a Twilio API URL")
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.DownloadTimeout.Duration)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, recording.String()+".mp3", nil)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid recording request")
+	}
+	req.SetBasicAuth(item.AccountSID, item.token.AccessToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to download recording")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return "", &providerError{status: resp.StatusCode, body: strings.TrimSpace(string(data))}
+	}
+	if cfg.MaxDownloadMB > 0 && resp.ContentLength > cfg.MaxDownloadMB*1024*1024 {
+		return "", errTooLarge
+	}
+	uploadID, err := stageSourceMedia(ctx, item.tenant, ".mp3", resp.Body, resp.ContentLength)
+	if err != nil {
+		return "", err
+	}
+
+	input.Type = JobTypeTranscription
+	input.URL = ""
+	input.UploadID = uploadID
+	input.Metadata = map[string]string{
+		"integration_id":       item.ID,
+		"twilio_recording_sid": recordingSID,
+	}
+	if v := form.Get("RecordingDuration"); v != "" && len(v) <= maxMetadataValueLength {
+		input.Metadata["twilio_recording_duration"] = v
+	}
+	if twilioCallPattern.MatchString(callSID) {
+		input.Metadata["twilio_call_sid"] = callSID
+		call, err := fetchTwilioCall(ctx, item, callSID)
+		if err != nil {
+			// Los datos de la llamada son un extra: el job se crea igual
+			log.Printf("⚠️ No se pudo leer la llamada %s de Twilio: %v", callSID, err)
+		}
+		for k, v := range map[string]string{"twilio_from": call.From, "twilio_to": call.To, "twilio_direction": call.Direction} {
+			if v != "" && len(v) <= maxMetadataValueLength {
+				input.Metadata[k] = v
+			}
+		}
+	}
+	source := &jobSource{Kind: ProviderTwilio, Key: recordingSID, Integration: item.ID, Name: callSID}
+	if createSourcedJob(jobID, item.tenant, input, source) {
+		jobLogf(jobID, "🚀 Job %s creado desde %s", jobID, source)
+	}
+	return jobID, nil
+}
+
+// Llamada de la grabación según la API de Twilio
+type twilioCall struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Direction string `json:"direction"` // inbound, outbound-api o outbound-dial
+}
+
+func fetchTwilioCall(ctx context.Context, item Integration, callSID string) (twilioCall, error) {
+	var call twilioCall
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(cfg.TwilioAPIURL, "/")+
+		"/2010-04-01/Accounts/"+item.AccountSID+"/Calls/"+callSID+".json", nil)
+	if err != nil {
+		return call, errors.Wrap(err, "invalid call request")
+	}
+	req.SetBasicAuth(item.AccountSID, item.token.AccessToken)
+	err = doProviderRequest(&http.Client{Timeout: cfg.IntegrationTimeout.Duration}, req, &call)
+	return call, err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Valores de accuracy en POST /process
+const (
+	AccuracyStandard = "standard"
+	AccuracyHigh     = "high" // dos pasadas: rápida y luego el modelo grande
+)
+
+// Contexto máximo de la primera pasada en el prompt de la segunda; whisper
+// solo usa unos 224 tokens
+const maxPromptChars = 800
+
+// Pausa mínima entre segmentos para separar regiones de voz
+const speechRegionGap = 1.0
+
+func validateAccuracy(accuracy string) error {
+	switch accuracy {
+	case "", AccuracyStandard, AccuracyHigh:
+		return nil
+	}
+	return errors.New("accuracy must be standard or high")
+}
+
+// Transcribe según el modo de precisión de la petición
+func transcribePayload(ctx context.Context, jobID string, payload PythonRequest) (*BackendResponse, string, error) {
+	if payload.Accuracy == AccuracyHigh {
+		return transcribeTwoPass(ctx, jobID, payload)
+	}
+	return transcribeWithFallback(ctx, jobID, payload)
+}
+
+// Primera pasada con un modelo rápido para el idioma y las regiones con voz;
+// la segunda, con el modelo grande, recibe su texto como prompt y transcribe
+// solo esas regiones. Si la primera falla se hace solo la segunda.
+func transcribeTwoPass(ctx context.Context, jobID string, payload PythonRequest) (*BackendResponse, string, error) {
+	first := payload
+	first.Model = cfg.TwoPassFirstModel
+	first.Backend = "" // el backend de un modelo propio puede no servir el rápido
+	if first.RouteModel != "" {
+		// Ni los de una regla que fija su modelo
+		first.Backends, first.RouteModel = nil, ""
+	}
+	first.Translate = false
+	first.Partials = nil // el borrador no se publica: la segunda pasada lo repite
+	draft, _, err := transcribeWithFallback(ctx, jobID, first)
+
+	second := payload
+	if second.Model == "" {
+		second.Model = cfg.TwoPassSecondModel
+	}
+	if err != nil {
+		jobLogf(jobID, "⚠️ Falló la primera pasada del job %s, se sigue con una sola: %v", jobID, err)
+		recordEvent(jobID, JobEvent{Type: EventError, Code: "FIRST_PASS_FAILED", Message: err.Error()})
+		return transcribeWithFallback(ctx, jobID, second)
+	}
+	if len(draft.Segments) == 0 {
+		// Sin voz en la primera pasada la segunda no va a encontrar más
+		return draft, cfg.TwoPassFirstModel, nil
+	}
+	if second.Language == "" {
+		second.Language = draft.Language
+	}
+	second.Prompt = promptFromDraft(draft.Transcription)
+	second.ClipTimestamps = speechRegions(draft.Segments)
+	jobLogf(jobID, "🚀 Primera pasada del job %s: idioma %s, %d regiones con voz", jobID, draft.Language, len(second.ClipTimestamps)/2)
+
+	return transcribeWithFallback(ctx, jobID, second)
+}
+
+// Comienzo del borrador cortado en un límite de palabra
+func promptFromDraft(text string) string {
+	text = strings.TrimSpace(text)
+	if len(text) <= maxPromptChars {
+		return text
+	}
+	cut := text[:maxPromptChars]
+	if i := strings.LastIndexAny(cut, " \n\t"); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.ToValidUTF8(cut, "")
+}
+
+// Regiones [inicio, fin, inicio, fin...] para clip_timestamps de whisper,
+// uniendo los segmentos separados por menos de speechRegionGap
+func speechRegions(segments []Segment) []float64 {
+	var regions []float64
+	for _, s := range segments {
+		if n := len(regions); n > 0 && s.Start-regions[n-1] < speechRegionGap {
+			if s.End > regions[n-1] {
+				regions[n-1] = s.End
+			}
+			continue
+		}
+		regions = append(regions, s.Start, s.End)
+	}
+	return regions
+}
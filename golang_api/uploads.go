@@ -0,0 +1,246 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// Medio subido por el cliente; se procesa con POST /process y url
+type Upload struct {
+	ID          string    `json:"upload_id"`
+	URL         string    `json:"url"` // enlace firmado que descarga el gateway
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"` // del medio descomprimido, para POST /process
+	ContentType string    `json:"content_type,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+var errUploadTooLarge = errors.New("upload exceeds maximum size")
+
+var errUnsupportedEncoding = errors.New("Content-Encoding must be gzip, zstd or identity")
+
+func uploadKey(id, name string) string {
+	return fmt.Sprintf("uploads/%s/%s", id, name)
+}
+
+// upload_id de las subidas presignadas: uuid más la extensión del archivo,
+// que el backend necesita para validar el formato
+var presignedUploadIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}(\.[a-z0-9]{1,5})?$`)
+
+// La clave depende del tenant, así que un tenant no puede usar el
+// upload_id de otro y no hace falta guardar registro de las subidas
+func presignedUploadKey(tenant, uploadID string) string {
+	sum := sha256.Sum256([]byte(tenant))
+	return fmt.Sprintf("uploads/direct/%s/%s", hex.EncodeToString(sum[:8]), uploadID)
+}
+
+// Subida directa al almacén
+type PresignedUpload struct {
+	ID        string    `json:"upload_id"`  // para POST /process
+	UploadURL string    `json:"upload_url"` // PUT del medio, sin API key
+	Method    string    `json:"method"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type PresignBody struct {
+	Filename string `json:"filename"` // solo se usa su extensión
+}
+
+// Con Content-Type application/json, POST /uploads no recibe el medio sino
+// que devuelve un enlace para subirlo directamente al almacén
+func presignUploadHandler(c *gin.Context, input PresignBody) {
+	id := uuid.NewString()
+	if ext := strings.ToLower(path.Ext(input.Filename)); ext != "" {
+		id += ext
+	}
+	if !presignedUploadIDPattern.MatchString(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "filename extension must be 1-5 letters or digits", "code": "INVALID_REQUEST"})
+		return
+	}
+	link, err := artifacts.UploadURL(c.Request.Context(), presignedUploadKey(currentTenant(c), id), cfg.UploadURLTTL.Duration)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "code": "STORAGE_FAILED"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusCreated, PresignedUpload{
+		ID:        id,
+		UploadURL: link,
+		Method:    http.MethodPut,
+		ExpiresAt: time.Now().Add(cfg.UploadURLTTL.Duration),
+	})
+}
+
+// Sustituye upload_id por un enlace firmado al medio ya subido. Devuelve
+// el estado HTTP y el código si falla.
+func resolveUpload(ctx context.Context, tenant string, input *RequestBody) (int, string, error) {
+	if input.UploadID == "" {
+		return 0, "", nil
+	}
+	if input.URL != "" {
+		return http.StatusBadRequest, "INVALID_REQUEST", errors.New("url and upload_id are mutually exclusive")
+	}
+	if !presignedUploadIDPattern.MatchString(input.UploadID) {
+		return http.StatusBadRequest, "UPLOAD_NOT_FOUND", errors.New("upload not found")
+	}
+	key := presignedUploadKey(tenant, input.UploadID)
+	size, err := artifacts.Stat(ctx, key)
+	if errors.Is(err, errObjectNotFound) {
+		return http.StatusBadRequest, "UPLOAD_NOT_FOUND", errors.New("upload not found")
+	}
+	if err != nil {
+		return http.StatusBadGateway, "STORAGE_FAILED", err
+	}
+	// El PUT presignado de S3 no limita el tamaño
+	if cfg.MaxDownloadMB > 0 && size > cfg.MaxDownloadMB*1024*1024 {
+		return http.StatusRequestEntityTooLarge, "UPLOAD_TOO_LARGE", errors.Errorf("upload exceeds %d MB", cfg.MaxDownloadMB)
+	}
+	link, err := artifacts.DownloadURL(ctx, key, cfg.UploadURLTTL.Duration)
+	if err != nil {
+		return http.StatusBadGateway, "STORAGE_FAILED", err
+	}
+	input.URL = link
+	return 0, "", nil
+}
+
+// Descomprime mientras se lee según Content-Encoding
+func uploadReader(body io.Reader, encoding string) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return io.NopCloser(body), nil
+	case "gzip", "x-gzip":
+		r, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid gzip stream")
+		}
+		return r, nil
+	case "zstd":
+		r, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid zstd stream")
+		}
+		return r.IOReadCloser(), nil
+	default:
+		return nil, errUnsupportedEncoding
+	}
+}
+
+// Copia como mucho limit bytes (0 = sin límite); el tope se aplica al medio
+// descomprimido, así un archivo pequeño no puede expandirse sin fin
+func copyLimited(dst io.Writer, src io.Reader, limit int64) (int64, error) {
+	if limit <= 0 {
+		return io.Copy(dst, src)
+	}
+	n, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	if err == nil && n > limit {
+		return n, errUploadTooLarge
+	}
+	return n, err
+}
+
+// Guarda el medio completo en el almacén de artefactos y firma su URL
+func publishUpload(ctx context.Context, id string, r io.Reader, size int64, sha, filename, contentType string) (*Upload, error) {
+	// El nombre conserva la extensión para la detección del formato
+	name := path.Base("/" + filename)
+	if name == "/" || name == "." {
+		name = "media"
+	}
+	upload := &Upload{
+		ID:          id,
+		Size:        size,
+		SHA256:      sha,
+		ContentType: contentType,
+		ExpiresAt:   time.Now().Add(cfg.UploadURLTTL.Duration),
+	}
+	key := uploadKey(id, name)
+	if err := artifacts.Put(ctx, key, r, size, contentType); err != nil {
+		return nil, err
+	}
+	link, err := artifacts.DownloadURL(ctx, key, cfg.UploadURLTTL.Duration)
+	if err != nil {
+		return nil, err
+	}
+	upload.URL = link
+	return upload, nil
+}
+
+// POST /uploads recibe el medio en el cuerpo (opcionalmente con
+// Content-Encoding gzip o zstd) y devuelve una URL para POST /process
+func uploadHandler(c *gin.Context) {
+	if c.ContentType() == "application/json" {
+		var input PresignBody
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		presignUploadHandler(c, input)
+		return
+	}
+	reader, err := uploadReader(c.Request.Body, c.GetHeader("Content-Encoding"))
+	if errors.Is(err, errUnsupportedEncoding) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error(), "code": "UNSUPPORTED_ENCODING"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_REQUEST"})
+		return
+	}
+	defer reader.Close()
+
+	if err := os.MkdirAll(cfg.DownloadDir, 0o755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errors.Wrap(err, "failed to create upload directory").Error(), "code": "STORAGE_FAILED"})
+		return
+	}
+	tmp, err := os.CreateTemp(cfg.DownloadDir, "upload-*")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errors.Wrap(err, "failed to create upload file").Error(), "code": "STORAGE_FAILED"})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := copyLimited(io.MultiWriter(tmp, hash), reader, cfg.MaxDownloadMB*1024*1024)
+	switch {
+	case errors.Is(err, errUploadTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("upload exceeds %d MB", cfg.MaxDownloadMB),
+			"code":  "UPLOAD_TOO_LARGE",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": errors.Wrap(err, "failed to read upload").Error(), "code": "INVALID_REQUEST"})
+		return
+	case size == 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "upload is empty", "code": "INVALID_REQUEST"})
+		return
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errors.Wrap(err, "failed to rewind upload").Error(), "code": "STORAGE_FAILED"})
+		return
+	}
+
+	upload, err := publishUpload(c.Request.Context(), uuid.NewString(), tmp, size, hex.EncodeToString(hash.Sum(nil)), c.Query("filename"), c.ContentType())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "code": "STORAGE_FAILED"})
+		return
+	}
+	logWithRequestID(requestID(c), fmt.Sprintf("🚀 Medio subido %s: %d bytes", upload.ID, size))
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusCreated, upload)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Modos de VAD_CHECK
+const (
+	VADCheckOff  = ""
+	VADCheckWarn = "warn" // registra un evento y sigue
+	VADCheckFail = "fail" // falla el job con NO_SPEECH
+)
+
+var (
+	silenceStartPattern    = regexp.MustCompile(`silence_start: (-?[0-9.]+)`)
+	silenceDurationPattern = regexp.MustCompile(`silence_duration: ([0-9.]+)`)
+)
+
+// Resultado de una pasada de ffmpeg sobre el medio
+type audioAnalysis struct {
+	SpeechRatio float64
+	Quality     *AudioQuality // solo si se pidió
+}
+
+// Fracción del medio con voz según silencedetect de ffmpeg: todo lo que
+// supera VAD_NOISE_DB cuenta como voz. Es un filtro por energía, rápido y
+// sin GPU, pensado para descartar grabaciones mudas antes del backend. Con
+// quality se añade astats en la misma pasada.
+func analyzeAudio(source string, duration float64, quality bool) (*audioAnalysis, error) {
+	if duration <= 0 {
+		return nil, errors.New("audio analysis requires the media duration")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.VADTimeout.Duration)
+	defer cancel()
+
+	filter := fmt.Sprintf("silencedetect=noise=%gdB:d=%g", cfg.VADNoiseDB, cfg.VADMinSilence.Seconds())
+	if quality {
+		filter += ",astats"
+	}
+	cmd := exec.CommandContext(ctx, cfg.FFmpegPath,
+		"-hide_banner", "-nostats",
+		"-i", source,
+		"-vn", "-af", filter,
+		"-f", "null", "-",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "ffmpeg audio analysis failed: %s", lastLine(stderr.String()))
+	}
+	result := &audioAnalysis{SpeechRatio: speechRatio(stderr.String(), duration)}
+	if quality {
+		result.Quality = audioQuality(stderr.String(), result.SpeechRatio, duration)
+	}
+	return result, nil
+}
+
+// Suma los silencios del log de silencedetect. Un silencio que llega al
+// final del medio no tiene silence_end y se cierra con la duración.
+func speechRatio(log string, duration float64) float64 {
+	var silence float64
+	for _, m := range silenceDurationPattern.FindAllStringSubmatch(log, -1) {
+		d, _ := strconv.ParseFloat(m[1], 64)
+		silence += d
+	}
+	starts := silenceStartPattern.FindAllStringSubmatch(log, -1)
+	if ends := len(silenceDurationPattern.FindAllString(log, -1)); len(starts) > ends {
+		start, _ := strconv.ParseFloat(starts[len(starts)-1][1], 64)
+		if start < 0 {
+			start = 0
+		}
+		if start < duration {
+			silence += duration - start
+		}
+	}
+	ratio := 1 - silence/duration
+	if ratio < 0 {
+		ratio = 0
+	}
+	return round2(ratio)
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
+
+func noSpeechError(ratio float64) error {
+	return errors.Errorf("media contains almost no speech (%.0f%% speech, minimum %.0f%%)", ratio*100, live().VADMinSpeechRatio*100)
+}
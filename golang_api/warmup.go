@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Estado del modelo en un backend según el gateway (warm_state en /capacity)
+const (
+	BackendCold    = "cold"    // sin calentar o sin jobs desde BACKEND_WARMUP_IDLE
+	BackendWarming = "warming" // calentamiento en curso
+	BackendWarm    = "warm"    // un job o un calentamiento reciente cargó el modelo
+)
+
+// Cada cuánto se buscan backends fríos
+const backendWarmupCheck = 30 * time.Second
+
+// Plazo de un calentamiento: cargar large puede tardar minutos
+const backendWarmupTimeout = 10 * time.Minute
+
+// El backend no sabe calentarse (p. ej. sin POST /warmup): no se reintenta
+var errWarmupUnsupported = errors.New("backend does not support warm-up")
+
+// Busca backends fríos al arrancar y cada backendWarmupCheck
+func (p *backendPool) startWarmup() {
+	p.warmAll()
+	ticker := time.NewTicker(backendWarmupCheck)
+	go func() {
+		for range ticker.C {
+			p.warmAll()
+		}
+	}()
+}
+
+// Enfría los backends sin jobs desde BACKEND_WARMUP_IDLE (o caídos, que
+// pueden volver sin el modelo) y, con BACKEND_WARMUP, calienta los fríos
+// sanos. Uno con jobs en curso ya tiene el modelo cargado.
+func (p *backendPool) warmAll() {
+	c := live()
+	now := time.Now()
+	var cold []*BackendStatus
+	p.mu.Lock()
+	for _, b := range p.backends {
+		switch {
+		case !b.Healthy:
+			b.WarmState = BackendCold
+			continue
+		case b.WarmState == BackendWarm && b.InFlight == 0 && now.Sub(b.lastUsed) > c.BackendWarmupIdle.Duration:
+			b.WarmState = BackendCold
+		}
+		if c.BackendWarmup && b.WarmState == BackendCold && b.InFlight == 0 && !b.warmupUnsupported {
+			b.WarmState = BackendWarming
+			cold = append(cold, b)
+		}
+	}
+	p.mu.Unlock()
+	for _, b := range cold {
+		go p.warm(b, c.BackendWarmupModel)
+	}
+}
+
+func (p *backendPool) warm(b *BackendStatus, model string) {
+	ctx, cancel := context.WithTimeout(context.Background(), backendWarmupTimeout)
+	defer cancel()
+	start := time.Now()
+	err := transcriberFor(b.URL).warmup(ctx, b.URL, model)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case err == nil:
+		b.markWarm()
+		log.Printf("🚀 Backend %s calentado en %s", b.URL, time.Since(start).Round(time.Millisecond))
+	case errors.Is(err, errWarmupUnsupported):
+		b.WarmState = BackendCold
+		b.warmupUnsupported = true
+		log.Printf("⚠️ Backend %s sin calentamiento: %v", b.URL, err)
+	default:
+		if b.WarmState == BackendWarming {
+			b.WarmState = BackendCold
+		}
+		log.Printf("⚠️ No se pudo calentar el backend %s: %v", b.URL, err)
+	}
+}
+
+func (b *BackendStatus) markWarm() {
+	now := time.Now()
+	b.WarmState = BackendWarm
+	b.WarmedAt = &now
+	b.lastUsed = now
+}
+
+// Una transcripción terminada deja el modelo cargado; una fallida solo
+// cuenta como uso
+func (p *backendPool) used(baseURL string, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, b := range p.backends {
+		if b.URL != baseURL {
+			continue
+		}
+		b.lastUsed = time.Now()
+		if ok {
+			b.markWarm()
+		}
+	}
+}
+
+// POST {backend}/warmup con el modelo; un 404 es un backend que no lo expone
+func (t *httpTranscriber) warmup(ctx context.Context, baseURL, model string) error {
+	body, _ := json.Marshal(map[string]string{"model": model})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/warmup", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "invalid backend URL")
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "warm-up request failed")
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errWarmupUnsupported
+	case resp.StatusCode != http.StatusOK:
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("warm-up responded with status %d: %s", resp.StatusCode, message)
+	}
+	return nil
+}
@@ -0,0 +1,575 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Eventos a los que puede suscribirse un webhook
+const (
+	WebhookJobCompleted   = "job.completed"
+	WebhookJobFailed      = "job.failed"
+	WebhookJobSkipped     = "job.skipped"     // idioma fuera de only_if_language
+	WebhookBatchCompleted = "batch.completed" // se acepta ya; se emitirá cuando existan los lotes
+)
+
+var webhookEventTypes = []string{WebhookJobCompleted, WebhookJobFailed, WebhookJobSkipped, WebhookBatchCompleted}
+
+// Entrada del catálogo de GET /webhooks/events
+type WebhookEventInfo struct {
+	Type        string         `json:"type"`
+	Description string         `json:"description"`
+	Emitted     bool           `json:"emitted"` // false: se acepta en la suscripción pero aún no se envía
+	Example     WebhookPayload `json:"example"`
+}
+
+// Catálogo con un ejemplo de cada cuerpo, para configurar el receptor sin
+// esperar a un evento real
+func webhookEventCatalog() []WebhookEventInfo {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	completed := JobState{
+		Type:          JobTypeTranscription,
+		Status:        "completed",
+		Transcription: "ẹ kú àárọ̀",
+		Language:      "yo",
+		Segments:      []Segment{{ID: 0, Start: 0, End: 1.5, Text: "ẹ kú àárọ̀"}},
+		Tags:          []string{"user:42"},
+		Duration:      1.5,
+		Timestamp:     at,
+	}
+	failed := JobState{
+		Type:      JobTypeTranscription,
+		Status:    "failed",
+		Error:     "failed to download media: unexpected status 404",
+		ErrorCode: "DOWNLOAD_FAILED",
+		Timestamp: at,
+	}
+	skipped := JobState{
+		Type:          JobTypeTranscription,
+		Status:        "skipped",
+		Language:      "fr",
+		LanguageCheck: &LanguageCheck{Detected: "fr", Allowed: []string{"yo", "en"}, Model: "base", SampleSeconds: 30},
+		Timestamp:     at,
+	}
+	example := func(event string, job JobState) WebhookPayload {
+		return WebhookPayload{
+			ID:        "2f8b6c1e-0000-4000-8000-000000000000",
+			Type:      event,
+			CreatedAt: at,
+			Data:      webhookJobData{JobID: "9a0e7f4c-0000-4000-8000-000000000000", Job: job},
+		}
+	}
+	return []WebhookEventInfo{
+		{
+			Type:        WebhookJobCompleted,
+			Description: "A job finished successfully; data.job is the same object as GET /result/{job_id}.",
+			Emitted:     true,
+			Example:     example(WebhookJobCompleted, completed),
+		},
+		{
+			Type:        WebhookJobFailed,
+			Description: "A job failed; data.job.error_code is the stable reason.",
+			Emitted:     true,
+			Example:     example(WebhookJobFailed, failed),
+		},
+		{
+			Type:        WebhookJobSkipped,
+			Description: "The detected language is not in only_if_language; data.job.language_check has the detection and there is no transcription.",
+			Emitted:     true,
+			Example:     example(WebhookJobSkipped, skipped),
+		},
+		{
+			Type:        WebhookBatchCompleted,
+			Description: "Every job of a batch finished. Reserved: accepted in subscriptions, not sent yet.",
+			Example:     WebhookPayload{ID: "2f8b6c1e-0000-4000-8000-000000000000", Type: WebhookBatchCompleted, CreatedAt: at, Data: gin.H{}},
+		},
+	}
+}
+
+// Máximo de webhooks por tenant
+const maxWebhooksPerTenant = 20
+
+// Webhook registrado por un tenant. El secreto solo se devuelve al crearlo
+// o rotarlo.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Enabled   bool      `json:"enabled"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	tenant         string
+	previousSecret string    // sigue firmando hasta previousExpiry tras una rotación
+	previousExpiry time.Time // fin del periodo de gracia
+}
+
+// Cuerpo de POST y PATCH /webhooks; en PATCH los campos ausentes no cambian
+type WebhookBody struct {
+	URL     *string  `json:"url"`
+	Events  []string `json:"events"`
+	Enabled *bool    `json:"enabled"`
+}
+
+// Cuerpo enviado al endpoint del tenant
+type WebhookPayload struct {
+	ID        string      `json:"id"` // id de la entrega, igual en los reintentos
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type webhookJobData struct {
+	JobID string   `json:"job_id"`
+	Job   JobState `json:"job"`
+}
+
+// Copia persistente de un webhook, con los campos internos
+type WebhookRecord struct {
+	Webhook
+	Tenant         string    `json:"tenant"`
+	PreviousSecret string    `json:"previous_secret,omitempty"`
+	PreviousExpiry time.Time `json:"previous_expiry"`
+}
+
+type webhookStore struct {
+	mu    sync.RWMutex
+	hooks map[string]*Webhook
+}
+
+var webhooks = &webhookStore{hooks: make(map[string]*Webhook)}
+
+// Webhook del tenant sin secretos; nil si no existe o es de otro tenant
+func (s *webhookStore) get(tenant, id string) *Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hook, ok := s.hooks[id]
+	if !ok || hook.tenant != tenant {
+		return nil
+	}
+	return hook.public()
+}
+
+// Carga (o recarga, en los workers) los webhooks guardados en el StateStore
+func (s *webhookStore) restore() error {
+	records, err := stateStore.LoadWebhooks()
+	if err != nil {
+		return err
+	}
+	hooks := make(map[string]*Webhook, len(records))
+	for _, rec := range records {
+		hook := rec.Webhook
+		hook.tenant = rec.Tenant
+		hook.previousSecret = rec.PreviousSecret
+		hook.previousExpiry = rec.PreviousExpiry
+		hooks[hook.ID] = &hook
+	}
+	s.mu.Lock()
+	s.hooks = hooks
+	s.mu.Unlock()
+	return nil
+}
+
+// Requiere s.mu tomado
+func (s *webhookStore) persistLocked() {
+	if stateStore == nil {
+		return
+	}
+	records := make([]WebhookRecord, 0, len(s.hooks))
+	for _, hook := range s.hooks {
+		records = append(records, WebhookRecord{
+			Webhook:        *hook,
+			Tenant:         hook.tenant,
+			PreviousSecret: hook.previousSecret,
+			PreviousExpiry: hook.previousExpiry,
+		})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].CreatedAt.Before(records[j].CreatedAt) })
+	if err := stateStore.SaveWebhooks(records); err != nil {
+		log.Printf("⚠️ No se pudieron persistir los webhooks: %v", err)
+	}
+}
+
+func (s *webhookStore) list(tenant string) []*Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []*Webhook{}
+	for _, hook := range s.hooks {
+		if hook.tenant == tenant {
+			out = append(out, hook.public())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+func (s *webhookStore) create(tenant string, hook *Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, h := range s.hooks {
+		if h.tenant == tenant {
+			count++
+		}
+	}
+	if count >= maxWebhooksPerTenant {
+		return errors.Errorf("at most %d webhooks per tenant", maxWebhooksPerTenant)
+	}
+	hook.tenant = tenant
+	s.hooks[hook.ID] = hook
+	s.persistLocked()
+	return nil
+}
+
+// Aplica fn al webhook del tenant y devuelve la copia resultante
+func (s *webhookStore) update(tenant, id string, fn func(hook *Webhook)) *Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hook, ok := s.hooks[id]
+	if !ok || hook.tenant != tenant {
+		return nil
+	}
+	fn(hook)
+	hook.UpdatedAt = time.Now()
+	s.persistLocked()
+	return hook.public()
+}
+
+func (s *webhookStore) delete(tenant, id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hook, ok := s.hooks[id]
+	if !ok || hook.tenant != tenant {
+		return false
+	}
+	delete(s.hooks, id)
+	s.persistLocked()
+	return true
+}
+
+// IDs de los webhooks activos del tenant suscritos al evento
+func (s *webhookStore) subscribers(tenant, event string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []string
+	for _, hook := range s.hooks {
+		if hook.tenant == tenant && hook.Enabled && containsString(hook.Events, event) {
+			out = append(out, hook.ID)
+		}
+	}
+	return out
+}
+
+// Copia completa (con secretos) para firmar una entrega
+func (s *webhookStore) lookup(id string) (Webhook, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hook, ok := s.hooks[id]
+	if !ok {
+		return Webhook{}, false
+	}
+	return *hook, true
+}
+
+func (h *Webhook) public() *Webhook {
+	out := *h
+	out.Secret = ""
+	out.Events = append([]string(nil), h.Events...)
+	return &out
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err, "failed to generate webhook secret")
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+func validateWebhookEvents(events []string) error {
+	if len(events) == 0 {
+		return errors.New("at least one event is required")
+	}
+	for _, e := range events {
+		if !containsString(webhookEventTypes, e) {
+			return errors.Errorf("unknown event %q", e)
+		}
+	}
+	return nil
+}
+
+// GET /webhooks/events describe los eventos a los que se puede suscribir un
+// webhook, con la cabecera de firma y un cuerpo de ejemplo
+func webhookEventsHandler(c *gin.Context) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{
+		"events": webhookEventCatalog(),
+		"headers": gin.H{
+			"X-Webhook-ID":        "ID of the webhook",
+			"X-Webhook-Event":     "event type",
+			"X-Webhook-Delivery":  "delivery ID, the same across retries: use it to deduplicate",
+			"X-Webhook-Signature": "t=<unix>,v1=<hex>: HMAC-SHA256 of \"<t>.<body>\" with the webhook secret",
+		},
+	})
+}
+
+// GET /webhooks lista los webhooks del tenant
+func listWebhooksHandler(c *gin.Context) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"webhooks": webhooks.list(currentTenant(c))})
+}
+
+// POST /webhooks registra un endpoint y devuelve su secreto de firma
+func createWebhookHandler(c *gin.Context) {
+	var input WebhookBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.URL == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url is required", "code": "INVALID_URL"})
+		return
+	}
+	if _, err := validateMediaURL(*input.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_URL"})
+		return
+	}
+	if err := validateWebhookEvents(input.Events); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "INTERNAL_ERROR"})
+		return
+	}
+
+	now := time.Now()
+	hook := &Webhook{
+		ID:        uuid.NewString(),
+		URL:       *input.URL,
+		Events:    input.Events,
+		Enabled:   input.Enabled == nil || *input.Enabled,
+		Secret:    secret,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := webhooks.create(currentTenant(c), hook); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := hook.public()
+	response.Secret = secret
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusCreated, response)
+}
+
+// GET /webhooks/:webhook_id
+func getWebhookHandler(c *gin.Context) {
+	hook := webhooks.get(currentTenant(c), c.Param("webhook_id"))
+	if hook == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, hook)
+}
+
+// PATCH /webhooks/:webhook_id cambia url, eventos o enabled
+func updateWebhookHandler(c *gin.Context) {
+	var input WebhookBody
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.URL != nil {
+		if _, err := validateMediaURL(*input.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_URL"})
+			return
+		}
+	}
+	if input.Events != nil {
+		if err := validateWebhookEvents(input.Events); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	hook := webhooks.update(currentTenant(c), c.Param("webhook_id"), func(hook *Webhook) {
+		if input.URL != nil {
+			hook.URL = *input.URL
+		}
+		if input.Events != nil {
+			hook.Events = input.Events
+		}
+		if input.Enabled != nil {
+			hook.Enabled = *input.Enabled
+		}
+	})
+	if hook == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, hook)
+}
+
+// DELETE /webhooks/:webhook_id
+func deleteWebhookHandler(c *gin.Context) {
+	if !webhooks.delete(currentTenant(c), c.Param("webhook_id")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// POST /webhooks/:webhook_id/rotate-secret genera un secreto nuevo. El
+// anterior sigue firmando durante WebhookSecretGrace para que el receptor
+// pueda actualizarse sin perder entregas.
+func rotateWebhookSecretHandler(c *gin.Context) {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "INTERNAL_ERROR"})
+		return
+	}
+	var expires time.Time
+	hook := webhooks.update(currentTenant(c), c.Param("webhook_id"), func(hook *Webhook) {
+		hook.previousSecret = hook.Secret
+		hook.previousExpiry = time.Now().Add(cfg.WebhookSecretGrace.Duration)
+		hook.Secret = secret
+		expires = hook.previousExpiry
+	})
+	if hook == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		return
+	}
+	hook.Secret = secret
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{
+		"webhook":                    hook,
+		"previous_secret_expires_at": expires,
+	})
+}
+
+// Firma "t=<unix>,v1=<hex>[,v1=<hex>]": HMAC-SHA256 de "<t>.<cuerpo>" con el
+// secreto actual y, durante la gracia de una rotación, con el anterior
+func signWebhook(hook Webhook, body []byte, now time.Time) string {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	sig := "t=" + ts + ",v1=" + webhookHMAC(hook.Secret, ts, body)
+	if hook.previousSecret != "" && now.Before(hook.previousExpiry) {
+		sig += ",v1=" + webhookHMAC(hook.previousSecret, ts, body)
+	}
+	return sig
+}
+
+func webhookHMAC(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Evento de webhook que corresponde al estado terminal del job
+func webhookEventFor(status string) string {
+	switch status {
+	case "completed":
+		return WebhookJobCompleted
+	case "failed":
+		return WebhookJobFailed
+	case "skipped":
+		return WebhookJobSkipped
+	}
+	return ""
+}
+
+// Encola en el outbox una entrega por webhook suscrito al llegar a un estado
+// terminal. Requiere mu tomado.
+func notifyWebhooksLocked(jobID, status string) {
+	event := webhookEventFor(status)
+	job, ok := jobStore[jobID]
+	if event == "" || !ok {
+		return
+	}
+	var tenant string
+	if meta, ok := jobMetas[jobID]; ok {
+		tenant = meta.Tenant
+	}
+	for _, hookID := range webhooks.subscribers(tenant, event) {
+		payload := WebhookPayload{
+			ID:        uuid.NewString(),
+			Type:      event,
+			CreatedAt: time.Now(),
+			Data:      webhookJobData{JobID: jobID, Job: *job},
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("❌ No se pudo serializar el webhook %s: %v", hookID, err)
+			continue
+		}
+		enqueueOutboxLocked(jobID, OutboxMessage{ID: payload.ID, Kind: OutboxWebhook, Target: hookID, Event: event, Payload: body})
+	}
+}
+
+// Un intento de entrega desde el outbox; el resultado queda en el historial
+// del job al resolverse el mensaje
+func deliverWebhook(msg OutboxMessage) (string, error) {
+	hook, ok := webhooks.lookup(msg.Target)
+	if !ok || !hook.Enabled {
+		return "", errOutboxDiscard
+	}
+	client := &http.Client{Timeout: cfg.WebhookTimeout.Duration}
+	status, err := postWebhook(client, hook, msg.Event, msg.ID, msg.Payload)
+	if err != nil {
+		return "", errors.Wrapf(err, "%s to %s", msg.Event, hook.URL)
+	}
+	return fmt.Sprintf("%s delivered to %s (%d)", msg.Event, hook.URL, status), nil
+}
+
+func postWebhook(client *http.Client, hook Webhook, event, deliveryID string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("User-Agent", "transcribe-whisper-webhooks")
+	req.Header.Set("X-Webhook-ID", hook.ID)
+	req.Header.Set("X-Webhook-Event", event)
+	req.Header.Set("X-Webhook-Delivery", deliveryID)
+	req.Header.Set("X-Webhook-Signature", signWebhook(hook, body, time.Now()))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "webhook request failed")
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.Errorf("webhook endpoint returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Ruta del webhook de la app de WhatsApp Business; no lleva API key, la
+// autentica X-Hub-Signature-256
+const whatsAppWebhookPath = "/integrations/whatsapp"
+
+// Tamaño máximo del cuerpo de un webhook
+const maxWhatsAppWebhookBytes = 1 << 20
+
+var whatsAppPhoneNumberIDPattern = regexp.MustCompile(`^[0-9]{1,32}$`)
+
+// Notificación de la Cloud API; solo interesan los mensajes de audio
+type whatsAppEvent struct {
+	Object string `json:"object"`
+	Entry  []struct {
+		Changes []struct {
+			Field string `json:"field"`
+			Value struct {
+				Metadata struct {
+					PhoneNumberID string `json:"phone_number_id"`
+				} `json:"metadata"`
+				Messages []struct {
+					From  string `json:"from"`
+					ID    string `json:"id"`
+					Type  string `json:"type"`
+					Audio *struct {
+						ID       string `json:"id"`
+						MimeType string `json:"mime_type"`
+						Voice    bool   `json:"voice"`
+					} `json:"audio"`
+				} `json:"messages"`
+			} `json:"value"`
+		} `json:"changes"`
+	} `json:"entry"`
+}
+
+// Firma X-Hub-Signature-256: sha256= y el HMAC-SHA256 del cuerpo con el app
+// secret
+func validWhatsAppSignature(appSecret string, body []byte, signature string) bool {
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+	return hmac.Equal([]byte("sha256="+hex.EncodeToString(mac.Sum(nil))), []byte(signature))
+}
+
+// GET /integrations/whatsapp verifica la suscripción del webhook: devuelve
+// hub.challenge si hub.verify_token es el de una integración whatsapp
+func whatsAppVerifyHandler(c *gin.Context) {
+	token := c.Query("hub.verify_token")
+	if c.Query("hub.mode") == "subscribe" && token != "" {
+		for _, candidate := range integrations.accounts(ProviderWhatsApp, "") {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(candidate.token.VerifyToken)) == 1 {
+				c.String(http.StatusOK, c.Query("hub.challenge"))
+				return
+			}
+		}
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "invalid verify token", "code": "FORBIDDEN"})
+}
+
+// POST /integrations/whatsapp recibe las notificaciones de la app. La firma
+// se comprueba con el app secret (webhook_secret) de las integraciones del
+// phone_number_id de cada cambio; cada audio recibido crea un job de
+// transcripción y, al terminar, se responde al remitente con el texto.
+func whatsAppWebhookHandler(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWhatsAppWebhookBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var event whatsAppEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid WhatsApp event", "code": "INVALID_REQUEST"})
+		return
+	}
+	signature := c.GetHeader("X-Hub-Signature-256")
+	verified := false
+	jobIDs := []string{}
+	for _, entry := range event.Entry {
+		for _, change := range entry.Changes {
+			phoneNumberID := change.Value.Metadata.PhoneNumberID
+			if phoneNumberID == "" {
+				continue
+			}
+			var item *Integration
+			for _, candidate := range integrations.accounts(ProviderWhatsApp, phoneNumberID) {
+				if validWhatsAppSignature(candidate.token.WebhookSecret, body, signature) {
+					candidate := candidate
+					item = &candidate
+					break
+				}
+			}
+			if item == nil {
+				continue
+			}
+			verified = true
+			for _, msg := range change.Value.Messages {
+				if msg.Type != "audio" || msg.Audio == nil {
+					continue
+				}
+				jobID, err := createBotJob(*item, botMessage{
+					ChatID:    msg.From,
+					MessageID: msg.ID,
+					MediaID:   msg.Audio.ID,
+					FileName:  "voice" + botAudioExtension(msg.Audio.MimeType),
+					Metadata:  map[string]string{"whatsapp_from": msg.From, "whatsapp_phone_number_id": phoneNumberID},
+				})
+				if err != nil {
+					// WhatsApp reintentaría la notificación: se descarta
+					log.Printf("⚠️ Audio %s de WhatsApp no procesado (integración %s): %v", msg.ID, item.ID, err)
+					continue
+				}
+				jobIDs = append(jobIDs, jobID)
+			}
+		}
+	}
+	if !verified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid WhatsApp signature", "code": "FORBIDDEN"})
+		return
+	}
+	if len(jobIDs) == 0 {
+		// Estados de entrega, textos...
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.JSON(http.StatusOK, gin.H{"job_ids": jobIDs})
+}
+
+// Cloud API de WhatsApp Business; access_token es el token del usuario del
+// sistema con whatsapp_business_messaging
+type whatsAppAdapter struct{}
+
+func (whatsAppAdapter) FetchMedia(ctx context.Context, item Integration, source *jobSource) (io.ReadCloser, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(cfg.WhatsAppAPIURL, "/")+"/"+url.PathEscape(source.Media), nil)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "invalid provider request")
+	}
+	req.Header.Set("Authorization", "Bearer "+item.token.AccessToken)
+	var media struct {
+		URL      string `json:"url"`
+		FileSize int64  `json:"file_size"`
+	}
+	if err := doProviderRequest(&http.Client{Timeout: cfg.IntegrationTimeout.Duration}, req, &media); err != nil {
+		return nil, 0, err
+	}
+	if cfg.MaxDownloadMB > 0 && media.FileSize > cfg.MaxDownloadMB*1024*1024 {
+		return nil, 0, errTooLarge
+	}
+	if u, err := url.Parse(media.URL); err != nil || (u.Scheme != "https" && !strings.HasPrefix(cfg.WhatsAppAPIURL, u.Scheme+"://")) {
+		return nil, 0, errors.New("WhatsApp returned an invalid media URL")
+	}
+	// El enlace de la media también exige el token
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, media.URL, nil)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "invalid provider request")
+	}
+	req.Header.Set("Authorization", "Bearer "+item.token.AccessToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to download voice note")
+	}
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		return nil, 0, &providerError{status: resp.StatusCode, body: strings.TrimSpace(string(data))}
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (whatsAppAdapter) MessageLimit() int { return 4096 }
+
+func (whatsAppAdapter) Reply(ctx context.Context, item Integration, source *jobSource, parts []string) error {
+	for _, text := range parts {
+		data, err := json.Marshal(map[string]interface{}{
+			"messaging_product": "whatsapp",
+			"recipient_type":    "individual",
+			"to":                source.ReplyTo,
+			"type":              "text",
+			"text":              map[string]string{"body": text},
+			"context":           map[string]string{"message_id": source.Key},
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal WhatsApp message")
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(cfg.WhatsAppAPIURL, "/")+
+			"/"+url.PathEscape(item.PhoneNumberID)+"/messages", bytes.NewReader(data))
+		if err != nil {
+			return errors.Wrap(err, "invalid provider request")
+		}
+		req.Header.Set("Authorization", "Bearer "+item.token.AccessToken)
+		req.Header.Set("Content-Type", "application/json")
+		if err := doProviderRequest(&http.Client{Timeout: cfg.IntegrationTimeout.Duration}, req, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Informe de diacríticos de una transcripción en yorùbá. Casi toda palabra
+// lleva tono o subpunto salvo las de tono medio, así que una cobertura baja
+// suele indicar que whisper perdió las marcas.
+type DiacriticsReport struct {
+	Words        int      `json:"words"`
+	MarkedWords  int      `json:"marked_words"`            // con tono o subpunto
+	Coverage     float64  `json:"coverage"`                // marked_words / words
+	FixedWords   int      `json:"fixed_words"`             // corregidas por la normalización
+	InvalidWords []string `json:"invalid_words,omitempty"` // con letras ajenas a la ortografía yorùbá
+}
+
+// Máximo de palabras no válidas listadas en el informe
+const maxReportedInvalidWords = 20
+
+const (
+	combiningGrave         = '\u0300'
+	combiningAcute         = '\u0301'
+	combiningMacron        = '\u0304'
+	combiningDotBelow      = '\u0323'
+	combiningVerticalBelow = '\u0329' // e̩, o̩, s̩: variante antigua del subpunto
+)
+
+// Letras precompuestas de otras ortografías que se usan por error en lugar
+// del subpunto
+var yorubaLookalikes = strings.NewReplacer(
+	"ȩ", "ẹ", "Ȩ", "Ẹ", // e con cedilla
+	"ǫ", "ọ", "Ǫ", "Ọ", // o con ogonek
+	"ş", "ṣ", "Ş", "Ṣ", // s con cedilla
+	"ș", "ṣ", "Ș", "Ṣ", // s con coma
+)
+
+// Normaliza tonos y subpuntos: deshace el texto UTF-8 leído como
+// Windows-1252, sustituye las letras parecidas y las marcas sueltas por las
+// combinantes correctas y compone en NFC
+func normalizeYoruba(text string) string {
+	words := strings.SplitAfter(text, " ")
+	for i, w := range words {
+		words[i] = repairMojibake(w)
+	}
+	text = strings.Join(words, "")
+	text = yorubaLookalikes.Replace(text)
+
+	runes := []rune(norm.NFD.String(text))
+	out := make([]rune, 0, len(runes))
+	for i, r := range runes {
+		switch r {
+		case combiningVerticalBelow:
+			r = combiningDotBelow
+		case '\u00b4', '\u02ca': // acento agudo suelto
+			if i > 0 && unicode.IsLetter(runes[i-1]) {
+				r = combiningAcute
+			}
+		case '\u02cb': // grave suelto
+			if i > 0 && unicode.IsLetter(runes[i-1]) {
+				r = combiningGrave
+			}
+		}
+		out = append(out, r)
+	}
+	// NFC reordena las marcas (subpunto antes del tono) y compone ẹ, ọ, ṣ
+	return norm.NFC.String(string(out))
+}
+
+func isToneMark(r rune) bool {
+	return r == combiningGrave || r == combiningAcute || r == combiningMacron
+}
+
+// Bytes de Windows-1252 de los caracteres 0x80-0x9F
+var cp1252 = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b,
+	'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// "áº¹" -> "ẹ": si la palabra solo tiene caracteres de Windows-1252 y sus
+// bytes forman UTF-8 válido con algún carácter multibyte, era mojibake
+func repairMojibake(word string) string {
+	raw := make([]byte, 0, len(word))
+	multibyte := false
+	for _, r := range word {
+		switch b, ok := cp1252[r]; {
+		case ok:
+			raw = append(raw, b)
+		case r < 0x100:
+			raw = append(raw, byte(r))
+		default:
+			return word
+		}
+		if r >= 0x80 {
+			multibyte = true
+		}
+	}
+	if !multibyte || !utf8.Valid(raw) {
+		return word
+	}
+	return string(raw)
+}
+
+// Letras base de la ortografía yorùbá (las marcas se comprueban aparte)
+func isYorubaBase(r rune) bool {
+	return strings.ContainsRune("abdefghijklmnoprstuwy", unicode.ToLower(r))
+}
+
+// Estadísticas con el informe de diacríticos, si se pidió la normalización
+// y la transcripción es yorùbá. raw es el resultado sin formatear.
+func (o *FormatOptions) withDiacritics(stats *TranscriptStats, raw BackendResponse) *TranscriptStats {
+	if o == nil || !o.Diacritics || stats == nil || baseLanguage(raw.Language) != LangYoruba {
+		return stats
+	}
+	withReport := *stats
+	withReport.Diacritics = yorubaDiacritics(raw.Transcription)
+	return &withReport
+}
+
+// Analiza el texto tras normalizarlo; las palabras que cambian cuentan como
+// corregidas
+func yorubaDiacritics(raw string) *DiacriticsReport {
+	report := &DiacriticsReport{}
+	rawWords := strings.Fields(raw)
+	for i, word := range strings.Fields(normalizeYoruba(raw)) {
+		if i < len(rawWords) && rawWords[i] != word {
+			report.FixedWords++
+		}
+		letters, marked, valid := 0, false, true
+		for _, r := range norm.NFD.String(word) {
+			switch {
+			case r == combiningDotBelow || isToneMark(r):
+				marked = true
+			case unicode.Is(unicode.Mn, r):
+				valid = false
+			case unicode.IsLetter(r):
+				letters++
+				if !isYorubaBase(r) {
+					valid = false
+				}
+			}
+		}
+		if letters == 0 {
+			continue
+		}
+		report.Words++
+		if marked {
+			report.MarkedWords++
+		}
+		if !valid && len(report.InvalidWords) < maxReportedInvalidWords {
+			report.InvalidWords = append(report.InvalidWords, word)
+		}
+	}
+	if report.Words > 0 {
+		report.Coverage = round2(float64(report.MarkedWords) / float64(report.Words))
+	}
+	return report
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Ruta de los webhooks de Zoom; no lleva API key, la autentica la firma
+const zoomWebhookPath = "/integrations/zoom"
+
+// Tamaño máximo del cuerpo y antigüedad máxima de x-zm-request-timestamp
+const (
+	maxZoomWebhookBytes = 1 << 20
+	zoomTimestampSkew   = 5 * time.Minute
+)
+
+// Los IDs de los jobs salen del archivo de la grabación, para que un webhook
+// repetido no cree otro job
+var zoomNamespace = uuid.MustParse("9a4d2c61-7e3b-4f08-b5c2-6d1e8f0a3b47")
+
+// Webhook de Zoom: recording.completed o la validación de la URL
+type zoomEvent struct {
+	Event   string `json:"event"`
+	Payload struct {
+		AccountID  string `json:"account_id"`
+		PlainToken string `json:"plainToken"` // endpoint.url_validation
+		Object     struct {
+			ID             json.Number     `json:"id"`
+			UUID           string          `json:"uuid"`
+			Topic          string          `json:"topic"`
+			HostEmail      string          `json:"host_email"`
+			StartTime      string          `json:"start_time"`
+			Duration       int             `json:"duration"` // minutos
+			RecordingFiles []zoomRecording `json:"recording_files"`
+		} `json:"object"`
+	} `json:"payload"`
+}
+
+type zoomRecording struct {
+	ID            string `json:"id"`
+	FileType      string `json:"file_type"` // M4A, MP4, TRANSCRIPT...
+	FileExtension string `json:"file_extension"`
+	FileSize      int64  `json:"file_size"`
+	DownloadURL   string `json:"download_url"`
+	Status        string `json:"status"`
+}
+
+func zoomHMAC(secret, message string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Firma x-zm-signature: v0= y el HMAC-SHA256 de "v0:<timestamp>:<cuerpo>"
+func validZoomSignature(secret, timestamp string, body []byte, signature string) bool {
+	expected := "v0=" + zoomHMAC(secret, "v0:"+timestamp+":"+string(body))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// Marca de tiempo Unix de un webhook firmado, a menos de skew de ahora
+func freshUnixTimestamp(timestamp string, skew time.Duration) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	return err == nil && math.Abs(time.Since(time.Unix(ts, 0)).Seconds()) <= skew.Seconds()
+}
+
+// Audio de la grabación: el M4A (solo audio) o, si no lo hay, el MP4
+func (e *zoomEvent) audioFile() (zoomRecording, bool) {
+	for _, fileType := range []string{"M4A", "MP4"} {
+		for _, f := range e.Payload.Object.RecordingFiles {
+			if f.FileType == fileType && f.DownloadURL != "" && (f.Status == "" || f.Status == "completed") {
+				return f, true
+			}
+		}
+	}
+	return zoomRecording{}, false
+}
+
+// POST /integrations/zoom recibe los webhooks de la app de Zoom. La firma se
+// comprueba con el webhook_secret de las integraciones zoom de la cuenta.
+// Responde a endpoint.url_validation y, con recording.completed, crea un
+// job diarizado con los datos de la reunión en metadata; la grabación se
+// descarga con el token OAuth al ejecutarlo, porque Zoom espera respuesta
+// en 3 segundos.
+func zoomWebhookHandler(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxZoomWebhookBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var event zoomEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Zoom event", "code": "INVALID_REQUEST"})
+		return
+	}
+	timestamp := c.GetHeader("x-zm-request-timestamp")
+	if !freshUnixTimestamp(timestamp, zoomTimestampSkew) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "missing or stale Zoom request timestamp", "code": "FORBIDDEN"})
+		return
+	}
+	signature := c.GetHeader("x-zm-signature")
+	var item *Integration
+	for _, candidate := range integrations.accounts(ProviderZoom, event.Payload.AccountID) {
+		if validZoomSignature(candidate.token.WebhookSecret, timestamp, body, signature) {
+			candidate := candidate
+			item = &candidate
+			break
+		}
+	}
+	if item == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid Zoom signature", "code": "FORBIDDEN"})
+		return
+	}
+
+	switch event.Event {
+	case "endpoint.url_validation":
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.JSON(http.StatusOK, gin.H{
+			"plainToken":     event.Payload.PlainToken,
+			"encryptedToken": zoomHMAC(item.token.WebhookSecret, event.Payload.PlainToken),
+		})
+	case "recording.completed":
+		jobID, err := createZoomJob(*item, &event)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": "INVALID_REQUEST"})
+			return
+		}
+		if jobID == "" {
+			// Sin audio (p. ej. solo el chat)
+			c.Status(http.StatusNoContent)
+			return
+		}
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.JSON(http.StatusOK, gin.H{"job_id": jobID})
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// Crea el job de la grabación, salvo que ya exista. Devuelve su ID, vacío
+// si la grabación no trae audio.
+func createZoomJob(item Integration, event *zoomEvent) (string, error) {
+	file, ok := event.audioFile()
+	if !ok {
+		return "", nil
+	}
+	if cfg.MaxDownloadMB > 0 && file.FileSize > cfg.MaxDownloadMB*1024*1024 {
+		return "", errTooLarge
+	}
+	if _, err := zoomDownloadURL(file.DownloadURL); err != nil {
+		return "", err
+	}
+	jobID := uuid.NewSHA1(zoomNamespace, []byte(item.ID+"/"+file.ID)).String()
+	input := RequestBody{}
+	if item.Template != "" {
+		if _, err := applyTemplate(item.tenant, item.Template, &input); err != nil {
+			return "", err
+		}
+	}
+	meeting := event.Payload.Object
+	input.Type = JobTypeTranscription
+	input.Diarize = true
+	input.Metadata = map[string]string{"integration_id": item.ID}
+	for k, v := range map[string]string{
+		"zoom_meeting_id":   meeting.ID.String(),
+		"zoom_meeting_uuid": meeting.UUID,
+		"zoom_topic":        meeting.Topic,
+		"zoom_host_email":   meeting.HostEmail,
+		"zoom_start_time":   meeting.StartTime,
+		"zoom_duration":     strconv.Itoa(meeting.Duration),
+	} {
+		if v != "" && v != "0" && len(v) <= maxMetadataValueLength {
+			input.Metadata[k] = v
+		}
+	}
+	ext := strings.ToLower(file.FileExtension)
+	if ext == "" {
+		ext = strings.ToLower(file.FileType)
+	}
+	source := &jobSource{Kind: ProviderZoom, Key: file.ID, Integration: item.ID, Name: meeting.Topic + "." + ext, URL: file.DownloadURL}
+	if len(source.Name) > maxMetadataValueLength {
+		source.Name = file.ID + "." + ext
+	}
+	if createSourcedJob(jobID, item.tenant, input, source) {
+		jobLogf(jobID, "🚀 Job %s creado desde %s", jobID, source)
+	}
+	return jobID, nil
+}
+
+// download_url de un host de ZOOM_DOWNLOAD_HOSTS: solo a ellos se envía el
+// token OAuth
+func zoomDownloadURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, errors.New("invalid Zoom download_url")
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range cfg.ZoomDownloadHosts {
+		h = strings.ToLower(h)
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return u, nil
+		}
+	}
+	return nil, errors.Errorf("Zoom download_url host %q is not in ZOOM_DOWNLOAD_HOSTS", host)
+}
+
+// Descarga la grabación del job a un upload del tenant con el token OAuth
+// de su integración y devuelve el upload_id
+func stageZoomRecording(meta jobMeta) (string, error) {
+	item, ok := integrations.lookup(meta.Source.Integration)
+	if !ok {
+		return "", errors.New("zoom integration no longer exists")
+	}
+	u, err := zoomDownloadURL(meta.Source.URL)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DownloadTimeout.Duration)
+	defer cancel()
+	var uploadID string
+	err = withAccessToken(&http.Client{Timeout: cfg.IntegrationTimeout.Duration}, item, func(accessToken string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return errors.Wrap(err, "invalid recording request")
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return errors.Wrap(err, "failed to download recording")
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+			return &providerError{status: resp.StatusCode, body: strings.TrimSpace(string(data))}
+		}
+		if cfg.MaxDownloadMB > 0 && resp.ContentLength > cfg.MaxDownloadMB*1024*1024 {
+			return errTooLarge
+		}
+		uploadID, err = stageSourceMedia(ctx, meta.Tenant, path.Ext(meta.Source.Name), resp.Body, resp.ContentLength)
+		return err
+	})
+	return uploadID, err
+}
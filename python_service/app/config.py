@@ -16,6 +16,21 @@ class Settings(BaseSettings):
     # Configuración de Whisper
     WHISPER_MODEL: str = "large"
     WHISPER_FP16: bool = False
+
+    # Jobs del protocolo v2 (POST /jobs): se guardan en disco para seguir
+    # tras un reinicio y se olvidan pasado el TTL una vez terminados
+    JOBS_DIR: str = "jobs"
+    JOB_RESULT_TTL_SECONDS: int = 3600  # 1 hora
+    CALLBACK_TIMEOUT_SECONDS: int = 10
+
+    # Puerto del servidor gRPC (backends grpc:// del gateway); 0 = desactivado
+    GRPC_PORT: int = 0
+
+    # Workers Celery (backends celery+redis:// del gateway): broker, result
+    # backend y cola de la que consumen
+    CELERY_BROKER_URL: str = "redis://redis:6379/0"
+    CELERY_RESULT_BACKEND: Optional[str] = None  # vacío = el broker
+    CELERY_QUEUE: str = "celery"
     
     # Configuración de OpenAI
     OPENAI_API_KEY: Optional[str] = None
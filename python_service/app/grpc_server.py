@@ -0,0 +1,141 @@
+"""Servidor gRPC del backend (proto/whisper_backend.proto).
+
+El gateway Go lo usa con los backends de WHISPER_BACKENDS en grpc://. Los
+módulos whisper_backend_pb2* los genera grpc_tools.protoc al construir la
+imagen; este módulo solo se importa con GRPC_PORT distinto de 0.
+"""
+import asyncio
+import logging
+from typing import Optional
+
+import grpc
+from fastapi import HTTPException
+from pydantic import ValidationError
+
+import whisper_backend_pb2 as pb
+import whisper_backend_pb2_grpc as pb_grpc
+
+from app import main
+
+logger = logging.getLogger(__name__)
+
+# Espera a las transcripciones en curso al apagar, tras avisarles
+SHUTDOWN_GRACE_SECONDS = 5
+
+server: Optional[grpc.aio.Server] = None
+stopping = asyncio.Event()
+
+def segment_message(seg: dict) -> "pb.Segment":
+    return pb.Segment(
+        id=seg["id"],
+        start=seg["start"],
+        end=seg["end"],
+        text=seg["text"],
+        avg_logprob=seg.get("avg_logprob"),
+        no_speech_prob=seg.get("no_speech_prob"),
+        words=[
+            pb.Word(word=w["word"], start=w["start"], end=w["end"], probability=w.get("probability") or 0.0)
+            for w in seg.get("words", [])
+        ],
+    )
+
+def result_message(result: dict) -> "pb.Result":
+    return pb.Result(
+        transcription=result["transcription"],
+        translation=result.get("translation") or "",
+        language=result.get("language") or "",
+        model_used=result.get("model_used") or "",
+        segments=[segment_message(seg) for seg in result["segments"]],
+    )
+
+async def cancel_reason(request_iterator) -> str:
+    """Espera al Cancel del gateway; si solo cierra su lado, no termina."""
+    async for msg in request_iterator:
+        if msg.WhichOneof("input") == "cancel":
+            return msg.cancel.reason or "cancelled by gateway"
+    await asyncio.Event().wait()
+
+class WhisperBackendServicer(pb_grpc.WhisperBackendServicer):
+    async def Transcribe(self, request_iterator, context):
+        try:
+            first = await request_iterator.__anext__()
+        except StopAsyncIteration:
+            first = None
+        if first is None or first.WhichOneof("input") != "request":
+            await context.abort(grpc.StatusCode.INVALID_ARGUMENT, "first message must be a TranscribeRequest")
+        r = first.request
+        main.request_id_var.set(r.request_id or "-")
+        try:
+            req = main.TranscribeRequest(
+                url=r.url or None,
+                file_path=r.file_path or None,
+                language=r.language,
+                translate=r.translate,
+                model=r.model or "large",
+                initial_prompt=r.initial_prompt or None,
+                clip_timestamps=list(r.clip_timestamps) or None,
+            )
+        except ValidationError as e:
+            await context.abort(grpc.StatusCode.INVALID_ARGUMENT, str(e))
+
+        main.in_progress += 1
+        transcription = asyncio.ensure_future(main.run_transcription(req))
+        cancelled = asyncio.ensure_future(cancel_reason(request_iterator))
+        shutdown = asyncio.ensure_future(stopping.wait())
+        try:
+            done, _ = await asyncio.wait({transcription, cancelled, shutdown}, return_when=asyncio.FIRST_COMPLETED)
+        finally:
+            main.in_progress -= 1
+            for task in (transcription, cancelled, shutdown):
+                if not task.done():
+                    task.cancel()
+
+        if transcription in done:
+            try:
+                result = transcription.result()
+            except Exception as e:
+                logger.error(f"Processing error: {str(e)}", exc_info=True)
+                await context.abort(grpc.StatusCode.INTERNAL, str(e))
+            # whisper devuelve los segmentos al terminar: se mandan antes del
+            # Result para que el gateway los publique igual que en streaming
+            for seg in result["segments"]:
+                yield pb.TranscribeEvent(segment=segment_message(seg))
+            yield pb.TranscribeEvent(result=result_message(result))
+        elif cancelled in done:
+            reason = cancelled.result()
+            logger.info(f"Transcription cancelled by gateway: {reason}")
+            await context.abort(grpc.StatusCode.CANCELLED, reason)
+        else:
+            # Apagándose: el gateway repite la transcripción en otro backend
+            yield pb.TranscribeEvent(cancelled=pb.Cancelled(reason="backend shutting down"))
+            await context.abort(grpc.StatusCode.CANCELLED, "backend shutting down")
+
+    async def Warmup(self, request, context):
+        try:
+            body = await main.warmup(main.WarmupRequest(model=request.model or None))
+        except HTTPException as e:
+            await context.abort(grpc.StatusCode.INVALID_ARGUMENT, e.detail["error"])
+        return pb.WarmupReply(model=body["model"], load_seconds=body["load_seconds"])
+
+    async def Capacity(self, request, context):
+        body = await main.capacity()
+        return pb.CapacityReply(
+            queue_length=body["queue_length"],
+            gpu_memory_used_mb=body.get("gpu_memory_used_mb", 0.0),
+            gpu_memory_total_mb=body.get("gpu_memory_total_mb", 0.0),
+            model_loaded=body["model_loaded"],
+        )
+
+async def start(port: int) -> None:
+    global server
+    server = grpc.aio.server()
+    pb_grpc.add_WhisperBackendServicer_to_server(WhisperBackendServicer(), server)
+    server.add_insecure_port(f"[::]:{port}")
+    await server.start()
+    logger.info(f"gRPC server listening on port {port}")
+
+async def stop() -> None:
+    if server is None:
+        return
+    stopping.set()
+    await server.stop(SHUTDOWN_GRACE_SECONDS)
@@ -1,31 +1,64 @@
-from fastapi import FastAPI, HTTPException, status
+from fastapi import FastAPI, Header, HTTPException, status
 from fastapi.responses import JSONResponse
-from pydantic import BaseModel, HttpUrl, validator
+from pydantic import BaseModel, HttpUrl, root_validator, validator
 from app.downloader import download_audio
-from app.transcriber import transcribe_audio
+from app.transcriber import transcribe_audio, warm_up
 from app.translator import translate_text
-from typing import Optional
+from app.config import settings
+from typing import Dict, List, Optional
+from contextvars import ContextVar
+import asyncio
+import json
 import logging
+import os
+import re
+import time
+import urllib.request
 from datetime import datetime
 
+# X-Request-ID que reenvía el gateway Go, para seguir un job de punta a punta
+request_id_var: ContextVar[str] = ContextVar("request_id", default="-")
+
+class RequestIDFilter(logging.Filter):
+    def filter(self, record):
+        record.request_id = request_id_var.get()
+        return True
+
 # Configurar logging
 logging.basicConfig(
     level=logging.INFO,
-    format='%(asctime)s - %(levelname)s - %(message)s'
+    format='%(asctime)s - %(levelname)s - [%(request_id)s] %(message)s'
 )
+for handler in logging.getLogger().handlers:
+    handler.addFilter(RequestIDFilter())
 logger = logging.getLogger(__name__)
 
 app = FastAPI(title="YouTube Transcriber API", version="1.0.0")
 
+# Peticiones de transcripción en curso (reportadas en /capacity)
+in_progress = 0
+
 class TranscribeRequest(BaseModel):
-    url: HttpUrl                          # URL del video de YouTube
-    language: str = "en"                  # Idioma original del audio
+    url: Optional[HttpUrl] = None         # URL del video de YouTube; sin ella, file_path (p. ej. medios sftp://)
+    file_path: Optional[str] = None       # Medio ya descargado por el gateway (volumen compartido)
+    language: Optional[str] = "en"        # Idioma original del audio; vacío = lo detecta whisper
     translate: bool = True                # Si se debe traducir o no
     model: Optional[str] = "large"        # Modelo Whisper a usar
     fp16: Optional[bool] = False          # Modo FP16 (GPU). False si CPU
+    initial_prompt: Optional[str] = None  # Contexto de la primera pasada (accuracy high)
+    clip_timestamps: Optional[List[float]] = None  # Regiones con voz [inicio, fin, ...] en segundos
+
+    @root_validator(skip_on_failure=True)
+    def require_media(cls, values):
+        if not values.get('url') and not values.get('file_path'):
+            raise ValueError("url or file_path is required")
+        return values
 
     @validator('language')
     def validate_language(cls, v):
+        # Vacío: detección del gateway (only_if_language) o idioma desconocido
+        if not v:
+            return None
         # Lista de idiomas soportados
         supported_languages = [
             "en", "es", "fr", "de", "it", "pt", "nl", "ru", "zh", "ja", "yo"
@@ -40,49 +73,99 @@ class TranscribeRequest(BaseModel):
             raise ValueError("Model must be one of: tiny, base, small, medium, large")
         return v
 
-@app.post("/transcribe", status_code=status.HTTP_200_OK)
-async def transcribe_and_translate(req: TranscribeRequest):
+@app.get("/capacity")
+async def capacity():
+    """Capacidad actual del backend, consultada periódicamente por el gateway Go."""
+    result = {
+        "queue_length": in_progress,
+        "model_loaded": settings.WHISPER_MODEL,
+        "protocol": 2,  # admite POST /jobs además de POST /transcribe
+    }
     try:
-        log_data = {
-            "url": req.url,
-            "language": req.language,
-            "translate": req.translate,
-            "model": req.model,
-            "fp16": req.fp16
-        }
-        logger.info("Transcription request received", extra={"data": log_data})
-
-        # Paso 1: Descargar el audio del video de YouTube
+        import torch
+        if torch.cuda.is_available():
+            result["gpu_memory_used_mb"] = torch.cuda.memory_allocated() / (1024 * 1024)
+            result["gpu_memory_total_mb"] = torch.cuda.get_device_properties(0).total_memory / (1024 * 1024)
+    except ImportError:
+        pass
+    return result
+
+class WarmupRequest(BaseModel):
+    model: Optional[str] = None  # vacío = WHISPER_MODEL
+
+@app.post("/warmup")
+async def warmup(req: WarmupRequest):
+    """Carga el modelo antes del primer job; el gateway lo llama al arrancar y tras un tiempo sin jobs."""
+    model = req.model or settings.WHISPER_MODEL
+    try:
+        seconds = await asyncio.to_thread(warm_up, model, settings.WHISPER_FP16)
+    except ValueError as e:
+        raise HTTPException(status_code=status.HTTP_400_BAD_REQUEST, detail={"error": str(e)})
+    logger.info(f"Model {model} warmed up in {seconds:.1f}s")
+    return {"model": model, "load_seconds": seconds}
+
+async def run_transcription(req: TranscribeRequest) -> dict:
+    """Descarga, transcribe y traduce; la respuesta de POST /transcribe."""
+    log_data = {
+        "url": req.url,
+        "language": req.language,
+        "translate": req.translate,
+        "model": req.model,
+        "fp16": req.fp16
+    }
+    logger.info("Transcription request received", extra={"data": log_data})
+
+    # Paso 1: Descargar el audio del video de YouTube (salvo que el gateway ya lo hizo)
+    if req.file_path:
+        logger.info(f"Using media downloaded by gateway: {req.file_path}")
+        audio_path = req.file_path
+    else:
         logger.info("Downloading audio from YouTube...")
         audio_path = await download_audio(req.url)
 
-        # Paso 2: Transcribir el audio usando Whisper
-        logger.info(f"Transcribing audio with model: {req.model}")
-        transcription = await transcribe_audio(
-            file_path=audio_path,
-            language=req.language,
-            model=req.model,
-            fp16=req.fp16
-        )
+    # Paso 2: Transcribir el audio usando Whisper
+    logger.info(f"Transcribing audio with model: {req.model}")
+    transcribed = await transcribe_audio(
+        file_path=audio_path,
+        language=req.language,
+        model=req.model,
+        fp16=req.fp16,
+        initial_prompt=req.initial_prompt,
+        clip_timestamps=req.clip_timestamps
+    )
+    transcription = transcribed["text"]
+
+    logger.info("Transcription completed")
+    result = {
+        "transcription": transcription,
+        "timestamp": datetime.utcnow().isoformat(),
+        "model_used": req.model,
+        "language": transcribed["language"] or req.language,
+        "segments": transcribed["segments"]
+    }
+
+    # Paso 3: Traducir si se solicita
+    if req.translate:
+        target_language = req.language or result["language"]
+        logger.info(f"Translating text to: {target_language}")
+        translation = await translate_text(transcription, target_language=target_language)
+        result["translation"] = translation
 
-        logger.info("Transcription completed")
-        result = {
-            "transcription": transcription,
-            "timestamp": datetime.utcnow().isoformat(),
-            "model_used": req.model,
-            "language": req.language
-        }
-
-        # Paso 3: Traducir si se solicita
-        if req.translate:
-            logger.info(f"Translating text to: {req.language}")
-            translation = await translate_text(transcription, target_language=req.language)
-            result["translation"] = translation
-
-        logger.info("Request processed successfully")
+    logger.info("Request processed successfully")
+    return result
+
+@app.post("/transcribe", status_code=status.HTTP_200_OK)
+async def transcribe_and_translate(req: TranscribeRequest, x_request_id: Optional[str] = Header(None)):
+    global in_progress
+    in_progress += 1
+    request_id_var.set(x_request_id or "-")
+    headers = {"X-Request-ID": x_request_id} if x_request_id else None
+    try:
+        result = await run_transcription(req)
         return JSONResponse(
             content=result,
-            media_type="application/json; charset=utf-8"
+            media_type="application/json; charset=utf-8",
+            headers=headers
         )
 
     except HTTPException:
@@ -93,6 +176,175 @@ async def transcribe_and_translate(req: TranscribeRequest):
             status_code=status.HTTP_500_INTERNAL_SERVER_ERROR,
             detail={
                 "error": str(e),
+                "request_id": x_request_id,
                 "timestamp": datetime.utcnow().isoformat()
-            }
+            },
+            headers=headers
         )
+    finally:
+        in_progress -= 1
+
+# Protocolo v2: el gateway encola con POST /jobs y sabe que terminó por el
+# callback_url o consultando GET /jobs/{job_id}, sin una conexión abierta
+# durante toda la transcripción. Los jobs se guardan en JOBS_DIR: tras un
+# reinicio los que no terminaron vuelven a empezar.
+
+class JobRequest(TranscribeRequest):
+    job_id: str                           # lo elige el gateway; repetido devuelve el mismo job
+    callback_url: Optional[str] = None    # POST {"job_id", "status"} al terminar
+
+    @validator('job_id')
+    def validate_job_id(cls, v):
+        if not re.fullmatch(r"[A-Za-z0-9_-]{1,128}", v):
+            raise ValueError("job_id must be 1-128 letters, digits, '-' or '_'")
+        return v
+
+# job_id -> {"job_id", "status", "request", "request_id", "result", "error", "finished_at"}
+jobs: Dict[str, dict] = {}
+job_tasks: Dict[str, asyncio.Task] = {}
+
+def job_path(job_id: str) -> str:
+    return os.path.join(settings.JOBS_DIR, f"{job_id}.json")
+
+def save_job(job: dict) -> None:
+    """Escribe el job de forma atómica para no dejarlo a medias en un reinicio."""
+    os.makedirs(settings.JOBS_DIR, exist_ok=True)
+    tmp = job_path(job["job_id"]) + ".tmp"
+    with open(tmp, "w", encoding="utf-8") as f:
+        json.dump(job, f, ensure_ascii=False)
+    os.replace(tmp, job_path(job["job_id"]))
+
+def forget_job(job_id: str) -> None:
+    jobs.pop(job_id, None)
+    task = job_tasks.pop(job_id, None)
+    if task and not task.done():
+        task.cancel()
+    try:
+        os.remove(job_path(job_id))
+    except FileNotFoundError:
+        pass
+
+def job_view(job: dict) -> dict:
+    view = {"job_id": job["job_id"], "status": job["status"]}
+    if job["status"] == "completed":
+        view["result"] = job["result"]
+    elif job["status"] == "failed":
+        view["error"] = job["error"]
+        view["retryable"] = True
+    return view
+
+def prune_jobs() -> None:
+    """Olvida los jobs terminados hace más de JOB_RESULT_TTL_SECONDS."""
+    now = time.time()
+    for job_id, job in list(jobs.items()):
+        finished = job.get("finished_at")
+        if finished and now - finished > settings.JOB_RESULT_TTL_SECONDS:
+            forget_job(job_id)
+
+def post_callback(url: str, body: dict) -> None:
+    req = urllib.request.Request(
+        url,
+        data=json.dumps(body).encode("utf-8"),
+        headers={"Content-Type": "application/json; charset=utf-8"},
+        method="POST"
+    )
+    with urllib.request.urlopen(req, timeout=settings.CALLBACK_TIMEOUT_SECONDS):
+        pass
+
+async def run_job(job_id: str) -> None:
+    global in_progress
+    job = jobs[job_id]
+    request_id_var.set(job.get("request_id") or "-")
+    in_progress += 1
+    job["status"] = "running"
+    save_job(job)
+    try:
+        job["result"] = await run_transcription(JobRequest(**job["request"]))
+        job["status"] = "completed"
+    except asyncio.CancelledError:
+        raise
+    except Exception as e:
+        logger.error(f"Job {job_id} failed: {str(e)}", exc_info=True)
+        job["status"] = "failed"
+        job["error"] = str(e)
+    finally:
+        in_progress -= 1
+    job["finished_at"] = time.time()
+    save_job(job)
+
+    callback_url = job["request"].get("callback_url")
+    if callback_url:
+        try:
+            await asyncio.to_thread(post_callback, callback_url, {"job_id": job_id, "status": job["status"]})
+        except Exception as e:
+            # El gateway sondea igualmente: el callback solo adelanta el aviso
+            logger.warning(f"Callback of job {job_id} failed: {str(e)}")
+
+def start_job(job_id: str) -> None:
+    job_tasks[job_id] = asyncio.create_task(run_job(job_id))
+
+@app.on_event("startup")
+async def resume_jobs():
+    """Recupera los jobs guardados y vuelve a empezar los que no terminaron."""
+    if not os.path.isdir(settings.JOBS_DIR):
+        return
+    for name in os.listdir(settings.JOBS_DIR):
+        if not name.endswith(".json"):
+            continue
+        try:
+            with open(os.path.join(settings.JOBS_DIR, name), encoding="utf-8") as f:
+                job = json.load(f)
+        except (OSError, ValueError) as e:
+            logger.warning(f"Ignoring unreadable job file {name}: {str(e)}")
+            continue
+        jobs[job["job_id"]] = job
+        if job["status"] in ("queued", "running"):
+            logger.info(f"Resuming job {job['job_id']} after restart")
+            job["status"] = "queued"
+            start_job(job["job_id"])
+    prune_jobs()
+
+@app.on_event("startup")
+async def start_grpc_server():
+    """Contrato gRPC (proto/whisper_backend.proto) junto a la API HTTP."""
+    if settings.GRPC_PORT:
+        from app import grpc_server
+        await grpc_server.start(settings.GRPC_PORT)
+
+@app.on_event("shutdown")
+async def stop_grpc_server():
+    """Avisa a las transcripciones gRPC en curso para que el gateway las repita."""
+    if settings.GRPC_PORT:
+        from app import grpc_server
+        await grpc_server.stop()
+
+@app.post("/jobs", status_code=status.HTTP_202_ACCEPTED)
+async def create_job(req: JobRequest, x_request_id: Optional[str] = Header(None)):
+    prune_jobs()
+    job = jobs.get(req.job_id)
+    if job and job["status"] != "failed":
+        return JSONResponse(content=job_view(job), status_code=status.HTTP_200_OK, media_type="application/json; charset=utf-8")
+    job = {
+        "job_id": req.job_id,
+        "status": "queued",
+        "request": json.loads(req.json()),
+        "request_id": x_request_id,
+    }
+    jobs[req.job_id] = job
+    save_job(job)
+    start_job(req.job_id)
+    return JSONResponse(content=job_view(job), status_code=status.HTTP_202_ACCEPTED, media_type="application/json; charset=utf-8")
+
+@app.get("/jobs/{job_id}")
+async def get_job(job_id: str):
+    job = jobs.get(job_id)
+    if not job:
+        raise HTTPException(status_code=status.HTTP_404_NOT_FOUND, detail={"error": "job not found"})
+    return JSONResponse(content=job_view(job), media_type="application/json; charset=utf-8")
+
+@app.delete("/jobs/{job_id}", status_code=status.HTTP_204_NO_CONTENT)
+async def delete_job(job_id: str):
+    """El gateway ya recogió el resultado o abandonó el job (se cancela)."""
+    if job_id not in jobs:
+        raise HTTPException(status_code=status.HTTP_404_NOT_FOUND, detail={"error": "job not found"})
+    forget_job(job_id)
@@ -1,8 +1,11 @@
 import os
+import time
+import unicodedata
+import numpy as np
 import whisper
 import mimetypes
 from pathlib import Path
-from typing import Optional
+from typing import Optional, Any, Dict, List
 import logging
 from app.config import settings
 
@@ -50,13 +53,31 @@ def validate_model(model: str) -> str:
         )
     return model
 
+# Modelos ya cargados: solo el primer job (o el calentamiento) paga la carga
+loaded_models: Dict[str, Any] = {}
+
+def load_model(model: str) -> Any:
+    if model not in loaded_models:
+        logger.info(f"Cargando modelo Whisper: {model}")
+        loaded_models[model] = whisper.load_model(model)
+    return loaded_models[model]
+
+def warm_up(model: str, fp16: bool = False) -> float:
+    """Carga el modelo y transcribe un segundo de silencio; devuelve los segundos que tardó."""
+    start = time.monotonic()
+    whisper_model = load_model(validate_model(model))
+    whisper_model.transcribe(np.zeros(16000, dtype=np.float32), fp16=fp16, language="en", verbose=None)
+    return time.monotonic() - start
+
 async def transcribe_audio(
     file_path: str,
     language: Optional[str] = None,
     model: str = "large",
     fp16: bool = False,
-    sample_rate: int = 16000
-) -> str:
+    sample_rate: int = 16000,
+    initial_prompt: Optional[str] = None,
+    clip_timestamps: Optional[List[float]] = None
+) -> Dict[str, Any]:
     """
     Transcribe un archivo de audio usando Whisper con parámetros configurables.
     Especialmente optimizado para idiomas con caracteres especiales como Yorùbá.
@@ -66,7 +87,10 @@ async def transcribe_audio(
     :param model: Modelo Whisper a usar ('tiny', 'base', 'small', 'medium', 'large')
     :param fp16: True para usar precisión FP16 (requiere GPU). False para CPU (por defecto).
     :param sample_rate: Tasa de muestreo para el audio (por defecto 16000)
-    :return: Texto transcrito manteniendo caracteres especiales
+    :param initial_prompt: Texto previo que orienta el vocabulario (segunda pasada)
+    :param clip_timestamps: Regiones a transcribir [inicio, fin, ...] en segundos
+    :return: Diccionario con el texto (manteniendo caracteres especiales), los
+             segmentos con marcas de tiempo por palabra y el idioma detectado
     """
     try:
         # Validar archivo y modelo
@@ -88,10 +112,13 @@ async def transcribe_audio(
             "best_of": 5,    # Para mejor precisión con caracteres especiales
             "temperature": 0.0  # Para resultados más consistentes
         }
+        if initial_prompt:
+            options["initial_prompt"] = initial_prompt
+        if clip_timestamps:
+            options["clip_timestamps"] = clip_timestamps
 
-        # Cargar modelo
-        logger.info(f"Cargando modelo Whisper: {model}")
-        whisper_model = whisper.load_model(model)
+        # Cargar modelo (o reutilizar el ya cargado)
+        whisper_model = load_model(model)
 
         # Transcribir con manejo especial de caracteres
         logger.info(f"Transcribiendo audio... (language={language}, fp16={fp16})")
@@ -104,10 +131,37 @@ async def transcribe_audio(
         text = result["text"]
         logger.info(f"Transcripción completada. Primera parte: {text[:200]}")
 
-        # Asegurar que el texto esté en UTF-8
-        text = text.encode('utf-8').decode('utf-8')
+        # Componer en NFC: whisper puede devolver los tonos del yorùbá como
+        # marcas combinantes sueltas
+        text = unicodedata.normalize("NFC", text)
+
+        segments = [
+            {
+                "id": seg["id"],
+                "start": seg["start"],
+                "end": seg["end"],
+                "text": unicodedata.normalize("NFC", seg["text"]),
+                # Confianza de whisper; el gateway la conserva en el segmento
+                "avg_logprob": seg.get("avg_logprob"),
+                "no_speech_prob": seg.get("no_speech_prob"),
+                "words": [
+                    {
+                        "word": unicodedata.normalize("NFC", w["word"]),
+                        "start": w["start"],
+                        "end": w["end"],
+                        "probability": w.get("probability", 0.0),
+                    }
+                    for w in seg.get("words", [])
+                ],
+            }
+            for seg in result.get("segments", [])
+        ]
 
-        return text
+        return {
+            "text": text,
+            "segments": segments,
+            "language": result.get("language", language),
+        }
 
     except FileNotFoundError as e:
         logger.error(f"Error de archivo: {str(e)}")
@@ -0,0 +1,44 @@
+"""Worker Celery que consume la cola de los backends celery+redis:// del gateway.
+
+Arranca con: celery -A app.worker worker --concurrency=1
+La tarea recibe la petición de POST /transcribe y devuelve su respuesta,
+que el gateway lee del result backend.
+"""
+import asyncio
+from typing import Optional
+
+from celery import Celery
+
+from app.config import settings
+from app.main import TranscribeRequest, logger, request_id_var, run_transcription
+from app.transcriber import warm_up
+
+celery_app = Celery(
+    "whisper",
+    broker=settings.CELERY_BROKER_URL,
+    backend=settings.CELERY_RESULT_BACKEND or settings.CELERY_BROKER_URL,
+)
+celery_app.conf.update(
+    task_serializer="json",
+    result_serializer="json",
+    accept_content=["json"],
+    task_default_queue=settings.CELERY_QUEUE,
+    # Una tarea a medias cuando el worker muere vuelve a la cola
+    task_acks_late=True,
+    task_reject_on_worker_lost=True,
+    worker_prefetch_multiplier=1,
+    result_expires=settings.JOB_RESULT_TTL_SECONDS,
+)
+
+@celery_app.task(name="whisper.transcribe")
+def transcribe(request: dict, request_id: Optional[str] = None) -> dict:
+    request_id_var.set(request_id or "-")
+    logger.info("Celery task received")
+    return asyncio.run(run_transcription(TranscribeRequest(**request)))
+
+@celery_app.task(name="whisper.warmup")
+def warmup(model: Optional[str] = None) -> dict:
+    model = model or settings.WHISPER_MODEL
+    seconds = warm_up(model, settings.WHISPER_FP16)
+    logger.info(f"Model {model} warmed up in {seconds:.1f}s")
+    return {"model": model, "load_seconds": seconds}